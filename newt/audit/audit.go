@@ -0,0 +1,237 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package audit matches the project's installed repos against a feed of
+// known vulnerabilities.  A feed is a YAML file with the following format:
+//
+//     advisories:
+//         - id: CVE-2018-12345
+//           repo: apache-mynewt-core
+//           affected: ">=1.0.0 <1.4.1"
+//           fixed: 1.4.1
+//           url: https://example.com/CVE-2018-12345
+//           summary: Buffer overflow in BLE host
+//
+// The "repo" field is the name the repo is given in project.yml.  The
+// "affected" field uses the same syntax as a project.yml version requirement.
+package audit
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/downloader"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/newt/settings"
+	"mynewt.apache.org/newt/util"
+)
+
+type Advisory struct {
+	Id       string
+	Repo     string
+	Affected []newtutil.RepoVersionReq
+	Fixed    string
+	Url      string
+	Summary  string
+}
+
+// A known vulnerability affecting an installed repo.
+type Finding struct {
+	RepoName string
+	Version  newtutil.RepoVersion
+	Advisory *Advisory
+}
+
+// Determines the location of the vulnerability feed.  An explicitly specified
+// location takes precedence over the "audit.feed" newtrc setting.
+func FeedLocation(override string) string {
+	if override != "" {
+		return override
+	}
+
+	return settings.Newtrc().GetValString("audit.feed", nil)
+}
+
+// Copies a remote feed to a temporary file.  The caller is responsible for
+// deleting the file.
+func downloadFeed(url string) (string, error) {
+	rsp, err := downloader.HttpGet(url)
+	if err != nil {
+		return "", util.FmtNewtError(
+			"Failed to download vulnerability feed: %s", err.Error())
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return "", util.FmtNewtError(
+			"Failed to download vulnerability feed from %s: %s",
+			url, rsp.Status)
+	}
+
+	f, err := ioutil.TempFile("", "newt-audit-feed")
+	if err != nil {
+		return "", util.ChildNewtError(err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, rsp.Body); err != nil {
+		os.Remove(f.Name())
+		return "", util.ChildNewtError(err)
+	}
+
+	return f.Name(), nil
+}
+
+func parseAdvisory(idx int, fields map[string]string) (*Advisory, error) {
+	adv := &Advisory{
+		Id:      fields["id"],
+		Repo:    strings.TrimPrefix(fields["repo"], "@"),
+		Fixed:   fields["fixed"],
+		Url:     fields["url"],
+		Summary: fields["summary"],
+	}
+
+	if adv.Id == "" {
+		return nil, util.FmtNewtError(
+			"advisory %d missing required \"id\" field", idx)
+	}
+	if adv.Repo == "" {
+		return nil, util.FmtNewtError(
+			"advisory %s missing required \"repo\" field", adv.Id)
+	}
+
+	affected := fields["affected"]
+	if affected == "" {
+		return nil, util.FmtNewtError(
+			"advisory %s missing required \"affected\" field", adv.Id)
+	}
+
+	var err error
+	adv.Affected, err = newtutil.ParseRepoVersionReqs(affected)
+	if err != nil {
+		return nil, util.FmtNewtError(
+			"advisory %s contains invalid \"affected\" field: %s",
+			adv.Id, err.Error())
+	}
+
+	return adv, nil
+}
+
+// Reads the vulnerability feed at the specified location (a file path or an
+// http(s) URL).
+func ReadFeed(location string) ([]*Advisory, error) {
+	if location == "" {
+		return nil, util.NewNewtError(
+			"No vulnerability feed specified; use the --feed option or " +
+				"the \"audit.feed\" setting in ~/.newt/repos.yml")
+	}
+
+	path := location
+	if strings.HasPrefix(location, "http://") ||
+		strings.HasPrefix(location, "https://") {
+
+		var err error
+		path, err = downloadFeed(location)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(path)
+	}
+
+	yc, err := newtutil.ReadConfigPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	advisories := []*Advisory{}
+	for i, itf := range cast.ToSlice(yc.GetFirstVal("advisories", nil)) {
+		adv, err := parseAdvisory(i, cast.ToStringMapString(itf))
+		if err != nil {
+			return nil, util.FmtNewtError(
+				"Error in vulnerability feed %s: %s", location, err.Error())
+		}
+		advisories = append(advisories, adv)
+	}
+
+	return advisories, nil
+}
+
+// Matches each installed repo's version against the specified advisories.
+//
+// @return []Finding            The advisories affecting installed repos,
+//                                  sorted by repo name.
+// @return []string             Names of installed repos whose version could
+//                                  not be determined.
+func Audit(proj *project.Project, advisories []*Advisory) (
+	[]Finding, []string, error) {
+
+	repoAdvs := map[string][]*Advisory{}
+	for _, adv := range advisories {
+		repoAdvs[adv.Repo] = append(repoAdvs[adv.Repo], adv)
+	}
+
+	repoNames := []string{}
+	for name, r := range proj.Repos() {
+		if !r.IsLocal() {
+			repoNames = append(repoNames, name)
+		}
+	}
+	sort.Strings(repoNames)
+
+	findings := []Finding{}
+	unknown := []string{}
+	for _, name := range repoNames {
+		advs := repoAdvs[name]
+		if len(advs) == 0 {
+			continue
+		}
+
+		ver, err := proj.GetRepoVersion(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ver == nil {
+			// Not installed.
+			continue
+		}
+		if ver.Commit != "" || !ver.IsNormalized() {
+			unknown = append(unknown, name)
+			continue
+		}
+
+		for _, adv := range advs {
+			if ver.SatisfiesAll(adv.Affected) {
+				findings = append(findings, Finding{
+					RepoName: name,
+					Version:  *ver,
+					Advisory: adv,
+				})
+			}
+		}
+	}
+
+	return findings, unknown, nil
+}
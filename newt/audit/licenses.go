@@ -0,0 +1,315 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// License auditing.  Each package's license is taken from the first of:
+//     1. The "pkg.license" setting in the package's pkg.yml (an SPDX
+//        expression).
+//     2. A license file (LICENSE, COPYING, ...) in the package's directory or
+//        the nearest parent directory within its repo; the license is
+//        identified from the file's text.
+//
+// The licenses are checked against a policy, specified in project.yml or in a
+// separate file (same keys, without the "audit.license_policy" prefix):
+//
+//     audit.license_policy:
+//         allow: Apache-2.0 MIT BSD-2-Clause BSD-3-Clause
+//         deny: GPL-2.0 GPL-3.0
+//
+// A license listed in "deny" is incompatible.  If "allow" is non-empty, any
+// license not listed there is also flagged.  Without a policy, copyleft
+// licenses that are incompatible with distributing closed firmware
+// (DEFAULT_DENIED_LICENSES) are flagged.
+
+package audit
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/project"
+)
+
+const LICENSE_POLICY_KEY = "audit.license_policy"
+
+var DEFAULT_DENIED_LICENSES = []string{
+	"AGPL-3.0",
+	"GPL-2.0",
+	"GPL-3.0",
+}
+
+// The result of checking a package's license against the policy.
+const (
+	LICENSE_STATUS_OK           = "ok"
+	LICENSE_STATUS_MISSING      = "missing"
+	LICENSE_STATUS_UNKNOWN      = "unknown"
+	LICENSE_STATUS_NOT_ALLOWED  = "not-allowed"
+	LICENSE_STATUS_INCOMPATIBLE = "incompatible"
+)
+
+// Identifies a license from the text of a license file.  Patterns are checked
+// in order; more specific licenses come first.
+var licenseTextPatterns = []struct {
+	id string
+	re *regexp.Regexp
+}{
+	{"Apache-2.0", regexp.MustCompile(`(?is)apache license.{0,40}version 2\.0`)},
+	{"AGPL-3.0", regexp.MustCompile(`(?is)gnu affero general public license.{0,40}version 3`)},
+	{"LGPL-2.1", regexp.MustCompile(`(?is)gnu lesser general public license.{0,40}version 2\.1`)},
+	{"LGPL-3.0", regexp.MustCompile(`(?is)gnu lesser general public license.{0,40}version 3`)},
+	{"GPL-2.0", regexp.MustCompile(`(?is)gnu general public license.{0,40}version 2`)},
+	{"GPL-3.0", regexp.MustCompile(`(?is)gnu general public license.{0,40}version 3`)},
+	{"MPL-2.0", regexp.MustCompile(`(?is)mozilla public license.{0,40}2\.0`)},
+	{"BSD-3-Clause", regexp.MustCompile(`(?is)redistribution and use in source and binary forms.*neither the name`)},
+	{"BSD-2-Clause", regexp.MustCompile(`(?is)redistribution and use in source and binary forms`)},
+	{"ISC", regexp.MustCompile(`(?is)permission to use, copy, modify, and(/or)? distribute this software for any purpose`)},
+	{"MIT", regexp.MustCompile(`(?is)permission is hereby granted, free of charge`)},
+	{"Zlib", regexp.MustCompile(`(?is)this software is provided 'as-is'.*altered source versions must be plainly marked`)},
+	{"Unlicense", regexp.MustCompile(`(?is)this is free and unencumbered software released into the public domain`)},
+}
+
+var licenseFileRe = regexp.MustCompile(`(?i)^(license|licence|copying)(\..*)?$`)
+
+type LicensePolicy struct {
+	Allow []string
+	Deny  []string
+}
+
+// The license determined for a package.
+type LicenseEntry struct {
+	Package string `json:"package"`
+	Repo    string `json:"repo"`
+
+	// SPDX expression; "" if none was found.
+	License string `json:"license"`
+
+	// Where the license was found: "pkg.yml" or the path of a license file
+	// relative to the repo.
+	Source string `json:"source"`
+
+	Status string `json:"status"`
+}
+
+func readLicensePolicy(m map[string]interface{}) LicensePolicy {
+	fields := func(key string) []string {
+		var strs []string
+		for _, s := range cast.ToStringSlice(m[key]) {
+			strs = append(strs, strings.Fields(s)...)
+		}
+		return strs
+	}
+
+	return LicensePolicy{
+		Allow: fields("allow"),
+		Deny:  fields("deny"),
+	}
+}
+
+// Reads the license policy from the specified file, or from project.yml if
+// path is empty.  Without a policy, DEFAULT_DENIED_LICENSES are denied.
+func ReadLicensePolicy(proj *project.Project,
+	path string) (LicensePolicy, error) {
+
+	var pol LicensePolicy
+	if path != "" {
+		yc, err := newtutil.ReadConfigPath(path)
+		if err != nil {
+			return pol, err
+		}
+		pol = readLicensePolicy(map[string]interface{}{
+			"allow": yc.GetValStringSlice("allow", nil),
+			"deny":  yc.GetValStringSlice("deny", nil),
+		})
+	} else {
+		pol = readLicensePolicy(
+			proj.Config().GetValStringMap(LICENSE_POLICY_KEY, nil))
+	}
+
+	if len(pol.Allow) == 0 && len(pol.Deny) == 0 {
+		pol.Deny = DEFAULT_DENIED_LICENSES
+	}
+
+	return pol, nil
+}
+
+// Identifies the license in the specified license file.
+//
+// @return string               The SPDX identifier; "" if unrecognized.
+func identifyLicenseFile(path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	// Collapse whitespace so that line breaks don't affect matching.
+	text := strings.Join(strings.Fields(string(b)), " ")
+	for _, p := range licenseTextPatterns {
+		if p.re.MatchString(text) {
+			return p.id
+		}
+	}
+
+	return ""
+}
+
+// Finds the license file that covers the specified directory: one in the
+// directory itself or in the nearest parent, up to the repo's root.
+//
+// @return string               The license file's path; "" if none.
+func findLicenseFile(dir string, root string) string {
+	for {
+		if infos, err := ioutil.ReadDir(dir); err == nil {
+			for _, info := range infos {
+				if info.Mode().IsRegular() &&
+					licenseFileRe.MatchString(info.Name()) {
+
+					return dir + "/" + info.Name()
+				}
+			}
+		}
+
+		if dir == root || !strings.HasPrefix(dir, root+"/") {
+			return ""
+		}
+		dir = filepath.ToSlash(filepath.Dir(dir))
+	}
+}
+
+// Determines a package's license.
+func packageLicense(lpkg *pkg.LocalPackage) LicenseEntry {
+	e := LicenseEntry{
+		Package: lpkg.FullName(),
+		Repo:    lpkg.Repo().Name(),
+	}
+
+	if lic := strings.TrimSpace(lpkg.Desc().License); lic != "" {
+		e.License = lic
+		e.Source = pkg.PACKAGE_FILE_NAME
+		return e
+	}
+
+	root := filepath.ToSlash(filepath.Clean(lpkg.Repo().Path()))
+	path := findLicenseFile(
+		filepath.ToSlash(filepath.Clean(lpkg.BasePath())), root)
+	if path == "" {
+		return e
+	}
+
+	e.Source = strings.TrimPrefix(path, root+"/")
+	e.License = identifyLicenseFile(path)
+	if e.License == "" {
+		e.License = "LicenseRef-unrecognized"
+	}
+
+	return e
+}
+
+func licenseListed(lic string, list []string) bool {
+	for _, l := range list {
+		if strings.EqualFold(lic, l) ||
+			strings.EqualFold(strings.TrimSuffix(lic, "-only"), l) ||
+			strings.EqualFold(strings.TrimSuffix(lic, "-or-later"), l) {
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// Checks a single license identifier against the policy.
+func (pol *LicensePolicy) checkOne(lic string) string {
+	lic = strings.Trim(lic, "() ")
+	switch {
+	case licenseListed(lic, pol.Deny):
+		return LICENSE_STATUS_INCOMPATIBLE
+	case len(pol.Allow) > 0 && !licenseListed(lic, pol.Allow):
+		if lic == "LicenseRef-unrecognized" {
+			return LICENSE_STATUS_UNKNOWN
+		}
+		return LICENSE_STATUS_NOT_ALLOWED
+	case lic == "LicenseRef-unrecognized":
+		return LICENSE_STATUS_UNKNOWN
+	default:
+		return LICENSE_STATUS_OK
+	}
+}
+
+// Checks an SPDX license expression against the policy.  An "OR" expression
+// is acceptable if any alternative is; an "AND" expression only if every
+// component is.  Parentheses are not interpreted.
+func (pol *LicensePolicy) Check(expr string) string {
+	if strings.TrimSpace(expr) == "" {
+		return LICENSE_STATUS_MISSING
+	}
+
+	worst := ""
+	for _, alt := range strings.Split(expr, " OR ") {
+		status := LICENSE_STATUS_OK
+		for _, lic := range strings.Split(alt, " AND ") {
+			if s := pol.checkOne(lic); s != LICENSE_STATUS_OK {
+				status = s
+			}
+		}
+		if status == LICENSE_STATUS_OK {
+			return status
+		}
+		if worst == "" {
+			worst = status
+		}
+	}
+
+	return worst
+}
+
+type licenseEntrySorter []LicenseEntry
+
+func (s licenseEntrySorter) Len() int {
+	return len(s)
+}
+func (s licenseEntrySorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s licenseEntrySorter) Less(i, j int) bool {
+	return s[i].Package < s[j].Package
+}
+
+// Determines the license of each specified package and checks it against the
+// policy.
+//
+// @return []LicenseEntry       One entry per package, sorted by package name.
+func AuditLicenses(lpkgs []*pkg.LocalPackage,
+	pol LicensePolicy) []LicenseEntry {
+
+	entries := make([]LicenseEntry, 0, len(lpkgs))
+	for _, lpkg := range lpkgs {
+		e := packageLicense(lpkg)
+		e.Status = pol.Check(e.License)
+		entries = append(entries, e)
+	}
+	sort.Sort(licenseEntrySorter(entries))
+
+	return entries
+}
@@ -0,0 +1,105 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Downloaded artifacts.  A package can list binary files that it needs but
+// that are not stored in its repo:
+//
+//     pkg.artifacts:
+//         - url: https://example.com/libfoo-1.2.0.a
+//           sha256: 3f0c...
+//           dest: lib/libfoo.a
+//
+// Each artifact is downloaded to the specified path within the package
+// directory when the target is resolved.  An artifact is only downloaded if
+// the file is missing or its digest does not match.
+
+package builder
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/downloader"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/util"
+)
+
+// Reads the artifacts that the specified package depends on.
+func pkgArtifacts(lpkg *pkg.LocalPackage,
+	settings map[string]string) ([]downloader.Artifact, error) {
+
+	entries := lpkg.PkgY.GetSlice("pkg.artifacts", settings)
+
+	artifacts := make([]downloader.Artifact, 0, len(entries))
+	for _, e := range entries {
+		m := cast.ToStringMapString(e.Value)
+		a := downloader.Artifact{
+			Url:    m["url"],
+			Sha256: m["sha256"],
+			Dest:   m["dest"],
+		}
+
+		if a.Url == "" || a.Sha256 == "" || a.Dest == "" {
+			return nil, util.FmtNewtError(
+				"Package %s contains an invalid pkg.artifacts entry; "+
+					"url, sha256, and dest are required", lpkg.FullName())
+		}
+
+		dest := filepath.Clean(a.Dest)
+		if filepath.IsAbs(dest) || dest == ".." ||
+			strings.HasPrefix(dest, "../") {
+
+			return nil, util.FmtNewtError(
+				"Package %s contains an invalid pkg.artifacts entry; "+
+					"dest must be within the package: %s",
+				lpkg.FullName(), a.Dest)
+		}
+
+		artifacts = append(artifacts, a)
+	}
+
+	return artifacts, nil
+}
+
+// Downloads the artifacts of every resolved package.
+func (t *TargetBuilder) fetchArtifacts() error {
+	for _, rpkg := range t.res.MasterSet.Rpkgs {
+		lpkg := rpkg.Lpkg
+
+		artifacts, err := pkgArtifacts(lpkg,
+			t.res.Cfg.AllSettingsForLpkg(lpkg))
+		if err != nil {
+			return err
+		}
+
+		for _, a := range artifacts {
+			if _, err := downloader.FetchArtifact(
+				a, lpkg.BasePath()); err != nil {
+
+				return util.PreNewtError(err,
+					"Failed to fetch artifact for package %s",
+					lpkg.FullName())
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Attestation metadata.  Provisioning systems often need device-class data
+// that newt knows nothing about (e.g., a signing certificate chain or the hash
+// of the boot loader's public key).  Any package in a target (typically the
+// BSP or the target itself) can declare commands that produce such data:
+//
+//     pkg.manifest.attestation:
+//         mcuboot_key_hash: "python3 scripts/key_hash.py"
+//         cert_chain: "cat certs/chain.pem"
+//
+// Each command runs in its package's directory after the image is created.
+// The command's standard output, with surrounding whitespace removed, is
+// written to the "attestation" object of the manifest under the specified
+// name.  The following environment variables are set:
+//
+//     NEWT_TARGET         The full name of the target.
+//     NEWT_IMAGE_PATH     The path of the app image.
+//     NEWT_IMAGE_HASH     The hash of the app image (hex).
+//     NEWT_IMAGE_VERSION  The version of the app image.
+
+package builder
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/image"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/util"
+)
+
+type attestGen struct {
+	lpkg *pkg.LocalPackage
+	name string
+	cmd  string
+}
+
+// Collects the attestation generators declared by the target's packages,
+// sorted by name.
+func (t *TargetBuilder) attestGens() ([]attestGen, error) {
+	genMap := map[string]attestGen{}
+
+	for _, rpkg := range t.res.MasterSet.Rpkgs {
+		lpkg := rpkg.Lpkg
+		m := lpkg.PkgY.GetValStringMapString("pkg.manifest.attestation",
+			t.res.Cfg.AllSettingsForLpkg(lpkg))
+
+		for name, cmd := range m {
+			if other, ok := genMap[name]; ok {
+				return nil, util.FmtNewtError(
+					"Attestation field \"%s\" defined by both %s and %s",
+					name, other.lpkg.FullName(), lpkg.FullName())
+			}
+
+			genMap[name] = attestGen{
+				lpkg: lpkg,
+				name: name,
+				cmd:  cmd,
+			}
+		}
+	}
+
+	names := make([]string, 0, len(genMap))
+	for name, _ := range genMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	gens := make([]attestGen, len(names))
+	for i, name := range names {
+		gens[i] = genMap[name]
+	}
+
+	return gens, nil
+}
+
+func (gen *attestGen) run(env []string) (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", util.ChildNewtError(err)
+	}
+	if err := os.Chdir(gen.lpkg.BasePath()); err != nil {
+		return "", util.ChildNewtError(err)
+	}
+	defer os.Chdir(wd)
+
+	out, err := util.ShellCommand(strings.Fields(gen.cmd), env)
+	if err != nil {
+		return "", util.PreNewtError(err,
+			"Attestation generator \"%s\" of package %s failed",
+			gen.name, gen.lpkg.FullName())
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Runs the target's attestation generators.
+//
+// @return map[string]string    The attestation object to write to the
+//                                  manifest; nil if there are no generators.
+func (t *TargetBuilder) attestation(
+	appImg *image.Image) (map[string]string, error) {
+
+	gens, err := t.attestGens()
+	if err != nil {
+		return nil, err
+	}
+	if len(gens) == 0 {
+		return nil, nil
+	}
+
+	env := []string{
+		"NEWT_TARGET=" + t.GetTarget().FullName(),
+		"NEWT_IMAGE_PATH=" + appImg.TargetImg,
+		fmt.Sprintf("NEWT_IMAGE_HASH=%x", appImg.Hash),
+		"NEWT_IMAGE_VERSION=" + appImg.Version.String(),
+	}
+
+	att := make(map[string]string, len(gens))
+	for _, gen := range gens {
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Generating attestation field %s\n", gen.name)
+
+		val, err := gen.run(env)
+		if err != nil {
+			return nil, err
+		}
+		att[gen.name] = val
+	}
+
+	return att, nil
+}
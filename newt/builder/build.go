@@ -20,16 +20,13 @@
 package builder
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 
 	log "github.com/Sirupsen/logrus"
 
 	"mynewt.apache.org/newt/newt/image"
-	"mynewt.apache.org/newt/newt/interfaces"
 	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/repo"
@@ -57,6 +54,12 @@ type Builder struct {
 	buildName        string
 	linkElf          string
 	injectedSettings map[string]string
+
+	// Packages whose generated files are up to date.
+	genDone map[*pkg.LocalPackage]bool
+
+	// The source files compiled by the most recent build.
+	compileJobs []toolchain.CompilerJob
 }
 
 func NewBuilder(
@@ -75,6 +78,7 @@ func NewBuilder(
 		linkElf:          "",
 		targetBuilder:    t,
 		injectedSettings: map[string]string{},
+		genDone:          map[*pkg.LocalPackage]bool{},
 	}
 
 	for _, rpkg := range rpkgs {
@@ -275,6 +279,16 @@ func (b *Builder) collectCompileEntriesBpkg(bpkg *BuildPackage) (
 	if err != nil {
 		return nil, err
 	}
+	c.SectionPrefixes = b.targetBuilder.placement.sectionPrefixes(
+		bpkg.rpkg.Lpkg)
+
+	// Bring the package's generated dependencies up to date before any of
+	// its source files get compiled.
+	genDeps, err := b.generateDeps(bpkg)
+	if err != nil {
+		return nil, err
+	}
+	c.AddDeps(genDeps...)
 
 	srcDirs := []string{}
 
@@ -384,6 +398,10 @@ func (b *Builder) link(elfName string, linkerScripts []string,
 	}
 
 	c.LinkerScripts = linkerScripts
+	if len(linkerScripts) > 0 {
+		c.LinkerScripts = append(append([]string{}, linkerScripts...),
+			b.targetBuilder.placementScripts()...)
+	}
 	err = c.CompileElf(elfName, pkgNames, keepSymbols, b.linkElf)
 	if err != nil {
 		return err
@@ -490,43 +508,32 @@ func (b *Builder) addSysinitBpkg() (*BuildPackage, error) {
 	return b.addPackage(rpkg)
 }
 
-// Runs build jobs while any remain.  On failure, signals the other workers to
-// stop via the stop channel.  On error, the error object is signaled via the
-// results channel.  On successful completion, nil is signaled via the results
-// channel.
-func buildWorker(
-	id int,
-	jobs <-chan toolchain.CompilerJob,
-	stop chan struct{},
-	results chan error) {
-
-	// Execute each job until failure or until a stop is signalled.
-	for {
-		select {
-		case s := <-stop:
-			// Re-enqueue the stop signal for the other routines.
-			stop <- s
-
-			// Terminate this go routine.
-			results <- nil
-			return
-
-		case j := <-jobs:
-			if err := toolchain.RunJob(j); err != nil {
-				// Stop the other routines.
-				stop <- struct{}{}
-
-				// Report the error back to the master thread and terminate.
-				results <- err
-				return
-			}
+// Compiles the specified source files and archives each package's object
+// files using newt's own job scheduler (see sched.go).
+func (b *Builder) compileAndArchive(entries []toolchain.CompilerJob,
+	bpkgCompilerMap map[*BuildPackage]*toolchain.Compiler) error {
+
+	pkgOf := map[*toolchain.Compiler]*BuildPackage{}
+	for bpkg, c := range bpkgCompilerMap {
+		pkgOf[c] = bpkg
+	}
 
-		default:
-			// Terminate this go routine.
-			results <- nil
-			return
+	sizes := map[string]int64{}
+	jobs := make([]*buildJob, len(entries))
+	for i, entry := range entries {
+		jobs[i] = compileBuildJob(entry, pkgOf[entry.Compiler], sizes)
+	}
+
+	// Archive each package as soon as its files are compiled.
+	archiveJob := func(bpkg *BuildPackage) *buildJob {
+		return &buildJob{
+			run: func() error {
+				return b.createArchive(bpkgCompilerMap[bpkg], bpkg)
+			},
 		}
 	}
+
+	return newBuildSched(jobs, archiveJob).run(newtutil.NewtNumJobs)
 }
 
 func (b *Builder) Build() error {
@@ -551,74 +558,29 @@ func (b *Builder) Build() error {
 		}
 	}
 
-	// Build each file in parallel.
-	jobs := make(chan toolchain.CompilerJob, len(entries))
-	defer close(jobs)
-
-	stop := make(chan struct{}, newtutil.NewtNumJobs)
-	defer close(stop)
-
-	errors := make(chan error, newtutil.NewtNumJobs)
-	defer close(errors)
-
-	for _, entry := range entries {
-		jobs <- entry
-	}
-
-	for i := 0; i < newtutil.NewtNumJobs; i++ {
-		go buildWorker(i, jobs, stop, errors)
+	backend, err := buildBackend()
+	if err != nil {
+		return err
 	}
 
-	var err error
-	for i := 0; i < newtutil.NewtNumJobs; i++ {
-		subErr := <-errors
-		if err == nil && subErr != nil {
-			err = subErr
-		}
+	if backend == BUILD_BACKEND_NINJA {
+		err = b.ninjaBuild(entries, bpkgs, bpkgCompilerMap)
+	} else {
+		err = b.compileAndArchive(entries, bpkgCompilerMap)
 	}
 	if err != nil {
 		return err
 	}
+	b.compileJobs = entries
 
+	compilers := []*toolchain.Compiler{}
 	for _, bpkg := range bpkgs {
-		c := bpkgCompilerMap[bpkg]
-		if c != nil {
-			if err := b.createArchive(c, bpkg); err != nil {
-				return err
-			}
-		}
-	}
-
-	var compileCommands []toolchain.CompileCommand
-
-	for _, bpkg := range bpkgs {
-		c := bpkgCompilerMap[bpkg]
-		if c != nil {
-			compileCommands = append(compileCommands,
-				c.GetCompileCommands()...)
+		if c := bpkgCompilerMap[bpkg]; c != nil {
+			compilers = append(compilers, c)
 		}
 	}
 
-	projectPath := interfaces.GetProject().Path() + "/"
-	for i := range compileCommands {
-		compileCommands[i].Directory = projectPath
-	}
-
-	cmdBytes, err := json.MarshalIndent(compileCommands, "", "    ")
-	if err != nil {
-		log.Error("Unable to encode compilation commands as JSON")
-		return nil
-	}
-
-	cmdPath := b.CompileCmdsPath()
-	errWrite := ioutil.WriteFile(cmdPath, cmdBytes, 0644)
-	if errWrite != nil {
-		return util.FmtNewtError(
-			"Unable to write compile_commands.json file; reason: %s",
-			errWrite.Error())
-	}
-
-	return nil
+	return writeCompileCmds(b.CompileCmdsPath(), b.compileCmds(compilers))
 }
 
 func (b *Builder) Link(linkerScripts []string) error {
@@ -0,0 +1,204 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Build metadata records the inputs that affect every object in a target: the
+// newt version, the format of each generated file, and the compiler
+// package's flags.  It is compared against the current inputs at the start of
+// each build so that newt can explain why a full rebuild happens.  Upgrading
+// newt by itself doesn't trigger a rebuild; only a change in a generated
+// file's format or in the global flags does.
+
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/syscfg"
+	"mynewt.apache.org/newt/newt/sysinit"
+	"mynewt.apache.org/newt/util"
+)
+
+const BUILD_META_FILENAME = "build-meta.json"
+
+type buildMeta struct {
+	NewtVersion string         `json:"newt_version"`
+	Generators  map[string]int `json:"generators"`
+	Profile     string         `json:"build_profile"`
+	Flags       []string       `json:"flags"`
+}
+
+func buildMetaPath(targetName string) string {
+	return TargetBinDir(targetName) + "/" + BUILD_META_FILENAME
+}
+
+func (t *TargetBuilder) curBuildMeta() (*buildMeta, error) {
+	c, err := t.NewCompiler("")
+	if err != nil {
+		return nil, err
+	}
+	ci := c.GetLocalCompilerInfo()
+
+	flags := []string{}
+	flags = append(flags, ci.Cflags...)
+	flags = append(flags, ci.Lflags...)
+	flags = append(flags, ci.Aflags...)
+
+	return &buildMeta{
+		NewtVersion: newtutil.NewtVersionStr,
+		Generators: map[string]int{
+			"syscfg":  syscfg.FORMAT_VERSION,
+			"sysinit": sysinit.FORMAT_VERSION,
+			"flash":   flash.FORMAT_VERSION,
+		},
+		Profile: t.target.BuildProfile,
+		Flags:   util.SortFields(flags...),
+	}, nil
+}
+
+func readBuildMeta(path string) *buildMeta {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	bm := &buildMeta{}
+	if err := json.Unmarshal(data, bm); err != nil {
+		log.Debugf("Ignoring corrupt build metadata %s: %s",
+			path, err.Error())
+		return nil
+	}
+
+	return bm
+}
+
+// Lists the strings in a that aren't in b.
+func stringsMissingFrom(a []string, b []string) []string {
+	bm := make(map[string]bool, len(b))
+	for _, s := range b {
+		bm[s] = true
+	}
+
+	missing := []string{}
+	for _, s := range a {
+		if !bm[s] {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
+
+// Describes how the current build metadata differs from the previous build's.
+// Each returned string is a reason for rebuilding every object in the target.
+func buildMetaChanges(prev *buildMeta, cur *buildMeta) []string {
+	reasons := []string{}
+
+	names := []string{}
+	for name, _ := range cur.Generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		pv, ok := prev.Generators[name]
+		if !ok {
+			continue
+		}
+		if cv := cur.Generators[name]; pv != cv {
+			reasons = append(reasons, fmt.Sprintf(
+				"%s output format changed (%d -> %d)", name, pv, cv))
+		}
+	}
+
+	if prev.Profile != cur.Profile {
+		reasons = append(reasons, fmt.Sprintf(
+			"build profile changed (%s -> %s)", prev.Profile, cur.Profile))
+	}
+
+	added := stringsMissingFrom(cur.Flags, prev.Flags)
+	removed := stringsMissingFrom(prev.Flags, cur.Flags)
+	if len(added) > 0 || len(removed) > 0 {
+		parts := []string{}
+		if len(added) > 0 {
+			parts = append(parts, "added ["+strings.Join(added, " ")+"]")
+		}
+		if len(removed) > 0 {
+			parts = append(parts, "removed ["+strings.Join(removed, " ")+"]")
+		}
+		reasons = append(reasons, "compiler flags changed: "+
+			strings.Join(parts, ", "))
+	}
+
+	return reasons
+}
+
+// Compares the current build inputs against those recorded by the previous
+// build and reports anything that forces a full rebuild.  This must be called
+// before the generated files are written.
+func (t *TargetBuilder) checkBuildMeta() {
+	prev := readBuildMeta(buildMetaPath(t.target.Name()))
+	if prev == nil {
+		return
+	}
+
+	cur, err := t.curBuildMeta()
+	if err != nil {
+		return
+	}
+
+	reasons := buildMetaChanges(prev, cur)
+	if len(reasons) > 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Full rebuild of %s required:\n", t.target.Name())
+		for _, r := range reasons {
+			util.StatusMessage(util.VERBOSITY_DEFAULT, "    * %s\n", r)
+		}
+	} else if prev.NewtVersion != cur.NewtVersion {
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"newt changed since last build (%s -> %s); generated output "+
+				"formats unchanged, no full rebuild required\n",
+			prev.NewtVersion, cur.NewtVersion)
+	}
+}
+
+// Records the current build inputs for comparison by the next build.
+func (t *TargetBuilder) writeBuildMeta() {
+	cur, err := t.curBuildMeta()
+	if err != nil {
+		return
+	}
+
+	data, err := json.MarshalIndent(cur, "", "    ")
+	if err != nil {
+		return
+	}
+
+	path := buildMetaPath(t.target.Name())
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		log.Debugf("Failed to write build metadata %s: %s",
+			path, err.Error())
+	}
+}
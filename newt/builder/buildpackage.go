@@ -177,7 +177,13 @@ func (bpkg *BuildPackage) CompilerInfo(
 		return nil, err
 	}
 
+	genIncludes, err := b.genIncludeDirs(bpkg)
+	if err != nil {
+		return nil, err
+	}
+
 	ci.Includes = append(bpkg.privateIncludeDirs(b), includePaths...)
+	ci.Includes = append(ci.Includes, genIncludes...)
 	bpkg.ci = ci
 
 	return bpkg.ci, nil
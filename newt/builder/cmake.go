@@ -24,7 +24,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"os"
+	"io/ioutil"
 	"path/filepath"
 	"strings"
 
@@ -88,26 +88,18 @@ func removeDuplicates(elements []string) []string {
 	return result
 }
 
-func CmakeSourceObjectWrite(w io.Writer, cj toolchain.CompilerJob, includeDirs *[]string) {
-	c := cj.Compiler
+func CmakeSourceObjectWrite(w io.Writer, cj toolchain.CompilerJob,
+	includeDirs *[]string) error {
 
-	compileFlags := []string{}
-	otherFlags := []string{}
+	c := cj.Compiler
 
-	switch cj.CompilerType {
-	case toolchain.COMPILER_TYPE_C:
-		compileFlags = append(compileFlags, c.GetCompilerInfo().Cflags...)
-		compileFlags = append(compileFlags, c.GetLocalCompilerInfo().Cflags...)
-	case toolchain.COMPILER_TYPE_ASM:
-		compileFlags = append(compileFlags, c.GetCompilerInfo().Cflags...)
-		compileFlags = append(compileFlags, c.GetLocalCompilerInfo().Cflags...)
-		compileFlags = append(compileFlags, c.GetCompilerInfo().Aflags...)
-		compileFlags = append(compileFlags, c.GetLocalCompilerInfo().Aflags...)
-	case toolchain.COMPILER_TYPE_CPP:
-		compileFlags = append(compileFlags, c.GetCompilerInfo().Cflags...)
-		compileFlags = append(compileFlags, c.GetLocalCompilerInfo().Cflags...)
+	// Use the flags newt itself would compile the file with.
+	_, compileFlags, err := c.CompileFlags(cj.Filename, cj.CompilerType)
+	if err != nil {
+		return err
 	}
 
+	otherFlags := []string{}
 	extractIncludes(&compileFlags, includeDirs, &otherFlags)
 	cj.Filename = trimProjectPath(cj.Filename)
 
@@ -118,6 +110,8 @@ func CmakeSourceObjectWrite(w io.Writer, cj toolchain.CompilerJob, includeDirs *
 		cj.Filename,
 		strings.Replace(strings.Join(otherFlags, " "), "\"", "\\\\\\\"", -1))
 	fmt.Fprintln(w)
+
+	return nil
 }
 
 func (b *Builder) CMakeBuildPackageWrite(w io.Writer, bpkg *BuildPackage) (*BuildPackage, error) {
@@ -140,7 +134,9 @@ func (b *Builder) CMakeBuildPackageWrite(w io.Writer, bpkg *BuildPackage) (*Buil
 			continue
 		}
 
-		CmakeSourceObjectWrite(w, s, &otherIncludes)
+		if err := CmakeSourceObjectWrite(w, s, &otherIncludes); err != nil {
+			return nil, err
+		}
 		s.Filename = trimProjectPath(s.Filename)
 		files = append(files, s.Filename)
 	}
@@ -291,6 +287,11 @@ func (t *TargetBuilder) CMakeTargetBuilderWrite(w io.Writer, targetCompiler *too
 	project.ResetDeps(t.AppList)
 
 	targetCompiler.LinkerScripts = t.bspPkg.LinkerScripts
+	if len(targetCompiler.LinkerScripts) > 0 {
+		targetCompiler.LinkerScripts = append(
+			append([]string{}, targetCompiler.LinkerScripts...),
+			t.placementScripts()...)
+	}
 
 	if err := t.bspPkg.Reload(t.AppBuilder.cfg.SettingValues()); err != nil {
 		return err
@@ -309,7 +310,9 @@ func CmakeCompilerWrite(w io.Writer, c *toolchain.Compiler) {
 	fmt.Fprintln(w, "set(CMAKE_SYSTEM_NAME Generic)")
 	fmt.Fprintln(w, "set(CMAKE_TRY_COMPILE_TARGET_TYPE STATIC_LIBRARY)")
 	fmt.Fprintf(w, "set(CMAKE_C_COMPILER %s)\n", c.GetCcPath())
-	fmt.Fprintf(w, "set(CMAKE_CXX_COMPILER %s)\n", c.GetCppPath())
+	if c.GetCppPath() != "" {
+		fmt.Fprintf(w, "set(CMAKE_CXX_COMPILER %s)\n", c.GetCppPath())
+	}
 	fmt.Fprintf(w, "set(CMAKE_ASM_COMPILER %s)\n", c.GetAsPath())
 	/* TODO: cmake returns error on link */
 	//fmt.Fprintf(w, "set(CMAKE_AR %s)\n", c.GetArPath())
@@ -319,7 +322,12 @@ func CmakeCompilerWrite(w io.Writer, c *toolchain.Compiler) {
 func CmakeHeaderWrite(w io.Writer, c *toolchain.Compiler, targetName string) {
 	fmt.Fprintln(w, "cmake_minimum_required(VERSION 3.7)\n")
 	CmakeCompilerWrite(w, c)
-	fmt.Fprintf(w, "project(%s VERSION 0.0.0 LANGUAGES C ASM)\n\n", targetName)
+	languages := "C ASM"
+	if c.GetCppPath() != "" {
+		languages += " CXX"
+	}
+	fmt.Fprintf(w, "project(%s VERSION 0.0.0 LANGUAGES %s)\n\n", targetName,
+		languages)
 	fmt.Fprintln(w, "SET(CMAKE_C_FLAGS_BACKUP  \"${CMAKE_C_FLAGS}\")")
 	fmt.Fprintln(w, "SET(CMAKE_CXX_FLAGS_BACKUP  \"${CMAKE_CXX_FLAGS}\")")
 	fmt.Fprintln(w, "SET(CMAKE_ASM_FLAGS_BACKUP  \"${CMAKE_ASM_FLAGS}\")")
@@ -327,14 +335,8 @@ func CmakeHeaderWrite(w io.Writer, c *toolchain.Compiler, targetName string) {
 }
 
 func CMakeTargetGenerate(target *target.Target) error {
-	CmakeFileHandle, err := os.Create(CmakeListsPath())
-	if err != nil {
-		return util.ChildNewtError(err)
-	}
-
 	var b = bytes.Buffer{}
 	w := bufio.NewWriter(&b)
-	defer CmakeFileHandle.Close()
 
 	targetBuilder, err := NewTargetBuilder(target)
 	if err != nil {
@@ -354,6 +356,11 @@ func CMakeTargetGenerate(target *target.Target) error {
 
 	w.Flush()
 
-	CmakeFileHandle.Write(b.Bytes())
+	// Only replace the file once the whole project has been generated.
+	if err := ioutil.WriteFile(CmakeListsPath(), b.Bytes(), 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Wrote %s\n", CmakeListsPath())
 	return nil
 }
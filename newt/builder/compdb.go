@@ -0,0 +1,169 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Newt maintains clang compilation databases (`compile_commands.json`) so that
+// editors and language servers (clangd, VS Code, CLion) see the same include
+// paths and defines as the compiler:
+//
+//     bin/targets/<target>/app/.../compile_commands.json
+//         Every source file in one build (app, loader, or unit test).
+//
+//     bin/targets/<target>/compile_commands.json
+//         The app and loader databases of a target, combined.
+//
+//     compile_commands.json (at the top of the project)
+//         A merge of the databases of every target built so far.  Each build
+//         replaces the entries for its own source files; entries for files
+//         that no longer exist are dropped.
+//
+// Files skipped by an incremental build are included along with those that
+// get compiled.  A database is only rewritten when its contents change, so
+// that an editor doesn't reindex the project after every no-op build.
+
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+
+	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/newt/toolchain"
+	"mynewt.apache.org/newt/util"
+)
+
+const COMPILE_CMDS_FILENAME = "compile_commands.json"
+
+// Returns the path of the project-level compilation database.
+func ProjectCompileCmdsPath() string {
+	return project.GetProject().Path() + "/" + COMPILE_CMDS_FILENAME
+}
+
+// Returns the path of the target-level compilation database.
+func TargetCompileCmdsPath(targetName string) string {
+	return TargetBinDir(targetName) + "/" + COMPILE_CMDS_FILENAME
+}
+
+// Reads a compilation database.  A missing or unparseable file is treated as
+// an empty database.
+func readCompileCmds(path string) []toolchain.CompileCommand {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var cmds []toolchain.CompileCommand
+	if err := json.Unmarshal(data, &cmds); err != nil {
+		return nil
+	}
+
+	return cmds
+}
+
+// Sorts a compilation database by source file, removing duplicate entries.
+// When a file appears more than once, its last entry is kept.
+func normalizeCompileCmds(
+	cmds []toolchain.CompileCommand) []toolchain.CompileCommand {
+
+	cmdMap := map[string]toolchain.CompileCommand{}
+	for _, cmd := range cmds {
+		cmdMap[cmd.File] = cmd
+	}
+
+	files := make([]string, 0, len(cmdMap))
+	for file, _ := range cmdMap {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	sorted := make([]toolchain.CompileCommand, len(files))
+	for i, file := range files {
+		sorted[i] = cmdMap[file]
+	}
+
+	return sorted
+}
+
+// Writes a compilation database.  The file is left untouched if its contents
+// wouldn't change.
+func writeCompileCmds(path string, cmds []toolchain.CompileCommand) error {
+	cmds = normalizeCompileCmds(cmds)
+
+	data, err := json.MarshalIndent(cmds, "", "    ")
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	if old, err := ioutil.ReadFile(path); err == nil && bytes.Equal(old, data) {
+		return nil
+	}
+
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return util.FmtNewtError(
+			"Unable to write %s file; reason: %s", path, err.Error())
+	}
+
+	return nil
+}
+
+// Collects the compile commands of every package in the build.
+func (b *Builder) compileCmds(
+	compilers []*toolchain.Compiler) []toolchain.CompileCommand {
+
+	var cmds []toolchain.CompileCommand
+	for _, c := range compilers {
+		cmds = append(cmds, c.GetCompileCommands()...)
+	}
+
+	projectPath := interfaces.GetProject().Path() + "/"
+	for i, _ := range cmds {
+		cmds[i].Directory = projectPath
+	}
+
+	return cmds
+}
+
+// Writes the target-level compilation database and merges it into the
+// project-level one.
+func (t *TargetBuilder) writeCompileCmds() error {
+	cmds := readCompileCmds(t.AppBuilder.CompileCmdsPath())
+	if t.LoaderBuilder != nil {
+		cmds = append(cmds,
+			readCompileCmds(t.LoaderBuilder.CompileCmdsPath())...)
+	}
+
+	if err := writeCompileCmds(
+		TargetCompileCmdsPath(t.target.Name()), cmds); err != nil {
+
+		return err
+	}
+
+	// Entries from other targets are kept unless their source file is gone.
+	merged := []toolchain.CompileCommand{}
+	for _, cmd := range readCompileCmds(ProjectCompileCmdsPath()) {
+		if util.NodeExist(cmd.File) {
+			merged = append(merged, cmd)
+		}
+	}
+	merged = append(merged, cmds...)
+
+	return writeCompileCmds(ProjectCompileCmdsPath(), merged)
+}
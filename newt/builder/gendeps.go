@@ -0,0 +1,228 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Generated artifact dependencies.  A package can produce files by running a
+// command (typically a tool package that generates a table):
+//
+//     pkg.gen.cmd: "python3 gen_table.py"
+//     pkg.gen.outputs:
+//         - table.h
+//     pkg.gen.inputs:
+//         - gen_table.py
+//         - table.csv
+//
+// The command runs in the producing package's directory, with the NEWT_GEN_DIR
+// environment variable set to the directory where the outputs are to be
+// written.  A package whose sources use the outputs declares a dependency on
+// the producer:
+//
+//     pkg.gen_deps:
+//         - "@apache-mynewt-core/tools/tablegen"
+//
+// All producers run before any source file is compiled.  A producer's output
+// directory is added to the include path of each dependent package, and each
+// dependent object file is rebuilt whenever an output changes.
+
+package builder
+
+import (
+	"os"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/util"
+)
+
+func (b *Builder) genOutputDir(lpkg *pkg.LocalPackage) string {
+	return GeneratedBaseDir(b.targetPkg.rpkg.Lpkg.Name()) + "/pkg/" +
+		lpkg.Name()
+}
+
+func (b *Builder) genOutputPaths(lpkg *pkg.LocalPackage) []string {
+	settings := b.cfg.AllSettingsForLpkg(lpkg)
+	outputs := lpkg.PkgY.GetValStringSlice("pkg.gen.outputs", settings)
+
+	dir := b.genOutputDir(lpkg)
+	paths := make([]string, len(outputs))
+	for i, o := range outputs {
+		paths[i] = dir + "/" + o
+	}
+
+	return paths
+}
+
+// Resolves the producers of the generated files that the specified package
+// depends on.
+func (b *Builder) genProducers(bpkg *BuildPackage) (
+	[]*pkg.LocalPackage, error) {
+
+	lpkg := bpkg.rpkg.Lpkg
+	settings := b.cfg.AllSettingsForLpkg(lpkg)
+	names := lpkg.PkgY.GetValStringSlice("pkg.gen_deps", settings)
+
+	producers := make([]*pkg.LocalPackage, 0, len(names))
+	for _, name := range names {
+		producer, err := project.GetProject().ResolvePackage(
+			lpkg.Repo(), name)
+		if err != nil {
+			return nil, util.PreNewtError(err,
+				"Package %s specifies invalid pkg.gen_deps entry",
+				lpkg.FullName())
+		}
+
+		if producer.PkgY.GetValString("pkg.gen.cmd",
+			b.cfg.AllSettingsForLpkg(producer)) == "" {
+
+			return nil, util.FmtNewtError(
+				"Package %s depends on files generated by %s, but %s does "+
+					"not specify a pkg.gen.cmd setting",
+				lpkg.FullName(), producer.FullName(), producer.FullName())
+		}
+
+		producers = append(producers, producer)
+	}
+
+	return producers, nil
+}
+
+// Indicates whether a producer's outputs are missing or older than any of its
+// inputs (including its pkg.yml file).
+func (b *Builder) genRequired(producer *pkg.LocalPackage) (bool, error) {
+	settings := b.cfg.AllSettingsForLpkg(producer)
+
+	inputs := []string{producer.BasePath() + "/" + pkg.PACKAGE_FILE_NAME}
+	for _, in := range producer.PkgY.GetValStringSlice(
+		"pkg.gen.inputs", settings) {
+
+		inputs = append(inputs, producer.BasePath()+"/"+in)
+	}
+
+	for _, out := range b.genOutputPaths(producer) {
+		if util.NodeNotExist(out) {
+			return true, nil
+		}
+
+		outTime, err := util.FileModificationTime(out)
+		if err != nil {
+			return false, err
+		}
+
+		for _, in := range inputs {
+			inTime, err := util.FileModificationTime(in)
+			if err != nil {
+				return false, err
+			}
+			if inTime.After(outTime) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// Runs the specified producer's command if its outputs are out of date.
+func (b *Builder) runProducer(producer *pkg.LocalPackage) error {
+	if b.genDone[producer] {
+		return nil
+	}
+	b.genDone[producer] = true
+
+	required, err := b.genRequired(producer)
+	if err != nil {
+		return err
+	}
+	if !required {
+		return nil
+	}
+
+	settings := b.cfg.AllSettingsForLpkg(producer)
+	cmd := strings.Fields(producer.PkgY.GetValString("pkg.gen.cmd", settings))
+
+	outDir := b.genOutputDir(producer)
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Generating files for %s\n",
+		producer.FullName())
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+	if err := os.Chdir(producer.BasePath()); err != nil {
+		return util.ChildNewtError(err)
+	}
+	defer os.Chdir(wd)
+
+	env := []string{"NEWT_GEN_DIR=" + outDir}
+	if _, err := util.ShellCommand(cmd, env); err != nil {
+		return util.PreNewtError(err, "Generation of files for %s failed",
+			producer.FullName())
+	}
+
+	for _, out := range b.genOutputPaths(producer) {
+		if util.NodeNotExist(out) {
+			return util.FmtNewtError(
+				"Package %s did not generate declared output %s",
+				producer.FullName(), out)
+		}
+	}
+
+	return nil
+}
+
+// Runs the producers of every generated file used by the specified package.
+//
+// @return []string             The paths of the generated files that the
+//                                  package's object files depend on.
+func (b *Builder) generateDeps(bpkg *BuildPackage) ([]string, error) {
+	producers, err := b.genProducers(bpkg)
+	if err != nil {
+		return nil, err
+	}
+
+	deps := []string{}
+	for _, producer := range producers {
+		if err := b.runProducer(producer); err != nil {
+			return nil, err
+		}
+		deps = append(deps, b.genOutputPaths(producer)...)
+	}
+
+	return deps, nil
+}
+
+// Returns the directories containing the generated files used by the
+// specified package.
+func (b *Builder) genIncludeDirs(bpkg *BuildPackage) ([]string, error) {
+	producers, err := b.genProducers(bpkg)
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := make([]string, len(producers))
+	for i, producer := range producers {
+		dirs[i] = b.genOutputDir(producer)
+	}
+
+	return dirs, nil
+}
@@ -0,0 +1,214 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Host tool requirements.  A package that needs programs on the build host
+// (e.g., a code generator) declares them in its pkg.yml:
+//
+//     pkg.host_tools:
+//         - name: protoc
+//           version: ">=3.6"
+//           hint: "apt install protobuf-compiler"
+//         - python_module: yaml
+//           version: ">=5.1"
+//           hint: "pip3 install pyyaml"
+//
+// A tool's version is determined by running "<name> --version" (overridden
+// with the "version_cmd" field) and extracting the first version number from
+// the output.  All requirements are checked before anything is built; missing
+// or outdated tools are reported together.
+
+package builder
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+)
+
+type hostTool struct {
+	name         string
+	pythonModule string
+	versionCmd   string
+	version      string
+	hint         string
+
+	// Full names of the packages that require this tool.
+	requirers []string
+}
+
+var hostToolVerRe = regexp.MustCompile(`\d+(\.\d+)*`)
+
+func (ht *hostTool) displayName() string {
+	if ht.pythonModule != "" {
+		return "python module " + ht.pythonModule
+	}
+	return ht.name
+}
+
+// Pads a version number to the three-part form that newt's version functions
+// expect (e.g., "3.6" becomes "3.6.0").
+func padToolVersion(ver string) string {
+	parts := strings.Split(ver, ".")
+	for len(parts) < 3 {
+		parts = append(parts, "0")
+	}
+	return strings.Join(parts[:3], ".")
+}
+
+func (ht *hostTool) command() *exec.Cmd {
+	if ht.versionCmd != "" {
+		fields := strings.Fields(ht.versionCmd)
+		return exec.Command(fields[0], fields[1:]...)
+	}
+
+	if ht.pythonModule != "" {
+		return exec.Command("python3", "-c", fmt.Sprintf(
+			"import %s; print(getattr(%s, '__version__', ''))",
+			ht.pythonModule, ht.pythonModule))
+	}
+
+	return exec.Command(ht.name, "--version")
+}
+
+// Checks whether the tool is installed and satisfies the version
+// requirement.  Returns "" on success, or a description of the problem.
+func (ht *hostTool) check() string {
+	out, err := ht.command().CombinedOutput()
+	if err != nil {
+		return "not found"
+	}
+
+	if ht.version == "" {
+		return ""
+	}
+
+	verStr := hostToolVerRe.FindString(string(out))
+	if verStr == "" {
+		return "cannot determine installed version"
+	}
+
+	reqStr := hostToolVerRe.ReplaceAllStringFunc(ht.version, padToolVersion)
+	reqs, err := newtutil.ParseRepoVersionReqs(reqStr)
+	if err != nil {
+		return fmt.Sprintf("invalid version requirement \"%s\"", ht.version)
+	}
+
+	ver, err := newtutil.ParseRepoVersion(padToolVersion(verStr))
+	if err != nil {
+		return "cannot determine installed version"
+	}
+
+	if !ver.SatisfiesAll(reqs) {
+		return fmt.Sprintf("found version %s, need %s", verStr, ht.version)
+	}
+
+	return ""
+}
+
+// Collects the host tool requirements of the target's packages.  Identical
+// requirements from several packages are merged.
+func (t *TargetBuilder) hostTools() ([]*hostTool, error) {
+	toolMap := map[string]*hostTool{}
+
+	for _, rpkg := range t.res.MasterSet.Rpkgs {
+		lpkg := rpkg.Lpkg
+		entries := lpkg.PkgY.GetSlice("pkg.host_tools",
+			t.res.Cfg.AllSettingsForLpkg(lpkg))
+
+		for _, e := range entries {
+			m := cast.ToStringMapString(e.Value)
+			ht := &hostTool{
+				name:         m["name"],
+				pythonModule: m["python_module"],
+				versionCmd:   m["version_cmd"],
+				version:      m["version"],
+				hint:         m["hint"],
+			}
+
+			if (ht.name == "") == (ht.pythonModule == "") {
+				return nil, util.FmtNewtError(
+					"Package %s contains an invalid pkg.host_tools entry; "+
+						"exactly one of name and python_module is required",
+					lpkg.FullName())
+			}
+
+			key := ht.displayName() + " " + ht.version
+			if prev := toolMap[key]; prev != nil {
+				ht = prev
+			} else {
+				toolMap[key] = ht
+			}
+			ht.requirers = append(ht.requirers, lpkg.FullName())
+		}
+	}
+
+	keys := make([]string, 0, len(toolMap))
+	for k, _ := range toolMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	tools := make([]*hostTool, len(keys))
+	for i, k := range keys {
+		tools[i] = toolMap[k]
+	}
+
+	return tools, nil
+}
+
+// Verifies that every host tool required by the target is installed.
+func (t *TargetBuilder) checkHostTools() error {
+	tools, err := t.hostTools()
+	if err != nil {
+		return err
+	}
+
+	report := ""
+	for _, ht := range tools {
+		problem := ht.check()
+		if problem == "" {
+			continue
+		}
+
+		desc := ht.displayName()
+		if ht.version != "" {
+			desc += " " + ht.version
+		}
+
+		sort.Strings(ht.requirers)
+		report += fmt.Sprintf("    * %s: %s (required by %s)\n",
+			desc, problem, strings.Join(ht.requirers, ", "))
+		if ht.hint != "" {
+			report += fmt.Sprintf("      Install: %s\n", ht.hint)
+		}
+	}
+
+	if report != "" {
+		return util.NewNewtError("Missing host tools:\n" + report)
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Compiler launchers.  A target's compiler invocations can be passed through
+// a chain of launchers (ccache, distcc, icecc, sccache, etc.) specified by
+// the "build.launcher" newtrc setting or the target's "target.launcher"
+// setting; the target setting takes precedence.  ccache can also be enabled
+// on its own with the "build.ccache" newtrc setting or the target's
+// "target.ccache" setting, in which case it becomes the head of the chain.
+//
+// When ccache is in use, its hits and misses are reported at the end of each
+// build.  The counts come from ccache's cumulative statistics, so they include
+// any other compilations that share the cache while the build runs.
+
+package builder
+
+import (
+	"os/exec"
+
+	log "github.com/Sirupsen/logrus"
+
+	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/newt/settings"
+	"mynewt.apache.org/newt/newt/toolchain"
+	"mynewt.apache.org/newt/util"
+)
+
+// Indicates whether the target's compiler invocations should go through
+// ccache.
+func (t *TargetBuilder) ccacheEnabled() bool {
+	if t.target.Ccache != nil {
+		return *t.target.Ccache
+	}
+	return settings.BuildCcache()
+}
+
+// Calculates the target's launcher chain.
+//
+// @return string               The ccache executable at the head of the
+//                                  chain; "" if ccache is not in use.
+// @return []string             The remaining launchers, outermost first.
+func (t *TargetBuilder) launcherChain() (string, []string) {
+	var chain []string
+	switch t.target.Launcher {
+	case "":
+		chain = settings.BuildLauncher()
+	case "none":
+	default:
+		chain = settings.LauncherChain(t.target.Launcher)
+	}
+
+	ccache := ""
+	if len(chain) > 0 && toolchain.IsCcache(chain[0]) {
+		ccache = chain[0]
+		chain = chain[1:]
+	} else if t.ccacheEnabled() {
+		ccache = settings.CcachePath()
+	}
+
+	return ccache, chain
+}
+
+// Locates a launcher executable.
+//
+// @return string               The executable's path; "" if it could not be
+//                                  found.
+func lookLauncher(launcher string) string {
+	path, err := exec.LookPath(launcher)
+	if err != nil {
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"WARNING: compiler launcher \"%s\" could not be found; "+
+				"compiling without it\n", launcher)
+		return ""
+	}
+
+	return path
+}
+
+// Retrieves the launcher for the target's compilers; nil if the target
+// compiles locally.  Launchers that are not installed are skipped with a
+// warning.
+func (t *TargetBuilder) compilerLauncher() *toolchain.Launcher {
+	if t.launcherResolved {
+		return t.launcher
+	}
+	t.launcherResolved = true
+
+	ccache, chain := t.launcherChain()
+	if ccache != "" {
+		ccache = lookLauncher(ccache)
+	}
+
+	var paths []string
+	for _, l := range chain {
+		if path := lookLauncher(l); path != "" {
+			paths = append(paths, path)
+		}
+	}
+
+	t.launcher = toolchain.NewLauncher(ccache, paths,
+		interfaces.GetProject().Path())
+	return t.launcher
+}
+
+// Records ccache's statistics at the start of a build so that the build's
+// hits and misses can be reported when it completes.
+func (t *TargetBuilder) ccacheStatsBegin() {
+	t.ccacheStart = nil
+
+	l := t.compilerLauncher()
+	if l == nil || l.Ccache == nil {
+		return
+	}
+
+	stats, err := l.Ccache.Stats()
+	if err != nil {
+		// `--print-stats` was added in ccache 3.7.
+		log.Debugf("failed to read ccache statistics: %s", err.Error())
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"ccache: statistics unavailable (requires ccache 3.7 or "+
+				"later)\n")
+		return
+	}
+	t.ccacheStart = &stats
+}
+
+// Reports the ccache hits and misses incurred since ccacheStatsBegin().
+func (t *TargetBuilder) ccacheStatsReport() {
+	if t.ccacheStart == nil {
+		return
+	}
+
+	stats, err := t.launcher.Ccache.Stats()
+	if err != nil {
+		log.Debugf("failed to read ccache statistics: %s", err.Error())
+		return
+	}
+	stats = stats.Since(*t.ccacheStart)
+
+	total := stats.Hits + stats.Misses
+	if total <= 0 {
+		return
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"ccache: %d hit(s), %d miss(es) (%d%% hit rate)\n",
+		stats.Hits, stats.Misses, stats.Hits*100/total)
+}
@@ -0,0 +1,125 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Versioning of the bin directory layout.  The layout version is recorded in
+// a marker file at the root of the bin directory.  When a future version of
+// newt changes where build artifacts are placed, it bumps BIN_LAYOUT_VERSION
+// and adds a migration to binLayoutMigrations; existing bin directories are
+// then migrated automatically before the next build.
+//
+// Tools that need to locate build artifacts should use `newt path` rather
+// than constructing paths themselves.
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"mynewt.apache.org/newt/util"
+)
+
+const BIN_LAYOUT_VERSION = 1
+const BIN_LAYOUT_FILENAME = ".layout"
+
+// Converts a bin directory from the indexed layout version to the next one.
+// Layout 0 is the unversioned layout used before the marker file was
+// introduced; it is identical to layout 1.
+var binLayoutMigrations = []func(binRoot string) error{
+	func(binRoot string) error { return nil },
+}
+
+func binLayoutPath() string {
+	return BinRoot() + "/" + BIN_LAYOUT_FILENAME
+}
+
+// Reads the layout version of the bin directory.
+//
+// @return int                  The layout version; 0 if the directory
+//                                  predates layout versioning.
+func readBinLayoutVersion() (int, error) {
+	contents, err := ioutil.ReadFile(binLayoutPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, util.ChildNewtError(err)
+	}
+
+	ver, err := strconv.Atoi(strings.TrimSpace(string(contents)))
+	if err != nil {
+		return 0, util.FmtNewtError("invalid bin layout file %s: %s",
+			binLayoutPath(), err.Error())
+	}
+
+	return ver, nil
+}
+
+func writeBinLayoutVersion() error {
+	if err := os.MkdirAll(BinRoot(), os.ModePerm); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	contents := []byte(strconv.Itoa(BIN_LAYOUT_VERSION) + "\n")
+	if err := ioutil.WriteFile(binLayoutPath(), contents, 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// Ensures the bin directory uses the current layout, migrating it if it was
+// created by an older version of newt.
+func EnsureBinLayout() error {
+	if util.NodeNotExist(BinRoot()) {
+		return writeBinLayoutVersion()
+	}
+
+	ver, err := readBinLayoutVersion()
+	if err != nil {
+		return err
+	}
+
+	if ver == BIN_LAYOUT_VERSION {
+		return nil
+	}
+
+	if ver > BIN_LAYOUT_VERSION {
+		return util.FmtNewtError(
+			"%s was created by a newer version of newt (layout %d; this "+
+				"newt supports layout %d); run \"newt clean all\" to "+
+				"discard it", BinRoot(), ver, BIN_LAYOUT_VERSION)
+	}
+
+	for ; ver < BIN_LAYOUT_VERSION; ver++ {
+		log.Debugf("Migrating bin directory from layout %d to %d",
+			ver, ver+1)
+		if err := binLayoutMigrations[ver](BinRoot()); err != nil {
+			return util.FmtNewtError(
+				"failed to migrate %s to layout %d: %s; run \"newt clean "+
+					"all\" to discard it", BinRoot(), ver+1, err.Error())
+		}
+	}
+
+	return writeBinLayoutVersion()
+}
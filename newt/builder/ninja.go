@@ -0,0 +1,261 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// The ninja build backend.  Rather than compiling source files itself, newt
+// writes a Ninja file describing every compile and archive step of a build
+// and runs ninja on it.  Newt remains responsible for everything else:
+// dependency resolution, syscfg and sysinit generation, linking, and image
+// creation.  Ninja tracks header dependencies and command changes on its own,
+// so a no-op build of a large project costs a single ninja invocation.
+//
+// The backend is selected with `newt build --backend=ninja` or the
+// "build.backend" newtrc setting.  Each build's Ninja file is written next to
+// its compilation database, e.g., `bin/targets/<target>/app/.../build.ninja`,
+// and can be run by hand.  The backend is not supported on Windows; the
+// generated rules assume a POSIX shell.
+
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/settings"
+	"mynewt.apache.org/newt/newt/toolchain"
+	"mynewt.apache.org/newt/util"
+)
+
+const (
+	BUILD_BACKEND_NEWT  = "newt"
+	BUILD_BACKEND_NINJA = "ninja"
+)
+
+const NINJA_FILENAME = "build.ninja"
+
+// The backend that compiles source files; overrides the "build.backend"
+// newtrc setting if non-empty.
+var BuildBackend string
+
+// Returns the backend that compiles source files.
+func buildBackend() (string, error) {
+	backend := BuildBackend
+	if backend == "" {
+		backend = settings.BuildBackend()
+	}
+
+	switch backend {
+	case "", BUILD_BACKEND_NEWT:
+		return BUILD_BACKEND_NEWT, nil
+	case BUILD_BACKEND_NINJA:
+		// Ninja runs commands with /bin/sh, which the generated rules rely on.
+		if runtime.GOOS == "windows" {
+			return "", util.FmtNewtError(
+				"the %s build backend is not supported on Windows; use the "+
+					"%s backend", BUILD_BACKEND_NINJA, BUILD_BACKEND_NEWT)
+		}
+		return BUILD_BACKEND_NINJA, nil
+	default:
+		return "", util.FmtNewtError(
+			"unknown build backend \"%s\"; must be one of: %s, %s",
+			backend, BUILD_BACKEND_NEWT, BUILD_BACKEND_NINJA)
+	}
+}
+
+const ninjaRules = `rule cc
+    command = $cmd
+    depfile = $dep
+    description = Compiling $in
+
+rule as
+    command = $cmd
+    description = Assembling $in
+
+rule aspp
+    command = $cmd
+    depfile = $dep
+    description = Assembling $in
+
+rule ar
+    command = rm -f $out && $cmd
+    description = Archiving $out
+
+rule copy
+    command = cp $in $out
+    description = Copying $out
+`
+
+var shellSafeRe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// Quotes a command-line argument for /bin/sh, which ninja runs commands with.
+func shellQuote(arg string) string {
+	if shellSafeRe.MatchString(arg) {
+		return arg
+	}
+
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
+
+// Escapes a path for use in a Ninja build statement.
+func ninjaEscapePath(path string) string {
+	r := strings.NewReplacer("$", "$$", " ", "$ ", ":", "$:")
+	return r.Replace(path)
+}
+
+// Converts a command to the value of a Ninja variable.
+func ninjaCommand(cmd []string) string {
+	quoted := make([]string, len(cmd))
+	for i, arg := range cmd {
+		quoted[i] = shellQuote(arg)
+	}
+
+	return strings.Replace(strings.Join(quoted, " "), "$", "$$", -1)
+}
+
+func ninjaEscapePaths(paths []string) string {
+	escaped := make([]string, len(paths))
+	for i, p := range paths {
+		escaped[i] = ninjaEscapePath(p)
+	}
+
+	return strings.Join(escaped, " ")
+}
+
+// Writes a single build statement.
+func writeNinjaEdge(buf *bytes.Buffer, edge *toolchain.NinjaEdge) {
+	fmt.Fprintf(buf, "build %s: %s %s", ninjaEscapePaths(edge.Outputs),
+		edge.Rule, ninjaEscapePaths(edge.Inputs))
+	if len(edge.Implicit) > 0 {
+		fmt.Fprintf(buf, " | %s", ninjaEscapePaths(edge.Implicit))
+	}
+	buf.WriteString("\n")
+
+	if len(edge.Command) > 0 {
+		cmd := ninjaCommand(edge.Command)
+
+		// Have the compiler list the headers each object file depends on.
+		// The dependency file goes where newt's own backend puts it and
+		// ninja only reads it, so other consumers (e.g., the unused setting
+		// check) still find it after the build.
+		if edge.Depfile != "" {
+			cmd += " -MMD -MF " +
+				strings.Replace(shellQuote(edge.Depfile), "$", "$$", -1)
+		}
+
+		for _, post := range edge.Post {
+			cmd += " && " + ninjaCommand(post)
+		}
+
+		fmt.Fprintf(buf, "    cmd = %s\n", cmd)
+	}
+
+	if edge.Depfile != "" {
+		fmt.Fprintf(buf, "    dep = %s\n",
+			strings.Replace(edge.Depfile, "$", "$$", -1))
+	}
+}
+
+// Returns the path of the build's Ninja file.
+func (b *Builder) NinjaFilePath() string {
+	return b.buildDir() + "/" + NINJA_FILENAME
+}
+
+// Compiles and archives the specified packages by generating a Ninja file and
+// running ninja on it.
+func (b *Builder) ninjaBuild(entries []toolchain.CompilerJob,
+	bpkgs []*BuildPackage,
+	bpkgCompilerMap map[*BuildPackage]*toolchain.Compiler) error {
+
+	ninjaPath, err := exec.LookPath(settings.NinjaPath())
+	if err != nil {
+		return util.FmtNewtError(
+			"the ninja build backend requires ninja (%s): %s; install it or "+
+				"set \"build.ninja_path\" in ~/.newt/repos.yml",
+			settings.NinjaPath(), err.Error())
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("# Generated by newt; do not edit.\n\n")
+	buf.WriteString("ninja_required_version = 1.3\n\n")
+	buf.WriteString(ninjaRules)
+	buf.WriteString("\n")
+
+	for _, entry := range entries {
+		edge, err := entry.Compiler.NinjaCompileEdge(entry.Filename,
+			entry.CompilerType)
+		if err != nil {
+			return err
+		}
+		if edge != nil {
+			writeNinjaEdge(&buf, edge)
+		}
+	}
+
+	for _, bpkg := range bpkgs {
+		c := bpkgCompilerMap[bpkg]
+		if c == nil {
+			continue
+		}
+
+		c.SetSrcDir(bpkg.rpkg.Lpkg.RelativePath())
+		if edge := c.NinjaArchiveEdge(b.ArchivePath(bpkg)); edge != nil {
+			writeNinjaEdge(&buf, edge)
+		}
+	}
+
+	if err := os.MkdirAll(b.buildDir(), 0755); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	// Leave an unchanged file alone so that its timestamp doesn't change.
+	path := b.NinjaFilePath()
+	old, err := ioutil.ReadFile(path)
+	if err != nil || !bytes.Equal(old, buf.Bytes()) {
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			return util.ChildNewtError(err)
+		}
+	}
+
+	cmd := []string{
+		ninjaPath,
+		"-C", interfaces.GetProject().Path(),
+		"-f", path,
+		"-j", strconv.Itoa(newtutil.NewtNumJobs),
+	}
+	var env []string
+	if l := b.targetBuilder.compilerLauncher(); l != nil {
+		env = l.Env
+	}
+
+	o, err := util.ShellCommand(cmd, env)
+	if err != nil {
+		return err
+	}
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "%s", o)
+
+	return nil
+}
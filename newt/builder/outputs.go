@@ -0,0 +1,217 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Secondary build outputs.  A package can declare non-code files that belong
+// in the build output alongside the firmware (e.g., configuration schemas,
+// protobuf descriptors, or host tools):
+//
+//     pkg.outputs:
+//         - path: schema/*.json
+//           kind: config-schema
+//           dest: schemas
+//
+// "path" is relative to the package directory and may contain wildcards.
+// Matching files are copied to the target's artifact directory
+// (bin/targets/<target>/artifacts), beneath "dest" if it is specified.  Each
+// copied file is recorded in the target's manifest along with the package and
+// repo it came from, so a single build output contains everything the device
+// and its host-side counterparts need.
+
+package builder
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/image"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/util"
+)
+
+const ARTIFACTS_DIR = "artifacts"
+
+type pkgOutput struct {
+	path string
+	kind string
+	dest string
+}
+
+func TargetArtifactDir(targetName string) string {
+	return TargetBinDir(targetName) + "/" + ARTIFACTS_DIR
+}
+
+// Indicates whether a relative path stays within its base directory.
+func pathIsContained(path string) bool {
+	path = filepath.Clean(path)
+	return !filepath.IsAbs(path) && path != ".." &&
+		!strings.HasPrefix(path, "../")
+}
+
+// Reads the secondary outputs that the specified package declares.
+func pkgOutputs(lpkg *pkg.LocalPackage,
+	settings map[string]string) ([]pkgOutput, error) {
+
+	entries := lpkg.PkgY.GetSlice("pkg.outputs", settings)
+
+	outputs := make([]pkgOutput, 0, len(entries))
+	for _, e := range entries {
+		m := cast.ToStringMapString(e.Value)
+		o := pkgOutput{
+			path: m["path"],
+			kind: m["kind"],
+			dest: m["dest"],
+		}
+
+		if o.path == "" {
+			return nil, util.FmtNewtError(
+				"Package %s contains an invalid pkg.outputs entry; "+
+					"path is required", lpkg.FullName())
+		}
+		if !pathIsContained(o.path) {
+			return nil, util.FmtNewtError(
+				"Package %s contains an invalid pkg.outputs entry; "+
+					"path must be within the package: %s",
+				lpkg.FullName(), o.path)
+		}
+		if o.dest != "" && !pathIsContained(o.dest) {
+			return nil, util.FmtNewtError(
+				"Package %s contains an invalid pkg.outputs entry; "+
+					"dest must be within the artifact directory: %s",
+				lpkg.FullName(), o.dest)
+		}
+
+		outputs = append(outputs, o)
+	}
+
+	return outputs, nil
+}
+
+// Copies a file, returning the SHA256 digest of its contents.
+func copyOutput(src string, dst string) (string, error) {
+	contents, err := ioutil.ReadFile(src)
+	if err != nil {
+		return "", util.ChildNewtError(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", util.ChildNewtError(err)
+	}
+	if err := ioutil.WriteFile(dst, contents, 0644); err != nil {
+		return "", util.ChildNewtError(err)
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(contents)), nil
+}
+
+// Copies every resolved package's secondary outputs to the target's artifact
+// directory.  The directory is recreated on each build so that it never
+// contains stale files.  The repo of each package that produces an output is
+// added to the specified repo manager.
+//
+// @return []*image.ImageManifestArtifact
+//                              Manifest entries describing the copied files,
+//                                  sorted by path.
+func (t *TargetBuilder) collectOutputs(rm *image.RepoManager) (
+	[]*image.ImageManifestArtifact, error) {
+
+	dir := TargetArtifactDir(t.target.Name())
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	artifacts := []*image.ImageManifestArtifact{}
+
+	// Artifact path -> package that produced it.
+	owners := map[string]string{}
+
+	for _, rpkg := range t.res.MasterSet.Rpkgs {
+		lpkg := rpkg.Lpkg
+
+		outputs, err := pkgOutputs(lpkg, t.res.Cfg.AllSettingsForLpkg(lpkg))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(outputs) > 0 {
+			rm.GetImageManifestPkg(lpkg)
+		}
+
+		for _, o := range outputs {
+			matches, err := filepath.Glob(lpkg.BasePath() + "/" + o.path)
+			if err != nil {
+				return nil, util.FmtNewtError(
+					"Package %s contains an invalid pkg.outputs path: %s",
+					lpkg.FullName(), o.path)
+			}
+			if len(matches) == 0 {
+				return nil, util.FmtNewtError(
+					"Package %s declares an output that doesn't exist: %s",
+					lpkg.FullName(), o.path)
+			}
+
+			for _, src := range matches {
+				relPath := filepath.ToSlash(
+					filepath.Join(o.dest, filepath.Base(src)))
+
+				if owner, ok := owners[relPath]; ok {
+					return nil, util.FmtNewtError(
+						"Output %s is produced by both %s and %s",
+						relPath, owner, lpkg.FullName())
+				}
+				owners[relPath] = lpkg.FullName()
+
+				digest, err := copyOutput(src, dir+"/"+relPath)
+				if err != nil {
+					return nil, err
+				}
+
+				artifacts = append(artifacts, &image.ImageManifestArtifact{
+					Path:   ARTIFACTS_DIR + "/" + relPath,
+					Kind:   o.kind,
+					Pkg:    lpkg.Name(),
+					Repo:   lpkg.Repo().Name(),
+					Sha256: digest,
+				})
+			}
+		}
+	}
+
+	sort.Sort(artifactSorter(artifacts))
+
+	return artifacts, nil
+}
+
+type artifactSorter []*image.ImageManifestArtifact
+
+func (s artifactSorter) Len() int {
+	return len(s)
+}
+func (s artifactSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s artifactSorter) Less(i, j int) bool {
+	return s[i].Path < s[j].Path
+}
@@ -30,11 +30,17 @@ import (
 
 const BUILD_NAME_APP = "app"
 const BUILD_NAME_LOADER = "loader"
+const OBJ_CACHE_DIRNAME = ".objcache"
 
 func BinRoot() string {
 	return project.GetProject().Path() + "/bin"
 }
 
+// The content-addressed object cache shared by all targets.
+func ObjCacheDir() string {
+	return BinRoot() + "/" + OBJ_CACHE_DIRNAME
+}
+
 func TargetBinDir(targetName string) string {
 	return BinRoot() + "/" + targetName
 }
@@ -59,6 +65,10 @@ func SysinitArchivePath(targetName string) string {
 	return GeneratedBinDir(targetName) + "/sysinit.a"
 }
 
+func PlacementScriptPath(targetName string) string {
+	return GeneratedBaseDir(targetName) + "/link/placement.ld"
+}
+
 func PkgSyscfgPath(pkgPath string) string {
 	return pkgPath + "/" + pkg.SYSCFG_YAML_FILENAME
 }
@@ -98,6 +108,11 @@ func AppBinPath(targetName string, buildName string, appName string) string {
 	return AppElfPath(targetName, buildName, appName) + ".bin"
 }
 
+func AppHexPath(targetName string, buildName string, appName string) string {
+	return FileBinDir(targetName, buildName, appName) + "/" +
+		filepath.Base(appName) + ".hex"
+}
+
 func TestExePath(targetName string, buildName string, pkgName string,
 	pkgType interfaces.PackageType) string {
 
@@ -189,13 +204,16 @@ func (b *Builder) AppBinBasePath() string {
 		filepath.Base(b.appPkg.rpkg.Lpkg.Name())
 }
 
-func (b *Builder) CompileCmdsPath() string {
+// Returns the directory containing the build's top-level outputs.
+func (b *Builder) buildDir() string {
 	// The path depends on whether we are building an app or running a test.
-	var basePath string
 	if b.appPkg != nil {
-		basePath = filepath.Dir(b.AppElfPath())
+		return filepath.Dir(b.AppElfPath())
 	} else {
-		basePath = filepath.Dir(b.TestExePath())
+		return filepath.Dir(b.TestExePath())
 	}
-	return basePath + "/compile_commands.json"
+}
+
+func (b *Builder) CompileCmdsPath() string {
+	return b.buildDir() + "/" + COMPILE_CMDS_FILENAME
 }
@@ -0,0 +1,381 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Memory placement: assigns packages or individual source files to alternate
+// memory regions (e.g., TCM or external RAM) without per-app linker scripts.
+// Placements are read from the "syscfg.placement" setting in the app's and
+// the target's syscfg.yml; the target's entries take precedence:
+//
+//     syscfg.placement:
+//         ITCM:
+//             - "@apache-mynewt-core/crypto/tinycrypt"
+//             - "@apache-mynewt-core/kernel/os:src/os_sched.c"
+//
+// Each key names a memory region in the BSP's linker script.  Like other
+// syscfg.yml settings, the block can be made conditional on a setting (e.g.,
+// "syscfg.placement.APP_FAST_CRYPTO").
+//
+// Newt renames the allocated sections of each placed object file (".text"
+// becomes ".placement_itcm.text") and generates a linker script fragment that
+// collects them into output sections in the specified regions.  The load
+// image of these sections follows the BSP's ".data" section (or the section
+// named by "bsp.placement_anchor").  The generated header
+// <placement/placement.h> defines attributes for placing individual functions
+// or variables, and mynewt_placement_init(), which the BSP's startup code
+// calls to copy placed code and data to their regions.
+
+package builder
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/util"
+)
+
+const PLACEMENT_KEY = "syscfg.placement"
+const PLACEMENT_HEADER_PATH = "placement/placement.h"
+
+var placementRegionRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// The memory region assignments for a target.
+type MemPlacement struct {
+	// Region names, sorted.
+	Regions []string
+
+	// Region that each placed package is assigned to.
+	pkgs map[*pkg.LocalPackage]string
+
+	// Region that each placed file is assigned to, indexed by package and
+	// slash-separated absolute path.
+	files map[*pkg.LocalPackage]map[string]string
+}
+
+func placementSection(region string) string {
+	return ".placement_" + strings.ToLower(region)
+}
+
+func placementSymbol(region string, suffix string) string {
+	return "__placement_" + strings.ToLower(region) + "_" + suffix + "__"
+}
+
+func (mp *MemPlacement) IsEmpty() bool {
+	return len(mp.Regions) == 0
+}
+
+// Retrieves the section prefixes that apply to a package's source files, in
+// the form expected by toolchain.Compiler.SectionPrefixes.
+func (mp *MemPlacement) sectionPrefixes(
+	lpkg *pkg.LocalPackage) map[string]string {
+
+	if mp == nil {
+		return nil
+	}
+
+	prefixes := map[string]string{}
+	if region, ok := mp.pkgs[lpkg]; ok {
+		prefixes[""] = placementSection(region)
+	}
+	for path, region := range mp.files[lpkg] {
+		prefixes[path] = placementSection(region)
+	}
+
+	if len(prefixes) == 0 {
+		return nil
+	}
+	return prefixes
+}
+
+// Reads the placement entries from the specified packages' syscfg.yml files.
+// Later packages take precedence.
+func (t *TargetBuilder) readPlacement(
+	lpkgs []*pkg.LocalPackage) (*MemPlacement, error) {
+
+	mp := &MemPlacement{
+		pkgs:  map[*pkg.LocalPackage]string{},
+		files: map[*pkg.LocalPackage]map[string]string{},
+	}
+
+	settings := t.res.Cfg.SettingValues()
+	regions := map[string]string{}
+
+	for _, lpkg := range lpkgs {
+		if lpkg == nil {
+			continue
+		}
+
+		m := lpkg.SyscfgY.GetValStringMap(PLACEMENT_KEY, settings)
+		for region, itf := range m {
+			if !placementRegionRe.MatchString(region) {
+				return nil, util.FmtNewtError(
+					"%s in %s: invalid memory region name \"%s\"",
+					PLACEMENT_KEY, lpkg.FullName(), region)
+			}
+			lower := strings.ToLower(region)
+			if other, ok := regions[lower]; ok && other != region {
+				return nil, util.FmtNewtError(
+					"%s: memory regions \"%s\" and \"%s\" differ only "+
+						"in case", PLACEMENT_KEY, other, region)
+			}
+			regions[lower] = region
+
+			for _, entry := range cast.ToStringSlice(itf) {
+				if err := t.addPlacement(mp, lpkg, region,
+					entry); err != nil {
+
+					return nil, err
+				}
+			}
+		}
+	}
+
+	for _, region := range regions {
+		mp.Regions = append(mp.Regions, region)
+	}
+	sort.Strings(mp.Regions)
+
+	return mp, nil
+}
+
+// Adds a single "<package>[:<file>]" entry to the placement.
+func (t *TargetBuilder) addPlacement(mp *MemPlacement,
+	cfgPkg *pkg.LocalPackage, region string, entry string) error {
+
+	pkgName := entry
+	file := ""
+	if i := strings.Index(entry, ":"); i >= 0 {
+		pkgName = entry[:i]
+		file = strings.Trim(entry[i+1:], "/")
+	}
+
+	dep, err := pkg.NewDependency(cfgPkg.Repo(), pkgName)
+	if err != nil {
+		return err
+	}
+	lpkg, ok := project.GetProject().ResolveDependency(dep).(*pkg.LocalPackage)
+	if !ok || lpkg == nil {
+		return util.FmtNewtError(
+			"%s in %s: unknown package \"%s\"",
+			PLACEMENT_KEY, cfgPkg.FullName(), pkgName)
+	}
+	if t.res.LpkgRpkgMap[lpkg] == nil {
+		return util.FmtNewtError(
+			"%s in %s: package \"%s\" is not part of the build",
+			PLACEMENT_KEY, cfgPkg.FullName(), lpkg.FullName())
+	}
+
+	if file == "" {
+		mp.pkgs[lpkg] = region
+		return nil
+	}
+
+	path := filepath.ToSlash(filepath.Clean(lpkg.BasePath() + "/" + file))
+	if util.NodeNotExist(path) {
+		return util.FmtNewtError(
+			"%s in %s: package \"%s\" does not contain \"%s\"",
+			PLACEMENT_KEY, cfgPkg.FullName(), lpkg.FullName(), file)
+	}
+
+	if mp.files[lpkg] == nil {
+		mp.files[lpkg] = map[string]string{}
+	}
+	mp.files[lpkg][path] = region
+
+	return nil
+}
+
+// Generates the linker script fragment that places the renamed sections in
+// their memory regions.  The fragment is passed to the linker after the BSP's
+// scripts, so its sections follow the BSP's; it relies only on the anchor
+// section for its load address.  The zero-initialized sections come first so
+// that their patterns take precedence over the catch-all patterns.
+func (mp *MemPlacement) linkerScript(anchor string) []byte {
+	buf := bytes.Buffer{}
+
+	fmt.Fprintf(&buf, "/**\n * This file was generated by Apache newt "+
+		"from %s.\n */\n\n", PLACEMENT_KEY)
+	fmt.Fprintf(&buf, "SECTIONS\n{\n")
+
+	for _, region := range mp.Regions {
+		sect := placementSection(region)
+		fmt.Fprintf(&buf, "    %s_bss (NOLOAD) :\n    {\n", sect)
+		fmt.Fprintf(&buf, "        . = ALIGN(4);\n")
+		fmt.Fprintf(&buf, "        %s = .;\n", placementSymbol(region,
+			"bss_start"))
+		fmt.Fprintf(&buf, "        *(%s.bss %s.bss.*)\n", sect, sect)
+		fmt.Fprintf(&buf, "        . = ALIGN(4);\n")
+		fmt.Fprintf(&buf, "        %s = .;\n", placementSymbol(region,
+			"bss_end"))
+		fmt.Fprintf(&buf, "    } > %s\n", region)
+	}
+
+	prev := anchor
+	for _, region := range mp.Regions {
+		sect := placementSection(region)
+		fmt.Fprintf(&buf, "\n    %s : AT (LOADADDR(%s) + SIZEOF(%s))\n",
+			sect, prev, prev)
+		fmt.Fprintf(&buf, "    {\n")
+		fmt.Fprintf(&buf, "        . = ALIGN(4);\n")
+		fmt.Fprintf(&buf, "        %s = .;\n", placementSymbol(region,
+			"start"))
+		fmt.Fprintf(&buf, "        *(%s.*)\n", sect)
+		fmt.Fprintf(&buf, "        . = ALIGN(4);\n")
+		fmt.Fprintf(&buf, "        %s = .;\n", placementSymbol(region,
+			"end"))
+		fmt.Fprintf(&buf, "    } > %s\n", region)
+		fmt.Fprintf(&buf, "    %s = LOADADDR(%s);\n",
+			placementSymbol(region, "load"), sect)
+		prev = sect
+	}
+
+	fmt.Fprintf(&buf, "}\n")
+
+	return buf.Bytes()
+}
+
+// Generates the <placement/placement.h> header.  The header is generated even
+// if nothing is placed so that code can include it unconditionally.
+func (mp *MemPlacement) header() []byte {
+	buf := bytes.Buffer{}
+
+	fmt.Fprintf(&buf, "/**\n * This file was generated by Apache newt "+
+		"from %s.\n */\n\n", PLACEMENT_KEY)
+	fmt.Fprintf(&buf, "#ifndef H_MYNEWT_PLACEMENT_\n")
+	fmt.Fprintf(&buf, "#define H_MYNEWT_PLACEMENT_\n\n")
+	fmt.Fprintf(&buf, "#include <stdint.h>\n")
+	fmt.Fprintf(&buf, "#include <string.h>\n\n")
+
+	for _, region := range mp.Regions {
+		sect := placementSection(region)
+		macro := "MYNEWT_PLACE_" + strings.ToUpper(region)
+		fmt.Fprintf(&buf, "#define %s __attribute__((section(\"%s.text\")))\n",
+			macro, sect)
+		fmt.Fprintf(&buf, "#define %s_DATA __attribute__((section(\"%s.data\")))\n",
+			macro, sect)
+		fmt.Fprintf(&buf, "#define %s_BSS __attribute__((section(\"%s.bss\")))\n",
+			macro, sect)
+		fmt.Fprintf(&buf, "\n")
+	}
+
+	for _, region := range mp.Regions {
+		for _, suffix := range []string{
+			"start", "end", "load", "bss_start", "bss_end"} {
+
+			fmt.Fprintf(&buf, "extern uint8_t %s[];\n",
+				placementSymbol(region, suffix))
+		}
+		fmt.Fprintf(&buf, "\n")
+	}
+
+	fmt.Fprintf(&buf, "/* Copies placed code and data to their memory "+
+		"regions and zeroes placed\n * uninitialized data.  Call before "+
+		"using anything placed. */\n")
+	fmt.Fprintf(&buf, "static inline void\nmynewt_placement_init(void)\n{\n")
+	for _, region := range mp.Regions {
+		fmt.Fprintf(&buf, "    memcpy(%s, %s, %s - %s);\n",
+			placementSymbol(region, "start"),
+			placementSymbol(region, "load"),
+			placementSymbol(region, "end"),
+			placementSymbol(region, "start"))
+		fmt.Fprintf(&buf, "    memset(%s, 0, %s - %s);\n",
+			placementSymbol(region, "bss_start"),
+			placementSymbol(region, "bss_end"),
+			placementSymbol(region, "bss_start"))
+	}
+	fmt.Fprintf(&buf, "}\n\n")
+
+	fmt.Fprintf(&buf, "#endif\n")
+
+	return buf.Bytes()
+}
+
+// Writes the specified generated file if its contents have changed.
+func writePlacementFile(path string, contents []byte) error {
+	writeReqd, err := util.FileContentsChanged(path, contents)
+	if err != nil {
+		return err
+	}
+	if !writeReqd {
+		log.Debugf("placement unchanged; not writing %s", path)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return util.ChildNewtError(err)
+	}
+	if err := ioutil.WriteFile(path, contents, 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// Reads the target's memory placement and generates the corresponding header
+// and linker script fragment.
+func (t *TargetBuilder) generatePlacement() error {
+	mp, err := t.readPlacement([]*pkg.LocalPackage{
+		t.loaderPkg, t.appPkg, t.target.Package()})
+	if err != nil {
+		return err
+	}
+
+	if !mp.IsEmpty() && len(t.bspPkg.LinkerScripts) == 0 {
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"WARNING: BSP \"%s\" has no linker script; ignoring %s\n",
+			t.bspPkg.FullName(), PLACEMENT_KEY)
+		mp = &MemPlacement{}
+	}
+
+	err = writePlacementFile(GeneratedIncludeDir(t.target.Name())+"/"+
+		PLACEMENT_HEADER_PATH, mp.header())
+	if err != nil {
+		return err
+	}
+
+	if !mp.IsEmpty() {
+		err := writePlacementFile(PlacementScriptPath(t.target.Name()),
+			mp.linkerScript(t.bspPkg.PlacementAnchor))
+		if err != nil {
+			return err
+		}
+	}
+
+	t.placement = mp
+	return nil
+}
+
+// Retrieves the linker scripts that implement the target's memory placement.
+func (t *TargetBuilder) placementScripts() []string {
+	if t.placement == nil || t.placement.IsEmpty() {
+		return nil
+	}
+
+	return []string{PlacementScriptPath(t.target.Name())}
+}
@@ -0,0 +1,206 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// The resolution cache is an experimental, shared store of resolution
+// results.  It is intended for CI setups in which many jobs build targets
+// from the same set of repos.  An entry is keyed by the inputs to resolution:
+// the newt version, the commit of each installed repo, the contents of every
+// configuration file in the local repo (including the target's), and the
+// resolution seeds.  An entry contains the final syscfg setting values, which
+// are fed back into the resolver as hints.  Entries are never reused if any
+// repo contains uncommitted changes.
+
+package builder
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	log "github.com/Sirupsen/logrus"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/newt/resolve"
+	"mynewt.apache.org/newt/newt/settings"
+)
+
+type resCacheEntry struct {
+	Settings map[string]string `json:"settings"`
+}
+
+// Calculates the resolution cache key for the specified seeds.  Returns "" if
+// the resolution cannot be cached.
+func resCacheKey(loaderSeeds []*pkg.LocalPackage,
+	appSeeds []*pkg.LocalPackage, injected map[string]string) string {
+
+	proj := project.GetProject()
+	h := sha256.New()
+
+	fmt.Fprintf(h, "%s\n", newtutil.NewtVersionStr)
+
+	repoNames := make([]string, 0, len(proj.Repos()))
+	for name, _ := range proj.Repos() {
+		repoNames = append(repoNames, name)
+	}
+	sort.Strings(repoNames)
+
+	for _, name := range repoNames {
+		r := proj.Repos()[name]
+		if r.IsLocal() {
+			continue
+		}
+
+		hash, err := r.CurrentHash()
+		if err != nil {
+			return ""
+		}
+		changes, err := r.HasChanges()
+		if err != nil || changes {
+			return ""
+		}
+
+		fmt.Fprintf(h, "repo %s %s\n", name, hash)
+	}
+
+	// The local repo is not necessarily under version control; hash its
+	// configuration files directly.
+	cfgFiles := []string{}
+	if lpkgs := proj.PackageList()[proj.LocalRepo().Name()]; lpkgs != nil {
+		for _, p := range *lpkgs {
+			cfgFiles = append(cfgFiles, p.(*pkg.LocalPackage).CfgFilenames()...)
+		}
+	}
+	sort.Strings(cfgFiles)
+
+	for _, path := range cfgFiles {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return ""
+		}
+		fmt.Fprintf(h, "file %s %x\n", path, sha256.Sum256(data))
+	}
+
+	for _, lpkg := range loaderSeeds {
+		fmt.Fprintf(h, "loader %s\n", lpkg.FullName())
+	}
+	for _, lpkg := range appSeeds {
+		fmt.Fprintf(h, "app %s\n", lpkg.FullName())
+	}
+
+	names := make([]string, 0, len(injected))
+	for k, _ := range injected {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		fmt.Fprintf(h, "inject %s=%s\n", k, injected[k])
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func resCachePath(key string) string {
+	return settings.ResolveCacheDir() + "/" + key + ".json"
+}
+
+// Reads the hint settings for the specified key.  Returns nil if there is no
+// usable cache entry.
+func readResCache(key string) map[string]string {
+	data, err := ioutil.ReadFile(resCachePath(key))
+	if err != nil {
+		return nil
+	}
+
+	entry := resCacheEntry{}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		log.Debugf("Ignoring corrupt resolution cache entry %s: %s",
+			key, err.Error())
+		return nil
+	}
+
+	log.Debugf("Using resolution cache entry %s", key)
+	return entry.Settings
+}
+
+// Stores the specified resolution in the cache.  The entry is written to a
+// temporary file and then renamed, so concurrent jobs never observe a partial
+// entry.  Failure is not an error; the cache is only an optimization.
+func writeResCache(key string, res *resolve.Resolution) {
+	dir := settings.ResolveCacheDir()
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		log.Debugf("Failed to create resolution cache: %s", err.Error())
+		return
+	}
+
+	entry := resCacheEntry{
+		Settings: res.Cfg.SettingValues(),
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	tmp, err := ioutil.TempFile(dir, key+".tmp")
+	if err != nil {
+		log.Debugf("Failed to write resolution cache: %s", err.Error())
+		return
+	}
+	_, err = tmp.Write(data)
+	tmp.Close()
+	if err == nil {
+		err = os.Rename(tmp.Name(), resCachePath(key))
+	}
+	if err != nil {
+		log.Debugf("Failed to write resolution cache: %s", err.Error())
+		os.Remove(tmp.Name())
+	}
+}
+
+// Resolves the specified seeds, consulting the shared resolution cache if it
+// is enabled.
+func (t *TargetBuilder) resolveCached(loaderSeeds []*pkg.LocalPackage,
+	appSeeds []*pkg.LocalPackage) (*resolve.Resolution, error) {
+
+	key := ""
+	if settings.ResolveCacheDir() != "" {
+		key = resCacheKey(loaderSeeds, appSeeds, t.injectedSettings)
+	}
+
+	var hints map[string]string
+	if key != "" {
+		hints = readResCache(key)
+	}
+
+	res, err := resolve.ResolveFullHinted(loaderSeeds, appSeeds,
+		t.injectedSettings, t.bspPkg.FlashMap, hints)
+	if err != nil {
+		return nil, err
+	}
+
+	if key != "" && hints == nil {
+		writeResCache(key, res)
+	}
+
+	return res, nil
+}
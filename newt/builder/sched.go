@@ -0,0 +1,206 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Build job scheduling.  Compiling and archiving are scheduled on a single
+// pool of workers (`newt -j N`) shared by every package in the build.  Work is
+// scheduled at file granularity:
+//     * Each package is archived as soon as its last object file is ready,
+//       rather than after every file in the build has been compiled.
+//     * Source files are compiled in decreasing order of estimated cost, so
+//       that a large file doesn't start last and stretch out the end of the
+//       build while the other workers sit idle.
+//
+// When a job fails, no further jobs are started; jobs that are already
+// running are allowed to finish.
+
+package builder
+
+import (
+	"sort"
+	"sync"
+
+	"mynewt.apache.org/newt/newt/toolchain"
+)
+
+type buildJob struct {
+	// Estimated relative cost; used for ordering only.
+	cost int64
+
+	run func() error
+
+	// The package that the job belongs to; nil if completing the job doesn't
+	// contribute to finishing a package.
+	bpkg *BuildPackage
+}
+
+type buildJobSorter []*buildJob
+
+func (s buildJobSorter) Len() int {
+	return len(s)
+}
+func (s buildJobSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s buildJobSorter) Less(i, j int) bool {
+	return s[i].cost > s[j].cost
+}
+
+type buildSched struct {
+	mtx  sync.Mutex
+	cond *sync.Cond
+
+	// Jobs that can be started, in the order they should be started.
+	ready []*buildJob
+
+	// The number of jobs currently executing.
+	running int
+
+	// The number of unfinished jobs belonging to each package.
+	pending map[*BuildPackage]int
+
+	// Produces the job to run once all of a package's jobs are done; returns
+	// nil if there is nothing left to do for the package.
+	pkgDone func(bpkg *BuildPackage) *buildJob
+
+	// The first error encountered.
+	err error
+}
+
+func newBuildSched(jobs []*buildJob,
+	pkgDone func(bpkg *BuildPackage) *buildJob) *buildSched {
+
+	s := &buildSched{
+		pending: map[*BuildPackage]int{},
+		pkgDone: pkgDone,
+	}
+	s.cond = sync.NewCond(&s.mtx)
+
+	for _, j := range jobs {
+		if j.bpkg != nil {
+			s.pending[j.bpkg]++
+		}
+	}
+
+	// Stable so that equal-cost jobs keep the build's alphabetical order.
+	s.ready = append(s.ready, jobs...)
+	sort.Stable(buildJobSorter(s.ready))
+
+	return s
+}
+
+// Retrieves the next job to run, blocking until one is ready.
+//
+// @return *buildJob            The job; nil if the build is done or has
+//                                  failed.
+func (s *buildSched) next() *buildJob {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for {
+		if s.err != nil {
+			return nil
+		}
+
+		if len(s.ready) > 0 {
+			j := s.ready[0]
+			s.ready = s.ready[1:]
+			s.running++
+			return j
+		}
+
+		if s.running == 0 {
+			return nil
+		}
+
+		// Jobs are still running; one of them may make a new job ready.
+		s.cond.Wait()
+	}
+}
+
+// Records the outcome of a job and readies any job that depended on it.
+func (s *buildSched) finish(j *buildJob, err error) {
+	var follow *buildJob
+	if err == nil && j.bpkg != nil {
+		s.mtx.Lock()
+		s.pending[j.bpkg]--
+		done := s.pending[j.bpkg] == 0
+		s.mtx.Unlock()
+
+		if done {
+			follow = s.pkgDone(j.bpkg)
+		}
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.running--
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+
+	// A package's final job is short and nothing else is waiting on it;
+	// start it ahead of the remaining compiles.
+	if follow != nil {
+		s.ready = append([]*buildJob{follow}, s.ready...)
+	}
+
+	s.cond.Broadcast()
+}
+
+// Executes every job with the specified number of workers.
+//
+// @return error                The first job error encountered.
+func (s *buildSched) run(numWorkers int) error {
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				j := s.next()
+				if j == nil {
+					return
+				}
+				s.finish(j, j.run())
+			}
+		}()
+	}
+	wg.Wait()
+
+	return s.err
+}
+
+// Creates the scheduler job that executes the specified compiler job.
+func compileBuildJob(cj toolchain.CompilerJob, bpkg *BuildPackage,
+	sizes map[string]int64) *buildJob {
+
+	return &buildJob{
+		cost: cj.Compiler.CompileCost(cj.Filename, sizes),
+		run: func() error {
+			return toolchain.RunJob(cj)
+		},
+		bpkg: bpkg,
+	}
+}
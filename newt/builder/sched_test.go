@@ -0,0 +1,167 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// Creates a job that appends its name to the log when it runs.
+func logJob(name string, cost int64, bpkg *BuildPackage, log *[]string,
+	err error) *buildJob {
+
+	return &buildJob{
+		cost: cost,
+		run: func() error {
+			*log = append(*log, name)
+			return err
+		},
+		bpkg: bpkg,
+	}
+}
+
+func TestBuildSchedOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		costs []int64
+		want  []string
+	}{
+		{"by cost", []int64{1, 3, 2}, []string{"j1", "j2", "j0"}},
+		{"equal cost keeps order", []int64{5, 5, 5},
+			[]string{"j0", "j1", "j2"}},
+		{"mixed", []int64{2, 7, 2, 7}, []string{"j1", "j3", "j0", "j2"}},
+	}
+
+	for _, tc := range tests {
+		var log []string
+		jobs := []*buildJob{}
+		for i, cost := range tc.costs {
+			jobs = append(jobs,
+				logJob(fmt.Sprintf("j%d", i), cost, nil, &log, nil))
+		}
+
+		if err := newBuildSched(jobs, nil).run(1); err != nil {
+			t.Fatalf("%s: unexpected error: %s", tc.name, err.Error())
+		}
+		if fmt.Sprint(log) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: order=%v, want %v", tc.name, log, tc.want)
+		}
+	}
+}
+
+func TestBuildSchedArchive(t *testing.T) {
+	pkgA := &BuildPackage{}
+	pkgB := &BuildPackage{}
+	names := map[*BuildPackage]string{pkgA: "a", pkgB: "b"}
+
+	var log []string
+	jobs := []*buildJob{
+		logJob("a0", 4, pkgA, &log, nil),
+		logJob("b0", 3, pkgB, &log, nil),
+		logJob("a1", 2, pkgA, &log, nil),
+		logJob("b1", 1, pkgB, &log, nil),
+	}
+
+	pkgDone := func(bpkg *BuildPackage) *buildJob {
+		return logJob("archive-"+names[bpkg], 0, nil, &log, nil)
+	}
+
+	if err := newBuildSched(jobs, pkgDone).run(1); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	// Each package is archived as soon as its last file is compiled, ahead of
+	// the remaining compiles.
+	want := []string{"a0", "b0", "a1", "archive-a", "b1", "archive-b"}
+	if fmt.Sprint(log) != fmt.Sprint(want) {
+		t.Errorf("order=%v, want %v", log, want)
+	}
+}
+
+func TestBuildSchedStopOnError(t *testing.T) {
+	tests := []struct {
+		name    string
+		failIdx int
+		want    []string
+	}{
+		{"first", 0, []string{"j0"}},
+		{"middle", 1, []string{"j0", "j1"}},
+		{"last", 2, []string{"j0", "j1", "j2"}},
+	}
+
+	for _, tc := range tests {
+		var log []string
+		pkg := &BuildPackage{}
+		archived := false
+
+		jobs := []*buildJob{}
+		for i := 0; i < 3; i++ {
+			var err error
+			if i == tc.failIdx {
+				err = fmt.Errorf("j%d failed", i)
+			}
+			jobs = append(jobs, logJob(fmt.Sprintf("j%d", i), int64(3-i),
+				pkg, &log, err))
+		}
+
+		pkgDone := func(bpkg *BuildPackage) *buildJob {
+			archived = true
+			return nil
+		}
+
+		err := newBuildSched(jobs, pkgDone).run(1)
+		if err == nil || err.Error() != fmt.Sprintf("j%d failed", tc.failIdx) {
+			t.Errorf("%s: err=%v, want j%d failed", tc.name, err, tc.failIdx)
+		}
+		if fmt.Sprint(log) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: ran %v, want %v", tc.name, log, tc.want)
+		}
+		if archived {
+			t.Errorf("%s: package archived despite failure", tc.name)
+		}
+	}
+}
+
+func TestBuildSchedParallel(t *testing.T) {
+	var mtx sync.Mutex
+	count := 0
+
+	jobs := []*buildJob{}
+	for i := 0; i < 50; i++ {
+		jobs = append(jobs, &buildJob{
+			cost: int64(i),
+			run: func() error {
+				mtx.Lock()
+				count++
+				mtx.Unlock()
+				return nil
+			},
+		})
+	}
+
+	if err := newBuildSched(jobs, nil).run(4); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if count != len(jobs) {
+		t.Errorf("ran %d jobs, want %d", count, len(jobs))
+	}
+}
@@ -55,6 +55,11 @@ func (t *TargetBuilder) SelfTestCreateExe() error {
 		return err
 	}
 
+	return t.selfTestBuild()
+}
+
+// Builds and links the test executable.  The build must already be prepared.
+func (t *TargetBuilder) selfTestBuild() error {
 	testRpkg, err := t.getTestRpkg()
 	if err != nil {
 		return err
@@ -66,6 +71,8 @@ func (t *TargetBuilder) SelfTestCreateExe() error {
 			"builder in invalid state: missing test package")
 	}
 
+	t.ccacheStatsBegin()
+
 	if err := t.AppBuilder.Build(); err != nil {
 		return err
 	}
@@ -74,6 +81,8 @@ func (t *TargetBuilder) SelfTestCreateExe() error {
 		return err
 	}
 
+	t.ccacheStatsReport()
+
 	return nil
 }
 
@@ -94,6 +103,49 @@ func (t *TargetBuilder) SelfTestExecute() error {
 	return nil
 }
 
+// Builds and runs the unit test.  If useCache is true, the test is skipped if
+// it passed during a previous run with identical inputs.
+//
+// @return bool                 true if the test was skipped.
+func (t *TargetBuilder) SelfTestExecuteCached(useCache bool) (bool, error) {
+	if err := t.PrepBuild(); err != nil {
+		return false, err
+	}
+
+	key, err := t.testInputHash()
+	if err != nil {
+		// Caching is an optimization; just run the test.
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Cannot cache test result: %s\n", err.Error())
+		key = ""
+	}
+
+	if useCache && key != "" && t.testPassedBefore(key) {
+		return true, nil
+	}
+
+	t.clearTestPass()
+
+	if err := t.selfTestBuild(); err != nil {
+		return false, err
+	}
+
+	testRpkg, err := t.getTestRpkg()
+	if err != nil {
+		return false, err
+	}
+
+	if err := t.AppBuilder.SelfTestExecute(testRpkg); err != nil {
+		return false, err
+	}
+
+	if key != "" {
+		t.recordTestPass(key)
+	}
+
+	return false, nil
+}
+
 func (t *TargetBuilder) SelfTestDebug() error {
 	if err := t.PrepBuild(); err != nil {
 		return err
@@ -149,12 +201,37 @@ func (b *Builder) SelfTestExecute(testRpkg *resolve.ResolvePackage) error {
 	util.StatusMessage(util.VERBOSITY_DEFAULT, "Executing test: %s\n",
 		testPath)
 	cmd := []string{testPath}
-	if _, err := util.ShellCommand(cmd, nil); err != nil {
+	output, err := util.ShellCommand(cmd, nil)
+
+	// Tests written for an alternative framework report their own counts;
+	// a reported failure fails the test even if the exit status doesn't.
+	fw := b.targetBuilder.testFw
+	res := fw.parseSummary(string(output))
+	b.targetBuilder.testResult = res
+	if res != nil {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"%s: %d tests, %d failures (%s)\n",
+			testRpkg.Lpkg.Name(), res.Tests, res.Failures, fw.Name)
+	}
+
+	if err != nil {
 		newtError := err.(*util.NewtError)
 		newtError.Text = fmt.Sprintf("Test failure (%s):\n%s",
 			testRpkg.Lpkg.Name(), newtError.Text)
 		return newtError
 	}
+	if res != nil && res.Failures > 0 {
+		return util.FmtNewtError("Test failure (%s):\n%s",
+			testRpkg.Lpkg.Name(), string(output))
+	}
 
 	return nil
 }
+
+// Retrieves the counts reported by the most recently executed test.
+//
+// @return *TestResult          The counts; nil if the test wasn't executed or
+//                                  its framework doesn't report counts.
+func (t *TargetBuilder) TestResult() *TestResult {
+	return t.testResult
+}
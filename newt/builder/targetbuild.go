@@ -43,6 +43,7 @@ import (
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/project"
 	"mynewt.apache.org/newt/newt/resolve"
+	"mynewt.apache.org/newt/newt/settings"
 	"mynewt.apache.org/newt/newt/symbol"
 	"mynewt.apache.org/newt/newt/syscfg"
 	"mynewt.apache.org/newt/newt/sysinit"
@@ -59,6 +60,10 @@ type TargetBuilder struct {
 	loaderPkg   *pkg.LocalPackage
 	testPkg     *pkg.LocalPackage
 
+	// Alternative test framework used by testPkg; nil for the native one.
+	testFw     *testFramework
+	testResult *TestResult
+
 	AppBuilder *Builder
 	AppList    interfaces.PackageList
 
@@ -68,12 +73,40 @@ type TargetBuilder struct {
 	keyFile          string
 	injectedSettings map[string]string
 
+	// The signing profile used to sign the images, and the hash of its
+	// public key; recorded in the manifest.
+	signingProfile string
+	signingKeyHash string
+
+	// Assignments of packages and files to alternate memory regions.
+	placement *MemPlacement
+
+	// The launcher for compiler invocations (nil if compiling locally), and
+	// ccache's statistics when the current build started.
+	launcher         *toolchain.Launcher
+	launcherResolved bool
+	ccacheStart      *toolchain.CcacheStats
+
 	res *resolve.Resolution
 }
 
 func NewTargetTester(target *target.Target,
 	testPkg *pkg.LocalPackage) (*TargetBuilder, error) {
 
+	// Build against the repo versions the target pins, if any.  This may
+	// reload the test package from a different checkout.
+	proj := project.GetProject()
+	if err := proj.UseRepoVersions(target.RepoVersions); err != nil {
+		return nil, err
+	}
+	if testPkg != nil {
+		var err error
+		testPkg, err = proj.ResolvePackage(testPkg.Repo(), testPkg.FullName())
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if err := target.Validate(testPkg == nil); err != nil {
 		return nil, err
 	}
@@ -83,7 +116,7 @@ func NewTargetTester(target *target.Target,
 		return nil, err
 	}
 
-	compilerPkg, err := project.GetProject().ResolvePackage(
+	compilerPkg, err := proj.ResolvePackage(
 		bspPkg.Repo(), bspPkg.CompilerName)
 	if err != nil {
 		return nil, err
@@ -114,8 +147,16 @@ func (t *TargetBuilder) NewCompiler(dstDir string) (
 		t.compilerPkg.BasePath(),
 		dstDir,
 		t.target.BuildProfile)
+	if err != nil {
+		return nil, err
+	}
+
+	c.SetLauncher(t.compilerLauncher())
+	if settings.ObjectCache() {
+		c.SetObjCacheDir(ObjCacheDir())
+	}
 
-	return c, err
+	return c, nil
 }
 
 func (t *TargetBuilder) ensureResolved() error {
@@ -168,18 +209,81 @@ func (t *TargetBuilder) ensureResolved() error {
 		t.injectedSettings["SELFTEST"] = "1"
 
 		appSeeds = append(appSeeds, t.testPkg)
+
+		// A test written for an alternative framework pulls in the
+		// framework's adapter package, which supplies the runner.
+		fw, err := resolveTestFramework(t.testPkg)
+		if err != nil {
+			return err
+		}
+		if fw != nil {
+			t.testFw = fw
+			t.injectedSettings[fw.settingName()] = "1"
+			appSeeds = append(appSeeds, fw.Adapter)
+		}
 	}
 
 	var err error
-	t.res, err = resolve.ResolveFull(
-		loaderSeeds, appSeeds, t.injectedSettings, t.bspPkg.FlashMap)
+	t.res, err = t.resolveCached(loaderSeeds, appSeeds)
 	if err != nil {
 		return err
 	}
 
+	if err := t.verifyCapabilities(); err != nil {
+		return err
+	}
+
+	if err := t.fetchArtifacts(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// Ensures the BSP provides every hardware feature required by the resolved
+// packages.  A package lists the features it depends on in its "pkg.req_hw"
+// setting; a BSP lists the features it provides in "bsp.capabilities".
+func (t *TargetBuilder) verifyCapabilities() error {
+	if t.bspPkg.Capabilities == nil {
+		return nil
+	}
+
+	rpkgs := append([]*resolve.ResolvePackage{}, t.res.AppSet.Rpkgs...)
+	if t.res.LoaderSet != nil {
+		rpkgs = append(rpkgs, t.res.LoaderSet.Rpkgs...)
+	}
+
+	missing := map[string][]string{}
+	for _, rpkg := range rpkgs {
+		settings := t.res.Cfg.AllSettingsForLpkg(rpkg.Lpkg)
+		reqs := rpkg.Lpkg.PkgY.GetValStringSlice("pkg.req_hw", settings)
+		for _, req := range reqs {
+			if !t.bspPkg.HasCapability(req) {
+				missing[req] = append(missing[req], rpkg.Lpkg.FullName())
+			}
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	caps := make([]string, 0, len(missing))
+	for c, _ := range missing {
+		caps = append(caps, c)
+	}
+	sort.Strings(caps)
+
+	str := fmt.Sprintf("BSP %s lacks hardware required by the target's "+
+		"packages:", t.bspPkg.FullName())
+	for _, c := range caps {
+		str += fmt.Sprintf("\n    * %s, required by: %s", c,
+			strings.Join(util.SortFields(missing[c]...), " "))
+	}
+
+	return util.NewNewtError(str)
+}
+
 func (t *TargetBuilder) Resolve() (*resolve.Resolution, error) {
 	if err := t.ensureResolved(); err != nil {
 		return nil, err
@@ -247,10 +351,24 @@ func (t *TargetBuilder) generateCode() error {
 		return err
 	}
 
+	if err := t.generatePlacement(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func (t *TargetBuilder) PrepBuild() error {
+	if err := EnsureBinLayout(); err != nil {
+		return err
+	}
+
+	for _, m := range project.GetProject().LockMismatches() {
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"WARNING: %s; run `newt install -f` to restore the locked "+
+				"commit\n", m)
+	}
+
 	if err := t.ensureResolved(); err != nil {
 		return err
 	}
@@ -260,6 +378,9 @@ func (t *TargetBuilder) PrepBuild() error {
 		return util.NewNewtError(flashErrText)
 	}
 
+	// Explain any full rebuild before the generated files get rewritten.
+	t.checkBuildMeta()
+
 	if err := t.validateAndWriteCfg(); err != nil {
 		return err
 	}
@@ -428,6 +549,12 @@ func (t *TargetBuilder) Build() error {
 		return err
 	}
 
+	if err := t.checkHostTools(); err != nil {
+		return err
+	}
+
+	t.ccacheStatsBegin()
+
 	/* Build the Apps */
 	project.ResetDeps(t.AppList)
 
@@ -461,11 +588,21 @@ func (t *TargetBuilder) Build() error {
 		return err
 	}
 
+	t.warnUnusedSettings()
+
 	/* Create manifest. */
 	if err := t.createManifest(); err != nil {
 		return err
 	}
 
+	t.writeBuildMeta()
+
+	if err := t.writeCompileCmds(); err != nil {
+		return err
+	}
+
+	t.ccacheStatsReport()
+
 	return nil
 }
 
@@ -604,11 +741,59 @@ func (t *TargetBuilder) GetTestPkg() *pkg.LocalPackage {
 	return t.testPkg
 }
 
+func (t *TargetBuilder) GetCompilerPkg() *pkg.LocalPackage {
+	return t.compilerPkg
+}
+
+// Calculates the set of compiler flags that get applied to every source file
+// in the app image (target, app, BSP, and compiler flags, after conflict
+// resolution).  Nothing gets generated or built.
+func (t *TargetBuilder) EffectiveCompilerInfo() (
+	*toolchain.CompilerInfo, error) {
+
+	if err := t.ensureResolved(); err != nil {
+		return nil, err
+	}
+
+	b, err := NewBuilder(t, BUILD_NAME_APP, t.res.AppSet.Rpkgs,
+		t.res.ApiMap, t.res.Cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.PrepBuild(); err != nil {
+		return nil, err
+	}
+
+	if t.res.LoaderSet != nil {
+		appFlags := toolchain.NewCompilerInfo()
+		appFlags.Cflags = append(appFlags.Cflags, "-DSPLIT_APPLICATION")
+		b.AddCompilerInfo(appFlags)
+	}
+
+	c, err := t.NewCompiler("")
+	if err != nil {
+		return nil, err
+	}
+	lclInfo := c.GetLocalCompilerInfo()
+
+	ci := toolchain.NewCompilerInfo()
+	ci.AddCompilerInfo(b.compilerInfo)
+	ci.AddCompilerInfo(&lclInfo)
+
+	return ci, nil
+}
+
 func (t *TargetBuilder) InjectSetting(key string, value string) {
 	t.injectedSettings[key] = value
 }
 
-func readManifest(path string) (*image.ImageManifest, error) {
+// Records the signing profile that signs the target's images.
+func (t *TargetBuilder) SetSigningProfile(name string, keyHash string) {
+	t.signingProfile = name
+	t.signingKeyHash = keyHash
+}
+
+func ReadManifest(path string) (*image.ImageManifest, error) {
 	content, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, util.ChildNewtError(err)
@@ -625,7 +810,7 @@ func readManifest(path string) (*image.ImageManifest, error) {
 
 func (t *TargetBuilder) createManifest() error {
 	manifest := &image.ImageManifest{
-		Date: time.Now().Format(time.RFC3339),
+		Date: newtutil.BuildTime().Format(time.RFC3339),
 		Name: t.GetTarget().FullName(),
 	}
 
@@ -642,6 +827,12 @@ func (t *TargetBuilder) createManifest() error {
 		}
 	}
 
+	artifacts, err := t.collectOutputs(rm)
+	if err != nil {
+		return err
+	}
+	manifest.Artifacts = artifacts
+
 	manifest.Repos = rm.AllRepos()
 
 	vars := t.GetTarget().Vars
@@ -698,12 +889,13 @@ func (t *TargetBuilder) createManifest() error {
 //     * Loader image path
 //     * Loader image hash
 //     * Build ID
+//     * Attestation metadata
 func (t *TargetBuilder) augmentManifest(
 	appImg *image.Image,
 	loaderImg *image.Image,
 	buildId []byte) error {
 
-	manifest, err := readManifest(t.AppBuilder.ManifestPath())
+	manifest, err := ReadManifest(t.AppBuilder.ManifestPath())
 	if err != nil {
 		return err
 	}
@@ -718,6 +910,13 @@ func (t *TargetBuilder) augmentManifest(
 	}
 
 	manifest.BuildID = fmt.Sprintf("%x", buildId)
+	manifest.SigningProfile = t.signingProfile
+	manifest.SigningKeyHash = t.signingKeyHash
+
+	manifest.Attestation, err = t.attestation(appImg)
+	if err != nil {
+		return err
+	}
 
 	file, err := os.Create(t.AppBuilder.ManifestPath())
 	if err != nil {
@@ -739,9 +938,18 @@ func (t *TargetBuilder) augmentManifest(
 	return nil
 }
 
-// Calculates the size of a single boot trailer.  This is the amount of flash
-// that must be reserved at the end of each image slot.
-func (t *TargetBuilder) bootTrailerSize() int {
+// The magic number that indicates a valid boot trailer.  This is the boot
+// loader's array of four 32-bit words, serialized in little endian order.
+var bootTrailerMagic = []byte{
+	0x77, 0xc2, 0x95, 0xf3,
+	0x60, 0xd2, 0xef, 0x7f,
+	0x35, 0x52, 0x50, 0x0f,
+	0x2c, 0xb6, 0x79, 0x80,
+}
+
+// Determines the minimum write size of the target's flash from the
+// MCU_FLASH_MIN_WRITE_SIZE setting.
+func (t *TargetBuilder) flashMinWriteSize() int {
 	var minWriteSz int
 
 	entry, ok := t.res.Cfg.Settings["MCU_FLASH_MIN_WRITE_SIZE"]
@@ -763,6 +971,14 @@ func (t *TargetBuilder) bootTrailerSize() int {
 		}
 	}
 
+	return minWriteSz
+}
+
+// Calculates the size of a single boot trailer.  This is the amount of flash
+// that must be reserved at the end of each image slot.
+func (t *TargetBuilder) bootTrailerSize() int {
+	minWriteSz := t.flashMinWriteSize()
+
 	/* Mynewt boot trailer format:
 	 *
 	 *  0                   1                   2                   3
@@ -790,6 +1006,31 @@ func (t *TargetBuilder) bootTrailerSize() int {
 	return tsize
 }
 
+// Generates the boot trailer of a factory-programmed image in slot 0.  The
+// trailer contains a valid magic number and has the "image ok" flag set, so
+// the boot loader treats the image as confirmed on the device's first boot.
+// All other fields are left in the erased state (0xff).
+//
+// @return []byte               The trailer; to be written to the very end of
+//                                  the image's slot.
+func (t *TargetBuilder) FirstBootTrailer() ([]byte, error) {
+	if err := t.ensureResolved(); err != nil {
+		return nil, err
+	}
+
+	minWriteSz := t.flashMinWriteSize()
+
+	trailer := make([]byte, t.bootTrailerSize())
+	for i, _ := range trailer {
+		trailer[i] = 0xff
+	}
+
+	copy(trailer, bootTrailerMagic)
+	trailer[len(trailer)-minWriteSz] = 0x01
+
+	return trailer, nil
+}
+
 // Calculates the size of the largest image that can be written to each image
 // slot.
 func (t *TargetBuilder) maxImgSizes() []int {
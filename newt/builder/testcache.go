@@ -0,0 +1,161 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// The test result cache lets `newt test` skip unit tests that passed during a
+// previous run and whose inputs haven't changed since.  A test's inputs are
+// the contents of every package in its resolution (including the compiler
+// and target packages), the generated syscfg and sysinit code, and the newt
+// version.  When a test passes, a digest of its inputs is written to the
+// test target's bin directory; a later run with the same digest is skipped.
+
+package builder
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+)
+
+const TEST_PASS_FILENAME = "test-pass.sha256"
+
+func (t *TargetBuilder) testPassPath() string {
+	return TargetBinDir(t.target.Name()) + "/" + TEST_PASS_FILENAME
+}
+
+// Adds the name and contents of every file beneath the specified directory to
+// a digest.  Subdirectories containing their own package are skipped; they
+// are hashed separately if they are part of the resolution.
+func hashDirContents(h hash.Hash, dir string, skipPkgs bool) error {
+	if util.NodeNotExist(dir) {
+		return nil
+	}
+
+	return filepath.Walk(dir, func(path string, info os.FileInfo,
+		err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if skipPkgs && path != dir &&
+				util.NodeExist(path+"/"+"pkg.yml") {
+
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		fmt.Fprintf(h, "%s\n", filepath.ToSlash(rel))
+		_, err = io.Copy(h, f)
+		return err
+	})
+}
+
+// Calculates the digest of the test's inputs.  It must be called after the
+// build has been prepared (i.e., after PrepBuild()), so that the generated
+// code is up to date.
+func (t *TargetBuilder) testInputHash() (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", newtutil.NewtVersionStr)
+
+	dirs := map[string]struct{}{
+		t.compilerPkg.BasePath():      struct{}{},
+		t.target.Package().BasePath(): struct{}{},
+	}
+	for _, rpkg := range t.res.AppSet.Rpkgs {
+		dirs[rpkg.Lpkg.BasePath()] = struct{}{}
+	}
+
+	sorted := make([]string, 0, len(dirs))
+	for d, _ := range dirs {
+		sorted = append(sorted, d)
+	}
+	sort.Strings(sorted)
+
+	for _, d := range sorted {
+		fmt.Fprintf(h, "pkg %s\n", d)
+		if err := hashDirContents(h, d, true); err != nil {
+			return "", util.ChildNewtError(err)
+		}
+	}
+
+	for _, d := range []string{
+		GeneratedSrcDir(t.target.Name()),
+		GeneratedIncludeDir(t.target.Name()),
+	} {
+		fmt.Fprintf(h, "generated %s\n", d)
+		if err := hashDirContents(h, d, false); err != nil {
+			return "", util.ChildNewtError(err)
+		}
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// Indicates whether the test passed during a previous run with the specified
+// input digest.
+func (t *TargetBuilder) testPassedBefore(key string) bool {
+	data, err := ioutil.ReadFile(t.testPassPath())
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimSpace(string(data)) == key
+}
+
+// Records a passing test run.
+func (t *TargetBuilder) recordTestPass(key string) {
+	if err := ioutil.WriteFile(t.testPassPath(), []byte(key+"\n"),
+		0644); err != nil {
+
+		log.Debugf("failed to record test result: %s", err.Error())
+	}
+}
+
+// Forgets any previous passing run; a failing test must always be re-run.
+func (t *TargetBuilder) clearTestPass() {
+	os.Remove(t.testPassPath())
+}
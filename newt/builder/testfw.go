@@ -0,0 +1,161 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/util"
+)
+
+// Name of Mynewt's native test framework (test/testutil).  A unit test
+// package that doesn't specify a framework uses it.
+const TEST_FRAMEWORK_NATIVE = "testutil"
+
+// An alternative unit test framework (e.g., Unity or CppUTest).  A unit test
+// package selects a framework with its "pkg.test_framework" setting.  The
+// framework is made available by an adapter package which declares
+// "pkg.test_framework_adapter: <name>" and provides the runner glue (main()
+// and the framework sources or a dependency on them).
+//
+// An adapter can also specify a "pkg.test_framework_summary" regular
+// expression.  It is matched against the test executable's output; its
+// first two capture groups are the number of tests run and the number of
+// failures.  This lets `newt test` report the results of every framework
+// uniformly.
+type testFramework struct {
+	Name      string
+	Adapter   *pkg.LocalPackage
+	SummaryRe *regexp.Regexp
+}
+
+// The outcome of a single test executable, as reported by its framework.
+type TestResult struct {
+	Tests    int
+	Failures int
+}
+
+func testFrameworkName(testPkg *pkg.LocalPackage) string {
+	name := testPkg.PkgY.GetValString("pkg.test_framework", nil)
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// Finds the adapter packages for the specified framework among all the
+// project's packages.
+func findTestFrameworkAdapters(name string) []*pkg.LocalPackage {
+	adapters := []*pkg.LocalPackage{}
+	for _, pack := range project.GetProject().PackagesOfType(-1) {
+		lpkg := pack.(*pkg.LocalPackage)
+		fw := lpkg.PkgY.GetValString("pkg.test_framework_adapter", nil)
+		if strings.ToLower(strings.TrimSpace(fw)) == name {
+			adapters = append(adapters, lpkg)
+		}
+	}
+
+	return adapters
+}
+
+// Determines which test framework the specified unit test package uses.
+// @return *testFramework       The package's framework; nil if the package
+//                                  uses the native framework.
+func resolveTestFramework(testPkg *pkg.LocalPackage) (*testFramework, error) {
+	name := testFrameworkName(testPkg)
+	if name == "" || name == TEST_FRAMEWORK_NATIVE {
+		return nil, nil
+	}
+
+	adapters := findTestFrameworkAdapters(name)
+	if len(adapters) == 0 {
+		return nil, util.FmtNewtError(
+			"package %s uses test framework \"%s\", but no package provides "+
+				"an adapter for it (pkg.test_framework_adapter: %s)",
+			testPkg.FullName(), name, name)
+	}
+	if len(adapters) > 1 {
+		names := make([]string, len(adapters))
+		for i, a := range adapters {
+			names[i] = a.FullName()
+		}
+		return nil, util.FmtNewtError(
+			"multiple adapters for test framework \"%s\": %s",
+			name, strings.Join(names, ", "))
+	}
+
+	fw := &testFramework{
+		Name:    name,
+		Adapter: adapters[0],
+	}
+
+	reStr := fw.Adapter.PkgY.GetValString("pkg.test_framework_summary", nil)
+	if reStr != "" {
+		var err error
+		fw.SummaryRe, err = regexp.Compile(reStr)
+		if err != nil {
+			return nil, util.FmtNewtError(
+				"%s: invalid pkg.test_framework_summary: %s",
+				fw.Adapter.FullName(), err.Error())
+		}
+		if fw.SummaryRe.NumSubexp() < 2 {
+			return nil, util.FmtNewtError(
+				"%s: pkg.test_framework_summary must contain two capture "+
+					"groups (tests, failures)", fw.Adapter.FullName())
+		}
+	}
+
+	return fw, nil
+}
+
+// Name of the setting that is injected into a test build to let packages
+// know which framework is in use (e.g., TEST_FRAMEWORK_UNITY).
+func (fw *testFramework) settingName() string {
+	return "TEST_FRAMEWORK_" + util.CIdentifier(strings.ToUpper(fw.Name))
+}
+
+// Extracts the test counts from a test executable's output.  The last
+// matching line wins, since frameworks print their summary at the end.
+//
+// @return *TestResult          The parsed counts; nil if the output doesn't
+//                                  contain a summary.
+func (fw *testFramework) parseSummary(output string) *TestResult {
+	if fw == nil || fw.SummaryRe == nil {
+		return nil
+	}
+
+	matches := fw.SummaryRe.FindAllStringSubmatch(output, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+	m := matches[len(matches)-1]
+
+	tests, err1 := strconv.Atoi(m[1])
+	failures, err2 := strconv.Atoi(m[2])
+	if err1 != nil || err2 != nil {
+		return nil
+	}
+
+	return &TestResult{
+		Tests:    tests,
+		Failures: failures,
+	}
+}
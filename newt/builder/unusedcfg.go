@@ -0,0 +1,206 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package builder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/syscfg"
+	"mynewt.apache.org/newt/newt/toolchain"
+	"mynewt.apache.org/newt/util"
+)
+
+// Matches a reference to a syscfg setting in C source: MYNEWT_VAL(NAME) or
+// MYNEWT_VAL_NAME.
+var cfgRefRe = regexp.MustCompile(
+	`\bMYNEWT_VAL(?:\(\s*([A-Za-z0-9_]+)\s*\)|_([A-Za-z0-9_]+))`)
+
+var identRe = regexp.MustCompile(`[A-Za-z0-9_]+`)
+
+// Settings that newt itself reads; they need not appear in any source file.
+var newtCfgSettings = map[string]bool{
+	"BOOT_LOADER":              true,
+	"BSP_SIMULATED":            true,
+	"MCU_FLASH_MIN_WRITE_SIZE": true,
+}
+
+// Collects the names of all settings referenced by the specified compiled
+// files and every header they include.
+//
+// @return map[string]bool      The referenced setting names (upper case).
+// @return bool                 False if the dependency information is
+//                                  incomplete; the result is unusable then.
+func cfgRefsInSources(jobs []toolchain.CompilerJob,
+	exclude string) (map[string]bool, bool) {
+
+	projPath := interfaces.GetProject().Path()
+
+	files := map[string]bool{}
+	for _, job := range jobs {
+		files[job.Filename] = true
+
+		deps, err := toolchain.ParseDepsFile(
+			job.Compiler.DepFilePath(job.Filename))
+		if err != nil {
+			log.Debugf("No dependency information for %s; not checking "+
+				"for unused settings", job.Filename)
+			return nil, false
+		}
+		for _, dep := range deps {
+			if !filepath.IsAbs(dep) {
+				dep = projPath + "/" + dep
+			}
+			files[filepath.ToSlash(filepath.Clean(dep))] = true
+		}
+	}
+
+	refs := map[string]bool{}
+	for file, _ := range files {
+		if file == exclude {
+			continue
+		}
+
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		for _, m := range cfgRefRe.FindAllStringSubmatch(
+			string(contents), -1) {
+
+			refs[strings.ToUpper(m[1]+m[2])] = true
+		}
+	}
+
+	return refs, true
+}
+
+// Collects the identifiers that appear in a package's YAML files, other than
+// as the key of a setting definition or override.  A setting can be
+// referenced in YAML as the condition of a conditional key (e.g.,
+// "pkg.deps.BLE_DEVICE") or in another setting's value or restriction.
+func cfgRefsInYaml(lpkg *pkg.LocalPackage, refs map[string]bool) {
+	paths := append([]string{lpkg.BasePath() + "/" + pkg.PACKAGE_FILE_NAME},
+		lpkg.CfgFilenames()...)
+
+	for _, path := range paths {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		for _, line := range strings.Split(string(contents), "\n") {
+			if i := strings.Index(line, "#"); i >= 0 {
+				line = line[:i]
+			}
+
+			// A line of the form "NAME: value" defines or overrides NAME;
+			// only the value can refer to other settings.
+			t := strings.TrimSpace(line)
+			if i := strings.Index(t, ":"); i > 0 &&
+				identRe.FindString(t) == strings.Trim(t[:i], "'\" ") {
+
+				t = t[i+1:]
+			}
+
+			for _, id := range identRe.FindAllString(t, -1) {
+				refs[strings.ToUpper(id)] = true
+			}
+		}
+	}
+}
+
+// Warns about syscfg settings that the target or app overrides but that
+// nothing in the build refers to.  Such an override has no effect; usually it
+// is left over from an older version of a dependency that has since renamed
+// or removed the setting.
+func (t *TargetBuilder) warnUnusedSettings() {
+	overriders := map[*pkg.LocalPackage]bool{t.target.Package(): true}
+	if t.appPkg != nil {
+		overriders[t.appPkg] = true
+	}
+
+	builders := []*Builder{t.AppBuilder}
+	if t.LoaderBuilder != nil {
+		builders = append(builders, t.LoaderBuilder)
+	}
+
+	header := GeneratedIncludeDir(t.target.Name()) + "/" + syscfg.HEADER_PATH
+
+	refs := map[string]bool{}
+	for _, b := range builders {
+		srcRefs, ok := cfgRefsInSources(b.compileJobs, header)
+		if !ok {
+			return
+		}
+		for name, _ := range srcRefs {
+			refs[name] = true
+		}
+
+		for _, bpkg := range b.PkgMap {
+			cfgRefsInYaml(bpkg.rpkg.Lpkg, refs)
+		}
+	}
+
+	unused := map[string][]string{}
+	for name, entry := range t.res.Cfg.Settings {
+		if refs[strings.ToUpper(util.CIdentifier(name))] ||
+			newtCfgSettings[name] ||
+			entry.SettingType == syscfg.CFG_SETTING_TYPE_FLASH_OWNER {
+
+			continue
+		}
+
+		for _, point := range entry.History {
+			if point.Source != nil && overriders[point.Source] &&
+				point.Source != entry.PackageDef {
+
+				unused[name] = append(unused[name], point.Source.FullName())
+			}
+		}
+	}
+
+	if len(unused) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(unused))
+	for name, _ := range unused {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	str := "* Warning: the following syscfg overrides have no effect; no " +
+		"compiled file refers to the settings (left over from an older " +
+		"dependency?):\n"
+	for _, name := range names {
+		str += fmt.Sprintf("    %s (overridden by: %s)\n", name,
+			strings.Join(util.SortFields(unused[name]...), " "))
+	}
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "%s", str)
+}
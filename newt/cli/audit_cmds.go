@@ -0,0 +1,258 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/newt/audit"
+	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/resolve"
+	"mynewt.apache.org/newt/util"
+)
+
+var auditFeed string
+var auditLicenseFormat string
+var auditLicensePolicy string
+
+func auditRunCmd(cmd *cobra.Command, args []string) {
+	proj := TryGetProject()
+
+	advisories, err := audit.ReadFeed(audit.FeedLocation(auditFeed))
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	findings, unknown, err := audit.Audit(proj, advisories)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	for _, name := range unknown {
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"WARNING: Cannot audit repo \"%s\"; installed version is "+
+				"unknown\n", name)
+	}
+
+	if len(findings) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"No known vulnerabilities found (%d advisories checked)\n",
+			len(advisories))
+		return
+	}
+
+	for _, f := range findings {
+		util.StatusMessage(util.VERBOSITY_QUIET, "@%s %s: %s\n",
+			f.RepoName, f.Version.String(), f.Advisory.Id)
+		if f.Advisory.Summary != "" {
+			util.StatusMessage(util.VERBOSITY_QUIET, "    %s\n",
+				f.Advisory.Summary)
+		}
+		if f.Advisory.Fixed != "" {
+			util.StatusMessage(util.VERBOSITY_QUIET, "    fixed in: %s\n",
+				f.Advisory.Fixed)
+		}
+		if f.Advisory.Url != "" {
+			util.StatusMessage(util.VERBOSITY_QUIET, "    %s\n",
+				f.Advisory.Url)
+		}
+	}
+
+	NewtUsage(nil, util.FmtNewtError(
+		"%d known vulnerabilities affect installed repos", len(findings)))
+}
+
+// Retrieves the packages whose licenses get audited: the packages that the
+// specified target resolves to, or every package in the project if no target
+// is specified.
+func auditLicensePkgs(args []string) []*pkg.LocalPackage {
+	if len(args) == 0 {
+		var lpkgs []*pkg.LocalPackage
+		for _, pkgList := range TryGetProject().PackageList() {
+			for _, p := range *pkgList {
+				lpkg := p.(*pkg.LocalPackage)
+				if lpkg.Type() != pkg.PACKAGE_TYPE_TARGET &&
+					!strings.HasSuffix(lpkg.Name(), "/unittest") {
+
+					lpkgs = append(lpkgs, lpkg)
+				}
+			}
+		}
+		return lpkgs
+	}
+
+	t := ResolveTarget(args[0])
+	if t == nil {
+		NewtUsage(nil, util.NewNewtError("Invalid target name: "+args[0]))
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	res, err := b.Resolve()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	rpkgs := append([]*resolve.ResolvePackage{}, res.AppSet.Rpkgs...)
+	if res.LoaderSet != nil {
+		rpkgs = append(rpkgs, res.LoaderSet.Rpkgs...)
+	}
+
+	seen := map[*pkg.LocalPackage]bool{}
+	var lpkgs []*pkg.LocalPackage
+	for _, lpkg := range resolve.RpkgSliceToLpkgSlice(rpkgs) {
+		if !seen[lpkg] {
+			seen[lpkg] = true
+			lpkgs = append(lpkgs, lpkg)
+		}
+	}
+
+	return lpkgs
+}
+
+func printLicenseEntries(entries []audit.LicenseEntry, format string) {
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(entries, "", "    ")
+		if err != nil {
+			NewtUsage(nil, util.ChildNewtError(err))
+		}
+		util.StatusMessage(util.VERBOSITY_QUIET, "%s\n", string(b))
+
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"package", "repo", "license", "source", "status"})
+		for _, e := range entries {
+			w.Write([]string{e.Package, e.Repo, e.License, e.Source, e.Status})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			NewtUsage(nil, util.ChildNewtError(err))
+		}
+
+	case "text":
+		for _, e := range entries {
+			lic := e.License
+			if lic == "" {
+				lic = "-"
+			}
+			line := e.Package + ": " + lic
+			if e.Source != "" && e.Source != pkg.PACKAGE_FILE_NAME {
+				line += " (" + e.Source + ")"
+			}
+			if e.Status != audit.LICENSE_STATUS_OK {
+				line += " [" + strings.ToUpper(e.Status) + "]"
+			}
+			util.StatusMessage(util.VERBOSITY_DEFAULT, "%s\n", line)
+		}
+
+	default:
+		NewtUsage(nil, util.FmtNewtError(
+			"invalid format \"%s\"; must be text, json, or csv", format))
+	}
+}
+
+func auditLicensesRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) > 1 {
+		NewtUsage(cmd, util.NewNewtError("Too many arguments"))
+	}
+
+	proj := TryGetProject()
+
+	pol, err := audit.ReadLicensePolicy(proj, auditLicensePolicy)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	entries := audit.AuditLicenses(auditLicensePkgs(args), pol)
+	printLicenseEntries(entries, auditLicenseFormat)
+
+	flagged := 0
+	for _, e := range entries {
+		if e.Status != audit.LICENSE_STATUS_OK {
+			flagged++
+		}
+	}
+
+	if flagged > 0 {
+		NewtUsage(nil, util.FmtNewtError(
+			"%d of %d packages have missing or incompatible licenses",
+			flagged, len(entries)))
+	}
+}
+
+func AddAuditCommands(cmd *cobra.Command) {
+	auditHelpText := "Check the project's installed repos against a feed " +
+		"of known vulnerabilities.  The feed location is specified with " +
+		"the --feed option or the \"audit.feed\" setting in " +
+		"~/.newt/repos.yml; it can be a local file or an http(s) URL."
+	auditHelpEx := "  newt audit\n"
+	auditHelpEx += "  newt audit --feed https://example.com/mynewt-cves.yml"
+
+	auditCmd := &cobra.Command{
+		Use:     "audit",
+		Short:   "Report known vulnerabilities in installed repos",
+		Long:    auditHelpText,
+		Example: auditHelpEx,
+		Run:     auditRunCmd,
+	}
+	auditCmd.PersistentFlags().StringVarP(&auditFeed, "feed", "f", "",
+		"Location of the vulnerability feed (file path or URL)")
+
+	licensesHelpText := "Report the license of every package in the " +
+		"project, or of every package that <target-name> resolves to.  " +
+		"A package's license is taken from its \"pkg.license\" setting, " +
+		"or else identified from the nearest LICENSE or COPYING file in " +
+		"its repo.\n\n" +
+		"Licenses are checked against the \"allow\" and \"deny\" lists in " +
+		"the \"audit.license_policy\" setting in project.yml, or in the " +
+		"file given with --policy.  Without a policy, GPL and AGPL " +
+		"licenses are flagged.  Newt exits with an error if any package " +
+		"has a missing, unrecognized, or incompatible license."
+	licensesHelpEx := "  newt audit licenses\n"
+	licensesHelpEx += "  newt audit licenses --format csv my_target1\n"
+	licensesHelpEx += "  newt audit licenses --policy license-policy.yml"
+
+	licensesCmd := &cobra.Command{
+		Use:     "licenses [target-name]",
+		Short:   "Report package licenses and check them against a policy",
+		Long:    licensesHelpText,
+		Example: licensesHelpEx,
+		Run:     auditLicensesRunCmd,
+	}
+	licensesCmd.Flags().StringVar(&auditLicenseFormat, "format", "text",
+		"Report format (text, json, or csv)")
+	licensesCmd.Flags().StringVar(&auditLicensePolicy, "policy", "",
+		"License policy file (default: audit.license_policy in project.yml)")
+
+	auditCmd.AddCommand(licensesCmd)
+	AddTabCompleteFn(licensesCmd, targetList)
+
+	cmd.AddCommand(auditCmd)
+}
@@ -0,0 +1,133 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/util"
+)
+
+// Where a new BSP is created if its name doesn't include a directory.
+const BSP_DFLT_DIR = "hw/bsp"
+
+func bspCopyRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		NewtUsage(cmd, util.NewNewtError("Exactly two arguments required"))
+	}
+
+	proj := TryGetProject()
+	interfaces.SetProject(proj)
+
+	srcPkg, err := proj.ResolvePackage(proj.LocalRepo(), args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	repoName, dstName, err := newtutil.ParsePackageString(args[1])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+	if !strings.Contains(dstName, "/") {
+		dstName = BSP_DFLT_DIR + "/" + dstName
+	}
+
+	// The copy must stay inside the destination repo.
+	dstName, err = newtutil.CleanRelPath(dstName)
+	if err != nil {
+		NewtUsage(cmd, util.FmtNewtError(
+			"Invalid package name \"%s\"; the package must be within "+
+				"its repo", args[1]))
+	}
+
+	dstRepo := proj.LocalRepo()
+	if repoName != "" {
+		dstRepo = proj.FindRepo(repoName)
+		if dstRepo == nil {
+			NewtUsage(cmd, util.FmtNewtError(
+				"Destination repo %s does not exist", repoName))
+		}
+	}
+
+	dstPath := dstRepo.Path() + "/" + dstName
+	if util.NodeExist(dstPath) {
+		NewtUsage(cmd, util.FmtNewtError(
+			"Cannot overwrite existing package %s", dstName))
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Copying BSP %s to %s\n",
+		srcPkg.FullName(), dstName)
+
+	hints, err := pkg.CopyBsp(srcPkg, dstRepo, dstName, dstPath)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if len(hints) > 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Files likely needing changes for the new board:\n")
+		for _, h := range hints {
+			util.StatusMessage(util.VERBOSITY_DEFAULT, "    %s/%s: %s\n",
+				dstName, h.Path, strings.Join(h.Reasons, ", "))
+		}
+	}
+}
+
+func AddBspCommands(cmd *cobra.Command) {
+	bspHelpText := "Commands for creating board support packages."
+	bspCmd := &cobra.Command{
+		Use:   "bsp",
+		Short: "Create board support packages",
+		Long:  bspHelpText,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+
+	cmd.AddCommand(bspCmd)
+
+	copyHelpText := "Create a BSP for a new board by copying the BSP of a " +
+		"similar reference board.  The copy's package name, file names, " +
+		"and references to the original BSP are rewritten.  If the " +
+		"original BSP is in a different repo, its references to packages " +
+		"in that repo are qualified with the repo name.  The files that " +
+		"typically need editing for the new board (pin assignments, " +
+		"clocks, the flash map, memory regions, and debugger scripts) are " +
+		"listed when the copy is complete.\n\n" +
+		"If <new-name> doesn't contain a directory, the BSP is created in " +
+		BSP_DFLT_DIR + "."
+	copyHelpEx := "  newt bsp copy @apache-mynewt-core/hw/bsp/nordic_pca10040 " +
+		"myboard"
+
+	copyCmd := &cobra.Command{
+		Use:     "copy <src-bsp> <new-name>",
+		Short:   "Create a BSP by copying an existing one",
+		Long:    copyHelpText,
+		Example: copyHelpEx,
+		Run:     bspCopyRunCmd,
+	}
+
+	bspCmd.AddCommand(copyCmd)
+}
@@ -21,15 +21,19 @@ package cli
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/spf13/cobra"
 	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/newt/repo"
 	"mynewt.apache.org/newt/newt/target"
+	"mynewt.apache.org/newt/newt/toolchain"
 	"mynewt.apache.org/newt/util"
 )
 
@@ -102,6 +106,31 @@ func pkgToUnitTests(pack *pkg.LocalPackage) []*pkg.LocalPackage {
 var extraJtagCmd string
 var noGDB_flag bool
 
+// Re-run unit tests even if they passed previously with identical inputs.
+var testNoCache bool
+
+// The number of slowest build steps to report at the end of a build.
+var showSlowest int
+
+// Options for "newt clean --unused".
+var cleanUnusedFlag bool
+var cleanDryRun bool
+var cleanYes bool
+var cleanForce bool
+
+func printSlowestSteps(n int) {
+	steps := toolchain.SlowestSteps(n)
+	if len(steps) == 0 {
+		return
+	}
+
+	util.StatusMessage(util.VERBOSITY_QUIET, "Slowest build steps:\n")
+	for _, s := range steps {
+		util.StatusMessage(util.VERBOSITY_QUIET, "    %8.2fs  %s\n",
+			s.Duration.Seconds(), s.Desc)
+	}
+}
+
 func buildRunCmd(cmd *cobra.Command, args []string, printShellCmds bool, executeShell bool) {
 	if len(args) < 1 {
 		NewtUsage(cmd, nil)
@@ -161,7 +190,21 @@ func buildRunCmd(cmd *cobra.Command, args []string, printShellCmds bool, execute
 
 		util.StatusMessage(util.VERBOSITY_DEFAULT,
 			"Target successfully built: %s\n", t.Name())
+
+		newtutil.SummaryAdd("Targets built", "%s", t.Name())
+		newtutil.SummaryAdd("Artifacts", "%s",
+			relativeToProject(b.AppBuilder.AppElfPath()))
+		if b.LoaderBuilder != nil {
+			newtutil.SummaryAdd("Artifacts", "%s",
+				relativeToProject(b.LoaderBuilder.AppElfPath()))
+		}
+	}
+
+	if showSlowest > 0 {
+		printSlowestSteps(showSlowest)
 	}
+
+	newtutil.PrintSummary()
 }
 
 func cleanDir(path string) {
@@ -174,7 +217,256 @@ func cleanDir(path string) {
 	}
 }
 
+// Lists the bin directory names that can be produced by the project's current
+// targets, unit test packages, and manufacturing images.
+func binDirNames(proj *project.Project) map[string]bool {
+	names := map[string]bool{}
+
+	for _, pack := range proj.PackagesOfType(-1) {
+		switch pack.Type() {
+		case pkg.PACKAGE_TYPE_TARGET, pkg.PACKAGE_TYPE_MFG:
+			names[pack.Name()] = true
+
+		case pkg.PACKAGE_TYPE_UNITTEST:
+			names[fmt.Sprintf("%s/%s/%s",
+				TARGET_DEFAULT_DIR, TARGET_TEST_NAME,
+				builder.TestTargetName(pack.Name()))] = true
+		}
+	}
+
+	// The object cache is shared by all targets.
+	names[builder.OBJ_CACHE_DIRNAME] = true
+
+	return names
+}
+
+// Lists the directories under the bin root that don't belong to any target,
+// unit test, or manufacturing image in the project.
+func orphanedBinDirs(proj *project.Project) ([]string, error) {
+	known := binDirNames(proj)
+
+	// Indicates whether the specified bin-relative path is a parent of a
+	// known bin directory (e.g., "targets").
+	isParent := func(rel string) bool {
+		for name, _ := range known {
+			if strings.HasPrefix(name, rel+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	orphans := []string{}
+
+	var walk func(rel string) error
+	walk = func(rel string) error {
+		infos, err := ioutil.ReadDir(builder.BinRoot() + "/" + rel)
+		if err != nil {
+			return util.ChildNewtError(err)
+		}
+
+		for _, fi := range infos {
+			if !fi.IsDir() {
+				continue
+			}
+
+			child := fi.Name()
+			if rel != "" {
+				child = rel + "/" + child
+			}
+
+			if known[child] {
+				continue
+			}
+
+			if isParent(child) {
+				if err := walk(child); err != nil {
+					return err
+				}
+			} else {
+				orphans = append(orphans, builder.BinRoot()+"/"+child)
+			}
+		}
+
+		return nil
+	}
+
+	if util.NodeNotExist(builder.BinRoot()) {
+		return nil, nil
+	}
+	if err := walk(""); err != nil {
+		return nil, err
+	}
+
+	return orphans, nil
+}
+
+// Calculates the total size, in bytes, of the files under the specified path.
+func diskUsage(path string) int64 {
+	var size int64
+
+	filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+
+	return size
+}
+
+func formatDiskUsage(size int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB"}
+
+	f := float64(size)
+	i := 0
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+
+	if i == 0 {
+		return fmt.Sprintf("%d %s", size, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", f, units[i])
+}
+
+// Removes repos that are no longer referenced by project.yml (under any
+// profile) or project.local.yml, along with bin directories of targets that no
+// longer exist.
+func cleanUnused() {
+	proj := TryGetProject()
+
+	type gcItem struct {
+		path string
+		desc string
+		size int64
+	}
+
+	items := []gcItem{}
+	skipped := []string{}
+
+	if proj.Workspace() != nil {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Project is part of a workspace; not cleaning the shared "+
+				"repo store\n")
+	} else {
+		repos := []*repo.Repo{}
+		for _, r := range proj.Repos() {
+			if !r.IsLocal() {
+				repos = append(repos, r)
+			}
+		}
+
+		// Checkouts of repo versions pinned by targets are in use.
+		pinned := []string{}
+		for _, t := range target.GetTargets() {
+			for repoName, vers := range t.RepoVersions {
+				if r := proj.FindRepo(repoName); r != nil {
+					pinned = append(pinned, r.VersionCheckoutPath(vers))
+				}
+			}
+		}
+
+		// Keep the repos of other profiles and of project.local.yml, even if
+		// the current configuration doesn't use them.
+		allNames, err := project.AllRepoNames(proj.BasePath)
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+
+		storeItems, err := repo.UnusedStoreItems(repos, allNames, pinned)
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+
+		// Keep modified checkouts, along with everything else belonging to
+		// the same repo.
+		keep := map[string]bool{}
+		for _, si := range storeItems {
+			if si.Modified && !cleanForce {
+				skipped = append(skipped, si.Path)
+				keep[si.RepoName] = true
+			}
+		}
+
+		for _, si := range storeItems {
+			if si.Modified && !cleanForce {
+				continue
+			}
+			if si.RepoName != "" && keep[si.RepoName] {
+				continue
+			}
+			items = append(items, gcItem{
+				path: si.Path,
+				desc: si.Desc,
+				size: diskUsage(si.Path),
+			})
+		}
+	}
+
+	binDirs, err := orphanedBinDirs(proj)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+	for _, dir := range binDirs {
+		items = append(items, gcItem{
+			path: dir,
+			desc: "orphaned target bin directory",
+			size: diskUsage(dir),
+		})
+	}
+
+	for _, path := range skipped {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"* Warning: %s contains local modifications; skipping "+
+				"(use --force to remove it anyway)\n", path)
+	}
+
+	if len(items) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "Nothing to clean\n")
+		return
+	}
+
+	var total int64
+	for _, item := range items {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    %s (%s, %s)\n",
+			item.path, item.desc, formatDiskUsage(item.size))
+		total += item.size
+	}
+
+	if cleanDryRun {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Would remove %d items (%s)\n",
+			len(items), formatDiskUsage(total))
+		return
+	}
+
+	if !cleanYes {
+		fmt.Printf("Remove %d items (%s)? (y/N): ",
+			len(items), formatDiskUsage(total))
+		if !PromptYesNo(false) {
+			return
+		}
+	}
+
+	for _, item := range items {
+		util.StatusMessage(util.VERBOSITY_VERBOSE, "Removing %s\n", item.path)
+		if err := os.RemoveAll(item.path); err != nil {
+			NewtUsage(nil, util.ChildNewtError(err))
+		}
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Removed %d items (%s)\n",
+		len(items), formatDiskUsage(total))
+}
+
 func cleanRunCmd(cmd *cobra.Command, args []string) {
+	if cleanUnusedFlag && len(args) == 0 {
+		cleanUnused()
+		return
+	}
+
 	if len(args) < 1 {
 		NewtUsage(cmd, util.NewNewtError("Must specify target"))
 	}
@@ -202,6 +494,10 @@ func cleanRunCmd(cmd *cobra.Command, args []string) {
 			cleanDir(builder.TargetBinDir(t.Name()))
 		}
 	}
+
+	if cleanUnusedFlag {
+		cleanUnused()
+	}
 }
 
 func pkgnames(pkgs []*pkg.LocalPackage) string {
@@ -277,6 +573,9 @@ func testRunCmd(cmd *cobra.Command, args []string, exclude string, executeShell
 
 	passedPkgs := []*pkg.LocalPackage{}
 	failedPkgs := []*pkg.LocalPackage{}
+	numCached := 0
+	numCases := 0
+	numCaseFailures := 0
 	for _, pack := range packs {
 		// Reset the global state for the next test.
 		if err := ResetGlobalState(); err != nil {
@@ -296,12 +595,23 @@ func testRunCmd(cmd *cobra.Command, args []string, exclude string, executeShell
 		util.StatusMessage(util.VERBOSITY_DEFAULT, "Testing package %s\n",
 			pack.FullName())
 
-		err = b.SelfTestExecute()
+		cached, err := b.SelfTestExecuteCached(!testNoCache)
+		if cached {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"Skipping test: unchanged since last passing run\n")
+			numCached++
+		}
+		if res := b.TestResult(); res != nil {
+			numCases += res.Tests
+			numCaseFailures += res.Failures
+		}
 		if err == nil {
+			newtutil.SummaryAdd("Tests passed", "%s", pack.FullName())
 			passedPkgs = append(passedPkgs, pack)
 		} else {
 			newtError := err.(*util.NewtError)
 			util.StatusMessage(util.VERBOSITY_QUIET, newtError.Text)
+			newtutil.SummaryAdd("Tests failed", "%s", pack.FullName())
 			failedPkgs = append(failedPkgs, pack)
 		}
 	}
@@ -309,13 +619,28 @@ func testRunCmd(cmd *cobra.Command, args []string, exclude string, executeShell
 	passStr := fmt.Sprintf("Passed tests: [%s]", PackageNameList(passedPkgs))
 	failStr := fmt.Sprintf("Failed tests: [%s]", PackageNameList(failedPkgs))
 
+	// Packages that use an alternative test framework report individual
+	// test cases; aggregate them across all packages.
+	if numCases > 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Test cases: %d run, %d failed\n", numCases, numCaseFailures)
+	}
+
 	if len(failedPkgs) > 0 {
 		NewtUsage(nil, util.FmtNewtError("Test failure(s):\n%s\n%s", passStr,
 			failStr))
 	} else {
 		util.StatusMessage(util.VERBOSITY_DEFAULT, "%s\n", passStr)
+		if numCached > 0 {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"%d of %d tests unchanged since their last passing run; "+
+					"use --no-cache to re-run them\n",
+				numCached, len(passedPkgs))
+		}
 		util.StatusMessage(util.VERBOSITY_DEFAULT, "All tests passed\n")
 	}
+
+	newtutil.PrintSummary()
 }
 
 func loadRunCmd(cmd *cobra.Command, args []string) {
@@ -426,16 +751,45 @@ func AddBuildCommands(cmd *cobra.Command) {
 	buildCmd.Flags().BoolVar(&executeShell, "executeShell", false,
 		"Execute build command using /bin/sh (Linux and MacOS only)")
 
+	buildCmd.Flags().IntVar(&showSlowest, "show-slowest", 0,
+		"Report the N slowest compile, archive, and link steps")
+
+	buildCmd.Flags().StringVar(&builder.BuildBackend, "backend", "",
+		"Compile with the specified backend (newt or ninja); overrides "+
+			"the build.backend setting")
+
 	cmd.AddCommand(buildCmd)
 	AddTabCompleteFn(buildCmd, func() []string {
 		return append(targetList(), "all")
 	})
 
+	cleanHelpText := "Delete build artifacts for one or more targets.\n\n" +
+		"With --unused, also delete repos that are no longer referenced " +
+		"by project.yml (under any profile) or project.local.yml, the " +
+		"remains of interrupted downloads, and bin " +
+		"directories of targets that no longer exist.  Repos containing " +
+		"local modifications are kept unless --force is specified."
+
+	cleanHelpEx := "  newt clean my_target\n"
+	cleanHelpEx += "  newt clean --unused --dry-run\n"
+	cleanHelpEx += "  newt clean --unused --yes\n"
+
 	cleanCmd := &cobra.Command{
-		Use:   "clean <target-name> [target-names...] | all",
-		Short: "Delete build artifacts for one or more targets",
-		Run:   cleanRunCmd,
-	}
+		Use:     "clean <target-name> [target-names...] | all",
+		Short:   "Delete build artifacts for one or more targets",
+		Long:    cleanHelpText,
+		Example: cleanHelpEx,
+		Run:     cleanRunCmd,
+	}
+
+	cleanCmd.Flags().BoolVar(&cleanUnusedFlag, "unused", false,
+		"Delete unreferenced repos and orphaned target bin directories")
+	cleanCmd.Flags().BoolVar(&cleanDryRun, "dry-run", false,
+		"List what --unused would delete without deleting anything")
+	cleanCmd.Flags().BoolVar(&cleanYes, "yes", false,
+		"Don't ask for confirmation before deleting")
+	cleanCmd.Flags().BoolVar(&cleanForce, "force", false,
+		"Delete unreferenced repos even if they contain local modifications")
 
 	cmd.AddCommand(cleanCmd)
 	AddTabCompleteFn(cleanCmd, func() []string {
@@ -453,6 +807,11 @@ func AddBuildCommands(cmd *cobra.Command) {
 	testCmd.Flags().StringVarP(&exclude, "exclude", "e", "", "Comma separated list of packages to exclude")
 	testCmd.Flags().BoolVar(&executeShell, "executeShell", false,
 		"Execute build command using /bin/sh (Linux and MacOS only)")
+	testCmd.Flags().StringVar(&builder.BuildBackend, "backend", "",
+		"Compile with the specified backend (newt or ninja); overrides "+
+			"the build.backend setting")
+	testCmd.Flags().BoolVar(&testNoCache, "no-cache", false,
+		"Run every test, even those unchanged since their last passing run")
 	cmd.AddCommand(testCmd)
 	AddTabCompleteFn(testCmd, func() []string {
 		return append(testablePkgList(), "all", "allexcept")
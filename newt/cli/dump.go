@@ -0,0 +1,227 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// The machine-readable project description emitted by `newt project dump
+// --json`.  External tools (IDE plugins, release scripts) parse this output,
+// so fields are only ever added.  Any incompatible change must increment
+// PROJECT_DUMP_SCHEMA_VERSION.
+
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/newt/target"
+)
+
+const PROJECT_DUMP_SCHEMA_VERSION = 1
+
+type dumpProject struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+type dumpRepo struct {
+	Name       string   `json:"name"`
+	Path       string   `json:"path"`
+	Url        string   `json:"url"`
+	Installed  bool     `json:"installed"`
+	Version    string   `json:"version"`
+	Commit     string   `json:"commit"`
+	Modified   bool     `json:"modified"`
+	Local      bool     `json:"local"`
+	Vendored   bool     `json:"vendored"`
+	Dependents []string `json:"dependents"`
+}
+
+type dumpPackage struct {
+	Name string `json:"name"`
+	Repo string `json:"repo"`
+	Type string `json:"type"`
+	Path string `json:"path"`
+}
+
+type dumpTarget struct {
+	Name         string            `json:"name"`
+	Path         string            `json:"path"`
+	App          string            `json:"app"`
+	Bsp          string            `json:"bsp"`
+	Loader       string            `json:"loader"`
+	BuildProfile string            `json:"build_profile"`
+	Vars         map[string]string `json:"vars"`
+}
+
+type projectDump struct {
+	SchemaVersion int                    `json:"schema_version"`
+	NewtVersion   string                 `json:"newt_version"`
+	Project       dumpProject            `json:"project"`
+	Repos         []dumpRepo             `json:"repos"`
+	Packages      []dumpPackage          `json:"packages"`
+	Targets       []dumpTarget           `json:"targets"`
+	Settings      map[string]interface{} `json:"settings"`
+}
+
+// Converts a value parsed from YAML into one that can be encoded as JSON
+// (i.e., with string map keys).
+func jsonValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, sub := range t {
+			m[fmt.Sprintf("%v", k)] = jsonValue(sub)
+		}
+		return m
+
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, sub := range t {
+			s[i] = jsonValue(sub)
+		}
+		return s
+
+	default:
+		return v
+	}
+}
+
+func dumpRepos(proj *project.Project) []dumpRepo {
+	names := []string{}
+	for name, _ := range proj.Repos() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	repos := []dumpRepo{}
+	for _, name := range names {
+		r := proj.Repos()[name]
+
+		dr := dumpRepo{
+			Name:       name,
+			Path:       r.Path(),
+			Url:        r.Url(),
+			Installed:  r.IsLocal(),
+			Local:      r.IsLocal(),
+			Vendored:   r.IsVendored(),
+			Dependents: proj.RepoDependents(name),
+		}
+		if dr.Dependents == nil {
+			dr.Dependents = []string{}
+		}
+
+		if !r.IsLocal() && proj.RepoIsInstalled(name) {
+			dr.Installed = true
+			if ver, err := r.InstalledVersion(); err == nil && ver != nil {
+				dr.Version = ver.String()
+			}
+			dr.Commit, _ = r.CurrentHash()
+			dr.Modified, _ = r.HasChanges()
+		}
+
+		repos = append(repos, dr)
+	}
+
+	return repos
+}
+
+func dumpPackages(proj *project.Project) []dumpPackage {
+	pkgMap := map[string]dumpPackage{}
+	for repoName, pkgList := range proj.PackageList() {
+		for _, p := range *pkgList {
+			pkgMap[p.FullName()] = dumpPackage{
+				Name: p.FullName(),
+				Repo: repoName,
+				Type: pkg.PackageTypeNames[p.Type()],
+				Path: p.BasePath(),
+			}
+		}
+	}
+
+	names := []string{}
+	for name, _ := range pkgMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pkgs := make([]dumpPackage, len(names))
+	for i, name := range names {
+		pkgs[i] = pkgMap[name]
+	}
+
+	return pkgs
+}
+
+func dumpTargets() []dumpTarget {
+	targetMap := target.GetTargets()
+
+	names := []string{}
+	for name, _ := range targetMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	targets := make([]dumpTarget, len(names))
+	for i, name := range names {
+		t := targetMap[name]
+		targets[i] = dumpTarget{
+			Name:         t.FullName(),
+			Path:         t.Package().BasePath(),
+			App:          t.AppName,
+			Bsp:          t.BspName,
+			Loader:       t.LoaderName,
+			BuildProfile: t.BuildProfile,
+			Vars:         t.Vars,
+		}
+	}
+
+	return targets
+}
+
+// Collects the project's settings: the contents of `project.yml` (with any
+// `project.local.yml` overrides applied), excluding repo descriptors.
+func dumpSettings(proj *project.Project) map[string]interface{} {
+	settings := map[string]interface{}{}
+	for k, v := range proj.Config().AllSettings() {
+		if !strings.HasPrefix(k, "repository.") {
+			settings[k] = jsonValue(v)
+		}
+	}
+
+	return settings
+}
+
+// Describes the fully resolved state of the specified project.
+func buildProjectDump(proj *project.Project) projectDump {
+	return projectDump{
+		SchemaVersion: PROJECT_DUMP_SCHEMA_VERSION,
+		NewtVersion:   newtutil.NewtVersion.String(),
+		Project: dumpProject{
+			Name: proj.Name(),
+			Path: proj.Path(),
+		},
+		Repos:    dumpRepos(proj),
+		Packages: dumpPackages(proj),
+		Targets:  dumpTargets(),
+		Settings: dumpSettings(proj),
+	}
+}
@@ -0,0 +1,105 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+)
+
+func TestProjectDumpJSONShape(t *testing.T) {
+	dump := projectDump{
+		SchemaVersion: PROJECT_DUMP_SCHEMA_VERSION,
+		Project:       dumpProject{Name: "proj", Path: "/proj"},
+		Repos: []dumpRepo{{
+			Name:       "apache-mynewt-core",
+			Dependents: []string{},
+		}},
+		Packages: []dumpPackage{{Name: "@apache-mynewt-core/kernel/os"}},
+		Targets:  []dumpTarget{{Name: "targets/blinky"}},
+		Settings: map[string]interface{}{},
+	}
+
+	b, err := json.Marshal(dump)
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err.Error())
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatalf("unmarshal failed: %s", err.Error())
+	}
+
+	keys := func(m map[string]interface{}) []string {
+		ks := []string{}
+		for k, _ := range m {
+			ks = append(ks, k)
+		}
+		sort.Strings(ks)
+		return ks
+	}
+
+	tests := []struct {
+		name string
+		obj  interface{}
+		keys []string
+	}{
+		{"top", m, []string{
+			"newt_version", "packages", "project", "repos",
+			"schema_version", "settings", "targets",
+		}},
+		{"project", m["project"], []string{"name", "path"}},
+		{"repo", m["repos"].([]interface{})[0], []string{
+			"commit", "dependents", "installed", "local", "modified",
+			"name", "path", "url", "vendored", "version",
+		}},
+		{"package", m["packages"].([]interface{})[0], []string{
+			"name", "path", "repo", "type",
+		}},
+		{"target", m["targets"].([]interface{})[0], []string{
+			"app", "bsp", "build_profile", "loader", "name", "path", "vars",
+		}},
+	}
+
+	for _, tc := range tests {
+		obj, ok := tc.obj.(map[string]interface{})
+		if !ok {
+			t.Errorf("%s: not a JSON object", tc.name)
+			continue
+		}
+		got := keys(obj)
+		if len(got) != len(tc.keys) {
+			t.Errorf("%s: keys=%v, want %v", tc.name, got, tc.keys)
+			continue
+		}
+		for i, k := range tc.keys {
+			if got[i] != k {
+				t.Errorf("%s: keys=%v, want %v", tc.name, got, tc.keys)
+				break
+			}
+		}
+	}
+
+	v := m["schema_version"].(float64)
+	if int(v) != PROJECT_DUMP_SCHEMA_VERSION {
+		t.Errorf("schema_version=%v, want %d", v, PROJECT_DUMP_SCHEMA_VERSION)
+	}
+}
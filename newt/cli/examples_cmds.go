@@ -0,0 +1,281 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/target"
+	"mynewt.apache.org/newt/util"
+)
+
+// Where an instantiated example is created if its name doesn't include a
+// directory.
+const EXAMPLE_DFLT_DIR = "apps"
+
+var exampleBsp string
+var exampleTarget string
+
+func findExamples() []*pkg.Example {
+	proj := TryGetProject()
+	return pkg.FindExamples(proj.PackagesOfType(-1))
+}
+
+// Resolves a BSP name.  Besides a package name, the BSP's base name (e.g.,
+// "nordic_pca10056") is accepted if it is unique.
+func resolveBspName(name string) (*pkg.LocalPackage, error) {
+	proj := TryGetProject()
+
+	if lpkg, err := proj.ResolvePackage(proj.LocalRepo(), name); err == nil {
+		if lpkg.Type() != pkg.PACKAGE_TYPE_BSP {
+			return nil, util.FmtNewtError("package \"%s\" is not a BSP",
+				lpkg.FullName())
+		}
+		return lpkg, nil
+	}
+
+	matches := []string{}
+	var match *pkg.LocalPackage
+	for _, p := range proj.PackagesOfType(pkg.PACKAGE_TYPE_BSP) {
+		lpkg := p.(*pkg.LocalPackage)
+		if path.Base(lpkg.Name()) == name {
+			match = lpkg
+			matches = append(matches, lpkg.FullName())
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, util.FmtNewtError("unknown BSP \"%s\"", name)
+	case 1:
+		return match, nil
+	default:
+		return nil, util.FmtNewtError(
+			"BSP name \"%s\" is ambiguous; specify one of: %s",
+			name, strings.Join(util.SortFields(matches...), " "))
+	}
+}
+
+func examplesListCmd(cmd *cobra.Command, args []string) {
+	found := false
+	for _, ex := range findExamples() {
+		if !ex.Matches(args) {
+			continue
+		}
+		found = true
+
+		util.StatusMessage(util.VERBOSITY_QUIET, "%s", ex.Lpkg.FullName())
+		desc := ex.Lpkg.Desc()
+		summary := desc.Summary
+		if summary == "" {
+			summary = strings.TrimSpace(desc.Description)
+		}
+		if summary != "" {
+			util.StatusMessage(util.VERBOSITY_DEFAULT, " - %s",
+				strings.Split(summary, "\n")[0])
+		}
+		util.StatusMessage(util.VERBOSITY_QUIET, "\n")
+
+		if len(ex.Demonstrates) > 0 {
+			util.StatusMessage(util.VERBOSITY_VERBOSE,
+				"    demonstrates: %s\n", strings.Join(ex.Demonstrates, " "))
+		}
+	}
+
+	if !found {
+		if len(args) > 0 {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"No example apps match \"%s\"\n", strings.Join(args, " "))
+		} else {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"No example apps in the installed repos\n")
+		}
+	}
+}
+
+func examplesInstantiateCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify an example app"))
+	}
+	if len(args) > 2 {
+		NewtUsage(cmd, util.NewNewtError("Too many arguments"))
+	}
+
+	proj := TryGetProject()
+	interfaces.SetProject(proj)
+
+	src, err := proj.ResolvePackage(proj.LocalRepo(), args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+	if src.Type() != pkg.PACKAGE_TYPE_APP {
+		NewtUsage(cmd, util.FmtNewtError("package \"%s\" is not an app",
+			src.FullName()))
+	}
+
+	dstName := path.Base(src.Name())
+	if len(args) >= 2 {
+		dstName = args[1]
+	}
+	if strings.HasPrefix(dstName, "@") {
+		NewtUsage(cmd, util.NewNewtError(
+			"An example can only be instantiated in the local project"))
+	}
+	if !strings.Contains(dstName, "/") {
+		dstName = EXAMPLE_DFLT_DIR + "/" + dstName
+	}
+
+	// The copy must stay inside the project.
+	dstName, err = newtutil.CleanRelPath(dstName)
+	if err != nil {
+		NewtUsage(cmd, util.FmtNewtError(
+			"Invalid package name \"%s\"; the package must be within "+
+				"the project", args[len(args)-1]))
+	}
+
+	dstPath := proj.LocalRepo().Path() + "/" + dstName
+	if util.NodeExist(dstPath) {
+		NewtUsage(cmd, util.FmtNewtError(
+			"Cannot overwrite existing package %s", dstName))
+	}
+
+	// Validate the target before anything gets written.
+	var bsp *pkg.LocalPackage
+	var targetName string
+	if exampleBsp != "" {
+		bsp, err = resolveBspName(exampleBsp)
+		if err != nil {
+			NewtUsage(cmd, err)
+		}
+
+		targetName = exampleTarget
+		if targetName == "" {
+			targetName = path.Base(dstName) + "_" + path.Base(bsp.Name())
+		}
+		targetName, err = ResolveNewTargetName(targetName)
+		if err != nil {
+			NewtUsage(cmd, err)
+		}
+	} else if exampleTarget != "" {
+		NewtUsage(cmd, util.NewNewtError("--target requires --bsp"))
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Copying example %s to %s\n",
+		src.FullName(), dstName)
+
+	if err := pkg.CopyApp(src, dstName, dstPath); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if bsp == nil {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"To build it, create a target for your board:\n"+
+				"    newt target create <target>\n"+
+				"    newt target set <target> app=%s bsp=<bsp>\n", dstName)
+		return
+	}
+
+	repo := proj.LocalRepo()
+	tpkg := pkg.NewLocalPackage(repo, repo.Path()+"/"+targetName)
+	tpkg.SetName(targetName)
+	tpkg.SetType(pkg.PACKAGE_TYPE_TARGET)
+
+	t := target.NewTarget(tpkg)
+	t.Vars = map[string]string{
+		"target.app":           dstName,
+		"target.bsp":           bsp.FullName(),
+		"target.build_profile": "debug",
+	}
+	if err := t.Save(); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Target %s created; build it with:\n    newt build %s\n",
+		targetName, path.Base(targetName))
+}
+
+func AddExamplesCommands(cmd *cobra.Command) {
+	examplesHelpText := "Discover the example apps in the installed repos " +
+		"and copy them into the project."
+	examplesHelpEx := "  newt examples list\n"
+	examplesHelpEx += "  newt examples instantiate @apache-mynewt-core/apps/blinky --bsp nordic_pca10056"
+
+	examplesCmd := &cobra.Command{
+		Use:     "examples",
+		Short:   "Discover and instantiate example apps",
+		Long:    examplesHelpText,
+		Example: examplesHelpEx,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Usage()
+		},
+	}
+
+	cmd.AddCommand(examplesCmd)
+
+	listHelpText := "List the example apps in the installed repos: every " +
+		"app package outside the local project.  If search terms are " +
+		"specified, only examples matching all of them (by name, " +
+		"description, keywords, or the packages that list the app in " +
+		"pkg.examples) are shown."
+	listHelpEx := "  newt examples list\n"
+	listHelpEx += "  newt examples list ble"
+
+	listCmd := &cobra.Command{
+		Use:     "list [term...]",
+		Short:   "List example apps",
+		Long:    listHelpText,
+		Example: listHelpEx,
+		Run:     examplesListCmd,
+	}
+
+	examplesCmd.AddCommand(listCmd)
+
+	instHelpText := "Copy an example app into the project as a new app " +
+		"package (apps/<name> by default; the example's name if no name " +
+		"is given).  References to packages in the example's repo are " +
+		"qualified with the repo name.  With --bsp, a target that builds " +
+		"the new app for that BSP is also created (<name>_<bsp> by " +
+		"default).  The BSP can be given by package name or by its unique " +
+		"base name."
+	instHelpEx := "  newt examples instantiate @apache-mynewt-core/apps/blinky\n"
+	instHelpEx += "  newt examples instantiate @apache-mynewt-core/apps/bleprph myprph --bsp nordic_pca10056\n"
+	instHelpEx += "  newt examples instantiate @apache-mynewt-core/apps/blinky --bsp nordic_pca10056 --target my_blinky"
+
+	instCmd := &cobra.Command{
+		Use:     "instantiate <example> [name]",
+		Short:   "Copy an example app into the project",
+		Long:    instHelpText,
+		Example: instHelpEx,
+		Run:     examplesInstantiateCmd,
+	}
+	instCmd.Flags().StringVar(&exampleBsp, "bsp", "",
+		"Also create a target for this BSP")
+	instCmd.Flags().StringVar(&exampleTarget, "target", "",
+		"Name of the target to create")
+
+	examplesCmd.AddCommand(instCmd)
+}
@@ -26,11 +26,85 @@ import (
 	"mynewt.apache.org/newt/newt/builder"
 	"mynewt.apache.org/newt/newt/image"
 	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/release"
+	"mynewt.apache.org/newt/newt/signing"
+	"mynewt.apache.org/newt/newt/target"
 	"mynewt.apache.org/newt/util"
 )
 
 var useV1 bool
 var useV2 bool
+var signingProfile string
+
+// Selects the key that signs a target's images.  A signing profile (from the
+// --profile option or the target's `target.signing_profile` setting) supplies
+// the key, after verifying that the profile may be used for the target and
+// that its key and release policy check out.  A profile and an explicitly
+// specified key are mutually exclusive.
+//
+// @return string               The signing key to use; "" for none.
+// @return uint8                The key ID.
+func applySigningProfile(t *target.Target, b *builder.TargetBuilder,
+	version string, keystr string, keyId uint8) (string, uint8, error) {
+
+	name := signingProfile
+	if name == "" {
+		name = signing.TargetProfileName(t)
+	}
+	if name == "" {
+		return keystr, keyId, nil
+	}
+
+	if keystr != "" {
+		if signingProfile != "" {
+			return "", 0, util.NewNewtError(
+				"A signing key cannot be specified together with --profile")
+		}
+		return "", 0, util.FmtNewtError(
+			"Target %s signs with profile \"%s\"; specify --profile "+
+				"instead of a signing key", t.FullName(), name)
+	}
+
+	prof, err := signing.GetProfile(name)
+	if err != nil {
+		return "", 0, err
+	}
+
+	hash, err := prof.Check(t)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if prof.Policy != "" {
+		pol, err := release.ReadPolicy(prof.Policy)
+		if err != nil {
+			return "", 0, err
+		}
+
+		results, err := release.Check(pol, release.Params{
+			Target:     t,
+			Builder:    b,
+			Version:    version,
+			SigningKey: prof.KeyFile,
+		})
+		if err != nil {
+			return "", 0, err
+		}
+
+		printReleaseChecklist(results)
+		if !release.AllPassed(results) {
+			return "", 0, util.FmtNewtError(
+				"Target %s does not meet the policy of signing profile "+
+					"\"%s\"", t.FullName(), name)
+		}
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Signing with profile \"%s\" (%s)\n", name, prof.KeyFile)
+	b.SetSigningProfile(name, hash)
+
+	return prof.KeyFile, prof.KeyId, nil
+}
 
 func createImageRunCmd(cmd *cobra.Command, args []string) {
 	var keyId uint8
@@ -76,6 +150,11 @@ func createImageRunCmd(cmd *cobra.Command, args []string) {
 		NewtUsage(nil, err)
 	}
 
+	keystr, keyId, err = applySigningProfile(t, b, version, keystr, keyId)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
 	if _, _, err := b.CreateImages(version, keystr, keyId); err != nil {
 		NewtUsage(nil, err)
 		return
@@ -143,12 +222,20 @@ func AddImageCommands(cmd *cobra.Command) {
 	createImageHelpText += "To sign version 2 of the image format give private " +
 		"key as <signing-key> (no key-id needed).\n\n"
 
-	createImageHelpText += "Default image format is version 1.\n"
+	createImageHelpText += "Default image format is version 1.\n\n"
+	createImageHelpText += "Instead of a signing key, a named signing profile " +
+		"(\"signing.profiles\" in project.yml or ~/.newt/repos.yml) can be " +
+		"selected with --profile or with the target's " +
+		"target.signing_profile setting.  The profile checks that the " +
+		"target may use it, that its key is the expected one, and that the " +
+		"target meets the profile's release policy.  The profile is " +
+		"recorded in the manifest.\n"
 
 	createImageHelpEx := "  newt create-image my_target1 1.3.0\n"
 	createImageHelpEx += "  newt create-image my_target1 1.3.0.3\n"
 	createImageHelpEx += "  newt create-image my_target1 1.3.0.3 private.pem\n"
 	createImageHelpEx += "  newt create-image my_target1 1.3.0.3 private.pem 5\n"
+	createImageHelpEx += "  newt create-image --profile prod my_target1 1.3.0\n"
 
 	createImageCmd := &cobra.Command{
 		Use:     "create-image <target-name> <version> [signing-key [key-id]]",
@@ -169,6 +256,8 @@ func AddImageCommands(cmd *cobra.Command) {
 		"1", "1", false, "Use old image header format")
 	createImageCmd.PersistentFlags().BoolVarP(&useV2,
 		"2", "2", false, "Use new image header format")
+	createImageCmd.PersistentFlags().StringVar(&signingProfile,
+		"profile", "", "Sign with the named signing profile")
 
 	cmd.AddCommand(createImageCmd)
 	AddTabCompleteFn(createImageCmd, targetList)
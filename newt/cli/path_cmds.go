@@ -0,0 +1,141 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/newt/target"
+	"mynewt.apache.org/newt/util"
+)
+
+// Calculates the path of a build artifact given the target's package name,
+// the build name, and the name of the app package.
+type artifactPathFn func(targetName string, buildName string,
+	appName string) string
+
+var artifactPathFns = map[string]artifactPathFn{
+	"elf":      builder.AppElfPath,
+	"bin":      builder.AppBinPath,
+	"img":      builder.AppImgPath,
+	"hex":      builder.AppHexPath,
+	"manifest": builder.ManifestPath,
+}
+
+const PATH_KIND_DIR = "dir"
+const PATH_LOADER_PREFIX = "loader-"
+
+func pathKinds() []string {
+	kinds := []string{PATH_KIND_DIR}
+	for kind, _ := range artifactPathFns {
+		kinds = append(kinds, kind, PATH_LOADER_PREFIX+kind)
+	}
+	sort.Strings(kinds)
+
+	return kinds
+}
+
+// Determines the location of the specified kind of artifact for a target.
+// The artifact does not need to exist.
+func artifactPath(kind string, t *target.Target) (string, error) {
+	if kind == PATH_KIND_DIR {
+		return builder.TargetBinDir(t.Name()), nil
+	}
+
+	buildName := builder.BUILD_NAME_APP
+	appPkg := t.App()
+
+	if strings.HasPrefix(kind, PATH_LOADER_PREFIX) {
+		kind = strings.TrimPrefix(kind, PATH_LOADER_PREFIX)
+		buildName = builder.BUILD_NAME_LOADER
+		appPkg = t.Loader()
+		if appPkg == nil {
+			return "", util.FmtNewtError(
+				"Target %s does not specify a loader", t.FullName())
+		}
+	}
+
+	fn := artifactPathFns[kind]
+	if fn == nil {
+		return "", util.FmtNewtError(
+			"Unknown artifact kind \"%s\"; must be one of: %s",
+			kind, strings.Join(pathKinds(), ", "))
+	}
+
+	if appPkg == nil {
+		return "", util.FmtNewtError(
+			"Target %s does not specify an app", t.FullName())
+	}
+
+	return fn(t.Name(), buildName, appPkg.Name()), nil
+}
+
+func pathRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Must specify an artifact kind and a target"))
+	}
+
+	TryGetProject()
+
+	t, err := resolveExistingTargetArg(args[1])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	path, err := artifactPath(args[0], t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	fmt.Printf("%s\n", path)
+}
+
+func AddPathCommands(cmd *cobra.Command) {
+	pathHelpText := "Print the location of a build artifact of " +
+		"<target-name>.  Scripts should use this command instead of " +
+		"constructing paths within the bin directory themselves; the " +
+		"directory layout may change between newt versions.  The artifact " +
+		"does not need to have been built.\n\n" +
+		"<kind> is one of: " + strings.Join(pathKinds(), ", ") + "."
+
+	pathHelpEx := "  newt path img my_blinky_sim\n"
+	pathHelpEx += "    Prints the location of the app image.\n\n"
+	pathHelpEx += "  newt path loader-elf my_split_target\n"
+	pathHelpEx += "    Prints the location of the loader's ELF file."
+
+	pathCmd := &cobra.Command{
+		Use:     "path <kind> <target-name>",
+		Short:   "Print the location of a build artifact",
+		Long:    pathHelpText,
+		Example: pathHelpEx,
+		Run:     pathRunCmd,
+	}
+
+	cmd.AddCommand(pathCmd)
+	AddTabCompleteFn(pathCmd, func() []string {
+		return append(pathKinds(), targetList()...)
+	})
+}
@@ -20,12 +20,15 @@
 package cli
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"regexp"
+	"sort"
 	"strings"
 
+	"github.com/spf13/cast"
 	"github.com/spf13/cobra"
 	"mynewt.apache.org/newt/newt/interfaces"
 	"mynewt.apache.org/newt/newt/newtutil"
@@ -211,6 +214,84 @@ func pkgRemoveCmd(cmd *cobra.Command, args []string) {
 	}
 }
 
+func pkgShowList(title string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "    %s:\n", title)
+	for _, item := range items {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "        %s\n", item)
+	}
+}
+
+func pkgShowField(name string, val string) {
+	if val != "" {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    %s: %s\n", name, val)
+	}
+}
+
+// Describes each syscfg setting that the package defines.
+func pkgSyscfgDefStrings(lpkg *pkg.LocalPackage) []string {
+	defs := lpkg.SyscfgY.GetValStringMap("syscfg.defs", nil)
+
+	names := make([]string, 0, len(defs))
+	for name, _ := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	strs := make([]string, len(names))
+	for i, name := range names {
+		fields := cast.ToStringMap(defs[name])
+		s := fmt.Sprintf("%s (default: %s)", name,
+			cast.ToString(fields["value"]))
+		if desc := strings.TrimSpace(
+			cast.ToString(fields["description"])); desc != "" {
+
+			s += ": " + desc
+		}
+		strs[i] = s
+	}
+
+	return strs
+}
+
+func pkgShowCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify a package name"))
+	}
+
+	lpkgs, err := ResolvePackages(args)
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	for _, lpkg := range lpkgs {
+		desc := lpkg.Desc()
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "%s\n", lpkg.FullName())
+		pkgShowField("type", pkg.PackageTypeNames[lpkg.Type()])
+		pkgShowField("path", lpkg.BasePath())
+		pkgShowField("summary", desc.Summary)
+		pkgShowField("description", strings.TrimSpace(desc.Description))
+		pkgShowField("homepage", desc.Homepage)
+		pkgShowField("author", desc.Author)
+		pkgShowField("license", desc.License)
+		pkgShowList("maintainers", desc.Maintainers)
+		if len(desc.Keywords) > 0 {
+			pkgShowField("keywords", strings.Join(desc.Keywords, ", "))
+		}
+		pkgShowList("examples", desc.Examples)
+		pkgShowList("apis", lpkg.PkgY.GetValStringSlice("pkg.apis", nil))
+		pkgShowList("required apis",
+			lpkg.PkgY.GetValStringSlice("pkg.req_apis", nil))
+		pkgShowList("dependencies",
+			lpkg.PkgY.GetValStringSlice("pkg.deps", nil))
+		pkgShowList("syscfg settings", pkgSyscfgDefStrings(lpkg))
+	}
+}
+
 func AddPackageCommands(cmd *cobra.Command) {
 	/* Add the base package command, on top of which other commands are
 	 * keyed
@@ -285,4 +366,20 @@ func AddPackageCommands(cmd *cobra.Command) {
 	}
 
 	pkgCmd.AddCommand(removeCmd)
+
+	showCmdHelpText := "Display a package's documentation (summary, " +
+		"homepage, maintainers, and examples, as specified in its " +
+		"pkg.yml file), the APIs it provides and requires, and the " +
+		"syscfg settings it defines."
+	showCmdHelpEx := "  newt pkg show @apache-mynewt-core/sys/log/full"
+
+	showCmd := &cobra.Command{
+		Use:     "show <package-name> [package-name...]",
+		Short:   "Display information about a package",
+		Long:    showCmdHelpText,
+		Example: showCmdHelpEx,
+		Run:     pkgShowCmd,
+	}
+
+	pkgCmd.AddCommand(showCmd)
 }
@@ -20,9 +20,12 @@
 package cli
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"mynewt.apache.org/newt/newt/downloader"
@@ -30,9 +33,19 @@ import (
 	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/project"
 	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/newt/settings"
+	"mynewt.apache.org/newt/newt/target"
+	"mynewt.apache.org/newt/newt/template"
 	"mynewt.apache.org/newt/util"
 )
 
+var newTemplate string
+var newBsp string
+var newApp string
+var newTemplateVars []string
+var installNoCache bool
+var projectDumpJson bool
+
 func newRunCmd(cmd *cobra.Command, args []string) {
 	if len(args) < 1 {
 		NewtUsage(cmd, util.NewNewtError("Must specify "+
@@ -46,31 +59,43 @@ func newRunCmd(cmd *cobra.Command, args []string) {
 			"directory already exists"))
 	}
 
-	util.StatusMessage(util.VERBOSITY_DEFAULT, "Downloading "+
-		"project skeleton from apache/mynewt-blinky...\n")
-	dl := downloader.NewGithubDownloader()
-	dl.User = "apache"
-	dl.Repo = "mynewt-blinky"
+	vars := map[string]string{}
+	for _, kv := range newTemplateVars {
+		k, v, err := util.ParseEqualsPair(kv)
+		if err != nil {
+			NewtUsage(cmd, err)
+		}
+		vars[k] = v
+	}
+	if newBsp != "" {
+		vars[template.VAR_BSP] = newBsp
+	}
+	if newApp != "" {
+		vars[template.VAR_APP_NAME] = newApp
+	}
 
-	tmpdir, err := newtutil.MakeTempRepoDir()
-	if err != nil {
-		NewtUsage(nil, err)
+	spec := newTemplate
+	if spec == "" {
+		spec = settings.NewTemplate()
 	}
-	defer os.RemoveAll(tmpdir)
+	if spec == "" {
+		spec = template.DEFAULT_TEMPLATE
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Downloading "+
+		"project skeleton from %s...\n", spec)
 
-	if err := dl.DownloadRepo(newtutil.NewtBlinkyTag, tmpdir); err != nil {
+	t, err := template.Download(spec)
+	if err != nil {
 		NewtUsage(nil, err)
 	}
+	defer os.RemoveAll(t.Path)
 
 	util.StatusMessage(util.VERBOSITY_DEFAULT, "Installing "+
 		"skeleton in %s...\n", newDir)
 
-	if err := util.CopyDir(tmpdir, newDir); err != nil {
-		NewtUsage(cmd, err)
-	}
-
-	if err := os.RemoveAll(newDir + "/" + "/.git/"); err != nil {
-		NewtUsage(cmd, err)
+	if err := t.Instantiate(newDir, vars); err != nil {
+		NewtUsage(nil, err)
 	}
 
 	util.StatusMessage(util.VERBOSITY_DEFAULT,
@@ -100,28 +125,195 @@ func makeRepoPredicate(repoNames []string) func(r *repo.Repo) bool {
 	}
 }
 
+// Creates or updates the checkouts of the repo versions that targets pin in
+// their target.yml files.
+func installPinnedVersions(proj *project.Project, pred func(*repo.Repo) bool) {
+	// Repo name => version => names of the targets that pin it.
+	pins := map[string]map[string][]string{}
+	for _, t := range target.GetTargets() {
+		if len(t.RepoVersions) > 0 {
+			if err := proj.CheckRepoVersions(t.RepoVersions); err != nil {
+				NewtUsage(nil, util.FmtNewtError(
+					"Target %s pins incompatible repo versions: %s",
+					t.Name(), err.Error()))
+			}
+		}
+
+		for repoName, vers := range t.RepoVersions {
+			if pins[repoName] == nil {
+				pins[repoName] = map[string][]string{}
+			}
+			pins[repoName][vers] = append(pins[repoName][vers], t.Name())
+		}
+	}
+
+	repoNames := []string{}
+	for repoName, _ := range pins {
+		repoNames = append(repoNames, repoName)
+	}
+	sort.Strings(repoNames)
+
+	for _, repoName := range repoNames {
+		r := proj.FindRepo(repoName)
+		if r == nil {
+			for _, targetNames := range pins[repoName] {
+				util.StatusMessage(util.VERBOSITY_DEFAULT,
+					"* Warning: target %s pins unknown repo \"%s\"\n",
+					strings.Join(targetNames, ", "), repoName)
+			}
+			continue
+		}
+		if !pred(r) {
+			continue
+		}
+
+		versions := []string{}
+		for vers, _ := range pins[repoName] {
+			versions = append(versions, vers)
+		}
+		sort.Strings(versions)
+
+		for _, vers := range versions {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"Checking out %s version %s for %s\n", repoName, vers,
+				strings.Join(pins[repoName][vers], ", "))
+
+			if err := r.InstallVersion(vers); err != nil {
+				NewtUsage(nil, err)
+			}
+		}
+	}
+}
+
 func installRunCmd(cmd *cobra.Command, args []string) {
 	proj := TryGetProject()
 	interfaces.SetProject(proj)
 
+	// An explicit "--frozen" flag overrides the newtrc setting.
+	frozen := newtutil.NewtFrozen
+	if !cmd.Flags().Changed("frozen") {
+		frozen = settings.InstallFrozen()
+	}
+
+	if installNoCache {
+		repo.DescCacheTTL = 0
+	}
+
 	pred := makeRepoPredicate(args)
+	if frozen {
+		if err := proj.InstallFrozen(pred); err != nil {
+			NewtUsage(nil, err)
+		}
+		return
+	}
+
 	if err := proj.InstallIf(
-		false, newtutil.NewtForce, newtutil.NewtAsk, pred); err != nil {
+		false, newtutil.NewtForce, newtutil.NewtAsk, false, false,
+		pred); err != nil {
 
 		NewtUsage(nil, err)
 	}
+	installPinnedVersions(proj, pred)
+
+	newtutil.PrintSummary()
 }
 
 func upgradeRunCmd(cmd *cobra.Command, args []string) {
 	proj := TryGetProject()
 	interfaces.SetProject(proj)
 
+	// An upgrade always considers the latest upstream versions.
+	repo.DescCacheTTL = 0
+
 	pred := makeRepoPredicate(args)
 	if err := proj.InstallIf(
-		true, newtutil.NewtForce, newtutil.NewtAsk, pred); err != nil {
+		true, newtutil.NewtForce, newtutil.NewtAsk, newtutil.NewtStash,
+		newtutil.NewtDryRun, pred); err != nil {
 
 		NewtUsage(nil, err)
 	}
+	if !newtutil.NewtDryRun {
+		installPinnedVersions(proj, pred)
+	}
+
+	newtutil.PrintSummary()
+}
+
+func fmtOpMetrics(om downloader.OpMetrics) string {
+	secs := func(d time.Duration) string {
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	}
+
+	s := fmt.Sprintf("%d", om.Count)
+	if om.Failures > 0 || om.Retries > 0 {
+		s += fmt.Sprintf(" (%d failed, %d retries)", om.Failures, om.Retries)
+	}
+	if om.Count > 0 {
+		s += fmt.Sprintf("; avg %s, last %s", secs(om.Average()),
+			secs(om.Last))
+	}
+
+	return s
+}
+
+// Displays the download metrics recorded for each of the project's repos.
+func printRepoMetrics(repoNames []string) {
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "\nDownload metrics:\n")
+
+	found := false
+	for _, repoName := range repoNames {
+		m, err := repo.ReadMetrics(repoName)
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+		if m.IsEmpty() {
+			continue
+		}
+		found = true
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    * @%s\n", repoName)
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"        downloads: %s\n", fmtOpMetrics(m.Download))
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"        fetches: %s\n", fmtOpMetrics(m.Fetch))
+		if !m.LastFailureTime.IsZero() {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"        last failure: %s (%s): %s\n",
+				m.LastFailureClass,
+				m.LastFailureTime.Local().Format("2006-01-02 15:04:05"),
+				m.LastFailure)
+		}
+	}
+
+	if !found {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    (none recorded)\n")
+	}
+}
+
+// Describes the state of an installed repo's working copy (e.g., "git
+// 1a2b3c4d, modified").
+func repoStateString(r *repo.Repo) string {
+	if r == nil || r.IsLocal() || r.IsVendored() ||
+		util.NodeNotExist(r.Path()) {
+
+		return ""
+	}
+
+	st := r.VCSState()
+	hash, err := st.CurrentCommit(r.Path())
+	if err != nil {
+		return st.Name() + ", unknown revision"
+	}
+	if len(hash) > 8 {
+		hash = hash[:8]
+	}
+
+	desc := st.Name() + " " + hash
+	if changes, err := st.AreChanges(r.Path()); err == nil && changes {
+		desc += ", modified"
+	}
+
+	return desc
 }
 
 func infoRunCmd(cmd *cobra.Command, args []string) {
@@ -143,7 +335,35 @@ func infoRunCmd(cmd *cobra.Command, args []string) {
 			proj.Name())
 
 		for _, repoName := range repoNames {
-			util.StatusMessage(util.VERBOSITY_DEFAULT, "    * @%s\n", repoName)
+			notes := []string{}
+			if util.Verbosity >= util.VERBOSITY_VERBOSE {
+				if state := repoStateString(
+					proj.FindRepo(repoName)); state != "" {
+
+					notes = append(notes, state)
+				}
+			}
+
+			// Repos that the project doesn't list itself are pulled in by
+			// other repos' dependencies.
+			if repoName != proj.Name() && !proj.RepoIsRoot(repoName) {
+				if deps := proj.RepoDependents(repoName); len(deps) > 0 {
+					notes = append(notes,
+						"required by "+strings.Join(deps, ", "))
+				}
+			}
+
+			if len(notes) > 0 {
+				util.StatusMessage(util.VERBOSITY_DEFAULT, "    * @%s (%s)\n",
+					repoName, strings.Join(notes, "; "))
+			} else {
+				util.StatusMessage(util.VERBOSITY_DEFAULT, "    * @%s\n",
+					repoName)
+			}
+		}
+
+		if util.Verbosity >= util.VERBOSITY_VERBOSE {
+			printRepoMetrics(repoNames)
 		}
 
 		// Now display the packages in the local repository.
@@ -186,11 +406,69 @@ func syncRunCmd(cmd *cobra.Command, args []string) {
 	proj := TryGetProject()
 	pred := makeRepoPredicate(args)
 
-	if err := proj.SyncIf(
-		newtutil.NewtForce, newtutil.NewtAsk, pred); err != nil {
+	// A sync always pulls the latest upstream commits.
+	repo.DescCacheTTL = 0
+
+	if err := proj.SyncIf(newtutil.NewtForce, newtutil.NewtAsk,
+		newtutil.NewtDryRun, pred); err != nil {
 
 		NewtUsage(nil, err)
 	}
+	if !newtutil.NewtDryRun {
+		installPinnedVersions(proj, pred)
+	}
+
+	newtutil.PrintSummary()
+}
+
+func printProjectDump(pd projectDump) {
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Project %s (%s)\n",
+		pd.Project.Name, pd.Project.Path)
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Repositories:\n")
+	for _, r := range pd.Repos {
+		desc := "not installed"
+		if r.Local {
+			desc = "local"
+		} else if r.Installed {
+			desc = r.Version + " " + r.Commit
+			if r.Modified {
+				desc += " (modified)"
+			}
+		}
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    %s: %s\n",
+			r.Name, desc)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Targets:\n")
+	for _, t := range pd.Targets {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    %s (app=%s, bsp=%s)\n",
+			t.Name, t.App, t.Bsp)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Packages: %d\n",
+		len(pd.Packages))
+}
+
+func projectDumpRunCmd(cmd *cobra.Command, args []string) {
+	// Warnings would corrupt the JSON output.
+	if projectDumpJson {
+		util.Verbosity = util.VERBOSITY_SILENT
+	}
+
+	proj := TryGetProject()
+	pd := buildProjectDump(proj)
+
+	if !projectDumpJson {
+		printProjectDump(pd)
+		return
+	}
+
+	b, err := json.MarshalIndent(pd, "", "    ")
+	if err != nil {
+		NewtUsage(nil, util.ChildNewtError(err))
+	}
+	util.StatusMessage(util.VERBOSITY_SILENT, "%s\n", string(b))
 }
 
 func AddProjectCommands(cmd *cobra.Command) {
@@ -198,7 +476,12 @@ func AddProjectCommands(cmd *cobra.Command) {
 	installHelpEx := "  newt install\n"
 	installHelpEx += "    Installs all repositories specified in project.yml.\n\n"
 	installHelpEx += "  newt install apache-mynewt-core\n"
-	installHelpEx += "    Installs the apache-mynewt-core repository."
+	installHelpEx += "    Installs the apache-mynewt-core repository.\n\n"
+	installHelpEx += "  newt install --frozen\n"
+	installHelpEx += "    Verifies that all repositories are installed at the " +
+		"commits in project.lock\n"
+	installHelpEx += "    and are unmodified, without fetching or changing " +
+		"anything."
 	installCmd := &cobra.Command{
 		Use:     "install [repo-1] [repo-2] [...]",
 		Short:   "Install project dependencies",
@@ -213,13 +496,33 @@ func AddProjectCommands(cmd *cobra.Command) {
 	installCmd.PersistentFlags().BoolVarP(&newtutil.NewtAsk,
 		"ask", "a", false, "Prompt user before installing any repos")
 
+	installCmd.PersistentFlags().BoolVar(&newtutil.NewtIgnoreCompat,
+		"ignore-newt-compat", false, "Proceed with installing repos that "+
+			"require a different version of newt")
+	installCmd.PersistentFlags().BoolVar(&newtutil.NewtFrozen,
+		"frozen", false, "Fail unless every repo is already installed at "+
+			"its locked commit without local modifications; nothing is "+
+			"fetched or changed")
+	installCmd.PersistentFlags().BoolVar(&installNoCache,
+		"no-cache", false, "Fetch every repo, even if its repository.yml "+
+			"was downloaded recently (see the cache.metadata.ttl setting)")
+
 	cmd.AddCommand(installCmd)
 
-	upgradeHelpText := ""
+	upgradeHelpText := "Upgrade the specified repos, or all repos if none " +
+		"are specified, to the versions required by project.yml.\n\n" +
+		"When only some repos are upgraded, newt checks that every other " +
+		"installed repo's dependencies are still satisfied.  If a repo " +
+		"depends on an incompatible version of an upgraded repo, the " +
+		"upgrade is refused; with --with-dependents, the dependent repos " +
+		"are upgraded as well."
 	upgradeHelpEx := "  newt upgrade\n"
 	upgradeHelpEx += "    Upgrades all repositories specified in project.yml.\n\n"
 	upgradeHelpEx += "  newt upgrade apache-mynewt-core\n"
-	upgradeHelpEx += "    Upgrades the apache-mynewt-core repository."
+	upgradeHelpEx += "    Upgrades the apache-mynewt-core repository.\n\n"
+	upgradeHelpEx += "  newt upgrade --with-dependents apache-mynewt-core\n"
+	upgradeHelpEx += "    Upgrades apache-mynewt-core and any repos that " +
+		"require a newer\n    version of it."
 	upgradeCmd := &cobra.Command{
 		Use:     "upgrade [repo-1] [repo-2] [...]",
 		Short:   "Upgrade project dependencies",
@@ -232,14 +535,32 @@ func AddProjectCommands(cmd *cobra.Command) {
 		"Force upgrade of the repositories to latest state in project.yml")
 	upgradeCmd.PersistentFlags().BoolVarP(&newtutil.NewtAsk,
 		"ask", "a", false, "Prompt user before upgrading any repos")
+	upgradeCmd.PersistentFlags().BoolVar(&newtutil.NewtStash,
+		"stash", false, "Stash local changes before upgrading a repo and "+
+			"re-apply them afterwards")
+	upgradeCmd.PersistentFlags().BoolVarP(&newtutil.NewtDryRun,
+		"dry-run", "n", false, "Report the changes that would be made "+
+			"without modifying any repos")
+
+	upgradeCmd.PersistentFlags().BoolVar(&newtutil.NewtIgnoreCompat,
+		"ignore-newt-compat", false, "Proceed with upgrading repos that "+
+			"require a different version of newt")
+	upgradeCmd.PersistentFlags().BoolVar(&newtutil.NewtUpgradeDependents,
+		"with-dependents", false, "Also upgrade repos whose dependencies "+
+			"the upgrade would break")
 
 	cmd.AddCommand(upgradeCmd)
 
-	syncHelpText := ""
+	syncHelpText := "Fetches and merges the latest commits for each " +
+		"installed repository.  Up to -j repositories are synced at " +
+		"once; when all are done, a table lists each repository's old " +
+		"and new commit, its status, and any warnings."
 	syncHelpEx := "  newt sync\n"
 	syncHelpEx += "    Syncs all repositories specified in project.yml.\n\n"
 	syncHelpEx += "  newt sync apache-mynewt-core\n"
-	syncHelpEx += "    Syncs the apache-mynewt-core repository."
+	syncHelpEx += "    Syncs the apache-mynewt-core repository.\n\n"
+	syncHelpEx += "  newt sync -j 8\n"
+	syncHelpEx += "    Syncs up to eight repositories at a time."
 	syncCmd := &cobra.Command{
 		Use:     "sync [repo-1] [repo-2] [...]",
 		Short:   "Synchronize project dependencies",
@@ -252,22 +573,54 @@ func AddProjectCommands(cmd *cobra.Command) {
 		"Force overwrite of existing remote repositories.")
 	syncCmd.PersistentFlags().BoolVarP(&newtutil.NewtAsk,
 		"ask", "a", false, "Prompt user before syncing any repos")
+	syncCmd.PersistentFlags().BoolVarP(&newtutil.NewtDryRun,
+		"dry-run", "n", false, "Report the changes that would be made "+
+			"without modifying any repos")
 	cmd.AddCommand(syncCmd)
 
-	newHelpText := ""
-	newHelpEx := ""
+	newHelpText := "Create a new project from a template.  The template " +
+		"is a git URL, a local directory, or a GitHub repo " +
+		"(<user>/<repo>), optionally followed by #<ref> to select a " +
+		"branch, tag, or commit.  If no template is specified, the " +
+		"new.template newtrc setting is used; if that isn't set either, " +
+		"the project is created from apache/mynewt-blinky.\n\n" +
+		"A template containing a template.yml file can refer to variables " +
+		"as {{name}} in file contents and paths.  project_name defaults " +
+		"to the project directory's name; bsp and app_name are set with " +
+		"--bsp and --app; any variable can be set with --var."
+	newHelpEx := "  newt new myproj\n"
+	newHelpEx += "  newt new myproj --template https://git.example.com/starter.git#v2 --bsp @apache-mynewt-core/hw/bsp/nordic_pca10056\n"
+	newHelpEx += "  newt new myproj --template acme/mynewt-starter --app sensor --var company=Acme"
 	newCmd := &cobra.Command{
 		Use:     "new <project-dir>",
+		Aliases: []string{"new-project"},
 		Short:   "Create a new project",
 		Long:    newHelpText,
 		Example: newHelpEx,
 		Run:     newRunCmd,
 	}
+	newCmd.Flags().StringVar(&newTemplate, "template", "",
+		"Template to create the project from")
+	newCmd.Flags().StringVar(&newBsp, "bsp", "",
+		"Value of the template's bsp variable")
+	newCmd.Flags().StringVar(&newApp, "app", "",
+		"Value of the template's app_name variable")
+	newCmd.Flags().StringArrayVar(&newTemplateVars, "var", nil,
+		"Template variable to set (<name>=<value>); may be repeated")
 
 	cmd.AddCommand(newCmd)
 
-	infoHelpText := "Show information about the current project."
+	infoHelpText := "Show information about the current project.  Repos " +
+		"that aren't listed in project.yml are annotated with the repos " +
+		"whose dependencies pulled them in.\n\n"
+	infoHelpText += "With -v, also shows the version control system and " +
+		"checked out revision of each installed repo, whether its working " +
+		"copy is modified, and each repo's download metrics: " +
+		"the number and duration of clones and fetches, fallbacks to " +
+		"mirrors, and the cause of the most recent failure (timeout, " +
+		"auth, not-found, network, disk, or other)."
 	infoHelpEx := "  newt info\n"
+	infoHelpEx += "  newt info -v\n"
 
 	infoCmd := &cobra.Command{
 		Use:     "info",
@@ -278,4 +631,36 @@ func AddProjectCommands(cmd *cobra.Command) {
 	}
 
 	cmd.AddCommand(infoCmd)
+
+	projectCmd := &cobra.Command{
+		Use:   "project",
+		Short: "Inspect the project",
+		Long:  "Inspect the project.",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+
+	cmd.AddCommand(projectCmd)
+
+	dumpHelpText := "Describe the fully resolved project: its repos (with " +
+		"URLs, versions, and commits), packages, targets, and settings.\n\n" +
+		"With --json, the description is written as a JSON object intended " +
+		"for external tools; nothing else is written to standard output.  " +
+		"The object's \"schema_version\" field is incremented whenever the " +
+		"format changes incompatibly."
+	dumpHelpEx := "  newt project dump\n"
+	dumpHelpEx += "  newt project dump --json > project.json"
+
+	dumpCmd := &cobra.Command{
+		Use:     "dump",
+		Short:   "Describe the resolved project state",
+		Long:    dumpHelpText,
+		Example: dumpHelpEx,
+		Run:     projectDumpRunCmd,
+	}
+	dumpCmd.Flags().BoolVar(&projectDumpJson, "json", false,
+		"Write a machine-readable JSON description")
+
+	projectCmd.AddCommand(dumpCmd)
 }
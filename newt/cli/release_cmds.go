@@ -0,0 +1,230 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/newt/image"
+	"mynewt.apache.org/newt/newt/release"
+	"mynewt.apache.org/newt/util"
+)
+
+var releasePolicyFile string
+var packageFormat string
+var packageOutput string
+
+func printReleaseChecklist(results []release.CheckResult) {
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Release checklist:\n")
+	for _, r := range results {
+		if r.Passed {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"    [PASS] %s\n", r.Name)
+		} else {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"    [FAIL] %s: %s\n", r.Name, r.Detail)
+		}
+	}
+}
+
+func releaseRunCmd(cmd *cobra.Command, args []string) {
+	var keyId uint8
+	var keystr string
+
+	if len(args) < 2 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target and version"))
+	}
+
+	if useV1 && useV2 {
+		NewtUsage(cmd, util.NewNewtError("Either -1, or -2, but not both"))
+	}
+	image.UseV1 = !useV2
+
+	TryGetProject()
+
+	t, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	version := args[1]
+
+	if len(args) > 2 {
+		if len(args) > 3 {
+			keyId64, err := strconv.ParseUint(args[3], 10, 8)
+			if err != nil {
+				NewtUsage(cmd,
+					util.NewNewtError("Key ID must be between 0-255"))
+			}
+			keyId = uint8(keyId64)
+		}
+		keystr = args[2]
+	}
+
+	policyPath := releasePolicyFile
+	if policyPath == "" {
+		policyPath = release.DefaultPolicyPath()
+	}
+	pol, err := release.ReadPolicy(policyPath)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	keystr, keyId, err = applySigningProfile(t, b, version, keystr, keyId)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	results, err := release.Check(pol, release.Params{
+		Target:     t,
+		Builder:    b,
+		Version:    version,
+		SigningKey: keystr,
+	})
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	printReleaseChecklist(results)
+	if !release.AllPassed(results) {
+		NewtUsage(nil, util.FmtNewtError(
+			"Target %s does not meet the release policy", t.FullName()))
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Building target %s\n",
+		t.FullName())
+	if err := b.Build(); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if _, _, err := b.CreateImages(version, keystr, keyId); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Release %s of target %s successfully created\n", version,
+		t.FullName())
+}
+
+func packageRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target"))
+	}
+
+	TryGetProject()
+
+	t, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	path, err := release.CreateArchive(b, packageFormat, packageOutput)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Release archive successfully created: %s\n",
+		relativeToProject(path))
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Checksum: %s\n",
+		relativeToProject(path+release.ARCHIVE_CHECKSUM_SUFFIX))
+}
+
+func AddReleaseCommands(cmd *cobra.Command) {
+	releaseHelpText := "Verify that <target-name> meets the project's " +
+		"release policy, then build it and create a release image with " +
+		"the specified version.  The arguments are the same as those of " +
+		"the create-image command.\n\n" +
+		"The policy is read from release.yml at the project root unless " +
+		"another file is specified with --policy.  By default, the " +
+		"following checks are performed:\n" +
+		"    * The target does not use the \"debug\" build profile.\n" +
+		"    * A signing key is specified.\n" +
+		"    * The version is not 0.0.0.\n" +
+		"    * No repo contains local changes.\n\n" +
+		"A policy file can disable these checks and can additionally " +
+		"require a minimum LOG_LEVEL and specific syscfg values."
+
+	releaseHelpEx := "  newt release my_target1 1.3.0 private.pem\n"
+	releaseHelpEx += "  newt release --policy ci/release.yml my_target1 " +
+		"1.3.0 private.pem\n"
+
+	releaseCmd := &cobra.Command{
+		Use:     "release <target-name> <version> [signing-key [key-id]]",
+		Short:   "Check a target against the release policy and create an image",
+		Long:    releaseHelpText,
+		Example: releaseHelpEx,
+		Run:     releaseRunCmd,
+	}
+
+	releaseCmd.PersistentFlags().StringVarP(&releasePolicyFile,
+		"policy", "p", "", "Release policy file (default: release.yml)")
+	releaseCmd.PersistentFlags().BoolVarP(&useV1,
+		"1", "1", false, "Use old image header format")
+	releaseCmd.PersistentFlags().BoolVarP(&useV2,
+		"2", "2", false, "Use new image header format")
+	releaseCmd.PersistentFlags().StringVar(&signingProfile,
+		"profile", "", "Sign with the named signing profile")
+
+	cmd.AddCommand(releaseCmd)
+	AddTabCompleteFn(releaseCmd, targetList)
+
+	packageHelpText := "Bundle the release artifacts of <target-name> into " +
+		"a reproducible archive: the image, hex file, ELF file, manifest, " +
+		"secondary outputs, an SPDX bill of materials, and a release notes " +
+		"template.  A SHA256SUMS file inside the archive lists the " +
+		"checksum of every file, and a <archive>.sha256 file is written " +
+		"next to the archive.\n\n" +
+		"Run create-image (or release) first.  Entries are sorted and " +
+		"timestamped with SOURCE_DATE_EPOCH (default: 1980-01-01), so " +
+		"identical artifacts always produce an identical archive."
+
+	packageHelpEx := "  newt package my_target1\n"
+	packageHelpEx += "  newt package --format tar.gz my_target1\n"
+
+	packageCmd := &cobra.Command{
+		Use:     "package <target-name>",
+		Short:   "Create a reproducible archive of a target's release artifacts",
+		Long:    packageHelpText,
+		Example: packageHelpEx,
+		Run:     packageRunCmd,
+	}
+
+	packageCmd.Flags().StringVar(&packageFormat, "format",
+		release.ARCHIVE_FORMAT_ZIP, "Archive format (zip or tar.gz)")
+	packageCmd.Flags().StringVar(&packageOutput, "output", "",
+		"Archive path (default: bin/targets/<target>/<target>-<version>.<ext>)")
+
+	cmd.AddCommand(packageCmd)
+	AddTabCompleteFn(packageCmd, targetList)
+}
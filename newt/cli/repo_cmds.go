@@ -0,0 +1,328 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/util"
+)
+
+// A repo with no upstream activity for this long is flagged as possibly
+// abandoned.
+const REPO_INACTIVE_DAYS = 365
+
+var repoNoFetch bool
+var repoVerifyFormat string
+
+// Formats the time elapsed since the specified time in days.
+func ageString(t time.Time) string {
+	days := int(time.Since(t).Hours() / 24)
+	switch days {
+	case 0:
+		return "today"
+	case 1:
+		return "1 day"
+	default:
+		return fmt.Sprintf("%d days", days)
+	}
+}
+
+func repoHealthRunCmd(cmd *cobra.Command, args []string) {
+	proj := TryGetProject()
+
+	pred := makeRepoPredicate(args)
+	if len(args) == 0 {
+		pred = func(r *repo.Repo) bool { return !r.IsLocal() }
+	}
+
+	repos := []*repo.Repo{}
+	for _, r := range proj.SelectRepos(pred) {
+		if proj.RepoIsInstalled(r.Name()) {
+			repos = append(repos, r)
+		}
+	}
+	if len(repos) == 0 {
+		NewtUsage(nil, util.NewNewtError("No installed repos to inspect"))
+	}
+
+	w := 10
+	for _, r := range repos {
+		if len(r.Name()) > w {
+			w = len(r.Name())
+		}
+	}
+
+	fmtStr := fmt.Sprintf("%%-%ds  %%-10s  %%-10s  %%-13s  %%-14s  %%s\n", w)
+	util.StatusMessage(util.VERBOSITY_DEFAULT, fmtStr, "Repository",
+		"Installed", "Commit age", "Last upstream", "Newest version",
+		"Behind")
+
+	// Staleness is measured against the latest upstream state.
+	repo.DescCacheTTL = 0
+
+	for _, r := range repos {
+		if !repoNoFetch {
+			if _, err := r.UpdateDesc(); err != nil {
+				NewtUsage(nil, err)
+			}
+		}
+
+		h, err := r.Health()
+		if err != nil {
+			NewtUsage(nil, util.FmtNewtError(
+				"Failed to inspect repo \"%s\": %s", r.Name(), err.Error()))
+		}
+
+		installed := "?"
+		if ver, err := proj.GetRepoVersion(r.Name()); err == nil &&
+			ver != nil {
+
+			installed = ver.String()
+		}
+
+		newest := "-"
+		if h.NewestVer != nil {
+			newest = h.NewestVer.String()
+		}
+
+		behind := "?"
+		if h.Behind >= 0 {
+			behind = fmt.Sprintf("%d commits", h.Behind)
+		}
+
+		upstream := ageString(h.UpstreamTime)
+		if time.Since(h.UpstreamTime) > REPO_INACTIVE_DAYS*24*time.Hour {
+			upstream += " (inactive)"
+		}
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT, fmtStr, r.Name(),
+			installed, ageString(h.CommitTime), upstream, newest, behind)
+	}
+}
+
+func repoPinRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		NewtUsage(cmd, util.NewNewtError("Must specify at least one repo"))
+	}
+
+	proj := TryGetProject()
+	for _, name := range args {
+		r := proj.FindRepo(name)
+		if r == nil || r.IsLocal() {
+			NewtUsage(cmd, util.FmtNewtError("Unknown repo \"%s\"", name))
+		}
+
+		hash, err := proj.PinRepo(r)
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Pinned %s to %s\n", name, hash)
+	}
+}
+
+func repoUnpinRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		NewtUsage(cmd, util.NewNewtError("Must specify at least one repo"))
+	}
+
+	proj := TryGetProject()
+	for _, name := range args {
+		r := proj.FindRepo(name)
+		if r == nil || r.IsLocal() {
+			NewtUsage(cmd, util.FmtNewtError("Unknown repo \"%s\"", name))
+		}
+
+		vers, err := proj.UnpinRepo(r)
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Unpinned %s; version requirement restored to %s\n", name, vers)
+	}
+}
+
+func printVerifyReports(reports []repo.VerifyReport, format string) {
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(reports, "", "    ")
+		if err != nil {
+			NewtUsage(nil, util.ChildNewtError(err))
+		}
+		util.StatusMessage(util.VERBOSITY_QUIET, "%s\n", string(b))
+
+	case "text":
+		for _, vr := range reports {
+			status := "OK"
+			if !vr.Ok {
+				status = "FAILED"
+			}
+			util.StatusMessage(util.VERBOSITY_DEFAULT, "%s: %s\n",
+				vr.Repo, status)
+
+			for _, vc := range vr.Checks {
+				if vc.Status == repo.VERIFY_STATUS_FAIL ||
+					vc.Status == repo.VERIFY_STATUS_WARN {
+
+					for _, d := range vc.Details {
+						util.StatusMessage(util.VERBOSITY_DEFAULT,
+							"    %s: %s\n", vc.Name, d)
+					}
+				} else {
+					util.StatusMessage(util.VERBOSITY_VERBOSE,
+						"    %s: %s %s\n", vc.Name, vc.Status,
+						strings.Join(vc.Details, "; "))
+				}
+			}
+		}
+
+	default:
+		NewtUsage(nil, util.FmtNewtError(
+			"invalid format \"%s\"; must be text or json", format))
+	}
+}
+
+func repoVerifyRunCmd(cmd *cobra.Command, args []string) {
+	proj := TryGetProject()
+
+	reports, err := proj.VerifyRepos(makeRepoPredicate(args))
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+	if len(reports) == 0 {
+		NewtUsage(nil, util.NewNewtError("No repos to verify"))
+	}
+
+	printVerifyReports(reports, repoVerifyFormat)
+
+	failed := 0
+	for _, vr := range reports {
+		if !vr.Ok {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		NewtUsage(nil, util.FmtNewtError(
+			"%d of %d repos failed verification", failed, len(reports)))
+	}
+}
+
+func AddRepoCommands(cmd *cobra.Command) {
+	repoHelpText := "Inspect and manage the repositories in the project."
+	repoCmd := &cobra.Command{
+		Use:   "repo",
+		Short: "Inspect and manage project repositories",
+		Long:  repoHelpText,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+
+	cmd.AddCommand(repoCmd)
+
+	healthHelpText := "Report how current each installed repository is: " +
+		"the age of the installed commit, the date of the most recent " +
+		"upstream commit, the newest version listed in the repository's " +
+		"repository.yml file, and the number of commits between the " +
+		"installed commit and that version.  Repositories without " +
+		"upstream activity in the last year are marked inactive.\n\n" +
+		"If no repositories are specified, all installed repositories are " +
+		"inspected.  Each repository is fetched first unless --no-fetch is " +
+		"specified."
+
+	healthCmd := &cobra.Command{
+		Use:   "health [repo-1] [repo-2] [...]",
+		Short: "Report stale and inactive repositories",
+		Long:  healthHelpText,
+		Run:   repoHealthRunCmd,
+	}
+	healthCmd.PersistentFlags().BoolVar(&repoNoFetch, "no-fetch", false,
+		"Use the already-fetched repository state")
+
+	repoCmd.AddCommand(healthCmd)
+
+	pinHelpText := "Pin each specified repository to its installed commit " +
+		"by replacing its version requirement in project.yml with the " +
+		"commit's hash.  The original requirement, along with the version, " +
+		"branches, and tags corresponding to the hash, is recorded in a " +
+		"comment."
+
+	pinCmd := &cobra.Command{
+		Use:   "pin <repo-1> [repo-2] [...]",
+		Short: "Pin repositories to their installed commits",
+		Long:  pinHelpText,
+		Run:   repoPinRunCmd,
+	}
+
+	repoCmd.AddCommand(pinCmd)
+
+	unpinHelpText := "Restore the version requirement each specified " +
+		"repository had in project.yml before it was pinned with " +
+		"`newt repo pin`."
+
+	unpinCmd := &cobra.Command{
+		Use:   "unpin <repo-1> [repo-2] [...]",
+		Short: "Restore the floating versions of pinned repositories",
+		Long:  unpinHelpText,
+		Run:   repoUnpinRunCmd,
+	}
+
+	repoCmd.AddCommand(unpinCmd)
+
+	verifyHelpText := "Check each installed repository without modifying " +
+		"it:\n\n" +
+		"  origin         The remote points to the URL in the repository's " +
+		"definition.\n" +
+		"  commit         The checked out commit matches project.lock, or " +
+		"the commit\n" +
+		"                 pinned in project.yml.\n" +
+		"  submodules     Each submodule is initialized and checked out at " +
+		"its\n" +
+		"                 recorded commit.\n" +
+		"  version-files  repository.yml and version.yml are present and " +
+		"valid.\n\n" +
+		"If no repositories are specified, all repositories are checked.  " +
+		"The command fails if any check fails, so it can gate CI builds; " +
+		"use --format json for a machine-readable report."
+	verifyHelpEx := "  newt repo verify\n"
+	verifyHelpEx += "  newt repo verify --format json apache-mynewt-core"
+
+	verifyCmd := &cobra.Command{
+		Use:     "verify [repo-1] [repo-2] [...]",
+		Short:   "Check the integrity of installed repositories",
+		Long:    verifyHelpText,
+		Example: verifyHelpEx,
+		Run:     repoVerifyRunCmd,
+	}
+	verifyCmd.Flags().StringVar(&repoVerifyFormat, "format", "text",
+		"Report format (text or json)")
+
+	repoCmd.AddCommand(verifyCmd)
+}
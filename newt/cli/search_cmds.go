@@ -0,0 +1,140 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/newt/registry"
+	"mynewt.apache.org/newt/util"
+)
+
+var searchIndex string
+var searchAdd string
+
+func searchAddRepo(indexes []*registry.Index, name string) {
+	proj := TryGetProject()
+
+	ir := registry.FindRepo(indexes, strings.TrimPrefix(name, "@"))
+	if ir == nil {
+		NewtUsage(nil, util.FmtNewtError(
+			"No repo named \"%s\" in the package indexes", name))
+	}
+
+	if proj.FindRepo(ir.Name) != nil {
+		NewtUsage(nil, util.FmtNewtError(
+			"Project already contains repo \"%s\"", ir.Name))
+	}
+
+	fields := map[string]string{}
+	for k, v := range ir.Fields {
+		fields[k] = v
+	}
+	if fields["vers"] == "" {
+		fields["vers"] = "0-dev"
+	}
+
+	if err := proj.AddRepoDesc(ir.Name, fields); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Added repo \"%s\" (%s) to project.yml; run \"newt upgrade\" to "+
+			"download it\n", ir.Name, fields["vers"])
+}
+
+func searchRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 && searchAdd == "" {
+		NewtUsage(cmd, util.NewNewtError("Must specify a search term"))
+	}
+
+	locs := registry.IndexLocations()
+	if searchIndex != "" {
+		locs = map[string]string{"cmdline": searchIndex}
+	}
+
+	indexes, err := registry.ReadIndexes(locs)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if len(args) > 0 {
+		matches := registry.Search(indexes, args)
+		if len(matches) == 0 {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"No packages or repos match \"%s\"\n",
+				strings.Join(args, " "))
+		}
+
+		for _, m := range matches {
+			util.StatusMessage(util.VERBOSITY_QUIET, "@%s", m.Repo.Name)
+			if len(indexes) > 1 {
+				util.StatusMessage(util.VERBOSITY_QUIET, " (index: %s)",
+					m.Repo.Index)
+			}
+			util.StatusMessage(util.VERBOSITY_QUIET, "\n")
+			if m.Repo.Description != "" {
+				util.StatusMessage(util.VERBOSITY_DEFAULT, "    %s\n",
+					m.Repo.Description)
+			}
+
+			for _, ip := range m.Pkgs {
+				util.StatusMessage(util.VERBOSITY_QUIET, "    @%s/%s",
+					m.Repo.Name, ip.Name)
+				if ip.Description != "" {
+					util.StatusMessage(util.VERBOSITY_DEFAULT, " - %s",
+						ip.Description)
+				}
+				util.StatusMessage(util.VERBOSITY_QUIET, "\n")
+			}
+		}
+	}
+
+	if searchAdd != "" {
+		searchAddRepo(indexes, searchAdd)
+	}
+}
+
+func AddSearchCommands(cmd *cobra.Command) {
+	searchHelpText := "Search the package indexes for repos and packages " +
+		"matching every search term.  Indexes are listed in " +
+		"~/.newt/repos.yml under \"search.indexes\" (name: location); a " +
+		"location is a file path or an https URL.  With --add, the named " +
+		"repo is added to project.yml."
+	searchHelpEx := "  newt search bme280\n"
+	searchHelpEx += "  newt search sensor i2c\n"
+	searchHelpEx += "  newt search bme280 --add apache-mynewt-core"
+
+	searchCmd := &cobra.Command{
+		Use:     "search <term> [terms...]",
+		Short:   "Search package indexes for repos and packages",
+		Long:    searchHelpText,
+		Example: searchHelpEx,
+		Run:     searchRunCmd,
+	}
+	searchCmd.Flags().StringVar(&searchIndex, "index", "",
+		"Search only this index (file path or URL)")
+	searchCmd.Flags().StringVar(&searchAdd, "add", "",
+		"Add the named repo to project.yml")
+
+	cmd.AddCommand(searchCmd)
+}
@@ -0,0 +1,118 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/newt/settings"
+	"mynewt.apache.org/newt/util"
+)
+
+func settingsGetRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify a setting name"))
+	}
+
+	val, ok, err := settings.GetNewtrcValue(args[0])
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+	if !ok {
+		util.StatusMessage(util.VERBOSITY_QUIET, "Setting \"%s\" not set\n",
+			args[0])
+		os.Exit(1)
+	}
+
+	fmt.Println(val)
+}
+
+func settingsSetRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Must specify a setting name and a value"))
+	}
+
+	if err := settings.SetNewtrcValue(args[0], args[1]); err != nil {
+		NewtUsage(nil, err)
+	}
+}
+
+func settingsUnsetRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify a setting name"))
+	}
+
+	if err := settings.UnsetNewtrcValue(args[0]); err != nil {
+		NewtUsage(nil, err)
+	}
+}
+
+func AddSettingsCommands(cmd *cobra.Command) {
+	settingsHelpText := "View and modify the user's newt settings " +
+		"(~/.newt/repos.yml).  Changes are made under a lock, validated, " +
+		"and written atomically, so these commands are safe to use from " +
+		"provisioning scripts while other newt processes are running.  " +
+		"Comments and formatting in the rest of the file are preserved.\n\n" +
+		"A setting name is either a top-level key (e.g., git.timeout) or a " +
+		"field of a top-level map (e.g., " +
+		"repository.apache-mynewt-core.login)."
+
+	settingsCmd := &cobra.Command{
+		Use:   "settings",
+		Short: "View and modify newt settings",
+		Long:  settingsHelpText,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+
+	cmd.AddCommand(settingsCmd)
+
+	getCmd := &cobra.Command{
+		Use:   "get <name>",
+		Short: "Print the value of a setting",
+		Long: "Print the value of a setting.  Exits with status 1 if the " +
+			"setting is not set.",
+		Run: settingsGetRunCmd,
+	}
+	settingsCmd.AddCommand(getCmd)
+
+	setCmd := &cobra.Command{
+		Use:   "set <name> <value>",
+		Short: "Change the value of a setting",
+		Long:  "Change the value of a setting, adding it if necessary.",
+		Example: "  newt settings set git.timeout 300\n" +
+			"  newt settings set repository.my-private-repo.token_env " +
+			"MY_TOKEN",
+		Run: settingsSetRunCmd,
+	}
+	settingsCmd.AddCommand(setCmd)
+
+	unsetCmd := &cobra.Command{
+		Use:   "unset <name>",
+		Short: "Remove a setting",
+		Run:   settingsUnsetRunCmd,
+	}
+	settingsCmd.AddCommand(unsetCmd)
+}
@@ -0,0 +1,357 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/newt/settings"
+	"mynewt.apache.org/newt/util"
+)
+
+const SETUP_DFLT_PROJECT = "myproj"
+const SETUP_DFLT_BSP = "nordic_pca10040"
+
+// A program that mynewt development typically needs.
+type setupTool struct {
+	names    []string // Alternatives; the first one found is used.
+	purpose  string
+	required bool
+
+	// Install hints, indexed by GOOS.  "" is the fallback.
+	hints map[string]string
+}
+
+var setupTools = []setupTool{
+	{
+		names:    []string{"git"},
+		purpose:  "downloading repos",
+		required: true,
+		hints: map[string]string{
+			"linux":  "apt install git",
+			"darwin": "brew install git",
+			"":       "https://git-scm.com/downloads",
+		},
+	},
+	{
+		names:   []string{"arm-none-eabi-gcc"},
+		purpose: "building for ARM targets",
+		hints: map[string]string{
+			"linux":  "apt install gcc-arm-none-eabi",
+			"darwin": "brew install --cask gcc-arm-embedded",
+			"": "https://developer.arm.com/downloads/-/" +
+				"gnu-rm",
+		},
+	},
+	{
+		names:   []string{"arm-none-eabi-gdb", "gdb-multiarch"},
+		purpose: "debugging ARM targets",
+		hints: map[string]string{
+			"linux":  "apt install gdb-multiarch",
+			"darwin": "brew install --cask gcc-arm-embedded",
+			"":       "included with the ARM toolchain",
+		},
+	},
+	{
+		names:   []string{"openocd", "JLinkExe"},
+		purpose: "loading images onto boards",
+		hints: map[string]string{
+			"linux":  "apt install openocd",
+			"darwin": "brew install openocd",
+			"":       "https://openocd.org",
+		},
+	},
+	{
+		names:   []string{"gcc"},
+		purpose: "running unit tests (newt test)",
+		hints: map[string]string{
+			"linux":  "apt install gcc",
+			"darwin": "xcode-select --install",
+			"":       "install a native C compiler",
+		},
+	},
+}
+
+// Shared by all prompts so that buffered input isn't lost between them.
+var setupReader = bufio.NewReader(os.Stdin)
+
+func promptString(question string, dflt string) string {
+	if dflt != "" {
+		fmt.Printf("%s [%s]: ", question, dflt)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+
+	line, err := setupReader.ReadString('\n')
+	line = strings.TrimSpace(line)
+	if err != nil && line == "" {
+		// End of input; accept the default.
+		fmt.Printf("\n")
+		return dflt
+	}
+	if line == "" {
+		return dflt
+	}
+
+	return line
+}
+
+func promptYesNo(question string, dflt bool) bool {
+	choices := "y/N"
+	if dflt {
+		choices = "Y/n"
+	}
+
+	for {
+		answer := strings.ToLower(promptString(
+			fmt.Sprintf("%s (%s)", question, choices), ""))
+		switch {
+		case answer == "":
+			return dflt
+		case strings.HasPrefix(answer, "y"):
+			return true
+		case strings.HasPrefix(answer, "n"):
+			return false
+		}
+
+		fmt.Printf("Invalid response.\n")
+	}
+}
+
+// Reports the first line of a program's version output; "" if it doesn't
+// have one.
+func toolVersion(path string) string {
+	out, err := exec.Command(path, "--version").Output()
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+}
+
+// Checks for each development tool and explains how to install the missing
+// ones.
+//
+// @return bool                 true if every required tool is present.
+func setupCheckTools() bool {
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Checking development tools:\n")
+
+	ok := true
+	for _, tool := range setupTools {
+		found := ""
+		for _, name := range tool.names {
+			if path, err := exec.LookPath(name); err == nil {
+				found = path
+				break
+			}
+		}
+
+		if found != "" {
+			desc := found
+			// J-Link tools wait for input rather than printing a version.
+			if !strings.Contains(found, "JLink") {
+				if ver := toolVersion(found); ver != "" {
+					desc = ver
+				}
+			}
+			util.StatusMessage(util.VERBOSITY_DEFAULT, "    [ok]      %s: %s\n",
+				tool.names[0], desc)
+			continue
+		}
+
+		hint, present := tool.hints[runtime.GOOS]
+		if !present {
+			hint = tool.hints[""]
+		}
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"    [missing] %s (needed for %s); install: %s\n",
+			strings.Join(tool.names, " or "), tool.purpose, hint)
+
+		if tool.required {
+			ok = false
+		}
+	}
+
+	return ok
+}
+
+func setupSetting(key string, val string) {
+	if val == "" {
+		if err := settings.UnsetNewtrcValue(key); err != nil {
+			NewtUsage(nil, err)
+		}
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    Removed %s\n", key)
+		return
+	}
+
+	if err := settings.SetNewtrcValue(key, val); err != nil {
+		NewtUsage(nil, err)
+	}
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "    Set %s\n", key)
+}
+
+// Prompts for the newtrc settings that new users most often need.
+func setupConfigureNewtrc() {
+	nrc := settings.Newtrc()
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"\nConfiguring newt settings (~/.newt/repos.yml); press enter to "+
+			"keep the current value:\n")
+
+	for _, key := range []string{"proxy.http", "proxy.https"} {
+		cur := nrc.GetValString(key, nil)
+		if val := promptString("HTTP proxy for "+
+			strings.TrimPrefix(key, "proxy.")+" URLs (blank for none)",
+			cur); val != cur {
+
+			setupSetting(key, val)
+		}
+	}
+
+	if nrc.GetValBool("cache.git.enabled", nil) ||
+		promptYesNo("Share downloaded git repos between projects", false) {
+
+		if !nrc.GetValBool("cache.git.enabled", nil) {
+			setupSetting("cache.git.enabled", "1")
+		}
+
+		cur := nrc.GetValString("cache.git.dir", nil)
+		if val := promptString("Git cache directory (blank for the default)",
+			cur); val != cur {
+
+			setupSetting("cache.git.dir", val)
+		}
+	}
+
+	// Credentials are never written to the settings file; only the name of
+	// the environment variable that holds them.
+	for {
+		repoName := promptString(
+			"Private repo requiring a GitHub token (blank to finish)", "")
+		if repoName == "" {
+			break
+		}
+
+		key := "repository." + repoName + ".token_env"
+		envVar := promptString(
+			"Environment variable containing the token for "+repoName,
+			nrc.GetValString(key, nil))
+		if envVar != "" {
+			setupSetting(key, envVar)
+		}
+	}
+}
+
+// Runs newt in a subprocess.
+func setupRunNewt(dir string, args ...string) error {
+	c := exec.Command(os.Args[0], args...)
+	c.Dir = dir
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return util.FmtNewtError("`newt %s` failed: %s",
+			strings.Join(args, " "), err.Error())
+	}
+
+	return nil
+}
+
+// Creates a project containing a blinky target for the chosen BSP.
+func setupCreateProject() {
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "\n")
+	if !promptYesNo("Create a starter project", true) {
+		return
+	}
+
+	dir := promptString("Project directory", SETUP_DFLT_PROJECT)
+	if util.NodeExist(dir) {
+		NewtUsage(nil, util.FmtNewtError("%s already exists", dir))
+	}
+
+	bsp := promptString("BSP (from apache-mynewt-core/hw/bsp)",
+		SETUP_DFLT_BSP)
+	if !strings.Contains(bsp, "/") {
+		bsp = "@apache-mynewt-core/hw/bsp/" + bsp
+	}
+	tgt := promptString("Target name", "blinky")
+
+	steps := [][]string{
+		{"new", dir},
+		{"upgrade"},
+		{"target", "create", tgt},
+		{"target", "set", tgt, "app=apps/blinky", "bsp=" + bsp,
+			"build_profile=debug"},
+	}
+	for i, step := range steps {
+		runDir := dir
+		if i == 0 {
+			runDir = "."
+		}
+		if err := setupRunNewt(runDir, step...); err != nil {
+			NewtUsage(nil, err)
+		}
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"\nProject created.  Build it with:\n"+
+			"    cd %s\n"+
+			"    newt build %s\n", dir, tgt)
+}
+
+func setupRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		NewtUsage(cmd, util.NewNewtError("Too many arguments"))
+	}
+
+	if !setupCheckTools() {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"\nInstall the required tools and run `newt setup` again.\n")
+		return
+	}
+
+	setupConfigureNewtrc()
+	setupCreateProject()
+}
+
+func AddSetupCommands(cmd *cobra.Command) {
+	setupHelpText := "Prepare a machine for mynewt development.  The " +
+		"command checks for the toolchain and related tools and explains " +
+		"how to install any that are missing, prompts for commonly needed " +
+		"newt settings (proxies, a shared git cache, and the environment " +
+		"variables holding credentials for private repos), and optionally " +
+		"creates a starter project with a blinky target for a chosen BSP."
+
+	setupCmd := &cobra.Command{
+		Use:   "setup",
+		Short: "Set up newt and create a first project",
+		Long:  setupHelpText,
+		Run:   setupRunCmd,
+	}
+
+	cmd.AddCommand(setupCmd)
+}
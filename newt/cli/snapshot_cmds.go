@@ -0,0 +1,221 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/newt/snapshot"
+	"mynewt.apache.org/newt/util"
+)
+
+var snapshotRestoreRepos bool
+
+func snapshotCreateRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		NewtUsage(cmd, util.NewNewtError(
+			"Must specify a target and a snapshot name"))
+	}
+
+	TryGetProject()
+
+	t, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	ss, err := snapshot.Create(t, args[1], targetForce)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Snapshot \"%s\" of target %s successfully created\n",
+		ss.Name, ss.TargetName)
+}
+
+func snapshotRestoreRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify a snapshot name"))
+	}
+
+	TryGetProject()
+
+	ss, err := snapshot.Read(args[0])
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if snapshotRestoreRepos {
+		if err := ss.RestoreRepos(); err != nil {
+			NewtUsage(nil, err)
+		}
+	}
+
+	if err := ss.RestoreTarget(); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Target %s successfully restored from snapshot \"%s\"\n",
+		ss.TargetName, ss.Name)
+
+	if !snapshotRestoreRepos {
+		// Let the user know if the build won't be reproduced exactly.
+		if err := ResetGlobalState(); err != nil {
+			NewtUsage(nil, err)
+		}
+		TryGetProject()
+
+		t, err := resolveExistingTargetArg(ss.TargetName)
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+
+		lines, err := ss.Diff(t)
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+		for _, line := range lines {
+			util.StatusMessage(util.VERBOSITY_QUIET,
+				"WARNING: differs from snapshot: %s\n", line)
+		}
+	}
+}
+
+func snapshotDiffRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify a snapshot name"))
+	}
+
+	TryGetProject()
+
+	ss, err := snapshot.Read(args[0])
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	t, err := resolveExistingTargetArg(ss.TargetName)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	lines, err := ss.Diff(t)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if len(lines) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Target %s matches snapshot \"%s\"\n", ss.TargetName, ss.Name)
+		return
+	}
+
+	for _, line := range lines {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "%s\n", line)
+	}
+}
+
+func snapshotListRunCmd(cmd *cobra.Command, args []string) {
+	TryGetProject()
+
+	names, err := snapshot.Names()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	for _, name := range names {
+		ss, err := snapshot.Read(name)
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "%s (target: %s, %s)\n",
+			ss.Name, ss.TargetName, ss.Created)
+	}
+}
+
+func snapshotNameList() []string {
+	names, _ := snapshot.Names()
+	return names
+}
+
+func AddSnapshotCommands(cmd *cobra.Command) {
+	snapshotHelpText := "Capture and restore the complete build inputs of " +
+		"a target: its target files, the hash of each repo, its resolved " +
+		"syscfg, and the hashes of its built images."
+	snapshotCmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Commands to create, restore, and compare target snapshots",
+		Long:  snapshotHelpText,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Usage()
+		},
+	}
+
+	cmd.AddCommand(snapshotCmd)
+
+	createHelpEx := "  newt snapshot create my_target1 fw-1.4.2"
+	createCmd := &cobra.Command{
+		Use:     "create <target-name> <snapshot-name>",
+		Short:   "Create a named snapshot of a target",
+		Example: createHelpEx,
+		Run:     snapshotCreateRunCmd,
+	}
+	createCmd.PersistentFlags().BoolVarP(&targetForce,
+		"force", "f", false, "Overwrite an existing snapshot")
+
+	snapshotCmd.AddCommand(createCmd)
+	AddTabCompleteFn(createCmd, targetList)
+
+	restoreHelpText := "Restore a target's files from a snapshot.  If the " +
+		"-r option is specified, each repo is also checked out at the " +
+		"commit it was at when the snapshot was taken."
+	restoreHelpEx := "  newt snapshot restore -r fw-1.4.2"
+	restoreCmd := &cobra.Command{
+		Use:     "restore <snapshot-name>",
+		Short:   "Restore a target from a snapshot",
+		Long:    restoreHelpText,
+		Example: restoreHelpEx,
+		Run:     snapshotRestoreRunCmd,
+	}
+	restoreCmd.PersistentFlags().BoolVarP(&snapshotRestoreRepos,
+		"repos", "r", false, "Also restore each repo to its snapshot commit")
+
+	snapshotCmd.AddCommand(restoreCmd)
+	AddTabCompleteFn(restoreCmd, snapshotNameList)
+
+	diffCmd := &cobra.Command{
+		Use:   "diff <snapshot-name>",
+		Short: "Compare a snapshot against the current state of its target",
+		Run:   snapshotDiffRunCmd,
+	}
+
+	snapshotCmd.AddCommand(diffCmd)
+	AddTabCompleteFn(diffCmd, snapshotNameList)
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the project's snapshots",
+		Run:   snapshotListRunCmd,
+	}
+
+	snapshotCmd.AddCommand(listCmd)
+}
@@ -0,0 +1,81 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/newt/support"
+	"mynewt.apache.org/newt/util"
+)
+
+var supportLogFile string
+
+func supportBundleRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify a target"))
+	}
+	if len(args) > 2 {
+		NewtUsage(cmd, util.NewNewtError("Too many arguments"))
+	}
+
+	TryGetProject()
+
+	t, err := resolveExistingTargetArg(args[0])
+	if err != nil {
+		NewtUsage(cmd, err)
+	}
+
+	outPath := support.BundleName(t) + ".tar.gz"
+	if len(args) > 1 {
+		outPath = args[1]
+	}
+
+	if err := support.Create(t, supportLogFile, outPath); err != nil {
+		NewtUsage(nil, err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Support bundle for target %s written to %s\n", t.FullName(), outPath)
+}
+
+func AddSupportCommands(cmd *cobra.Command) {
+	supportBundleHelpText := "Gather the information needed to reproduce a " +
+		"problem with <target-name> into a single archive.  The archive " +
+		"contains the newt version, project.yml, the target's files, the " +
+		"target's resolved syscfg, the installed repo versions, and a " +
+		"description of the host environment.  Passwords, tokens, and " +
+		"credentials embedded in URLs are masked.\n\n" +
+		"The archive is written to <output-file> if specified, or to " +
+		"<target-name>-support.tar.gz in the current directory otherwise."
+
+	supportBundleCmd := &cobra.Command{
+		Use:   "support-bundle <target-name> [output-file]",
+		Short: "Create an archive describing a target for bug reports",
+		Long:  supportBundleHelpText,
+		Run:   supportBundleRunCmd,
+	}
+
+	supportBundleCmd.PersistentFlags().StringVar(&supportLogFile,
+		"log", "", "Include the specified build log in the archive")
+
+	cmd.AddCommand(supportBundleCmd)
+	AddTabCompleteFn(supportBundleCmd, targetList)
+}
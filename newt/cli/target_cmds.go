@@ -42,12 +42,24 @@ import (
 
 var targetForce bool = false
 var amendDelete bool = false
+var targetShowEffective bool = false
 
 // target variables that can have values amended with the amend command.
 var amendVars = []string{"aflags", "cflags", "lflags", "syscfg"}
 
-var setVars = []string{"aflags", "app", "build_profile", "bsp", "cflags",
-	"lflags", "loader", "syscfg"}
+var setVars = []string{"aflags", "app", "build_profile", "bsp", "ccache",
+	"cflags", "image_confirm", "launcher", "lflags", "loader", "syscfg"}
+
+// Returns the "<var-name>=" strings that complete the variable argument of
+// `newt target set`.
+func setVarCompletions() []string {
+	vals := make([]string, len(setVars))
+	for i, v := range setVars {
+		vals[i] = v + "="
+	}
+
+	return vals
+}
 
 func resolveExistingTargetArg(arg string) (*target.Target, error) {
 	t := ResolveTarget(arg)
@@ -91,6 +103,51 @@ func pkgVarSliceString(pack *pkg.LocalPackage, key string) string {
 	return buffer.String()
 }
 
+// Ensures each of the specified syscfg settings is defined by a package in
+// the target.  The check is skipped if the -f option was specified, or if the
+// target is not complete enough to resolve yet.  Setting a value can pull in
+// packages that define more settings, so the check may reject a setting that
+// would have become valid; -f overrides it in that case.
+func validateSyscfgNames(t *target.Target, vals map[string]string) error {
+	if targetForce || len(vals) == 0 {
+		return nil
+	}
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		return nil
+	}
+	res, err := b.Resolve()
+	if err != nil {
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Not validating syscfg settings; target does not resolve: %s\n",
+			err.Error())
+		return nil
+	}
+
+	known := make([]string, 0, len(res.Cfg.Settings))
+	for name, _ := range res.Cfg.Settings {
+		known = append(known, name)
+	}
+
+	unknown := []string{}
+	for name, _ := range vals {
+		if _, ok := res.Cfg.Settings[name]; !ok {
+			unknown = append(unknown, name+suggestionText(name, known))
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+
+	return util.FmtNewtError(
+		"Target %s does not define the following syscfg settings:\n"+
+			"    %s\n"+
+			"Use -f to set them anyway.",
+		t.FullName(), strings.Join(unknown, "\n    "))
+}
+
 //Process amend command for syscfg target variable
 func amendSysCfg(value string, t *target.Target) error {
 
@@ -102,6 +159,11 @@ func amendSysCfg(value string, t *target.Target) error {
 	if err != nil {
 		return err
 	}
+	if !amendDelete {
+		if err := validateSyscfgNames(t, amendSysVals); err != nil {
+			return err
+		}
+	}
 	// Have current syscfg.vals in syscfg.yml file
 	if sysVals != nil {
 		// Either delete syscfg variable or replace with new value
@@ -194,6 +256,17 @@ func targetShowCmd(cmd *cobra.Command, args []string) {
 
 	sort.Strings(targetNames)
 
+	if targetShowEffective {
+		for _, name := range targetNames {
+			if err := targetShowEffectiveVals(
+				target.GetTargets()[name]); err != nil {
+
+				NewtUsage(nil, err)
+			}
+		}
+		return
+	}
+
 	for _, name := range targetNames {
 		kvPairs := map[string]string{}
 
@@ -226,6 +299,68 @@ func targetShowCmd(cmd *cobra.Command, args []string) {
 	}
 }
 
+// Displays the values the build will actually use for the specified target,
+// i.e., after the BSP, app, compiler, and build profile have been applied and
+// all syscfg overrides have been processed.
+func targetShowEffectiveVals(t *target.Target) error {
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		return err
+	}
+
+	res, err := b.Resolve()
+	if err != nil {
+		return err
+	}
+
+	if errText := res.ErrorText(); errText != "" {
+		return util.NewNewtError(errText)
+	}
+
+	ci, err := b.EffectiveCompilerInfo()
+	if err != nil {
+		return err
+	}
+
+	kvPairs := map[string]string{}
+	for k, v := range t.Vars {
+		kvPairs[strings.TrimPrefix(k, "target.")] = v
+	}
+	kvPairs["compiler"] = b.GetCompilerPkg().FullName()
+	kvPairs["cflags"] = strings.Join(ci.Cflags, " ")
+	kvPairs["lflags"] = strings.Join(ci.Lflags, " ")
+	kvPairs["aflags"] = strings.Join(ci.Aflags, " ")
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "%s\n", t.FullName())
+
+	keys := []string{}
+	for k, _ := range kvPairs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if len(kvPairs[k]) > 0 {
+			util.StatusMessage(util.VERBOSITY_DEFAULT, "    %s=%s\n",
+				k, kvPairs[k])
+		}
+	}
+
+	vals := res.Cfg.SettingValues()
+	names := make([]string, 0, len(vals))
+	for k, _ := range vals {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "    syscfg:\n")
+	for _, name := range names {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "        %s=%s\n",
+			name, vals[name])
+	}
+
+	return nil
+}
+
 func targetCmakeCmd(cmd *cobra.Command, args []string) {
 	TryGetProject()
 
@@ -241,7 +376,9 @@ func targetCmakeCmd(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	builder.CMakeTargetGenerate(targets[0])
+	if err := builder.CMakeTargetGenerate(targets[0]); err != nil {
+		NewtUsage(nil, err)
+	}
 }
 
 func targetSetCmd(cmd *cobra.Command, args []string) {
@@ -254,7 +391,7 @@ func targetSetCmd(cmd *cobra.Command, args []string) {
 	TryGetProject()
 
 	// Parse target name.
-	t, err := resolveExistingTargetArg(args[0])
+	t, err := resolveLocalTarget(args[0])
 	if err != nil {
 		NewtUsage(cmd, err)
 	}
@@ -274,8 +411,8 @@ func targetSetCmd(cmd *cobra.Command, args []string) {
 		}
 
 		if !supported {
-			NewtUsage(cmd,
-				util.NewNewtError("Not a valid variable: "+key))
+			NewtUsage(cmd, util.NewNewtError("Not a valid variable: "+
+				key+suggestionText(key, setVars)))
 		}
 		if !strings.HasPrefix(kv[0], "target.") {
 			kv[0] = "target." + kv[0]
@@ -300,11 +437,15 @@ func targetSetCmd(cmd *cobra.Command, args []string) {
 		// A few variables are special cases; they get set in the base package
 		// instead of the target.
 		if kv[0] == "target.syscfg" {
-			t.Package().SyscfgY = ycfg.YCfg{}
 			kv, err := syscfg.KeyValueFromStr(kv[1])
 			if err != nil {
 				NewtUsage(cmd, err)
 			}
+			if err := validateSyscfgNames(t, kv); err != nil {
+				NewtUsage(nil, err)
+			}
+
+			t.Package().SyscfgY = ycfg.YCfg{}
 
 			t.Package().SyscfgY.Replace("syscfg.vals", kv)
 		} else if kv[0] == "target.cflags" ||
@@ -355,7 +496,7 @@ func targetAmendCmd(cmd *cobra.Command, args []string) {
 	TryGetProject()
 
 	// Parse target name.
-	t, err := resolveExistingTargetArg(args[0])
+	t, err := resolveLocalTarget(args[0])
 	if err != nil {
 		NewtUsage(cmd, err)
 	}
@@ -374,8 +515,8 @@ func targetAmendCmd(cmd *cobra.Command, args []string) {
 			}
 		}
 		if !valid {
-			NewtUsage(cmd,
-				util.NewNewtError("Cannot amend values for "+kv[0]))
+			NewtUsage(cmd, util.NewNewtError("Cannot amend values for "+
+				kv[0]+suggestionText(kv[0], amendVars)))
 		}
 
 		if len(kv) == 1 {
@@ -448,6 +589,12 @@ func targetCreateCmd(cmd *cobra.Command, args []string) {
 }
 
 func targetDelOne(t *target.Target) error {
+	if r := t.Package().Repo(); !r.IsLocal() {
+		return util.FmtNewtError(
+			"Target %s is maintained in repo \"%s\" and cannot be deleted",
+			t.FullName(), r.Name())
+	}
+
 	if !targetForce {
 		// Determine if the target directory contains extra user files.  If it
 		// does, a prompt (or force) is required to delete it.
@@ -821,6 +968,59 @@ func targetConfigInitCmd(cmd *cobra.Command, args []string) {
 	}
 }
 
+func targetMigrateCmd(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		NewtUsage(cmd, util.NewNewtError("Must specify target name"))
+	}
+
+	TryGetProject()
+
+	for _, arg := range args {
+		t, err := resolveExistingTargetArg(arg)
+		if err != nil {
+			NewtUsage(cmd, err)
+		}
+
+		b, err := builder.NewTargetBuilder(t)
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+
+		res, err := b.Resolve()
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+
+		vals := t.Package().SyscfgY.GetValStringMapString("syscfg.vals", nil)
+		mr := res.Cfg.MigrateVals(vals)
+
+		for _, m := range mr.Migrations {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"Target %s: migrated %s --> %s (value: %s)\n",
+				t.FullName(), m.OldName, m.NewName, m.Value)
+		}
+
+		if len(mr.Migrations) > 0 {
+			t.Package().SyscfgY.Replace("syscfg.vals", mr.Vals)
+			if err := t.Save(); err != nil {
+				NewtUsage(nil, err)
+			}
+		} else {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"Target %s: no settings to migrate\n", t.FullName())
+		}
+
+		if len(mr.Problems) > 0 {
+			util.StatusMessage(util.VERBOSITY_QUIET,
+				"Target %s: settings requiring manual attention:\n",
+				t.FullName())
+			for _, p := range mr.Problems {
+				util.StatusMessage(util.VERBOSITY_QUIET, "    %s\n", p)
+			}
+		}
+	}
+}
+
 func targetDepCmd(cmd *cobra.Command, args []string) {
 	if len(args) < 1 {
 		NewtUsage(cmd,
@@ -937,11 +1137,20 @@ func AddTargetCommands(cmd *cobra.Command) {
 		Example: showHelpEx,
 		Run:     targetShowCmd,
 	}
+	showCmd.PersistentFlags().BoolVarP(&targetShowEffective,
+		"effective", "e", false,
+		"Show the values the build will use, including inherited "+
+			"compiler flags and all syscfg settings")
 	targetCmd.AddCommand(showCmd)
 	AddTabCompleteFn(showCmd, targetList)
 
 	cmakeHelpText := "Generate CMakeLists.txt for target specified " +
-		"by <target-name>."
+		"by <target-name>.\n\n" +
+		"The fully resolved target is exported at the top of the " +
+		"project: a library per package, with each source file compiled " +
+		"with the same flags and defines as `newt build`, and an " +
+		"executable linked with the BSP's linker scripts.  The target's " +
+		"syscfg and sysinit files are generated as part of the export."
 	cmakeHelpEx := "  newt target cmake <target-name>\n"
 	cmakeHelpEx += "  newt target cmake my_target1"
 
@@ -977,8 +1186,12 @@ func AddTargetCommands(cmd *cobra.Command) {
 		Example: setHelpEx,
 		Run:     targetSetCmd,
 	}
+	setCmd.PersistentFlags().BoolVarP(&targetForce, "force", "f", false,
+		"Allow syscfg settings that the target does not define")
 	targetCmd.AddCommand(setCmd)
-	AddTabCompleteFn(setCmd, targetList)
+	AddTabCompleteFn(setCmd, func() []string {
+		return append(targetList(), setVarCompletions()...)
+	})
 
 	amendHelpText := "Add, change, or delete values for multi-value target variables\n\n"
 	amendHelpText += "Variables that can have values amended are:\n"
@@ -1004,6 +1217,8 @@ func AddTargetCommands(cmd *cobra.Command) {
 	}
 	amendCmd.Flags().BoolVarP(&amendDelete, "delete", "d", false,
 		"Delete Variable values")
+	amendCmd.Flags().BoolVarP(&targetForce, "force", "f", false,
+		"Allow syscfg settings that the target does not define")
 	targetCmd.AddCommand(amendCmd)
 	AddTabCompleteFn(amendCmd, targetList)
 
@@ -1105,6 +1320,23 @@ func AddTargetCommands(cmd *cobra.Command) {
 		return append(targetList(), unittestList()...)
 	})
 
+	migrateHelpText := "Rewrite a target's syscfg overrides such that " +
+		"they refer to current setting names.  Overrides of renamed " +
+		"settings are moved to the replacement setting.  Overrides which " +
+		"cannot be migrated automatically are reported."
+	migrateHelpEx := "  newt target migrate my_target1"
+
+	migrateCmd := &cobra.Command{
+		Use:     "migrate <target> [target...]",
+		Short:   "Migrate a target's syscfg overrides to current setting names",
+		Long:    migrateHelpText,
+		Example: migrateHelpEx,
+		Run:     targetMigrateCmd,
+	}
+
+	targetCmd.AddCommand(migrateCmd)
+	AddTabCompleteFn(migrateCmd, targetList)
+
 	depHelpText := "View a target's dependency graph."
 
 	depCmd := &cobra.Command{
@@ -26,6 +26,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
@@ -46,6 +47,9 @@ const MFG_DEFAULT_DIR string = "mfgs"
 
 func NewtUsage(cmd *cobra.Command, err error) {
 	if err != nil {
+		// Show what was accomplished before the failure.
+		newtutil.PrintSummary()
+
 		sErr := err.(*util.NewtError)
 		log.Debugf("%s", sErr.StackTrace)
 		fmt.Fprintf(os.Stderr, "Error: %s\n", sErr.Text)
@@ -59,6 +63,16 @@ func NewtUsage(cmd *cobra.Command, err error) {
 	os.Exit(1)
 }
 
+// Converts an absolute path within the project to a project-relative one.
+// Other paths are returned unchanged.
+func relativeToProject(path string) string {
+	rel, err := filepath.Rel(TryGetProject().Path(), path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
 // Display help text with a max line width of 79 characters
 func FormatHelp(text string) string {
 	// first compress all new lines and extra spaces
@@ -95,12 +109,29 @@ func ResolveTarget(name string) *target.Target {
 		return t
 	}
 
-	// Check each repo alphabetically.
 	fullNames := []string{}
 	for fullName, _ := range targetMap {
 		fullNames = append(fullNames, fullName)
 	}
-	for _, fullName := range util.SortFields(fullNames...) {
+	fullNames = util.SortFields(fullNames...)
+
+	// Check the repos listed in `project.target_repos`, in order.
+	for _, repoName := range project.GetProject().TargetRepos() {
+		prefix := newtutil.BuildPackageString(repoName, "")
+		if t := targetMap[prefix+TARGET_DEFAULT_DIR+"/"+name]; t != nil {
+			return t
+		}
+		for _, fullName := range fullNames {
+			if strings.HasPrefix(fullName, prefix) &&
+				name == filepath.Base(fullName) {
+
+				return targetMap[fullName]
+			}
+		}
+	}
+
+	// Check each repo alphabetically.
+	for _, fullName := range fullNames {
 		if name == filepath.Base(fullName) {
 			return targetMap[fullName]
 		}
@@ -109,6 +140,25 @@ func ResolveTarget(name string) *target.Target {
 	return nil
 }
 
+// Resolves a target that is about to be modified.  Targets belonging to a
+// dependency repo are maintained upstream and get overwritten when the repo is
+// upgraded, so they must be copied into the project before they are changed.
+func resolveLocalTarget(name string) (*target.Target, error) {
+	t := ResolveTarget(name)
+	if t == nil {
+		return nil, util.NewNewtError("Unknown target: " + name)
+	}
+
+	if r := t.Package().Repo(); !r.IsLocal() {
+		return nil, util.FmtNewtError(
+			"Target %s is maintained in repo \"%s\"; use \"newt target "+
+				"copy\" to create a local copy before modifying it",
+			t.FullName(), r.Name())
+	}
+
+	return t, nil
+}
+
 // Resolves a list of target names and checks for the optional "all" keyword
 // among them.  Regardless of whether "all" is specified, all target names must
 // be valid, or an error is reported.
@@ -351,3 +401,120 @@ func PromptYesNo(dflt bool) bool {
 
 	return dflt
 }
+
+// Calculates the Levenshtein distance between two strings.
+func editDistance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+type nameSuggestion struct {
+	name string
+	dist int
+}
+
+type nameSuggestionSorter []nameSuggestion
+
+func (s nameSuggestionSorter) Len() int      { return len(s) }
+func (s nameSuggestionSorter) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s nameSuggestionSorter) Less(i, j int) bool {
+	if s[i].dist != s[j].dist {
+		return s[i].dist < s[j].dist
+	}
+	return s[i].name < s[j].name
+}
+
+// Finds the candidates that closely resemble a misspelled name.  Comparisons
+// are case-insensitive.
+//
+// @return []string             Up to three suggestions, closest first.
+func suggestNames(name string, candidates []string) []string {
+	maxDist := len(name) / 3
+	if maxDist < 2 {
+		maxDist = 2
+	}
+
+	matches := []nameSuggestion{}
+	for _, c := range candidates {
+		dist := editDistance(strings.ToUpper(name), strings.ToUpper(c))
+		if dist <= maxDist {
+			matches = append(matches, nameSuggestion{c, dist})
+		}
+	}
+	sort.Sort(nameSuggestionSorter(matches))
+
+	names := []string{}
+	for i := 0; i < len(matches) && i < 3; i++ {
+		names = append(names, matches[i].name)
+	}
+
+	return names
+}
+
+// Produces a "did you mean" hint for a misspelled name, or "" if there are no
+// close matches.
+func suggestionText(name string, candidates []string) string {
+	names := suggestNames(name, candidates)
+	if len(names) == 0 {
+		return ""
+	}
+
+	return "; did you mean " + strings.Join(names, " or ") + "?"
+}
+
+// Applies the command-line flag defaults specified by the selected project
+// profile.  Flags specified on the command line are left alone, as are flags
+// that the command doesn't accept.
+func ApplyProfileFlags(cmd *cobra.Command) {
+	flags, err := project.ProfileFlags()
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	names := []string{}
+	for name, _ := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := cmd.Flags().Lookup(name)
+		if f == nil {
+			log.Debugf("Profile flag --%s doesn't apply to `%s`",
+				name, cmd.CommandPath())
+			continue
+		}
+		if f.Changed {
+			continue
+		}
+
+		if err := cmd.Flags().Set(name, flags[name]); err != nil {
+			NewtUsage(nil, util.FmtNewtError(
+				"profile \"%s\" specifies invalid value for --%s: %s",
+				newtutil.NewtProfile, name, err.Error()))
+		}
+	}
+}
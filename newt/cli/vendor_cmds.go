@@ -0,0 +1,80 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/util"
+)
+
+var vendorForce bool
+
+func vendorRunCmd(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		NewtUsage(cmd, util.NewNewtError("Too many arguments"))
+	}
+
+	proj := TryGetProject()
+
+	names, err := proj.Vendor(vendorForce)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+
+	if len(names) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Project has no external repos to vendor\n")
+		return
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Vendored %d repos into %s/\n", len(names), project.VENDOR_DIR)
+	if !proj.UsesVendor() {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Add \"project.use_vendor: true\" to project.yml to build "+
+				"from the vendored copies\n")
+	}
+}
+
+func AddVendorCommands(cmd *cobra.Command) {
+	vendorHelpText := "Copy every installed external repo, without its " +
+		"version control history, into the project's \"" +
+		project.VENDOR_DIR + "\" directory.  The commit and version each " +
+		"copy was taken from are recorded in " + project.VENDOR_DIR + "/" +
+		project.VENDOR_MANIFEST_FILE_NAME + ".  If project.yml sets " +
+		"\"project.use_vendor: true\", newt uses the vendored copies " +
+		"instead of downloading the repos."
+	vendorHelpEx := "  newt vendor\n"
+	vendorHelpEx += "  newt vendor -f"
+
+	vendorCmd := &cobra.Command{
+		Use:     "vendor",
+		Short:   "Copy external repos into the project",
+		Long:    vendorHelpText,
+		Example: vendorHelpEx,
+		Run:     vendorRunCmd,
+	}
+	vendorCmd.PersistentFlags().BoolVarP(&vendorForce, "force", "f", false,
+		"Vendor repos even if they contain uncommitted changes")
+
+	cmd.AddCommand(vendorCmd)
+}
@@ -0,0 +1,229 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package cli
+
+import (
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/newt/workspace"
+	"mynewt.apache.org/newt/util"
+)
+
+func tryGetWorkspace() *workspace.Workspace {
+	wd, err := os.Getwd()
+	if err != nil {
+		NewtUsage(nil, util.ChildNewtError(err))
+	}
+
+	ws, err := workspace.Find(wd)
+	if err != nil {
+		NewtUsage(nil, err)
+	}
+	if ws == nil {
+		NewtUsage(nil, util.FmtNewtError(
+			"Not in a workspace; no %s file found",
+			workspace.WORKSPACE_FILE_NAME))
+	}
+
+	return ws
+}
+
+// Retrieves the short hash of a repo checkout's HEAD; "" if it can't be
+// determined.
+func checkoutHash(path string) string {
+	cmd := []string{"git", "-C", path, "rev-parse", "--short", "HEAD"}
+	out, err := util.ShellCommand(cmd, nil)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(out))
+}
+
+func wsStatusRunCmd(cmd *cobra.Command, args []string) {
+	ws := tryGetWorkspace()
+
+	// Repo name -> project path -> version requirement.
+	repoReqs := map[string]map[string]string{}
+	for _, p := range ws.ProjectPaths {
+		reqs, err := project.RepoVersReqs(p)
+		if err != nil {
+			NewtUsage(nil, err)
+		}
+
+		for name, vers := range reqs {
+			if repoReqs[name] == nil {
+				repoReqs[name] = map[string]string{}
+			}
+			repoReqs[name][p] = vers
+		}
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Workspace: %s\n", ws.BasePath)
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Repo store: %s\n", ws.ReposDir)
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Projects:\n")
+	for _, p := range ws.ProjectPaths {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    %s\n", ws.RelPath(p))
+	}
+
+	names := make([]string, 0, len(repoReqs))
+	for name, _ := range repoReqs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Repositories:\n")
+	for _, name := range names {
+		state := "not installed"
+		if path := ws.ReposDir + "/" + name; util.NodeExist(path) {
+			state = "installed"
+			if hash := checkoutHash(path); hash != "" {
+				state += " at " + hash
+			}
+		}
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    %s (%s)\n",
+			name, state)
+
+		distinct := map[string]bool{}
+		for _, p := range ws.ProjectPaths {
+			if vers, ok := repoReqs[name][p]; ok {
+				util.StatusMessage(util.VERBOSITY_DEFAULT, "        %s: %s\n",
+					ws.RelPath(p), vers)
+				distinct[vers] = true
+			}
+		}
+
+		// Each repo has a single checkout, so differing requirements can't
+		// all be honored.
+		if len(distinct) > 1 {
+			util.StatusMessage(util.VERBOSITY_QUIET,
+				"* Warning: projects specify different versions of %s; "+
+					"they share a single checkout\n", name)
+		}
+	}
+}
+
+func wsBuildRunCmd(cmd *cobra.Command, args []string) {
+	ws := tryGetWorkspace()
+
+	if len(args) == 0 {
+		args = []string{"all"}
+	}
+
+	buildArgs := []string{}
+	switch util.Verbosity {
+	case util.VERBOSITY_SILENT:
+		buildArgs = append(buildArgs, "-s")
+	case util.VERBOSITY_QUIET:
+		buildArgs = append(buildArgs, "-q")
+	case util.VERBOSITY_VERBOSE:
+		buildArgs = append(buildArgs, "-v")
+	}
+	buildArgs = append(buildArgs, "build")
+	buildArgs = append(buildArgs, args...)
+
+	newtPath, err := os.Executable()
+	if err != nil {
+		NewtUsage(nil, util.ChildNewtError(err))
+	}
+
+	// Each project is built by a separate newt process; a newt process can
+	// only load one project.
+	failed := false
+	for _, p := range ws.ProjectPaths {
+		rel := ws.RelPath(p)
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "Building project %s\n",
+			rel)
+
+		c := exec.Command(newtPath, buildArgs...)
+		c.Dir = p
+		c.Stdout = os.Stdout
+		c.Stderr = os.Stderr
+		if err := c.Run(); err != nil {
+			failed = true
+			newtutil.SummaryAdd("Projects failed", "%s", rel)
+		} else {
+			newtutil.SummaryAdd("Projects built", "%s", rel)
+		}
+	}
+
+	newtutil.PrintSummary()
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func AddWorkspaceCommands(cmd *cobra.Command) {
+	wsHelpText := "Operate on every project in a workspace.  A workspace " +
+		"is a directory containing a " + workspace.WORKSPACE_FILE_NAME +
+		" file that lists several newt projects:\n\n" +
+		"    workspace.projects:\n" +
+		"        - fw/sensor-node\n" +
+		"        - fw/gateway\n\n" +
+		"The projects share a single repo store (\"repos\" in the " +
+		"workspace directory, or the directory specified by " +
+		"\"workspace.repos_dir\"), so each repo is downloaded once for all " +
+		"of them."
+
+	wsCmd := &cobra.Command{
+		Use:   "ws",
+		Short: "Manage multi-project workspaces",
+		Long:  wsHelpText,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+
+	cmd.AddCommand(wsCmd)
+
+	statusHelpText := "List the workspace's projects and the repos they " +
+		"use, along with each project's version requirement for each " +
+		"repo.  Repos for which the projects specify different versions " +
+		"are flagged."
+
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the state of the workspace's repos",
+		Long:  statusHelpText,
+		Run:   wsStatusRunCmd,
+	}
+
+	wsCmd.AddCommand(statusCmd)
+
+	buildHelpText := "Build the specified targets in each project of the " +
+		"workspace.  If no targets are specified, every target in each " +
+		"project is built."
+
+	buildCmd := &cobra.Command{
+		Use:   "build [target-1] [target-2] [...]",
+		Short: "Build targets in every project of the workspace",
+		Long:  buildHelpText,
+		Run:   wsBuildRunCmd,
+	}
+
+	wsCmd.AddCommand(buildCmd)
+}
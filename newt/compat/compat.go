@@ -242,6 +242,30 @@ func (tbl NewtCompatTable) CheckNewtVer(
 	return code, ""
 }
 
+// Determines which version of newt to upgrade to if the specified version is
+// too old.
+//
+// @return *newtutil.Version    The newt version to upgrade to; nil if the
+//                                  specified version is not too old.
+func (tbl NewtCompatTable) RequiredNewtVer(
+	newtVer newtutil.Version) *newtutil.Version {
+
+	idx := tbl.matchIdx(newtVer)
+	if idx != -1 && tbl[idx].code == NEWT_COMPAT_GOOD {
+		return nil
+	}
+
+	goodRanges := tbl.idxRangesWithCode(NEWT_COMPAT_GOOD)
+	for i := 0; i < len(goodRanges); i++ {
+		minVer, _, tgtVer := tbl.minMaxTgtVers(goodRanges[i])
+		if newtutil.VerCmp(newtVer, minVer) < 0 {
+			return &tgtVer
+		}
+	}
+
+	return nil
+}
+
 type entrySorter struct {
 	entries []NewtCompatEntry
 }
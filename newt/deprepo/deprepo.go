@@ -23,7 +23,6 @@ package deprepo
 import (
 	"fmt"
 	"sort"
-	"strings"
 
 	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/repo"
@@ -42,7 +41,13 @@ type RequirementMap map[string][]newtutil.RepoVersionReq
 // Indicates an inability to find an acceptable version of a particular repo.
 type Conflict struct {
 	RepoName string
-	Filters  []Filter
+
+	// The requirements that can't all be satisfied, each with its
+	// provenance.
+	Constraints []Constraint
+
+	// Suggested changes to the project that would resolve the conflict.
+	Resolutions []string
 }
 
 // Returns a sorted slice of all constituent repo names.
@@ -231,7 +236,9 @@ func PruneMatrix(m *Matrix, repos RepoMap, rootReqs RequirementMap) error {
 	return nil
 }
 
-// Produces an error describing the specified set of repo conflicts.
+// Produces an error describing the specified set of repo conflicts.  Each
+// requirement is listed along with the chain of requirements that pulled its
+// source into the project.
 func ConflictError(conflicts []Conflict) error {
 	s := ""
 
@@ -243,13 +250,24 @@ func ConflictError(conflicts []Conflict) error {
 		s += fmt.Sprintf("    Installation of repo \"%s\" is blocked:",
 			c.RepoName)
 
-		lines := []string{}
-		for _, f := range c.Filters {
-			lines = append(lines, fmt.Sprintf("\n    %30s requires %s %s",
-				f.Name, c.RepoName, newtutil.RepoVerReqsString(f.Reqs)))
+		for _, con := range c.Constraints {
+			s += fmt.Sprintf("\n        %s", con.String())
+			for _, link := range con.Chain {
+				s += fmt.Sprintf("\n            because %s", link.String())
+			}
+		}
+
+		if len(c.Resolutions) > 0 {
+			s += "\n    Possible resolutions:"
+			for _, r := range c.Resolutions {
+				s += fmt.Sprintf("\n        * %s", r)
+			}
+		} else {
+			s += fmt.Sprintf("\n    No published versions satisfy these "+
+				"requirements together; relax a requirement in project.yml "+
+				"or ask the maintainers of the repos above to update "+
+				"their dependencies on %s.", c.RepoName)
 		}
-		sort.Strings(lines)
-		s += strings.Join(lines, "")
 	}
 
 	return util.NewNewtError("Repository conflicts:\n" + s)
@@ -307,6 +325,12 @@ func findClosestMatch(m Matrix, dg DepGraph) (VersionMap, []string) {
 //                                  conflicts preventing a perfect match from
 //                                  being returned.
 func FindAcceptableVersions(m Matrix, dg DepGraph) (VersionMap, []Conflict) {
+	if vm := resolveVersions(m, dg); vm != nil {
+		return vm, nil
+	}
+
+	// There is no acceptable set.  Find the set with the fewest conflicts so
+	// that they can be reported.
 	vm, failures := findClosestMatch(m, dg)
 	if len(failures) == 0 {
 		// No failures implies a perfect match was found.  Return it.
@@ -325,28 +349,29 @@ func FindAcceptableVersions(m Matrix, dg DepGraph) (VersionMap, []Conflict) {
 			RepoName: f,
 		}
 		for _, node := range rg[f] {
-			// Determine if this filter is responsible for any conflicts.
-			// Record the name of the filter if it applies.
-			var filterName string
-			if node.Name == rootDependencyName {
-				filterName = "project.yml"
-			} else {
-				// If the version of the repo in the closest-match version map
-				// is the same one that imposes this version requirement,
-				// include it in the conflict object.
-				if newtutil.CompareRepoVersions(vm[node.Name], node.Ver) == 0 {
-					filterName = fmt.Sprintf(
-						"%s,%s", node.Name, node.Ver.String())
-				}
+			// Determine if this requirement is responsible for any conflicts.
+			// A requirement from `project.yml` always applies; a repo's
+			// requirement applies if that version of the repo is in the
+			// closest-match version map.
+			if node.Name != rootDependencyName &&
+				newtutil.CompareRepoVersions(vm[node.Name], node.Ver) != 0 {
+
+				continue
 			}
 
-			if filterName != "" {
-				conflict.Filters = append(conflict.Filters, Filter{
-					Name: filterName,
-					Reqs: node.VerReqs,
-				})
+			con := Constraint{
+				Source:   Dependent{Name: node.Name, Ver: node.Ver},
+				RepoName: f,
+				Reqs:     node.VerReqs,
+			}
+			if !con.IsRoot() {
+				con.Chain = requirementChain(rg, vm, node.Name)
 			}
+			conflict.Constraints = append(conflict.Constraints, con)
 		}
+		sortConstraints(conflict.Constraints)
+		conflict.Resolutions = conflictResolutions(m, dg, conflict)
+
 		conflicts[i] = conflict
 	}
 
@@ -0,0 +1,252 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// deprepo: Package for resolving repo dependencies.
+package deprepo
+
+import (
+	"fmt"
+	"sort"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+)
+
+// A version requirement that one repo imposes on another, along with the
+// reason the requiring repo is part of the project.
+type Constraint struct {
+	// The repo version that imposes the requirement, or the root dependent if
+	// the requirement comes from `project.yml`.
+	Source Dependent
+
+	// The name of the repo that the requirement applies to.
+	RepoName string
+
+	// The versions of the repo that satisfy the requirement.
+	Reqs []newtutil.RepoVersionReq
+
+	// The chain of requirements that pulled the source into the project,
+	// nearest first.  Empty if the requirement comes from `project.yml`.
+	Chain []Constraint
+}
+
+func (c *Constraint) IsRoot() bool {
+	return c.Source.Name == rootDependencyName
+}
+
+func (c *Constraint) String() string {
+	if c.IsRoot() && len(c.Reqs) == 1 && c.Reqs[0].CompareType == "==" {
+		return fmt.Sprintf("project.yml pins %s to %s",
+			c.RepoName, c.Reqs[0].Ver.String())
+	}
+
+	return fmt.Sprintf("%s requires %s %s", c.Source.String(), c.RepoName,
+		newtutil.RepoVerReqsString(c.Reqs))
+}
+
+type constraintSorter struct {
+	constraints []Constraint
+}
+
+func (s constraintSorter) Len() int {
+	return len(s.constraints)
+}
+func (s constraintSorter) Swap(i, j int) {
+	s.constraints[i], s.constraints[j] = s.constraints[j], s.constraints[i]
+}
+func (s constraintSorter) Less(i, j int) bool {
+	ci := &s.constraints[i]
+	cj := &s.constraints[j]
+
+	// Requirements from `project.yml` come first.
+	if ci.IsRoot() != cj.IsRoot() {
+		return ci.IsRoot()
+	}
+	return ci.Source.String() < cj.Source.String()
+}
+
+func sortConstraints(constraints []Constraint) {
+	sort.Sort(constraintSorter{constraints})
+}
+
+// Explains why the specified repo is part of a version map: the chain of
+// requirements leading from `project.yml` to the repo, nearest first.  The
+// chain is empty if no requirement applies.
+func requirementChain(rg RevdepGraph, vm VersionMap,
+	repoName string) []Constraint {
+
+	chain := []Constraint{}
+	seen := map[string]struct{}{}
+
+	name := repoName
+	for {
+		if _, ok := seen[name]; ok {
+			break
+		}
+		seen[name] = struct{}{}
+
+		// Prefer the requirement imposed by `project.yml`; otherwise, use the
+		// first selected repo version that requires this repo.
+		var via *RevdepGraphNode
+		for i, node := range rg[name] {
+			if node.Name == rootDependencyName {
+				via = &rg[name][i]
+				break
+			}
+			ver, ok := vm[node.Name]
+			if via == nil && ok &&
+				newtutil.CompareRepoVersions(ver, node.Ver) == 0 {
+
+				via = &rg[name][i]
+			}
+		}
+		if via == nil {
+			break
+		}
+
+		chain = append(chain, Constraint{
+			Source:   Dependent{Name: via.Name, Ver: via.Ver},
+			RepoName: name,
+			Reqs:     via.VerReqs,
+		})
+
+		if via.Name == rootDependencyName {
+			break
+		}
+		name = via.Name
+	}
+
+	return chain
+}
+
+// Returns the versions in the specified slice that satisfy every constraint.
+func satisfyingVers(vers []newtutil.RepoVersion,
+	constraints []Constraint) []newtutil.RepoVersion {
+
+	good := []newtutil.RepoVersion{}
+	for _, v := range vers {
+		ok := true
+		for _, c := range constraints {
+			if !v.SatisfiesAll(c.Reqs) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			good = append(good, v)
+		}
+	}
+
+	return good
+}
+
+// Suggests a change to the project that removes the specified constraint from
+// a conflict, or "" if there is no such change.  Only the conflicting repo's
+// other constraints are considered, so a suggested change can introduce
+// conflicts elsewhere.
+//
+// @param m                     The version matrix; versions are taken from
+//                                  its unfiltered rows.
+// @param dg                    The repo dependency graph.
+// @param c                     The constraint to replace.
+// @param others                The conflicting repo's remaining constraints.
+func suggestResolution(m Matrix, dg DepGraph, c Constraint,
+	others []Constraint) string {
+
+	row := m.FindRow(c.RepoName)
+	if row == nil {
+		return ""
+	}
+
+	// The conflicting repo is pinned by `project.yml`: suggest a version that
+	// satisfies everything else.
+	if c.IsRoot() {
+		good := satisfyingVers(row.AllVers, others)
+		if len(good) == 0 {
+			return ""
+		}
+		return fmt.Sprintf("change the version of %s in project.yml to %s",
+			c.RepoName, good[0].String())
+	}
+
+	// Otherwise, look for a version of the source repo that is compatible
+	// with the conflicting repo's other constraints.
+	srcRow := m.FindRow(c.Source.Name)
+	if srcRow == nil {
+		return ""
+	}
+
+	for _, v := range srcRow.AllVers {
+		if newtutil.CompareRepoVersions(v, c.Source.Ver) == 0 {
+			continue
+		}
+
+		// If a repo pulls the source in, the replacement version has to
+		// satisfy it too; a `project.yml` requirement can be changed.
+		if len(c.Chain) > 0 && !c.Chain[0].IsRoot() &&
+			!v.SatisfiesAll(c.Chain[0].Reqs) {
+
+			continue
+		}
+
+		reqs := others
+		for _, node := range dg[Dependent{c.Source.Name, v}] {
+			if node.Name == c.RepoName {
+				reqs = append(append([]Constraint{}, others...), Constraint{
+					Reqs: node.VerReqs,
+				})
+			}
+		}
+		if len(satisfyingVers(row.AllVers, reqs)) == 0 {
+			continue
+		}
+
+		if len(c.Chain) > 0 && c.Chain[0].IsRoot() {
+			return fmt.Sprintf(
+				"change the version of %s in project.yml to %s",
+				c.Source.Name, v.String())
+		} else {
+			return fmt.Sprintf("use %s %s instead of %s",
+				c.Source.Name, v.String(), c.Source.Ver.String())
+		}
+	}
+
+	return ""
+}
+
+// Suggests changes to the project that would resolve the specified conflict.
+func conflictResolutions(m Matrix, dg DepGraph, conflict Conflict) []string {
+	suggestions := []string{}
+	seen := map[string]struct{}{}
+
+	for i, c := range conflict.Constraints {
+		others := make([]Constraint, 0, len(conflict.Constraints)-1)
+		others = append(others, conflict.Constraints[:i]...)
+		others = append(others, conflict.Constraints[i+1:]...)
+
+		s := suggestResolution(m, dg, c, others)
+		if s != "" {
+			if _, ok := seen[s]; !ok {
+				seen[s] = struct{}{}
+				suggestions = append(suggestions, s)
+			}
+		}
+	}
+
+	return suggestions
+}
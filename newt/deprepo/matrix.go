@@ -40,9 +40,13 @@ type MatrixRow struct {
 	// The name of the repo that the row corresponds to.
 	RepoName string
 
-	// All normalized versions of the repo.
+	// All normalized versions of the repo that remain after filtering.
 	Vers []newtutil.RepoVersion
 
+	// All normalized versions of the repo, including those removed by
+	// filters.  This is only used during reporting.
+	AllVers []newtutil.RepoVersion
+
 	// Indicates the version of this repo currently being evaluated for
 	// conflicts.
 	VerIdx int
@@ -132,9 +136,11 @@ func (m *Matrix) AddRow(repoName string,
 			repoName)
 	}
 
+	sorted := newtutil.SortedVersionsDesc(vers)
 	m.rows = append(m.rows, MatrixRow{
 		RepoName: repoName,
-		Vers:     newtutil.SortedVersionsDesc(vers),
+		Vers:     sorted,
+		AllVers:  sorted,
 	})
 
 	return nil
@@ -0,0 +1,115 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package deprepo
+
+import (
+	"mynewt.apache.org/newt/newt/newtutil"
+)
+
+// Searches a version matrix for a set of repo versions that satisfies every
+// constraint in the dependency graph.  Repos are assigned one at a time, and
+// an assignment is abandoned as soon as it conflicts with an earlier one, so
+// large parts of the search space are never visited.
+//
+// The search visits version sets in the same order that `Matrix#Increment()`
+// does, so the result is the first acceptable set in that order.
+//
+// @param m                     Matrix containing all unpruned repo versions.
+// @param dg                    The repo dependency graph.
+//
+// @return VersionMap           An acceptable set of repo versions, or nil if
+//                                  there is no such set.
+func resolveVersions(m Matrix, dg DepGraph) VersionMap {
+	// Repos without any remaining versions are absent from the version map,
+	// just like in `Matrix#CurVersions()`.
+	rows := []MatrixRow{}
+	inMatrix := map[string]bool{}
+	for _, row := range m.rows {
+		if len(row.Vers) > 0 {
+			rows = append(rows, row)
+			inMatrix[row.RepoName] = true
+		}
+	}
+
+	vm := VersionMap{}
+
+	// Indicates whether the dependencies of the specified repo version are
+	// satisfied by the repos that have been assigned so far.  Dependencies on
+	// repos that aren't in the matrix are evaluated against the zero version.
+	depsOk := func(name string, ver newtutil.RepoVersion) bool {
+		for _, node := range dg[Dependent{name, ver}] {
+			dver, ok := vm[node.Name]
+			if !ok && inMatrix[node.Name] {
+				// Not assigned yet; checked when it is.
+				continue
+			}
+			if !dver.SatisfiesAll(node.VerReqs) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	// Indicates whether the specified repo version satisfies every assigned
+	// repo that depends on it.
+	revdepsOk := func(name string, ver newtutil.RepoVersion) bool {
+		for depName, depVer := range vm {
+			if depName == name {
+				continue
+			}
+			for _, node := range dg[Dependent{depName, depVer}] {
+				if node.Name == name && !ver.SatisfiesAll(node.VerReqs) {
+					return false
+				}
+			}
+		}
+
+		return true
+	}
+
+	// The matrix increments its first row fastest, so the last row is
+	// assigned first.
+	var assign func(idx int) bool
+	assign = func(idx int) bool {
+		if idx < 0 {
+			return true
+		}
+
+		row := rows[idx]
+		for _, ver := range row.Vers {
+			vm[row.RepoName] = ver
+			if depsOk(row.RepoName, ver) && revdepsOk(row.RepoName, ver) &&
+				assign(idx-1) {
+
+				return true
+			}
+		}
+		delete(vm, row.RepoName)
+
+		return false
+	}
+
+	if !assign(len(rows) - 1) {
+		return nil
+	}
+
+	return vm
+}
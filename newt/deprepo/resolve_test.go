@@ -0,0 +1,174 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package deprepo
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+)
+
+type testRow struct {
+	name string
+	vers []string
+}
+
+// A dependency of one repo version on another repo; e.g.,
+// {"a", "2.0.0", "b", "<1.0.0"}.
+type testDep struct {
+	name    string
+	ver     string
+	depName string
+	reqs    string
+}
+
+func mustVer(t *testing.T, s string) newtutil.RepoVersion {
+	v, err := newtutil.ParseRepoVersion(s)
+	if err != nil {
+		t.Fatalf("ParseRepoVersion(%q): %s", s, err.Error())
+	}
+	return v
+}
+
+// Formats a version map as a sorted list of "name-version" strings.
+func versionMapText(vm VersionMap) string {
+	if vm == nil {
+		return "<nil>"
+	}
+
+	ss := []string{}
+	for name, ver := range vm {
+		ss = append(ss, name+"-"+ver.String())
+	}
+	sort.Strings(ss)
+
+	return strings.Join(ss, " ")
+}
+
+func TestResolveVersions(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []testRow
+		deps []testDep
+		want string
+	}{
+		{
+			name: "no deps picks first version",
+			rows: []testRow{{"a", []string{"2.0.0", "1.0.0"}}},
+			want: "a-2.0.0",
+		},
+		{
+			name: "backtracks to older dependent",
+			rows: []testRow{
+				{"a", []string{"2.0.0", "1.0.0"}},
+				{"b", []string{"1.1.0", "0.9.0"}},
+			},
+			deps: []testDep{{"a", "2.0.0", "b", "<1.0.0"}},
+			want: "a-1.0.0 b-1.1.0",
+		},
+		{
+			name: "caret range",
+			rows: []testRow{
+				{"a", []string{"2.0.0", "1.0.0"}},
+				{"b", []string{"1.3.0", "1.2.0", "0.9.0"}},
+			},
+			deps: []testDep{{"a", "2.0.0", "b", "^1.2.0"}},
+			want: "a-2.0.0 b-1.3.0",
+		},
+		{
+			name: "tilde range backtracks dependency",
+			rows: []testRow{
+				{"a", []string{"1.0.0"}},
+				{"b", []string{"1.3.0", "1.2.5", "1.2.0"}},
+			},
+			deps: []testDep{{"a", "1.0.0", "b", "~1.2"}},
+			want: "a-1.0.0 b-1.2.5",
+		},
+		{
+			// The last row varies slowest, so c-3.0.0 is tried first.
+			name: "transitive follows matrix order",
+			rows: []testRow{
+				{"a", []string{"1.0.0"}},
+				{"b", []string{"2.0.0", "1.0.0"}},
+				{"c", []string{"3.0.0", "2.0.0"}},
+			},
+			deps: []testDep{
+				{"a", "1.0.0", "b", ">=1.0.0"},
+				{"b", "2.0.0", "c", "<3.0.0"},
+				{"b", "1.0.0", "c", ">=3.0.0"},
+			},
+			want: "a-1.0.0 b-1.0.0 c-3.0.0",
+		},
+		{
+			name: "conflict",
+			rows: []testRow{
+				{"a", []string{"1.0.0"}},
+				{"b", []string{"1.0.0"}},
+			},
+			deps: []testDep{{"a", "1.0.0", "b", ">=2.0.0"}},
+			want: "<nil>",
+		},
+		{
+			name: "repo outside matrix is zero version",
+			rows: []testRow{{"a", []string{"1.0.0"}}},
+			deps: []testDep{{"a", "1.0.0", "x", "<1.0.0"}},
+			want: "a-1.0.0",
+		},
+		{
+			name: "empty row is skipped",
+			rows: []testRow{
+				{"a", []string{"1.0.0"}},
+				{"b", nil},
+			},
+			want: "a-1.0.0",
+		},
+	}
+
+	for _, tc := range tests {
+		m := Matrix{}
+		for _, r := range tc.rows {
+			row := MatrixRow{RepoName: r.name}
+			for _, v := range r.vers {
+				row.Vers = append(row.Vers, mustVer(t, v))
+			}
+			m.rows = append(m.rows, row)
+		}
+
+		dg := DepGraph{}
+		for _, d := range tc.deps {
+			reqs, err := newtutil.ParseRepoVersionReqs(d.reqs)
+			if err != nil {
+				t.Fatalf("%s: %s", tc.name, err.Error())
+			}
+			dep := Dependent{Name: d.name, Ver: mustVer(t, d.ver)}
+			dg[dep] = append(dg[dep], DepGraphNode{
+				Name:    d.depName,
+				VerReqs: reqs,
+			})
+		}
+
+		got := versionMapText(resolveVersions(m, dg))
+		if got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
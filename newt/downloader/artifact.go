@@ -0,0 +1,172 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package downloader
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"mynewt.apache.org/newt/newt/settings"
+	"mynewt.apache.org/newt/util"
+)
+
+// A versioned binary file that a package downloads over HTTP (e.g., a
+// prebuilt library or a register map).
+type Artifact struct {
+	Url string
+
+	// Expected SHA256 digest of the file (hex).
+	Sha256 string
+
+	// Destination path, relative to the package directory.
+	Dest string
+}
+
+func fileSha256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// Indicates whether the specified file exists and has the expected digest.
+func artifactValid(path string, digest string) bool {
+	sum, err := fileSha256(path)
+	return err == nil && sum == strings.ToLower(digest)
+}
+
+// Downloads the specified URL into a temporary file in the specified
+// directory.
+func downloadArtifact(url string, dir string) (string, error) {
+	rsp, err := HttpGet(url)
+	if err != nil {
+		return "", util.FmtNewtError(
+			"Failed to download %s: %s", url, err.Error())
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return "", util.FmtNewtError(
+			"Failed to download %s: %s", url, rsp.Status)
+	}
+
+	f, err := ioutil.TempFile(dir, "download")
+	if err != nil {
+		return "", util.ChildNewtError(err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, rsp.Body); err != nil {
+		os.Remove(f.Name())
+		return "", util.FmtNewtError(
+			"Failed to download %s: %s", url, err.Error())
+	}
+
+	return f.Name(), nil
+}
+
+// Ensures the specified artifact is present in a package directory.  Files
+// are cached by digest, so an artifact is only downloaded once regardless of
+// how many projects use it.
+//
+// @param a                     The artifact to fetch.
+// @param pkgDir                The directory of the package that uses the
+//                                  artifact.
+//
+// @return bool                 True if the artifact was written to the
+//                                  package directory.
+func FetchArtifact(a Artifact, pkgDir string) (bool, error) {
+	dstPath := filepath.Join(pkgDir, a.Dest)
+	if artifactValid(dstPath, a.Sha256) {
+		return false, nil
+	}
+
+	cacheDir := settings.ArtifactCacheDir()
+	tmpDir := cacheDir
+	if tmpDir == "" {
+		tmpDir = os.TempDir()
+	} else if err := os.MkdirAll(cacheDir, os.ModePerm); err != nil {
+		return false, util.ChildNewtError(err)
+	}
+
+	cachePath := ""
+	if cacheDir != "" {
+		cachePath = cacheDir + "/" + strings.ToLower(a.Sha256)
+	}
+
+	srcPath := cachePath
+	if cachePath == "" || !artifactValid(cachePath, a.Sha256) {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Downloading %s\n", a.Url)
+
+		tmpPath, err := downloadArtifact(a.Url, tmpDir)
+		if err != nil {
+			return false, err
+		}
+		defer os.Remove(tmpPath)
+
+		sum, err := fileSha256(tmpPath)
+		if err != nil {
+			return false, util.ChildNewtError(err)
+		}
+		if sum != strings.ToLower(a.Sha256) {
+			return false, util.FmtNewtError(
+				"Checksum mismatch for %s: expected %s, got %s",
+				a.Url, a.Sha256, sum)
+		}
+
+		srcPath = tmpPath
+		if cachePath != "" {
+			if err := os.Rename(tmpPath, cachePath); err != nil {
+				log.Debugf("Failed to cache artifact %s: %s", a.Url,
+					err.Error())
+			} else {
+				srcPath = cachePath
+			}
+		}
+	} else {
+		log.Debugf("Using cached artifact %s for %s", cachePath, a.Url)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dstPath), os.ModePerm); err != nil {
+		return false, util.ChildNewtError(err)
+	}
+	if err := util.CopyFile(srcPath, dstPath); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,96 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package downloader
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// The user name sent with an access token when the repo doesn't specify a
+// login.  GitHub accepts a token as the password of any user.
+const TOKEN_DFLT_LOGIN = "x-access-token"
+
+// HTTP headers to send with git requests, indexed by the URL they apply to.
+// Headers are passed to git through its GIT_CONFIG_* environment variables,
+// so they never appear on a command line or in a repo's configuration.
+var gitAuthHeaders = map[string]string{}
+
+// Indicates whether access tokens can be sent in HTTP headers.  Git releases
+// that can't read their configuration from the environment can't be given
+// the headers; with those, a token is put in the remote URL instead, like a
+// password, and removed from it once the network operation is done.
+func tokenHeadersSupported() bool {
+	return gitSupports(gitFeatConfigEnv)
+}
+
+// Registers an access token to send with every git request to the specified
+// URL.  The token is sent as the password of an HTTP basic authentication
+// header.
+//
+// @param login                 The user name to send with the token; "" for
+//                                  TOKEN_DFLT_LOGIN.
+func registerToken(url string, login string, token string) {
+	if login == "" {
+		login = TOKEN_DFLT_LOGIN
+	}
+	cred := base64.StdEncoding.EncodeToString([]byte(login + ":" + token))
+	gitAuthHeaders[url] = "Authorization: Basic " + cred
+}
+
+// Returns the environment variables that apply the registered HTTP headers.
+// Variables are numbered after any config variables already in newt's
+// environment, so the user's own settings remain in effect.
+//
+// @param mask                  Whether to replace the header values with a
+//                                  placeholder; used for logging.
+func gitAuthEnv(mask bool) []string {
+	if len(gitAuthHeaders) == 0 || !tokenHeadersSupported() {
+		return nil
+	}
+
+	urls := make([]string, 0, len(gitAuthHeaders))
+	for url, _ := range gitAuthHeaders {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+
+	base, err := strconv.Atoi(os.Getenv("GIT_CONFIG_COUNT"))
+	if err != nil || base < 0 {
+		base = 0
+	}
+
+	env := []string{}
+	for i, url := range urls {
+		header := gitAuthHeaders[url]
+		if mask {
+			header = "<header-hidden>"
+		}
+		env = append(env,
+			fmt.Sprintf("GIT_CONFIG_KEY_%d=http.%s.extraheader", base+i, url),
+			fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", base+i, header))
+	}
+	env = append(env, fmt.Sprintf("GIT_CONFIG_COUNT=%d", base+len(urls)))
+
+	return env
+}
@@ -0,0 +1,388 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package downloader
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/settings"
+	"mynewt.apache.org/newt/util"
+)
+
+const AZURE_DFLT_SERVER = "dev.azure.com"
+
+// The environment variable that the Azure CLI reads a personal access token
+// from.  Used if the repo doesn't name a different variable.
+const AZURE_DFLT_PAT_ENV = "AZURE_DEVOPS_EXT_PAT"
+
+// Downloads repos hosted in Azure DevOps.  Repo URLs have the form:
+//
+//     https://dev.azure.com/<org>/<project>/_git/<repo>
+//
+// Private repos are accessed with a personal access token (PAT).  Azure
+// DevOps accepts a PAT as the password of an HTTPS request with any user name.
+type AzureDownloader struct {
+	GenericDownloader
+	Server  string
+	Org     string
+	Project string
+	Repo    string
+
+	// Personal access token for private repos.
+	Pat string
+
+	// Name of environment variable containing the personal access token.
+	// Only used if the Pat field is empty.
+	PatEnv string
+}
+
+// Splits an Azure DevOps repo URL into its server, organization, project, and
+// repo name components.
+func parseAzureUrl(s string) (string, string, string, string, error) {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return "", "", "", "", util.FmtNewtError(
+			"invalid Azure DevOps URL: %s", s)
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 4 || parts[2] != "_git" {
+		return "", "", "", "", util.FmtNewtError(
+			"invalid Azure DevOps URL: %s; expected "+
+				"https://%s/<org>/<project>/_git/<repo>", s, AZURE_DFLT_SERVER)
+	}
+
+	return u.Host, parts[0], parts[1], strings.TrimSuffix(parts[3], ".git"),
+		nil
+}
+
+func (ad *AzureDownloader) pat() string {
+	if ad.Pat != "" {
+		return ad.Pat
+	}
+
+	env := ad.PatEnv
+	if env == "" {
+		env = AZURE_DFLT_PAT_ENV
+	}
+	return os.Getenv(env)
+}
+
+// Returns the credentials portion of an authenticated URL, or "" if no access
+// token is available.
+func (ad *AzureDownloader) userInfo() string {
+	pat := ad.pat()
+	if pat == "" {
+		return ""
+	}
+
+	return url.UserPassword("pat", pat).String() + "@"
+}
+
+func (ad *AzureDownloader) remoteUrls() (string, string) {
+	server := AZURE_DFLT_SERVER
+	if ad.Server != "" {
+		server = ad.Server
+	}
+
+	path := fmt.Sprintf("%s/%s/_git/%s",
+		url.PathEscape(ad.Org), url.PathEscape(ad.Project),
+		url.PathEscape(ad.Repo))
+
+	authUrl := fmt.Sprintf("https://%s%s/%s", ad.userInfo(), server, path)
+	publicUrl := fmt.Sprintf("https://%s/%s", server, path)
+
+	return authUrl, publicUrl
+}
+
+// Adds a hint to errors that are likely caused by missing credentials.
+func (ad *AzureDownloader) authHint(err error) error {
+	if err == nil || ad.pat() != "" {
+		return err
+	}
+
+	env := ad.PatEnv
+	if env == "" {
+		env = AZURE_DFLT_PAT_ENV
+	}
+	return util.FmtNewtError("%s\nIf %s/%s is private, set the %s "+
+		"environment variable to a personal access token", err.Error(),
+		ad.Org, ad.Repo, env)
+}
+
+func (ad *AzureDownloader) setOriginUrl(path string, remoteUrl string) error {
+	// Hide the access token in the logged command.
+	safeUrl := remoteUrl
+	if ui := ad.userInfo(); ui != "" {
+		safeUrl = strings.Replace(safeUrl, ui, "pat:<token-hidden>@", -1)
+	}
+	util.LogShellCmd(setRemoteUrlCmd(ad.RemoteName(), safeUrl), nil)
+
+	return setRemoteUrl(path, ad.RemoteName(), remoteUrl, false)
+}
+
+func (ad *AzureDownloader) clearRemoteAuth(path string) error {
+	url, publicUrl := ad.remoteUrls()
+	if url == publicUrl {
+		return nil
+	}
+
+	return ad.setOriginUrl(path, publicUrl)
+}
+
+func (ad *AzureDownloader) setRemoteAuth(path string) error {
+	url, publicUrl := ad.remoteUrls()
+	if url == publicUrl {
+		return nil
+	}
+
+	return ad.setOriginUrl(path, url)
+}
+
+func (ad *AzureDownloader) authenticatedCommand(path string,
+	args []string) ([]byte, error) {
+
+	if err := ad.setRemoteAuth(path); err != nil {
+		return nil, err
+	}
+	defer ad.clearRemoteAuth(path)
+
+	return executeGitNetCommand(path, args, true)
+}
+
+func (ad *AzureDownloader) fetch(repoDir string) error {
+	return ad.cachedFetch(func() error {
+		util.StatusMessage(util.VERBOSITY_VERBOSE, "Fetching repo %s\n",
+			ad.Repo)
+
+		refreshMirror(ad.remoteUrls())
+
+		if err := ad.setRemoteAuth(repoDir); err != nil {
+			return err
+		}
+		defer ad.clearRemoteAuth(repoDir)
+
+		_, publicUrl := ad.remoteUrls()
+		return ad.authHint(ad.fetchFromUrls(repoDir, ad.RemoteName(),
+			remoteUrl{url: publicUrl, display: publicUrl},
+			mirrorRemoteUrls(ad.Mirrors)))
+	})
+}
+
+func (ad *AzureDownloader) FetchFile(
+	path string, filename string, dstDir string) error {
+
+	if err := ad.fetch(path); err != nil {
+		return err
+	}
+
+	if err := ad.fetchPullRef(path, ad.GetCommit(),
+		func(args []string) ([]byte, error) {
+			return ad.authenticatedCommand(path, args)
+		}); err != nil {
+
+		return err
+	}
+
+	return showFile(path, ad.RemoteName(), ad.GetCommit(), filename, dstDir)
+}
+
+func (ad *AzureDownloader) UpdateRepo(path string, branchName string) error {
+	if err := ad.fetch(path); err != nil {
+		return err
+	}
+
+	if err := ad.fetchPullRef(path, branchName,
+		func(args []string) ([]byte, error) {
+			return ad.authenticatedCommand(path, args)
+		}); err != nil {
+
+		return err
+	}
+
+	// Ignore error, probably resulting from a branch not available at origin
+	// anymore.
+	merge(path, ad.RemoteName(), branchName, &ad.Submodules)
+
+	if err := checkout(
+		path, ad.RemoteName(), branchName, &ad.Submodules); err != nil {
+
+		return err
+	}
+
+	return ad.updateLfs(path, func(args []string) ([]byte, error) {
+		return ad.authenticatedCommand(path, args)
+	})
+}
+
+func (ad *AzureDownloader) MainBranch() string {
+	url, _ := ad.remoteUrls()
+	return ad.mainBranch(url)
+}
+
+func (ad *AzureDownloader) DownloadRepo(commit string, dstPath string) error {
+	branch := ad.MainBranch()
+
+	url, publicUrl := ad.remoteUrls()
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Downloading repository %s (commit: %s) from %s\n",
+		ad.Repo, commit, publicUrl)
+
+	if spath := ad.worktreeStore(publicUrl); spath != "" {
+		if err := ensureWorktreeStore(
+			spath, ad.RemoteName(), publicUrl); err != nil {
+
+			return ad.authHint(err)
+		}
+		fetch := func() error { return ad.fetch(spath) }
+		if err := addWorktree(spath, ad.RemoteName(), dstPath, branch,
+			ad.Subdir != "", fetch); err != nil {
+
+			return err
+		}
+	} else {
+		// Clone the repository.
+		args := []string{"-b", branch}
+		args = append(args, ad.remoteCloneArgs()...)
+		args = append(args, referenceArgs(url, publicUrl)...)
+		args = append(args, ad.sparseCloneArgs()...)
+
+		urls := append([]remoteUrl{{url: url, display: publicUrl}},
+			mirrorRemoteUrls(ad.Mirrors)...)
+		idx, err := ad.cloneFromUrls(urls, args, dstPath)
+		if err != nil {
+			return ad.authHint(err)
+		}
+
+		// The remote always refers to the primary URL.
+		if idx != 0 {
+			if err := ad.setOriginUrl(dstPath, url); err != nil {
+				ad.clearRemoteAuth(dstPath)
+				return err
+			}
+		}
+	}
+
+	defer ad.clearRemoteAuth(dstPath)
+
+	if err := ad.finishSparseClone(dstPath); err != nil {
+		return err
+	}
+
+	// Checkout the specified commit.
+	if err := ad.fetchPullRef(dstPath, commit,
+		func(args []string) ([]byte, error) {
+			return executeGitNetCommand(dstPath, args, true)
+		}); err != nil {
+
+		return err
+	}
+	if err := checkout(
+		dstPath, ad.RemoteName(), commit, &ad.Submodules); err != nil {
+
+		return err
+	}
+
+	// The remote URL still contains the credentials at this point.
+	return ad.updateLfs(dstPath, func(args []string) ([]byte, error) {
+		return executeGitNetCommand(dstPath, args, true)
+	})
+}
+
+func (ad *AzureDownloader) FixupOrigin(path string) error {
+	// Use the public URL, i.e., hide the access token.
+	_, publicUrl := ad.remoteUrls()
+
+	curUrl, err := getRemoteUrl(path, ad.RemoteName())
+	if err != nil {
+		// The remote doesn't exist; the repo was probably cloned before the
+		// remote name was configured.
+		return addRemote(path, ad.RemoteName(), publicUrl, true)
+	}
+
+	if curUrl == publicUrl {
+		return nil
+	}
+
+	warnWrongOriginUrl(ad.RemoteName(), curUrl, publicUrl)
+	return ad.setOriginUrl(path, publicUrl)
+}
+
+func (ad *AzureDownloader) CheckOrigin(path string) (string, error) {
+	_, publicUrl := ad.remoteUrls()
+	return checkOriginUrl(path, ad.RemoteName(), publicUrl), nil
+}
+
+func NewAzureDownloader() *AzureDownloader {
+	return &AzureDownloader{}
+}
+
+// Populates an Azure DevOps downloader from a repo definition.  The repo is
+// identified either by a "url" field or by the "org", "project", and "repo"
+// fields.  A personal access token can be specified in the definition or in
+// the repo's entry in $HOME/.newt/repos.yml, but keeping it in an environment
+// variable is preferable.
+func loadAzureDownloader(repoName string, repoVars map[string]string) (
+	*AzureDownloader, error) {
+
+	ad := NewAzureDownloader()
+
+	if repoVars["url"] != "" {
+		var err error
+		ad.Server, ad.Org, ad.Project, ad.Repo, err =
+			parseAzureUrl(repoVars["url"])
+		if err != nil {
+			return nil, loadError("repo \"%s\": %s", repoName, err.Error())
+		}
+	} else {
+		ad.Server = repoVars["server"]
+		ad.Org = repoVars["org"]
+		ad.Project = repoVars["project"]
+		ad.Repo = repoVars["repo"]
+
+		for _, field := range []string{"org", "project", "repo"} {
+			if repoVars[field] == "" {
+				return nil, loadError(
+					"repo \"%s\" missing required field \"%s\"",
+					repoName, field)
+			}
+		}
+	}
+
+	ad.Pat = repoVars["pat"]
+	ad.PatEnv = repoVars["pat_env"]
+
+	privRepo := settings.Newtrc().GetValStringMapString(
+		"repository."+repoName, nil)
+	if privRepo != nil {
+		if ad.Pat == "" {
+			ad.Pat = privRepo["pat"]
+		}
+		if ad.PatEnv == "" {
+			ad.PatEnv = privRepo["pat_env"]
+		}
+	}
+
+	return ad, nil
+}
@@ -0,0 +1,103 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Creates or updates a secondary checkout of a git repo, with its HEAD
+// detached at the specified commit.  The secondary checkout is a local clone
+// of the primary one, so no network access is needed as long as the primary
+// checkout contains the commit.
+//
+// @param srcPath               The path of the primary checkout.
+// @param dstPath               The path of the secondary checkout.
+// @param hash                  The commit to check out.
+func CheckoutCopy(srcPath string, dstPath string, hash string) error {
+	created := false
+	if util.NodeNotExist(dstPath) {
+		absSrc, err := filepath.Abs(srcPath)
+		if err != nil {
+			return util.ChildNewtError(err)
+		}
+		absDst, err := filepath.Abs(dstPath)
+		if err != nil {
+			return util.ChildNewtError(err)
+		}
+
+		parent := filepath.Dir(absDst)
+		if err := os.MkdirAll(parent, os.ModePerm); err != nil {
+			return util.ChildNewtError(err)
+		}
+
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Creating checkout %s from %s\n", dstPath, srcPath)
+
+		cmd := []string{"clone", "--quiet", "--no-checkout", absSrc, absDst}
+		if _, err := executeGitCommand(parent, cmd, true); err != nil {
+			os.RemoveAll(absDst)
+			return err
+		}
+		created = true
+	} else {
+		cmd := []string{"rev-parse", "HEAD"}
+		o, err := executeGitCommand(dstPath, cmd, true)
+		if err == nil && strings.TrimSpace(string(o)) == hash {
+			return nil
+		}
+
+		cmd = []string{"status", "--porcelain", "--untracked-files=no"}
+		o, err = executeGitCommand(dstPath, cmd, true)
+		if err != nil {
+			return err
+		}
+		if len(strings.TrimSpace(string(o))) > 0 {
+			return util.FmtNewtError(
+				"can't check out %s in %s; it contains local modifications",
+				hash, dstPath)
+		}
+	}
+
+	// The primary checkout may have acquired the commit since the copy was
+	// made.  Fetch all of its refs, including its remote-tracking branches.
+	cmd := []string{"cat-file", "-e", hash + "^{commit}"}
+	if _, err := executeGitCommand(dstPath, cmd, false); err != nil {
+		cmd := []string{"fetch", "--quiet", "origin",
+			"+refs/*:refs/primary/*"}
+		if _, err := executeGitCommand(dstPath, cmd, true); err != nil {
+			return err
+		}
+	}
+
+	cmd = []string{"checkout", "--quiet", "--detach", hash}
+	if _, err := executeGitCommand(dstPath, cmd, true); err != nil {
+		if created {
+			os.RemoveAll(dstPath)
+		}
+		return err
+	}
+
+	return nil
+}
@@ -22,14 +22,17 @@ package downloader
 import (
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 
+	"mynewt.apache.org/newt/newt/interfaces"
 	"mynewt.apache.org/newt/newt/settings"
 	"mynewt.apache.org/newt/util"
 )
@@ -48,19 +51,79 @@ type Downloader interface {
 	GetCommit() string
 	SetCommit(commit string)
 	DownloadRepo(commit string, dstPath string) error
-	HashFor(path string, commit string) (string, error)
-	CommitsFor(path string, commit string) ([]string, error)
 	UpdateRepo(path string, branchName string) error
-	AreChanges(path string) (bool, error)
-	CommitType(path string, commit string) (DownloaderCommitType, error)
 	FixupOrigin(path string) error
+
+	// Performs the checks of FixupOrigin without correcting anything.
+	// Returns a description of the problem with the repo's remote, or "" if
+	// the remote points to the expected URL.
+	CheckOrigin(path string) (string, error)
+
+	// Reports each submodule that is not checked out at the commit that the
+	// repo records for it.  Submodules that the repo definition skips are
+	// ignored.
+	CheckSubmodules(path string) ([]string, error)
+
+	MainBranch() string
+	RemoteName() string
+	// Records that the remote is already up to date, so that it is not
+	// fetched during this run.
+	MarkFetched()
+
+	StashChanges(path string) (bool, error)
+	RestoreChanges(path string) error
+
+	// Verifies the checked out contents of a repo against the digests in
+	// the repo's definition.
+	Verify(path string) error
+
+	Metrics() *Metrics
+	ResetMetrics()
+
+	// Reports the state of a repo that this downloader installed at the
+	// specified path.
+	State(path string) VCSState
 }
 
 type GenericDownloader struct {
 	commit string
 
-	// Whether 'origin' has been fetched during this run.
+	// If non-empty, only this subdirectory of the repo is checked out
+	// (sparse checkout).  The full history is still downloaded.
+	Subdir string
+
+	// Whether the remote has been fetched during this run.
 	fetched bool
+
+	// Pull request refs that have been fetched during this run.
+	pullRefsFetched map[string]bool
+
+	// The branch that gets checked out when the repo is first cloned.  If
+	// empty, the remote's default branch (HEAD) is detected automatically.
+	Branch string
+
+	// Cached result of default branch detection.
+	detectedBranch string
+
+	// Whether to fetch Git LFS content after checking out a commit.
+	Lfs bool
+
+	Submodules SubmoduleCfg
+
+	// Expected digests of a downloaded repo; unverified if empty.  Sha256 is
+	// a digest of the working tree's contents (see dirSha256()); Tree is the
+	// hash of the checked out commit's git tree object.
+	Sha256 string
+	Tree   string
+
+	// Alternative URLs to download the repo from if the primary one fails.
+	Mirrors []string
+
+	// The name of the remote that newt fetches from; "origin" if empty.
+	Remote string
+
+	// Network statistics gathered during this run.
+	metrics Metrics
 }
 
 type GithubDownloader struct {
@@ -78,6 +141,17 @@ type GithubDownloader struct {
 	// Name of environment variable containing the password for private repos.
 	// Only used if the Password field is empty.
 	PasswordEnv string
+
+	// Access token (fine-grained personal access token or GitHub App
+	// installation token) for private repos.  Unlike a login and password,
+	// a token is sent in an HTTP header and never stored in the repo's
+	// remote URL (unless git is too old to accept the header; see
+	// tokenHeadersSupported()).
+	Token string
+
+	// Name of environment variable containing the access token.  Only used
+	// if the Token field is empty.
+	TokenEnv string
 }
 
 type GitDownloader struct {
@@ -90,6 +164,65 @@ type LocalDownloader struct {
 
 	// Path to parent directory of repository.yml file.
 	Path string
+
+	// How the repo is made available in the project: LOCAL_LINK_NONE (copy),
+	// LOCAL_LINK_SYMLINK, or LOCAL_LINK_HARDLINK.
+	Link string
+}
+
+const (
+	LOCAL_LINK_NONE     = ""
+	LOCAL_LINK_SYMLINK  = "symlink"
+	LOCAL_LINK_HARDLINK = "hardlink"
+)
+
+// The repo types understood by LoadDownloader.
+var RepoTypes = []string{"azure", "git", "github", "local"}
+
+// Every field that may appear in a repo descriptor, regardless of type.
+var RepoFields = []string{
+	"branch",
+	"default_branch",
+	"lfs",
+	"link",
+	"login",
+	"mirrors",
+	"org",
+	"password",
+	"password_env",
+	"pat",
+	"patches",
+	"pat_env",
+	"path",
+	"project",
+	"remote",
+	"repo",
+	"root",
+	"server",
+	"sha256",
+	"subdir",
+	"submodules_recursive",
+	"submodules_shallow",
+	"submodules_skip",
+	"subtree",
+	"token",
+	"token_env",
+	"tree",
+	"type",
+	"url",
+	"user",
+	"vers",
+}
+
+// Indicates whether the specified name is a repo descriptor field.
+func IsRepoField(name string) bool {
+	for _, f := range RepoFields {
+		if f == name {
+			return true
+		}
+	}
+
+	return false
 }
 
 func gitPath() (string, error) {
@@ -102,27 +235,90 @@ func gitPath() (string, error) {
 	return filepath.ToSlash(gitPath), nil
 }
 
-func executeGitCommand(dir string, cmd []string, logCmd bool) ([]byte, error) {
-	wd, err := os.Getwd()
-	if err != nil {
-		return nil, util.NewNewtError(err.Error())
+// Global options passed to every git invocation.  Paths in git's output are
+// not escaped, regardless of the user's configuration.
+var gitGlobalOpts = []string{
+	"-c", "core.quotepath=false",
+}
+
+// Returns the environment for git subprocesses.  Git's messages are
+// translated according to the user's locale, so the C locale is forced to
+// keep the output independent of the user's language settings.  These values
+// override any inherited from newt's environment (see util.ChildEnv).
+func gitEnv() []string {
+	env := []string{"LC_ALL=C", "LANGUAGE=C"}
+	return append(env, settings.ProxyEnv()...)
+}
+
+// The maximum number of seconds a git operation may take, as specified on the
+// command line.  A negative value indicates that the "git.timeout" newtrc
+// setting applies.
+var GitTimeoutSecs int = -1
+
+// Whether per-repo progress messages are withheld.  This is set while several
+// repos are downloaded concurrently; their messages would be interleaved with
+// no indication of which repo each belongs to.
+var QuietProgress bool
+
+func gitTimeout() time.Duration {
+	secs := GitTimeoutSecs
+	if secs < 0 {
+		secs = settings.GitTimeout()
 	}
 
+	return time.Duration(secs) * time.Second
+}
+
+// Runs git in the specified directory.  The directory is passed to git with
+// the -C option rather than by changing newt's working directory, so this
+// function is safe to call from concurrent goroutines.  Commands that access
+// a remote must use executeGitNetCommand instead.
+func executeGitCommand(dir string, cmd []string, logCmd bool) ([]byte, error) {
+	return runGitCommand(dir, cmd, logCmd, false)
+}
+
+// @param auth                  Whether to send the registered access tokens.
+func runGitCommand(dir string, cmd []string, logCmd bool,
+	auth bool) ([]byte, error) {
+
 	gp, err := gitPath()
 	if err != nil {
 		return nil, err
 	}
 
-	if err := os.Chdir(dir); err != nil {
+	if _, err := os.Stat(dir); err != nil {
 		return nil, util.ChildNewtError(err)
 	}
 
-	defer os.Chdir(wd)
+	if err := requireGit(gitFeatDirOpt, "repo operations"); err != nil {
+		return nil, err
+	}
 
-	gitCmd := []string{gp}
+	gitCmd := []string{gp, "-C", dir}
+	gitCmd = append(gitCmd, gitGlobalOpts...)
 	gitCmd = append(gitCmd, cmd...)
-	output, err := util.ShellCommandLimitDbgOutput(gitCmd, nil, logCmd, -1)
+
+	env := gitEnv()
+	if auth && len(gitAuthHeaders) > 0 {
+		if logCmd {
+			// Don't reveal credentials in the log.
+			util.LogShellCmd(gitCmd, append(env, gitAuthEnv(true)...))
+			logCmd = false
+		}
+		env = append(env, gitAuthEnv(false)...)
+	}
+
+	timeout := gitTimeout()
+	start := time.Now()
+	output, err := util.ShellCommandTimeout(gitCmd, env, logCmd, -1, timeout)
 	if err != nil {
+		if timeout > 0 && time.Since(start) >= timeout {
+			return nil, util.FmtNewtError(
+				"git %s did not complete within %s; check your network and "+
+					"proxy settings, or raise the limit with --git-timeout "+
+					"or the \"git.timeout\" setting in ~/.newt/repos.yml",
+				cmd[0], timeout.String())
+		}
 		return nil, err
 	}
 
@@ -140,28 +336,134 @@ func commitExists(repoDir string, commit string) bool {
 	return err == nil
 }
 
-func initSubmodules(path string) error {
+// Controls how a repo's submodules are populated on checkout.
+type SubmoduleCfg struct {
+	// Also update submodules nested inside submodules.
+	Recursive bool
+
+	// Only fetch the commit each submodule points to, not its full history.
+	Shallow bool
+
+	// Paths of submodules that are never initialized.  A "*" entry skips
+	// all submodules.
+	Skip []string
+}
+
+func (smc *SubmoduleCfg) skipped(path string) bool {
+	for _, s := range smc.Skip {
+		if s == "*" || strings.Trim(s, "/") == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Lists the paths of the submodules declared in the repo's .gitmodules file.
+func submodulePaths(repoDir string) []string {
+	if util.NodeNotExist(repoDir + "/.gitmodules") {
+		return nil
+	}
+
 	cmd := []string{
-		"submodule",
-		"init",
+		"config",
+		"--null",
+		"--file", ".gitmodules",
+		"--get-regexp", `^submodule\..*\.path$`,
+	}
+	o, err := executeGitCommand(repoDir, cmd, true)
+	if err != nil {
+		// git config exits with status 1 if there are no matches.
+		return nil
+	}
+
+	// Each entry has the form "<key>\n<value>\0".
+	paths := []string{}
+	for _, entry := range strings.Split(string(o), "\x00") {
+		fields := strings.SplitN(entry, "\n", 2)
+		if len(fields) == 2 {
+			paths = append(paths, fields[1])
+		}
+	}
+
+	return paths
+}
+
+func (gd *GenericDownloader) CheckSubmodules(path string) ([]string, error) {
+	if util.NodeNotExist(path + "/.gitmodules") {
+		return nil, nil
 	}
 
-	_, err := executeGitCommand(path, cmd, true)
+	cmd := []string{"submodule", "status"}
+	if gd.Submodules.Recursive {
+		cmd = append(cmd, "--recursive")
+	}
+	o, err := executeGitCommand(path, cmd, true)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	// Each line has the form "<flag><hash> <path> [(<describe>)]".
+	problems := []string{}
+	for _, line := range strings.Split(string(o), "\n") {
+		if len(line) < 2 {
+			continue
+		}
+		fields := strings.Fields(line[1:])
+		if len(fields) < 2 {
+			continue
+		}
+		subPath := fields[1]
+
+		switch line[0] {
+		case '-':
+			if !gd.Submodules.skipped(subPath) {
+				problems = append(problems, fmt.Sprintf(
+					"submodule \"%s\" is not initialized", subPath))
+			}
+		case '+':
+			problems = append(problems, fmt.Sprintf(
+				"submodule \"%s\" is checked out at %s, not at its "+
+					"recorded commit",
+				subPath, fields[0]))
+		case 'U':
+			problems = append(problems, fmt.Sprintf(
+				"submodule \"%s\" has merge conflicts", subPath))
+		}
+	}
+
+	return problems, nil
 }
 
-func updateSubmodules(path string) error {
+func updateSubmodules(repoDir string, smc *SubmoduleCfg) error {
 	cmd := []string{
 		"submodule",
 		"update",
+		"--init",
 	}
+	if smc.Recursive {
+		cmd = append(cmd, "--recursive")
+	}
+	if smc.Shallow {
+		cmd = append(cmd, "--depth", "1")
+	}
+	cmd = append(cmd, "--")
 
-	_, err := executeGitCommand(path, cmd, true)
-	if err != nil {
+	numPaths := 0
+	for _, path := range submodulePaths(repoDir) {
+		if smc.skipped(path) {
+			log.Debugf("Skipping submodule %s", path)
+		} else {
+			cmd = append(cmd, path)
+			numPaths++
+		}
+	}
+
+	if numPaths == 0 {
+		return nil
+	}
+
+	if _, err := executeGitNetCommand(repoDir, cmd, true); err != nil {
 		return err
 	}
 
@@ -171,19 +473,30 @@ func updateSubmodules(path string) error {
 // checkout does checkout a branch, or create a new branch from a tag name
 // if the commit supplied is a tag. sha1 based commits have no special
 // handling and result in dettached from HEAD state.
-func checkout(repoDir string, commit string) error {
+func checkout(repoDir string, remote string, commit string,
+	smc *SubmoduleCfg) error {
+
 	var cmd []string
-	ct, err := commitType(repoDir, commit)
+	ct, err := commitType(repoDir, remote, commit)
 	if err != nil {
 		return err
 	}
 
-	full, err := fullCommitName(repoDir, commit)
+	full, err := fullCommitName(repoDir, remote, commit)
 	if err != nil {
 		return err
 	}
 
-	if ct == COMMIT_TYPE_TAG {
+	if isLinkedWorktree(repoDir) || IsPullRef(commit) {
+		// Branches are shared with other worktrees, and a pull request has
+		// no local branch; don't touch them.
+		util.StatusMessage(util.VERBOSITY_VERBOSE, "Will checkout %s\n", full)
+		cmd = []string{
+			"checkout",
+			"--detach",
+			full,
+		}
+	} else if ct == COMMIT_TYPE_TAG {
 		util.StatusMessage(util.VERBOSITY_VERBOSE, "Will create new branch %s"+
 			" from %s\n", commit, full)
 		cmd = []string{
@@ -207,10 +520,7 @@ func checkout(repoDir string, commit string) error {
 	// repo from being in a modified "(new commits)" state immediately after
 	// switching commits.  If the submodules have already been updated, this
 	// does not generate any network activity.
-	if err := initSubmodules(repoDir); err != nil {
-		return err
-	}
-	if err := updateSubmodules(repoDir); err != nil {
+	if err := updateSubmodules(repoDir, smc); err != nil {
 		return err
 	}
 
@@ -219,12 +529,19 @@ func checkout(repoDir string, commit string) error {
 
 // mergees applies upstream changes to the local copy and must be
 // preceeded by a "fetch" to achieve any meaningful result.
-func merge(repoDir string, commit string) error {
-	if err := checkout(repoDir, commit); err != nil {
+func merge(repoDir string, remote string, commit string,
+	smc *SubmoduleCfg) error {
+
+	if err := checkout(repoDir, remote, commit, smc); err != nil {
 		return err
 	}
 
-	ct, err := commitType(repoDir, commit)
+	// The checkout already put HEAD at the fetched pull request ref.
+	if IsPullRef(commit) {
+		return nil
+	}
+
+	ct, err := commitType(repoDir, remote, commit)
 	if err != nil {
 		return err
 	}
@@ -234,7 +551,7 @@ func merge(repoDir string, commit string) error {
 		ct = COMMIT_TYPE_REMOTE_BRANCH
 	}
 
-	full, err := prependCommitPrefix(commit, ct)
+	full, err := prependCommitPrefix(remote, commit, ct)
 	if err != nil {
 		return err
 	}
@@ -255,11 +572,14 @@ func merge(repoDir string, commit string) error {
 	return nil
 }
 
-func mergeBase(repoDir string, commit string) (string, error) {
+// Resolves the specified name to a commit hash.  Fails if the name does not
+// refer to a commit.
+func revParseCommit(repoDir string, commit string) (string, error) {
 	cmd := []string{
-		"merge-base",
-		commit,
-		commit,
+		"rev-parse",
+		"--verify",
+		"--quiet",
+		commit + "^{commit}",
 	}
 	o, err := executeGitCommand(repoDir, cmd, true)
 	if err != nil {
@@ -280,12 +600,14 @@ func branchExists(repoDir string, branchName string) bool {
 	return err == nil
 }
 
-func commitType(repoDir string, commit string) (DownloaderCommitType, error) {
+func commitType(repoDir string, remote string,
+	commit string) (DownloaderCommitType, error) {
+
 	if commit == "HEAD" {
 		return COMMIT_TYPE_HASH, nil
 	}
 
-	if _, err := mergeBase(repoDir, commit); err == nil {
+	if _, err := revParseCommit(repoDir, commit); err == nil {
 		// Distinguish local branch from hash.
 		if branchExists(repoDir, commit) {
 			return COMMIT_TYPE_LOCAL_BRANCH, nil
@@ -294,10 +616,10 @@ func commitType(repoDir string, commit string) (DownloaderCommitType, error) {
 		}
 	}
 
-	if _, err := mergeBase(repoDir, "origin/"+commit); err == nil {
+	if _, err := revParseCommit(repoDir, remote+"/"+commit); err == nil {
 		return COMMIT_TYPE_REMOTE_BRANCH, nil
 	}
-	if _, err := mergeBase(repoDir, "tags/"+commit); err == nil {
+	if _, err := revParseCommit(repoDir, "tags/"+commit); err == nil {
 		return COMMIT_TYPE_TAG, nil
 	}
 
@@ -305,10 +627,22 @@ func commitType(repoDir string, commit string) (DownloaderCommitType, error) {
 		"Cannot determine commit type of \"%s\"", commit)
 }
 
+// Indicates whether the working tree contains uncommitted changes to tracked
+// files.
 func areChanges(repoDir string) (bool, error) {
+	// diff-files compares stat information only, so a file that was merely
+	// touched (e.g., by a copy or a checkout on another machine) appears
+	// modified until the index is refreshed.  update-index exits with a
+	// nonzero status when there are changes; that is not an error here.
+	refresh := []string{"update-index", "-q", "--refresh"}
+	if _, err := executeGitCommand(repoDir, refresh, true); err != nil {
+		log.Debugf("git update-index --refresh: %s", err.Error())
+	}
+
 	cmd := []string{
-		"diff",
+		"diff-files",
 		"--name-only",
+		"-z",
 	}
 
 	o, err := executeGitCommand(repoDir, cmd, true)
@@ -319,10 +653,12 @@ func areChanges(repoDir string) (bool, error) {
 	return len(o) > 0, nil
 }
 
-func prependCommitPrefix(commit string, ct DownloaderCommitType) (string, error) {
+func prependCommitPrefix(remote string, commit string,
+	ct DownloaderCommitType) (string, error) {
+
 	switch ct {
 	case COMMIT_TYPE_REMOTE_BRANCH:
-		return "origin/" + commit, nil
+		return remote + "/" + commit, nil
 	case COMMIT_TYPE_TAG:
 		return "tags/" + commit, nil
 	case COMMIT_TYPE_HASH, COMMIT_TYPE_LOCAL_BRANCH:
@@ -332,30 +668,33 @@ func prependCommitPrefix(commit string, ct DownloaderCommitType) (string, error)
 	}
 }
 
-func fullCommitName(path string, commit string) (string, error) {
-	ct, err := commitType(path, commit)
+func fullCommitName(path string, remote string, commit string) (string, error) {
+	ct, err := commitType(path, remote, commit)
 	if err != nil {
 		return "", err
 	}
 
-	return prependCommitPrefix(commit, ct)
+	return prependCommitPrefix(remote, commit, ct)
 }
 
-func showFile(
-	path string, branch string, filename string, dstDir string) error {
+func showFile(path string, remote string, branch string, filename string,
+	dstDir string) error {
 
 	if err := os.MkdirAll(dstDir, os.ModePerm); err != nil {
 		return util.ChildNewtError(err)
 	}
 
-	full, err := fullCommitName(path, branch)
+	full, err := fullCommitName(path, remote, branch)
 	if err != nil {
 		return err
 	}
 
+	// The "./" prefix makes the filename relative to the specified path
+	// rather than to the top of the repo.  This matters for repos that live
+	// in a subtree of a larger git repo.
 	cmd := []string{
 		"show",
-		fmt.Sprintf("%s:%s", full, filename),
+		fmt.Sprintf("%s:./%s", full, filename),
 	}
 
 	dstPath := fmt.Sprintf("%s/%s", dstDir, filename)
@@ -374,9 +713,9 @@ func showFile(
 
 func getRemoteUrl(path string, remote string) (string, error) {
 	cmd := []string{
-		"remote",
-		"get-url",
-		remote,
+		"config",
+		"--get",
+		"remote." + remote + ".url",
 	}
 
 	o, err := executeGitCommand(path, cmd, true)
@@ -402,73 +741,416 @@ func setRemoteUrl(path string, remote string, url string, logCmd bool) error {
 	return err
 }
 
-func warnWrongOriginUrl(path string, curUrl string, goodUrl string) {
+func addRemote(path string, remote string, url string, logCmd bool) error {
+	cmd := []string{
+		"remote",
+		"add",
+		remote,
+		url,
+	}
+	_, err := executeGitCommand(path, cmd, logCmd)
+	return err
+}
+
+// Describes how the specified remote differs from the expected URL, or returns
+// "" if it doesn't.
+func checkOriginUrl(path string, remote string, goodUrl string) string {
+	curUrl, err := getRemoteUrl(path, remote)
+	if err != nil {
+		return fmt.Sprintf("remote \"%s\" does not exist", remote)
+	}
+
+	if curUrl != goodUrl {
+		return fmt.Sprintf("remote \"%s\" points to %s; expected %s",
+			remote, curUrl, goodUrl)
+	}
+
+	return ""
+}
+
+func warnWrongOriginUrl(remote string, curUrl string, goodUrl string) {
 	util.StatusMessage(util.VERBOSITY_QUIET,
-		"WARNING: Repo's \"origin\" remote points to unexpected URL: "+
+		"WARNING: Repo's \"%s\" remote points to unexpected URL: "+
 			"%s; correcting it to %s.  Repo contents may be incorrect.\n",
-		curUrl, goodUrl)
+		remote, curUrl, goodUrl)
 }
 
-func (gd *GenericDownloader) GetCommit() string {
-	return gd.commit
-}
+// Indicates whether the repo's working tree contains files tracked by Git
+// LFS.  Only the top-level .gitattributes file is inspected.
+func usesLfs(repoDir string) bool {
+	data, err := ioutil.ReadFile(repoDir + "/.gitattributes")
+	if err != nil {
+		return false
+	}
 
-func (gd *GenericDownloader) SetCommit(branch string) {
-	gd.commit = branch
+	return strings.Contains(string(data), "filter=lfs")
 }
 
-func (gd *GenericDownloader) CommitType(
-	path string, commit string) (DownloaderCommitType, error) {
+// Replaces Git LFS pointer files in the working tree with their actual
+// content.  If the repo uses LFS but LFS support is not enabled for it, the
+// user is warned that the pointer files are left in place.
+//
+// @param repoDir               The path of the repo's working tree.
+// @param gitCmd                Runs the specified git command in the repo;
+//                                  allows the caller to provide credentials.
+func (gd *GenericDownloader) updateLfs(repoDir string,
+	gitCmd func(args []string) ([]byte, error)) error {
+
+	if !usesLfs(repoDir) {
+		return nil
+	}
 
-	return commitType(path, commit)
+	if !gd.Lfs {
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"WARNING: Repo at %s uses Git LFS, but LFS support is not "+
+				"enabled for it; large files will contain LFS pointers.  "+
+				"Specify \"lfs: true\" in the repo's definition to enable "+
+				"LFS support.\n", repoDir)
+		return nil
+	}
+
+	if _, err := executeGitCommand(
+		repoDir, []string{"lfs", "version"}, true); err != nil {
+
+		return util.FmtNewtError(
+			"Repo at %s uses Git LFS, but the git-lfs extension is not "+
+				"installed; see https://git-lfs.github.com", repoDir)
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE,
+		"Fetching Git LFS content for %s\n", repoDir)
+
+	if _, err := executeGitCommand(
+		repoDir, []string{"lfs", "install", "--local"}, true); err != nil {
+
+		return err
+	}
+
+	if _, err := gitCmd([]string{"lfs", "pull"}); err != nil {
+		return err
+	}
+
+	return nil
 }
 
-func (gd *GenericDownloader) HashFor(path string, commit string) (string, error) {
-	full, err := fullCommitName(path, commit)
-	if err != nil {
-		return "", err
+// Queries the specified remote for the branch its HEAD points to.
+//
+// @return string               The default branch name; "" if it could not be
+//                                  determined.
+func remoteDefaultBranch(url string) string {
+	if !gitSupports(gitFeatSymref) {
+		log.Debugf("git too old to query the remote's default branch")
+		return ""
 	}
-	cmd := []string{"rev-parse", full}
-	o, err := executeGitCommand(path, cmd, true)
+
+	cmd := []string{"ls-remote", "--symref", url, "HEAD"}
+	o, err := executeGitNetCommand(os.TempDir(), cmd, false)
 	if err != nil {
-		return "", err
+		log.Debugf("Failed to determine default branch of remote: %s",
+			err.Error())
+		return ""
 	}
 
-	return strings.TrimSpace(string(o)), nil
+	for _, line := range strings.Split(string(o), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[0] == "ref:" && fields[2] == "HEAD" {
+			return strings.TrimPrefix(fields[1], "refs/heads/")
+		}
+	}
+
+	return ""
+}
+
+// Determines which branch to check out when the repo is first cloned.  In
+// order of preference, this is:
+//     * The branch specified in the repo definition.
+//     * The remote's default branch.
+//     * "master".
+func (gd *GenericDownloader) mainBranch(url string) string {
+	if gd.Branch != "" {
+		return gd.Branch
+	}
+
+	if gd.detectedBranch == "" {
+		gd.detectedBranch = remoteDefaultBranch(url)
+		if gd.detectedBranch == "" {
+			gd.detectedBranch = "master"
+		}
+		log.Debugf("Using default branch \"%s\"", gd.detectedBranch)
+	}
+
+	return gd.detectedBranch
 }
 
-func (gd *GenericDownloader) CommitsFor(
-	path string, commit string) ([]string, error) {
+// Restricts the working tree of a freshly cloned (--no-checkout) repo to the
+// specified subdirectory and populates it.  The sparse checkout setting is
+// stored in the repo's config, so subsequent checkouts and merges performed by
+// newt only touch the subdirectory as well.  For a linked worktree, the
+// setting and the patterns are specific to the worktree; other checkouts of
+// the same store are unaffected.
+func initSparseCheckout(repoDir string, subdir string) error {
+	subdir = strings.Trim(filepath.ToSlash(subdir), "/")
+	if subdir == "" || subdir == "." || strings.Contains(subdir, "..") {
+		return util.FmtNewtError("invalid repo subdir: \"%s\"", subdir)
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE,
+		"Configuring sparse checkout of %s\n", subdir)
+
+	cmd := []string{"config", "core.sparseCheckout", "true"}
+	if isLinkedWorktree(repoDir) {
+		if err := requireGit(gitFeatWorktreeCfg,
+			"sparse checkouts in a worktree"); err != nil {
+
+			return err
+		}
 
-	// Hash.
-	hash, err := gd.HashFor(path, commit)
+		if err := enableWorktreeConfig(repoDir); err != nil {
+			return err
+		}
+		cmd = []string{"config", "--worktree", "core.sparseCheckout", "true"}
+	}
+	if _, err := executeGitCommand(repoDir, cmd, true); err != nil {
+		return err
+	}
+
+	// The patterns file lives in the worktree's own git directory.
+	cmd = []string{"rev-parse", "--git-path", "info/sparse-checkout"}
+	o, err := executeGitCommand(repoDir, cmd, true)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	patternPath := strings.TrimSpace(string(o))
+	if !filepath.IsAbs(patternPath) {
+		patternPath = repoDir + "/" + patternPath
+	}
+
+	// Always include the repository.yml file so that the repo's version
+	// information remains available in the working tree.
+	patterns := fmt.Sprintf("/%s/\n/repository.yml\n", subdir)
+	if err := os.MkdirAll(filepath.Dir(patternPath), os.ModePerm); err != nil {
+		return util.ChildNewtError(err)
+	}
+	if err := ioutil.WriteFile(patternPath,
+		[]byte(patterns), 0644); err != nil {
+
+		return util.ChildNewtError(err)
+	}
+
+	cmd = []string{"read-tree", "-mu", "HEAD"}
+	if _, err := executeGitCommand(repoDir, cmd, true); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Returns the extra "git clone" arguments needed for a sparse checkout.  The
+// working tree gets populated by initSparseCheckout() after the clone.
+func (gd *GenericDownloader) sparseCloneArgs() []string {
+	if gd.Subdir == "" {
+		return nil
 	}
 
-	// Branches and tags.
+	return []string{"--no-checkout"}
+}
+
+// Performs the post-clone step of a sparse checkout, if one was requested.
+func (gd *GenericDownloader) finishSparseClone(repoDir string) error {
+	if gd.Subdir == "" {
+		return nil
+	}
+
+	return initSparseCheckout(repoDir, gd.Subdir)
+}
+
+// Converts a repo URL to the name of its directory in the mirror cache.
+func mirrorName(url string) string {
+	if i := strings.Index(url, "://"); i != -1 {
+		url = url[i+3:]
+	}
+	url = strings.TrimSuffix(url, ".git")
+
+	name := []byte(url)
+	for i, c := range name {
+		isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+			(c >= '0' && c <= '9')
+		if !isAlnum && c != '.' && c != '-' {
+			name[i] = '_'
+		}
+	}
+
+	return string(name) + ".git"
+}
+
+// Returns the path of the specified repo's mirror in the shared cache, or ""
+// if the cache is disabled.
+func mirrorPath(publicUrl string) string {
+	dir := settings.GitCacheDir()
+	if dir == "" {
+		return ""
+	}
+
+	return dir + "/" + mirrorName(publicUrl)
+}
+
+// Creates or refreshes the cached mirror of the specified repo.  The mirror
+// has no configured remote so that credentials are never written to disk; the
+// (possibly authenticated) fetch URL is only passed on the command line.
+//
+// @return string               The mirror path on success; "" if the cache
+//                                  is disabled or the mirror could not be
+//                                  updated.
+func updateMirror(url string, publicUrl string) string {
+	mpath := mirrorPath(publicUrl)
+	if mpath == "" {
+		return ""
+	}
+
+	if util.NodeNotExist(mpath) {
+		if err := os.MkdirAll(filepath.Dir(mpath), os.ModePerm); err != nil {
+			log.Debugf("Failed to create git cache directory: %s",
+				err.Error())
+			return ""
+		}
+
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Creating cached mirror of %s\n", publicUrl)
+
+		cmd := []string{"init", "--bare", "--quiet", mpath}
+		if _, err := executeGitCommand(
+			filepath.Dir(mpath), cmd, true); err != nil {
+
+			util.StatusMessage(util.VERBOSITY_VERBOSE,
+				"Failed to create cached mirror of %s: %s\n", publicUrl,
+				err.Error())
+			os.RemoveAll(mpath)
+			return ""
+		}
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE,
+		"Refreshing cached mirror of %s\n", publicUrl)
+
+	cmd := []string{"fetch", "--prune", url, "+refs/*:refs/*"}
+	if _, err := executeGitNetCommand(mpath, cmd, false); err != nil {
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Failed to refresh cached mirror of %s: %s\n", publicUrl,
+			err.Error())
+		return ""
+	}
+
+	return mpath
+}
+
+// Returns the extra "git clone" arguments needed to borrow objects from the
+// repo's cached mirror.  The clone is dissociated from the mirror, so the
+// resulting repo remains valid if the cache is deleted.
+func referenceArgs(url string, publicUrl string) []string {
+	mpath := updateMirror(url, publicUrl)
+	if mpath == "" {
+		return nil
+	}
+
+	return []string{"--reference", mpath, "--dissociate"}
+}
+
+// Refreshes the repo's cached mirror if one exists.  Failure is not an error;
+// the mirror is only an optimization.
+func refreshMirror(url string, publicUrl string) {
+	if mpath := mirrorPath(publicUrl); mpath != "" && util.NodeExist(mpath) {
+		updateMirror(url, publicUrl)
+	}
+}
+
+// Returns the name of the remote that newt fetches from.
+func (gd *GenericDownloader) RemoteName() string {
+	if gd.Remote == "" {
+		return "origin"
+	}
+
+	return gd.Remote
+}
+
+// Returns the extra "git clone" arguments needed to name the remote.
+func (gd *GenericDownloader) remoteCloneArgs() []string {
+	if gd.RemoteName() == "origin" {
+		return nil
+	}
+
+	return []string{"--origin", gd.RemoteName()}
+}
+
+func (gd *GenericDownloader) GetCommit() string {
+	return gd.commit
+}
+
+func (gd *GenericDownloader) SetCommit(branch string) {
+	gd.commit = branch
+}
+
+func (gd *GenericDownloader) State(path string) VCSState {
+	return &gitState{remote: gd.RemoteName()}
+}
+
+// Lists the short names of the branches and tags that point at the specified
+// commit hash.
+func refsPointingAt(path string, hash string) ([]string, error) {
+	if gitSupports(gitFeatPointsAt) {
+		cmd := []string{
+			"for-each-ref",
+			"--format=%(refname:short)",
+			"--points-at",
+			hash,
+		}
+		o, err := executeGitCommand(path, cmd, true)
+		if err != nil {
+			return nil, err
+		}
+
+		text := strings.TrimSpace(string(o))
+		if text == "" {
+			return nil, nil
+		}
+		return strings.Split(text, "\n"), nil
+	}
+
+	// Older gits can't filter by commit; list every ref along with the
+	// object it points to.  For annotated tags, %(*objectname) is the tagged
+	// commit.
 	cmd := []string{
 		"for-each-ref",
-		"--format=%(refname:short)",
-		"--points-at",
-		hash,
+		"--format=%(objectname) %(*objectname) %(refname:short)",
 	}
 	o, err := executeGitCommand(path, cmd, true)
 	if err != nil {
 		return nil, err
 	}
 
-	lines := []string{hash}
-	text := strings.TrimSpace(string(o))
-	if text != "" {
-		lines = append(lines, strings.Split(text, "\n")...)
+	refs := []string{}
+	for _, line := range strings.Split(string(o), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		name := fields[len(fields)-1]
+		for _, obj := range fields[:len(fields)-1] {
+			if obj == hash {
+				refs = append(refs, name)
+				break
+			}
+		}
 	}
 
-	sort.Strings(lines)
-	return lines, nil
+	return refs, nil
+}
+
+func (gd *GenericDownloader) MarkFetched() {
+	gd.fetched = true
 }
 
-// Fetches the downloader's origin remote if it hasn't been fetched yet during
+// Fetches the downloader's remote if it hasn't been fetched yet during
 // this run.
 func (gd *GenericDownloader) cachedFetch(fn func() error) error {
 	if gd.fetched {
@@ -488,8 +1170,17 @@ func (gd *GithubDownloader) fetch(repoDir string) error {
 		util.StatusMessage(util.VERBOSITY_VERBOSE, "Fetching repo %s\n",
 			gd.Repo)
 
-		_, err := gd.authenticatedCommand(repoDir, []string{"fetch", "--tags"})
-		return err
+		refreshMirror(gd.remoteUrls())
+
+		if err := gd.setRemoteAuth(repoDir); err != nil {
+			return err
+		}
+		defer gd.clearRemoteAuth(repoDir)
+
+		_, publicUrl := gd.remoteUrls()
+		return gd.fetchFromUrls(repoDir, gd.RemoteName(),
+			remoteUrl{url: publicUrl, display: publicUrl},
+			mirrorRemoteUrls(gd.Mirrors))
 	})
 }
 
@@ -511,7 +1202,7 @@ func (gd *GithubDownloader) authenticatedCommand(path string,
 	}
 	defer gd.clearRemoteAuth(path)
 
-	return executeGitCommand(path, args, true)
+	return executeGitNetCommand(path, args, true)
 }
 
 func (gd *GithubDownloader) FetchFile(
@@ -521,7 +1212,16 @@ func (gd *GithubDownloader) FetchFile(
 		return err
 	}
 
-	if err := showFile(path, gd.GetCommit(), filename, dstDir); err != nil {
+	if err := gd.fetchPullRef(path, gd.GetCommit(),
+		func(args []string) ([]byte, error) {
+			return gd.authenticatedCommand(path, args)
+		}); err != nil {
+
+		return err
+	}
+
+	if err := showFile(path, gd.RemoteName(), gd.GetCommit(), filename,
+		dstDir); err != nil {
 		return err
 	}
 
@@ -534,19 +1234,37 @@ func (gd *GithubDownloader) UpdateRepo(path string, branchName string) error {
 		return err
 	}
 
+	if err := gd.fetchPullRef(path, branchName,
+		func(args []string) ([]byte, error) {
+			return gd.authenticatedCommand(path, args)
+		}); err != nil {
+
+		return err
+	}
+
 	// Ignore error, probably resulting from a branch not available at origin
 	// anymore.
-	merge(path, branchName)
+	merge(path, gd.RemoteName(), branchName, &gd.Submodules)
+
+	if err := checkout(
+		path, gd.RemoteName(), branchName, &gd.Submodules); err != nil {
 
-	if err := checkout(path, branchName); err != nil {
 		return err
 	}
 
-	return nil
+	return gd.updateLfs(path, func(args []string) ([]byte, error) {
+		return gd.authenticatedCommand(path, args)
+	})
 }
 
-func (gd *GithubDownloader) AreChanges(path string) (bool, error) {
-	return areChanges(path)
+func (gd *GithubDownloader) token() string {
+	if gd.Token != "" {
+		return gd.Token
+	} else if gd.TokenEnv != "" {
+		return os.Getenv(gd.TokenEnv)
+	} else {
+		return ""
+	}
 }
 
 func (gd *GithubDownloader) remoteUrls() (string, string) {
@@ -556,8 +1274,18 @@ func (gd *GithubDownloader) remoteUrls() (string, string) {
 		server = gd.Server
 	}
 
+	// A token is sent in a header along with the login; it takes precedence
+	// over a password.
 	var auth string
-	if gd.Login != "" {
+	if token := gd.token(); token != "" && !tokenHeadersSupported() {
+		login := gd.Login
+		if login == "" {
+			login = TOKEN_DFLT_LOGIN
+		}
+		auth = fmt.Sprintf("%s:%s@", login, token)
+	} else if gd.Login != "" && token != "" {
+		auth = fmt.Sprintf("%s@", gd.Login)
+	} else if gd.Login != "" {
 		pw := gd.password()
 		auth = fmt.Sprintf("%s:%s@", gd.Login, pw)
 	}
@@ -572,13 +1300,14 @@ func (gd *GithubDownloader) remoteUrls() (string, string) {
 func (gd *GithubDownloader) setOriginUrl(path string, url string) error {
 	// Hide password in logged command.
 	safeUrl := url
-	pw := gd.password()
-	if pw != "" {
-		safeUrl = strings.Replace(safeUrl, pw, "<password-hidden>", -1)
+	for _, pw := range []string{gd.password(), gd.token()} {
+		if pw != "" {
+			safeUrl = strings.Replace(safeUrl, pw, "<password-hidden>", -1)
+		}
 	}
-	util.LogShellCmd(setRemoteUrlCmd("origin", safeUrl), nil)
+	util.LogShellCmd(setRemoteUrlCmd(gd.RemoteName(), safeUrl), nil)
 
-	return setRemoteUrl(path, "origin", url, false)
+	return setRemoteUrl(path, gd.RemoteName(), url, false)
 }
 
 func (gd *GithubDownloader) clearRemoteAuth(path string) error {
@@ -599,9 +1328,13 @@ func (gd *GithubDownloader) setRemoteAuth(path string) error {
 	return gd.setOriginUrl(path, url)
 }
 
+func (gd *GithubDownloader) MainBranch() string {
+	url, _ := gd.remoteUrls()
+	return gd.mainBranch(url)
+}
+
 func (gd *GithubDownloader) DownloadRepo(commit string, dstPath string) error {
-	// Currently only the master branch is supported.
-	branch := "master"
+	branch := gd.MainBranch()
 
 	url, publicUrl := gd.remoteUrls()
 
@@ -609,66 +1342,104 @@ func (gd *GithubDownloader) DownloadRepo(commit string, dstPath string) error {
 		"Downloading repository %s (commit: %s) from %s\n",
 		gd.Repo, commit, publicUrl)
 
-	gp, err := gitPath()
-	if err != nil {
-		return err
-	}
+	if spath := gd.worktreeStore(publicUrl); spath != "" {
+		if err := ensureWorktreeStore(
+			spath, gd.RemoteName(), publicUrl); err != nil {
 
-	// Clone the repository.
-	cmd := []string{
-		gp,
-		"clone",
-		"-b",
-		branch,
-		url,
-		dstPath,
-	}
+			return err
+		}
+		fetch := func() error { return gd.fetch(spath) }
+		if err := addWorktree(spath, gd.RemoteName(), dstPath, branch,
+			gd.Subdir != "", fetch); err != nil {
 
-	if util.Verbosity >= util.VERBOSITY_VERBOSE {
-		err = util.ShellInteractiveCommand(cmd, nil)
+			return err
+		}
 	} else {
-		_, err = util.ShellCommand(cmd, nil)
-	}
-	if err != nil {
-		return err
+		// Clone the repository.
+		args := []string{"-b", branch}
+		args = append(args, gd.remoteCloneArgs()...)
+		args = append(args, referenceArgs(url, publicUrl)...)
+		args = append(args, gd.sparseCloneArgs()...)
+
+		urls := append([]remoteUrl{{url: url, display: publicUrl}},
+			mirrorRemoteUrls(gd.Mirrors)...)
+		idx, err := gd.cloneFromUrls(urls, args, dstPath)
+		if err != nil {
+			return err
+		}
+
+		// The remote always refers to the primary URL.
+		if idx != 0 {
+			if err := gd.setOriginUrl(dstPath, url); err != nil {
+				gd.clearRemoteAuth(dstPath)
+				return err
+			}
+		}
 	}
 
 	defer gd.clearRemoteAuth(dstPath)
 
+	if err := gd.finishSparseClone(dstPath); err != nil {
+		return err
+	}
+
 	// Checkout the specified commit.
-	if err := checkout(dstPath, commit); err != nil {
+	if err := gd.fetchPullRef(dstPath, commit,
+		func(args []string) ([]byte, error) {
+			return executeGitNetCommand(dstPath, args, true)
+		}); err != nil {
+
 		return err
 	}
+	if err := checkout(
+		dstPath, gd.RemoteName(), commit, &gd.Submodules); err != nil {
 
-	return nil
+		return err
+	}
+
+	// The remote URL still contains the credentials at this point.
+	return gd.updateLfs(dstPath, func(args []string) ([]byte, error) {
+		return executeGitNetCommand(dstPath, args, true)
+	})
 }
 
 func (gd *GithubDownloader) FixupOrigin(path string) error {
-	curUrl, err := getRemoteUrl(path, "origin")
+	// Use the public URL, i.e., hide the login and password.
+	_, publicUrl := gd.remoteUrls()
+
+	curUrl, err := getRemoteUrl(path, gd.RemoteName())
 	if err != nil {
-		return err
+		// The remote doesn't exist; the repo was probably cloned before the
+		// remote name was configured.
+		return addRemote(path, gd.RemoteName(), publicUrl, true)
 	}
 
-	// Use the public URL, i.e., hide the login and password.
-	_, publicUrl := gd.remoteUrls()
 	if curUrl == publicUrl {
 		return nil
 	}
 
-	warnWrongOriginUrl(path, curUrl, publicUrl)
+	warnWrongOriginUrl(gd.RemoteName(), curUrl, publicUrl)
 	return gd.setOriginUrl(path, publicUrl)
 }
 
+func (gd *GithubDownloader) CheckOrigin(path string) (string, error) {
+	_, publicUrl := gd.remoteUrls()
+	return checkOriginUrl(path, gd.RemoteName(), publicUrl), nil
+}
+
 func NewGithubDownloader() *GithubDownloader {
 	return &GithubDownloader{}
 }
 
 func (gd *GitDownloader) fetch(repoDir string) error {
 	return gd.cachedFetch(func() error {
+		display := StripUrlCredentials(gd.Url)
 		util.StatusMessage(util.VERBOSITY_VERBOSE, "Fetching repo %s\n",
-			gd.Url)
-		_, err := executeGitCommand(repoDir, []string{"fetch", "--tags"}, true)
-		return err
+			display)
+		refreshMirror(gd.Url, gd.Url)
+		return gd.fetchFromUrls(repoDir, gd.RemoteName(),
+			remoteUrl{url: gd.Url, display: display},
+			mirrorRemoteUrls(gd.Mirrors))
 	})
 }
 
@@ -679,7 +1450,16 @@ func (gd *GitDownloader) FetchFile(
 		return err
 	}
 
-	if err := showFile(path, gd.GetCommit(), filename, dstDir); err != nil {
+	if err := gd.fetchPullRef(path, gd.GetCommit(),
+		func(args []string) ([]byte, error) {
+			return executeGitNetCommand(path, args, true)
+		}); err != nil {
+
+		return err
+	}
+
+	if err := showFile(path, gd.RemoteName(), gd.GetCommit(), filename,
+		dstDir); err != nil {
 		return err
 	}
 
@@ -692,72 +1472,118 @@ func (gd *GitDownloader) UpdateRepo(path string, branchName string) error {
 		return err
 	}
 
+	if err := gd.fetchPullRef(path, branchName,
+		func(args []string) ([]byte, error) {
+			return executeGitNetCommand(path, args, true)
+		}); err != nil {
+
+		return err
+	}
+
 	// Ignore error, probably resulting from a branch not available at origin
 	// anymore.
-	merge(path, branchName)
+	merge(path, gd.RemoteName(), branchName, &gd.Submodules)
+
+	if err := checkout(
+		path, gd.RemoteName(), branchName, &gd.Submodules); err != nil {
 
-	if err := checkout(path, branchName); err != nil {
 		return err
 	}
 
-	return nil
+	return gd.updateLfs(path, func(args []string) ([]byte, error) {
+		return executeGitNetCommand(path, args, true)
+	})
 }
 
-func (gd *GitDownloader) AreChanges(path string) (bool, error) {
-	return areChanges(path)
+func (gd *GitDownloader) MainBranch() string {
+	return gd.mainBranch(gd.Url)
 }
 
 func (gd *GitDownloader) DownloadRepo(commit string, dstPath string) error {
-	// Currently only the master branch is supported.
-	branch := "master"
+	branch := gd.MainBranch()
 
 	util.StatusMessage(util.VERBOSITY_DEFAULT,
-		"Downloading repository %s (commit: %s)\n", gd.Url, commit)
+		"Downloading repository %s (commit: %s)\n",
+		StripUrlCredentials(gd.Url), commit)
 
-	gp, err := gitPath()
-	if err != nil {
-		return err
-	}
+	if spath := gd.worktreeStore(gd.Url); spath != "" {
+		if err := ensureWorktreeStore(
+			spath, gd.RemoteName(), gd.Url); err != nil {
 
-	// Clone the repository.
-	cmd := []string{
-		gp,
-		"clone",
-		"-b",
-		branch,
-		gd.Url,
-		dstPath,
-	}
+			return err
+		}
+		fetch := func() error { return gd.fetch(spath) }
+		if err := addWorktree(spath, gd.RemoteName(), dstPath, branch,
+			gd.Subdir != "", fetch); err != nil {
 
-	if util.Verbosity >= util.VERBOSITY_VERBOSE {
-		err = util.ShellInteractiveCommand(cmd, nil)
+			return err
+		}
 	} else {
-		_, err = util.ShellCommand(cmd, nil)
+		// Clone the repository.
+		args := []string{"-b", branch}
+		args = append(args, gd.remoteCloneArgs()...)
+		args = append(args, referenceArgs(gd.Url, gd.Url)...)
+		args = append(args, gd.sparseCloneArgs()...)
+
+		urls := append([]remoteUrl{
+			{url: gd.Url, display: StripUrlCredentials(gd.Url)}},
+			mirrorRemoteUrls(gd.Mirrors)...)
+		idx, err := gd.cloneFromUrls(urls, args, dstPath)
+		if err != nil {
+			return err
+		}
+
+		// The remote always refers to the primary URL.
+		if idx != 0 {
+			if err := setRemoteUrl(
+				dstPath, gd.RemoteName(), gd.Url, true); err != nil {
+
+				return err
+			}
+		}
 	}
-	if err != nil {
+
+	if err := gd.finishSparseClone(dstPath); err != nil {
 		return err
 	}
 
 	// Checkout the specified commit.
-	if err := checkout(dstPath, commit); err != nil {
+	if err := gd.fetchPullRef(dstPath, commit,
+		func(args []string) ([]byte, error) {
+			return executeGitNetCommand(dstPath, args, true)
+		}); err != nil {
+
 		return err
 	}
+	if err := checkout(
+		dstPath, gd.RemoteName(), commit, &gd.Submodules); err != nil {
 
-	return nil
+		return err
+	}
+
+	return gd.updateLfs(dstPath, func(args []string) ([]byte, error) {
+		return executeGitNetCommand(dstPath, args, true)
+	})
 }
 
 func (gd *GitDownloader) FixupOrigin(path string) error {
-	curUrl, err := getRemoteUrl(path, "origin")
+	curUrl, err := getRemoteUrl(path, gd.RemoteName())
 	if err != nil {
-		return err
+		// The remote doesn't exist; the repo was probably cloned before the
+		// remote name was configured.
+		return addRemote(path, gd.RemoteName(), gd.Url, true)
 	}
 
 	if curUrl == gd.Url {
 		return nil
 	}
 
-	warnWrongOriginUrl(path, curUrl, gd.Url)
-	return setRemoteUrl(path, "origin", gd.Url, true)
+	warnWrongOriginUrl(gd.RemoteName(), curUrl, gd.Url)
+	return setRemoteUrl(path, gd.RemoteName(), gd.Url, true)
+}
+
+func (gd *GitDownloader) CheckOrigin(path string) (string, error) {
+	return checkOriginUrl(path, gd.RemoteName(), gd.Url), nil
 }
 
 func NewGitDownloader() *GitDownloader {
@@ -779,15 +1605,52 @@ func (ld *LocalDownloader) FetchFile(
 }
 
 func (ld *LocalDownloader) UpdateRepo(path string, branchName string) error {
+	if ld.Link == LOCAL_LINK_SYMLINK {
+		if dst, err := os.Readlink(path); err == nil && dst == ld.Path {
+			// Already up to date by definition.
+			return nil
+		}
+	}
+
 	os.RemoveAll(path)
 	return ld.DownloadRepo(branchName, path)
 }
 
-func (ld *LocalDownloader) AreChanges(path string) (bool, error) {
-	return areChanges(path)
+// A local repo need not be under version control; its state is reported by
+// whichever system manages the source directory.
+func (ld *LocalDownloader) State(path string) VCSState {
+	source := ""
+	if ld.Link == LOCAL_LINK_NONE {
+		source = ld.Path
+	}
+
+	return DetectVCSState(ld.Path, ld.RemoteName(), source)
 }
 
 func (ld *LocalDownloader) DownloadRepo(commit string, dstPath string) error {
+	switch ld.Link {
+	case LOCAL_LINK_SYMLINK:
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Linking local repository %s\n", ld.Path)
+		if err := os.Symlink(ld.Path, dstPath); err != nil {
+			return util.ChildNewtError(err)
+		}
+
+		// The repo is used in place; don't change its checked out commit.
+		return nil
+
+	case LOCAL_LINK_HARDLINK:
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Linking local repository %s\n", ld.Path)
+		if err := hardlinkDir(ld.Path, dstPath); err != nil {
+			return err
+		}
+
+		// The links refer to the repo's current working tree, so the repo
+		// is used at its currently checked out commit.
+		return nil
+	}
+
 	util.StatusMessage(util.VERBOSITY_DEFAULT,
 		"Downloading local repository %s\n", ld.Path)
 
@@ -795,8 +1658,16 @@ func (ld *LocalDownloader) DownloadRepo(commit string, dstPath string) error {
 		return err
 	}
 
+	// Only a git repo can be moved to the specified commit; any other repo
+	// is used at its current revision.
+	if ld.State(dstPath).Name() != "git" {
+		return nil
+	}
+
 	// Checkout the specified commit.
-	if err := checkout(dstPath, commit); err != nil {
+	if err := checkout(
+		dstPath, ld.RemoteName(), commit, &ld.Submodules); err != nil {
+
 		return err
 	}
 
@@ -807,6 +1678,52 @@ func (ld *LocalDownloader) FixupOrigin(path string) error {
 	return nil
 }
 
+func (ld *LocalDownloader) CheckOrigin(path string) (string, error) {
+	return "", nil
+}
+
+func (ld *LocalDownloader) MainBranch() string {
+	return ld.mainBranch(ld.Path)
+}
+
+// Recreates the directory tree rooted at src at dst, hard linking each
+// regular file.  Symbolic links are copied as links.
+func hardlinkDir(src string, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo,
+		err error) error {
+
+		if err != nil {
+			return util.ChildNewtError(err)
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return util.ChildNewtError(err)
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			err = os.MkdirAll(target, info.Mode().Perm())
+
+		case info.Mode()&os.ModeSymlink != 0:
+			var link string
+			link, err = os.Readlink(path)
+			if err == nil {
+				err = os.Symlink(link, target)
+			}
+
+		case info.Mode().IsRegular():
+			err = os.Link(path, target)
+		}
+
+		if err != nil {
+			return util.ChildNewtError(err)
+		}
+		return nil
+	})
+}
+
 func NewLocalDownloader() *LocalDownloader {
 	return &LocalDownloader{}
 }
@@ -816,9 +1733,147 @@ func loadError(format string, args ...interface{}) error {
 		"error loading project.yml: " + fmt.Sprintf(format, args...))
 }
 
+// Reads the repo's default branch from its definition.  Both "branch" and
+// "default_branch" are accepted.
+func repoBranch(repoVars map[string]string) string {
+	if branch := repoVars["branch"]; branch != "" {
+		return branch
+	}
+
+	return repoVars["default_branch"]
+}
+
+// Reads the repo's "lfs" setting from its definition.
+func repoLfs(repoVars map[string]string) bool {
+	lfs, _ := strconv.ParseBool(repoVars["lfs"])
+	return lfs
+}
+
+// Splits a repo definition field containing a space or comma separated list.
+func splitListVar(val string) []string {
+	return strings.FieldsFunc(val, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// Reads the repo's submodule settings from its definition:
+//     submodules_recursive: <bool>
+//     submodules_shallow: <bool>
+//     submodules_skip: <space or comma separated list of paths, or "*">
+func repoSubmoduleCfg(repoVars map[string]string) SubmoduleCfg {
+	smc := SubmoduleCfg{}
+
+	smc.Recursive, _ = strconv.ParseBool(repoVars["submodules_recursive"])
+	smc.Shallow, _ = strconv.ParseBool(repoVars["submodules_shallow"])
+	smc.Skip = splitListVar(repoVars["submodules_skip"])
+
+	return smc
+}
+
+// Returns the value of a variable that can be referenced in a repo
+// definition.  Built-in variables take precedence over environment variables.
+func lookupRepoVar(name string) (string, bool) {
+	switch name {
+	case "PROJECT_DIR":
+		if proj := interfaces.GetProject(); proj != nil {
+			return proj.Path(), true
+		}
+		return "", false
+
+	case "HOME":
+		if dir := filepath.Dir(settings.NewtrcDir()); dir != "." {
+			return dir, true
+		}
+	}
+
+	return os.LookupEnv(name)
+}
+
+// Expands ${VAR} references in the repo definition fields that specify
+// locations: url, path, user, server, org, project, and mirrors.  It is an
+// error to reference an undefined variable.  Only repo definitions from the
+// user's own project (`project.yml` and `project.local.yml`) are expanded;
+// an upstream `repository.yml` must not be able to read the user's
+// environment.
+func ExpandRepoVars(repoName string, repoVars map[string]string) (
+	map[string]string, error) {
+
+	expanded := make(map[string]string, len(repoVars))
+	for k, v := range repoVars {
+		expanded[k] = v
+	}
+
+	for _, field := range []string{
+		"url", "path", "user", "server", "org", "project", "mirrors"} {
+
+		var undefined []string
+		expanded[field] = os.Expand(repoVars[field], func(name string) string {
+			val, ok := lookupRepoVar(name)
+			if !ok {
+				undefined = append(undefined, name)
+			}
+			return val
+		})
+
+		if len(undefined) > 0 {
+			return nil, loadError(
+				"repo \"%s\" field \"%s\" references undefined "+
+					"variable(s): %s",
+				repoName, field, strings.Join(undefined, ", "))
+		}
+	}
+
+	return expanded, nil
+}
+
+// Removes the userinfo component (e.g., "user:token@") from the specified
+// URL.  Strings that are not parseable as URLs (e.g., scp-style git
+// locations) are returned unchanged.
+func StripUrlCredentials(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+
+	u.User = nil
+	return u.String()
+}
+
+// Returns the location that the specified downloader downloads from, with any
+// credentials removed.
+func PublicUrl(dl Downloader) string {
+	switch d := dl.(type) {
+	case *GitDownloader:
+		return StripUrlCredentials(d.Url)
+	case *GithubDownloader:
+		_, u := d.remoteUrls()
+		return StripUrlCredentials(u)
+	case *AzureDownloader:
+		_, u := d.remoteUrls()
+		return StripUrlCredentials(u)
+	case *LocalDownloader:
+		return d.Path
+	default:
+		return ""
+	}
+}
+
+// Creates a downloader for the specified repo definition.  The repo's URL is
+// subject to the URL rewrites in newtrc (see URL_REWRITE_KEY).
 func LoadDownloader(repoName string, repoVars map[string]string) (
 	Downloader, error) {
 
+	dl, err := newDownloader(repoName, repoVars)
+	if err != nil {
+		return nil, err
+	}
+
+	return rewriteDownloader(repoName, dl), nil
+}
+
+func newDownloader(repoName string, repoVars map[string]string) (
+	Downloader, error) {
+
 	switch repoVars["type"] {
 	case "github":
 		gd := NewGithubDownloader()
@@ -826,6 +1881,14 @@ func LoadDownloader(repoName string, repoVars map[string]string) (
 		gd.Server = repoVars["server"]
 		gd.User = repoVars["user"]
 		gd.Repo = repoVars["repo"]
+		gd.Subdir = repoVars["subdir"]
+		gd.Branch = repoBranch(repoVars)
+		gd.Lfs = repoLfs(repoVars)
+		gd.Submodules = repoSubmoduleCfg(repoVars)
+		gd.Sha256 = repoVars["sha256"]
+		gd.Tree = repoVars["tree"]
+		gd.Mirrors = splitListVar(repoVars["mirrors"])
+		gd.Remote = repoVars["remote"]
 
 		// The project.yml file can contain github access tokens and
 		// authentication credentials, but this file is probably world-readable
@@ -833,6 +1896,8 @@ func LoadDownloader(repoName string, repoVars map[string]string) (
 		gd.Login = repoVars["login"]
 		gd.Password = repoVars["password"]
 		gd.PasswordEnv = repoVars["password_env"]
+		gd.Token = repoVars["token"]
+		gd.TokenEnv = repoVars["token_env"]
 
 		// Alternatively, the user can put security material in
 		// $HOME/.newt/repos.yml.
@@ -848,9 +1913,35 @@ func LoadDownloader(repoName string, repoVars map[string]string) (
 			if gd.PasswordEnv == "" {
 				gd.PasswordEnv = privRepo["password_env"]
 			}
+			if gd.Token == "" {
+				gd.Token = privRepo["token"]
+			}
+			if gd.TokenEnv == "" {
+				gd.TokenEnv = privRepo["token_env"]
+			}
+		}
+
+		if token := gd.token(); token != "" {
+			_, publicUrl := gd.remoteUrls()
+			registerToken(publicUrl, gd.Login, token)
 		}
 		return gd, nil
 
+	case "azure":
+		ad, err := loadAzureDownloader(repoName, repoVars)
+		if err != nil {
+			return nil, err
+		}
+		ad.Subdir = repoVars["subdir"]
+		ad.Branch = repoBranch(repoVars)
+		ad.Lfs = repoLfs(repoVars)
+		ad.Submodules = repoSubmoduleCfg(repoVars)
+		ad.Sha256 = repoVars["sha256"]
+		ad.Tree = repoVars["tree"]
+		ad.Mirrors = splitListVar(repoVars["mirrors"])
+		ad.Remote = repoVars["remote"]
+		return ad, nil
+
 	case "git":
 		gd := NewGitDownloader()
 		gd.Url = repoVars["url"]
@@ -858,11 +1949,44 @@ func LoadDownloader(repoName string, repoVars map[string]string) (
 			return nil, loadError("repo \"%s\" missing required field \"url\"",
 				repoName)
 		}
+		gd.Subdir = repoVars["subdir"]
+		gd.Branch = repoBranch(repoVars)
+		gd.Lfs = repoLfs(repoVars)
+		gd.Submodules = repoSubmoduleCfg(repoVars)
+		gd.Sha256 = repoVars["sha256"]
+		gd.Tree = repoVars["tree"]
+		gd.Mirrors = splitListVar(repoVars["mirrors"])
+		gd.Remote = repoVars["remote"]
 		return gd, nil
 
 	case "local":
 		ld := NewLocalDownloader()
 		ld.Path = repoVars["path"]
+
+		// A relative path is relative to the project directory, not to
+		// newt's working directory or to the repo's checkout (which a
+		// symlink's target would be resolved against).
+		if ld.Path != "" && !filepath.IsAbs(ld.Path) {
+			base := "."
+			if proj := interfaces.GetProject(); proj != nil {
+				base = proj.Path()
+			}
+			absPath, err := filepath.Abs(filepath.Join(base, ld.Path))
+			if err != nil {
+				return nil, util.ChildNewtError(err)
+			}
+			ld.Path = filepath.ToSlash(absPath)
+		}
+		ld.Link = repoVars["link"]
+		switch ld.Link {
+		case LOCAL_LINK_NONE, LOCAL_LINK_SYMLINK, LOCAL_LINK_HARDLINK:
+		default:
+			return nil, loadError("repo \"%s\" has invalid link mode: %s",
+				repoName, ld.Link)
+		}
+		ld.Branch = repoBranch(repoVars)
+		ld.Submodules = repoSubmoduleCfg(repoVars)
+		ld.Sha256 = repoVars["sha256"]
 		return ld, nil
 
 	default:
@@ -0,0 +1,146 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package downloader
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+
+	"mynewt.apache.org/newt/util"
+)
+
+type gitVersion struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+func (v gitVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+func (v gitVersion) atLeast(o gitVersion) bool {
+	if v.Major != o.Major {
+		return v.Major > o.Major
+	}
+	if v.Minor != o.Minor {
+		return v.Minor > o.Minor
+	}
+	return v.Patch >= o.Patch
+}
+
+// A git feature that newt uses, along with the oldest git release that
+// supports it.
+type gitFeature struct {
+	Desc string
+	Ver  gitVersion
+}
+
+// Features that are missing from some git releases still found in older
+// distributions.  Newt either falls back to an alternative or reports the
+// required version when the installed git is too old.
+var (
+	gitFeatDirOpt      = gitFeature{"-C", gitVersion{1, 8, 5}}
+	gitFeatWorktree    = gitFeature{"worktree add", gitVersion{2, 5, 0}}
+	gitFeatPointsAt    = gitFeature{"--points-at", gitVersion{2, 7, 0}}
+	gitFeatSymref      = gitFeature{"ls-remote --symref", gitVersion{2, 8, 0}}
+	gitFeatStashPush   = gitFeature{"stash push", gitVersion{2, 13, 0}}
+	gitFeatWorktreeCfg = gitFeature{"config --worktree", gitVersion{2, 20, 0}}
+	gitFeatWorktreeFix = gitFeature{"worktree repair", gitVersion{2, 30, 0}}
+	gitFeatConfigEnv   = gitFeature{"GIT_CONFIG_COUNT", gitVersion{2, 31, 0}}
+)
+
+var detectedGitVer *gitVersion
+var detectedGitVerOnce sync.Once
+
+var gitVersionRe = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// Parses the output of `git --version`, e.g., "git version 2.20.1" or
+// "git version 2.33.0.windows.2".
+func parseGitVersion(s string) (gitVersion, error) {
+	m := gitVersionRe.FindStringSubmatch(s)
+	if m == nil {
+		return gitVersion{}, util.FmtNewtError(
+			"cannot parse git version string: \"%s\"", s)
+	}
+
+	v := gitVersion{}
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		v.Patch, _ = strconv.Atoi(m[3])
+	}
+
+	return v, nil
+}
+
+// Determines the version of the installed git.  The version is detected once
+// per run.  nil is returned if the version could not be determined.
+func installedGitVersion() *gitVersion {
+	detectedGitVerOnce.Do(func() {
+		gp, err := gitPath()
+		if err != nil {
+			return
+		}
+
+		o, err := util.ShellCommand([]string{gp, "--version"}, gitEnv())
+		if err != nil {
+			log.Debugf("failed to determine git version: %s", err.Error())
+			return
+		}
+
+		v, err := parseGitVersion(string(o))
+		if err != nil {
+			log.Debugf("%s", err.Error())
+			return
+		}
+
+		log.Debugf("detected git version %s", v.String())
+		detectedGitVer = &v
+	})
+
+	return detectedGitVer
+}
+
+// Indicates whether the installed git supports the specified feature.  If the
+// git version can't be determined, the feature is assumed to be supported.
+func gitSupports(feat gitFeature) bool {
+	v := installedGitVersion()
+	return v == nil || v.atLeast(feat.Ver)
+}
+
+// Returns an error if the installed git does not support the specified
+// feature.
+//
+// @param use                   What newt needs the feature for; included in
+//                                  the error message.
+func requireGit(feat gitFeature, use string) error {
+	if gitSupports(feat) {
+		return nil
+	}
+
+	return util.FmtNewtError(
+		"git >= %s required for %s (%s); installed version is %s",
+		feat.Ver.String(), use, feat.Desc, installedGitVersion().String())
+}
@@ -0,0 +1,116 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// This file implements the HTTP client used for every download that doesn't
+// go through git: artifacts, newt executables, package indexes, and
+// vulnerability feeds.  Like git, the client honors the newtrc proxy settings.
+
+package downloader
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"mynewt.apache.org/newt/newt/settings"
+)
+
+// How long an HTTP download may take in total.
+const HTTP_TIMEOUT = 10 * time.Minute
+
+// How long to wait for a server to start responding.
+const HTTP_RESPONSE_TIMEOUT = 30 * time.Second
+
+var httpClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: httpProxy,
+		DialContext: (&net.Dialer{
+			Timeout:   HTTP_RESPONSE_TIMEOUT,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   HTTP_RESPONSE_TIMEOUT,
+		ResponseHeaderTimeout: HTTP_RESPONSE_TIMEOUT,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	},
+	Timeout: HTTP_TIMEOUT,
+}
+
+// Indicates whether a host is excluded from proxying by a no_proxy list: a
+// comma-separated list of host names and domain suffixes, or "*".
+func noProxy(host string, list string) bool {
+	host = strings.ToLower(host)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+		if h, _, err := net.SplitHostPort(entry); err == nil {
+			entry = h
+		}
+
+		entry = strings.TrimPrefix(entry, ".")
+		if host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Selects the proxy for an HTTP request from the newtrc proxy settings (see
+// settings.ProxySetting()).  Returns a nil URL if the request is not to be
+// proxied.
+func httpProxy(req *http.Request) (*url.URL, error) {
+	host := req.URL.Hostname()
+	if noProxy(host, settings.ProxySetting("proxy.no_proxy")) {
+		return nil, nil
+	}
+
+	setting := "proxy.http"
+	if req.URL.Scheme == "https" {
+		setting = "proxy.https"
+	}
+	proxy := settings.ProxySetting(setting)
+	if proxy == "" {
+		return nil, nil
+	}
+
+	// A proxy is often specified as "host:port" without a scheme.
+	u, err := url.Parse(proxy)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		u, err = url.Parse("http://" + proxy)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return u, nil
+}
+
+// Issues an HTTP GET request through newt's HTTP client.  The caller is
+// responsible for closing the response body.
+func HttpGet(url string) (*http.Response, error) {
+	return httpClient.Get(url)
+}
@@ -0,0 +1,88 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package downloader
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Performs a quick check of a repo's object database.  This detects repos
+// left incomplete by an interrupted download.  Symlinked repos and directories
+// that are not git repos are not checked.
+//
+// @return bool                 True if git found the repo to be damaged.
+// @return error                Set if the check could not be performed
+//                                  (e.g., git timed out, refused to operate
+//                                  on the repo, or is too old).  This says
+//                                  nothing about the state of the repo.
+func CheckIntegrity(repoDir string) (bool, error) {
+	if fi, err := os.Lstat(repoDir); err != nil ||
+		fi.Mode()&os.ModeSymlink != 0 {
+
+		return false, nil
+	}
+
+	if util.NodeNotExist(repoDir + "/.git") {
+		return false, nil
+	}
+
+	cmd := []string{"fsck", "--connectivity-only", "--no-progress"}
+	_, err := executeGitCommand(repoDir, cmd, true)
+	if err == nil {
+		return false, nil
+	}
+
+	// fsck reports the problems it finds with exit statuses below 128; git
+	// uses 128 and above for fatal errors and usage errors.
+	if status, ok := exitStatus(err); ok && status > 0 && status < 128 {
+		return true, util.FmtNewtError("integrity check failed: %s",
+			err.Error())
+	}
+
+	return false, util.FmtNewtError("failed to check repo integrity: %s",
+		err.Error())
+}
+
+// Retrieves the exit status of a failed command executed with
+// util.ShellCommand.
+//
+// @return bool                 False if the command didn't run to completion
+//                                  (e.g., it couldn't be started or it timed
+//                                  out).
+func exitStatus(err error) (int, bool) {
+	newtErr, ok := err.(*util.NewtError)
+	if !ok {
+		return 0, false
+	}
+	ee, ok := newtErr.Parent.(*exec.ExitError)
+	if !ok {
+		return 0, false
+	}
+	ws, ok := ee.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Exited() {
+		return 0, false
+	}
+
+	return ws.ExitStatus(), true
+}
@@ -0,0 +1,213 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package downloader
+
+import (
+	"strings"
+	"time"
+)
+
+// Broad causes of a failed download, used to tell infrastructure problems
+// (e.g., a flaky proxy) apart from problems with the repo itself.
+const (
+	FAILURE_TIMEOUT   = "timeout"
+	FAILURE_AUTH      = "auth"
+	FAILURE_NOT_FOUND = "not-found"
+	FAILURE_NETWORK   = "network"
+	FAILURE_DISK      = "disk"
+	FAILURE_OTHER     = "other"
+)
+
+// Substrings of git error messages indicating each class of failure, in the
+// order they are checked.
+var failurePatterns = []struct {
+	class    string
+	patterns []string
+}{
+	{FAILURE_TIMEOUT, []string{
+		"did not complete within",
+		"timed out",
+		"timeout",
+	}},
+	{FAILURE_AUTH, []string{
+		"authentication failed",
+		"could not read username",
+		"could not read password",
+		"terminal prompts disabled",
+		"permission denied",
+		"access denied",
+		"returned error: 401",
+		"returned error: 403",
+	}},
+	{FAILURE_NOT_FOUND, []string{
+		"repository not found",
+		"does not appear to be a git repository",
+		"returned error: 404",
+		"couldn't find remote ref",
+	}},
+	{FAILURE_NETWORK, []string{
+		"could not resolve host",
+		"could not resolve proxy",
+		"connection refused",
+		"connection reset",
+		"network is unreachable",
+		"no route to host",
+		"failed to connect",
+		"the remote end hung up",
+		"early eof",
+		"rpc failed",
+		"ssl",
+		"tls",
+		"gnutls",
+		"returned error: 5",
+	}},
+	{FAILURE_DISK, []string{
+		"no space left on device",
+		"disk quota exceeded",
+		"read-only file system",
+	}},
+}
+
+// Determines the likely cause of a failed git operation from its error
+// message.
+func ClassifyFailure(msg string) string {
+	msg = strings.ToLower(msg)
+	for _, fp := range failurePatterns {
+		for _, p := range fp.patterns {
+			if strings.Contains(msg, p) {
+				return fp.class
+			}
+		}
+	}
+
+	return FAILURE_OTHER
+}
+
+// Statistics for one kind of network operation.
+type OpMetrics struct {
+	// Number of operations performed.
+	Count int
+
+	// Number of operations that failed with every URL.
+	Failures int
+
+	// Number of attempts beyond the first (i.e., fallbacks to a mirror).
+	Retries int
+
+	// Total and most recent duration, including all attempts.
+	Total time.Duration
+	Last  time.Duration
+}
+
+// Network statistics for a repo.
+type Metrics struct {
+	// Clones.
+	Download OpMetrics
+
+	// Fetches of an existing repo.
+	Fetch OpMetrics
+
+	// The most recent failed attempt; LastFailureTime is zero if none.
+	LastFailure      string
+	LastFailureClass string
+	LastFailureTime  time.Time
+}
+
+func (om *OpMetrics) Add(other OpMetrics) {
+	om.Count += other.Count
+	om.Failures += other.Failures
+	om.Retries += other.Retries
+	om.Total += other.Total
+	if other.Count > 0 {
+		om.Last = other.Last
+	}
+}
+
+// Returns the mean duration of an operation.
+func (om *OpMetrics) Average() time.Duration {
+	if om.Count == 0 {
+		return 0
+	}
+	return om.Total / time.Duration(om.Count)
+}
+
+// Adds the statistics in other to m.  other is assumed to be more recent.
+func (m *Metrics) Add(other Metrics) {
+	m.Download.Add(other.Download)
+	m.Fetch.Add(other.Fetch)
+	if !other.LastFailureTime.IsZero() {
+		m.LastFailure = other.LastFailure
+		m.LastFailureClass = other.LastFailureClass
+		m.LastFailureTime = other.LastFailureTime
+	}
+}
+
+func (m *Metrics) IsEmpty() bool {
+	return m.Download.Count == 0 && m.Fetch.Count == 0 &&
+		m.LastFailureTime.IsZero()
+}
+
+// Records a failed attempt.
+func (m *Metrics) recordFailure(err error) {
+	// Keep the first line git flagged as an error; it is the most specific.
+	msg := strings.TrimSpace(err.Error())
+	for _, line := range strings.Split(msg, "\n") {
+		if strings.HasPrefix(line, "fatal: ") ||
+			strings.HasPrefix(line, "error: ") {
+
+			msg = strings.TrimSpace(line)
+			break
+		}
+	}
+
+	m.LastFailure = msg
+	m.LastFailureClass = ClassifyFailure(err.Error())
+	m.LastFailureTime = time.Now()
+}
+
+// Records the outcome of an operation.
+//
+// @param op                    The operation's statistics.
+// @param start                 When the operation started.
+// @param attempts              The number of URLs tried.
+// @param err                   The operation's final result.
+func (m *Metrics) record(op *OpMetrics, start time.Time, attempts int,
+	err error) {
+
+	op.Count++
+	op.Last = time.Since(start)
+	op.Total += op.Last
+	if attempts > 1 {
+		op.Retries += attempts - 1
+	}
+	if err != nil {
+		op.Failures++
+	}
+}
+
+// Returns the network statistics gathered since the downloader was created or
+// last reset.
+func (gd *GenericDownloader) Metrics() *Metrics {
+	return &gd.metrics
+}
+
+func (gd *GenericDownloader) ResetMetrics() {
+	gd.metrics = Metrics{}
+}
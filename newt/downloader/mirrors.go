@@ -0,0 +1,170 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package downloader
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// A URL that a repo can be downloaded from.
+type remoteUrl struct {
+	// The URL passed to git; may contain credentials.
+	url string
+
+	// The URL shown to the user and recorded in the repo.
+	display string
+}
+
+// Git config key recording the URL of the most recent successful download.
+const LAST_URL_CFG_KEY = "newt.lasturl"
+
+func mirrorRemoteUrls(mirrors []string) []remoteUrl {
+	urls := make([]remoteUrl, len(mirrors))
+	for i, m := range mirrors {
+		urls[i] = remoteUrl{url: m, display: m}
+	}
+
+	return urls
+}
+
+func recordUrl(repoDir string, ru remoteUrl) {
+	cmd := []string{"config", LAST_URL_CFG_KEY, ru.display}
+	if _, err := executeGitCommand(repoDir, cmd, true); err != nil {
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Failed to record download URL: %s\n", err.Error())
+	}
+}
+
+// Orders the specified URLs such that the one that most recently succeeded
+// gets tried first.
+func orderUrls(repoDir string, urls []remoteUrl) []remoteUrl {
+	o, err := executeGitCommand(repoDir,
+		[]string{"config", "--get", LAST_URL_CFG_KEY}, true)
+	if err != nil {
+		return urls
+	}
+	last := strings.TrimSpace(string(o))
+
+	ordered := []remoteUrl{}
+	for _, ru := range urls {
+		if ru.display == last {
+			ordered = append([]remoteUrl{ru}, ordered...)
+		} else {
+			ordered = append(ordered, ru)
+		}
+	}
+
+	return ordered
+}
+
+// Clones a repo from the first of the specified URLs that works.
+//
+// @param urls                  The URLs to try, in order.
+// @param args                  The "git clone" options, excluding the URL
+//                                  and destination.
+// @param dstPath               The directory to clone into.
+//
+// @return int                  The index of the URL that was cloned.
+func (gd *GenericDownloader) cloneFromUrls(urls []remoteUrl, args []string,
+	dstPath string) (int, error) {
+
+	var err error
+	start := time.Now()
+	for i, ru := range urls {
+		cmd := []string{"clone"}
+		cmd = append(cmd, args...)
+		cmd = append(cmd, ru.url, dstPath)
+
+		_, err = executeGitNetCommand("", cmd, true)
+		if err == nil {
+			if i != 0 {
+				util.StatusMessage(util.VERBOSITY_DEFAULT,
+					"Downloaded from mirror %s\n", ru.display)
+			}
+			recordUrl(dstPath, ru)
+			gd.metrics.record(&gd.metrics.Download, start, i+1, nil)
+			return i, nil
+		}
+
+		gd.metrics.recordFailure(err)
+
+		// Discard a partial clone before trying the next URL.
+		os.RemoveAll(dstPath)
+
+		if i < len(urls)-1 {
+			util.StatusMessage(util.VERBOSITY_QUIET,
+				"WARNING: Failed to download from %s; trying %s\n",
+				ru.display, urls[i+1].display)
+		}
+	}
+
+	gd.metrics.record(&gd.metrics.Download, start, len(urls), err)
+	return -1, err
+}
+
+// Fetches a repo's remote.  If the fetch fails, the specified mirrors are
+// tried in turn.  A mirror's branches are fetched into the remote's
+// remote-tracking branches, so the rest of newt is unaware of which URL was
+// used.
+//
+// @param repoDir               The path of the repo to fetch.
+// @param remote                The name of the remote.
+// @param origin                The URL of the remote (already configured in
+//                                  the repo).
+// @param mirrors               Alternative URLs to try.
+func (gd *GenericDownloader) fetchFromUrls(repoDir string, remote string,
+	origin remoteUrl, mirrors []remoteUrl) error {
+
+	urls := orderUrls(repoDir, append([]remoteUrl{origin}, mirrors...))
+
+	start := time.Now()
+	var err error
+	for i, ru := range urls {
+		var cmd []string
+		if ru == origin {
+			cmd = []string{"fetch", "--tags", remote}
+		} else {
+			cmd = []string{"fetch", "--tags", ru.url,
+				"+refs/heads/*:refs/remotes/" + remote + "/*"}
+		}
+
+		_, err = executeGitNetCommand(repoDir, cmd, true)
+		if err == nil {
+			recordUrl(repoDir, ru)
+			gd.metrics.record(&gd.metrics.Fetch, start, i+1, nil)
+			return nil
+		}
+
+		gd.metrics.recordFailure(err)
+
+		if i < len(urls)-1 {
+			util.StatusMessage(util.VERBOSITY_QUIET,
+				"WARNING: Failed to fetch from %s; trying %s\n",
+				ru.display, urls[i+1].display)
+		}
+	}
+
+	gd.metrics.record(&gd.metrics.Fetch, start, len(urls), err)
+	return err
+}
@@ -0,0 +1,45 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package downloader
+
+import (
+	"strings"
+)
+
+// Returns a name that identifies the git repo the specified downloader
+// fetches from.  Newt repos that live in subtrees of the same git repo (a
+// monorepo) have the same key, and share a single checkout.  Returns "" if
+// the downloader doesn't fetch from a git remote.
+func CheckoutKey(dl Downloader) string {
+	var url string
+
+	switch d := dl.(type) {
+	case *GitDownloader:
+		url = d.Url
+	case *GithubDownloader:
+		_, url = d.remoteUrls()
+	case *AzureDownloader:
+		_, url = d.remoteUrls()
+	default:
+		return ""
+	}
+
+	return strings.TrimSuffix(mirrorName(url), ".git")
+}
@@ -0,0 +1,100 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/settings"
+	"mynewt.apache.org/newt/util"
+)
+
+// Expands the placeholders in a newt download URL: "%s" is replaced with the
+// version, "%os" and "%arch" with the platform.
+func NewtDownloadUrl(tmpl string, ver string) string {
+	url := strings.Replace(tmpl, "%os", runtime.GOOS, -1)
+	url = strings.Replace(url, "%arch", runtime.GOARCH, -1)
+	return strings.Replace(url, "%s", ver, -1)
+}
+
+// Returns the path of the specified newt version's executable, downloading
+// it if it isn't cached in the user's newt directory ($HOME/.newt/bin).
+//
+// @param ver                   The newt version to fetch.
+// @param url                   The location of the executable.
+// @param digest                The expected SHA256 digest of the
+//                                  executable.  Required; newt never runs an
+//                                  unverified executable.
+func FetchNewt(ver string, url string, digest string) (string, error) {
+	if digest == "" {
+		return "", util.FmtNewtError(
+			"Refusing to download newt %s without a SHA256 digest", ver)
+	}
+
+	dir := settings.NewtrcDir()
+	if dir == "" {
+		return "", util.NewNewtError(
+			"cannot determine the user's home directory")
+	}
+	dir += "/bin/" + ver
+
+	exe := "newt"
+	if runtime.GOOS == "windows" {
+		exe += ".exe"
+	}
+	path := filepath.Join(dir, exe)
+
+	if util.NodeExist(path) && artifactValid(path, digest) {
+		return path, nil
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", util.ChildNewtError(err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Downloading newt %s from %s\n", ver, url)
+
+	tmpPath, err := downloadArtifact(url, dir)
+	if err != nil {
+		return "", err
+	}
+
+	if !artifactValid(tmpPath, digest) {
+		os.Remove(tmpPath)
+		return "", util.FmtNewtError(
+			"Downloaded newt %s from %s has the wrong SHA256 digest",
+			ver, url)
+	}
+
+	if err := os.Chmod(tmpPath, 0755); err != nil {
+		os.Remove(tmpPath)
+		return "", util.ChildNewtError(err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return "", util.ChildNewtError(err)
+	}
+
+	return path, nil
+}
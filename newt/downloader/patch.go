@@ -0,0 +1,90 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package downloader
+
+import (
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+func patchCmd(patchPath string, directory string, reverse bool) []string {
+	cmd := []string{"apply", "--whitespace=nowarn"}
+	if reverse {
+		cmd = append(cmd, "-R")
+	}
+	if directory != "" {
+		cmd = append(cmd, "--directory="+directory)
+	}
+	return cmd
+}
+
+// Indicates whether a patch applies cleanly to a repo's working tree (or, if
+// reverse is true, whether it can be cleanly un-applied).
+//
+// @param directory             Prepended to the paths in the patch; "" if
+//                                  the patch is relative to the top of the
+//                                  git repo.
+func PatchApplies(repoDir string, patchPath string, directory string,
+	reverse bool) bool {
+
+	cmd := append(patchCmd(patchPath, directory, reverse), "--check",
+		patchPath)
+	_, err := executeGitCommand(repoDir, cmd, true)
+	return err == nil
+}
+
+// Applies a patch to a repo's working tree, or un-applies it if reverse is
+// true.  Nothing is modified if the patch does not apply cleanly.
+func ApplyPatch(repoDir string, patchPath string, directory string,
+	reverse bool) error {
+
+	cmd := append(patchCmd(patchPath, directory, reverse), patchPath)
+	if _, err := executeGitCommand(repoDir, cmd, true); err != nil {
+		return util.FmtNewtError("failed to apply patch %s: %s", patchPath,
+			strings.TrimSpace(err.Error()))
+	}
+
+	return nil
+}
+
+// Returns the ID of the tree object representing the state of a repo's
+// tracked files, including uncommitted changes.  The repo is not modified.
+func WorkTreeId(repoDir string) (string, error) {
+	// `git stash create` records the working tree without touching it or the
+	// stash list.  It prints nothing if there are no changes.
+	o, err := executeGitCommand(repoDir, []string{"stash", "create"}, true)
+	if err != nil {
+		return "", err
+	}
+
+	rev := strings.TrimSpace(string(o))
+	if rev == "" {
+		rev = "HEAD"
+	}
+
+	cmd := []string{"rev-parse", "--verify", "--quiet", rev + "^{tree}"}
+	o, err = executeGitCommand(repoDir, cmd, true)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(o)), nil
+}
@@ -0,0 +1,239 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package downloader
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Matches a git progress line, e.g.,
+//     Receiving objects:  45% (450/1000), 1.20 MiB | 2.00 MiB/s
+var gitProgressRe = regexp.MustCompile(`^([A-Za-z][A-Za-z ]*):\s+(\d+)%`)
+
+// Consumes the stderr output of a git network command.  Progress lines are
+// condensed and reported to the user; everything else is retained so that it
+// can be included in an error message.
+type gitProgress struct {
+	output  bytes.Buffer
+	line    []byte
+	phase   string
+	lastPct int
+}
+
+func (gp *gitProgress) processLine(line string) {
+	m := gitProgressRe.FindStringSubmatch(line)
+	if m == nil {
+		if strings.TrimSpace(line) != "" {
+			gp.output.WriteString(line + "\n")
+		}
+		return
+	}
+
+	if QuietProgress {
+		return
+	}
+
+	pct, _ := strconv.Atoi(m[2])
+	if m[1] != gp.phase {
+		gp.phase = m[1]
+		gp.lastPct = -1
+	}
+
+	// Report each phase in 10% increments to keep the output readable.
+	if pct/10 > gp.lastPct/10 || (pct == 100 && gp.lastPct != 100) {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    %s\n",
+			strings.TrimSpace(line))
+		gp.lastPct = pct
+	}
+}
+
+// Git terminates progress updates with a carriage return and all other output
+// with a newline.
+func (gp *gitProgress) Write(p []byte) (int, error) {
+	for _, c := range p {
+		if c == '\r' || c == '\n' {
+			gp.processLine(string(gp.line))
+			gp.line = gp.line[:0]
+		} else {
+			gp.line = append(gp.line, c)
+		}
+	}
+
+	return len(p), nil
+}
+
+// Waits for a started git command to exit.  The command and its descendants
+// are killed if it runs longer than the git timeout (see gitTimeout()).
+//
+// @return bool                 Whether the command timed out.
+// @return error                The command's exit status; nil on success.
+func waitGitCommand(c *exec.Cmd) (bool, error) {
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Wait()
+	}()
+
+	// A nil channel never becomes ready.
+	var timeoutCh <-chan time.Time
+	if timeout := gitTimeout(); timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	select {
+	case err := <-done:
+		return false, err
+	case <-timeoutCh:
+		util.KillProcessTree(c.Process)
+		return true, nil
+	}
+}
+
+// Returns the error reported when a git command times out.
+func gitTimeoutError(gitCmd []string) error {
+	return util.FmtNewtError("Command timed out after %s: %s",
+		gitTimeout().String(), strings.Join(gitCmd, " "))
+}
+
+// Executes a git command that accesses a remote.  Every such command goes
+// through this function, which sends the registered access tokens.  Unless
+// the user requested quiet output, the transfer progress of a clone or fetch
+// is reported so that long downloads do not appear to hang (see
+// QuietProgress).  At verbose level, a clone runs interactively and git
+// displays its own progress.  In
+// every case, the command is subject to the git timeout.
+//
+// @param dir                   The directory to execute the command in; ""
+//                                  for the current directory.
+// @param cmd                   The git command, starting with the name of
+//                                  the git subcommand.
+// @param logCmd                Whether to log the command being executed.
+//
+// @return []byte               The command's non-progress output.
+// @return error                NewtError on failure.
+func executeGitNetCommand(
+	dir string, cmd []string, logCmd bool) ([]byte, error) {
+
+	if dir == "" {
+		dir = "."
+	}
+
+	transfer := cmd[0] == "clone" || cmd[0] == "fetch"
+	if !transfer || util.Verbosity < util.VERBOSITY_DEFAULT {
+		return runGitCommand(dir, cmd, logCmd, true)
+	}
+
+	gp, err := gitPath()
+	if err != nil {
+		return nil, err
+	}
+
+	env := append(gitEnv(), gitAuthEnv(false)...)
+	logEnv := append(gitEnv(), gitAuthEnv(true)...)
+
+	if cmd[0] == "clone" && util.Verbosity >= util.VERBOSITY_VERBOSE &&
+		!QuietProgress {
+		gitCmd := []string{gp, "-C", dir}
+		gitCmd = append(gitCmd, gitGlobalOpts...)
+		gitCmd = append(gitCmd, cmd...)
+		if logCmd {
+			util.LogShellCmd(gitCmd, logEnv)
+		}
+
+		c := exec.Command(gitCmd[0], gitCmd[1:]...)
+		c.Env = util.ChildEnv(env)
+		c.Stdin = os.Stdin
+		c.Stdout = os.Stdout
+		c.Stderr = os.Stderr
+
+		if err := c.Start(); err != nil {
+			return nil, util.NewNewtError(err.Error())
+		}
+		timedOut, err := waitGitCommand(c)
+		if timedOut {
+			return nil, gitTimeoutError(gitCmd)
+		}
+		if err != nil {
+			return nil, util.NewNewtError(err.Error())
+		}
+
+		return nil, nil
+	}
+
+	gitCmd := []string{gp}
+	gitCmd = append(gitCmd, gitGlobalOpts...)
+	gitCmd = append(gitCmd, cmd[0], "--progress")
+	gitCmd = append(gitCmd, cmd[1:]...)
+
+	if logCmd {
+		util.LogShellCmd(gitCmd, logEnv)
+	}
+
+	progress := &gitProgress{}
+
+	wd := util.NewWatchdog(gitCmd, util.HangTimeout)
+
+	c := exec.Command(gitCmd[0], gitCmd[1:]...)
+	c.Dir = dir
+	c.Env = util.ChildEnv(env)
+	// With the same writer for both streams, exec never calls it from two
+	// goroutines at once.
+	c.Stdout = wd.Writer(progress)
+	c.Stderr = c.Stdout
+
+	if err := c.Start(); err != nil {
+		return nil, util.NewNewtError(err.Error())
+	}
+	wd.Watch(c.Process)
+	timedOut, err := waitGitCommand(c)
+	wd.Stop()
+	if wd.Fired() {
+		return nil, wd.Error()
+	}
+	if timedOut {
+		return nil, gitTimeoutError(gitCmd)
+	}
+	progress.processLine(string(progress.line))
+
+	o := progress.output.Bytes()
+	log.Debugf("o=%s", string(o))
+
+	if err != nil {
+		log.Debugf("err=%s", err.Error())
+		if len(o) > 0 {
+			return o, util.NewNewtError(string(o))
+		} else {
+			return o, util.NewNewtError(err.Error())
+		}
+	}
+
+	return o, nil
+}
@@ -0,0 +1,92 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// A repo can be pinned to an open pull request by specifying the request's
+// ref as a commit, e.g.:
+//
+//     repository.apache-mynewt-core:
+//         type: github
+//         vers: pull/1234/head-commit
+//         user: apache
+//         repo: mynewt-core
+//
+// Pull request refs are not fetched by the default refspec, so newt fetches
+// the named ref explicitly into `refs/remotes/<remote>/pull/1234/head`.
+// Afterwards it resolves like a remote branch.  The ref is always checked out
+// as a detached HEAD: a pull request may be force-pushed, so there is no
+// local branch to merge into.  GitLab's `merge-requests/<n>/head` refs are
+// supported in the same way.
+
+package downloader
+
+import (
+	"regexp"
+
+	"mynewt.apache.org/newt/util"
+)
+
+var pullRefRe = regexp.MustCompile(
+	`^(pull/[0-9]+/(head|merge)|merge-requests/[0-9]+/(head|merge))$`)
+
+// Indicates whether the specified commit string names a pull request ref.
+func IsPullRef(commit string) bool {
+	return pullRefRe.MatchString(commit)
+}
+
+// Returns the refspec that fetches the specified pull request ref into the
+// remote's namespace.
+func pullRefspec(remote string, ref string) string {
+	return "+refs/" + ref + ":refs/remotes/" + remote + "/" + ref
+}
+
+// Fetches the specified commit from the downloader's remote if it names a
+// pull request.  Each ref is fetched at most once per run.
+//
+// @param repoDir               The path of the repo to fetch into.
+// @param commit                The commit about to be resolved.
+// @param gitCmd                Runs the specified git command in the repo;
+//                                  allows the caller to provide credentials.
+func (gd *GenericDownloader) fetchPullRef(repoDir string, commit string,
+	gitCmd func(args []string) ([]byte, error)) error {
+
+	if !IsPullRef(commit) || gd.pullRefsFetched[commit] {
+		return nil
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE,
+		"Fetching pull request ref %s\n", commit)
+
+	cmd := []string{
+		"fetch",
+		gd.RemoteName(),
+		pullRefspec(gd.RemoteName(), commit),
+	}
+	if _, err := gitCmd(cmd); err != nil {
+		return util.FmtNewtError(
+			"Failed to fetch \"%s\"; does the pull request exist? %s",
+			commit, err.Error())
+	}
+
+	if gd.pullRefsFetched == nil {
+		gd.pullRefsFetched = map[string]bool{}
+	}
+	gd.pullRefsFetched[commit] = true
+
+	return nil
+}
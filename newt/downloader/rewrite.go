@@ -0,0 +1,188 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package downloader
+
+import (
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/settings"
+	"mynewt.apache.org/newt/util"
+)
+
+// The newtrc map of URL rewrites.  Each key is a URL prefix; a repo whose URL
+// starts with a key is downloaded from the corresponding replacement instead.
+// Schemes and credentials are ignored when matching, so one rule covers
+// https, ssh, and scp-style URLs alike:
+//
+//     mirrors:
+//         github.com/apache: git.internal/apache-mirror
+//         github.com/myorg: https://git.internal/myorg
+//
+// If the replacement has no scheme, the repo URL's own scheme is kept.  When
+// several prefixes match, the longest one wins.  A rewritten GitHub or Azure
+// repo is downloaded as a plain git repo from the replacement URL.
+const URL_REWRITE_KEY = "mirrors"
+
+type urlRewrite struct {
+	from string
+	to   string
+}
+
+// Splits a repo URL into its scheme (including "://"), user info (including
+// "@"), and the remainder (host and path).  An scp-style URL
+// ("git@host:path") is treated as ssh.
+func splitRepoUrl(url string) (string, string, string) {
+	scheme := ""
+	rest := url
+	if i := strings.Index(url, "://"); i >= 0 {
+		scheme = url[:i+3]
+		rest = url[i+3:]
+	} else if i := strings.Index(url, ":"); i > 0 &&
+		!strings.Contains(url[:i], "/") {
+
+		scheme = "ssh://"
+		rest = url[:i] + "/" + strings.TrimPrefix(url[i+1:], "/")
+	}
+
+	userInfo := ""
+	if slash := strings.Index(rest, "/"); slash >= 0 {
+		if at := strings.LastIndex(rest[:slash], "@"); at >= 0 {
+			userInfo = rest[:at+1]
+			rest = rest[at+1:]
+		}
+	} else if at := strings.LastIndex(rest, "@"); at >= 0 {
+		userInfo = rest[:at+1]
+		rest = rest[at+1:]
+	}
+
+	return scheme, userInfo, rest
+}
+
+func readUrlRewrites() []urlRewrite {
+	m := settings.Newtrc().GetValStringMapString(URL_REWRITE_KEY, nil)
+
+	rws := make([]urlRewrite, 0, len(m))
+	for from, to := range m {
+		_, _, from = splitRepoUrl(strings.TrimSpace(from))
+		from = strings.TrimSuffix(from, "/")
+		to = strings.TrimSuffix(strings.TrimSpace(to), "/")
+		if from != "" && to != "" {
+			rws = append(rws, urlRewrite{from: from, to: to})
+		}
+	}
+
+	// Longest prefix first.
+	sort.Sort(urlRewriteSorter(rws))
+
+	return rws
+}
+
+type urlRewriteSorter []urlRewrite
+
+func (s urlRewriteSorter) Len() int {
+	return len(s)
+}
+func (s urlRewriteSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s urlRewriteSorter) Less(i, j int) bool {
+	if len(s[i].from) != len(s[j].from) {
+		return len(s[i].from) > len(s[j].from)
+	}
+	return s[i].from < s[j].from
+}
+
+// Applies the newtrc URL rewrites to a repo URL.
+//
+// @return string               The URL to download from.
+// @return bool                 Whether a rewrite applied.
+func RewriteUrl(url string) (string, bool) {
+	scheme, userInfo, rest := splitRepoUrl(url)
+
+	for _, rw := range readUrlRewrites() {
+		if rest != rw.from && !strings.HasPrefix(rest, rw.from+"/") {
+			continue
+		}
+
+		suffix := rest[len(rw.from):]
+		if strings.Contains(rw.to, "://") {
+			return rw.to + suffix, true
+		}
+		if scheme == "" {
+			return rw.to + suffix, true
+		}
+		return scheme + userInfo + rw.to + suffix, true
+	}
+
+	return url, false
+}
+
+func rewriteUrls(urls []string) []string {
+	rewritten := make([]string, len(urls))
+	for i, u := range urls {
+		rewritten[i], _ = RewriteUrl(u)
+	}
+
+	return rewritten
+}
+
+// Redirects a downloader according to the newtrc URL rewrites.  A hosted
+// (GitHub or Azure) repo that gets rewritten is replaced with a plain git
+// downloader for the new URL.
+func rewriteDownloader(repoName string, dl Downloader) Downloader {
+	var gen *GenericDownloader
+	var publicUrl string
+
+	switch d := dl.(type) {
+	case *GitDownloader:
+		gen = &d.GenericDownloader
+		publicUrl = d.Url
+	case *GithubDownloader:
+		gen = &d.GenericDownloader
+		_, publicUrl = d.remoteUrls()
+	case *AzureDownloader:
+		gen = &d.GenericDownloader
+		_, publicUrl = d.remoteUrls()
+	default:
+		return dl
+	}
+
+	gen.Mirrors = rewriteUrls(gen.Mirrors)
+
+	url, ok := RewriteUrl(publicUrl)
+	if !ok {
+		return dl
+	}
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE,
+		"Downloading repo \"%s\" from %s instead of %s\n",
+		repoName, url, publicUrl)
+
+	if gd, ok := dl.(*GitDownloader); ok {
+		gd.Url = url
+		return gd
+	}
+
+	return &GitDownloader{
+		GenericDownloader: *gen,
+		Url:               url,
+	}
+}
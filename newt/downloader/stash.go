@@ -0,0 +1,100 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package downloader
+
+import (
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+const STASH_MESSAGE = "newt upgrade"
+
+// Saves a repo's local modifications with `git stash` so that a different
+// commit can be checked out.
+//
+// @return bool                 true if anything was stashed.
+func (gd *GenericDownloader) StashChanges(path string) (bool, error) {
+	changes, err := areChanges(path)
+	if err != nil || !changes {
+		return false, err
+	}
+
+	cmd := []string{"stash", "push", "-m", STASH_MESSAGE}
+	if !gitSupports(gitFeatStashPush) {
+		cmd = []string{"stash", "save", STASH_MESSAGE}
+	}
+	if _, err := executeGitCommand(path, cmd, true); err != nil {
+		return false, util.FmtNewtError(
+			"failed to stash local changes: %s", err.Error())
+	}
+
+	return true, nil
+}
+
+// Lists the files with unresolved conflicts in a repo's working tree.
+func conflictedFiles(path string) []string {
+	cmd := []string{"diff", "--name-only", "--diff-filter=U"}
+	o, err := executeGitCommand(path, cmd, true)
+	if err != nil {
+		return nil
+	}
+
+	return strings.Fields(string(o))
+}
+
+// Re-applies the changes saved by StashChanges().  If the changes conflict
+// with the newly checked out commit, the conflicts are left in the working
+// tree for the user to resolve and the stash is kept.
+func (gd *GenericDownloader) RestoreChanges(path string) error {
+	cmd := []string{"stash", "pop"}
+	if _, err := executeGitCommand(path, cmd, true); err != nil {
+		files := conflictedFiles(path)
+		if len(files) == 0 {
+			return util.FmtNewtError(
+				"failed to re-apply stashed changes; they remain in the "+
+					"repo's stash (git stash list): %s", err.Error())
+		}
+
+		return util.FmtNewtError(
+			"local changes conflict with the new version in the following "+
+				"files:\n    %s\nResolve the conflicts in %s; the original "+
+				"changes remain in the repo's stash (git stash list)",
+			strings.Join(files, "\n    "), path)
+	}
+
+	return nil
+}
+
+// Linked local repos are never updated, so their changes don't need to be set
+// aside.
+func (ld *LocalDownloader) StashChanges(path string) (bool, error) {
+	if ld.Link != LOCAL_LINK_NONE {
+		return false, nil
+	}
+
+	if st := ld.State(path); st.Name() != "git" {
+		return false, util.FmtNewtError(
+			"cannot stash changes in %s (%s); only git repos support "+
+				"stashing", path, st.Name())
+	}
+
+	return ld.GenericDownloader.StashChanges(path)
+}
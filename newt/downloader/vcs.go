@@ -0,0 +1,521 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package downloader
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Reports the state of an installed repo: which revision is checked out, how
+// commit strings from `repository.yml` map to revisions, and whether the
+// working copy has been modified.  The repo layer (version detection, `newt
+// info`, upgrade previews) only inspects a repo through this interface, so
+// every backend reports its state in the same terms.
+type VCSState interface {
+	// The name of the version control system (e.g., "git").
+	Name() string
+
+	// Indicates whether the backend tracks history.  Without history, a repo
+	// has a single revision, which every commit string refers to.
+	HasHistory() bool
+
+	// Retrieves the identifier of the currently checked out revision.
+	CurrentCommit(path string) (string, error)
+
+	// Retrieves the unique identifier of the revision that the specified
+	// commit string refers to.
+	HashFor(path string, commit string) (string, error)
+
+	// Retrieves every commit string (hash, branches, tags) that refers to the
+	// same revision as the specified commit string.
+	CommitsFor(path string, commit string) ([]string, error)
+
+	CommitType(path string, commit string) (DownloaderCommitType, error)
+
+	// Retrieves the commit string that an update to the specified commit
+	// would move the repo to.  For a git branch, this is the remote's copy of
+	// the branch.
+	UpstreamCommit(commit string) string
+
+	// Removes backend-specific decoration from a commit string so that it can
+	// be compared against the commit strings in `repository.yml`.
+	NormalizeCommit(commit string) string
+
+	// Indicates whether the working copy contains local modifications.
+	AreChanges(path string) (bool, error)
+
+	// Retrieves the date of the specified commit.
+	CommitTime(path string, commit string) (time.Time, error)
+
+	// Counts the commits reachable from `to` but not from `from`.
+	CommitsBetween(path string, from string, to string) (int, error)
+}
+
+// Determines which version control system manages the specified directory.
+//
+// @param path                  The directory to inspect.
+// @param remote                The name of the git remote that newt fetches
+//                                  from.
+// @param source                For a copied repo, the directory it was copied
+//                                  from; used to detect changes in a repo that
+//                                  is not under version control.
+func DetectVCSState(path string, remote string, source string) VCSState {
+	if util.NodeExist(path + "/.git") {
+		return &gitState{remote: remote}
+	}
+	if util.NodeExist(path + "/.hg") {
+		return &hgState{}
+	}
+
+	return &snapshotState{source: source}
+}
+
+// git
+
+type gitState struct {
+	remote string
+}
+
+func (gs *gitState) Name() string {
+	return "git"
+}
+
+func (gs *gitState) HasHistory() bool {
+	return true
+}
+
+func (gs *gitState) CurrentCommit(path string) (string, error) {
+	return gs.HashFor(path, "HEAD")
+}
+
+func (gs *gitState) HashFor(path string, commit string) (string, error) {
+	full, err := fullCommitName(path, gs.remote, commit)
+	if err != nil {
+		return "", err
+	}
+	cmd := []string{"rev-parse", full}
+	o, err := executeGitCommand(path, cmd, true)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(o)), nil
+}
+
+func (gs *gitState) CommitsFor(path string, commit string) ([]string, error) {
+	// Hash.
+	hash, err := gs.HashFor(path, commit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Branches and tags.
+	refs, err := refsPointingAt(path, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := append([]string{hash}, refs...)
+	sort.Strings(lines)
+	return lines, nil
+}
+
+func (gs *gitState) CommitType(
+	path string, commit string) (DownloaderCommitType, error) {
+
+	return commitType(path, gs.remote, commit)
+}
+
+func (gs *gitState) UpstreamCommit(commit string) string {
+	return gs.remote + "/" + commit
+}
+
+// Removes extra information from a git commit string.  This throws away
+// information and causes some ambiguity, but it allows git commits to be
+// specified in a user-friendly manner (e.g., "mynewt_1_3_0_tag" rather than
+// "tags/mynewt_1_3_0_tag").
+func (gs *gitState) NormalizeCommit(commit string) string {
+	commit = strings.TrimPrefix(commit, "tags/")
+	commit = strings.TrimPrefix(commit, gs.remote+"/")
+	commit = strings.TrimPrefix(commit, "heads/")
+	return commit
+}
+
+func (gs *gitState) AreChanges(path string) (bool, error) {
+	return areChanges(path)
+}
+
+func (gs *gitState) CommitTime(
+	path string, commit string) (time.Time, error) {
+
+	full, err := fullCommitName(path, gs.remote, commit)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	cmd := []string{"log", "-1", "--format=%ct", full}
+	o, err := executeGitCommand(path, cmd, true)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	secs, err := strconv.ParseInt(strings.TrimSpace(string(o)), 10, 64)
+	if err != nil {
+		return time.Time{}, util.FmtNewtError(
+			"failed to parse date of commit %s: %s", commit, err.Error())
+	}
+
+	return time.Unix(secs, 0), nil
+}
+
+func (gs *gitState) CommitsBetween(
+	path string, from string, to string) (int, error) {
+
+	fullFrom, err := fullCommitName(path, gs.remote, from)
+	if err != nil {
+		return 0, err
+	}
+	fullTo, err := fullCommitName(path, gs.remote, to)
+	if err != nil {
+		return 0, err
+	}
+
+	cmd := []string{"rev-list", "--count", fullFrom + ".." + fullTo}
+	o, err := executeGitCommand(path, cmd, true)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(string(o)))
+	if err != nil {
+		return 0, util.FmtNewtError(
+			"failed to count commits between %s and %s: %s",
+			from, to, err.Error())
+	}
+
+	return n, nil
+}
+
+// Mercurial
+
+type hgState struct{}
+
+// Runs hg in the specified directory.  As with git, the C locale is forced so
+// that the output can be parsed.
+func executeHgCommand(dir string, cmd []string) ([]byte, error) {
+	hp, err := exec.LookPath("hg")
+	if err != nil {
+		return nil, util.FmtNewtError("Can't find hg binary: %s",
+			err.Error())
+	}
+
+	if _, err := os.Stat(dir); err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	hgCmd := append([]string{filepath.ToSlash(hp), "-R", dir}, cmd...)
+	return util.ShellCommand(hgCmd, gitEnv())
+}
+
+// Lists the names that hg prints one per line for the specified command
+// (e.g., tags or branches).
+func hgNames(path string, cmd []string) ([]string, error) {
+	o, err := executeHgCommand(path, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, line := range strings.Split(string(o), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			names = append(names, line)
+		}
+	}
+
+	return names, nil
+}
+
+func (hs *hgState) Name() string {
+	return "hg"
+}
+
+func (hs *hgState) HasHistory() bool {
+	return true
+}
+
+func (hs *hgState) CurrentCommit(path string) (string, error) {
+	return hs.HashFor(path, ".")
+}
+
+func (hs *hgState) HashFor(path string, commit string) (string, error) {
+	if commit == "HEAD" {
+		commit = "."
+	}
+
+	cmd := []string{"log", "-r", commit, "--template", "{node}"}
+	o, err := executeHgCommand(path, cmd)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(o)), nil
+}
+
+func (hs *hgState) CommitsFor(path string, commit string) ([]string, error) {
+	hash, err := hs.HashFor(path, commit)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []string{hash}
+
+	// Tags and bookmarks that point at the revision.  "tip" is a moving
+	// pseudo-tag, so it is never reported.
+	cmd := []string{"log", "-r", hash, "--template",
+		"{join(tags, '\\n')}\\n{join(bookmarks, '\\n')}\\n{branch}"}
+	names, err := hgNames(path, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, name := range names {
+		if name == "tip" {
+			continue
+		}
+
+		// The last line is the revision's branch; the branch name only
+		// refers to this revision if it is the branch's head.
+		if i == len(names)-1 {
+			if h, err := hs.HashFor(path, name); err != nil || h != hash {
+				continue
+			}
+		}
+
+		lines = append(lines, name)
+	}
+
+	sort.Strings(lines)
+	return lines, nil
+}
+
+func (hs *hgState) CommitType(
+	path string, commit string) (DownloaderCommitType, error) {
+
+	if commit == "HEAD" || commit == "." {
+		return COMMIT_TYPE_HASH, nil
+	}
+
+	tags, err := hgNames(path, []string{"tags", "--template", "{tag}\\n"})
+	if err != nil {
+		return DownloaderCommitType(-1), err
+	}
+	for _, t := range tags {
+		if t == commit {
+			return COMMIT_TYPE_TAG, nil
+		}
+	}
+
+	branches, err := hgNames(path,
+		[]string{"branches", "--template", "{branch}\\n"})
+	if err != nil {
+		return DownloaderCommitType(-1), err
+	}
+	bookmarks, err := hgNames(path,
+		[]string{"bookmarks", "--template", "{bookmark}\\n"})
+	if err != nil {
+		return DownloaderCommitType(-1), err
+	}
+	for _, b := range append(branches, bookmarks...) {
+		if b == commit {
+			return COMMIT_TYPE_LOCAL_BRANCH, nil
+		}
+	}
+
+	if _, err := hs.HashFor(path, commit); err == nil {
+		return COMMIT_TYPE_HASH, nil
+	}
+
+	return DownloaderCommitType(-1), util.FmtNewtError(
+		"Cannot determine commit type of \"%s\"", commit)
+}
+
+// Pulling updates hg's branches in place; there are no remote-tracking
+// branches.
+func (hs *hgState) UpstreamCommit(commit string) string {
+	return commit
+}
+
+func (hs *hgState) NormalizeCommit(commit string) string {
+	return commit
+}
+
+func (hs *hgState) AreChanges(path string) (bool, error) {
+	o, err := executeHgCommand(path, []string{"status", "-mard"})
+	if err != nil {
+		return false, err
+	}
+
+	return len(strings.TrimSpace(string(o))) > 0, nil
+}
+
+func (hs *hgState) CommitTime(
+	path string, commit string) (time.Time, error) {
+
+	cmd := []string{"log", "-r", commit, "--template", "{date|hgdate}"}
+	o, err := executeHgCommand(path, cmd)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// "<seconds> <tz-offset>"
+	fields := strings.Fields(string(o))
+	if len(fields) == 0 {
+		return time.Time{}, util.FmtNewtError(
+			"failed to parse date of commit %s", commit)
+	}
+	secs, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return time.Time{}, util.FmtNewtError(
+			"failed to parse date of commit %s: %s", commit, err.Error())
+	}
+
+	return time.Unix(secs, 0), nil
+}
+
+func (hs *hgState) CommitsBetween(
+	path string, from string, to string) (int, error) {
+
+	cmd := []string{"log", "-r", "only('" + to + "', '" + from + "')",
+		"--template", "x"}
+	o, err := executeHgCommand(path, cmd)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(strings.TrimSpace(string(o))), nil
+}
+
+// A repo that isn't under version control (e.g., an extracted tarball or a
+// copy of a plain directory).  Such a repo has exactly one revision: its
+// current contents, identified by their digest.  Every commit string refers
+// to that revision, so the repo's version comes from its `version.yml` file,
+// or else is the newest version in `repository.yml`.
+
+type snapshotState struct {
+	// The directory the repo was copied from; "" if the repo is used in
+	// place.
+	source string
+}
+
+func (ss *snapshotState) Name() string {
+	return "unversioned"
+}
+
+func (ss *snapshotState) HasHistory() bool {
+	return false
+}
+
+func (ss *snapshotState) CurrentCommit(path string) (string, error) {
+	return dirSha256(path)
+}
+
+func (ss *snapshotState) HashFor(path string, commit string) (string, error) {
+	return ss.CurrentCommit(path)
+}
+
+func (ss *snapshotState) CommitsFor(
+	path string, commit string) ([]string, error) {
+
+	hash, err := ss.CurrentCommit(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{hash}, nil
+}
+
+func (ss *snapshotState) CommitType(
+	path string, commit string) (DownloaderCommitType, error) {
+
+	return COMMIT_TYPE_HASH, nil
+}
+
+func (ss *snapshotState) UpstreamCommit(commit string) string {
+	return commit
+}
+
+func (ss *snapshotState) NormalizeCommit(commit string) string {
+	return commit
+}
+
+// A copied repo has changes if its contents differ from the directory it was
+// copied from.
+func (ss *snapshotState) AreChanges(path string) (bool, error) {
+	if ss.source == "" {
+		return false, nil
+	}
+
+	cur, err := dirSha256(path)
+	if err != nil {
+		return false, err
+	}
+	orig, err := dirSha256(ss.source)
+	if err != nil {
+		return false, err
+	}
+
+	return cur != orig, nil
+}
+
+// The time the repo's contents were last modified.
+func (ss *snapshotState) CommitTime(
+	path string, commit string) (time.Time, error) {
+
+	var latest time.Time
+	err := filepath.Walk(path,
+		func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.Mode().IsRegular() && info.ModTime().After(latest) {
+				latest = info.ModTime()
+			}
+			return nil
+		})
+	if err != nil {
+		return time.Time{}, util.ChildNewtError(err)
+	}
+
+	return latest, nil
+}
+
+func (ss *snapshotState) CommitsBetween(
+	path string, from string, to string) (int, error) {
+
+	return 0, nil
+}
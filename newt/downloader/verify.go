@@ -0,0 +1,145 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package downloader
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Calculates a digest of the contents of a directory tree.  The digest covers
+// the relative path and contents of every regular file; git metadata is
+// excluded.  The result is independent of file modification times and of the
+// host's path separator.
+func dirSha256(dir string) (string, error) {
+	// A linked local repo is a symlink to its source directory.
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", util.ChildNewtError(err)
+	}
+
+	paths := []string{}
+	err = filepath.Walk(dir,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if info.IsDir() && info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			if info.Mode().IsRegular() {
+				rel, err := filepath.Rel(dir, path)
+				if err != nil {
+					return err
+				}
+				paths = append(paths, filepath.ToSlash(rel))
+			}
+
+			return nil
+		})
+	if err != nil {
+		return "", util.ChildNewtError(err)
+	}
+
+	sort.Strings(paths)
+
+	h := sha256.New()
+	for _, path := range paths {
+		f, err := os.Open(dir + "/" + path)
+		if err != nil {
+			return "", util.ChildNewtError(err)
+		}
+
+		fh := sha256.New()
+		_, err = io.Copy(fh, f)
+		f.Close()
+		if err != nil {
+			return "", util.ChildNewtError(err)
+		}
+
+		fmt.Fprintf(h, "%s\x00%x\n", path, fh.Sum(nil))
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// Retrieves the hash of the tree object that the repo's HEAD points to.
+func headTreeHash(repoDir string) (string, error) {
+	cmd := []string{
+		"rev-parse",
+		"--verify",
+		"--quiet",
+		"HEAD^{tree}",
+	}
+	o, err := executeGitCommand(repoDir, cmd, true)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(o)), nil
+}
+
+// Verifies the contents of a repo against the digests in the repo's
+// definition.  The repo must be checked out at the commit resolved for the
+// requested version.  Verification is skipped for digests that are not
+// specified.
+func (gd *GenericDownloader) Verify(repoDir string) error {
+	if gd.Sha256 != "" {
+		sum, err := dirSha256(repoDir)
+		if err != nil {
+			return err
+		}
+
+		if !strings.EqualFold(sum, gd.Sha256) {
+			return util.FmtNewtError(
+				"Checksum mismatch for repo: expected "+
+					"sha256 %s, got %s", gd.Sha256, sum)
+		}
+
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Verified sha256 of repo: %s\n", sum)
+	}
+
+	if gd.Tree != "" {
+		tree, err := headTreeHash(repoDir)
+		if err != nil {
+			return err
+		}
+
+		if !strings.EqualFold(tree, gd.Tree) {
+			return util.FmtNewtError(
+				"Tree hash mismatch for repo: expected %s, got %s",
+				gd.Tree, tree)
+		}
+
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Verified tree hash of repo: %s\n", tree)
+	}
+
+	return nil
+}
@@ -0,0 +1,268 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package downloader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"mynewt.apache.org/newt/newt/settings"
+	"mynewt.apache.org/newt/util"
+)
+
+// In worktree mode, the git cache contains one bare repo (a "store") per
+// upstream repo.  Rather than cloning, the downloader adds a worktree of the
+// store to the project.  All projects that use the same upstream repo thus
+// share a single copy of its objects, and a fetch in one project is visible
+// to all of them.
+//
+// Branches are shared by all worktrees of a store, so worktrees are always
+// checked out with a detached HEAD.  This prevents one project's checkout or
+// upgrade from affecting another project.
+
+const WORKTREE_STORE_DIR = "worktrees"
+
+// Returns the path of the specified repo's worktree store, or "" if worktree
+// mode is disabled.
+func worktreeStorePath(publicUrl string) string {
+	if !settings.GitWorktrees() {
+		return ""
+	}
+
+	return settings.GitCacheDir() + "/" + WORKTREE_STORE_DIR + "/" +
+		mirrorName(publicUrl)
+}
+
+// Returns the path of the repo's worktree store, or "" if the repo should be
+// cloned instead.
+func (gd *GenericDownloader) worktreeStore(publicUrl string) string {
+	spath := worktreeStorePath(publicUrl)
+	if spath == "" {
+		return ""
+	}
+
+	if gd.Subdir != "" && !gitSupports(gitFeatWorktreeCfg) {
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Not using a worktree for %s; sparse checkouts in a worktree "+
+				"require git >= %s\n",
+			publicUrl, gitFeatWorktreeCfg.Ver.String())
+		return ""
+	}
+
+	if !gitSupports(gitFeatWorktree) {
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Not using a worktree for %s; git >= %s required\n",
+			publicUrl, gitFeatWorktree.Ver.String())
+		return ""
+	}
+
+	return spath
+}
+
+// Creates the specified worktree store if it doesn't exist, and ensures it
+// contains the specified remote.  The store's remotes are shared by all of its
+// worktrees.
+func ensureWorktreeStore(spath string, remote string, publicUrl string) error {
+	if util.NodeNotExist(spath) {
+		if err := os.MkdirAll(filepath.Dir(spath), os.ModePerm); err != nil {
+			return util.ChildNewtError(err)
+		}
+
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Creating shared repo for %s\n", publicUrl)
+
+		cmd := []string{"init", "--bare", "--quiet", spath}
+		if _, err := executeGitCommand(
+			filepath.Dir(spath), cmd, true); err != nil {
+
+			os.RemoveAll(spath)
+			return err
+		}
+	}
+
+	if _, err := getRemoteUrl(spath, remote); err == nil {
+		return nil
+	}
+
+	if err := addRemote(spath, remote, publicUrl, true); err != nil {
+		return err
+	}
+
+	cmd := []string{"config", "remote." + remote + ".fetch",
+		"+refs/heads/*:refs/remotes/" + remote + "/*"}
+	if _, err := executeGitCommand(spath, cmd, true); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Adds a worktree of the specified store at dstPath.  The worktree's HEAD is
+// detached at the tip of the specified remote branch.
+//
+// @param spath                 The path of the worktree store.
+// @param remote                The name of the remote to check out from.
+// @param dstPath               The path of the worktree to create.
+// @param branch                The branch to initially check out.
+// @param sparse                Whether the worktree will be a sparse
+//                                  checkout; if so, its working tree is left
+//                                  empty for initSparseCheckout() to
+//                                  populate.
+// @param fetch                 Fetches the store's remote.
+func addWorktree(spath string, remote string, dstPath string, branch string,
+	sparse bool, fetch func() error) error {
+
+	if err := fetch(); err != nil {
+		return err
+	}
+
+	// Forget worktrees whose directories have been deleted.  Otherwise, git
+	// refuses to recreate a worktree at the same location.
+	if _, err := executeGitCommand(
+		spath, []string{"worktree", "prune"}, true); err != nil {
+
+		log.Debugf("Failed to prune worktrees of %s: %s", spath, err.Error())
+	}
+
+	absPath, err := filepath.Abs(dstPath)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	cmd := []string{"worktree", "add", "--detach"}
+	if sparse {
+		cmd = append(cmd, "--no-checkout")
+	}
+	cmd = append(cmd, absPath, remote+"/"+branch)
+	if _, err := executeGitCommand(spath, cmd, true); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Indicates whether the specified repo is a linked worktree, i.e., whether it
+// shares its git directory with other checkouts.
+func isLinkedWorktree(repoDir string) bool {
+	cmd := []string{"rev-parse", "--git-dir", "--git-common-dir"}
+	o, err := executeGitCommand(repoDir, cmd, true)
+	if err != nil {
+		return false
+	}
+
+	dirs := strings.Split(strings.TrimSpace(string(o)), "\n")
+	return len(dirs) == 2 && dirs[0] != dirs[1]
+}
+
+// Enables per-worktree configuration ("git config --worktree") in the store
+// that the specified linked worktree belongs to.  With per-worktree
+// configuration enabled, git applies the store's core.bare setting to every
+// worktree unless it lives in the store's own per-worktree file, so it is
+// moved there.
+func enableWorktreeConfig(repoDir string) error {
+	cmd := []string{"rev-parse", "--git-common-dir"}
+	o, err := executeGitCommand(repoDir, cmd, true)
+	if err != nil {
+		return err
+	}
+	spath := strings.TrimSpace(string(o))
+	if !filepath.IsAbs(spath) {
+		spath = repoDir + "/" + spath
+	}
+
+	cmd = []string{"config", "--get", "extensions.worktreeConfig"}
+	if o, err := executeGitCommand(spath, cmd, true); err == nil &&
+		strings.TrimSpace(string(o)) == "true" {
+
+		return nil
+	}
+
+	for _, cmd := range [][]string{
+		{"config", "extensions.worktreeConfig", "true"},
+		{"config", "--worktree", "core.bare", "true"},
+		{"config", "--local", "--unset", "core.bare"},
+	} {
+		if _, err := executeGitCommand(spath, cmd, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Updates the links between a worktree and its store after the worktree has
+// been moved.  Repos that are not linked worktrees are left alone.
+func RepairWorktree(repoDir string) error {
+	fi, err := os.Lstat(repoDir + "/.git")
+	if err != nil || !fi.Mode().IsRegular() {
+		return nil
+	}
+
+	if !gitSupports(gitFeatWorktreeFix) {
+		return relinkWorktree(repoDir)
+	}
+
+	if _, err := executeGitCommand(
+		repoDir, []string{"worktree", "repair"}, true); err != nil {
+
+		return util.FmtNewtError(
+			"failed to repair worktree %s after moving it: %s",
+			repoDir, err.Error())
+	}
+
+	return nil
+}
+
+// Performs the equivalent of `git worktree repair` for gits that lack it:
+// points the store's record of the worktree at the worktree's new location.
+func relinkWorktree(repoDir string) error {
+	contents, err := ioutil.ReadFile(repoDir + "/.git")
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	adminDir := strings.TrimSpace(
+		strings.TrimPrefix(string(contents), "gitdir:"))
+	if adminDir == "" {
+		return util.FmtNewtError("invalid worktree link: %s/.git", repoDir)
+	}
+	if !filepath.IsAbs(adminDir) {
+		adminDir = filepath.Join(repoDir, adminDir)
+	}
+
+	absPath, err := filepath.Abs(repoDir)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	if err := ioutil.WriteFile(adminDir+"/gitdir",
+		[]byte(filepath.ToSlash(absPath)+"/.git\n"), 0644); err != nil {
+
+		return util.FmtNewtError(
+			"failed to repair worktree %s after moving it: %s",
+			repoDir, err.Error())
+	}
+
+	return nil
+}
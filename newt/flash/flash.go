@@ -36,6 +36,10 @@ import (
 	"mynewt.apache.org/newt/util"
 )
 
+// Version of the generated flash map files' format.  Increment this whenever
+// a newt change alters their contents for the same flash map.
+const FORMAT_VERSION = 1
+
 const FLASH_AREA_NAME_BOOTLOADER = "FLASH_AREA_BOOTLOADER"
 const FLASH_AREA_NAME_IMAGE_0 = "FLASH_AREA_IMAGE_0"
 const FLASH_AREA_NAME_IMAGE_1 = "FLASH_AREA_IMAGE_1"
@@ -194,6 +194,17 @@ type ImageManifest struct {
 
 	PkgSizes       []*ImageManifestSizePkg `json:"pkgsz"`
 	LoaderPkgSizes []*ImageManifestSizePkg `json:"loader_pkgsz,omitempty"`
+
+	// Device-class metadata produced by the target's attestation generators.
+	Attestation map[string]string `json:"attestation,omitempty"`
+
+	// Secondary outputs declared by the target's packages.
+	Artifacts []*ImageManifestArtifact `json:"artifacts,omitempty"`
+
+	// The signing profile that signed the image, and the SHA-256 of its
+	// public key.
+	SigningProfile string `json:"signing_profile,omitempty"`
+	SigningKeyHash string `json:"signing_key_hash,omitempty"`
 }
 
 type ImageManifestPkg struct {
@@ -201,6 +212,17 @@ type ImageManifestPkg struct {
 	Repo string `json:"repo"`
 }
 
+// A non-code file copied to the target's artifact directory.  The commit of
+// the repo it came from is listed in the manifest's "repos" field.
+type ImageManifestArtifact struct {
+	// Relative to the target's bin directory.
+	Path   string `json:"path"`
+	Kind   string `json:"kind,omitempty"`
+	Pkg    string `json:"pkg"`
+	Repo   string `json:"repo"`
+	Sha256 string `json:"sha256"`
+}
+
 type ImageManifestRepo struct {
 	Name   string `json:"name"`
 	Commit string `json:"commit"`
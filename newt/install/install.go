@@ -41,6 +41,8 @@
 //           (e.g., "0-dev")
 //     * [Git commit]:         <git-commit-ish>-commit
 //           (e.g., "0aae710654b48d9a84d54de771cc18427709df7d-commit")
+//           A pull request ref is also accepted (e.g., "pull/1234/head-commit");
+//           see downloader/pullref.go.
 //
 // The first two types (normalized version and floating version) are called
 // "version specifiers".  Version specifiers map to "official releases", while
@@ -176,15 +178,22 @@ type Installer struct {
 
 	// Required versions of installed repos, as read from `project.yml`.
 	reqs deprepo.RequirementMap
+
+	// Commits recorded in the project's lock file, indexed by repo name.
+	locked map[string]string
+
+	// Names of the repos that this installer checked out a commit in.
+	checkedOut map[string]bool
 }
 
 func NewInstaller(repos deprepo.RepoMap,
 	reqs deprepo.RequirementMap) (Installer, error) {
 
 	inst := Installer{
-		repos: repos,
-		vers:  deprepo.VersionMap{},
-		reqs:  reqs,
+		repos:      repos,
+		vers:       deprepo.VersionMap{},
+		reqs:       reqs,
+		checkedOut: map[string]bool{},
 	}
 
 	// Detect the installed versions of all repos.
@@ -202,6 +211,38 @@ func NewInstaller(repos deprepo.RepoMap,
 	return inst, nil
 }
 
+// Directs subsequent installs to check out the specified commits (indexed by
+// repo name) rather than the commits that the resolved versions map to.
+func (inst *Installer) UseLockedCommits(locked map[string]string) {
+	inst.locked = locked
+}
+
+// Returns the names of the repos that the installer checked out a commit in,
+// sorted.  Only these repos need new lock file entries.
+func (inst *Installer) CheckedOut() []string {
+	names := make([]string, 0, len(inst.checkedOut))
+	for name, _ := range inst.checkedOut {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Applies locked commits to a version map.  Repos that `project.yml` pins to
+// a specific commit keep that commit.
+func (inst *Installer) applyLockedCommits(vm deprepo.VersionMap) {
+	for name, ver := range vm {
+		commit := inst.locked[name]
+		if commit != "" && ver.Commit == "" {
+			log.Debugf("using locked commit %s for repo \"%s\"",
+				commit, name)
+			ver.Commit = commit
+			vm[name] = ver
+		}
+	}
+}
+
 // Retrieves the installed version of the specified repo.  Versions get
 // detected and cached when the installer is constructed.  This function just
 // retrieves the corresponding entry from the cache.
@@ -531,6 +572,75 @@ func (inst *Installer) installPrompt(vm deprepo.VersionMap, op installOp,
 		return true, nil
 	}
 
+	return readYesNo(true)
+}
+
+// Reports what an upgrade or sync would do to each repo in the version map
+// without modifying anything.
+func (inst *Installer) dryRunReport(vm deprepo.VersionMap, op installOp,
+	stash bool) error {
+
+	if len(vm) == 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "No changes to make\n")
+		return nil
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Dry run; the following changes would be made to the project:\n")
+
+	for _, name := range vm.SortedNames() {
+		r := inst.repos[name]
+		destVer := vm[name]
+
+		msg, err := inst.installMessageOneRepo(
+			name, op, false, inst.installedVer(name), destVer)
+		if err != nil {
+			return err
+		}
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "%s\n", msg)
+
+		p, err := r.PreviewUpdate(destVer)
+		if err != nil {
+			return err
+		}
+
+		if p.CurCommit == "" {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"        current commit: (not installed)\n")
+		} else {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"        current commit: %s\n", p.CurCommit)
+		}
+
+		if p.CurCommit == p.DestCommit {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"        new commit:     (unchanged)\n")
+		} else {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"        new commit:     %s\n", p.DestCommit)
+		}
+
+		var changes string
+		switch {
+		case !p.Changes:
+			changes = "none"
+		case op == INSTALL_OP_SYNC:
+			changes = "present; the sync fails if they conflict"
+		case stash:
+			changes = "would be stashed and re-applied"
+		default:
+			changes = "present; blocks the upgrade (use --stash)"
+		}
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"        local changes:  %s\n", changes)
+	}
+
+	return nil
+}
+
+// Reads a yes or no response from stdin.  An empty response yields the
+// specified default.
+func readYesNo(dflt bool) (bool, error) {
 	for {
 		line, more, err := bufio.NewReader(os.Stdin).ReadLine()
 		if more || err != nil {
@@ -538,7 +648,11 @@ func (inst *Installer) installPrompt(vm deprepo.VersionMap, op installOp,
 		}
 
 		trimmed := strings.ToLower(strings.TrimSpace(string(line)))
-		if len(trimmed) == 0 || strings.HasPrefix(trimmed, "y") {
+		if len(trimmed) == 0 {
+			return dflt, nil
+		}
+
+		if strings.HasPrefix(trimmed, "y") {
 			// User wants to proceed.
 			return true, nil
 		}
@@ -553,6 +667,24 @@ func (inst *Installer) installPrompt(vm deprepo.VersionMap, op installOp,
 	}
 }
 
+// Determines whether a repo's local changes should be stashed during an
+// upgrade.  If stashing wasn't requested on the command line, the user is
+// asked when the `-a` (ask) option was specified.
+func stashForUpgrade(r *repo.Repo, stash bool, ask bool) (bool, error) {
+	if stash || !ask {
+		return stash, nil
+	}
+
+	changes, err := r.HasChanges()
+	if err != nil || !changes {
+		return false, err
+	}
+
+	fmt.Printf("Repository \"%s\" contains local changes; stash them during "+
+		"the upgrade and re-apply them afterwards? (y/N): ", r.Name())
+	return readYesNo(false)
+}
+
 // Determines whether a repo version's `Commit` field should be maintained.  If
 // the commit corresponds exactly to a repo version in `repository.yml` (as
 // opposed to simply indicating its version in a `version.yml` file), then the
@@ -701,6 +833,8 @@ func (inst *Installer) Install(
 		return err
 	}
 
+	inst.applyLockedCommits(vm)
+
 	// Perform some additional filtering on the list of repos to process.
 	if !force {
 		// Don't install a repo if it is already installed (any version).  We
@@ -711,6 +845,10 @@ func (inst *Installer) Install(
 		}
 	}
 
+	if err := inst.checkNewtCompat(vm, false); err != nil {
+		return err
+	}
+
 	// Notify the user of what install operations are about to happen, and
 	// prompt if the `-a` (ask) option was specified.
 	proceed, err := inst.installPrompt(vm, INSTALL_OP_INSTALL, force, ask)
@@ -726,15 +864,29 @@ func (inst *Installer) Install(
 		return err
 	}
 
-	// For a forced install, delete all existing repos.
+	// For a forced install, delete all existing repos.  A repo that lives
+	// in a shared checkout, or below the top of its own checkout, is
+	// re-cloned along with the entire checkout.
 	if force {
+		// Checkouts that were just cloned during this invocation of newt.
+		removed := map[string]bool{}
+		for _, r := range repos {
+			if r.IsNewlyCloned() {
+				removed[r.CheckoutPath()] = true
+			}
+		}
+
 		for _, r := range repos {
 			// Don't delete the local project directory!  And don't delete a
 			// repo that was just cloned during this invocation of newt.
 			if !r.IsLocal() && !r.IsNewlyCloned() {
-				util.StatusMessage(util.VERBOSITY_DEFAULT,
-					"Removing old copy of \"%s\" (%s)\n", r.Name(), r.Path())
-				os.RemoveAll(r.Path())
+				path := r.CheckoutPath()
+				if !removed[path] {
+					util.StatusMessage(util.VERBOSITY_DEFAULT,
+						"Removing old copy of \"%s\" (%s)\n", r.Name(), path)
+					os.RemoveAll(path)
+					removed[path] = true
+				}
 				delete(inst.vers, r.Name())
 			}
 		}
@@ -746,28 +898,165 @@ func (inst *Installer) Install(
 		if err := r.Install(destVer); err != nil {
 			return err
 		}
+		inst.checkedOut[r.Name()] = true
 
 		util.StatusMessage(util.VERBOSITY_DEFAULT,
 			"%s successfully installed version %s\n",
 			r.Name(), destVer.String())
+		newtutil.SummaryAdd("Repos installed", "%s: %s",
+			r.Name(), destVer.String())
+	}
+
+	return applyPatches(candidates)
+}
+
+// Brings each repo's applied patches in line with project.yml.  This covers
+// repos whose patch list changed even though their version did not.
+func applyPatches(repos []*repo.Repo) error {
+	for _, r := range repos {
+		if err := r.ApplyPatches(); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-// Installs or upgrades the specified set of repos.
-func (inst *Installer) Upgrade(candidates []*repo.Repo, ask bool) error {
+// An installed repo whose dependency would no longer be satisfied after an
+// upgrade.
+type brokenDep struct {
+	Dependent    string
+	DependentVer newtutil.RepoVersion
+	Dep          string
+	DepVer       newtutil.RepoVersion
+	VerReqs      []newtutil.RepoVersionReq
+}
+
+func (bd *brokenDep) String() string {
+	return fmt.Sprintf("%s,%s requires %s %s (upgrade would install %s)",
+		bd.Dependent, bd.DependentVer.String(), bd.Dep,
+		newtutil.RepoVerReqsString(bd.VerReqs), bd.DepVer.String())
+}
+
+// Identifies installed repos that aren't part of the specified version map,
+// but that depend on a repo in the map at a version that the map doesn't
+// satisfy.  Leaving such a repo at its installed version would leave the
+// project in a mixed state that doesn't build.
+func (inst *Installer) brokenDependents(
+	vm deprepo.VersionMap) ([]brokenDep, error) {
+
+	var broken []brokenDep
+
+	for _, name := range inst.vers.SortedNames() {
+		if _, ok := vm[name]; ok {
+			continue
+		}
+
+		r := inst.repos[name]
+		if r == nil || r.IsLocal() {
+			continue
+		}
+
+		ver := inst.vers[name]
+		for _, d := range r.DepsForVersion(ver) {
+			newVer, ok := vm[d.Name]
+			if !ok {
+				continue
+			}
+
+			reqs, err := inst.repos[d.Name].NormalizeVerReqs(d.VerReqs)
+			if err != nil {
+				return nil, err
+			}
+
+			if !newVer.SatisfiesAll(reqs) {
+				broken = append(broken, brokenDep{
+					Dependent:    name,
+					DependentVer: ver,
+					Dep:          d.Name,
+					DepVer:       newVer,
+					VerReqs:      reqs,
+				})
+			}
+		}
+	}
+
+	return broken, nil
+}
+
+// Ensures that upgrading only some of the project's repos doesn't break the
+// repos that depend on them.  If a dependent repo's requirements would no
+// longer be met and withDependents is true, the dependent is added to the set
+// of upgraded repos and the versions are resolved again; otherwise, an error
+// is returned.
+func (inst *Installer) checkDependents(candidates []*repo.Repo,
+	vm deprepo.VersionMap, withDependents bool) (deprepo.VersionMap, error) {
+
+	for {
+		broken, err := inst.brokenDependents(vm)
+		if err != nil {
+			return nil, err
+		}
+		if len(broken) == 0 {
+			return vm, nil
+		}
+
+		if !withDependents {
+			lines := make([]string, len(broken))
+			for i, bd := range broken {
+				lines[i] = "    " + bd.String()
+			}
+			return nil, util.FmtNewtError(
+				"Upgrade would leave dependent repos with unsatisfied "+
+					"requirements:\n%s\nUpgrade the dependent repos as well, "+
+					"or specify --with-dependents.",
+				strings.Join(lines, "\n"))
+		}
+
+		for _, bd := range broken {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"Also upgrading \"%s\": %s\n", bd.Dependent, bd.String())
+			candidates = append(candidates, inst.repos[bd.Dependent])
+		}
+
+		vm, err = inst.calcVersionMap(candidates)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Installs or upgrades the specified set of repos.  If stash is true, local
+// changes in the upgraded repos are stashed and re-applied afterwards.  If
+// dryRun is true, the upgrade is only reported.
+func (inst *Installer) Upgrade(candidates []*repo.Repo, ask bool,
+	stash bool, dryRun bool) error {
+
 	vm, err := inst.calcVersionMap(candidates)
 	if err != nil {
 		return err
 	}
 
+	vm, err = inst.checkDependents(
+		candidates, vm, newtutil.NewtUpgradeDependents)
+	if err != nil {
+		return err
+	}
+
 	// Don't upgrade a repo if we already have the desired version.
 	vm, err = inst.filterUpgradeList(vm)
 	if err != nil {
 		return err
 	}
 
+	if err := inst.checkNewtCompat(vm, dryRun); err != nil {
+		return err
+	}
+
+	if dryRun {
+		return inst.dryRunReport(vm, INSTALL_OP_UPGRADE, stash)
+	}
+
 	// Notify the user of what install operations are about to happen, and
 	// prompt if the `-a` (ask) option was specified.
 	proceed, err := inst.installPrompt(vm, INSTALL_OP_UPGRADE, false, ask)
@@ -786,24 +1075,51 @@ func (inst *Installer) Upgrade(candidates []*repo.Repo, ask bool) error {
 	// Upgrade each repo in the version map.
 	for _, r := range repos {
 		destVer := vm[r.Name()]
-		if err := r.Upgrade(destVer); err != nil {
+
+		stashRepo, err := stashForUpgrade(r, stash, ask)
+		if err != nil {
 			return err
 		}
+
+		if err := r.Upgrade(destVer, stashRepo); err != nil {
+			return err
+		}
+		inst.checkedOut[r.Name()] = true
 		util.StatusMessage(util.VERBOSITY_DEFAULT,
 			"%s successfully upgraded to version %s\n",
 			r.Name(), destVer.String())
+
+		fromStr := "none"
+		if curVer := inst.installedVer(r.Name()); curVer != nil {
+			fromStr = curVer.String()
+		}
+		newtutil.SummaryAdd("Repos changed", "%s: %s -> %s",
+			r.Name(), fromStr, destVer.String())
 	}
 
-	return nil
+	return applyPatches(candidates)
 }
 
-// Syncs the specified set of repos.
-func (inst *Installer) Sync(candidates []*repo.Repo, ask bool) error {
+// Syncs the specified set of repos.  If dryRun is true, the sync is only
+// reported.
+func (inst *Installer) Sync(candidates []*repo.Repo, ask bool,
+	dryRun bool) error {
+
 	vm, err := inst.calcVersionMap(candidates)
 	if err != nil {
 		return err
 	}
 
+	if dryRun {
+		// Repos that aren't installed are skipped by a sync.
+		for name, _ := range vm {
+			if inst.installedVer(name) == nil {
+				delete(vm, name)
+			}
+		}
+		return inst.dryRunReport(vm, INSTALL_OP_SYNC, false)
+	}
+
 	// Notify the user of what install operations are about to happen, and
 	// prompt if the `-a` (ask) option was specified.
 	proceed, err := inst.installPrompt(vm, INSTALL_OP_SYNC, false, ask)
@@ -819,8 +1135,9 @@ func (inst *Installer) Sync(candidates []*repo.Repo, ask bool) error {
 		return err
 	}
 
-	// Sync each repo in the list.
-	var anyFails bool
+	// Sync the installed repos in the list concurrently.
+	toSync := []*repo.Repo{}
+	versions := map[string]newtutil.RepoVersion{}
 	for _, r := range repos {
 		ver := inst.installedVer(r.Name())
 		if ver == nil {
@@ -828,12 +1145,30 @@ func (inst *Installer) Sync(candidates []*repo.Repo, ask bool) error {
 				"No installed version of %s found, skipping\n",
 				r.Name())
 		} else {
-			if _, err := r.Sync(*ver); err != nil {
-				util.StatusMessage(util.VERBOSITY_QUIET,
-					"Failed to sync repo \"%s\": %s\n",
-					r.Name(), err.Error())
-				anyFails = true
-			}
+			toSync = append(toSync, r)
+			versions[r.Name()] = *ver
+		}
+	}
+
+	if len(toSync) == 0 {
+		return nil
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "Syncing %d repositories...\n",
+		len(toSync))
+
+	outcomes := syncRepos(toSync, versions)
+	printSyncSummary(outcomes)
+
+	var anyFails bool
+	for _, o := range outcomes {
+		if o.err != nil {
+			newtutil.SummaryAdd("Repos failed to sync", "%s", o.r.Name())
+			anyFails = true
+		} else {
+			inst.checkedOut[o.r.Name()] = true
+			newtutil.SummaryAdd("Repos synced", "%s: %s",
+				o.r.Name(), o.ver.String())
 		}
 	}
 
@@ -0,0 +1,96 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Checks that the repo versions being installed are compatible with this
+// version of newt.
+
+package install
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/compat"
+	"mynewt.apache.org/newt/newt/deprepo"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/settings"
+	"mynewt.apache.org/newt/util"
+)
+
+// Suggests where to get a newer newt.
+func NewtUpgradeText(ver newtutil.Version) string {
+	return fmt.Sprintf("Newt %s can be downloaded from %s", ver.String(),
+		settings.NewtReleaseUrl(ver))
+}
+
+// Verifies that this version of newt is compatible with the repo versions
+// about to be installed.  An incompatibility aborts the operation before any
+// repo is modified, unless the user specified --ignore-newt-compat.  During a
+// dry run, incompatibilities are only reported.
+func (inst *Installer) checkNewtCompat(vm deprepo.VersionMap,
+	dryRun bool) error {
+
+	names := make([]string, 0, len(vm))
+	for name, _ := range vm {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msgs := []string{}
+	var reqVer *newtutil.Version
+	for _, name := range names {
+		r := inst.repos[name]
+		if r == nil || r.IsLocal() {
+			continue
+		}
+
+		ver := vm[name]
+		code, msg := r.CheckNewtCompatibility(ver, newtutil.NewtVersion)
+		switch code {
+		case compat.NEWT_COMPAT_WARN:
+			util.StatusMessage(util.VERBOSITY_QUIET,
+				"WARNING: %s (%s): %s.\n", name, ver.String(), msg)
+
+		case compat.NEWT_COMPAT_ERROR:
+			msgs = append(msgs, msg)
+
+			v := r.RequiredNewtVersion(ver, newtutil.NewtVersion)
+			if v != nil && (reqVer == nil || newtutil.VerCmp(*v, *reqVer) > 0) {
+				reqVer = v
+			}
+		}
+	}
+
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	if reqVer != nil {
+		msgs = append(msgs, NewtUpgradeText(*reqVer))
+	}
+
+	if dryRun || newtutil.NewtIgnoreCompat {
+		for _, msg := range msgs {
+			util.StatusMessage(util.VERBOSITY_QUIET, "WARNING: %s\n", msg)
+		}
+		return nil
+	}
+
+	msgs = append(msgs, "Specify --ignore-newt-compat to proceed anyway")
+	return util.NewNewtError(strings.Join(msgs, "\n"))
+}
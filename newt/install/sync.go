@@ -0,0 +1,246 @@
+// Licensed to the Apache Software Foundation (ASF) under one
+// or more contributor license agreements.  See the NOTICE file
+// distributed with this work for additional information
+// regarding copyright ownership.  The ASF licenses this file
+// to you under the Apache License, Version 2.0 (the
+// "License"); you may not use this file except in compliance
+// with the License.  You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// A sync fetches and merges each repo in its own goroutine, up to the number
+// of jobs specified with `-j`.  Repos that share a git checkout (monorepos and
+// repos with the same worktree store) are synced one after another by a
+// single worker.  Nothing is printed per repo while the sync is in progress;
+// the outcome is reported in a single table once all repos are done.
+
+package install
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"mynewt.apache.org/newt/newt/downloader"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/util"
+)
+
+const (
+	SYNC_STATUS_UPDATED   = "updated"
+	SYNC_STATUS_UNCHANGED = "unchanged"
+	SYNC_STATUS_FAILED    = "failed"
+)
+
+// The outcome of syncing one repo.
+type syncOutcome struct {
+	r   *repo.Repo
+	ver newtutil.RepoVersion
+	res repo.SyncResult
+	err error
+}
+
+func (so *syncOutcome) status() string {
+	switch {
+	case so.err != nil:
+		return SYNC_STATUS_FAILED
+	case so.res.OldCommit == so.res.NewCommit:
+		return SYNC_STATUS_UNCHANGED
+	default:
+		return SYNC_STATUS_UPDATED
+	}
+}
+
+// Abbreviates a commit hash for display.
+func shortCommit(commit string) string {
+	if commit == "" {
+		return "-"
+	}
+	if len(commit) > 10 {
+		return commit[:10]
+	}
+	return commit
+}
+
+// Returns the first non-blank line of a message.
+func firstLine(msg string) string {
+	for _, line := range strings.Split(msg, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// Partitions the repos into groups that can be synced concurrently with one
+// another.  The repos within a group share a checkout.
+func syncGroups(repos []*repo.Repo) [][]*repo.Repo {
+	groupMap := map[string][]*repo.Repo{}
+	keys := []string{}
+
+	for _, r := range repos {
+		key := r.CheckoutGroup()
+		if _, ok := groupMap[key]; !ok {
+			keys = append(keys, key)
+		}
+		groupMap[key] = append(groupMap[key], r)
+	}
+
+	groups := make([][]*repo.Repo, len(keys))
+	for i, key := range keys {
+		groups[i] = groupMap[key]
+	}
+
+	return groups
+}
+
+// Syncs each group of repos received from the jobs channel.  Unlike a build,
+// a failed repo doesn't stop the others from being synced.
+func syncWorker(jobs <-chan []*repo.Repo,
+	versions map[string]newtutil.RepoVersion,
+	results chan<- []syncOutcome) {
+
+	for group := range jobs {
+		outcomes := make([]syncOutcome, len(group))
+		for i, r := range group {
+			ver := versions[r.Name()]
+			res, err := r.Sync(ver)
+			outcomes[i] = syncOutcome{
+				r:   r,
+				ver: ver,
+				res: res,
+				err: err,
+			}
+		}
+		results <- outcomes
+	}
+}
+
+// Syncs the specified repos concurrently.  Each repo is synced to the
+// corresponding entry in the versions map.
+func syncRepos(repos []*repo.Repo,
+	versions map[string]newtutil.RepoVersion) []syncOutcome {
+
+	groups := syncGroups(repos)
+
+	numWorkers := newtutil.NewtNumJobs
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+	if numWorkers > len(groups) {
+		numWorkers = len(groups)
+	}
+
+	jobs := make(chan []*repo.Repo, len(groups))
+	for _, g := range groups {
+		jobs <- g
+	}
+	close(jobs)
+
+	results := make(chan []syncOutcome, len(groups))
+
+	// Concurrent repos can't report their progress legibly.
+	if numWorkers > 1 {
+		downloader.QuietProgress = true
+		defer func() { downloader.QuietProgress = false }()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			syncWorker(jobs, versions, results)
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	outcomeMap := map[string]syncOutcome{}
+	names := []string{}
+	for outcomes := range results {
+		for _, o := range outcomes {
+			outcomeMap[o.r.Name()] = o
+			names = append(names, o.r.Name())
+		}
+	}
+	sort.Strings(names)
+
+	sorted := make([]syncOutcome, len(names))
+	for i, name := range names {
+		sorted[i] = outcomeMap[name]
+	}
+
+	return sorted
+}
+
+// Prints a table summarizing the result of a sync, one row per repo.
+func printSyncSummary(outcomes []syncOutcome) {
+	header := []string{"REPO", "COMMIT", "STATUS", "WARNINGS"}
+	rows := [][]string{}
+
+	for _, o := range outcomes {
+		commit := shortCommit(o.res.OldCommit)
+		if o.res.NewCommit != "" && o.res.NewCommit != o.res.OldCommit {
+			commit += " -> " + shortCommit(o.res.NewCommit)
+		}
+
+		// Errors are often multi-line git output; only the first line fits
+		// in the table.  The full text is printed after it.
+		notes := append([]string{}, o.res.Warnings...)
+		if o.err != nil {
+			notes = append(notes, firstLine(o.err.Error()))
+		}
+
+		rows = append(rows, []string{
+			o.r.Name(),
+			commit,
+			o.status(),
+			strings.Join(notes, "; "),
+		})
+	}
+
+	widths := make([]int, len(header))
+	for _, row := range append([][]string{header}, rows...) {
+		for i, cell := range row {
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+
+	printRow := func(row []string) {
+		line := ""
+		for i, cell := range row {
+			if i == len(row)-1 {
+				line += cell
+			} else {
+				line += fmt.Sprintf("%-*s  ", widths[i], cell)
+			}
+		}
+		util.StatusMessage(util.VERBOSITY_QUIET, "%s\n",
+			strings.TrimRight(line, " "))
+	}
+
+	printRow(header)
+	for _, row := range rows {
+		printRow(row)
+	}
+
+	for _, o := range outcomes {
+		if o.err != nil {
+			util.StatusMessage(util.VERBOSITY_QUIET,
+				"Failed to sync repo \"%s\": %s\n",
+				o.r.Name(), strings.TrimSpace(o.err.Error()))
+		}
+	}
+}
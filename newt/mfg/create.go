@@ -30,6 +30,7 @@ import (
 
 	"mynewt.apache.org/newt/newt/builder"
 	"mynewt.apache.org/newt/newt/flash"
+	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/target"
 	"mynewt.apache.org/newt/util"
@@ -110,6 +111,36 @@ func (mi *MfgImage) partFromImage(
 	return part, nil
 }
 
+// Writes a boot trailer to the end of the specified slot 0 part, marking its
+// image as confirmed.  This allows a factory-programmed device to boot the
+// image permanently without an "image confirm" step.
+func (mi *MfgImage) confirmImagePart(part *mfgPart) error {
+	b, err := builder.NewTargetBuilder(mi.images[0])
+	if err != nil {
+		return err
+	}
+
+	trailer, err := b.FirstBootTrailer()
+	if err != nil {
+		return err
+	}
+
+	// The part has already been padded to the size of its flash area.
+	trailerOff := len(part.data) - len(trailer)
+	for _, c := range part.data[trailerOff:] {
+		if c != 0xff {
+			return util.FmtNewtError(
+				"Image in %s leaves no room for a boot trailer", part.name)
+		}
+	}
+	copy(part.data[trailerOff:], trailer)
+
+	util.StatusMessage(util.VERBOSITY_VERBOSE,
+		"Marking image in %s as confirmed\n", part.name)
+
+	return nil
+}
+
 func partFromRawEntry(entry MfgRawEntry, entryIdx int) mfgPart {
 	return mfgPart{
 		name:   fmt.Sprintf("entry-%d (%s)", entryIdx, entry.filename),
@@ -144,6 +175,13 @@ func (mi *MfgImage) targetParts() ([]mfgPart, error) {
 			if err != nil {
 				return nil, err
 			}
+
+			if i == 0 && mi.images[0].ImageConfirm {
+				if err := mi.confirmImagePart(&part); err != nil {
+					return nil, err
+				}
+			}
+
 			parts = append(parts, part)
 		}
 	}
@@ -453,7 +491,7 @@ func (mi *MfgImage) build() (createState, error) {
 
 func (mi *MfgImage) createManifest(cs createState) ([]byte, error) {
 	manifest := mfgManifest{
-		BuildTime:   time.Now().Format(time.RFC3339),
+		BuildTime:   newtutil.BuildTime().Format(time.RFC3339),
 		Version:     mi.version.String(),
 		MfgHash:     fmt.Sprintf("%x", cs.hash),
 		MetaSection: 0,
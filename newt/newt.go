@@ -23,12 +23,16 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/spf13/cobra"
 
 	"mynewt.apache.org/newt/newt/cli"
+	"mynewt.apache.org/newt/newt/downloader"
 	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/newt/settings"
 	"mynewt.apache.org/newt/util"
 )
 
@@ -38,6 +42,8 @@ var newtQuiet bool
 var newtVerbose bool
 var newtLogFile string
 var newtNumJobs int
+var newtGitTimeout int
+var newtHangTimeout int
 var newtHelp bool
 
 func newtDfltNumJobs() int {
@@ -77,6 +83,10 @@ func newtCmd() *cobra.Command {
 		Long:    newtHelpText,
 		Example: newtHelpEx,
 		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			// Apply the profile first so that it can set the output flags
+			// (e.g., --verbose, --loglevel) too.
+			cli.ApplyProfileFlags(cmd)
+
 			verbosity := util.VERBOSITY_DEFAULT
 			if newtSilent {
 				verbosity = util.VERBOSITY_SILENT
@@ -97,7 +107,26 @@ func newtCmd() *cobra.Command {
 				cli.NewtUsage(nil, err)
 			}
 
+			if !cmd.Flags().Changed("jobs") {
+				if n := settings.BuildJobs(); n > 0 {
+					newtNumJobs = n
+				}
+			}
+			if newtNumJobs < 1 {
+				cli.NewtUsage(nil, util.FmtNewtError(
+					"Invalid job count: %d; must be at least 1", newtNumJobs))
+			}
 			newtutil.NewtNumJobs = newtNumJobs
+			downloader.GitTimeoutSecs = newtGitTimeout
+
+			hangSecs := newtHangTimeout
+			if hangSecs < 0 {
+				hangSecs = settings.HangTimeout()
+			}
+			util.HangTimeout = time.Duration(hangSecs) * time.Second
+
+			repo.DescCacheTTL = time.Duration(settings.MetadataCacheTTL()) *
+				time.Second
 		},
 		Run: func(cmd *cobra.Command, args []string) {
 			cmd.Help()
@@ -115,7 +144,22 @@ func newtCmd() *cobra.Command {
 	newtCmd.PersistentFlags().StringVarP(&newtLogFile, "outfile", "o",
 		"", "Filename to tee output to")
 	newtCmd.PersistentFlags().IntVarP(&newtNumJobs, "jobs", "j",
-		newtDfltNumJobs(), "Number of concurrent build jobs")
+		newtDfltNumJobs(), "Number of concurrent build jobs; overrides the "+
+			"build.jobs setting")
+	newtCmd.PersistentFlags().IntVar(&newtGitTimeout, "git-timeout", -1,
+		"Seconds before a git operation is aborted (0 = no limit; "+
+			"default: git.timeout setting)")
+	newtCmd.PersistentFlags().IntVar(&newtHangTimeout, "hang-timeout", -1,
+		"Seconds an external command may run without producing output "+
+			"before it is killed (0 = no limit; default: "+
+			"exec.hang_timeout setting)")
+	newtCmd.PersistentFlags().BoolVar(&newtutil.NewtIgnoreVersion,
+		"ignore-newt-version", false,
+		"Run even if this newt doesn't satisfy the project's newt_version")
+	newtCmd.PersistentFlags().StringVar(&newtutil.NewtProfile, "profile",
+		os.Getenv(newtutil.NEWT_PROFILE_ENV),
+		"Apply the named profile from project.yml (default: $"+
+			newtutil.NEWT_PROFILE_ENV+")")
 	newtCmd.PersistentFlags().BoolVarP(&newtHelp, "help", "h",
 		false, "Help for newt commands")
 
@@ -139,14 +183,27 @@ func newtCmd() *cobra.Command {
 func main() {
 	cmd := newtCmd()
 
+	cli.AddAuditCommands(cmd)
+	cli.AddBspCommands(cmd)
 	cli.AddBuildCommands(cmd)
 	cli.AddCompleteCommands(cmd)
+	cli.AddExamplesCommands(cmd)
 	cli.AddImageCommands(cmd)
 	cli.AddPackageCommands(cmd)
+	cli.AddPathCommands(cmd)
 	cli.AddProjectCommands(cmd)
+	cli.AddReleaseCommands(cmd)
+	cli.AddRepoCommands(cmd)
 	cli.AddRunCommands(cmd)
+	cli.AddSearchCommands(cmd)
+	cli.AddSettingsCommands(cmd)
+	cli.AddSetupCommands(cmd)
+	cli.AddSnapshotCommands(cmd)
+	cli.AddSupportCommands(cmd)
 	cli.AddTargetCommands(cmd)
 	cli.AddValsCommands(cmd)
+	cli.AddVendorCommands(cmd)
+	cli.AddWorkspaceCommands(cmd)
 	cli.AddMfgCommands(cmd)
 
 	/* only pass the first two args to check for complete command */
@@ -22,8 +22,12 @@ package newtutil
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"mynewt.apache.org/newt/newt/interfaces"
 	"mynewt.apache.org/newt/newt/ycfg"
@@ -37,6 +41,19 @@ var NewtBlinkyTag string = "master"
 var NewtNumJobs int
 var NewtForce bool
 var NewtAsk bool
+var NewtStash bool
+var NewtDryRun bool
+var NewtIgnoreCompat bool
+var NewtIgnoreVersion bool
+var NewtFrozen bool
+var NewtUpgradeDependents bool
+
+// The project profile selected with --profile (see project/profile.go).
+var NewtProfile string
+
+// The environment variable that selects a profile when --profile isn't
+// specified.
+const NEWT_PROFILE_ENV = "NEWT_PROFILE"
 
 const CORE_REPO_NAME string = "apache-mynewt-core"
 const ARDUINO_ZERO_REPO_NAME string = "mynewt_arduino_zero"
@@ -160,9 +177,31 @@ func BuildPackageString(repoName string, pkgName string) string {
 	}
 }
 
+// Cleans a slash-separated path that is meant to be relative to some
+// directory.
+//
+// @return string               The cleaned path.
+//         error                If the path is absolute or leads outside the
+//                                  directory.
+func CleanRelPath(relPath string) (string, error) {
+	clean := path.Clean(filepath.ToSlash(relPath))
+	if path.IsAbs(clean) || filepath.IsAbs(relPath) ||
+		clean == ".." || strings.HasPrefix(clean, "../") {
+
+		return "", util.FmtNewtError(
+			"path \"%s\" is absolute or leads outside its directory",
+			relPath)
+	}
+
+	return clean, nil
+}
+
+// The preamble written at the top of every generated source file.  It
+// deliberately omits the newt version: a generated file only changes when its
+// contents change, so upgrading newt doesn't force a rebuild of everything
+// that includes it.
 func GeneratedPreamble() string {
-	return fmt.Sprintf("/**\n * This file was generated by %s\n */\n\n",
-		NewtVersionStr)
+	return "/**\n * This file was generated by Apache Newt\n */\n\n"
 }
 
 // Creates a temporary directory for downloading a repo.
@@ -196,3 +235,29 @@ func ReadConfigPath(path string) (ycfg.YCfg, error) {
 func ReadConfig(dir string, filename string) (ycfg.YCfg, error) {
 	return ReadConfigPath(dir + "/" + filename + ".yml")
 }
+
+// Returns the time specified by the SOURCE_DATE_EPOCH environment variable
+// (seconds since the Unix epoch); false if the variable is unset or invalid.
+// Reproducible builds use it in place of the current time.
+func SourceDateEpoch() (time.Time, bool) {
+	s := os.Getenv("SOURCE_DATE_EPOCH")
+	if s == "" {
+		return time.Time{}, false
+	}
+
+	secs, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(secs, 0).UTC(), true
+}
+
+// Returns the time to record as a build's creation time: SOURCE_DATE_EPOCH if
+// it is set; the current time otherwise.
+func BuildTime() time.Time {
+	if t, ok := SourceDateEpoch(); ok {
+		return t
+	}
+	return time.Now()
+}
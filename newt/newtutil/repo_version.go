@@ -220,6 +220,53 @@ func ParseRepoVersion(verStr string) (RepoVersion, error) {
 	return ver, nil
 }
 
+// Parses the operand of a "~" or "^" range constraint and expands the range
+// into a pair of version constraints.  Unspecified parts of the version are
+// zero.
+//    ~1.10   -->  >=1.10.0 <1.11.0
+//    ~1.10.2 -->  >=1.10.2 <1.11.0
+//    ~1      -->  >=1.0.0 <2.0.0
+//    ^1.2.3  -->  >=1.2.3 <2.0.0
+//    ^0.2.3  -->  >=0.2.3 <0.3.0
+func parseRangeReqs(op string, verStr string) ([]RepoVersionReq, error) {
+	parts := strings.Split(verStr, ".")
+	if len(parts) > 3 {
+		return nil, util.FmtNewtError("Invalid version string: %s", verStr)
+	}
+
+	nums := []int64{0, 0, 0}
+	for i, p := range parts {
+		n, err := strconv.ParseInt(p, 10, 64)
+		if err != nil {
+			return nil, util.FmtNewtError(
+				"Invalid version string: %s", verStr)
+		}
+		nums[i] = n
+	}
+
+	lo := RepoVersion{Major: nums[0], Minor: nums[1], Revision: nums[2]}
+	hi := RepoVersion{}
+
+	switch {
+	case op == "~" && len(parts) == 1:
+		hi.Major = lo.Major + 1
+	case op == "~":
+		hi.Major = lo.Major
+		hi.Minor = lo.Minor + 1
+	case lo.Major != 0:
+		hi.Major = lo.Major + 1
+	case lo.Minor != 0:
+		hi.Minor = lo.Minor + 1
+	default:
+		hi.Revision = lo.Revision + 1
+	}
+
+	return []RepoVersionReq{
+		RepoVersionReq{CompareType: ">=", Ver: lo},
+		RepoVersionReq{CompareType: "<", Ver: hi},
+	}, nil
+}
+
 // Parse a set of version string constraints on a dependency.
 // This function
 // The version string contains a list of version constraints in the following format:
@@ -228,12 +275,20 @@ func ParseRepoVersion(verStr string) (RepoVersion, error) {
 //   operators: <=, <, >, >=, ==
 // And <version> is specified in the form: X.Y.Z where X, Y and Z are all
 // int64 types in decimal form
+//
+// A constraint can also be a range:
+//    - ~<version>: Allows changes to the revision (or to the minor number, if
+//      only a major number is specified).  E.g., "~1.10".
+//    - ^<version>: Allows changes that don't modify the left-most non-zero
+//      part of the version.  E.g., "^1.2.3".
+// Constraints are separated by whitespace and must all be satisfied, e.g.,
+// ">=1.9.0 <2.0.0".
 func ParseRepoVersionReqs(versStr string) ([]RepoVersionReq, error) {
 	var err error
 
 	verReqs := []RepoVersionReq{}
 
-	re, err := regexp.Compile(`(<=|>=|==|>|<)([\d\.]+)`)
+	re, err := regexp.Compile(`(<=|>=|==|>|<|~|\^)([\d\.]+)`)
 	if err != nil {
 		return nil, err
 	}
@@ -241,6 +296,15 @@ func ParseRepoVersionReqs(versStr string) ([]RepoVersionReq, error) {
 	matches := re.FindAllStringSubmatch(versStr, -1)
 	if matches != nil {
 		for _, match := range matches {
+			if match[1] == "~" || match[1] == "^" {
+				rangeReqs, err := parseRangeReqs(match[1], match[2])
+				if err != nil {
+					return nil, err
+				}
+				verReqs = append(verReqs, rangeReqs...)
+				continue
+			}
+
 			vm := RepoVersionReq{}
 			vm.CompareType = match[1]
 			if vm.Ver, err = ParseRepoVersion(match[2]); err != nil {
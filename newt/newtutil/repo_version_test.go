@@ -0,0 +1,101 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package newtutil
+
+import (
+	"testing"
+)
+
+func TestParseRepoVersionReqs(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "1.2.3", want: "==1.2.3"},
+		{in: ">=1.9.0 <2.0.0", want: ">=1.9.0 <2.0.0"},
+		{in: "==0.0.0", want: "==0.0.0"},
+		{in: "~1.10", want: ">=1.10.0 <1.11.0"},
+		{in: "~1.10.2", want: ">=1.10.2 <1.11.0"},
+		{in: "~1", want: ">=1.0.0 <2.0.0"},
+		{in: "^1.2.3", want: ">=1.2.3 <2.0.0"},
+		{in: "^0.2.3", want: ">=0.2.3 <0.3.0"},
+		{in: "^0.0.3", want: ">=0.0.3 <0.0.4"},
+		{in: "^1.2.3 <1.5.0", want: ">=1.2.3 <2.0.0 <1.5.0"},
+		{in: "~1.2.3.4", wantErr: true},
+		{in: "1.2", wantErr: true},
+		{in: "bogus", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		reqs, err := ParseRepoVersionReqs(tc.in)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseRepoVersionReqs(%q): expected error, got %s",
+					tc.in, RepoVerReqsString(reqs))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRepoVersionReqs(%q): unexpected error: %s",
+				tc.in, err.Error())
+			continue
+		}
+
+		if got := RepoVerReqsString(reqs); got != tc.want {
+			t.Errorf("ParseRepoVersionReqs(%q)=%q, want %q",
+				tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestRepoVersionSatisfiesAll(t *testing.T) {
+	tests := []struct {
+		ver  string
+		reqs string
+		want bool
+	}{
+		{"1.10.0", "~1.10", true},
+		{"1.10.9", "~1.10", true},
+		{"1.11.0", "~1.10", false},
+		{"1.9.9", "~1.10", false},
+		{"1.9.0", "^1.2.3", true},
+		{"2.0.0", "^1.2.3", false},
+		{"0.2.9", "^0.2.3", true},
+		{"0.3.0", "^0.2.3", false},
+		{"1.5.0", ">=1.0.0 <1.5.0", false},
+	}
+
+	for _, tc := range tests {
+		ver, err := ParseRepoVersion(tc.ver)
+		if err != nil {
+			t.Fatalf("ParseRepoVersion(%q): %s", tc.ver, err.Error())
+		}
+		reqs, err := ParseRepoVersionReqs(tc.reqs)
+		if err != nil {
+			t.Fatalf("ParseRepoVersionReqs(%q): %s", tc.reqs, err.Error())
+		}
+
+		if got := ver.SatisfiesAll(reqs); got != tc.want {
+			t.Errorf("%s satisfies %q: got %v, want %v",
+				tc.ver, tc.reqs, got, tc.want)
+		}
+	}
+}
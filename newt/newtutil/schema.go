@@ -0,0 +1,267 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Schema validation for newt's own YAML files (`project.yml`,
+// `repository.yml`).  Problems are reported against the file and line on
+// which they occur, so that a typo is caught when the file is read rather
+// than surfacing later as an obscure downloader or git error.
+
+package newtutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/util"
+)
+
+type SchemaIssue struct {
+	Path  string
+	Line  int
+	Text  string
+	Fatal bool
+}
+
+// Accumulates the problems found in a single YAML file.
+type SchemaChecker struct {
+	Path   string
+	Issues []SchemaIssue
+
+	lines []string
+}
+
+type schemaIssueSorter []SchemaIssue
+
+func (s schemaIssueSorter) Len() int {
+	return len(s)
+}
+func (s schemaIssueSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s schemaIssueSorter) Less(i, j int) bool {
+	return s[i].Line < s[j].Line
+}
+
+// Warnings that have already been printed.  A file may be read several times
+// in a single run; each warning is only reported once.
+var schemaWarned = map[string]bool{}
+var schemaWarnedMtx sync.Mutex
+
+func (si SchemaIssue) String() string {
+	if si.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", si.Path, si.Line, si.Text)
+	} else {
+		return fmt.Sprintf("%s: %s", si.Path, si.Text)
+	}
+}
+
+func NewSchemaChecker(path string) *SchemaChecker {
+	sc := &SchemaChecker{
+		Path: path,
+	}
+
+	// Line information is a nicety; validation proceeds without it if the
+	// file can't be read.
+	if b, err := ioutil.ReadFile(path); err == nil {
+		sc.lines = strings.Split(string(b), "\n")
+	}
+
+	return sc
+}
+
+// Indicates whether a line of YAML defines the specified key.
+func lineDefinesKey(line string, key string) bool {
+	t := strings.TrimSpace(line)
+	t = strings.TrimPrefix(t, "- ")
+
+	for _, q := range []string{"", "\"", "'"} {
+		prefix := q + key + q
+		if strings.HasPrefix(t, prefix) &&
+			strings.HasPrefix(strings.TrimSpace(t[len(prefix):]), ":") {
+
+			return true
+		}
+	}
+
+	return false
+}
+
+func (sc *SchemaChecker) findKey(start int, key string) int {
+	for i := start; i < len(sc.lines); i++ {
+		if strings.HasPrefix(strings.TrimSpace(sc.lines[i]), "#") {
+			continue
+		}
+		if lineDefinesKey(sc.lines[i], key) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Returns the 1-based line number on which the specified key is defined, or 0
+// if it can't be located.  Each element of `keys` is searched for beneath the
+// previous one, so a nested key is found within its parent.  A dotted key
+// (e.g., "repository.apache-mynewt-core") matches either its literal form or
+// the equivalent nested maps.
+func (sc *SchemaChecker) KeyLine(keys ...string) int {
+	idx := 0
+	for _, key := range keys {
+		next := sc.findKey(idx, key)
+		if next == -1 {
+			next = idx
+			for _, part := range strings.Split(key, ".") {
+				next = sc.findKey(next, part)
+				if next == -1 {
+					return 0
+				}
+			}
+		}
+		idx = next
+	}
+
+	return idx + 1
+}
+
+func (sc *SchemaChecker) add(fatal bool, keys []string, format string,
+	args ...interface{}) {
+
+	sc.Issues = append(sc.Issues, SchemaIssue{
+		Path:  sc.Path,
+		Line:  sc.KeyLine(keys...),
+		Text:  fmt.Sprintf(format, args...),
+		Fatal: fatal,
+	})
+}
+
+// Records a problem that doesn't prevent the file from being used.  `keys` is
+// the path to the offending key.
+func (sc *SchemaChecker) Warnf(keys []string, format string,
+	args ...interface{}) {
+
+	sc.add(false, keys, format, args...)
+}
+
+// Records a problem that prevents the file from being used.  `keys` is the
+// path to the offending key.
+func (sc *SchemaChecker) Errorf(keys []string, format string,
+	args ...interface{}) {
+
+	sc.add(true, keys, format, args...)
+}
+
+// Warns about each key in `m` that is not in the `known` list.
+func (sc *SchemaChecker) CheckKeys(parent []string, m map[string]interface{},
+	known []string) {
+
+	knownMap := map[string]bool{}
+	for _, k := range known {
+		knownMap[k] = true
+	}
+
+	for k, _ := range m {
+		if !knownMap[k] {
+			keys := append(append([]string{}, parent...), k)
+			sc.Warnf(keys, "unknown key \"%s\"", strings.Join(keys, "."))
+		}
+	}
+}
+
+// Prints the accumulated warnings and returns an error describing the fatal
+// problems, if any.
+func (sc *SchemaChecker) Report() error {
+	sort.Stable(schemaIssueSorter(sc.Issues))
+
+	schemaWarnedMtx.Lock()
+	defer schemaWarnedMtx.Unlock()
+
+	errs := []string{}
+	for _, si := range sc.Issues {
+		s := si.String()
+		if si.Fatal {
+			errs = append(errs, "    "+s)
+		} else if !schemaWarned[s] {
+			schemaWarned[s] = true
+			util.StatusMessage(util.VERBOSITY_QUIET, "* Warning: %s\n", s)
+		}
+	}
+
+	if len(errs) > 0 {
+		return util.FmtNewtError("Invalid %s:\n%s",
+			sc.Path, strings.Join(errs, "\n"))
+	}
+
+	return nil
+}
+
+// Verifies that a string is usable as a git commit specifier (a branch, tag,
+// or hash).  This is a subset of the rules enforced by
+// `git check-ref-format`.
+func ValidateCommitSpec(spec string) error {
+	if spec == "" {
+		return util.NewNewtError("empty commit")
+	}
+
+	if strings.HasPrefix(spec, "-") || strings.HasPrefix(spec, "/") ||
+		strings.HasSuffix(spec, "/") || strings.HasSuffix(spec, ".") ||
+		strings.HasSuffix(spec, ".lock") {
+
+		return util.FmtNewtError("invalid commit \"%s\"", spec)
+	}
+
+	for _, bad := range []string{"..", "//", "@{"} {
+		if strings.Contains(spec, bad) {
+			return util.FmtNewtError(
+				"invalid commit \"%s\": contains \"%s\"", spec, bad)
+		}
+	}
+
+	for _, c := range spec {
+		if c <= ' ' || c == 0x7f || strings.ContainsRune("~^:?*[\\", c) {
+			return util.FmtNewtError(
+				"invalid commit \"%s\": contains '%c'", spec, c)
+		}
+	}
+
+	return nil
+}
+
+// Expands top-level maps into dotted keys, e.g., `repo: { name: x }` becomes
+// `repo.name: x`.  Newt accepts either form in its YAML files.
+func FlattenTopLevel(m map[string]interface{}) map[string]interface{} {
+	flat := map[string]interface{}{}
+	for k, v := range m {
+		if !strings.Contains(k, ".") {
+			if sub, err := cast.ToStringMapE(v); err == nil {
+				for sk, sv := range sub {
+					flat[k+"."+sk] = sv
+				}
+				continue
+			}
+		}
+		flat[k] = v
+	}
+
+	return flat
+}
@@ -0,0 +1,76 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package newtutil
+
+import (
+	"fmt"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// A run summary lists the outcomes of a multi-step command (repos changed,
+// targets built, artifacts produced, etc.) in a compact block at the end of
+// the command's output, where they aren't buried by progress messages.
+
+type summarySection struct {
+	title string
+	items []string
+}
+
+var summarySections []*summarySection
+
+// Adds an item to the specified section of the run summary.  Sections are
+// printed in the order they are first added to.
+func SummaryAdd(title string, format string, args ...interface{}) {
+	item := fmt.Sprintf(format, args...)
+
+	for _, sec := range summarySections {
+		if sec.title == title {
+			sec.items = append(sec.items, item)
+			return
+		}
+	}
+
+	summarySections = append(summarySections, &summarySection{
+		title: title,
+		items: []string{item},
+	})
+}
+
+// Prints the run summary, if anything has been added to it, and clears it.
+func PrintSummary() {
+	if len(summarySections) == 0 {
+		return
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT, "\nSummary:\n")
+	for _, sec := range summarySections {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    %s:\n", sec.title)
+		for _, item := range sec.items {
+			util.StatusMessage(util.VERBOSITY_DEFAULT, "        %s\n", item)
+		}
+	}
+
+	if n := util.WarningCount(); n > 0 {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "    Warnings: %d\n", n)
+	}
+
+	summarySections = nil
+}
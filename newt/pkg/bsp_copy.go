@@ -0,0 +1,261 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package pkg
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+)
+
+// A file in a copied BSP that typically needs to be edited for the new board.
+type BspEditHint struct {
+	// Relative to the new BSP's directory.
+	Path    string
+	Reasons []string
+}
+
+type bspEditRule struct {
+	reason string
+	exts   []string
+	// Nil means every file with a matching extension needs editing.
+	re *regexp.Regexp
+}
+
+var bspEditRules = []bspEditRule{
+	{
+		reason: "flash map",
+		exts:   []string{".yml"},
+		re:     regexp.MustCompile(`bsp\.flash_map`),
+	},
+	{
+		reason: "memory regions",
+		exts:   []string{".ld"},
+	},
+	{
+		reason: "pin assignments",
+		exts:   []string{".c", ".h", ".yml"},
+		re:     regexp.MustCompile(`(?i)(^|[^a-z])pins?([^a-z]|$)`),
+	},
+	{
+		reason: "clock configuration",
+		exts:   []string{".c", ".h", ".yml"},
+		re: regexp.MustCompile(
+			`(?i)(clock|xtal|oscillator|lfclk|hfclk|sysclk|pll)`),
+	},
+	{
+		reason: "debugger scripts",
+		exts:   []string{".sh", ".cmd", ".gdb", ".jlink"},
+	},
+}
+
+// Files in which the BSP's short name (e.g., "nrf52dk") is replaced with the
+// new one.  Other files, C sources in particular, tend to use the name in
+// unrelated identifiers.
+var bspRenameExts = []string{".yml", ".sh", ".cmd", ".gdb", ".jlink"}
+
+func hasExt(path string, exts []string) bool {
+	ext := filepath.Ext(path)
+	for _, e := range exts {
+		if ext == e {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Replaces whole-word occurrences of `from` with `to`.  Underscores count as
+// word boundaries so that names such as "nrf52dk_debug.sh" are replaced.
+func replaceWord(s string, from string, to string) string {
+	re := regexp.MustCompile(`(^|[^A-Za-z0-9])` + regexp.QuoteMeta(from) +
+		`([^A-Za-z0-9]|$)`)
+
+	// Matches of adjacent words overlap; repeat until there are none left.
+	for {
+		r := re.ReplaceAllString(s, "${1}"+to+"${2}")
+		if r == s {
+			return r
+		}
+		s = r
+	}
+}
+
+// Qualifies package-relative paths (e.g., "hw/mcu/nordic") that refer to the
+// source repo with the repo's name.  Unqualified names in a package's YAML
+// files are resolved in the package's own repo, which changes when the BSP is
+// copied to a different repo.
+func qualifyRepoPaths(s string, srcRepo interfaces.RepoInterface,
+	dstName string) string {
+
+	re := regexp.MustCompile(`(^|[\s"'\[,])([A-Za-z0-9_][\w.\-]*/[\w.\-/]*)`)
+	return re.ReplaceAllStringFunc(s, func(m string) string {
+		sub := re.FindStringSubmatch(m)
+		path := sub[2]
+		if path == dstName || strings.HasPrefix(path, dstName+"/") {
+			return m
+		}
+		if !util.NodeExist(srcRepo.Path() + "/" + path) {
+			return m
+		}
+
+		// '@' can't start a plain YAML scalar.
+		qualified := newtutil.BuildPackageString(srcRepo.Name(), path)
+		if sub[1] != "\"" && sub[1] != "'" {
+			qualified = "\"" + qualified + "\""
+		}
+
+		return sub[1] + qualified
+	})
+}
+
+// Renames each file and directory under `dir` whose name contains `from`.
+func renameBspFiles(dir string, from string, to string) error {
+	paths := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo,
+		err error) error {
+
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.Contains(info.Name(), from) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	// Rename the deepest paths first so that renaming a directory doesn't
+	// invalidate the paths beneath it.
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+	for _, path := range paths {
+		newPath := filepath.Join(filepath.Dir(path),
+			strings.Replace(filepath.Base(path), from, to, -1))
+		if err := os.Rename(path, newPath); err != nil {
+			return util.ChildNewtError(err)
+		}
+	}
+
+	return nil
+}
+
+// Copies the BSP package `src` to `dstPath` and rewrites it as the package
+// `dstName` in `dstRepo`.  References to the BSP's name are updated, and
+// references to packages in the source repo are qualified with the repo's
+// name if the copy is made in a different repo.
+//
+// @return []BspEditHint        The files in the new BSP that most likely need
+//                                  to be edited for the new board.
+func CopyBsp(src *LocalPackage, dstRepo interfaces.RepoInterface,
+	dstName string, dstPath string) ([]BspEditHint, error) {
+
+	if src.Type() != PACKAGE_TYPE_BSP {
+		return nil, util.FmtNewtError("package \"%s\" is not a BSP",
+			src.FullName())
+	}
+
+	if err := util.CopyDir(src.BasePath(), dstPath); err != nil {
+		return nil, err
+	}
+
+	srcRepo := src.Repo()
+	srcBase := filepath.Base(src.Name())
+	dstBase := filepath.Base(dstName)
+
+	if srcBase != dstBase {
+		if err := renameBspFiles(dstPath, srcBase, dstBase); err != nil {
+			return nil, err
+		}
+	}
+
+	dstFull := dstName
+	if !dstRepo.IsLocal() {
+		dstFull = newtutil.BuildPackageString(dstRepo.Name(), dstName)
+	}
+	qualify := !srcRepo.IsLocal() && srcRepo.Name() != dstRepo.Name()
+
+	nameRe := regexp.MustCompile(`(^|[^\w/\-])` +
+		regexp.QuoteMeta(src.Name()) + `([^\w\-]|$)`)
+
+	hints := []BspEditHint{}
+	err := filepath.Walk(dstPath, func(path string, info os.FileInfo,
+		err error) error {
+
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.IndexByte(b, 0) != -1 {
+			// Binary file.
+			return nil
+		}
+
+		s := string(b)
+		s = strings.Replace(s, src.FullName(), dstFull, -1)
+		s = nameRe.ReplaceAllString(s, "${1}"+dstName+"${2}")
+		if hasExt(path, bspRenameExts) && srcBase != dstBase {
+			s = replaceWord(s, srcBase, dstBase)
+		}
+		if qualify && filepath.Ext(path) == ".yml" {
+			s = qualifyRepoPaths(s, srcRepo, dstName)
+		}
+
+		if s != string(b) {
+			if err := ioutil.WriteFile(path, []byte(s), info.Mode()); err != nil {
+				return err
+			}
+		}
+
+		hint := BspEditHint{}
+		for _, rule := range bspEditRules {
+			if hasExt(path, rule.exts) &&
+				(rule.re == nil || rule.re.MatchString(s)) {
+
+				hint.Reasons = append(hint.Reasons, rule.reason)
+			}
+		}
+		if len(hint.Reasons) > 0 {
+			hint.Path, _ = filepath.Rel(dstPath, path)
+			hint.Path = filepath.ToSlash(hint.Path)
+			hints = append(hints, hint)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	return hints, nil
+}
@@ -42,6 +42,30 @@ type BspPackage struct {
 	DebugScript        string
 	FlashMap           flash.FlashMap
 	BspV               ycfg.YCfg
+
+	// Hardware features the BSP provides (e.g., "radio", "fpu").  Nil if the
+	// BSP does not declare its capabilities.
+	Capabilities []string
+
+	// The output section in the BSP's linker script whose load image is
+	// followed by the load image of the memory placement sections.
+	PlacementAnchor string
+}
+
+// Indicates whether the BSP provides the specified hardware feature.  A BSP
+// that does not declare its capabilities is assumed to provide everything.
+func (bsp *BspPackage) HasCapability(capability string) bool {
+	if bsp.Capabilities == nil {
+		return true
+	}
+
+	for _, c := range bsp.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (bsp *BspPackage) resolvePathSetting(
@@ -144,6 +168,15 @@ func (bsp *BspPackage) Reload(settings map[string]string) error {
 		return err
 	}
 
+	bsp.Capabilities = bsp.BspV.GetValStringSlice(
+		"bsp.capabilities", settings)
+
+	bsp.PlacementAnchor = bsp.BspV.GetValString(
+		"bsp.placement_anchor", settings)
+	if bsp.PlacementAnchor == "" {
+		bsp.PlacementAnchor = ".data"
+	}
+
 	if bsp.CompilerName == "" {
 		return util.NewNewtError("BSP does not specify a compiler " +
 			"(bsp.compiler)")
@@ -0,0 +1,167 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package pkg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/interfaces"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+)
+
+// An example app: an app package in an installed repo, along with the
+// packages that list it in their "pkg.examples" setting.
+type Example struct {
+	Lpkg *LocalPackage
+
+	// Full names of the packages that list this app as an example.
+	Demonstrates []string
+}
+
+// Indicates whether every term appears in the example's name, summary,
+// description, keywords, or the packages it demonstrates.  Matching is case
+// insensitive.
+func (ex *Example) Matches(terms []string) bool {
+	desc := ex.Lpkg.Desc()
+	text := strings.ToLower(strings.Join([]string{
+		ex.Lpkg.FullName(),
+		desc.Summary,
+		desc.Description,
+		strings.Join(desc.Keywords, " "),
+		strings.Join(ex.Demonstrates, " "),
+	}, "\n"))
+
+	for _, term := range terms {
+		if !strings.Contains(text, strings.ToLower(term)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type exampleSorter []*Example
+
+func (s exampleSorter) Len() int {
+	return len(s)
+}
+func (s exampleSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s exampleSorter) Less(i, j int) bool {
+	return s[i].Lpkg.FullName() < s[j].Lpkg.FullName()
+}
+
+// Finds the example apps among the specified packages: every app package that
+// doesn't belong to the local project.  Apps in the local project are the
+// user's own and are not examples.
+//
+// @return []*Example           The examples, sorted by name.
+func FindExamples(pkgs []interfaces.PackageInterface) []*Example {
+	exMap := map[string]*Example{}
+	for _, p := range pkgs {
+		lpkg := p.(*LocalPackage)
+		if lpkg.Type() == PACKAGE_TYPE_APP && !lpkg.Repo().IsLocal() {
+			exMap[lpkg.FullName()] = &Example{Lpkg: lpkg}
+		}
+	}
+
+	for _, p := range pkgs {
+		lpkg := p.(*LocalPackage)
+		for _, name := range lpkg.Desc().Examples {
+			if !strings.HasPrefix(name, "@") && !lpkg.Repo().IsLocal() {
+				name = newtutil.BuildPackageString(lpkg.Repo().Name(), name)
+			}
+			if ex := exMap[name]; ex != nil {
+				ex.Demonstrates = append(ex.Demonstrates, lpkg.FullName())
+			}
+		}
+	}
+
+	exs := make([]*Example, 0, len(exMap))
+	for _, ex := range exMap {
+		sort.Strings(ex.Demonstrates)
+		exs = append(exs, ex)
+	}
+	sort.Sort(exampleSorter(exs))
+
+	return exs
+}
+
+// Copies the app package `src` to `dstPath` in the local project and rewrites
+// it as the package `dstName`.  References to packages in the app's repo are
+// qualified with the repo's name so that they still resolve from the project.
+func CopyApp(src *LocalPackage, dstName string, dstPath string) error {
+	if src.Type() != PACKAGE_TYPE_APP {
+		return util.FmtNewtError("package \"%s\" is not an app",
+			src.FullName())
+	}
+
+	if err := util.CopyDir(src.BasePath(), dstPath); err != nil {
+		return err
+	}
+
+	srcRepo := src.Repo()
+	qualify := !srcRepo.IsLocal()
+
+	nameRe := regexp.MustCompile(`(^|[^\w/\-])` +
+		regexp.QuoteMeta(src.Name()) + `([^\w\-]|$)`)
+
+	err := filepath.Walk(dstPath, func(path string, info os.FileInfo,
+		err error) error {
+
+		if err != nil || !info.Mode().IsRegular() ||
+			filepath.Ext(path) != ".yml" {
+
+			return err
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		s := string(b)
+		s = strings.Replace(s, src.FullName(), dstName, -1)
+		s = nameRe.ReplaceAllString(s, "${1}"+dstName+"${2}")
+		if qualify {
+			s = qualifyRepoPaths(s, srcRepo, dstName)
+		}
+
+		if s != string(b) {
+			if err := ioutil.WriteFile(path, []byte(s), info.Mode()); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
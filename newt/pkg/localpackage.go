@@ -193,6 +193,10 @@ func (pkg *LocalPackage) readDesc(yc ycfg.YCfg) (*PackageDesc, error) {
 	pdesc.Homepage = yc.GetValString("pkg.homepage", nil)
 	pdesc.Description = yc.GetValString("pkg.description", nil)
 	pdesc.Keywords = yc.GetValStringSlice("pkg.keywords", nil)
+	pdesc.Summary = yc.GetValString("pkg.summary", nil)
+	pdesc.Maintainers = yc.GetValStringSlice("pkg.maintainers", nil)
+	pdesc.Examples = yc.GetValStringSlice("pkg.examples", nil)
+	pdesc.License = yc.GetValString("pkg.license", nil)
 
 	return pdesc, nil
 }
@@ -274,6 +278,16 @@ func (pkg *LocalPackage) Save() error {
 		yaml.EscapeString(pkg.Desc().Author) + "\n")
 	file.WriteString("pkg.homepage: " +
 		yaml.EscapeString(pkg.Desc().Homepage) + "\n")
+	if pkg.Desc().Summary != "" {
+		file.WriteString("pkg.summary: " +
+			yaml.EscapeString(pkg.Desc().Summary) + "\n")
+	}
+	file.WriteString(pkg.sequenceString("pkg.maintainers"))
+	file.WriteString(pkg.sequenceString("pkg.examples"))
+	if pkg.Desc().License != "" {
+		file.WriteString("pkg.license: " +
+			yaml.EscapeString(pkg.Desc().License) + "\n")
+	}
 
 	file.WriteString("\n")
 
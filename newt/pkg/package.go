@@ -91,4 +91,13 @@ type PackageDesc struct {
 	Homepage    string
 	Description string
 	Keywords    []string
+
+	// One-line summary of the package
+	Summary string
+	// People responsible for the package (e.g., "Name <email>")
+	Maintainers []string
+	// Packages (typically apps) that demonstrate the package's use
+	Examples []string
+	// SPDX license expression (e.g., "Apache-2.0" or "MIT OR Apache-2.0")
+	License string
 }
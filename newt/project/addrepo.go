@@ -0,0 +1,94 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package project
+
+import (
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/downloader"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+)
+
+// Repo names become `project.yml` keys.
+var repoNameRe = regexp.MustCompile(`^[A-Za-z0-9_\-.]+$`)
+
+// Returns the text of a `project.yml` repo descriptor.  The "type" and
+// "vers" fields come first; the rest are sorted.  Fields that are not repo
+// descriptor fields are dropped, and every value is quoted, so the descriptor
+// cannot add other keys to `project.yml`.
+func repoDescText(repoName string, fields map[string]string) string {
+	keys := []string{}
+	for k, _ := range fields {
+		if k != "type" && k != "vers" && downloader.IsRepoField(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	keys = append([]string{"type", "vers"}, keys...)
+
+	lines := []string{"repository." + repoName + ":"}
+	for _, k := range keys {
+		if v := fields[k]; v != "" {
+			lines = append(lines, "    "+k+": "+strconv.Quote(v))
+		}
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Appends a repo descriptor to `project.yml`.  The repo is not downloaded;
+// that happens on the next `newt upgrade`.
+func (proj *Project) AddRepoDesc(repoName string,
+	fields map[string]string) error {
+
+	path := proj.BasePath + "/" + PROJECT_FILE_NAME
+
+	if !repoNameRe.MatchString(repoName) {
+		return util.FmtNewtError("Invalid repo name \"%s\"", repoName)
+	}
+
+	sc := newtutil.NewSchemaChecker(path)
+	if sc.KeyLine("repository."+repoName) != 0 {
+		return util.FmtNewtError(
+			"%s already contains a descriptor for repo \"%s\"",
+			path, repoName)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+	text := string(b)
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	text += "\n" + repoDescText(repoName, fields)
+
+	if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,210 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// This file implements project lifecycle hooks: commands that run before and
+// after `newt install`, `newt sync`, and `newt upgrade`.  They allow a project
+// to regenerate code or re-run vendoring tools whenever its dependencies move.
+// Hooks are configured in `project.yml`:
+//
+//     project.hooks:
+//         pre_upgrade: "scripts/check_clean.sh"
+//         post_install:
+//             - "scripts/regen.sh"
+//             - "scripts/vendor.sh"
+//
+// The available hooks are pre_<op> and post_<op>, where <op> is install,
+// sync, or upgrade.  Each command is run by the shell (`sh -c`, or `cmd /c` on
+// Windows) in the project directory.  A pre hook
+// runs once for each repo the operation applies to; a failing pre hook aborts
+// the operation.  A post hook runs once for each repo whose checked out commit
+// the operation changed.  Hooks are not run for dry runs.  The following
+// environment variables are set:
+//
+//     NEWT_HOOK           The name of the hook (e.g., "post_install").
+//     NEWT_REPO           The name of the repo.
+//     NEWT_REPO_PATH      The path of the repo.
+//     NEWT_OLD_COMMIT     The repo's commit before the operation; empty if
+//                         the repo was not installed.
+//     NEWT_NEW_COMMIT     The repo's commit after the operation; empty for
+//                         pre hooks.
+
+package project
+
+import (
+	"os/exec"
+	"runtime"
+	"sort"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/util"
+)
+
+const PROJECT_HOOKS_KEY = "project.hooks"
+
+const (
+	HOOK_OP_INSTALL = "install"
+	HOOK_OP_SYNC    = "sync"
+	HOOK_OP_UPGRADE = "upgrade"
+)
+
+var hookNames = []string{
+	"pre_" + HOOK_OP_INSTALL,
+	"post_" + HOOK_OP_INSTALL,
+	"pre_" + HOOK_OP_SYNC,
+	"post_" + HOOK_OP_SYNC,
+	"pre_" + HOOK_OP_UPGRADE,
+	"post_" + HOOK_OP_UPGRADE,
+}
+
+// Validates the "project.hooks" map of `project.yml`.
+func checkHooks(sc *newtutil.SchemaChecker, keys []string, itf interface{}) {
+	m, err := cast.ToStringMapE(itf)
+	if err != nil {
+		sc.Errorf(keys, "\"%s\" must be a map", PROJECT_HOOKS_KEY)
+		return
+	}
+
+	sc.CheckKeys(keys, m, hookNames)
+	for name, v := range m {
+		if _, err := cast.ToStringSliceE(v); err != nil {
+			sc.Errorf(append(keys, name),
+				"hook \"%s\" must be a command or a list of commands", name)
+		}
+	}
+}
+
+// Retrieves the commands configured for the specified hook.
+func (proj *Project) hookCmds(hook string) []string {
+	itf := proj.yc.GetValStringMap(PROJECT_HOOKS_KEY, nil)[hook]
+	if s, ok := itf.(string); ok {
+		return []string{s}
+	}
+
+	return cast.ToStringSlice(itf)
+}
+
+// Runs the commands configured for the specified hook once for the specified
+// repo.
+func (proj *Project) runHook(hook string, r *repo.Repo,
+	oldCommit string, newCommit string) error {
+
+	cmds := proj.hookCmds(hook)
+	if len(cmds) == 0 {
+		return nil
+	}
+
+	env := []string{
+		"NEWT_HOOK=" + hook,
+		"NEWT_REPO=" + r.Name(),
+		"NEWT_REPO_PATH=" + r.Path(),
+		"NEWT_OLD_COMMIT=" + oldCommit,
+		"NEWT_NEW_COMMIT=" + newCommit,
+	}
+
+	for _, cmd := range cmds {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Running %s hook for %s: %s\n", hook, r.Name(), cmd)
+
+		var shell []string
+		if runtime.GOOS == "windows" {
+			shell = []string{"cmd", "/c", cmd}
+		} else {
+			shell = []string{"sh", "-c", cmd}
+		}
+		util.LogShellCmd(shell, env)
+
+		c := exec.Command(shell[0], shell[1:]...)
+		c.Dir = proj.BasePath
+		c.Env = util.ChildEnv(env)
+
+		out, err := c.CombinedOutput()
+		if err != nil {
+			msg := err.Error()
+			if len(out) > 0 {
+				msg = string(out)
+			}
+			return util.FmtNewtError("%s hook for repo \"%s\" failed: %s",
+				hook, r.Name(), msg)
+		}
+		if len(out) > 0 {
+			util.StatusMessage(util.VERBOSITY_DEFAULT, "%s", string(out))
+		}
+	}
+
+	return nil
+}
+
+// Records the checked out commit of each installed repo.
+func (proj *Project) repoCommits() map[string]string {
+	commits := map[string]string{}
+	for name, r := range proj.repos {
+		if r == nil || r.IsLocal() || util.NodeNotExist(r.Path()) {
+			continue
+		}
+
+		if commit, err := r.CurrentHash(); err == nil {
+			commits[name] = commit
+		}
+	}
+
+	return commits
+}
+
+// Runs the pre hook of the specified operation for each of the specified
+// repos.
+func (proj *Project) runPreHooks(op string, repos []*repo.Repo,
+	commits map[string]string) error {
+
+	for _, r := range repos {
+		if err := proj.runHook("pre_"+op, r, commits[r.Name()],
+			""); err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Runs the post hook of the specified operation for each repo whose commit
+// differs from the one recorded before the operation.
+func (proj *Project) runPostHooks(op string, before map[string]string) error {
+	after := proj.repoCommits()
+
+	names := []string{}
+	for name, commit := range after {
+		if commit != before[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := proj.runHook("post_"+op, proj.repos[name], before[name],
+			after[name]); err != nil {
+
+			return err
+		}
+	}
+
+	return nil
+}
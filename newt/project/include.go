@@ -0,0 +1,141 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package project
+
+import (
+	"path/filepath"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// The `project.yml` key listing YAML fragments to merge into the file, e.g.,
+// a repo list shared by several projects:
+//
+//     include:
+//         - ../shared/org-defaults.yml
+//         - ../shared/core-repos.yml
+//
+// Paths are relative to the including file.  Fragments are merged in the
+// order listed, so a later fragment overrides an earlier one, and the
+// including file overrides all of its fragments.  Maps (e.g., a repo
+// descriptor) are merged key by key; any other value is replaced outright.
+// A fragment may itself include other fragments.  `project.local.yml` can
+// also include fragments; its settings, as always, take precedence over
+// everything in `project.yml`.
+//
+// Relative paths within a fragment (e.g., a repo's patch files) are still
+// interpreted relative to the project root.
+const PROJECT_INCLUDE_KEY = "include"
+
+// Limits the nesting of includes; deeper nesting almost certainly indicates
+// a mistake.
+const PROJECT_INCLUDE_MAX_DEPTH = 8
+
+func includePaths(path string, m map[string]interface{}) ([]string, error) {
+	itf, ok := m[PROJECT_INCLUDE_KEY]
+	if !ok || itf == nil {
+		return nil, nil
+	}
+
+	var incs []string
+	if s, ok := itf.(string); ok {
+		incs = strings.Fields(s)
+	} else {
+		var err error
+		incs, err = cast.ToStringSliceE(itf)
+		if err != nil {
+			return nil, util.FmtNewtError(
+				"%s: \"%s\" must be a file name or a list of file names",
+				path, PROJECT_INCLUDE_KEY)
+		}
+	}
+
+	dir := filepath.Dir(path)
+	paths := make([]string, len(incs))
+	for i, inc := range incs {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(dir, inc)
+		}
+		paths[i] = filepath.ToSlash(filepath.Clean(inc))
+	}
+
+	return paths, nil
+}
+
+// Reads a project file along with all the fragments it includes, and
+// validates each of them.
+//
+// @param path                  The file to read.
+// @param stack                 The chain of files that led to this one, for
+//                                  detecting cycles.
+func readProjectYml(path string, stack []string) (map[string]interface{},
+	error) {
+
+	for _, p := range stack {
+		if p == path {
+			return nil, util.FmtNewtError("include cycle: %s",
+				strings.Join(append(stack, path), " -> "))
+		}
+	}
+	if len(stack) > PROJECT_INCLUDE_MAX_DEPTH {
+		return nil, util.FmtNewtError("includes nested too deeply: %s",
+			strings.Join(append(stack, path), " -> "))
+	}
+
+	m, err := readYmlMap(path)
+	if err != nil {
+		if len(stack) > 0 {
+			return nil, util.FmtNewtError("%s (included from %s)",
+				err.Error(), stack[len(stack)-1])
+		}
+		return nil, err
+	}
+	if err := validateProjectYml(path, m); err != nil {
+		return nil, err
+	}
+
+	incs, err := includePaths(path, m)
+	if err != nil {
+		return nil, err
+	}
+	delete(m, PROJECT_INCLUDE_KEY)
+
+	if len(incs) == 0 {
+		return m, nil
+	}
+
+	merged := map[string]interface{}{}
+	for _, inc := range incs {
+		log.Debugf("Including %s from %s", inc, path)
+
+		im, err := readProjectYml(inc, append(stack, path))
+		if err != nil {
+			return nil, err
+		}
+		mergeYmlMaps(merged, im)
+	}
+	mergeYmlMaps(merged, m)
+
+	return merged, nil
+}
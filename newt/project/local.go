@@ -0,0 +1,160 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package project
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/ycfg"
+	"mynewt.apache.org/newt/util"
+	"mynewt.apache.org/newt/yaml"
+)
+
+// An optional, per-developer file that is merged on top of `project.yml`.  It
+// lets a developer override repo descriptors (e.g., point a repo at a local
+// checkout or change its version requirement) without modifying the shared
+// project file.  It is meant to be excluded from version control.
+const PROJECT_LOCAL_FILE_NAME = "project.local.yml"
+
+func readYmlMap(path string) (map[string]interface{}, error) {
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, util.FmtNewtError("Error reading %s: %s",
+			path, err.Error())
+	}
+
+	m := map[string]interface{}{}
+	if err := yaml.Unmarshal(file, &m); err != nil {
+		return nil, util.FmtNewtError("Failure parsing \"%s\": %s",
+			path, err.Error())
+	}
+
+	return m, nil
+}
+
+// Merges src into dst.  Maps are merged key by key; any other value in src
+// replaces the corresponding value in dst.
+func mergeYmlMaps(dst map[string]interface{}, src map[string]interface{}) {
+	for k, sv := range src {
+		dv, ok := dst[k]
+		if ok {
+			dm, derr := cast.ToStringMapE(dv)
+			sm, serr := cast.ToStringMapE(sv)
+			if derr == nil && serr == nil && dm != nil && sm != nil {
+				mergeYmlMaps(dm, sm)
+				dst[k] = dm
+				continue
+			}
+		}
+
+		dst[k] = sv
+	}
+}
+
+// Warns if the overrides file is part of a git repo but not ignored by it;
+// such a file is easily committed by accident.
+func warnIfLocalYmlTracked(basePath string) {
+	_, err := util.ShellCommand([]string{
+		"git", "-C", basePath, "check-ignore", "-q", PROJECT_LOCAL_FILE_NAME,
+	}, nil)
+	if err == nil {
+		return
+	}
+
+	// Exit status 1 means "not ignored"; anything else means the project is
+	// not in a git repo or git isn't available.
+	newtErr, ok := err.(*util.NewtError)
+	if !ok {
+		return
+	}
+	ee, ok := newtErr.Parent.(*exec.ExitError)
+	if !ok {
+		return
+	}
+	if ws, ok := ee.Sys().(syscall.WaitStatus); ok &&
+		ws.Exited() && ws.ExitStatus() == 1 {
+
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"* Warning: %s is not ignored by git; add it to .gitignore "+
+				"to avoid committing it\n", PROJECT_LOCAL_FILE_NAME)
+	}
+}
+
+// Reads `project.yml` and applies the selected profile and any overrides in
+// `project.local.yml`.  Fragments included by either file are merged in.
+func readProjectConfig(basePath string) (ycfg.YCfg, error) {
+	path := basePath + "/" + PROJECT_FILE_NAME
+	m, err := readProjectYml(path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyProfile(m); err != nil {
+		return nil, err
+	}
+
+	localPath := basePath + "/" + PROJECT_LOCAL_FILE_NAME
+	if util.NodeExist(localPath) {
+		lm, err := readProjectYml(localPath, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Debugf("Applying overrides from %s", localPath)
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Applying developer overrides from %s\n",
+			PROJECT_LOCAL_FILE_NAME)
+
+		mergeYmlMaps(m, lm)
+		warnIfLocalYmlTracked(basePath)
+	}
+
+	return ycfg.NewYCfg(m)
+}
+
+// Reads the version requirement of each repo listed in the specified project's
+// `project.yml` file (including any overrides in `project.local.yml`).  The
+// project is not loaded.
+//
+// @return map[string]string    Version requirement strings, indexed by repo
+//                                  name.
+func RepoVersReqs(basePath string) (map[string]string, error) {
+	yc, err := readProjectConfig(basePath)
+	if err != nil {
+		return nil, err
+	}
+
+	reqs := map[string]string{}
+	for k, _ := range yc.AllSettings() {
+		repoName := strings.TrimPrefix(k, "repository.")
+		if repoName != k {
+			fields := yc.GetValStringMapString(k, nil)
+			reqs[repoName] = fields["vers"]
+		}
+	}
+
+	return reqs, nil
+}
@@ -0,0 +1,336 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// This file implements the project lock file (`project.lock`).  The lock file
+// records the exact commit each installed repo resolved to.  Subsequent
+// installs check out the locked commits rather than re-resolving each repo's
+// version, so every machine that installs the project gets identical repos.
+// `newt upgrade` ignores the lock file and rewrites it afterwards.
+//
+// The lock file has the following form:
+//
+//     lock.repos:
+//         apache-mynewt-core:
+//             vers: 1-latest
+//             commit: 6e6ee2ad5e8b1ef2e31bb1d0b7c7b26a7d0b4e8c
+//
+// The "vers" field holds the repo's `project.yml` version requirement at the
+// time the commit was locked; it is empty for repos that were only pulled in
+// as dependencies.  If the requirement in `project.yml` has since changed, the
+// entry is considered stale and is ignored.
+//
+// A frozen install (`newt install --frozen`) changes nothing and performs no
+// network access; it only verifies that every repo is installed at exactly
+// its locked commit.  This keeps CI builds from silently picking up new
+// upstream commits.
+
+package project
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/util"
+	"mynewt.apache.org/newt/yaml"
+)
+
+const PROJECT_LOCK_FILE_NAME = "project.lock"
+
+type lockedRepo struct {
+	Vers   string
+	Commit string
+}
+
+func (proj *Project) lockPath() string {
+	return proj.BasePath + "/" + PROJECT_LOCK_FILE_NAME
+}
+
+// Retrieves the version requirement that `project.yml` specifies for the
+// named repo, exactly as written.  An empty string is returned for repos that
+// are not listed in `project.yml`.
+func (proj *Project) rootReqString(repoName string) string {
+	fields := proj.yc.GetValStringMapString("repository."+repoName, nil)
+	return fields["vers"]
+}
+
+// Reads the project's lock file.  A nil map is returned if the project does
+// not have a lock file.
+func (proj *Project) readLock() (map[string]lockedRepo, error) {
+	if util.NodeNotExist(proj.lockPath()) {
+		return nil, nil
+	}
+
+	yc, err := newtutil.ReadConfigPath(proj.lockPath())
+	if err != nil {
+		return nil, err
+	}
+
+	lock := map[string]lockedRepo{}
+	for name, itf := range yc.GetValStringMap("lock.repos", nil) {
+		fields := cast.ToStringMapString(itf)
+		if fields["commit"] == "" {
+			return nil, util.FmtNewtError(
+				"%s: repo \"%s\" missing required \"commit\" field",
+				proj.lockPath(), name)
+		}
+
+		lock[name] = lockedRepo{
+			Vers:   fields["vers"],
+			Commit: fields["commit"],
+		}
+	}
+
+	return lock, nil
+}
+
+// Determines the commits that an install operation should check out.  Entries
+// for repos whose `project.yml` requirement has changed since the lock file
+// was written are discarded.
+func (proj *Project) lockedCommits() (map[string]string, error) {
+	lock, err := proj.readLock()
+	if err != nil {
+		return nil, err
+	}
+
+	commits := map[string]string{}
+	for name, lr := range lock {
+		if proj.repos[name] == nil {
+			continue
+		}
+
+		if lr.Vers != proj.rootReqString(name) {
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"Ignoring locked commit for \"%s\": project.yml requirement "+
+					"changed from \"%s\" to \"%s\"\n",
+				name, lr.Vers, proj.rootReqString(name))
+			continue
+		}
+
+		commits[name] = lr.Commit
+	}
+
+	return commits, nil
+}
+
+// Records the current commit of each of the specified repos in the project's
+// lock file.  These are the repos that an install, upgrade, or sync just
+// checked out; the entries of other repos are carried over unchanged, so a
+// repo that the user switched by hand doesn't get locked at an arbitrary
+// commit.
+func (proj *Project) writeLock(repoNames []string) error {
+	if len(repoNames) == 0 {
+		return nil
+	}
+
+	lock, err := proj.readLock()
+	if err != nil {
+		return err
+	}
+	if lock == nil {
+		lock = map[string]lockedRepo{}
+	}
+
+	for _, name := range repoNames {
+		r := proj.repos[name]
+		if r == nil || r.IsLocal() || util.NodeNotExist(r.Path()) {
+			continue
+		}
+
+		commit, err := r.CurrentHash()
+		if err != nil {
+			log.Debugf("not locking repo \"%s\": %s", name, err.Error())
+			continue
+		}
+
+		lock[name] = lockedRepo{
+			Vers:   proj.rootReqString(name),
+			Commit: commit,
+		}
+	}
+
+	// Drop repos that are no longer part of the project.
+	names := []string{}
+	for name, _ := range lock {
+		if proj.repos[name] != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "# Generated by newt; do not edit.  Run "+
+		"`newt upgrade` to update.\n")
+	fmt.Fprintf(&buf, "lock.repos:\n")
+	for _, name := range names {
+		fmt.Fprintf(&buf, "    %s:\n", name)
+		fmt.Fprintf(&buf, "        vers: %s\n",
+			yaml.EscapeString(lock[name].Vers))
+		fmt.Fprintf(&buf, "        commit: %s\n", lock[name].Commit)
+	}
+
+	if err := ioutil.WriteFile(proj.lockPath(), buf.Bytes(),
+		0644); err != nil {
+
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// Compares each installed repo against the project's lock file.  Returns a
+// description of each repo whose checked out commit differs from its locked
+// commit.
+func (proj *Project) LockMismatches() []string {
+	lock, err := proj.readLock()
+	if err != nil || lock == nil {
+		return nil
+	}
+
+	names := []string{}
+	for name, _ := range lock {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	mismatches := []string{}
+	for _, name := range names {
+		// The lock file only describes primary checkouts.
+		r := proj.repos[name]
+		if r == nil || r.IsPinned() || util.NodeNotExist(r.Path()) {
+			continue
+		}
+
+		commit, err := r.CurrentHash()
+		if err != nil {
+			continue
+		}
+
+		if commit != lock[name].Commit {
+			mismatches = append(mismatches, fmt.Sprintf(
+				"repo \"%s\" is at commit %s, but %s specifies %s",
+				name, commit, PROJECT_LOCK_FILE_NAME, lock[name].Commit))
+		}
+	}
+
+	return mismatches
+}
+
+// Checks a single repo against its lock file entry for a frozen install.
+// Returns a description of each problem found.
+func (proj *Project) frozenRepoProblems(r *repo.Repo,
+	lock map[string]lockedRepo) []string {
+
+	name := r.Name()
+
+	lr, ok := lock[name]
+	if !ok {
+		return []string{fmt.Sprintf("repo \"%s\" is not locked in %s",
+			name, PROJECT_LOCK_FILE_NAME)}
+	}
+	if lr.Vers != proj.rootReqString(name) {
+		return []string{fmt.Sprintf(
+			"repo \"%s\" is locked for requirement \"%s\", but "+
+				"project.yml now requires \"%s\"",
+			name, lr.Vers, proj.rootReqString(name))}
+	}
+
+	if util.NodeNotExist(r.Path()) {
+		return []string{fmt.Sprintf(
+			"repo \"%s\" is not installed; installing it would require a "+
+				"network fetch", name)}
+	}
+
+	problems := []string{}
+
+	commit, err := r.CurrentHash()
+	if err != nil {
+		problems = append(problems, fmt.Sprintf(
+			"repo \"%s\": failed to determine current commit: %s",
+			name, err.Error()))
+	} else if commit != lr.Commit {
+		msg := fmt.Sprintf("repo \"%s\" is at commit %s, but %s specifies %s",
+			name, commit, PROJECT_LOCK_FILE_NAME, lr.Commit)
+		if _, err := r.VCSState().CommitTime(
+			r.Path(), lr.Commit); err != nil {
+
+			msg += "; the locked commit is not present locally and " +
+				"would require a network fetch"
+		}
+		problems = append(problems, msg)
+	}
+
+	changes, err := r.HasChanges()
+	if err != nil {
+		problems = append(problems, fmt.Sprintf(
+			"repo \"%s\": failed to check for local modifications: %s",
+			name, err.Error()))
+	} else if changes {
+		problems = append(problems, fmt.Sprintf(
+			"repo \"%s\" contains local modifications", name))
+	}
+
+	return problems
+}
+
+// Performs a frozen install of the repos matching the specified predicate:
+// verifies that each one is installed at exactly the commit recorded in the
+// lock file and is unmodified.  Nothing is fetched or checked out.  An error
+// describing every discrepancy is returned if any repo fails verification.
+func (proj *Project) InstallFrozen(predicate func(r *repo.Repo) bool) error {
+	lock, err := proj.readLock()
+	if err != nil {
+		return err
+	}
+	if lock == nil {
+		return util.FmtNewtError(
+			"frozen install requires a lock file, but %s does not exist; "+
+				"run `newt install` without --frozen and commit the "+
+				"resulting lock file", proj.lockPath())
+	}
+
+	problems := []string{}
+	for _, r := range proj.SelectRepos(proj.skipVendored(predicate)) {
+		if r.IsLocal() {
+			continue
+		}
+
+		problems = append(problems, proj.frozenRepoProblems(r, lock)...)
+	}
+
+	if len(problems) > 0 {
+		return util.FmtNewtError(
+			"frozen install failed; repos do not match %s:\n    %s\n"+
+				"Run `newt install` without --frozen to update the repos, or "+
+				"`newt upgrade` to update the lock file",
+			PROJECT_LOCK_FILE_NAME, strings.Join(problems, "\n    "))
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"All repos match %s\n", PROJECT_LOCK_FILE_NAME)
+
+	return nil
+}
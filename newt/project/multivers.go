@@ -0,0 +1,155 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package project
+
+import (
+	"sort"
+
+	"mynewt.apache.org/newt/newt/deprepo"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/util"
+)
+
+// Ensures that the specified repo versions, together with the installed
+// versions of the project's other repos, satisfy the dependencies each repo
+// declares in its `repository.yml` file.  The versions are checked by the
+// same resolver that `newt install` uses.
+//
+// @param versions              Repo name => version string.
+func (proj *Project) CheckRepoVersions(versions map[string]string) error {
+	names := []string{}
+	for name, r := range proj.repos {
+		if !r.IsLocal() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	m := deprepo.Matrix{}
+	for _, name := range names {
+		r := proj.repos[name]
+
+		var ver newtutil.RepoVersion
+		if vers := versions[name]; vers != "" {
+			v, err := newtutil.ParseRepoVersion(vers)
+			if err != nil {
+				return err
+			}
+			ver = v
+		} else {
+			v, err := proj.GetRepoVersion(name)
+			if err != nil {
+				return err
+			}
+			if v == nil {
+				continue
+			}
+			ver = *v
+		}
+
+		nv, err := r.NormalizeVersion(ver)
+		if err != nil {
+			return err
+		}
+		if err := m.AddRow(name, []newtutil.RepoVersion{nv}); err != nil {
+			return err
+		}
+	}
+
+	dg, err := deprepo.BuildDepGraph(proj.repos, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, conflicts := deprepo.FindAcceptableVersions(m, dg); conflicts != nil {
+		return deprepo.ConflictError(conflicts)
+	}
+
+	return nil
+}
+
+// Points the project's repos at the versions a target pins them to (see
+// repo/multivers.go).  The checkouts of the pinned versions must already
+// exist; they are created by `newt install`, never by a build.  Repos that
+// the target doesn't pin use their primary checkouts.  The packages of every
+// repo that changes location are reloaded.
+//
+// @param versions              Repo name => version string.
+func (proj *Project) UseRepoVersions(versions map[string]string) error {
+	for name, _ := range versions {
+		r := proj.repos[name]
+		if r == nil {
+			return util.FmtNewtError(
+				"target pins unknown repo \"%s\"", name)
+		}
+		if r.IsLocal() {
+			return util.FmtNewtError(
+				"target can't pin the project's local repo \"%s\"", name)
+		}
+	}
+
+	if len(versions) > 0 {
+		if err := proj.CheckRepoVersions(versions); err != nil {
+			return err
+		}
+	}
+
+	names := []string{}
+	for name, r := range proj.repos {
+		if !r.IsLocal() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		r := proj.repos[name]
+		oldPath := r.Path()
+
+		r.UseVersion("")
+
+		if vers := versions[name]; vers != "" {
+			if util.NodeNotExist(r.VersionCheckoutPath(vers)) {
+				return util.FmtNewtError(
+					"version %s of repo \"%s\" is not checked out; run "+
+						"`newt install` to create %s", vers, name,
+					r.VersionCheckoutPath(vers))
+			}
+			r.UseVersion(vers)
+
+			util.StatusMessage(util.VERBOSITY_DEFAULT,
+				"Using %s version %s from %s\n", name, vers, r.Path())
+		}
+
+		if r.Path() == oldPath {
+			continue
+		}
+
+		list, warnings, err := pkg.ReadLocalPackages(r, r.Path())
+		if err != nil {
+			return err
+		}
+		proj.packages[name] = list
+		proj.warnings = append(proj.warnings, warnings...)
+	}
+
+	return nil
+}
@@ -0,0 +1,203 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package project
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"mynewt.apache.org/newt/newt/downloader"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/settings"
+	"mynewt.apache.org/newt/util"
+)
+
+// A project can pin the newt versions it supports:
+//
+//     project.newt_version: "1.12.0"
+//
+// The value is a version requirement in the same format as a repo's "vers"
+// field (e.g., ">=1.11.0 <1.13.0" or "~1.12"); alternatives are separated by
+// "||".  When the running newt doesn't satisfy it, newt aborts with
+// instructions.  If the requirement is an exact version and the user has
+// enabled the "newt.auto_exec" newtrc setting, newt instead downloads the
+// required version and reruns the command with it.  The download location
+// comes only from the user's "newt.download_url" newtrc setting, never from
+// the project; the project must list the SHA256 digest of the executable for
+// each platform, and newt refuses to run a download without a matching
+// digest:
+//
+//     project.newt_sha256:
+//         linux_amd64: "1f3c..."
+//         darwin_arm64: "9ab0..."
+
+// Set in the environment of a newt that was run because of a version pin.
+// Prevents a misconfigured download from running newt in a loop.
+const NEWT_PIN_ENV = "NEWT_PINNED_VERSION"
+
+// Parses a "project.newt_version" value into its alternatives.
+func parseNewtVersionReqs(
+	s string) ([][]newtutil.RepoVersionReq, error) {
+
+	alts := [][]newtutil.RepoVersionReq{}
+	for _, alt := range strings.Split(s, "||") {
+		alt = strings.TrimSpace(alt)
+		if alt == "" {
+			continue
+		}
+
+		reqs, err := newtutil.ParseRepoVersionReqs(alt)
+		if err != nil {
+			return nil, util.FmtNewtError(
+				"project.yml: invalid project.newt_version \"%s\": %s",
+				s, err.Error())
+		}
+		alts = append(alts, reqs)
+	}
+
+	return alts, nil
+}
+
+// Returns the exact newt version required by the specified alternatives, or
+// nil if they allow a range of versions.
+func exactNewtVersion(
+	alts [][]newtutil.RepoVersionReq) *newtutil.RepoVersion {
+
+	if len(alts) != 1 || len(alts[0]) != 1 ||
+		alts[0][0].CompareType != "==" {
+
+		return nil
+	}
+
+	return &alts[0][0].Ver
+}
+
+// Runs the specified newt executable with this process's arguments and exits
+// with its status.
+func execNewt(path string, ver string) {
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), NEWT_PIN_ENV+"="+ver)
+
+	err := cmd.Run()
+	if err == nil {
+		os.Exit(0)
+	}
+	if ee, ok := err.(*exec.ExitError); ok {
+		if ws, ok := ee.Sys().(syscall.WaitStatus); ok && ws.Exited() {
+			os.Exit(ws.ExitStatus())
+		}
+		os.Exit(1)
+	}
+
+	util.ErrorMessage(util.VERBOSITY_QUIET, "Error: failed to run %s: %s\n",
+		path, err.Error())
+	os.Exit(1)
+}
+
+// Enforces the project's "project.newt_version" requirement.  If this version
+// of newt doesn't satisfy it, either the required version is run in its
+// place (this function doesn't return), or an error describing how to get it
+// is returned.
+func (proj *Project) checkNewtPin() error {
+	reqStr := proj.yc.GetValString("project.newt_version", nil)
+	if reqStr == "" {
+		return nil
+	}
+
+	alts, err := parseNewtVersionReqs(reqStr)
+	if err != nil {
+		return err
+	}
+
+	cur := newtutil.RepoVersion{
+		Major:    newtutil.NewtVersion.Major,
+		Minor:    newtutil.NewtVersion.Minor,
+		Revision: newtutil.NewtVersion.Revision,
+	}
+	for _, reqs := range alts {
+		if cur.SatisfiesAll(reqs) {
+			return nil
+		}
+	}
+
+	msg := fmt.Sprintf("This project requires newt %s; this is newt %s",
+		reqStr, newtutil.NewtVersion.String())
+
+	if newtutil.NewtIgnoreVersion {
+		util.StatusMessage(util.VERBOSITY_QUIET, "WARNING: %s.\n", msg)
+		return nil
+	}
+
+	lines := []string{msg + "."}
+
+	exact := exactNewtVersion(alts)
+	if exact != nil {
+		verStr := exact.String()
+
+		// Only the user decides where newt executables come from.
+		tmpl := settings.NewtDownloadUrl()
+		platform := runtime.GOOS + "_" + runtime.GOARCH
+		digest := proj.yc.GetValStringMapString(
+			"project.newt_sha256", nil)[platform]
+
+		if prev := os.Getenv(NEWT_PIN_ENV); prev != "" {
+			lines = append(lines, fmt.Sprintf(
+				"This newt was run because the project requires newt %s, "+
+					"but it reports version %s; check the download "+
+					"location.", prev, newtutil.NewtVersion.String()))
+		} else if tmpl != "" && settings.NewtAutoExec() && digest == "" {
+			lines = append(lines, fmt.Sprintf(
+				"Not downloading newt %s: project.yml does not specify its "+
+					"SHA256 digest for %s (project.newt_sha256).", verStr,
+				platform))
+		} else if tmpl != "" && settings.NewtAutoExec() {
+			path, err := downloader.FetchNewt(verStr,
+				downloader.NewtDownloadUrl(tmpl, verStr), digest)
+			if err != nil {
+				return err
+			}
+
+			util.StatusMessage(util.VERBOSITY_VERBOSE,
+				"Running newt %s (%s) as required by project.yml\n",
+				verStr, path)
+			execNewt(path, verStr)
+		} else if tmpl != "" {
+			lines = append(lines, fmt.Sprintf(
+				"Newt %s can be downloaded from %s; set \"newt.auto_exec: "+
+					"1\" in ~/.newt/repos.yml to have newt download and run "+
+					"it automatically.", verStr,
+				downloader.NewtDownloadUrl(tmpl, verStr)))
+		} else {
+			lines = append(lines, fmt.Sprintf(
+				"Newt %s can be downloaded from %s", verStr,
+				settings.NewtReleaseUrl(exact.ToNuVersion())))
+		}
+	}
+
+	lines = append(lines, "Specify --ignore-newt-version to proceed anyway.")
+	return util.NewNewtError(strings.Join(lines, "\n"))
+}
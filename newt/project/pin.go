@@ -0,0 +1,373 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package project
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/util"
+)
+
+// Pinning a repo replaces its `vers` field in `project.yml` with the hash of
+// the installed commit.  The original requirement is recorded in a trailing
+// comment so that the repo can be unpinned later:
+//
+//     vers: "0123abcd...-commit"  # pinned from "1-latest" (1.4.0; master)
+//
+// Only the project's own definition of the repo is rewritten: `project.yml`,
+// or the included fragment that declares the repo.  Overrides from
+// `project.local.yml` and profiles are left out of the rewritten file.
+const PIN_COMMENT_PREFIX = "pinned from"
+
+var pinCommentRe = regexp.MustCompile(`#\s*` + PIN_COMMENT_PREFIX +
+	`\s+"([^"]*)"`)
+
+func lineIndent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+// Retrieves the specified repo's descriptor from a parsed project file.
+func fileRepoDesc(m map[string]interface{},
+	repoName string) (map[string]interface{}, bool) {
+
+	itf, ok := newtutil.FlattenTopLevel(m)["repository."+repoName]
+	if !ok {
+		return nil, false
+	}
+
+	return cast.ToStringMap(itf), true
+}
+
+// Finds the file that defines the specified repo's version requirement:
+// either the specified project file or one of the fragments it includes.  A
+// file takes precedence over the fragments it includes, and a later fragment
+// over an earlier one.  If no file specifies a `vers` field, the file with
+// the highest precedence that declares the repo is returned.
+//
+// @return string               The path of the file; "" if no file declares
+//                                  the repo.
+// @return bool                 Whether the file specifies the repo's `vers`
+//                                  field.
+func repoDescFile(path string, repoName string, depth int) (
+	string, bool, error) {
+
+	if depth > PROJECT_INCLUDE_MAX_DEPTH {
+		return "", false, util.FmtNewtError(
+			"includes nested too deeply: %s", path)
+	}
+
+	m, err := readYmlMap(path)
+	if err != nil {
+		return "", false, err
+	}
+
+	best := ""
+	if desc, ok := fileRepoDesc(m, repoName); ok {
+		if _, ok := desc["vers"]; ok {
+			return path, true, nil
+		}
+		best = path
+	}
+
+	incs, err := includePaths(path, m)
+	if err != nil {
+		return "", false, err
+	}
+	for i := len(incs) - 1; i >= 0; i-- {
+		p, vers, err := repoDescFile(incs[i], repoName, depth+1)
+		if err != nil {
+			return "", false, err
+		}
+		if vers {
+			return p, true, nil
+		}
+		if best == "" {
+			best = p
+		}
+	}
+
+	return best, false, nil
+}
+
+// Returns the path of the file whose `vers` field pinning rewrites for the
+// specified repo.
+func (proj *Project) repoVersPath(repoName string) (string, error) {
+	projPath := proj.BasePath + "/" + PROJECT_FILE_NAME
+
+	path, _, err := repoDescFile(projPath, repoName, 0)
+	if err != nil {
+		return "", err
+	}
+	if path == "" {
+		return "", util.FmtNewtError(
+			"%s does not contain a descriptor for repo \"%s\"",
+			projPath, repoName)
+	}
+
+	return path, nil
+}
+
+// Reads the `vers` field of the specified repo's descriptor in a single
+// project file, ignoring overrides from any other file.
+func readFileRepoVers(path string, repoName string) (string, error) {
+	m, err := readYmlMap(path)
+	if err != nil {
+		return "", err
+	}
+
+	desc, _ := fileRepoDesc(m, repoName)
+	return cast.ToString(desc["vers"]), nil
+}
+
+// Locates the `vers` line in the specified repo's descriptor.
+//
+// @return int                  The index of the line defining the repo
+//                                  descriptor.
+// @return int                  The index of the `vers` line; -1 if the
+//                                  descriptor doesn't contain one.
+func findRepoVersLine(path string, lines []string, repoName string) (
+	int, int, error) {
+
+	sc := newtutil.NewSchemaChecker(path)
+	descLine := sc.KeyLine("repository." + repoName)
+	if descLine == 0 {
+		return 0, 0, util.FmtNewtError(
+			"%s does not contain a descriptor for repo \"%s\"",
+			path, repoName)
+	}
+
+	descIdx := descLine - 1
+	descIndent := lineIndent(lines[descIdx])
+	for i := descIdx + 1; i < len(lines); i++ {
+		t := strings.TrimSpace(lines[i])
+		if t == "" || strings.HasPrefix(t, "#") {
+			continue
+		}
+		if lineIndent(lines[i]) <= descIndent {
+			break
+		}
+		if strings.HasPrefix(t, "vers:") {
+			return descIdx, i, nil
+		}
+	}
+
+	return descIdx, -1, nil
+}
+
+// Replaces the `vers` field of the specified repo's descriptor.
+func rewriteRepoVers(path string, repoName string, vers string,
+	comment string) error {
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+	lines := strings.Split(string(b), "\n")
+
+	descIdx, versIdx, err := findRepoVersLine(path, lines, repoName)
+	if err != nil {
+		return err
+	}
+
+	var indent string
+	if versIdx == -1 {
+		// No `vers` field; add one as the first field of the descriptor.
+		indent = strings.Repeat(" ", lineIndent(lines[descIdx])+4)
+		if descIdx+1 < len(lines) &&
+			lineIndent(lines[descIdx+1]) > lineIndent(lines[descIdx]) {
+
+			indent = lines[descIdx+1][:lineIndent(lines[descIdx+1])]
+		}
+
+		versIdx = descIdx + 1
+		lines = append(lines[:versIdx],
+			append([]string{""}, lines[versIdx:]...)...)
+	} else {
+		indent = lines[versIdx][:lineIndent(lines[versIdx])]
+	}
+
+	// A version range such as ">=1.2.0" is not a valid plain YAML scalar.
+	line := indent + "vers: " + strconv.Quote(vers)
+	if comment != "" {
+		line += "  # " + comment
+	}
+	lines[versIdx] = line
+
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")),
+		0644); err != nil {
+
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// Reads the version requirement that a pinned repo was pinned from.  An empty
+// string is returned if the repo isn't pinned or the original requirement
+// wasn't recorded.
+func readPinnedFrom(path string, repoName string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", util.ChildNewtError(err)
+	}
+	lines := strings.Split(string(b), "\n")
+
+	_, versIdx, err := findRepoVersLine(path, lines, repoName)
+	if err != nil || versIdx == -1 {
+		return "", err
+	}
+
+	m := pinCommentRe.FindStringSubmatch(lines[versIdx])
+	if m == nil {
+		return "", nil
+	}
+
+	return m[1], nil
+}
+
+// Warns if `project.local.yml` overrides the version requirement that is
+// being rewritten; the override continues to take precedence.
+func (proj *Project) warnVersOverridden(repoName string) {
+	localPath := proj.BasePath + "/" + PROJECT_LOCAL_FILE_NAME
+	if !util.NodeExist(localPath) {
+		return
+	}
+
+	lm, err := readYmlMap(localPath)
+	if err != nil {
+		return
+	}
+
+	for k, v := range newtutil.FlattenTopLevel(lm) {
+		if k == "repository."+repoName {
+			if desc, err := cast.ToStringMapE(v); err == nil {
+				if _, ok := desc["vers"]; ok {
+					util.StatusMessage(util.VERBOSITY_QUIET,
+						"* Warning: %s overrides the version of repo "+
+							"\"%s\"; the override still takes precedence\n",
+						PROJECT_LOCAL_FILE_NAME, repoName)
+				}
+			}
+		}
+	}
+}
+
+// Pins a repo to its currently installed commit by rewriting its version
+// requirement in `project.yml` or the fragment that declares the repo.
+//
+// @return string               The hash the repo was pinned to.
+func (proj *Project) PinRepo(r *repo.Repo) (string, error) {
+	if !proj.RepoIsInstalled(r.Name()) {
+		return "", util.FmtNewtError("repo \"%s\" is not installed",
+			r.Name())
+	}
+
+	path, err := proj.repoVersPath(r.Name())
+	if err != nil {
+		return "", err
+	}
+
+	hash, err := r.CurrentHash()
+	if err != nil {
+		return "", err
+	}
+
+	// Describe the hash in terms a human will recognize: the installed
+	// version and any branches or tags that point at it.
+	descs := []string{}
+	if ver, err := proj.GetRepoVersion(r.Name()); err == nil && ver != nil &&
+		ver.Commit == "" {
+
+		descs = append(descs, ver.String())
+	}
+	commits, err := r.CurrentCommits()
+	if err != nil {
+		return "", err
+	}
+	refs := []string{}
+	for _, c := range commits {
+		if c != hash {
+			refs = append(refs, c)
+		}
+	}
+	if len(refs) > 0 {
+		descs = append(descs, strings.Join(refs, ", "))
+	}
+
+	from, err := readPinnedFrom(path, r.Name())
+	if err != nil {
+		return "", err
+	}
+	if from == "" {
+		from, err = readFileRepoVers(path, r.Name())
+		if err != nil {
+			return "", err
+		}
+	}
+
+	comment := fmt.Sprintf("%s \"%s\"", PIN_COMMENT_PREFIX, from)
+	if len(descs) > 0 {
+		comment += " (" + strings.Join(descs, "; ") + ")"
+	}
+
+	if err := rewriteRepoVers(path, r.Name(), hash+"-commit",
+		comment); err != nil {
+
+		return "", err
+	}
+
+	proj.warnVersOverridden(r.Name())
+	return hash, nil
+}
+
+// Restores the version requirement a repo had before it was pinned.
+//
+// @return string               The restored version requirement.
+func (proj *Project) UnpinRepo(r *repo.Repo) (string, error) {
+	path, err := proj.repoVersPath(r.Name())
+	if err != nil {
+		return "", err
+	}
+
+	from, err := readPinnedFrom(path, r.Name())
+	if err != nil {
+		return "", err
+	}
+	if from == "" {
+		return "", util.FmtNewtError(
+			"repo \"%s\" was not pinned with `newt repo pin`; edit its "+
+				"\"vers\" field in %s instead", r.Name(), PROJECT_FILE_NAME)
+	}
+
+	if err := rewriteRepoVers(path, r.Name(), from, ""); err != nil {
+		return "", err
+	}
+
+	proj.warnVersOverridden(r.Name())
+	return from, nil
+}
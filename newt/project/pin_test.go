@@ -0,0 +1,183 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package project
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRewriteRepoVers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pinComment := fmt.Sprintf("%s \"%s\"", PIN_COMMENT_PREFIX, "1-latest")
+
+	tests := []struct {
+		name    string
+		in      string
+		vers    string
+		comment string
+		want    string
+	}{
+		{
+			name: "replace",
+			in: "repository.core:\n" +
+				"    type: git\n" +
+				"    vers: 1-latest\n" +
+				"    url: https://example.com/core.git\n",
+			vers:    "0123abcd-commit",
+			comment: pinComment,
+			want: "repository.core:\n" +
+				"    type: git\n" +
+				"    vers: \"0123abcd-commit\"  # pinned from \"1-latest\"\n" +
+				"    url: https://example.com/core.git\n",
+		},
+		{
+			name: "unpin range",
+			in: "repository.core:\n" +
+				"    vers: \"0123abcd-commit\"  # pinned from \">=1.2.0\"\n",
+			vers: ">=1.2.0",
+			want: "repository.core:\n" +
+				"    vers: \">=1.2.0\"\n",
+		},
+		{
+			name: "add missing vers",
+			in: "repository.core:\n" +
+				"  type: git\n" +
+				"  url: https://example.com/core.git\n",
+			vers: "1.2.0",
+			want: "repository.core:\n" +
+				"  vers: \"1.2.0\"\n" +
+				"  type: git\n" +
+				"  url: https://example.com/core.git\n",
+		},
+		{
+			name: "only named repo",
+			in: "repository.nimble:\n" +
+				"    vers: 1-latest\n" +
+				"repository.core:\n" +
+				"    # comment\n" +
+				"    vers: 1-latest\n",
+			vers: "1.4.0",
+			want: "repository.nimble:\n" +
+				"    vers: 1-latest\n" +
+				"repository.core:\n" +
+				"    # comment\n" +
+				"    vers: \"1.4.0\"\n",
+		},
+		{
+			name: "vers of following repo is not used",
+			in: "repository.core:\n" +
+				"    type: git\n" +
+				"repository.nimble:\n" +
+				"    vers: 1-latest\n",
+			vers: "1.4.0",
+			want: "repository.core:\n" +
+				"    vers: \"1.4.0\"\n" +
+				"    type: git\n" +
+				"repository.nimble:\n" +
+				"    vers: 1-latest\n",
+		},
+	}
+
+	for i, tc := range tests {
+		path := filepath.Join(dir, fmt.Sprintf("project%d.yml", i))
+		if err := ioutil.WriteFile(path, []byte(tc.in), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := rewriteRepoVers(path, "core", tc.vers,
+			tc.comment); err != nil {
+
+			t.Errorf("%s: unexpected error: %s", tc.name, err.Error())
+			continue
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tc.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tc.name, string(b), tc.want)
+		}
+	}
+}
+
+func TestReadPinnedFrom(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "pinned",
+			in: "repository.core:\n" +
+				"    vers: \"0123abcd-commit\"  # pinned from \"1-latest\"\n",
+			want: "1-latest",
+		},
+		{
+			name: "pinned range",
+			in: "repository.core:\n" +
+				"    vers: \"0123abcd-commit\"  " +
+				"#pinned from \">=1.2.0 <2.0.0\"\n",
+			want: ">=1.2.0 <2.0.0",
+		},
+		{
+			name: "not pinned",
+			in: "repository.core:\n" +
+				"    vers: 1-latest  # track the latest release\n",
+			want: "",
+		},
+		{
+			name: "no vers",
+			in:   "repository.core:\n    type: git\n",
+			want: "",
+		},
+	}
+
+	for i, tc := range tests {
+		path := filepath.Join(dir, fmt.Sprintf("project%d.yml", i))
+		if err := ioutil.WriteFile(path, []byte(tc.in), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := readPinnedFrom(path, "core")
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.name, err.Error())
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
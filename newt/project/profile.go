@@ -0,0 +1,258 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// This file implements project profiles: named sets of overrides that are
+// applied on top of `project.yml` when selected with `newt --profile <name>`
+// (or the NEWT_PROFILE environment variable).  They let one project file serve
+// several environments, e.g., developer machines, CI, and release builds:
+//
+//     project.profiles:
+//         ci:
+//             repository.apache-mynewt-core:
+//                 vers: 1.9.0
+//                 token_env: CI_GITHUB_TOKEN
+//             flags:
+//                 frozen: true
+//                 jobs: 8
+//
+// A profile may override any `project.yml` setting.  Repo descriptors are
+// merged field by field, so a profile only needs to list the fields it
+// changes (e.g., a version requirement or a credentials source).  The
+// "flags" map supplies default values for command-line flags; a flag that is
+// specified on the command line takes precedence, and a flag that the
+// command doesn't accept is ignored.  This includes the flags that control
+// newt's output (e.g., verbose: true or loglevel: debug).  Overrides in
+// `project.local.yml` are applied after the profile.
+
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/util"
+)
+
+const PROJECT_PROFILES_KEY = "project.profiles"
+const PROFILE_FLAGS_KEY = "flags"
+
+// Validates the "project.profiles" map of `project.yml`.
+func checkProfiles(sc *newtutil.SchemaChecker, keys []string,
+	itf interface{}) {
+
+	profiles, err := cast.ToStringMapE(itf)
+	if err != nil {
+		sc.Errorf(keys, "\"%s\" must be a map", PROJECT_PROFILES_KEY)
+		return
+	}
+
+	known := map[string]bool{}
+	for _, k := range projectYmlKeys {
+		known[k] = true
+	}
+
+	for name, pitf := range profiles {
+		pkeys := append(append([]string{}, keys...), name)
+
+		profile, err := cast.ToStringMapE(pitf)
+		if err != nil {
+			sc.Errorf(pkeys, "profile \"%s\" must be a map", name)
+			continue
+		}
+
+		if v, ok := profile[PROFILE_FLAGS_KEY]; ok {
+			if _, err := cast.ToStringMapStringE(v); err != nil {
+				sc.Errorf(append(pkeys, PROFILE_FLAGS_KEY),
+					"\"%s\" must be a map of flag name to value",
+					PROFILE_FLAGS_KEY)
+			}
+		}
+
+		for k, v := range profileOverrides(profile) {
+			vkeys := append(append([]string{}, pkeys...), k)
+
+			switch {
+			case k == PROJECT_PROFILES_KEY || k == PROJECT_INCLUDE_KEY:
+				sc.Errorf(vkeys, "a profile can't specify \"%s\"", k)
+
+			case strings.HasPrefix(k, "repository."):
+				desc, err := cast.ToStringMapE(v)
+				if err != nil {
+					sc.Errorf(vkeys, "repo descriptor \"%s\" must be a map", k)
+					continue
+				}
+				repo.CheckRepoDesc(sc, vkeys, desc)
+				if itf, ok := desc["vers"]; ok {
+					repo.CheckVersReqs(sc, append(vkeys, "vers"),
+						cast.ToString(itf))
+				}
+
+			case !known[k]:
+				sc.Warnf(vkeys, "unknown key \"%s\"",
+					strings.Join(vkeys, "."))
+			}
+		}
+	}
+}
+
+// Retrieves the specified profile from the contents of `project.yml`.
+func findProfile(m map[string]interface{},
+	name string) (map[string]interface{}, error) {
+
+	profiles := cast.ToStringMap(
+		newtutil.FlattenTopLevel(m)[PROJECT_PROFILES_KEY])
+
+	profile, ok := profiles[name]
+	if !ok {
+		names := []string{}
+		for n, _ := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+
+		if len(names) == 0 {
+			return nil, util.FmtNewtError(
+				"unknown profile \"%s\"; %s doesn't define any profiles",
+				name, PROJECT_FILE_NAME)
+		}
+		return nil, util.FmtNewtError(
+			"unknown profile \"%s\"; available profiles: %s",
+			name, strings.Join(names, ", "))
+	}
+
+	return cast.ToStringMap(profile), nil
+}
+
+// Retrieves the `project.yml` settings that a profile overrides, i.e.,
+// everything but its flags.
+func profileOverrides(
+	profile map[string]interface{}) map[string]interface{} {
+
+	overrides := map[string]interface{}{}
+	for k, v := range profile {
+		if k != PROFILE_FLAGS_KEY {
+			overrides[k] = v
+		}
+	}
+
+	return newtutil.FlattenTopLevel(overrides)
+}
+
+// Retrieves the names of every repo the specified project can use: those
+// listed in `project.yml`, in any of its profiles, or in `project.local.yml`.
+// Unlike the project's repos, this doesn't depend on the selected profile.
+// The project is not loaded.
+func AllRepoNames(basePath string) ([]string, error) {
+	m, err := readProjectYml(basePath+"/"+PROJECT_FILE_NAME, nil)
+	if err != nil {
+		return nil, err
+	}
+	maps := []map[string]interface{}{newtutil.FlattenTopLevel(m)}
+
+	profiles := cast.ToStringMap(maps[0][PROJECT_PROFILES_KEY])
+	for _, profile := range profiles {
+		maps = append(maps, profileOverrides(cast.ToStringMap(profile)))
+	}
+
+	localPath := basePath + "/" + PROJECT_LOCAL_FILE_NAME
+	if util.NodeExist(localPath) {
+		lm, err := readProjectYml(localPath, nil)
+		if err != nil {
+			return nil, err
+		}
+		maps = append(maps, newtutil.FlattenTopLevel(lm))
+	}
+
+	nameMap := map[string]bool{}
+	for _, m := range maps {
+		for k, _ := range m {
+			if name := strings.TrimPrefix(k, "repository."); name != k {
+				nameMap[name] = true
+			}
+		}
+	}
+
+	names := []string{}
+	for name, _ := range nameMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Applies the selected profile, if any, to the contents of `project.yml`.
+func applyProfile(m map[string]interface{}) error {
+	if newtutil.NewtProfile == "" {
+		return nil
+	}
+
+	profile, err := findProfile(m, newtutil.NewtProfile)
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Applying profile \"%s\"", newtutil.NewtProfile)
+	util.StatusMessage(util.VERBOSITY_VERBOSE,
+		"Applying profile \"%s\"\n", newtutil.NewtProfile)
+
+	mergeYmlMaps(m, profileOverrides(profile))
+
+	return nil
+}
+
+// Retrieves the command-line flag defaults that the selected profile
+// specifies.  The project is not loaded.  Returns nil if no profile is
+// selected or newt isn't running inside a project.
+//
+// @return map[string]string    Flag values, indexed by flag name.
+func ProfileFlags() (map[string]string, error) {
+	if newtutil.NewtProfile == "" {
+		return nil, nil
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	dir, err := findProjectDir(filepath.ToSlash(wd))
+	if err != nil {
+		return nil, nil
+	}
+
+	m, err := readProjectYml(dir+"/"+PROJECT_FILE_NAME, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := findProfile(m, newtutil.NewtProfile)
+	if err != nil {
+		return nil, err
+	}
+
+	return cast.ToStringMapString(profile[PROFILE_FLAGS_KEY]), nil
+}
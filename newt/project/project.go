@@ -20,10 +20,13 @@
 package project
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
@@ -36,6 +39,7 @@ import (
 	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/newt/workspace"
 	"mynewt.apache.org/newt/newt/ycfg"
 	"mynewt.apache.org/newt/util"
 )
@@ -47,6 +51,7 @@ const PROJECT_FILE_NAME = "project.yml"
 var ignoreSearchDirs []string = []string{
 	"bin",
 	"repos",
+	"snapshots",
 }
 
 type Project struct {
@@ -75,13 +80,28 @@ type Project struct {
 	// Required versions of installed repos, as read from `project.yml`.
 	rootRepoReqs deprepo.RequirementMap
 
+	// For each repo, the names of the repos whose `repository.yml` files
+	// declare it as a dependency.
+	repoDependents map[string][]string
+
 	warnings []string
 
 	// Indicates the repos whose version we couldn't detect.  Prevents
 	// duplicate warnings.
 	unknownRepoVers map[string]struct{}
 
+	// Repos containing shared target definitions, in order of precedence.
+	// Targets in these repos can be referenced by their short name.
+	targetRepos []string
+
 	yc ycfg.YCfg
+
+	// Vendored repos, as read from `vendor/vendor.yml`; nil if the project
+	// doesn't use vendored repos.
+	vendored map[string]vendoredRepo
+
+	// The workspace the project is a member of; nil if none.
+	workspace *workspace.Workspace
 }
 
 func initProject(dir string) error {
@@ -159,10 +179,22 @@ func (proj *Project) Path() string {
 	return proj.BasePath
 }
 
+// Returns the workspace the project is a member of, or nil if it isn't in a
+// workspace.
+func (proj *Project) Workspace() *workspace.Workspace {
+	return proj.workspace
+}
+
 func (proj *Project) Name() string {
 	return proj.name
 }
 
+// Returns the project's settings: the contents of `project.yml`, with any
+// overrides from `project.local.yml` applied.
+func (proj *Project) Config() ycfg.YCfg {
+	return proj.yc
+}
+
 func (proj *Project) Repos() map[string]*repo.Repo {
 	return proj.repos
 }
@@ -234,10 +266,22 @@ func (proj *Project) RepoIsRoot(rname string) bool {
 	return proj.rootRepoReqs[rname] != nil
 }
 
+// Returns the names of the repos that declare the specified repo as a
+// dependency in their `repository.yml` files, sorted.
+func (proj *Project) RepoDependents(rname string) []string {
+	return proj.repoDependents[rname]
+}
+
 func (proj *Project) LocalRepo() *repo.Repo {
 	return proj.localRepo
 }
 
+// Returns the names of the repos listed in the `project.target_repos`
+// setting, in order of precedence.
+func (proj *Project) TargetRepos() []string {
+	return proj.targetRepos
+}
+
 func (proj *Project) Warnings() []string {
 	return proj.warnings
 }
@@ -257,11 +301,16 @@ func (proj *Project) SelectRepos(pred func(r *repo.Repo) bool) []*repo.Repo {
 	return filtered
 }
 
-// Installs or upgrades repos matching the specified predicate.
+// Installs or upgrades repos matching the specified predicate.  The stash and
+// dry-run settings only apply to upgrades.
 func (proj *Project) InstallIf(
-	upgrade bool, force bool, ask bool,
+	upgrade bool, force bool, ask bool, stash bool, dryRun bool,
 	predicate func(r *repo.Repo) bool) error {
 
+	// Fetching a repo's `repository.yml` file may clone the repo, so record
+	// the commits for the lifecycle hooks first.
+	before := proj.repoCommits()
+
 	// Make sure we have an up to date copy of all `repository.yml` files.
 	if err := proj.downloadRepositoryYmlFiles(); err != nil {
 		return err
@@ -271,23 +320,57 @@ func (proj *Project) InstallIf(
 	// install procedure locally.
 
 	// Determine which repos the user wants to install or upgrade.
-	specifiedRepoList := proj.SelectRepos(predicate)
+	specifiedRepoList := proj.SelectRepos(proj.skipVendored(predicate))
 
 	inst, err := install.NewInstaller(proj.repos, proj.rootRepoReqs)
 	if err != nil {
 		return err
 	}
 
+	op := HOOK_OP_INSTALL
+	if upgrade {
+		op = HOOK_OP_UPGRADE
+	}
+	if !dryRun {
+		if err := proj.runPreHooks(op, specifiedRepoList,
+			before); err != nil {
+
+			return err
+		}
+	}
+
 	if upgrade {
-		return inst.Upgrade(specifiedRepoList, ask)
+		err = inst.Upgrade(specifiedRepoList, ask, stash, dryRun)
 	} else {
-		return inst.Install(specifiedRepoList, force, ask)
+		// Reproduce the commits recorded in the lock file, if any.
+		locked, lockErr := proj.lockedCommits()
+		if lockErr != nil {
+			return lockErr
+		}
+		inst.UseLockedCommits(locked)
+
+		err = inst.Install(specifiedRepoList, force, ask)
 	}
+	if err != nil || dryRun {
+		return err
+	}
+
+	if err := proj.writeLock(inst.CheckedOut()); err != nil {
+		return err
+	}
+
+	return proj.runPostHooks(op, before)
 }
 
 // Syncs (i.e., applies `git pull` to) repos matching the specified predicate.
+// If dryRun is true, the sync is only reported.
 func (proj *Project) SyncIf(
-	force bool, ask bool, predicate func(r *repo.Repo) bool) error {
+	force bool, ask bool, dryRun bool,
+	predicate func(r *repo.Repo) bool) error {
+
+	// Fetching a repo's `repository.yml` file may clone the repo, so record
+	// the commits for the lifecycle hooks first.
+	before := proj.repoCommits()
 
 	// Make sure we have an up to date copy of all `repository.yml` files.
 	if err := proj.downloadRepositoryYmlFiles(); err != nil {
@@ -295,14 +378,30 @@ func (proj *Project) SyncIf(
 	}
 
 	// Determine which repos the user wants to sync.
-	repoList := proj.SelectRepos(predicate)
+	repoList := proj.SelectRepos(proj.skipVendored(predicate))
 
 	inst, err := install.NewInstaller(proj.repos, proj.rootRepoReqs)
 	if err != nil {
 		return err
 	}
 
-	return inst.Sync(repoList, ask)
+	if !dryRun {
+		if err := proj.runPreHooks(HOOK_OP_SYNC, repoList,
+			before); err != nil {
+
+			return err
+		}
+	}
+
+	if err := inst.Sync(repoList, ask, dryRun); err != nil || dryRun {
+		return err
+	}
+
+	if err := proj.writeLock(inst.CheckedOut()); err != nil {
+		return err
+	}
+
+	return proj.runPostHooks(HOOK_OP_SYNC, before)
 }
 
 // Loads a complete repo definition from the appropriate `repository.yml` file.
@@ -333,6 +432,39 @@ func (proj *Project) loadRepo(name string, fields map[string]string) (
 	if err != nil {
 		return nil, err
 	}
+	if fields["subtree"] != "" && fields["root"] != "" {
+		return nil, util.FmtNewtError(
+			"repo \"%s\" specifies both \"subtree\" and \"root\"", name)
+	}
+	if fields["subtree"] != "" {
+		if err := r.UseSubtree(fields["subtree"]); err != nil {
+			return nil, err
+		}
+	}
+	if fields["root"] != "" {
+		if err := r.UseRoot(fields["root"]); err != nil {
+			return nil, err
+		}
+	}
+	proj.applyVendored(r)
+
+	if fields["patches"] != "" {
+		patches := []string{}
+		for _, p := range strings.FieldsFunc(fields["patches"],
+			func(c rune) bool { return c == ',' || c == ' ' }) {
+
+			if !filepath.IsAbs(p) {
+				p = proj.BasePath + "/" + p
+			}
+			if util.NodeNotExist(p) {
+				return nil, util.FmtNewtError(
+					"Patch file for repo \"%s\" does not exist: %s",
+					name, p)
+			}
+			patches = append(patches, p)
+		}
+		r.SetPatches(patches)
+	}
 
 	for _, ignDir := range ignoreSearchDirs {
 		r.AddIgnoreDir(ignDir)
@@ -355,7 +487,16 @@ func (proj *Project) loadRepo(name string, fields map[string]string) (
 		case compat.NEWT_COMPAT_WARN:
 			util.StatusMessage(util.VERBOSITY_QUIET, "WARNING: %s.\n", msg)
 		case compat.NEWT_COMPAT_ERROR:
-			return nil, util.NewNewtError(msg)
+			if reqVer := r.RequiredNewtVersion(
+				*ver, newtutil.NewtVersion); reqVer != nil {
+
+				msg += "\n" + install.NewtUpgradeText(*reqVer)
+			}
+			if newtutil.NewtIgnoreCompat {
+				util.StatusMessage(util.VERBOSITY_QUIET, "WARNING: %s\n", msg)
+			} else {
+				return nil, util.NewNewtError(msg)
+			}
 		}
 	}
 
@@ -398,30 +539,103 @@ func (proj *Project) checkNewtVer() error {
 	}
 }
 
-// Loads the `repository.yml` file for each depended-on repo.  This
+// The repo descriptor fields that identify where a repo is downloaded from.
+var repoLocationFields = []string{
+	"type", "url", "user", "org", "project", "repo", "server", "path",
+}
+
+// Indicates whether two repo descriptors refer to the same download
+// location.
+func sameRepoLocation(a map[string]string, b map[string]string) bool {
+	for _, f := range repoLocationFields {
+		if a[f] != b[f] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (proj *Project) addWarning(w string) {
+	for _, prev := range proj.warnings {
+		if prev == w {
+			return
+		}
+	}
+	proj.warnings = append(proj.warnings, w)
+}
+
+// Loads the `repository.yml` file for each depended-on repo, recursively, so
+// that a project only needs to list the repos it uses directly.  A repo that
+// isn't listed in `project.yml` is loaded from the descriptor in the first
+// `repository.yml` that declares it.
+//
+// @param download              Whether to download each depended-on repo's
+//                                  `repository.yml` file; if false, only the
+//                                  files already on disk are read.
 func (proj *Project) loadRepoDeps(download bool) error {
 	seen := map[string]struct{}{}
+	dependents := map[string]map[string]struct{}{}
+
+	// The repo whose dependency declaration each loaded repo was read from,
+	// and that declaration.
+	declaredBy := map[string]string{}
+	declFields := map[string]map[string]string{}
 
 	loadDeps := func(r *repo.Repo) ([]*repo.Repo, error) {
 		var newRepos []*repo.Repo
 
 		depMap := r.CommitDepMap()
-		for _, depSlice := range depMap {
-			for _, dep := range depSlice {
-				if _, ok := seen[dep.Name]; !ok {
-					seen[r.Name()] = struct{}{}
+		commits := make([]string, 0, len(depMap))
+		for commit, _ := range depMap {
+			commits = append(commits, commit)
+		}
+		sort.Strings(commits)
+
+		for _, commit := range commits {
+			for _, dep := range depMap[commit] {
+				if dependents[dep.Name] == nil {
+					dependents[dep.Name] = map[string]struct{}{}
+				}
+				dependents[dep.Name][r.Name()] = struct{}{}
+
+				if prev, ok := declaredBy[dep.Name]; ok && prev != r.Name() &&
+					!sameRepoLocation(declFields[dep.Name], dep.Fields) {
 
-					depRepo := proj.repos[dep.Name]
+					proj.addWarning(fmt.Sprintf(
+						"repos \"%s\" and \"%s\" declare different "+
+							"download locations for repo \"%s\"; using the "+
+							"one from \"%s\" (list the repo in project.yml "+
+							"to choose)", prev, r.Name(), dep.Name, prev))
+				}
+
+				if _, ok := seen[dep.Name]; ok {
+					continue
+				}
+				seen[dep.Name] = struct{}{}
+
+				depRepo := proj.repos[dep.Name]
+				if depRepo == nil {
+					// A repo whose `repository.yml` hasn't been downloaded
+					// yet fails to read; only an invalid descriptor is an
+					// error.
+					var err error
+					depRepo, err = proj.loadRepo(dep.Name, dep.Fields)
 					if depRepo == nil {
-						depRepo, _ = proj.loadRepo(dep.Name, dep.Fields)
-						proj.repos[dep.Name] = depRepo
+						return nil, util.FmtNewtError(
+							"repo \"%s\" declares an invalid dependency "+
+								"on repo \"%s\": %s",
+							r.Name(), dep.Name, err.Error())
 					}
-					newRepos = append(newRepos, depRepo)
+					proj.repos[dep.Name] = depRepo
+					declaredBy[dep.Name] = r.Name()
+					declFields[dep.Name] = dep.Fields
+				}
+				newRepos = append(newRepos, depRepo)
 
-					if download {
-						if _, err := depRepo.UpdateDesc(); err != nil {
-							return nil, err
-						}
+				if download {
+					if _, err := depRepo.UpdateDesc(); err != nil {
+						return nil, err
 					}
 				}
 			}
@@ -446,6 +660,15 @@ func (proj *Project) loadRepoDeps(download bool) error {
 		curRepos = nextRepos
 	}
 
+	proj.repoDependents = map[string][]string{}
+	for name, names := range dependents {
+		for dependent, _ := range names {
+			proj.repoDependents[name] = append(proj.repoDependents[name],
+				dependent)
+		}
+		sort.Strings(proj.repoDependents[name])
+	}
+
 	return nil
 }
 
@@ -468,9 +691,37 @@ func (proj *Project) downloadRepositoryYmlFiles() error {
 	return nil
 }
 
+// Calculates a digest of the repo definitions in the project's configuration,
+// i.e., of every "repository.<name>" entry after overrides are applied.
+func repoDefsDigest(yc ycfg.YCfg) string {
+	keys := []string{}
+	for k, _ := range yc.AllSettings() {
+		if strings.HasPrefix(k, "repository.") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		fields := yc.GetValStringMapString(k, nil)
+		names := make([]string, 0, len(fields))
+		for name, _ := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Fprintf(h, "%s\n", k)
+		for _, name := range names {
+			fmt.Fprintf(h, "    %s=%s\n", name, fields[name])
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 func (proj *Project) loadConfig() error {
-	yc, err := newtutil.ReadConfig(proj.BasePath,
-		strings.TrimSuffix(PROJECT_FILE_NAME, ".yml"))
+	yc, err := readProjectConfig(proj.BasePath)
 	if err != nil {
 		return util.NewNewtError(err.Error())
 	}
@@ -478,9 +729,22 @@ func (proj *Project) loadConfig() error {
 	// this avoids keeping every string around as a project variable when
 	// we need to process it later.
 	proj.yc = yc
+	repo.DescCacheConfigKey = repoDefsDigest(yc)
 
 	proj.name = yc.GetValString("project.name", nil)
 
+	if yc.GetValBool("project.use_vendor", nil) {
+		proj.vendored, err = readVendorManifest(proj.vendorPath())
+		if err != nil {
+			return err
+		}
+		if proj.vendored == nil {
+			util.StatusMessage(util.VERBOSITY_QUIET,
+				"* Warning: project.use_vendor is set, but no repos have "+
+					"been vendored; run `newt vendor`\n")
+		}
+	}
+
 	// Local repository always included in initialization
 	r, err := repo.NewLocalRepo(proj.name)
 	if err != nil {
@@ -493,13 +757,28 @@ func (proj *Project) loadConfig() error {
 		r.AddIgnoreDir(ignDir)
 	}
 
+	// Vendored repo copies are loaded as repos of their own; only the
+	// project's `vendor` directory is excluded.  A directory named `vendor`
+	// inside a repo contains ordinary packages.
+	r.AddIgnoreDir(VENDOR_DIR)
+
 	// Assume every item starting with "repository." is a repository descriptor
 	// and try to load it.
 	for k, _ := range yc.AllSettings() {
 		repoName := strings.TrimPrefix(k, "repository.")
 		if repoName != k {
-			fields := yc.GetValStringMapString(k, nil)
-			r, _ := proj.loadRepo(repoName, fields)
+			fields, err := downloader.ExpandRepoVars(repoName,
+				yc.GetValStringMapString(k, nil))
+			if err != nil {
+				return err
+			}
+
+			// A repo whose `repository.yml` hasn't been downloaded yet fails
+			// to read; only an invalid descriptor is an error.
+			r, err := proj.loadRepo(repoName, fields)
+			if r == nil {
+				return err
+			}
 
 			verReqs, err := newtutil.ParseRepoVersionReqs(fields["vers"])
 			if err != nil {
@@ -538,9 +817,22 @@ func (proj *Project) loadConfig() error {
 		r.AddIgnoreDir(dirName)
 	}
 
+	proj.targetRepos = yc.GetValStringSlice("project.target_repos", nil)
+	for i, repoName := range proj.targetRepos {
+		repoName = strings.TrimPrefix(repoName, "@")
+		if proj.FindRepo(repoName) == nil {
+			return util.FmtNewtError("target_repos: unknown repo %s",
+				repoName)
+		}
+		proj.targetRepos[i] = repoName
+	}
+
 	if err := proj.checkNewtVer(); err != nil {
 		return err
 	}
+	if err := proj.checkNewtPin(); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -554,6 +846,24 @@ func (proj *Project) Init(dir string) error {
 	proj.repos = map[string]*repo.Repo{}
 	proj.rootRepoReqs = map[string][]newtutil.RepoVersionReq{}
 
+	// A project in a workspace keeps its repos in the workspace's shared
+	// store.
+	ws, err := workspace.FindForProject(proj.BasePath)
+	if err != nil {
+		return err
+	}
+	proj.workspace = ws
+	if ws != nil {
+		log.Debugf("Project is in workspace %s; using repo store %s",
+			ws.BasePath, ws.ReposDir)
+		repo.SetReposDir(ws.ReposDir)
+	} else {
+		repo.SetReposDir("")
+	}
+
+	// Clean up after any download that was interrupted last time.
+	repo.CleanPartialDownloads()
+
 	// Load Project configuration
 	if err := proj.loadConfig(); err != nil {
 		return err
@@ -0,0 +1,92 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package project
+
+import (
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/repo"
+)
+
+// The keys that may appear in `project.yml`, other than repo descriptors
+// ("repository.<name>").  "project.repositories" is accepted for the sake of
+// older projects; newt ignores it.
+var projectYmlKeys = []string{
+	PROJECT_INCLUDE_KEY,
+	"audit.license_policy",
+	"project.ignore_dirs",
+	PROJECT_HOOKS_KEY,
+	"project.name",
+	"project.newt_compatibility",
+	"project.newt_sha256",
+	"project.newt_version",
+	PROJECT_PROFILES_KEY,
+	"project.repositories",
+	"project.target_repos",
+	"project.use_vendor",
+	"signing.profiles",
+}
+
+// Validates the contents of `project.yml` or `project.local.yml`.  Unknown
+// keys produce warnings; malformed repo descriptors are errors.
+func validateProjectYml(path string, m map[string]interface{}) error {
+	sc := newtutil.NewSchemaChecker(path)
+
+	known := map[string]bool{}
+	for _, k := range projectYmlKeys {
+		known[k] = true
+	}
+
+	for k, v := range newtutil.FlattenTopLevel(m) {
+		keys := []string{k}
+
+		if k == PROJECT_HOOKS_KEY {
+			checkHooks(sc, keys, v)
+			continue
+		}
+		if k == PROJECT_PROFILES_KEY {
+			checkProfiles(sc, keys, v)
+			continue
+		}
+
+		if !strings.HasPrefix(k, "repository.") {
+			if !known[k] {
+				sc.Warnf(keys, "unknown key \"%s\"", k)
+			}
+			continue
+		}
+
+		desc, err := cast.ToStringMapE(v)
+		if err != nil {
+			sc.Errorf(keys, "repo descriptor \"%s\" must be a map", k)
+			continue
+		}
+
+		repo.CheckRepoDesc(sc, keys, desc)
+		if itf, ok := desc["vers"]; ok {
+			repo.CheckVersReqs(sc, append(keys, "vers"), cast.ToString(itf))
+		}
+	}
+
+	return sc.Report()
+}
@@ -0,0 +1,295 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// This file implements vendoring: copying the project's external repos into
+// the project itself so that all source can be checked into a single
+// repository.  `newt vendor` copies each installed repo, without its version
+// control metadata, to `vendor/<repo-name>` and records where each copy came
+// from in `vendor/vendor.yml`:
+//
+//     vendor.repos:
+//         apache-mynewt-core:
+//             vers: 1.4.0
+//             commit: 6e6ee2ad5e8b1ef2e31bb1d0b7c7b26a7d0b4e8c
+//
+// A project that sets `project.use_vendor: true` in `project.yml` loads its
+// repos from the vendored copies rather than from `repos/`.
+
+package project
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/util"
+	"mynewt.apache.org/newt/yaml"
+)
+
+const VENDOR_DIR = "vendor"
+const VENDOR_MANIFEST_FILE_NAME = "vendor.yml"
+
+// Vendoring writes to a directory with this name and swaps it into place
+// once every repo has been copied.
+const VENDOR_PARTIAL_DIR = ".vendor-partial"
+
+type vendoredRepo struct {
+	Vers   string
+	Commit string
+}
+
+func (proj *Project) vendorPath() string {
+	return proj.BasePath + "/" + VENDOR_DIR
+}
+
+func readVendorManifest(vendorPath string) (map[string]vendoredRepo, error) {
+	path := vendorPath + "/" + VENDOR_MANIFEST_FILE_NAME
+	if util.NodeNotExist(path) {
+		return nil, nil
+	}
+
+	yc, err := newtutil.ReadConfigPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	vendored := map[string]vendoredRepo{}
+	for name, itf := range yc.GetValStringMap("vendor.repos", nil) {
+		fields := cast.ToStringMapString(itf)
+		vendored[name] = vendoredRepo{
+			Vers:   fields["vers"],
+			Commit: fields["commit"],
+		}
+	}
+
+	return vendored, nil
+}
+
+// Directs the specified repo to use its vendored copy, if the project uses
+// vendored repos and the repo has been vendored.
+func (proj *Project) applyVendored(r *repo.Repo) {
+	vr, ok := proj.vendored[r.Name()]
+	if !ok {
+		return
+	}
+
+	path := proj.vendorPath() + "/" + r.Name()
+	if util.NodeNotExist(path) {
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"* Warning: vendored repo \"%s\" missing from %s; using "+
+				"repos/%s\n", r.Name(), proj.vendorPath(), r.Name())
+		return
+	}
+
+	var ver *newtutil.RepoVersion
+	if vr.Vers != "" {
+		v, err := newtutil.ParseRepoVersion(vr.Vers)
+		if err == nil {
+			ver = &v
+		}
+	}
+
+	r.UseVendored(path, vr.Commit, ver)
+}
+
+// Copies a directory tree, omitting version control metadata.
+func copyVendorTree(srcDir string, dstDir string) error {
+	return filepath.Walk(srcDir,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(srcDir, path)
+			if err != nil {
+				return err
+			}
+			dst := filepath.Join(dstDir, rel)
+
+			if info.IsDir() && info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+
+			switch {
+			case info.Mode()&os.ModeSymlink != 0:
+				target, err := os.Readlink(path)
+				if err != nil {
+					return err
+				}
+				return os.Symlink(target, dst)
+
+			case info.IsDir():
+				return os.MkdirAll(dst, info.Mode().Perm())
+
+			default:
+				if info.Name() == ".git" {
+					// A worktree or submodule link file.
+					return nil
+				}
+				return util.CopyFile(path, dst)
+			}
+		})
+}
+
+func writeVendorManifest(path string, names []string,
+	vendored map[string]vendoredRepo) error {
+
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "# Generated by newt; do not edit.  Run "+
+		"`newt vendor` to update.\n")
+	fmt.Fprintf(&buf, "vendor.repos:\n")
+	for _, name := range names {
+		vr := vendored[name]
+		fmt.Fprintf(&buf, "    %s:\n", name)
+		fmt.Fprintf(&buf, "        vers: %s\n", yaml.EscapeString(vr.Vers))
+		fmt.Fprintf(&buf, "        commit: %s\n", vr.Commit)
+	}
+
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// Copies every installed external repo into the project's `vendor`
+// directory, replacing any previously vendored copies.  Repos with
+// uncommitted changes are only vendored if force is true.
+//
+// @return []string             The names of the vendored repos.
+func (proj *Project) Vendor(force bool) ([]string, error) {
+	names := []string{}
+	for name, r := range proj.repos {
+		if r == nil || r.IsLocal() {
+			continue
+		}
+		if r.IsVendored() {
+			return nil, util.FmtNewtError(
+				"Repo \"%s\" is loaded from its vendored copy; remove "+
+					"project.use_vendor from project.yml and run "+
+					"`newt install` before re-vendoring", name)
+		}
+		if util.NodeNotExist(r.Path()) {
+			return nil, util.FmtNewtError(
+				"Repo \"%s\" is not installed; run `newt install` first", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	vendored := map[string]vendoredRepo{}
+	dirty := []string{}
+	for _, name := range names {
+		r := proj.repos[name]
+
+		changes, err := r.HasChanges()
+		if err != nil {
+			return nil, err
+		}
+		if changes {
+			dirty = append(dirty, name)
+		}
+
+		commit, err := r.CurrentHash()
+		if err != nil {
+			return nil, err
+		}
+
+		vr := vendoredRepo{Commit: commit}
+		if ver, err := r.InstalledVersion(); err == nil && ver != nil {
+			vr.Vers = ver.String()
+		}
+		vendored[name] = vr
+	}
+
+	if len(dirty) > 0 && !force {
+		return nil, util.FmtNewtError(
+			"Repos contain uncommitted changes: %s; commit them or use "+
+				"-f to vendor them anyway", strings.Join(dirty, ", "))
+	}
+
+	partialPath := proj.BasePath + "/" + VENDOR_PARTIAL_DIR
+	if err := os.RemoveAll(partialPath); err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+	if err := os.MkdirAll(partialPath, repo.REPO_DEFAULT_PERMS); err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	for _, name := range names {
+		r := proj.repos[name]
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Vendoring \"%s\" (%s)\n", name, vendored[name].Commit)
+
+		if err := copyVendorTree(r.Path(),
+			partialPath+"/"+name); err != nil {
+
+			os.RemoveAll(partialPath)
+			return nil, util.FmtNewtError("Error vendoring \"%s\": %s",
+				name, err.Error())
+		}
+	}
+
+	err := writeVendorManifest(partialPath+"/"+VENDOR_MANIFEST_FILE_NAME,
+		names, vendored)
+	if err != nil {
+		os.RemoveAll(partialPath)
+		return nil, err
+	}
+
+	if err := os.RemoveAll(proj.vendorPath()); err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+	if err := os.Rename(partialPath, proj.vendorPath()); err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	return names, nil
+}
+
+// Indicates whether the project loads its repos from vendored copies.
+func (proj *Project) UsesVendor() bool {
+	return proj.vendored != nil
+}
+
+// Wraps a repo predicate such that it rejects vendored repos.  Vendored repos
+// are part of the project and can't be installed, upgraded, or synced.
+func (proj *Project) skipVendored(
+	pred func(r *repo.Repo) bool) func(r *repo.Repo) bool {
+
+	return func(r *repo.Repo) bool {
+		if !pred(r) {
+			return false
+		}
+		if r.IsVendored() {
+			util.StatusMessage(util.VERBOSITY_VERBOSE,
+				"Skipping \"%s\": using vendored copy\n", r.Name())
+			return false
+		}
+		return true
+	}
+}
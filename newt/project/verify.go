@@ -0,0 +1,78 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package project
+
+import (
+	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/util"
+)
+
+// Determines the hash that the specified repo is expected to be checked out
+// at, and the file that specifies it.  The lock file takes precedence over a
+// commit pinned in `project.yml`.  An empty hash is returned if neither
+// specifies one.  A pinned commit that doesn't exist in the repo is returned
+// as written, so that it is reported as a mismatch.
+func (proj *Project) expectedCommit(r *repo.Repo,
+	lock map[string]lockedRepo) (string, string) {
+
+	if lr, ok := lock[r.Name()]; ok && lr.Vers == proj.rootReqString(r.Name()) {
+		return lr.Commit, PROJECT_LOCK_FILE_NAME
+	}
+
+	reqs := proj.rootRepoReqs[r.Name()]
+	if len(reqs) == 1 && reqs[0].Ver.Commit != "" {
+		commit := reqs[0].Ver.Commit
+		if hash, err := r.VCSState().HashFor(r.Path(), commit); err == nil {
+			commit = hash
+		}
+		return commit, PROJECT_FILE_NAME
+	}
+
+	return "", ""
+}
+
+// Checks each repo matching the specified predicate against the project's
+// expectations without modifying anything.  Local and vendored repos are not
+// checked.
+func (proj *Project) VerifyRepos(
+	predicate func(r *repo.Repo) bool) ([]repo.VerifyReport, error) {
+
+	lock, err := proj.readLock()
+	if err != nil {
+		return nil, err
+	}
+
+	reports := []repo.VerifyReport{}
+	for _, r := range proj.SelectRepos(proj.skipVendored(predicate)) {
+		if r.IsLocal() {
+			continue
+		}
+
+		expCommit := ""
+		expSource := ""
+		if util.NodeExist(r.Path()) {
+			expCommit, expSource = proj.expectedCommit(r, lock)
+		}
+
+		reports = append(reports, r.Verify(expCommit, expSource))
+	}
+
+	return reports, nil
+}
@@ -0,0 +1,342 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package registry searches package indexes for the repos that provide a
+// package.  An index is a YAML file with the following format:
+//
+//     repos:
+//         - name: apache-mynewt-core
+//           description: Apache Mynewt OS and drivers
+//           type: github
+//           user: apache
+//           repo: mynewt-core
+//           vers: 1-latest
+//           packages:
+//               - name: hw/drivers/sensors/bme280
+//                 description: Bosch BME280 environmental sensor driver
+//                 keywords: [sensor, temperature, humidity, i2c]
+//
+// Repo descriptor fields (see downloader.RepoFields) are copied into the
+// repo's `project.yml` descriptor when the repo is added to a project; any
+// other field is ignored.
+//
+// Indexes are listed in newtrc.  A remote index must be served over https:
+//
+//     search.indexes:
+//         mycorp: https://example.com/mynewt-index.yml
+package registry
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/downloader"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/settings"
+	"mynewt.apache.org/newt/util"
+)
+
+// Repo names from an index end up as `project.yml` keys.
+var repoNameRe = regexp.MustCompile(`^[A-Za-z0-9_\-.]+$`)
+
+type IndexPkg struct {
+	Name        string
+	Description string
+	Keywords    []string
+}
+
+type IndexRepo struct {
+	Name        string
+	Description string
+	Index       string
+
+	// The repo's `project.yml` descriptor.
+	Fields map[string]string
+
+	Packages []*IndexPkg
+}
+
+type Index struct {
+	Name     string
+	Location string
+	Repos    []*IndexRepo
+}
+
+// A repo that matched a search, along with its matching packages.
+type Match struct {
+	Repo *IndexRepo
+
+	// True if the repo itself (name or description) matched.
+	RepoMatched bool
+
+	Pkgs []*IndexPkg
+}
+
+// Returns the configured indexes as a map of name to location.
+func IndexLocations() map[string]string {
+	locs := map[string]string{}
+
+	nrc := settings.Newtrc()
+	for name, loc := range nrc.GetValStringMapString("search.indexes", nil) {
+		if loc != "" {
+			locs[name] = loc
+		}
+	}
+
+	return locs
+}
+
+// Copies a remote index to a temporary file.  The caller is responsible for
+// deleting the file.
+func downloadIndex(url string) (string, error) {
+	rsp, err := downloader.HttpGet(url)
+	if err != nil {
+		return "", util.FmtNewtError(
+			"Failed to download package index: %s", err.Error())
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return "", util.FmtNewtError(
+			"Failed to download package index from %s: %s", url, rsp.Status)
+	}
+
+	f, err := ioutil.TempFile("", "newt-index")
+	if err != nil {
+		return "", util.ChildNewtError(err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, rsp.Body); err != nil {
+		os.Remove(f.Name())
+		return "", util.ChildNewtError(err)
+	}
+
+	return f.Name(), nil
+}
+
+func parseIndexPkg(itf interface{}) *IndexPkg {
+	m := cast.ToStringMap(itf)
+	if len(m) == 0 {
+		// A bare package name.
+		return &IndexPkg{Name: cast.ToString(itf)}
+	}
+
+	ip := &IndexPkg{
+		Name:        cast.ToString(m["name"]),
+		Description: cast.ToString(m["description"]),
+	}
+
+	// Keywords may be a list or a space-separated string.
+	if kws, err := cast.ToStringSliceE(m["keywords"]); err == nil &&
+		len(kws) > 0 {
+
+		ip.Keywords = kws
+	} else {
+		ip.Keywords = strings.Fields(cast.ToString(m["keywords"]))
+	}
+
+	return ip
+}
+
+func parseIndexRepo(indexName string, idx int, itf interface{}) (
+	*IndexRepo, error) {
+
+	m := cast.ToStringMap(itf)
+
+	ir := &IndexRepo{
+		Name:        cast.ToString(m["name"]),
+		Description: cast.ToString(m["description"]),
+		Index:       indexName,
+		Fields:      map[string]string{},
+	}
+	if ir.Name == "" {
+		return nil, util.FmtNewtError(
+			"repo %d missing required \"name\" field", idx)
+	}
+	if !repoNameRe.MatchString(ir.Name) {
+		return nil, util.FmtNewtError("invalid repo name \"%s\"", ir.Name)
+	}
+
+	for k, v := range m {
+		switch k {
+		case "name", "description", "packages":
+		default:
+			if !downloader.IsRepoField(k) {
+				log.Debugf("Ignoring unknown field \"%s\" in index repo "+
+					"\"%s\"", k, ir.Name)
+				continue
+			}
+			ir.Fields[k] = cast.ToString(v)
+		}
+	}
+	if ir.Fields["type"] == "" {
+		return nil, util.FmtNewtError(
+			"repo \"%s\" missing required \"type\" field", ir.Name)
+	}
+
+	for _, pitf := range cast.ToSlice(m["packages"]) {
+		ip := parseIndexPkg(pitf)
+		if ip.Name != "" {
+			ir.Packages = append(ir.Packages, ip)
+		}
+	}
+
+	return ir, nil
+}
+
+// Reads the index at the specified location (a file path or an https URL).
+func ReadIndex(name string, location string) (*Index, error) {
+	path := location
+	if strings.HasPrefix(location, "http://") {
+		return nil, util.FmtNewtError(
+			"Refusing to read package index over plain http: %s; use https",
+			location)
+	}
+	if strings.HasPrefix(location, "https://") {
+
+		var err error
+		path, err = downloadIndex(location)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(path)
+	}
+
+	yc, err := newtutil.ReadConfigPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	index := &Index{
+		Name:     name,
+		Location: location,
+	}
+	for i, itf := range cast.ToSlice(yc.GetFirstVal("repos", nil)) {
+		ir, err := parseIndexRepo(name, i, itf)
+		if err != nil {
+			return nil, util.FmtNewtError(
+				"Error in package index %s: %s", location, err.Error())
+		}
+		index.Repos = append(index.Repos, ir)
+	}
+
+	return index, nil
+}
+
+// Reads all configured indexes.  An index that cannot be read produces a
+// warning; it is only an error if no index could be read.
+func ReadIndexes(locs map[string]string) ([]*Index, error) {
+	if len(locs) == 0 {
+		return nil, util.NewNewtError(
+			"No package indexes configured; add \"search.indexes\" in " +
+				"~/.newt/repos.yml or use --index")
+	}
+
+	names := make([]string, 0, len(locs))
+	for name, _ := range locs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	indexes := []*Index{}
+	var lastErr error
+	for _, name := range names {
+		index, err := ReadIndex(name, locs[name])
+		if err != nil {
+			util.StatusMessage(util.VERBOSITY_QUIET,
+				"WARNING: Skipping package index \"%s\": %s\n",
+				name, err.Error())
+			lastErr = err
+			continue
+		}
+		indexes = append(indexes, index)
+	}
+
+	if len(indexes) == 0 {
+		return nil, lastErr
+	}
+
+	return indexes, nil
+}
+
+// Indicates whether each term appears in at least one of the specified
+// strings (case insensitive).
+func matchAll(terms []string, fields ...string) bool {
+	text := strings.ToLower(strings.Join(fields, "\n"))
+	for _, term := range terms {
+		if !strings.Contains(text, strings.ToLower(term)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Searches the specified indexes.  A repo matches if its name or description
+// contains every search term; a package matches if its name, description, or
+// keywords contain every term.  Matches are returned in index order.
+func Search(indexes []*Index, terms []string) []*Match {
+	matches := []*Match{}
+
+	for _, index := range indexes {
+		for _, ir := range index.Repos {
+			m := &Match{
+				Repo:        ir,
+				RepoMatched: matchAll(terms, ir.Name, ir.Description),
+			}
+
+			for _, ip := range ir.Packages {
+				fields := append([]string{ip.Name, ip.Description},
+					ip.Keywords...)
+				if matchAll(terms, fields...) {
+					m.Pkgs = append(m.Pkgs, ip)
+				}
+			}
+
+			if m.RepoMatched || len(m.Pkgs) > 0 {
+				matches = append(matches, m)
+			}
+		}
+	}
+
+	return matches
+}
+
+// Finds the named repo in the specified indexes.  If more than one index
+// provides the repo, the first one wins.
+func FindRepo(indexes []*Index, name string) *IndexRepo {
+	for _, index := range indexes {
+		for _, ir := range index.Repos {
+			if ir.Name == name {
+				return ir
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,230 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package registry
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Summarizes a parsed repo as "name|description|field=val,...|pkg[kw,...];...".
+func indexRepoText(ir *IndexRepo) string {
+	fields := []string{}
+	for k, v := range ir.Fields {
+		fields = append(fields, k+"="+v)
+	}
+	sort.Strings(fields)
+
+	pkgs := []string{}
+	for _, ip := range ir.Packages {
+		pkgs = append(pkgs, fmt.Sprintf("%s[%s]", ip.Name,
+			strings.Join(ip.Keywords, ",")))
+	}
+
+	return strings.Join([]string{
+		ir.Name,
+		ir.Description,
+		strings.Join(fields, ","),
+		strings.Join(pkgs, ";"),
+	}, "|")
+}
+
+func TestReadIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		yml     string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "full",
+			yml: `
+repos:
+    - name: apache-mynewt-core
+      description: Apache Mynewt OS
+      type: github
+      user: apache
+      repo: mynewt-core
+      vers: 1-latest
+      packages:
+          - name: hw/drivers/sensors/bme280
+            description: BME280 driver
+            keywords: [sensor, i2c]
+          - name: kernel/os
+            keywords: os scheduler
+          - sys/log
+`,
+			want: []string{
+				"apache-mynewt-core|Apache Mynewt OS|" +
+					"repo=mynewt-core,type=github,user=apache,vers=1-latest|" +
+					"hw/drivers/sensors/bme280[sensor,i2c];" +
+					"kernel/os[os,scheduler];sys/log[]",
+			},
+		},
+		{
+			name: "unknown fields ignored",
+			yml: `
+repos:
+    - name: r1
+      type: git
+      url: https://example.com/r1.git
+      homepage: https://example.com
+`,
+			want: []string{"r1||type=git,url=https://example.com/r1.git|"},
+		},
+		{
+			name: "numeric fields keep their text",
+			yml: `
+repos:
+    - name: r1
+      type: git
+      vers: 1.0
+`,
+			want: []string{"r1||type=git,vers=1.0|"},
+		},
+		{
+			name: "empty",
+			yml:  "repos: []\n",
+			want: nil,
+		},
+		{
+			name: "missing name",
+			yml: `
+repos:
+    - type: git
+`,
+			wantErr: "missing required \"name\"",
+		},
+		{
+			name: "invalid name",
+			yml: `
+repos:
+    - name: "bad name/x"
+      type: git
+`,
+			wantErr: "invalid repo name",
+		},
+		{
+			name: "missing type",
+			yml: `
+repos:
+    - name: r1
+`,
+			wantErr: "missing required \"type\"",
+		},
+	}
+
+	for i, tc := range tests {
+		path := filepath.Join(dir, fmt.Sprintf("index%d.yml", i))
+		if err := ioutil.WriteFile(path, []byte(tc.yml), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		index, err := ReadIndex("test", path)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%s: err=%v, want %q", tc.name, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.name, err.Error())
+			continue
+		}
+
+		got := []string{}
+		for _, ir := range index.Repos {
+			got = append(got, indexRepoText(ir))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(append([]string{}, tc.want...)) {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestReadIndexRejectsHttp(t *testing.T) {
+	_, err := ReadIndex("test", "http://example.com/index.yml")
+	if err == nil || !strings.Contains(err.Error(), "plain http") {
+		t.Errorf("err=%v, want refusal of plain http", err)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	indexes := []*Index{{
+		Name: "test",
+		Repos: []*IndexRepo{
+			{
+				Name:        "apache-mynewt-core",
+				Description: "Apache Mynewt OS",
+				Packages: []*IndexPkg{
+					{Name: "hw/drivers/sensors/bme280",
+						Keywords: []string{"sensor", "I2C"}},
+					{Name: "kernel/os", Description: "Scheduler"},
+				},
+			},
+			{
+				Name:     "mynewt-nimble",
+				Packages: []*IndexPkg{{Name: "nimble/host"}},
+			},
+		},
+	}}
+
+	tests := []struct {
+		terms []string
+		want  string
+	}{
+		{[]string{"i2c"}, "apache-mynewt-core:hw/drivers/sensors/bme280"},
+		{[]string{"SENSOR", "bme"},
+			"apache-mynewt-core:hw/drivers/sensors/bme280"},
+		{[]string{"mynewt"}, "apache-mynewt-core+ mynewt-nimble+"},
+		{[]string{"nimble", "host"}, "mynewt-nimble:nimble/host"},
+		{[]string{"scheduler"}, "apache-mynewt-core:kernel/os"},
+		{[]string{"zigbee"}, ""},
+	}
+
+	for _, tc := range tests {
+		got := []string{}
+		for _, m := range Search(indexes, tc.terms) {
+			s := m.Repo.Name
+			if m.RepoMatched {
+				s += "+"
+			}
+			for _, ip := range m.Pkgs {
+				s += ":" + ip.Name
+			}
+			got = append(got, s)
+		}
+
+		if strings.Join(got, " ") != tc.want {
+			t.Errorf("Search(%v)=%q, want %q", tc.terms, got, tc.want)
+		}
+	}
+}
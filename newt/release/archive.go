@@ -0,0 +1,485 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Release archives.  A release archive bundles a target's release artifacts:
+// the image, hex file, ELF file (with debug information), manifest, the
+// secondary outputs listed in the manifest, an SPDX software bill of
+// materials, and a release notes template.  The archive is reproducible:
+// entries are sorted, and every timestamp is taken from SOURCE_DATE_EPOCH (or
+// fixed at 1980-01-01 if that is unset), so rebuilding identical artifacts
+// yields an identical archive.
+
+package release
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/newt/image"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/target"
+	"mynewt.apache.org/newt/util"
+)
+
+const ARCHIVE_FORMAT_ZIP = "zip"
+const ARCHIVE_FORMAT_TGZ = "tar.gz"
+
+var ArchiveFormats = []string{ARCHIVE_FORMAT_ZIP, ARCHIVE_FORMAT_TGZ}
+
+const ARCHIVE_SUMS_NAME = "SHA256SUMS"
+const ARCHIVE_SBOM_NAME = "sbom.spdx.json"
+const ARCHIVE_NOTES_NAME = "RELEASE_NOTES.md"
+
+// Suffix of the checksum file written next to the archive.
+const ARCHIVE_CHECKSUM_SUFFIX = ".sha256"
+
+type archiveEntry struct {
+	name string
+	data []byte
+}
+
+type archiveEntrySorter []archiveEntry
+
+func (s archiveEntrySorter) Len() int {
+	return len(s)
+}
+func (s archiveEntrySorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s archiveEntrySorter) Less(i, j int) bool {
+	return s[i].name < s[j].name
+}
+
+// Returns the timestamp applied to every archive entry.
+func archiveTime() time.Time {
+	if t, ok := newtutil.SourceDateEpoch(); ok {
+		return t
+	}
+
+	// The earliest time a zip file can represent.
+	return time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Returns the name of a target's release archive, without extension.
+func ArchiveBaseName(t *target.Target, version string) string {
+	return strings.Replace(t.ShortName(), "/", "_", -1) + "-" + version
+}
+
+func ArchiveExt(format string) string {
+	return "." + format
+}
+
+func readEntry(entries []archiveEntry, name string, path string,
+	required bool) ([]archiveEntry, error) {
+
+	if util.NodeNotExist(path) {
+		if required {
+			return nil, util.FmtNewtError("missing release artifact: %s",
+				path)
+		}
+		return entries, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	return append(entries, archiveEntry{name, data}), nil
+}
+
+// Collects the build artifacts of a target whose image has been created.
+func artifactEntries(b *builder.TargetBuilder) ([]archiveEntry, error) {
+	entries := []archiveEntry{}
+	var err error
+
+	ab := b.AppBuilder
+	base := filepath.Base(ab.AppBinBasePath())
+	entries, err = readEntry(entries, base+".img", ab.AppImgPath(), true)
+	if err != nil {
+		return nil, err
+	}
+	entries, err = readEntry(entries, "manifest.json", ab.ManifestPath(), true)
+	if err != nil {
+		return nil, err
+	}
+	entries, err = readEntry(entries, base+".elf", ab.AppElfPath(), false)
+	if err != nil {
+		return nil, err
+	}
+	entries, err = readEntry(entries, base+".hex", ab.AppHexPath(), false)
+	if err != nil {
+		return nil, err
+	}
+
+	if lb := b.LoaderBuilder; lb != nil {
+		lbase := "loader/" + filepath.Base(lb.AppBinBasePath())
+		entries, err = readEntry(entries, lbase+".img", lb.AppImgPath(), false)
+		if err != nil {
+			return nil, err
+		}
+		entries, err = readEntry(entries, lbase+".elf", lb.AppElfPath(), false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// SPDX 2.2 document; only the fields newt can fill in are included.
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string `json:"name"`
+	SPDXID           string `json:"SPDXID"`
+	VersionInfo      string `json:"versionInfo,omitempty"`
+	DownloadLocation string `json:"downloadLocation"`
+	FilesAnalyzed    bool   `json:"filesAnalyzed"`
+	LicenseConcluded string `json:"licenseConcluded"`
+	LicenseDeclared  string `json:"licenseDeclared"`
+	CopyrightText    string `json:"copyrightText"`
+	Comment          string `json:"comment,omitempty"`
+}
+
+type spdxRelationship struct {
+	Element string `json:"spdxElementId"`
+	Type    string `json:"relationshipType"`
+	Related string `json:"relatedSpdxElement"`
+}
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+const SPDX_NOASSERTION = "NOASSERTION"
+
+var spdxIdRe = regexp.MustCompile(`[^A-Za-z0-9.\-]`)
+
+func spdxId(name string) string {
+	return "SPDXRef-" + spdxIdRe.ReplaceAllString(name, "-")
+}
+
+// Generates a bill of materials listing the repos that went into the image.
+func sbomText(man *image.ImageManifest, created time.Time) ([]byte, error) {
+	fwId := spdxId("Firmware-" + man.Name)
+
+	doc := spdxDocument{
+		SPDXVersion: "SPDX-2.2",
+		DataLicense: "CC0-1.0",
+		SPDXID:      "SPDXRef-DOCUMENT",
+		Name:        man.Name + "-" + man.Version,
+		DocumentNamespace: fmt.Sprintf(
+			"https://mynewt.apache.org/spdxdocs/%s-%s-%s",
+			strings.Replace(man.Name, "/", "_", -1), man.Version,
+			man.ImageHash),
+		CreationInfo: spdxCreationInfo{
+			Created:  created.Format(time.RFC3339),
+			Creators: []string{"Tool: newt-" + newtutil.NewtVersion.String()},
+		},
+		Packages: []spdxPackage{{
+			Name:             man.Name,
+			SPDXID:           fwId,
+			VersionInfo:      man.Version,
+			DownloadLocation: SPDX_NOASSERTION,
+			LicenseConcluded: SPDX_NOASSERTION,
+			LicenseDeclared:  SPDX_NOASSERTION,
+			CopyrightText:    SPDX_NOASSERTION,
+			Comment:          "Image hash: " + man.ImageHash,
+		}},
+		Relationships: []spdxRelationship{{
+			Element: "SPDXRef-DOCUMENT",
+			Type:    "DESCRIBES",
+			Related: fwId,
+		}},
+	}
+
+	// Count the packages each repo contributes.
+	pkgCounts := map[string]int{}
+	for _, p := range man.Pkgs {
+		pkgCounts[p.Repo]++
+	}
+
+	repos := append([]image.ImageManifestRepo{}, man.Repos...)
+	sort.Sort(manifestRepoSorter(repos))
+
+	for _, r := range repos {
+		loc := SPDX_NOASSERTION
+		if r.URL != "" {
+			loc = "git+" + r.URL
+			if r.Commit != "" {
+				loc += "@" + r.Commit
+			}
+		}
+
+		comment := fmt.Sprintf("%d packages", pkgCounts[r.Name])
+		if r.Dirty {
+			comment += "; built with local changes"
+		}
+
+		id := spdxId("Repo-" + r.Name)
+		doc.Packages = append(doc.Packages, spdxPackage{
+			Name:             r.Name,
+			SPDXID:           id,
+			VersionInfo:      r.Commit,
+			DownloadLocation: loc,
+			LicenseConcluded: SPDX_NOASSERTION,
+			LicenseDeclared:  SPDX_NOASSERTION,
+			CopyrightText:    SPDX_NOASSERTION,
+			Comment:          comment,
+		})
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			Element: fwId,
+			Type:    "CONTAINS",
+			Related: id,
+		})
+	}
+
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	return append(b, '\n'), nil
+}
+
+type manifestRepoSorter []image.ImageManifestRepo
+
+func (s manifestRepoSorter) Len() int {
+	return len(s)
+}
+func (s manifestRepoSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s manifestRepoSorter) Less(i, j int) bool {
+	return s[i].Name < s[j].Name
+}
+
+// Generates a release notes template for the maintainer to fill in.
+func notesText(man *image.ImageManifest) string {
+	buf := bytes.Buffer{}
+
+	fmt.Fprintf(&buf, "# %s %s\n\n", man.Name, man.Version)
+	fmt.Fprintf(&buf, "Image hash: %s\n", man.ImageHash)
+	if man.BuildID != "" {
+		fmt.Fprintf(&buf, "Build ID: %s\n", man.BuildID)
+	}
+	fmt.Fprintf(&buf, "\n## Changes\n\n- TODO\n")
+	fmt.Fprintf(&buf, "\n## Known issues\n\n- TODO\n")
+	fmt.Fprintf(&buf, "\n## Components\n\n")
+	fmt.Fprintf(&buf, "| Repo | Commit |\n|------|--------|\n")
+
+	repos := append([]image.ImageManifestRepo{}, man.Repos...)
+	sort.Sort(manifestRepoSorter(repos))
+	for _, r := range repos {
+		commit := r.Commit
+		if r.Dirty {
+			commit += " (dirty)"
+		}
+		fmt.Fprintf(&buf, "| %s | %s |\n", r.Name, commit)
+	}
+
+	return buf.String()
+}
+
+// Generates a checksum listing in the format read by `sha256sum -c`.
+func sumsText(entries []archiveEntry) string {
+	buf := bytes.Buffer{}
+	for _, e := range entries {
+		fmt.Fprintf(&buf, "%x  %s\n", sha256.Sum256(e.data), e.name)
+	}
+	return buf.String()
+}
+
+func writeZip(path string, prefix string, entries []archiveEntry,
+	mtime time.Time) error {
+
+	buf := bytes.Buffer{}
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{
+			Name:     prefix + "/" + e.name,
+			Method:   zip.Deflate,
+			Modified: mtime,
+		}
+		hdr.SetMode(0644)
+
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return util.ChildNewtError(err)
+		}
+		if _, err := w.Write(e.data); err != nil {
+			return util.ChildNewtError(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+	return nil
+}
+
+func writeTgz(path string, prefix string, entries []archiveEntry,
+	mtime time.Time) error {
+
+	buf := bytes.Buffer{}
+
+	// A zero gzip header (no name, no timestamp) keeps the output stable.
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name:     prefix + "/" + e.name,
+			Typeflag: tar.TypeReg,
+			Mode:     0644,
+			Size:     int64(len(e.data)),
+			ModTime:  mtime,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return util.ChildNewtError(err)
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			return util.ChildNewtError(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return util.ChildNewtError(err)
+	}
+	if err := gw.Close(); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+	return nil
+}
+
+// Creates a release archive for a target whose image has already been
+// created.  A checksum file is written next to the archive.
+//
+// @param b                     The target's builder.
+// @param format                One of ArchiveFormats.
+// @param outPath               The archive to create; "" for the default
+//                                  location in the target's bin directory.
+//
+// @return string               The path of the created archive.
+func CreateArchive(b *builder.TargetBuilder, format string,
+	outPath string) (string, error) {
+
+	if format != ARCHIVE_FORMAT_ZIP && format != ARCHIVE_FORMAT_TGZ {
+		return "", util.FmtNewtError(
+			"invalid archive format \"%s\"; must be one of: %s",
+			format, strings.Join(ArchiveFormats, ", "))
+	}
+
+	t := b.GetTarget()
+	ab := b.AppBuilder
+	if util.NodeNotExist(ab.ManifestPath()) ||
+		util.NodeNotExist(ab.AppImgPath()) {
+
+		return "", util.FmtNewtError(
+			"target %s has no image; run \"newt create-image\" first",
+			t.FullName())
+	}
+
+	man, err := builder.ReadManifest(ab.ManifestPath())
+	if err != nil {
+		return "", err
+	}
+
+	entries, err := artifactEntries(b)
+	if err != nil {
+		return "", err
+	}
+
+	binDir := builder.TargetBinDir(t.Name())
+	for _, a := range man.Artifacts {
+		entries, err = readEntry(entries, a.Path, binDir+"/"+a.Path, true)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	mtime := archiveTime()
+
+	sbom, err := sbomText(man, mtime)
+	if err != nil {
+		return "", err
+	}
+	entries = append(entries,
+		archiveEntry{ARCHIVE_SBOM_NAME, sbom},
+		archiveEntry{ARCHIVE_NOTES_NAME, []byte(notesText(man))})
+
+	sort.Sort(archiveEntrySorter(entries))
+	entries = append(entries,
+		archiveEntry{ARCHIVE_SUMS_NAME, []byte(sumsText(entries))})
+
+	prefix := ArchiveBaseName(t, man.Version)
+	if outPath == "" {
+		outPath = binDir + "/" + prefix + ArchiveExt(format)
+	}
+
+	if format == ARCHIVE_FORMAT_ZIP {
+		err = writeZip(outPath, prefix, entries, mtime)
+	} else {
+		err = writeTgz(outPath, prefix, entries, mtime)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	data, err := ioutil.ReadFile(outPath)
+	if err != nil {
+		return "", util.ChildNewtError(err)
+	}
+	sum := fmt.Sprintf("%x  %s\n", sha256.Sum256(data), filepath.Base(outPath))
+	if err := ioutil.WriteFile(outPath+ARCHIVE_CHECKSUM_SUFFIX, []byte(sum),
+		0644); err != nil {
+
+		return "", util.ChildNewtError(err)
+	}
+
+	return outPath, nil
+}
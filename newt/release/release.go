@@ -0,0 +1,315 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// The release package verifies that a target meets a set of production
+// criteria before release artifacts are produced.  The criteria are read from
+// a policy file (by default, release.yml at the project root):
+//
+//     release.forbidden_profiles:   # Build profiles that may not be released.
+//         - debug
+//     release.require_signing: 1     # A signing key must be specified.
+//     release.require_version: 1     # The version may not be 0.0.0.
+//     release.require_clean: 1       # Repos may not contain local changes.
+//     release.min_log_level: 1       # Minimum value of the LOG_LEVEL setting.
+//     release.syscfg:                # Required syscfg values.
+//         OS_CRASH_STACKTRACE: 0
+//
+// Each check can be disabled by setting it to 0 (or to an empty list).  If
+// the policy file does not exist, the defaults shown above apply, except that
+// there is no log level or syscfg requirement.
+
+package release
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/newt/image"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/newt/target"
+	"mynewt.apache.org/newt/util"
+)
+
+const POLICY_FILENAME = "release.yml"
+
+type Policy struct {
+	ForbiddenProfiles []string
+	RequireSigning    bool
+	RequireVersion    bool
+	RequireClean      bool
+
+	// -1 if unspecified.
+	MinLogLevel int
+
+	Syscfg map[string]string
+}
+
+type CheckResult struct {
+	Name   string
+	Passed bool
+
+	// Explains why the check failed; "" if it passed.
+	Detail string
+}
+
+type Params struct {
+	Target     *target.Target
+	Builder    *builder.TargetBuilder
+	Version    string
+	SigningKey string
+}
+
+func DefaultPolicyPath() string {
+	return project.GetProject().Path() + "/" + POLICY_FILENAME
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		ForbiddenProfiles: []string{"debug"},
+		RequireSigning:    true,
+		RequireVersion:    true,
+		RequireClean:      true,
+		MinLogLevel:       -1,
+	}
+}
+
+// Reads the policy file at the specified path.  If the path is
+// DefaultPolicyPath() and the file does not exist, the default policy is
+// returned.
+func ReadPolicy(path string) (Policy, error) {
+	pol := DefaultPolicy()
+
+	if path == DefaultPolicyPath() && util.NodeNotExist(path) {
+		return pol, nil
+	}
+
+	yc, err := newtutil.ReadConfigPath(path)
+	if err != nil {
+		return pol, err
+	}
+
+	if _, ok := yc.GetFirst("release.forbidden_profiles", nil); ok {
+		pol.ForbiddenProfiles = yc.GetValStringSliceNonempty(
+			"release.forbidden_profiles", nil)
+	}
+	pol.RequireSigning = yc.GetValBoolDflt("release.require_signing", nil,
+		pol.RequireSigning)
+	pol.RequireVersion = yc.GetValBoolDflt("release.require_version", nil,
+		pol.RequireVersion)
+	pol.RequireClean = yc.GetValBoolDflt("release.require_clean", nil,
+		pol.RequireClean)
+
+	if s := yc.GetValString("release.min_log_level", nil); s != "" {
+		lvl, err := strconv.Atoi(s)
+		if err != nil {
+			return pol, util.FmtNewtError(
+				"%s: invalid release.min_log_level: %s", path, s)
+		}
+		pol.MinLogLevel = lvl
+	}
+
+	pol.Syscfg = yc.GetValStringMapString("release.syscfg", nil)
+
+	return pol, nil
+}
+
+func pass(name string) CheckResult {
+	return CheckResult{Name: name, Passed: true}
+}
+
+func fail(name string, format string, args ...interface{}) CheckResult {
+	return CheckResult{
+		Name:   name,
+		Passed: false,
+		Detail: fmt.Sprintf(format, args...),
+	}
+}
+
+func checkProfile(pol Policy, p Params) *CheckResult {
+	if len(pol.ForbiddenProfiles) == 0 {
+		return nil
+	}
+
+	name := "Build profile is suitable for production"
+	for _, prof := range pol.ForbiddenProfiles {
+		if p.Target.BuildProfile == prof {
+			r := fail(name, "target uses build profile \"%s\"", prof)
+			return &r
+		}
+	}
+
+	r := pass(name)
+	return &r
+}
+
+func checkSigning(pol Policy, p Params) *CheckResult {
+	if !pol.RequireSigning {
+		return nil
+	}
+
+	name := "Signing key specified"
+	r := pass(name)
+	if p.SigningKey == "" {
+		r = fail(name, "no signing key specified")
+	}
+
+	return &r
+}
+
+func checkVersion(pol Policy, p Params) *CheckResult {
+	if !pol.RequireVersion {
+		return nil
+	}
+
+	name := "Version is set"
+
+	ver, err := image.ParseVersion(p.Version)
+	if err != nil {
+		r := fail(name, "%s", err.Error())
+		return &r
+	}
+
+	if ver == (image.ImageVersion{}) {
+		r := fail(name, "version is %s", ver.String())
+		return &r
+	}
+
+	r := pass(name)
+	return &r
+}
+
+func checkClean(pol Policy, p Params) (*CheckResult, error) {
+	if !pol.RequireClean {
+		return nil, nil
+	}
+
+	name := "Repos contain no local changes"
+
+	proj := project.GetProject()
+
+	dirty := []string{}
+	for rname, r := range proj.Repos() {
+		if r.IsLocal() || util.NodeNotExist(r.Path()) {
+			continue
+		}
+
+		changes, err := r.HasChanges()
+		if err != nil {
+			return nil, err
+		}
+		if changes {
+			dirty = append(dirty, rname)
+		}
+	}
+
+	if len(dirty) > 0 {
+		sort.Strings(dirty)
+		r := fail(name, "modified repos: %v", dirty)
+		return &r, nil
+	}
+
+	r := pass(name)
+	return &r, nil
+}
+
+func checkSyscfg(pol Policy, settings map[string]string) []CheckResult {
+	results := []CheckResult{}
+
+	if pol.MinLogLevel >= 0 {
+		name := fmt.Sprintf("LOG_LEVEL is at least %d", pol.MinLogLevel)
+
+		val, ok := settings["LOG_LEVEL"]
+		lvl, err := strconv.Atoi(val)
+		if !ok {
+			results = append(results, fail(name, "LOG_LEVEL is not defined"))
+		} else if err != nil || lvl < pol.MinLogLevel {
+			results = append(results, fail(name, "LOG_LEVEL is %s", val))
+		} else {
+			results = append(results, pass(name))
+		}
+	}
+
+	names := make([]string, 0, len(pol.Syscfg))
+	for k, _ := range pol.Syscfg {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, k := range names {
+		want := pol.Syscfg[k]
+		name := fmt.Sprintf("%s=%s", k, want)
+
+		got, ok := settings[k]
+		if !ok {
+			results = append(results, fail(name, "%s is not defined", k))
+		} else if got != want {
+			results = append(results, fail(name, "%s is %s", k, got))
+		} else {
+			results = append(results, pass(name))
+		}
+	}
+
+	return results
+}
+
+// Evaluates the specified policy against a prospective release.
+func Check(pol Policy, p Params) ([]CheckResult, error) {
+	results := []CheckResult{}
+
+	add := func(r *CheckResult) {
+		if r != nil {
+			results = append(results, *r)
+		}
+	}
+
+	add(checkProfile(pol, p))
+	add(checkSigning(pol, p))
+	add(checkVersion(pol, p))
+
+	r, err := checkClean(pol, p)
+	if err != nil {
+		return nil, err
+	}
+	add(r)
+
+	if pol.MinLogLevel >= 0 || len(pol.Syscfg) > 0 {
+		res, err := p.Builder.Resolve()
+		if err != nil {
+			return nil, err
+		}
+		results = append(results,
+			checkSyscfg(pol, res.Cfg.SettingValues())...)
+	}
+
+	return results, nil
+}
+
+// Indicates whether every check passed.
+func AllPassed(results []CheckResult) bool {
+	for _, r := range results {
+		if !r.Passed {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,125 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Repo description caching.  Fetching a repo to read its latest
+// `repository.yml` file is the main source of network access for routine
+// commands.  After each successful fetch, the time and the repo's location
+// are recorded in `repos/.configs/<repo>/cache.yml`, along with a digest of
+// the project's repo definitions.  Until that record is older than
+// DescCacheTTL, the previously downloaded description is used as is and the
+// repo is not fetched again.  A change to any repo definition, whether made
+// in `project.yml`, `project.local.yml`, an included fragment, or by
+// selecting a different profile, may require versions that the cached
+// description doesn't list, so it invalidates the record.
+//
+// The cache is disabled unless the "cache.metadata.ttl" newtrc setting
+// specifies a TTL.
+
+package repo
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"mynewt.apache.org/newt/newt/downloader"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+	"mynewt.apache.org/newt/yaml"
+)
+
+const DESC_CACHE_FILE_NAME = "cache.yml"
+
+// How long a downloaded repo description remains valid.  Zero disables the
+// cache.
+var DescCacheTTL time.Duration
+
+// A digest of the project's repo definitions, set when the project is
+// loaded.
+var DescCacheConfigKey string
+
+func (r *Repo) descCachePath() string {
+	return r.repoFilePath() + "/" + DESC_CACHE_FILE_NAME
+}
+
+// Returns the string that identifies the location the repo's description was
+// downloaded from, or "" if the description can't be cached.
+func (r *Repo) descCacheKey() string {
+	return downloader.CheckoutKey(r.downloader)
+}
+
+// Indicates whether the repo's previously downloaded description is recent
+// enough to be used without fetching the repo.
+func (r *Repo) descCacheValid(key string) bool {
+	if DescCacheTTL <= 0 || key == "" {
+		return false
+	}
+
+	if util.NodeNotExist(r.repoFilePath()+"/"+REPO_FILE_NAME) ||
+		util.NodeNotExist(r.checkoutPath()) {
+
+		return false
+	}
+
+	if util.NodeNotExist(r.descCachePath()) {
+		return false
+	}
+	yc, err := newtutil.ReadConfigPath(r.descCachePath())
+	if err != nil {
+		return false
+	}
+
+	if yc.GetValString("cache.key", nil) != key ||
+		yc.GetValString("cache.config", nil) != DescCacheConfigKey {
+
+		return false
+	}
+
+	t, err := time.Parse(time.RFC3339Nano,
+		yc.GetValString("cache.time", nil))
+	if err != nil {
+		return false
+	}
+
+	age := time.Since(t)
+	return age >= 0 && age < DescCacheTTL
+}
+
+// Records that the repo's description was just downloaded from the location
+// identified by the specified key.
+func (r *Repo) writeDescCache(key string) {
+	if key == "" {
+		return
+	}
+
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "cache.key: %s\n", yaml.EscapeString(key))
+	fmt.Fprintf(&buf, "cache.config: %s\n",
+		yaml.EscapeString(DescCacheConfigKey))
+	fmt.Fprintf(&buf, "cache.time: %s\n", time.Now().Format(time.RFC3339Nano))
+
+	if err := ioutil.WriteFile(r.descCachePath(), buf.Bytes(),
+		0644); err != nil {
+
+		log.Debugf("failed to write %s: %s", r.descCachePath(), err.Error())
+	}
+}
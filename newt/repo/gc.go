@@ -0,0 +1,179 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/downloader"
+	"mynewt.apache.org/newt/util"
+)
+
+// An entry in the repo store (the directory containing the project's repos).
+type StoreItem struct {
+	Path string
+
+	// The name of the unused repo the entry belongs to, if any.
+	RepoName string
+
+	// Describes what the entry is (e.g., "unused repo").
+	Desc string
+
+	// Whether the entry is a working copy containing local modifications.
+	Modified bool
+}
+
+// Indicates whether the working copy at the specified path contains local
+// modifications.
+func workingCopyModified(path string) bool {
+	st := downloader.DetectVCSState(path, "origin", "")
+	changes, err := st.AreChanges(path)
+	return err == nil && changes
+}
+
+// Lists the entries of the repo store that none of the specified repos use:
+// checkouts of repos that are no longer part of the project, the cached
+// descriptions and download metrics of such repos, and the remains of
+// interrupted downloads and damaged repos.
+//
+// @param repos                 The repos in use.
+// @param otherNames            The names of repos that the project doesn't
+//                                  use at the moment but may use later
+//                                  (e.g., those of other profiles).  Their
+//                                  checkouts are kept.
+// @param pinned                The paths of the secondary checkouts in use
+//                                  (see VersionCheckoutPath).
+func UnusedStoreItems(repos []*Repo, otherNames []string,
+	pinned []string) ([]StoreItem, error) {
+
+	dir := ReposDir()
+
+	pinnedPaths := map[string]bool{}
+	for _, path := range pinned {
+		pinnedPaths[path] = true
+	}
+
+	usedNames := map[string]bool{}
+	for _, name := range otherNames {
+		usedNames[name] = true
+	}
+
+	usedCheckouts := map[string]bool{}
+	for _, r := range repos {
+		usedNames[r.Name()] = true
+		usedCheckouts[filepath.Base(r.checkoutPath())] = true
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, util.ChildNewtError(err)
+	}
+
+	items := []StoreItem{}
+	for _, fi := range infos {
+		name := fi.Name()
+		path := dir + "/" + name
+
+		switch {
+		case pinnedPaths[path]:
+			// A checkout of a version that a target pins.
+
+		case strings.HasPrefix(name, REPO_PARTIAL_PREFIX):
+			// Another newt process may still be downloading.
+			if partialDownloadAbandoned(path) {
+				items = append(items, StoreItem{
+					Path: path,
+					Desc: "incomplete download",
+				})
+			}
+
+		case strings.HasPrefix(name, REPO_CORRUPT_PREFIX):
+			items = append(items, StoreItem{
+				Path:     path,
+				Desc:     "damaged repo",
+				Modified: workingCopyModified(path),
+			})
+
+		case strings.HasPrefix(name, REPO_MONOREPO_PREFIX):
+			if !usedCheckouts[name] {
+				items = append(items, StoreItem{
+					Path:     path,
+					Desc:     "unused shared checkout",
+					Modified: workingCopyModified(path),
+				})
+			}
+
+		case strings.HasPrefix(name, "."), !fi.IsDir():
+			// Newt's own bookkeeping.
+
+		case strings.Contains(name, REPO_VERSION_SEP):
+			items = append(items, StoreItem{
+				Path:     path,
+				Desc:     "unused pinned version",
+				Modified: workingCopyModified(path),
+			})
+
+		default:
+			if !usedCheckouts[name] && !usedNames[name] {
+				items = append(items, StoreItem{
+					Path:     path,
+					RepoName: name,
+					Desc:     "unused repo",
+					Modified: workingCopyModified(path),
+				})
+			}
+		}
+	}
+
+	// Per-repo bookkeeping: ".configs/<repo>" and ".metrics/<repo>.yml".
+	bookkeeping := []struct {
+		subdir string
+		suffix string
+		desc   string
+	}{
+		{".configs", "", "description of unused repo"},
+		{".metrics", ".yml", "download metrics of unused repo"},
+	}
+	for _, bk := range bookkeeping {
+		infos, err := ioutil.ReadDir(dir + "/" + bk.subdir)
+		if err != nil {
+			continue
+		}
+
+		for _, fi := range infos {
+			name := strings.TrimSuffix(fi.Name(), bk.suffix)
+			if !usedNames[name] {
+				items = append(items, StoreItem{
+					Path:     dir + "/" + bk.subdir + "/" + fi.Name(),
+					RepoName: name,
+					Desc:     bk.desc,
+				})
+			}
+		}
+	}
+
+	return items, nil
+}
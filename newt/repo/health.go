@@ -0,0 +1,95 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package repo
+
+import (
+	"time"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+)
+
+// Describes how current an installed repo is relative to its upstream.
+type Health struct {
+	// The installed commit and its date.
+	Commit     string
+	CommitTime time.Time
+
+	// The date of the most recent commit on the repo's main branch.
+	UpstreamTime time.Time
+
+	// The newest version listed in the repo's `repository.yml` file, and the
+	// number of commits between the installed commit and that version.  A
+	// negative count indicates the count could not be determined.
+	NewestVer *newtutil.RepoVersion
+	Behind    int
+}
+
+// Inspects the repo's history to determine how stale it is.  The caller should
+// have already fetched the repo (e.g., with UpdateDesc()).
+func (r *Repo) Health() (Health, error) {
+	h := Health{Behind: -1}
+	dl := r.downloader
+	st := r.VCSState()
+
+	commit, err := r.CurrentHash()
+	if err != nil {
+		return h, err
+	}
+	h.Commit = commit
+
+	h.CommitTime, err = st.CommitTime(r.Path(), commit)
+	if err != nil {
+		return h, err
+	}
+
+	upstream := st.UpstreamCommit(dl.MainBranch())
+	h.UpstreamTime, err = st.CommitTime(r.Path(), upstream)
+	if err != nil {
+		return h, err
+	}
+
+	vers, err := r.NormalizedVersions()
+	if err != nil {
+		return h, err
+	}
+	if len(vers) == 0 {
+		return h, nil
+	}
+
+	newest := newtutil.SortedVersionsDesc(vers)[0]
+	h.NewestVer = &newest
+
+	newestCommit, err := r.CommitFromVer(newest)
+	if err != nil || newestCommit == "" {
+		return h, nil
+	}
+	newestHash, err := st.HashFor(r.Path(), newestCommit)
+	if err != nil {
+		return h, nil
+	}
+
+	if behind, err := st.CommitsBetween(
+		r.Path(), commit, newestHash); err == nil {
+
+		h.Behind = behind
+	}
+
+	return h, nil
+}
@@ -0,0 +1,210 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Repo metadata signatures.  A repo's `repository.yml` tells newt where to
+// clone the repo's dependencies from, so a compromised mirror could redirect
+// clones to malicious URLs by altering it.  To guard against this, a repo can
+// carry a detached signature of each metadata file (`repository.yml.sig` and
+// `version.yml.sig`, next to the files they sign).  If the user's newtrc lists
+// trusted keys for a repo (see settings.RepoTrustedKeys), newt refuses to use
+// the repo's metadata unless it is signed by one of those keys.
+//
+// A signature covers a one-line header naming the file, the repo, and the
+// version the file describes, followed by the file's contents:
+//
+//     newt-repo-metadata <file> <repo> <version>
+//
+// where <version> is the version declared by `version.yml`, or the repo's
+// main branch for `repository.yml`.  This keeps a signature from vouching for
+// the same file served as part of another repo or release.  A signature file
+// contains a raw or base64-encoded signature of the header and contents:
+// PKCS #1 v1.5 with SHA-256 for RSA keys, or ASN.1 DER with SHA-256 for ECDSA
+// keys.  E.g., for an ECDSA key:
+//
+//     (echo "newt-repo-metadata repository.yml apache-mynewt-core master";
+//      cat repository.yml) | openssl dgst -sha256 -sign key.pem | base64 \
+//         > repository.yml.sig
+
+package repo
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mynewt.apache.org/newt/newt/settings"
+	"mynewt.apache.org/newt/util"
+)
+
+const REPO_SIG_SUFFIX = ".sig"
+const REPO_SIG_HEADER = "newt-repo-metadata"
+
+// Reads a PEM-encoded public key.
+func readTrustedKey(path string) (crypto.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, util.FmtNewtError(
+			"failed to read trusted key: %s", err.Error())
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, util.FmtNewtError(
+			"trusted key %s is not a PEM file", path)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, util.FmtNewtError(
+			"trusted key %s is not a public key: %s", path, err.Error())
+	}
+
+	return key, nil
+}
+
+// Indicates whether sig is a valid signature of data made with the private
+// half of the specified key.
+func signatureValid(key crypto.PublicKey, data []byte, sig []byte) bool {
+	hash := sha256.Sum256(data)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, hash[:], sig) == nil
+
+	case *ecdsa.PublicKey:
+		var esig struct {
+			R, S *big.Int
+		}
+		rest, err := asn1.Unmarshal(sig, &esig)
+		if err != nil || len(rest) != 0 || esig.R == nil || esig.S == nil {
+			return false
+		}
+		return ecdsa.Verify(k, hash[:], esig.R, esig.S)
+
+	default:
+		return false
+	}
+}
+
+// Builds the data that a metadata file's signature covers: a header naming
+// the file, repo, and version, followed by the file's contents.
+func signedPayload(fileName string, repoName string, vers string,
+	contents []byte) []byte {
+
+	hdr := fmt.Sprintf("%s %s %s %s\n", REPO_SIG_HEADER, fileName, repoName,
+		vers)
+	return append([]byte(hdr), contents...)
+}
+
+// Returns the version that the specified metadata file describes: the
+// version declared in `version.yml`, or the main branch for
+// `repository.yml`.
+func (r *Repo) metadataVersion(path string) string {
+	if filepath.Base(path) != REPO_VER_FILE_NAME {
+		return r.downloader.MainBranch()
+	}
+
+	ver, err := parseVersionYml(path)
+	if err != nil {
+		return ""
+	}
+	return ver.String()
+}
+
+// Decodes the contents of a signature file, which may or may not be
+// base64-encoded.
+func decodeSignature(contents []byte) []byte {
+	sig, err := base64.StdEncoding.DecodeString(
+		strings.TrimSpace(string(contents)))
+	if err != nil {
+		return contents
+	}
+
+	return sig
+}
+
+// Verifies the signature of one of the repo's metadata files against the keys
+// the user trusts for the repo.  Does nothing if the user doesn't list any
+// trusted keys for the repo.
+func (r *Repo) verifyMetadata(path string) error {
+	keyPaths := settings.RepoTrustedKeys(r.Name())
+	if len(keyPaths) == 0 {
+		return nil
+	}
+
+	name := filepath.Base(path)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	contents, err := ioutil.ReadFile(path + REPO_SIG_SUFFIX)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return util.FmtNewtError(
+				"%s of repo \"%s\" is not signed (no %s); newtrc requires "+
+					"it to be signed by a trusted key",
+				name, r.Name(), name+REPO_SIG_SUFFIX)
+		}
+		return util.ChildNewtError(err)
+	}
+	sig := decodeSignature(contents)
+	payload := signedPayload(name, r.Name(), r.metadataVersion(path), data)
+
+	for _, kp := range keyPaths {
+		key, err := readTrustedKey(kp)
+		if err != nil {
+			return err
+		}
+
+		if signatureValid(key, payload, sig) {
+			return nil
+		}
+	}
+
+	return util.FmtNewtError(
+		"%s of repo \"%s\" is not signed by a trusted key; refusing to use it",
+		name, r.Name())
+}
+
+// Downloads the signature of one of the repo's metadata files, if the user
+// lists trusted keys for the repo.  A missing signature is not an error here;
+// it is reported when the file is verified.
+func (r *Repo) downloadSignature(commit string, srcPath string) {
+	if len(settings.RepoTrustedKeys(r.Name())) == 0 {
+		return
+	}
+
+	// Don't let a stale signature vouch for a new file.
+	os.Remove(r.repoFilePath() + "/" + srcPath + REPO_SIG_SUFFIX)
+
+	r.downloadFile(commit, srcPath+REPO_SIG_SUFFIX)
+}
@@ -0,0 +1,215 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package repo
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func signRsa(t *testing.T, key *rsa.PrivateKey, data []byte) []byte {
+	hash := sha256.Sum256(data)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+// Produces an ASN.1 (DER) ECDSA signature, as made by `openssl dgst -sign`.
+func signEcdsa(t *testing.T, key *ecdsa.PrivateKey, data []byte) []byte {
+	hash := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig, err := asn1.Marshal(struct {
+		R, S *big.Int
+	}{r, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+func TestSignatureValid(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaOther, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents := []byte("repo.versions:\n    \"1.0.0\": \"v1.0.0\"\n")
+	payload := signedPayload("repository.yml", "core", "master", contents)
+
+	rsaSig := signRsa(t, rsaKey, payload)
+	ecSig := signEcdsa(t, ecKey, payload)
+
+	tests := []struct {
+		name string
+		key  crypto.PublicKey
+		data []byte
+		sig  []byte
+		want bool
+	}{
+		{"rsa", &rsaKey.PublicKey, payload, rsaSig, true},
+		{"ecdsa", &ecKey.PublicKey, payload, ecSig, true},
+		{"rsa wrong key", &rsaOther.PublicKey, payload, rsaSig, false},
+		{"ecdsa sig with rsa key", &rsaKey.PublicKey, payload, ecSig, false},
+		{"rsa sig with ecdsa key", &ecKey.PublicKey, payload, rsaSig, false},
+		{"unsigned contents", &rsaKey.PublicKey, contents, rsaSig, false},
+		{"other repo", &ecKey.PublicKey,
+			signedPayload("repository.yml", "nimble", "master", contents),
+			ecSig, false},
+		{"other version", &ecKey.PublicKey,
+			signedPayload("version.yml", "core", "1.0.0", contents),
+			ecSig, false},
+		{"ecdsa trailing data", &ecKey.PublicKey, payload,
+			append(append([]byte{}, ecSig...), 0), false},
+		{"ecdsa truncated", &ecKey.PublicKey, payload,
+			ecSig[:len(ecSig)-1], false},
+		{"empty sig", &rsaKey.PublicKey, payload, nil, false},
+		{"unsupported key", "key", payload, rsaSig, false},
+	}
+
+	for _, tc := range tests {
+		if got := signatureValid(tc.key, tc.data, tc.sig); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSignedPayload(t *testing.T) {
+	tests := []struct {
+		file     string
+		repo     string
+		vers     string
+		contents string
+		want     string
+	}{
+		{"repository.yml", "core", "master", "a: b\n",
+			"newt-repo-metadata repository.yml core master\na: b\n"},
+		{"version.yml", "nimble", "1.2.0", "",
+			"newt-repo-metadata version.yml nimble 1.2.0\n"},
+	}
+
+	for _, tc := range tests {
+		got := string(signedPayload(tc.file, tc.repo, tc.vers,
+			[]byte(tc.contents)))
+		if got != tc.want {
+			t.Errorf("signedPayload(%s, %s, %s)=%q, want %q",
+				tc.file, tc.repo, tc.vers, got, tc.want)
+		}
+	}
+}
+
+func TestDecodeSignature(t *testing.T) {
+	raw := []byte{0x30, 0x45, 0x02, 0x21, 0xff}
+
+	tests := []struct {
+		name     string
+		contents []byte
+		want     []byte
+	}{
+		{"raw", raw, raw},
+		{"base64", []byte(base64.StdEncoding.EncodeToString(raw)), raw},
+		{"base64 with newline",
+			[]byte(base64.StdEncoding.EncodeToString(raw) + "\n"), raw},
+	}
+
+	for _, tc := range tests {
+		got := decodeSignature(tc.contents)
+		if string(got) != string(tc.want) {
+			t.Errorf("%s: got %x, want %x", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestReadTrustedKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metasig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		contents []byte
+		wantErr  bool
+	}{
+		{"public key", pem.EncodeToMemory(
+			&pem.Block{Type: "PUBLIC KEY", Bytes: der}), false},
+		{"not pem", []byte("not a key"), true},
+		{"not a public key", pem.EncodeToMemory(
+			&pem.Block{Type: "PUBLIC KEY", Bytes: []byte{1, 2, 3}}), true},
+	}
+
+	for _, tc := range tests {
+		path := filepath.Join(dir, "key.pem")
+		if err := ioutil.WriteFile(path, tc.contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		key, err := readTrustedKey(path)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.name, err.Error())
+			continue
+		}
+		if _, ok := key.(*ecdsa.PublicKey); !ok {
+			t.Errorf("%s: got %T, want *ecdsa.PublicKey", tc.name, key)
+		}
+	}
+}
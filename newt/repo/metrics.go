@@ -0,0 +1,141 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Download metrics.  Each repo's network statistics (durations, mirror
+// fallbacks, and the most recent failure) accumulate across runs in
+// `repos/.metrics/<repo>.yml`, so intermittent infrastructure problems show up
+// as a pattern rather than as isolated failures.
+
+package repo
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"mynewt.apache.org/newt/newt/downloader"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/ycfg"
+	"mynewt.apache.org/newt/util"
+)
+
+func metricsPath(repoName string) string {
+	return ReposDir() + "/.metrics/" + repoName + ".yml"
+}
+
+func readOpMetrics(yc ycfg.YCfg, key string) downloader.OpMetrics {
+	ms := func(name string) time.Duration {
+		return time.Duration(yc.GetValInt(key+"."+name, nil)) *
+			time.Millisecond
+	}
+
+	return downloader.OpMetrics{
+		Count:    yc.GetValInt(key+".count", nil),
+		Failures: yc.GetValInt(key+".failures", nil),
+		Retries:  yc.GetValInt(key+".retries", nil),
+		Total:    ms("total_ms"),
+		Last:     ms("last_ms"),
+	}
+}
+
+// Reads the download metrics recorded for the specified repo.  A repo without
+// any recorded metrics yields an empty set.
+func ReadMetrics(repoName string) (downloader.Metrics, error) {
+	m := downloader.Metrics{}
+
+	path := metricsPath(repoName)
+	if util.NodeNotExist(path) {
+		return m, nil
+	}
+
+	yc, err := newtutil.ReadConfigPath(path)
+	if err != nil {
+		return m, err
+	}
+
+	m.Download = readOpMetrics(yc, "download")
+	m.Fetch = readOpMetrics(yc, "fetch")
+	m.LastFailure = yc.GetValString("last_failure.message", nil)
+	m.LastFailureClass = yc.GetValString("last_failure.class", nil)
+	if s := yc.GetValString("last_failure.time", nil); s != "" {
+		m.LastFailureTime, _ = time.Parse(time.RFC3339, s)
+	}
+
+	return m, nil
+}
+
+func writeOpMetrics(buf *bytes.Buffer, key string, om downloader.OpMetrics) {
+	fmt.Fprintf(buf, "%s.count: %d\n", key, om.Count)
+	fmt.Fprintf(buf, "%s.failures: %d\n", key, om.Failures)
+	fmt.Fprintf(buf, "%s.retries: %d\n", key, om.Retries)
+	fmt.Fprintf(buf, "%s.total_ms: %d\n", key, om.Total/time.Millisecond)
+	fmt.Fprintf(buf, "%s.last_ms: %d\n", key, om.Last/time.Millisecond)
+}
+
+func writeMetrics(repoName string, m downloader.Metrics) error {
+	buf := bytes.Buffer{}
+	writeOpMetrics(&buf, "download", m.Download)
+	writeOpMetrics(&buf, "fetch", m.Fetch)
+	if !m.LastFailureTime.IsZero() {
+		fmt.Fprintf(&buf, "last_failure.class: %s\n", m.LastFailureClass)
+		fmt.Fprintf(&buf, "last_failure.message: %s\n",
+			strconv.Quote(m.LastFailure))
+		fmt.Fprintf(&buf, "last_failure.time: %s\n",
+			m.LastFailureTime.Format(time.RFC3339))
+	}
+
+	path := metricsPath(repoName)
+	if err := os.MkdirAll(ReposDir()+"/.metrics",
+		REPO_DEFAULT_PERMS); err != nil {
+
+		return util.ChildNewtError(err)
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// Adds the statistics the repo's downloader gathered to the repo's recorded
+// metrics.  Failure to save metrics is not an error.
+func (r *Repo) saveMetrics() {
+	dm := r.downloader.Metrics()
+	if dm.IsEmpty() {
+		return
+	}
+
+	m, err := ReadMetrics(r.Name())
+	if err == nil {
+		m.Add(*dm)
+		err = writeMetrics(r.Name(), m)
+	}
+	if err != nil {
+		log.Debugf("Failed to save download metrics for repo \"%s\": %s",
+			r.Name(), err.Error())
+		return
+	}
+
+	r.downloader.ResetMetrics()
+}
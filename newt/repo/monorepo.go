@@ -0,0 +1,222 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// A monorepo is a single git repo that contains several newt repos, each in
+// its own subtree with its own `repository.yml` file.  A project.yml entry
+// selects one of these repos with the "subtree" field:
+//
+//     repository.acme-core:
+//         type: git
+//         vers: 1-latest
+//         url: https://git.example.com/acme/mynewt.git
+//         subtree: core
+//
+// All repos that come from the same git repo share one checkout, located at
+// `repos/.monorepo-<name>`; each repo's path is its subtree within the
+// checkout.  Since there is only one working tree, every such repo must
+// resolve to the same commit.
+//
+// A git repo that contains a single newt repo somewhere below its top level
+// (e.g., a vendor source tree with its Mynewt packages in `firmware/`) uses
+// the "root" field instead:
+//
+//     repository.vendor-bsp:
+//         type: git
+//         vers: 1-latest
+//         url: https://git.example.com/vendor/sdk.git
+//         root: firmware
+//
+// Such a repo gets its own checkout at `repos/<name>`, and the repo's path is
+// the root directory within it.
+
+package repo
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"mynewt.apache.org/newt/newt/downloader"
+	"mynewt.apache.org/newt/util"
+)
+
+const REPO_MONOREPO_PREFIX = ".monorepo-"
+
+type checkoutClaim struct {
+	repoName string
+	commit   string
+}
+
+// Shared checkout path => the first repo updated in it and its commit.
+var checkoutClaims = map[string]checkoutClaim{}
+var checkoutClaimsMtx sync.Mutex
+
+// Normalizes the path of a newt repo within its git repo.
+//
+// @return string               The normalized path.
+// @return bool                 False if the path is empty or refers to a
+//                                  location outside the git repo.
+func cleanSubpath(p string) (string, bool) {
+	p = path.Clean(strings.Trim(filepath.ToSlash(p), "/"))
+	if p == "." || p == ".." || strings.HasPrefix(p, "../") {
+		return "", false
+	}
+
+	return p, true
+}
+
+// Makes the repo a subtree of a shared git checkout.
+//
+// @param subtree               The path of the repo within its git repo.
+func (r *Repo) UseSubtree(subtree string) error {
+	clean, ok := cleanSubpath(subtree)
+	if !ok {
+		return util.FmtNewtError(
+			"repo \"%s\" has invalid subtree: \"%s\"", r.Name(), subtree)
+	}
+	subtree = clean
+
+	key := downloader.CheckoutKey(r.downloader)
+	if key == "" {
+		return util.FmtNewtError(
+			"repo \"%s\": the \"subtree\" field requires a git, github, or "+
+				"azure repo", r.Name())
+	}
+
+	r.subtree = subtree
+	r.monoRoot = ReposDir() + "/" + REPO_MONOREPO_PREFIX + key
+	r.localPath = r.monoRoot + "/" + r.subtree
+
+	return nil
+}
+
+// Makes the repo a subdirectory of its own git checkout.  Unlike a subtree,
+// the checkout isn't shared with other repos.
+//
+// @param root                  The path of the repo within its git repo.
+func (r *Repo) UseRoot(root string) error {
+	clean, ok := cleanSubpath(root)
+	if !ok {
+		return util.FmtNewtError(
+			"repo \"%s\" has invalid root: \"%s\"", r.Name(), root)
+	}
+	root = clean
+
+	if downloader.CheckoutKey(r.downloader) == "" {
+		return util.FmtNewtError(
+			"repo \"%s\": the \"root\" field requires a git, github, or "+
+				"azure repo", r.Name())
+	}
+
+	r.subtree = root
+	r.monoRoot = ReposDir() + "/" + r.Name()
+	r.localPath = r.monoRoot + "/" + r.subtree
+
+	return nil
+}
+
+// Returns the path of the repo's git checkout.  For a repo in a shared
+// checkout, this is the top of the checkout rather than the repo's subtree.
+func (r *Repo) CheckoutPath() string {
+	return r.checkoutPath()
+}
+
+func (r *Repo) checkoutPath() string {
+	if r.monoRoot != "" && r.vendorPath == "" {
+		return r.monoRoot
+	}
+	return r.localPath
+}
+
+// Identifies the git checkout the repo is updated in.  Repos that return the
+// same string must not be updated concurrently.
+func (r *Repo) CheckoutGroup() string {
+	if key := downloader.CheckoutKey(r.downloader); key != "" {
+		return key
+	}
+	return r.checkoutPath()
+}
+
+func claimConflictError(claim checkoutClaim, repoName string,
+	commit string) error {
+
+	return util.FmtNewtError(
+		"repos \"%s\" and \"%s\" share a git checkout but resolve to "+
+			"different commits (%s, %s); their version requirements "+
+			"must select the same commit",
+		claim.repoName, repoName, claim.commit, commit)
+}
+
+// Fails if another repo in the same shared checkout was already updated to a
+// commit other than the specified one during this run.  This is checked
+// before the checkout is modified, so a conflict leaves the other repo's
+// files intact.  A commit that can't be resolved yet is left for the update
+// itself to report.
+func (r *Repo) checkClaim(commit string) error {
+	if r.monoRoot == "" {
+		return nil
+	}
+
+	checkoutClaimsMtx.Lock()
+	claim, ok := checkoutClaims[r.monoRoot]
+	checkoutClaimsMtx.Unlock()
+	if !ok {
+		return nil
+	}
+
+	path := r.checkoutPath()
+	hash, err := r.downloader.State(path).HashFor(path, commit)
+	if err != nil || hash == claim.commit {
+		return nil
+	}
+
+	return claimConflictError(claim, r.Name(), hash)
+}
+
+// Records the commit the repo was just updated to.  Fails if another repo in
+// the same shared checkout was updated to a different commit during this run.
+func (r *Repo) claimCheckout() error {
+	if r.monoRoot == "" {
+		return nil
+	}
+
+	commit, err := r.CurrentHash()
+	if err != nil {
+		return err
+	}
+
+	checkoutClaimsMtx.Lock()
+	defer checkoutClaimsMtx.Unlock()
+
+	claim, ok := checkoutClaims[r.monoRoot]
+	if !ok {
+		checkoutClaims[r.monoRoot] = checkoutClaim{
+			repoName: r.Name(),
+			commit:   commit,
+		}
+		return nil
+	}
+
+	if claim.commit != commit {
+		return claimConflictError(claim, r.Name(), commit)
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// A target can build against a different version of a repo than the rest of
+// the project by pinning the repo in its `target.yml`:
+//
+//     target.repos:
+//         apache-mynewt-core: 1.9.0
+//
+// Each pinned version gets its own checkout next to the repo's primary
+// checkout, named `<repo>@<version>` (e.g., `repos/apache-mynewt-core@1.9.0`).
+// These secondary checkouts are local clones of the primary one; they never
+// fetch from the repo's remote.
+
+package repo
+
+import (
+	"strings"
+
+	"mynewt.apache.org/newt/newt/downloader"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+)
+
+const REPO_VERSION_SEP = "@"
+
+// Returns the path of the repo's primary git checkout.
+func (r *Repo) primaryCheckoutPath() string {
+	if r.primaryPath != "" && r.monoRoot == "" {
+		return r.primaryPath
+	}
+	return r.checkoutPath()
+}
+
+// Returns the path of the secondary checkout holding the specified version of
+// the repo.
+func (r *Repo) VersionCheckoutPath(vers string) string {
+	return r.primaryCheckoutPath() + REPO_VERSION_SEP +
+		strings.Replace(vers, "/", "_", -1)
+}
+
+// Returns the path of the specified version of the repo, i.e., the repo's
+// directory within the corresponding secondary checkout.
+func (r *Repo) versionPath(vers string) string {
+	path := r.VersionCheckoutPath(vers)
+	if r.monoRoot != "" {
+		path += "/" + r.subtree
+	}
+
+	return path
+}
+
+// Creates or updates the secondary checkout holding the specified version of
+// the repo.  The repo must be using its primary checkout.
+func (r *Repo) InstallVersion(vers string) error {
+	if r.IsLocal() || r.IsVendored() ||
+		downloader.CheckoutKey(r.downloader) == "" {
+
+		return util.FmtNewtError(
+			"repo \"%s\" can't be pinned to a version per target; only "+
+				"git, github, and azure repos can", r.Name())
+	}
+	if r.primaryPath != "" {
+		return util.FmtNewtError(
+			"repo \"%s\" isn't using its primary checkout", r.Name())
+	}
+	if !r.checkExists() {
+		return util.FmtNewtError(
+			"repo \"%s\" is not installed; run `newt upgrade` first",
+			r.Name())
+	}
+
+	ver, err := newtutil.ParseRepoVersion(vers)
+	if err != nil {
+		return err
+	}
+
+	hash, err := r.HashFromVer(ver)
+	if err != nil {
+		return err
+	}
+
+	return downloader.CheckoutCopy(
+		r.primaryCheckoutPath(), r.VersionCheckoutPath(vers), hash)
+}
+
+// Points the repo at the secondary checkout holding the specified version.
+// An empty version string points the repo back at its primary checkout.
+//
+// @return bool                 True if the repo's path changed.
+func (r *Repo) UseVersion(vers string) bool {
+	path := r.primaryPath
+	if vers != "" {
+		path = r.versionPath(vers)
+	}
+
+	if path == "" || path == r.localPath {
+		return false
+	}
+
+	if r.primaryPath == "" {
+		r.primaryPath = r.localPath
+	} else if path == r.primaryPath {
+		r.primaryPath = ""
+	}
+	r.localPath = path
+
+	return true
+}
+
+// Indicates whether the repo refers to a secondary checkout rather than its
+// primary one.
+func (r *Repo) IsPinned() bool {
+	return r.primaryPath != ""
+}
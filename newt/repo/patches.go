@@ -0,0 +1,301 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Local patches.  A repo descriptor in `project.yml` can list patch files
+// (paths relative to the project root) that newt applies to the repo's
+// working tree whenever the repo is downloaded or updated:
+//
+//     repository.apache-mynewt-core:
+//         type: github
+//         vers: 1.7.0
+//         user: apache
+//         repo: mynewt-core
+//         patches: patches/core-uart-fix.patch patches/core-spi.patch
+//
+// Applied patches are recorded in `repos/.patches/<repo>/`: a copy of each
+// patch and a state file.  Before the repo is updated, the recorded patches
+// are un-applied so that the update starts from a pristine tree and nothing
+// gets applied twice.  The state file also holds the ID of the patched
+// working tree, which lets newt tell the patches apart from the user's own
+// local changes.
+
+package repo
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	log "github.com/Sirupsen/logrus"
+
+	"mynewt.apache.org/newt/newt/downloader"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+)
+
+const PATCH_STATE_FILE_NAME = "applied.yml"
+
+type patchState struct {
+	// ID of the working tree immediately after the patches were applied.
+	tree string
+
+	// Copies of the applied patches, in the order they were applied.
+	patches []string
+}
+
+// Specifies the patch files to apply to the repo.
+func (r *Repo) SetPatches(paths []string) {
+	r.patches = paths
+}
+
+func (r *Repo) Patches() []string {
+	return r.patches
+}
+
+func (r *Repo) patchStateDir() string {
+	return r.patchesFilePath() + r.Name()
+}
+
+// The directory the patches' paths are relative to, within the git repo.
+func (r *Repo) patchDirectory() string {
+	if r.monoRoot != "" {
+		return r.subtree
+	}
+	return ""
+}
+
+func (r *Repo) readPatchState() (*patchState, error) {
+	path := r.patchStateDir() + "/" + PATCH_STATE_FILE_NAME
+	if util.NodeNotExist(path) {
+		return nil, nil
+	}
+
+	yc, err := newtutil.ReadConfigPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &patchState{
+		tree: yc.GetValString("tree", nil),
+	}
+	for _, name := range yc.GetValStringSlice("patches", nil) {
+		st.patches = append(st.patches, r.patchStateDir()+"/"+name)
+	}
+
+	return st, nil
+}
+
+func (r *Repo) writePatchState(st *patchState) error {
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "tree: %s\n", st.tree)
+	fmt.Fprintf(&buf, "patches:\n")
+	for _, p := range st.patches {
+		fmt.Fprintf(&buf, "    - %s\n", filepath.Base(p))
+	}
+
+	path := r.patchStateDir() + "/" + PATCH_STATE_FILE_NAME
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+func (r *Repo) clearPatchState() error {
+	if err := os.RemoveAll(r.patchStateDir()); err != nil {
+		return util.ChildNewtError(err)
+	}
+	return nil
+}
+
+// Indicates whether the configured patches are the ones recorded as applied.
+func (r *Repo) patchesMatch(st *patchState) bool {
+	if len(st.patches) != len(r.patches) {
+		return false
+	}
+
+	for i, p := range r.patches {
+		want, err := ioutil.ReadFile(p)
+		if err != nil {
+			return false
+		}
+		have, err := ioutil.ReadFile(st.patches[i])
+		if err != nil || !bytes.Equal(want, have) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Indicates whether every recorded patch is still applied.
+func (r *Repo) patchesApplied(st *patchState) bool {
+	for _, p := range st.patches {
+		if !downloader.PatchApplies(r.checkoutPath(), p, r.patchDirectory(),
+			true) {
+
+			return false
+		}
+	}
+	return true
+}
+
+// Un-applies the patches recorded as applied, leaving the repo as it was
+// downloaded.
+func (r *Repo) revertPatches() error {
+	st, err := r.readPatchState()
+	if err != nil || st == nil {
+		return err
+	}
+
+	if util.NodeExist(r.checkoutPath()) {
+		for i := len(st.patches) - 1; i >= 0; i-- {
+			p := st.patches[i]
+			dir := r.patchDirectory()
+
+			if !downloader.PatchApplies(r.checkoutPath(), p, dir, true) {
+				if downloader.PatchApplies(r.checkoutPath(), p, dir, false) {
+					// Already removed (e.g., the user reset the repo).
+					log.Debugf("Patch %s no longer applied to repo %s",
+						p, r.Name())
+					continue
+				}
+				return util.FmtNewtError(
+					"Cannot un-apply patch %s from repo \"%s\"; local "+
+						"changes conflict with it.  Revert the patch "+
+						"manually and delete %s.",
+					filepath.Base(p), r.Name(), r.patchStateDir())
+			}
+
+			if err := downloader.ApplyPatch(r.checkoutPath(), p, dir,
+				true); err != nil {
+
+				return err
+			}
+		}
+	}
+
+	return r.clearPatchState()
+}
+
+// Applies the repo's patches, if they are not already applied.  Patches that
+// were applied earlier but have since been removed from `project.yml` are
+// un-applied.
+func (r *Repo) ApplyPatches() error {
+	if r.IsVendored() || r.IsLocal() || util.NodeNotExist(r.checkoutPath()) {
+		return nil
+	}
+
+	st, err := r.readPatchState()
+	if err != nil {
+		return err
+	}
+
+	if st != nil {
+		if r.patchesMatch(st) && r.patchesApplied(st) {
+			return nil
+		}
+		if err := r.revertPatches(); err != nil {
+			return err
+		}
+	}
+
+	if len(r.patches) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(r.patchStateDir(), REPO_DEFAULT_PERMS); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	st = &patchState{}
+	for i, p := range r.patches {
+		cpy := fmt.Sprintf("%s/%04d-%s", r.patchStateDir(), i+1,
+			filepath.Base(p))
+		if err := util.CopyFile(p, cpy); err != nil {
+			r.revertPatchState(st)
+			return err
+		}
+
+		err := downloader.ApplyPatch(r.checkoutPath(), cpy,
+			r.patchDirectory(), false)
+		if err != nil {
+			r.revertPatchState(st)
+			return util.FmtNewtError(
+				"Patch %s does not apply to repo \"%s\"; it may need to be "+
+					"updated for the installed version: %s",
+				p, r.Name(), err.Error())
+		}
+
+		st.patches = append(st.patches, cpy)
+
+		// Record progress so that a failure part way through can be undone.
+		if err := r.writePatchState(st); err != nil {
+			return err
+		}
+	}
+
+	st.tree, err = downloader.WorkTreeId(r.checkoutPath())
+	if err != nil {
+		return err
+	}
+	if err := r.writePatchState(st); err != nil {
+		return err
+	}
+
+	if !downloader.QuietProgress {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Applied %d patch(es) to \"%s\"\n", len(r.patches), r.Name())
+	}
+
+	return nil
+}
+
+// Undoes a partially applied set of patches after a failure.
+func (r *Repo) revertPatchState(st *patchState) {
+	if err := r.writePatchState(st); err == nil {
+		if err := r.revertPatches(); err != nil {
+			util.StatusMessage(util.VERBOSITY_QUIET, "WARNING: %s\n",
+				err.Error())
+		}
+	}
+}
+
+// Indicates whether the repo's working tree contains changes other than the
+// applied patches.
+func (r *Repo) hasLocalChanges() (bool, error) {
+	st, err := r.readPatchState()
+	if err != nil {
+		return false, err
+	}
+
+	if st != nil && st.tree != "" && util.NodeExist(r.checkoutPath()) {
+		tree, err := downloader.WorkTreeId(r.checkoutPath())
+		if err != nil {
+			return false, err
+		}
+		if tree == st.tree {
+			return false, nil
+		}
+	}
+
+	return r.VCSState().AreChanges(r.Path())
+}
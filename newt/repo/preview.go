@@ -0,0 +1,85 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package repo
+
+import (
+	"mynewt.apache.org/newt/newt/downloader"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+)
+
+// Describes what an upgrade or sync would do to a repo.
+type UpdatePreview struct {
+	// The currently checked out commit; "" if the repo isn't installed.
+	CurCommit string
+
+	// The commit that the repo would be moved to.
+	DestCommit string
+
+	// Whether the repo's working tree contains local changes.
+	Changes bool
+}
+
+// Determines the effect of moving the repo to the specified version without
+// modifying the repo.  The caller should have already fetched the repo (e.g.,
+// with UpdateDesc()), so that branches resolve to their latest upstream
+// commits.
+func (r *Repo) PreviewUpdate(ver newtutil.RepoVersion) (UpdatePreview, error) {
+	p := UpdatePreview{}
+
+	commit, err := r.CommitFromVer(ver)
+	if err != nil {
+		return p, err
+	}
+
+	if util.NodeNotExist(r.Path()) {
+		// The repo would be cloned.
+		p.DestCommit = commit
+		return p, nil
+	}
+
+	p.CurCommit, err = r.CurrentHash()
+	if err != nil {
+		return p, err
+	}
+
+	// An update merges the remote's copy of a branch into the local branch,
+	// so a branch resolves to the remote's copy.
+	st := r.VCSState()
+	ct, err := st.CommitType(r.Path(), commit)
+	if err == nil && ct == downloader.COMMIT_TYPE_LOCAL_BRANCH {
+		p.DestCommit, err = st.HashFor(r.Path(), st.UpstreamCommit(commit))
+	}
+	if p.DestCommit == "" {
+		p.DestCommit, err = st.HashFor(r.Path(), commit)
+	}
+	if err != nil {
+		return p, util.FmtNewtError(
+			"Error resolving \"%s\" in repo \"%s\": %s",
+			commit, r.Name(), err.Error())
+	}
+
+	p.Changes, err = st.AreChanges(r.Path())
+	if err != nil {
+		return p, err
+	}
+
+	return p, nil
+}
@@ -0,0 +1,207 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Repo redirects.  When an upstream repo is renamed or migrated, its final
+// `repository.yml` at the old location can declare where it went:
+//
+//	repo.moved_to:
+//	    type: git
+//	    url: https://github.com/neworg/newname.git
+//
+// (`repo.replaced_by` is accepted as a synonym.)  Newt follows the redirect
+// with a warning, so downstream projects keep working until their
+// `project.yml` files are updated.  The redirect is also remembered locally,
+// so newt can still find the repo after the old location disappears.
+
+package repo
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"mynewt.apache.org/newt/newt/downloader"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/ycfg"
+	"mynewt.apache.org/newt/util"
+)
+
+// The `repository.yml` keys that redirect a repo to a new location.
+var repoMoveKeys = []string{"repo.moved_to", "repo.replaced_by"}
+
+// The maximum number of redirects followed when updating a repo's
+// description.  Guards against two locations pointing at each other.
+const REPO_MAX_REDIRECTS = 5
+
+// Records the last redirect followed; lives next to the cached copy of
+// `repository.yml`.
+const REPO_REDIRECT_FILE_NAME = "redirect.yml"
+
+// Returns a short human-readable description of a repo location.
+func repoLocationString(fields map[string]string) string {
+	if fields["url"] != "" {
+		return fields["url"]
+	}
+	if fields["user"] != "" && fields["repo"] != "" {
+		server := fields["server"]
+		if server == "" {
+			server = "github.com"
+		}
+		return fmt.Sprintf("%s/%s/%s", server, fields["user"], fields["repo"])
+	}
+	return fmt.Sprintf("%v", fields)
+}
+
+// Reads the redirect (if any) from a parsed `repository.yml` file.
+func readRepoMove(yc ycfg.YCfg) (map[string]string, string) {
+	for _, key := range repoMoveKeys {
+		fields := yc.GetValStringMapString(key, nil)
+		if len(fields) > 0 {
+			return fields, key
+		}
+	}
+	return nil, ""
+}
+
+// Switches the repo to the location named by its `repository.yml` redirect,
+// if there is one.  The commit being tracked carries over to the new
+// downloader.  Returns true if the repo now points somewhere new.
+func (r *Repo) followMove(yc ycfg.YCfg) (bool, error) {
+	fields, key := readRepoMove(yc)
+	if fields == nil {
+		return false, nil
+	}
+
+	loc := repoLocationString(fields)
+	if loc == r.movedTo || loc == downloaderLocation(r.downloader) {
+		// Already following this redirect, or project.yml has been updated to
+		// point at the new location.
+		return false, nil
+	}
+
+	// A vendored or local repo doesn't get downloaded; nothing to redirect.
+	if r.IsVendored() || r.IsLocal() {
+		log.Debugf("Ignoring %s in non-downloaded repo \"%s\"", key,
+			r.Name())
+		return false, nil
+	}
+
+	dl, err := downloader.LoadDownloader(r.Name(), fields)
+	if err != nil {
+		return false, util.FmtNewtError(
+			"repo \"%s\" has moved to %s, but its \"%s\" entry is invalid: %s",
+			r.Name(), loc, key, strings.TrimSpace(err.Error()))
+	}
+	dl.SetCommit(r.downloader.GetCommit())
+
+	// The record is keyed by the location project.yml names, i.e., the start
+	// of a chain of redirects.
+	if r.movedFrom == "" {
+		r.movedFrom = downloaderLocation(r.downloader)
+	}
+
+	util.StatusMessage(util.VERBOSITY_QUIET,
+		"WARNING: repo \"%s\" has moved to %s; following the redirect.  "+
+			"Update the repo's entry in project.yml to stop this warning.\n",
+		r.Name(), loc)
+
+	r.downloader = dl
+	r.movedTo = loc
+
+	if err := r.saveMove(r.movedFrom, fields); err != nil {
+		log.Debugf("Failed to record redirect for repo \"%s\": %s",
+			r.Name(), err.Error())
+	}
+
+	return true, nil
+}
+
+func (r *Repo) redirectFilePath() string {
+	return r.repoFilePath() + "/" + REPO_REDIRECT_FILE_NAME
+}
+
+// Describes the location a downloader fetches from, in the same form as
+// repoLocationString.  Returns "" for downloaders without a remote location.
+func downloaderLocation(dl downloader.Downloader) string {
+	switch d := dl.(type) {
+	case *downloader.GitDownloader:
+		return repoLocationString(map[string]string{"url": d.Url})
+	case *downloader.GithubDownloader:
+		return repoLocationString(map[string]string{
+			"server": d.Server,
+			"user":   d.User,
+			"repo":   d.Repo,
+		})
+	default:
+		return ""
+	}
+}
+
+// Records a followed redirect so that later runs go straight to the new
+// location, even if the old one has since disappeared.
+func (r *Repo) saveMove(from string, fields map[string]string) error {
+	keys := make([]string, 0, len(fields))
+	for k, _ := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "repo.moved_from: %s\n", strconv.Quote(from))
+	fmt.Fprintf(&buf, "%s:\n", repoMoveKeys[0])
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "    %s: %s\n", k, strconv.Quote(fields[k]))
+	}
+
+	err := ioutil.WriteFile(r.redirectFilePath(), buf.Bytes(), 0644)
+	if err != nil {
+		return util.ChildNewtError(err)
+	}
+	return nil
+}
+
+// Follows the redirect recorded by an earlier run, if it applies to the
+// repo's current location.  A stale record (e.g., project.yml now points
+// somewhere else) is removed.
+func (r *Repo) followSavedMove() (bool, error) {
+	path := r.redirectFilePath()
+	if !util.NodeExist(path) {
+		return false, nil
+	}
+
+	yc, err := newtutil.ReadConfigPath(path)
+	if err != nil {
+		return false, err
+	}
+
+	from := yc.GetValString("repo.moved_from", nil)
+	if from == "" || from != downloaderLocation(r.downloader) {
+		log.Debugf("Removing stale redirect record %s", path)
+		os.Remove(path)
+		return false, nil
+	}
+
+	return r.followMove(yc)
+}
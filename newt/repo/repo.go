@@ -26,6 +26,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/spf13/cast"
@@ -45,6 +46,20 @@ const REPO_FILE_NAME = "repository.yml"
 const REPO_VER_FILE_NAME = "version.yml"
 const REPOS_DIR = "repos"
 
+// Repos are downloaded to a directory with this prefix and renamed once the
+// download completes.  A directory with this prefix is left behind if newt is
+// interrupted mid-download.
+const REPO_PARTIAL_PREFIX = ".partial-"
+
+// A partial download is only considered abandoned once nothing in it has
+// changed for this long; until then, another newt process may still be
+// writing to it.
+const REPO_PARTIAL_MAX_AGE = time.Hour
+
+// Repos that fail an integrity check are moved to a directory with this
+// prefix.
+const REPO_CORRUPT_PREFIX = ".corrupt-"
+
 type Repo struct {
 	name       string
 	downloader downloader.Downloader
@@ -57,11 +72,40 @@ type Repo struct {
 	// True if this repo was cloned during this invocation of newt.
 	newlyCloned bool
 
+	// True if this repo's integrity has been checked during this invocation
+	// of newt.
+	checked bool
+
 	// commit => [dependencies]
 	deps map[string][]*RepoDependency
 
 	// version => commit
 	vers map[newtutil.RepoVersion]string
+
+	// Set if the project uses a vendored copy of this repo (see
+	// UseVendored).
+	vendorPath   string
+	vendorCommit string
+	vendorVer    *newtutil.RepoVersion
+
+	// Set if the repo lives in a subdirectory of its git checkout, either a
+	// subtree shared with other newt repos or its own root directory (see
+	// UseSubtree and UseRoot).
+	monoRoot string
+	subtree  string
+
+	// Set while the repo's path refers to a secondary checkout of another
+	// version (see UseVersion); holds the path of the primary checkout.
+	primaryPath string
+
+	// Set if the repo's `repository.yml` redirected it to a new location
+	// (see followMove).
+	movedFrom string
+	movedTo   string
+
+	// Patch files applied after each download or update (see
+	// ApplyPatches).
+	patches []string
 }
 
 type RepoDependency struct {
@@ -168,6 +212,17 @@ func (r *Repo) Path() string {
 	return r.localPath
 }
 
+// Returns the location the repo is downloaded from, without credentials.
+func (r *Repo) Url() string {
+	return downloader.PublicUrl(r.downloader)
+}
+
+// Retrieves the state of the repo's working copy from the version control
+// system that manages it.
+func (r *Repo) VCSState() downloader.VCSState {
+	return r.downloader.State(r.Path())
+}
+
 func (r *Repo) IsLocal() bool {
 	return r.local
 }
@@ -176,9 +231,33 @@ func (r *Repo) IsNewlyCloned() bool {
 	return r.newlyCloned
 }
 
+// Indicates whether the repo's working tree contains uncommitted changes.
+func (r *Repo) HasChanges() (bool, error) {
+	if r.IsVendored() {
+		return false, nil
+	}
+	return r.hasLocalChanges()
+}
+
+// The directory containing the project's repos, if it isn't the project's
+// own "repos" directory (e.g., the shared repo store of a workspace).
+var reposDirOverride string
+
+func SetReposDir(dir string) {
+	reposDirOverride = dir
+}
+
+// Returns the directory in which the project's repos are installed.
+func ReposDir() string {
+	if reposDirOverride != "" {
+		return reposDirOverride
+	}
+
+	return interfaces.GetProject().Path() + "/" + REPOS_DIR
+}
+
 func RepoFilePath(repoName string) string {
-	return interfaces.GetProject().Path() + "/" + REPOS_DIR + "/" +
-		".configs/" + repoName
+	return ReposDir() + "/.configs/" + repoName
 }
 
 func (r *Repo) repoFilePath() string {
@@ -186,34 +265,121 @@ func (r *Repo) repoFilePath() string {
 }
 
 func (r *Repo) patchesFilePath() string {
-	return interfaces.GetProject().Path() + "/" + REPOS_DIR +
-		"/.patches/"
+	return ReposDir() + "/.patches/"
+}
+
+func (r *Repo) partialPath() string {
+	return filepath.Dir(r.checkoutPath()) + "/" + REPO_PARTIAL_PREFIX +
+		filepath.Base(r.checkoutPath())
 }
 
+// Indicates whether the specified partial download has been abandoned, i.e.,
+// whether nothing in it has been modified within REPO_PARTIAL_MAX_AGE.
+func partialDownloadAbandoned(path string) bool {
+	cutoff := time.Now().Add(-REPO_PARTIAL_MAX_AGE)
+
+	// Stop walking at the first recently modified entry.
+	errRecent := fmt.Errorf("recently modified")
+	err := filepath.Walk(path,
+		func(p string, info os.FileInfo, err error) error {
+			if err == nil && info.ModTime().After(cutoff) {
+				return errRecent
+			}
+			return nil
+		})
+
+	return err != errRecent
+}
+
+// Removes the remains of downloads that were interrupted during a previous
+// invocation of newt.  Downloads that may still be in progress in another
+// newt process are left alone.
+func CleanPartialDownloads() {
+	reposDir := ReposDir()
+	paths, _ := filepath.Glob(reposDir + "/" + REPO_PARTIAL_PREFIX + "*")
+	for _, path := range paths {
+		if !partialDownloadAbandoned(path) {
+			log.Debugf("Not removing recent download %s", path)
+			continue
+		}
+
+		util.StatusMessage(util.VERBOSITY_VERBOSE,
+			"Removing incomplete download %s\n", path)
+		if err := os.RemoveAll(path); err != nil {
+			log.Debugf("Failed to remove %s: %s", path, err.Error())
+		}
+	}
+}
+
+// Downloads the repo to a temporary directory and moves it into place once
+// the download is complete.  An interrupted download never leaves a partial
+// repo at the repo's path.
 func (r *Repo) downloadRepo(commit string) error {
 	dl := r.downloader
 
-	tmpdir, err := newtutil.MakeTempRepoDir()
+	tmpPath := r.partialPath()
+	if err := os.RemoveAll(tmpPath); err != nil {
+		return util.ChildNewtError(err)
+	}
+	err := os.MkdirAll(filepath.Dir(tmpPath), REPO_DEFAULT_PERMS)
 	if err != nil {
-		return err
+		return util.ChildNewtError(err)
 	}
-	defer os.RemoveAll(tmpdir)
 
 	// Download the git repo, returns the git repo, checked out to that commit
-	if err := dl.DownloadRepo(commit, tmpdir); err != nil {
+	if err := dl.DownloadRepo(commit, tmpPath); err != nil {
+		os.RemoveAll(tmpPath)
 		return util.FmtNewtError("Error downloading repository %s: %s",
 			r.Name(), err.Error())
 	}
 
-	// Copy the Git repo into the the desired local path of the repo
-	if err := util.CopyDir(tmpdir, r.Path()); err != nil {
-		// Cleanup any directory that might have been created if we error out
-		// here.
-		os.RemoveAll(r.Path())
+	if err := os.Rename(tmpPath, r.checkoutPath()); err != nil {
+		os.RemoveAll(tmpPath)
+		return util.ChildNewtError(err)
+	}
+
+	if err := downloader.RepairWorktree(r.checkoutPath()); err != nil {
 		return err
 	}
 
 	r.newlyCloned = true
+	r.checked = true
+	return nil
+}
+
+// Verifies that an existing repo is intact.  A corrupt repo is moved out of
+// the way so that it gets downloaded again; it is kept rather than deleted in
+// case it contains work the user wants to recover.  A corrupt repo with local
+// changes is left alone, as is a repo that couldn't be checked.
+func (r *Repo) checkIntegrity() error {
+	if r.checked {
+		return nil
+	}
+	r.checked = true
+
+	corrupt, err := downloader.CheckIntegrity(r.checkoutPath())
+	if !corrupt {
+		return err
+	}
+
+	changes, cerr := r.VCSState().AreChanges(r.checkoutPath())
+	if cerr != nil || changes {
+		return util.FmtNewtError(
+			"repository \"%s\" is damaged (%s) and may contain local "+
+				"changes; move %s aside to download it again",
+			r.Name(), err.Error(), r.checkoutPath())
+	}
+
+	dst := fmt.Sprintf("%s/%s%s-%d", filepath.Dir(r.checkoutPath()),
+		REPO_CORRUPT_PREFIX, filepath.Base(r.checkoutPath()),
+		time.Now().Unix())
+	if err := os.Rename(r.checkoutPath(), dst); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	util.StatusMessage(util.VERBOSITY_QUIET,
+		"* Warning: repository \"%s\" is damaged (%s); moved it to %s "+
+			"and downloading it again\n", r.Name(), err.Error(), dst)
 	return nil
 }
 
@@ -222,18 +388,42 @@ func (r *Repo) checkExists() bool {
 }
 
 func (r *Repo) updateRepo(commit string) error {
+	if r.IsVendored() {
+		return util.FmtNewtError(
+			"Repo \"%s\" is vendored; run `newt vendor` without "+
+				"project.use_vendor to refresh it", r.Name())
+	}
+
+	defer r.saveMetrics()
+
 	// Clone the repo if it doesn't exist.
 	if err := r.ensureExists(); err != nil {
 		return err
 	}
 
+	if err := r.checkClaim(commit); err != nil {
+		return err
+	}
+
+	// Start from the tree as it was downloaded.
+	if err := r.revertPatches(); err != nil {
+		return err
+	}
+
 	// Fetch and checkout the specified commit.
 	if err := r.downloader.UpdateRepo(r.Path(), commit); err != nil {
 		return util.FmtNewtError(
 			"Error updating \"%s\": %s", r.Name(), err.Error())
 	}
 
-	return nil
+	// The digests describe the requested version, not the branch the repo
+	// was cloned from.
+	if err := r.downloader.Verify(r.checkoutPath()); err != nil {
+		return util.FmtNewtError(
+			"Error updating \"%s\": %s", r.Name(), err.Error())
+	}
+
+	return r.claimCheckout()
 }
 
 func (r *Repo) Install(ver newtutil.RepoVersion) error {
@@ -246,87 +436,188 @@ func (r *Repo) Install(ver newtutil.RepoVersion) error {
 		return err
 	}
 
-	return nil
+	return r.ApplyPatches()
 }
 
-func (r *Repo) Upgrade(ver newtutil.RepoVersion) error {
+// Upgrades the repo to the specified version.  If stash is true, local
+// changes are stashed before the upgrade and re-applied afterwards; otherwise,
+// a repo with local changes is not upgraded.
+func (r *Repo) Upgrade(ver newtutil.RepoVersion, stash bool) error {
 	commit, err := r.CommitFromVer(ver)
 	if err != nil {
 		return err
 	}
 
-	changes, err := r.downloader.AreChanges(r.Path())
+	changes, err := r.hasLocalChanges()
 	if err != nil {
 		return err
 	}
 
-	if changes {
+	if changes && !stash {
 		return util.FmtNewtError(
 			"Repository \"%s\" contains local changes.  Provide the "+
-				"-f option to attempt a merge.", r.Name())
+				"--stash option to set them aside during the upgrade.",
+			r.Name())
 	}
 
-	if err := r.updateRepo(commit); err != nil {
+	// Un-apply the patches first so that they don't end up in the stash.
+	if err := r.revertPatches(); err != nil {
 		return err
 	}
 
-	return nil
+	stashed := false
+	if changes {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Stashing local changes in \"%s\"\n", r.Name())
+		stashed, err = r.downloader.StashChanges(r.Path())
+		if err != nil {
+			return util.FmtNewtError("Error upgrading \"%s\": %s",
+				r.Name(), err.Error())
+		}
+	}
+
+	upErr := r.updateRepo(commit)
+
+	// Re-apply the changes even if the upgrade failed so that they don't
+	// remain hidden in the stash.
+	if stashed {
+		util.StatusMessage(util.VERBOSITY_DEFAULT,
+			"Re-applying local changes in \"%s\"\n", r.Name())
+		if err := r.downloader.RestoreChanges(r.Path()); err != nil {
+			return util.FmtNewtError("Error upgrading \"%s\": %s",
+				r.Name(), err.Error())
+		}
+	}
+
+	if err := r.ApplyPatches(); err != nil {
+		return err
+	}
+
+	return upErr
+}
+
+// Describes the outcome of syncing a single repo.
+type SyncResult struct {
+	OldCommit string
+	NewCommit string
+	Warnings  []string
 }
 
-func (r *Repo) Sync(ver newtutil.RepoVersion) (bool, error) {
+// Syncs the repo to the specified version.  Nothing is printed for the repo;
+// the caller reports the returned result.  The result's old commit is filled
+// in even if the sync fails.
+func (r *Repo) Sync(ver newtutil.RepoVersion) (SyncResult, error) {
+	res := SyncResult{}
+
+	if r.checkExists() {
+		res.OldCommit, _ = r.CurrentHash()
+
+		changes, err := r.hasLocalChanges()
+		if err == nil && changes {
+			res.Warnings = append(res.Warnings, "local changes")
+		}
+	}
+
 	// Update the repo description
 	if _, err := r.UpdateDesc(); err != nil {
-		return false, util.NewNewtError("Cannot update repository description.")
+		return res, util.NewNewtError("Cannot update repository description.")
 	}
 
 	commit, err := r.CommitFromVer(ver)
 	if err != nil {
-		return false, err
+		return res, err
 	}
 	if commit == "" {
-		return false, util.FmtNewtError(
+		return res, util.FmtNewtError(
 			"No commit mapping for %s,%s", r.Name(), ver.String())
 	}
 
-	util.StatusMessage(util.VERBOSITY_DEFAULT,
-		"Syncing repository \"%s\"... ", r.Name())
-	err = r.updateRepo(commit)
-	if err == nil {
-		util.StatusMessage(util.VERBOSITY_DEFAULT, "success\n")
-		return true, err
-	} else {
-		util.StatusMessage(util.VERBOSITY_QUIET, "failed: %s\n",
-			err.Error())
-		return false, err
+	if err := r.updateRepo(commit); err != nil {
+		return res, err
 	}
+
+	if err := r.ApplyPatches(); err != nil {
+		return res, err
+	}
+	if len(r.patches) > 0 {
+		res.Warnings = append(res.Warnings,
+			fmt.Sprintf("%d patch(es) applied", len(r.patches)))
+	}
+
+	res.NewCommit, _ = r.CurrentHash()
+
+	return res, nil
 }
 
 func (r *Repo) UpdateDesc() (bool, error) {
 	var err error
 
-	if r.updated {
+	if r.updated || r.IsVendored() {
 		return false, nil
 	}
 
+	// A recently downloaded description is used without fetching the repo.
+	cacheKey := r.descCacheKey()
+	if r.descCacheValid(cacheKey) {
+		if err := r.Read(); err == nil {
+			util.StatusMessage(util.VERBOSITY_VERBOSE,
+				"[%s]: using cached repository description\n", r.Name())
+			r.downloader.MarkFetched()
+			r.updated = true
+			return false, nil
+		}
+	}
+
 	util.StatusMessage(util.VERBOSITY_VERBOSE, "[%s]:\n", r.Name())
 
-	if err = r.DownloadDesc(); err != nil {
-		return false, err
-	}
+	// Follow redirects: a repo that moved gets its description from the new
+	// location.
+	visited := map[string]bool{}
+	for i := 0; ; i++ {
+		if err = r.DownloadDesc(); err != nil {
+			if r.movedTo != "" {
+				return false, util.FmtNewtError(
+					"failed to download repository.yml for repo \"%s\" "+
+						"from its new location, %s: %s",
+					r.Name(), r.movedTo, err.Error())
+			}
+			return false, err
+		}
 
-	if err := r.Read(); err != nil {
-		return false, err
+		prevMove := r.movedTo
+		if err := r.Read(); err != nil {
+			return false, err
+		}
+		if r.movedTo == prevMove {
+			break
+		}
+
+		if visited[r.movedTo] || i >= REPO_MAX_REDIRECTS {
+			return false, util.FmtNewtError(
+				"too many redirects for repo \"%s\" (last: %s)",
+				r.Name(), r.movedTo)
+		}
+		visited[r.movedTo] = true
 	}
 
 	r.updated = true
+	r.writeDescCache(cacheKey)
 
 	return true, nil
 }
 
 func (r *Repo) ensureExists() error {
-	// Clone the repo if it doesn't exist.
-	if util.NodeNotExist(r.localPath) {
-		if err := r.downloadRepo("master"); err != nil {
+	// A damaged repo gets moved out of the way and downloaded again.
+	if util.NodeExist(r.checkoutPath()) {
+		if err := r.checkIntegrity(); err != nil {
+			return err
+		}
+	}
+
+	// Clone the repo if it doesn't exist.  A repo in a shared checkout may
+	// already have been cloned by another repo.
+	if util.NodeNotExist(r.checkoutPath()) {
+		if err := r.downloadRepo(r.downloader.MainBranch()); err != nil {
 			return err
 		}
 	}
@@ -334,7 +625,7 @@ func (r *Repo) ensureExists() error {
 	// Make sure the repo's "origin" remote points to the correct URL.  This is
 	// necessary in case the user changed his `project.yml` file to point to a
 	// different fork.
-	if err := r.downloader.FixupOrigin(r.localPath); err != nil {
+	if err := r.downloader.FixupOrigin(r.checkoutPath()); err != nil {
 		return err
 	}
 
@@ -372,9 +663,18 @@ func (r *Repo) downloadFile(commit string, srcPath string) (string, error) {
 }
 
 func (r *Repo) downloadRepositoryYml() error {
-	if _, err := r.downloadFile("master", REPO_FILE_NAME); err != nil {
+	commit := r.downloader.MainBranch()
+
+	// After a redirect, the local branch still tracks the old location; read
+	// the description from the new remote instead.
+	if r.movedTo != "" && util.NodeExist(r.checkoutPath()) {
+		commit = r.downloader.RemoteName() + "/" + commit
+	}
+
+	if _, err := r.downloadFile(commit, REPO_FILE_NAME); err != nil {
 		return err
 	}
+	r.downloadSignature(commit, REPO_FILE_NAME)
 
 	return nil
 }
@@ -384,6 +684,8 @@ func (r *Repo) DownloadDesc() error {
 	util.StatusMessage(util.VERBOSITY_VERBOSE, "Downloading "+
 		"repository description\n")
 
+	defer r.saveMetrics()
+
 	// Remember if the directory already exists.  If it doesn't, we'll create
 	// it.  If downloading fails, only remove the directory if we just created
 	// it.
@@ -475,12 +777,35 @@ func (r *Repo) readDepRepos(yc ycfg.YCfg) error {
 func (r *Repo) Read() error {
 	r.Init(r.Name(), r.downloader)
 
-	yc, err := newtutil.ReadConfig(r.repoFilePath(),
+	// A vendored repo's description is part of the vendored copy.
+	ymlDir := r.repoFilePath()
+	if r.IsVendored() {
+		ymlDir = r.Path()
+	}
+
+	if err := r.verifyMetadata(ymlDir + "/" + REPO_FILE_NAME); err != nil {
+		return err
+	}
+	if err := validateRepoYml(ymlDir + "/" + REPO_FILE_NAME); err != nil {
+		return err
+	}
+
+	yc, err := newtutil.ReadConfig(ymlDir,
 		strings.TrimSuffix(REPO_FILE_NAME, ".yml"))
 	if err != nil {
 		return err
 	}
 
+	moved, err := r.followMove(yc)
+	if err != nil {
+		return err
+	}
+	if !moved && r.movedTo == "" {
+		if _, err := r.followSavedMove(); err != nil {
+			return err
+		}
+	}
+
 	versMap := yc.GetValStringMapString("repo.versions", nil)
 	for versStr, commit := range versMap {
 		log.Debugf("Printing version %s for remote repo %s", versStr, r.name)
@@ -516,8 +841,12 @@ func (r *Repo) Init(repoName string, d downloader.Downloader) error {
 
 	if r.local {
 		r.localPath = filepath.ToSlash(filepath.Clean(path))
+	} else if r.vendorPath != "" {
+		r.localPath = r.vendorPath
+	} else if r.monoRoot != "" {
+		r.localPath = r.monoRoot + "/" + r.subtree
 	} else {
-		r.localPath = filepath.ToSlash(filepath.Clean(path + "/" + REPOS_DIR + "/" + r.name))
+		r.localPath = filepath.ToSlash(filepath.Clean(ReposDir() + "/" + r.name))
 	}
 
 	return nil
@@ -551,6 +880,22 @@ func (r *Repo) CheckNewtCompatibility(
 		nvers.String(), r.name, rnuver.String(), text)
 }
 
+// Determines which version of newt the specified version of this repo
+// requires, if `nvers` is too old.
+//
+// @return *newtutil.Version    The required newt version; nil if `nvers` is
+//                                  not too old.
+func (r *Repo) RequiredNewtVersion(
+	rvers newtutil.RepoVersion, nvers newtutil.Version) *newtutil.Version {
+
+	tbl, ok := r.ncMap[rvers.ToNuVersion()]
+	if !ok {
+		return nil
+	}
+
+	return tbl.RequiredNewtVer(nvers)
+}
+
 func NewRepo(repoName string, d downloader.Downloader) (*Repo, error) {
 	r := &Repo{
 		local: false,
@@ -0,0 +1,217 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package repo
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/downloader"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/yaml"
+)
+
+// The keys that may appear at the top level of a `repository.yml` file.
+var repoYmlKeys = []string{
+	"repo.deps",
+	"repo.moved_to",
+	"repo.name",
+	"repo.newt_compatibility",
+	"repo.replaced_by",
+	"repo.versions",
+}
+
+// Checks a repo descriptor: a `repository.<name>` entry in `project.yml` or a
+// dependency in `repository.yml`.  The "vers" field is not checked; its
+// format differs between the two files.
+func CheckRepoDesc(sc *newtutil.SchemaChecker, keys []string,
+	desc map[string]interface{}) {
+
+	sc.CheckKeys(keys, desc, downloader.RepoFields)
+
+	fieldKeys := func(field string) []string {
+		return append(append([]string{}, keys...), field)
+	}
+
+	if itf, ok := desc["type"]; ok {
+		typ := cast.ToString(itf)
+		valid := false
+		for _, t := range downloader.RepoTypes {
+			if typ == t {
+				valid = true
+			}
+		}
+		if !valid {
+			sc.Errorf(fieldKeys("type"),
+				"invalid repo type \"%s\"; must be one of: %s",
+				typ, strings.Join(downloader.RepoTypes, ", "))
+		}
+	}
+
+	for _, field := range []string{"branch", "default_branch"} {
+		if itf, ok := desc[field]; ok {
+			if err := newtutil.ValidateCommitSpec(
+				cast.ToString(itf)); err != nil {
+
+				sc.Errorf(fieldKeys(field), "%s: %s", field, err.Error())
+			}
+		}
+	}
+}
+
+// Checks a version requirement string (e.g., ">=1.2.0" or "abc123-commit").
+func CheckVersReqs(sc *newtutil.SchemaChecker, keys []string, reqsStr string) {
+	reqs, err := newtutil.ParseRepoVersionReqs(reqsStr)
+	if err != nil {
+		sc.Errorf(keys, "invalid version requirement \"%s\": %s",
+			reqsStr, err.Error())
+		return
+	}
+
+	for _, req := range reqs {
+		if req.Ver.Commit != "" {
+			if err := newtutil.ValidateCommitSpec(req.Ver.Commit); err != nil {
+				sc.Errorf(keys, "invalid version requirement \"%s\": %s",
+					reqsStr, err.Error())
+			}
+		}
+	}
+}
+
+func checkRepoVersions(sc *newtutil.SchemaChecker, itf interface{}) {
+	versMap, err := cast.ToStringMapE(itf)
+	if err != nil {
+		sc.Errorf([]string{"repo.versions"},
+			"\"repo.versions\" must be a map of version to commit")
+		return
+	}
+
+	for versStr, commitItf := range versMap {
+		keys := []string{"repo.versions", versStr}
+
+		if _, err := newtutil.ParseRepoVersion(versStr); err != nil {
+			sc.Errorf(keys, "invalid version \"%s\": %s",
+				versStr, err.Error())
+		}
+
+		// A version maps to either a commit or another version (e.g.,
+		// "1-latest": "1.4.0").
+		commit := cast.ToString(commitItf)
+		if _, err := newtutil.ParseRepoVersion(commit); err == nil {
+			continue
+		}
+		if err := newtutil.ValidateCommitSpec(commit); err != nil {
+			sc.Errorf(keys, "version \"%s\": %s", versStr, err.Error())
+		}
+	}
+}
+
+func checkRepoDeps(sc *newtutil.SchemaChecker, itf interface{}) {
+	depMap, err := cast.ToStringMapE(itf)
+	if err != nil {
+		sc.Errorf([]string{"repo.deps"},
+			"\"repo.deps\" must be a map of repo name to descriptor")
+		return
+	}
+
+	for depName, depItf := range depMap {
+		keys := []string{"repo.deps", depName}
+
+		desc, err := cast.ToStringMapE(depItf)
+		if err != nil {
+			sc.Errorf(keys, "dependency \"%s\" must be a map", depName)
+			continue
+		}
+
+		CheckRepoDesc(sc, keys, desc)
+
+		versItf, ok := desc["vers"]
+		if !ok {
+			sc.Errorf(keys, "dependency \"%s\" missing \"vers\" map",
+				depName)
+			continue
+		}
+		versMap, err := cast.ToStringMapStringE(versItf)
+		if err != nil {
+			sc.Errorf(append(keys, "vers"),
+				"dependency \"%s\" has invalid \"vers\" map; must map "+
+					"commit to version requirement", depName)
+			continue
+		}
+
+		for commit, reqsStr := range versMap {
+			versKeys := []string{"repo.deps", depName, "vers", commit}
+			if err := newtutil.ValidateCommitSpec(commit); err != nil {
+				sc.Errorf(versKeys, "dependency \"%s\": %s",
+					depName, err.Error())
+			}
+			CheckVersReqs(sc, versKeys, reqsStr)
+		}
+	}
+}
+
+func checkRepoMove(sc *newtutil.SchemaChecker, key string, itf interface{}) {
+	desc, err := cast.ToStringMapE(itf)
+	if err != nil {
+		sc.Errorf([]string{key},
+			"\"%s\" must be a repo descriptor (e.g., type and url)", key)
+		return
+	}
+	if _, ok := desc["type"]; !ok {
+		sc.Errorf([]string{key}, "\"%s\" missing \"type\"", key)
+	}
+
+	CheckRepoDesc(sc, []string{key}, desc)
+}
+
+// Validates the structure of a `repository.yml` file.  Unknown keys produce
+// warnings; anything that would prevent the repo from being used is an error.
+func validateRepoYml(path string) error {
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		// Reported when the file is parsed.
+		return nil
+	}
+
+	m := map[string]interface{}{}
+	if err := yaml.Unmarshal(file, &m); err != nil {
+		return nil
+	}
+	m = newtutil.FlattenTopLevel(m)
+
+	sc := newtutil.NewSchemaChecker(path)
+	sc.CheckKeys(nil, m, repoYmlKeys)
+
+	if itf, ok := m["repo.versions"]; ok {
+		checkRepoVersions(sc, itf)
+	}
+	if itf, ok := m["repo.deps"]; ok {
+		checkRepoDeps(sc, itf)
+	}
+	for _, key := range repoMoveKeys {
+		if itf, ok := m[key]; ok {
+			checkRepoMove(sc, key, itf)
+		}
+	}
+
+	return sc.Report()
+}
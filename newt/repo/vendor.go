@@ -0,0 +1,48 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package repo
+
+import (
+	"path/filepath"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+)
+
+// Directs the repo to use a vendored copy (a snapshot stored in the project
+// without version control history) instead of its download under `repos/`.
+// A vendored repo is never downloaded or updated.
+//
+// @param path                  The location of the vendored copy.
+// @param commit                The commit the copy was taken from.
+// @param ver                   The version the copy was taken from; nil if
+//                                  unknown.
+func (r *Repo) UseVendored(path string, commit string,
+	ver *newtutil.RepoVersion) {
+
+	r.vendorPath = filepath.ToSlash(filepath.Clean(path))
+	r.vendorCommit = commit
+	r.vendorVer = ver
+	r.localPath = r.vendorPath
+}
+
+// Indicates whether the project uses a vendored copy of this repo.
+func (r *Repo) IsVendored() bool {
+	return r.vendorPath != ""
+}
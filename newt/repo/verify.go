@@ -0,0 +1,168 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package repo
+
+import (
+	"fmt"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// The checks performed by Verify().
+const (
+	VERIFY_CHECK_ORIGIN        = "origin"
+	VERIFY_CHECK_COMMIT        = "commit"
+	VERIFY_CHECK_SUBMODULES    = "submodules"
+	VERIFY_CHECK_VERSION_FILES = "version-files"
+)
+
+// The outcome of a single check.
+const (
+	VERIFY_STATUS_OK   = "ok"
+	VERIFY_STATUS_WARN = "warn"
+	VERIFY_STATUS_FAIL = "fail"
+	VERIFY_STATUS_SKIP = "skip"
+)
+
+type VerifyCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+
+	// Describes each problem found, or why the check was skipped.  A check
+	// that only found warnings passes.
+	Details []string `json:"details,omitempty"`
+}
+
+// The result of checking an installed repo against the project's
+// expectations.
+type VerifyReport struct {
+	Repo   string        `json:"repo"`
+	Path   string        `json:"path"`
+	Commit string        `json:"commit,omitempty"`
+	Ok     bool          `json:"ok"`
+	Checks []VerifyCheck `json:"checks"`
+}
+
+func (vr *VerifyReport) add(name string, problems []string, err error) {
+	vr.addWarn(name, problems, nil, err)
+}
+
+func (vr *VerifyReport) addWarn(name string, problems []string,
+	warnings []string, err error) {
+
+	vc := VerifyCheck{Name: name, Status: VERIFY_STATUS_OK}
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	if len(warnings) > 0 {
+		vc.Status = VERIFY_STATUS_WARN
+		vc.Details = warnings
+	}
+	if len(problems) > 0 {
+		vc.Status = VERIFY_STATUS_FAIL
+		vc.Details = append(problems, warnings...)
+		vr.Ok = false
+	}
+
+	vr.Checks = append(vr.Checks, vc)
+}
+
+func (vr *VerifyReport) skip(name string, reason string) {
+	vr.Checks = append(vr.Checks, VerifyCheck{
+		Name:    name,
+		Status:  VERIFY_STATUS_SKIP,
+		Details: []string{reason},
+	})
+}
+
+// Checks the installed repo without modifying it: its remote must point to the
+// URL in its definition, its submodules must be checked out at their recorded
+// commits, and the checked out `repository.yml` must be present and valid,
+// as must `version.yml` if there is one.  A missing `version.yml` only
+// produces a warning; newt treats such a repo as version 0.0.0.
+//
+// @param expCommit             The hash the repo is expected to be checked
+//                                  out at; "" if the project doesn't specify
+//                                  one.
+// @param expSource             The file that specifies the expected hash.
+func (r *Repo) Verify(expCommit string, expSource string) VerifyReport {
+	vr := VerifyReport{
+		Repo: r.Name(),
+		Path: r.Path(),
+		Ok:   true,
+	}
+
+	if util.NodeNotExist(r.Path()) {
+		vr.Ok = false
+		vr.Checks = []VerifyCheck{{
+			Name:    "installed",
+			Status:  VERIFY_STATUS_FAIL,
+			Details: []string{"repo is not installed"},
+		}}
+		return vr
+	}
+
+	// Origin URL.
+	problem, err := r.downloader.CheckOrigin(r.checkoutPath())
+	problems := []string{}
+	if problem != "" {
+		problems = append(problems, problem)
+	}
+	vr.add(VERIFY_CHECK_ORIGIN, problems, err)
+
+	// Checked out commit.
+	commit, err := r.CurrentHash()
+	vr.Commit = commit
+	if err != nil || expCommit != "" {
+		problems = nil
+		if err == nil && commit != expCommit {
+			problems = append(problems, fmt.Sprintf(
+				"repo is at commit %s, but %s specifies %s",
+				commit, expSource, expCommit))
+		}
+		vr.add(VERIFY_CHECK_COMMIT, problems, err)
+	} else {
+		vr.skip(VERIFY_CHECK_COMMIT,
+			"neither project.yml nor the lock file specifies a commit")
+	}
+
+	// Submodules.
+	problems, err = r.downloader.CheckSubmodules(r.checkoutPath())
+	vr.add(VERIFY_CHECK_SUBMODULES, problems, err)
+
+	// Version files.
+	problems = nil
+	warnings := []string(nil)
+	ymlPath := r.Path() + "/" + REPO_FILE_NAME
+	if util.NodeNotExist(ymlPath) {
+		problems = append(problems, REPO_FILE_NAME+" is missing")
+	} else if err := validateRepoYml(ymlPath); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if util.NodeNotExist(r.Path() + "/" + REPO_VER_FILE_NAME) {
+		warnings = append(warnings,
+			REPO_VER_FILE_NAME+" is missing; assuming version 0.0.0")
+	} else if _, err := r.installedVersionYml(); err != nil {
+		problems = append(problems, REPO_VER_FILE_NAME+" is malformed")
+	}
+	vr.addWarn(VERIFY_CHECK_VERSION_FILES, problems, warnings, nil)
+
+	return vr
+}
@@ -22,8 +22,6 @@
 package repo
 
 import (
-	"strings"
-
 	log "github.com/Sirupsen/logrus"
 
 	"mynewt.apache.org/newt/newt/newtutil"
@@ -62,21 +60,13 @@ func (r *Repo) DepsForVersion(ver newtutil.RepoVersion) []*RepoDependency {
 	return r.deps[commit]
 }
 
-// Removes extra information from a git commit string.  This throws away
-// information and causes some ambiguity, but it allows git commits to be
-// specified in a user-friendly manner (e.g., "mynewt_1_3_0_tag" rather than
-// "tags/mynewt_1_3_0_tag").
-func normalizeCommit(commit string) string {
-	commit = strings.TrimPrefix(commit, "tags/")
-	commit = strings.TrimPrefix(commit, "origin/")
-	commit = strings.TrimPrefix(commit, "heads/")
-	return commit
-}
-
 // Retrieves the repo's currently checked-out hash.
 func (r *Repo) CurrentHash() (string, error) {
-	dl := r.downloader
-	commit, err := dl.HashFor(r.Path(), "HEAD")
+	if r.IsVendored() {
+		return r.vendorCommit, nil
+	}
+
+	commit, err := r.VCSState().CurrentCommit(r.Path())
 	if err != nil {
 		return "",
 			util.FmtNewtError("Error finding current hash for \"%s\": %s",
@@ -87,7 +77,17 @@ func (r *Repo) CurrentHash() (string, error) {
 
 // Retrieves all commit strings corresponding to the repo's current state.
 func (r *Repo) CurrentCommits() ([]string, error) {
-	commits, err := r.downloader.CommitsFor(r.Path(), "HEAD")
+	if r.IsVendored() {
+		return []string{r.vendorCommit}, nil
+	}
+
+	st := r.VCSState()
+	cur, err := st.CurrentCommit(r.Path())
+	if err != nil {
+		return nil, err
+	}
+
+	commits, err := st.CommitsFor(r.Path(), cur)
 	if err != nil {
 		return nil, err
 	}
@@ -128,7 +128,13 @@ func (r *Repo) CommitsEquivalent(c1 string, c2 string) (bool, error) {
 		return false, nil
 	}
 
-	commits, err := r.downloader.CommitsFor(r.Path(), c1)
+	st := r.VCSState()
+	if !st.HasHistory() {
+		// There is only one revision.
+		return true, nil
+	}
+
+	commits, err := st.CommitsFor(r.Path(), c1)
 	if err != nil {
 		return false, err
 	}
@@ -150,7 +156,7 @@ func (r *Repo) HashFromVer(ver newtutil.RepoVersion) (string, error) {
 		return "", err
 	}
 
-	hash, err := r.downloader.HashFor(r.Path(), commit)
+	hash, err := r.VCSState().HashFor(r.Path(), commit)
 	if err != nil {
 		return "", err
 	}
@@ -179,8 +185,9 @@ func (r *Repo) VersFromCommit(commit string) []newtutil.RepoVersion {
 // commits exist, they are not considered here.
 func (r *Repo) VersFromCommits(commits []string) []newtutil.RepoVersion {
 	var vers []newtutil.RepoVersion
+	st := r.VCSState()
 	for _, c := range commits {
-		vers = append(vers, r.VersFromCommit(normalizeCommit(c))...)
+		vers = append(vers, r.VersFromCommit(st.NormalizeCommit(c))...)
 	}
 
 	newtutil.SortVersions(vers)
@@ -192,7 +199,18 @@ func (r *Repo) VersFromCommits(commits []string) []newtutil.RepoVersion {
 func (r *Repo) VersFromEquivCommit(
 	commit string) ([]newtutil.RepoVersion, error) {
 
-	commits, err := r.downloader.CommitsFor(r.Path(), commit)
+	st := r.VCSState()
+	if !st.HasHistory() {
+		// Every version refers to the repo's only revision.
+		var vers []newtutil.RepoVersion
+		for v, _ := range r.vers {
+			vers = append(vers, v)
+		}
+		newtutil.SortVersions(vers)
+		return vers, nil
+	}
+
+	commits, err := st.CommitsFor(r.Path(), commit)
 	if err != nil {
 		return nil, err
 	}
@@ -329,7 +347,14 @@ func parseVersionYml(path string) (newtutil.RepoVersion, error) {
 
 // Reads and parses the `version.yml` file belonging to an installed repo.
 func (r *Repo) installedVersionYml() (*newtutil.RepoVersion, error) {
-	ver, err := parseVersionYml(r.Path() + "/" + REPO_VER_FILE_NAME)
+	path := r.Path() + "/" + REPO_VER_FILE_NAME
+	if util.NodeExist(path) {
+		if err := r.verifyMetadata(path); err != nil {
+			return nil, err
+		}
+	}
+
+	ver, err := parseVersionYml(path)
 	if err != nil {
 		return nil, err
 	}
@@ -346,7 +371,7 @@ func (r *Repo) nonInstalledVersionYml(
 	if err != nil {
 		// The download failed.  Determine if the commit string is bad or if
 		// the file just doesn't exist in that commit.
-		if _, e2 := r.downloader.CommitType(r.localPath, commit); e2 != nil {
+		if _, e2 := r.VCSState().CommitType(r.localPath, commit); e2 != nil {
 			// Bad commit string.
 			return nil, err
 		}
@@ -356,6 +381,11 @@ func (r *Repo) nonInstalledVersionYml(
 		return nil, versionYmlMissing
 	}
 
+	r.downloadSignature(commit, REPO_VER_FILE_NAME)
+	if err := r.verifyMetadata(filePath); err != nil {
+		return nil, err
+	}
+
 	ver, err := parseVersionYml(filePath)
 	if err != nil {
 		return nil, err
@@ -395,7 +425,7 @@ func (r *Repo) inferVersion(commit string, vyVer *newtutil.RepoVersion) (
 			// `repository.yml`, record the commit hash in the version
 			// specifier.  This will distinguish the returned version from its
 			// corresponding official release.
-			hash, err := r.downloader.HashFor(r.Path(), commit)
+			hash, err := r.VCSState().HashFor(r.Path(), commit)
 			if err != nil {
 				return nil, err
 			}
@@ -409,9 +439,14 @@ func (r *Repo) inferVersion(commit string, vyVer *newtutil.RepoVersion) (
 	}
 
 	if len(ryVers) > 0 {
+		ver := ryVers[0]
+		if !r.VCSState().HasHistory() {
+			// A repo without history holds its source's latest contents.
+			ver = ryVers[len(ryVers)-1]
+		}
 		log.Debugf("Inferred version %s for %s:%s from repository.yml",
-			ryVers[0].String(), r.Name(), commit)
-		return &ryVers[0], nil
+			ver.String(), r.Name(), commit)
+		return &ver, nil
 	}
 
 	return nil, nil
@@ -420,6 +455,12 @@ func (r *Repo) inferVersion(commit string, vyVer *newtutil.RepoVersion) (
 // Retrieves the installed version of the repo.  Returns nil if the version
 // cannot be detected.
 func (r *Repo) InstalledVersion() (*newtutil.RepoVersion, error) {
+	// A vendored copy has no history; its version was recorded when it was
+	// vendored.
+	if r.IsVendored() {
+		return r.vendorVer, nil
+	}
+
 	vyVer, err := r.installedVersionYml()
 	if err != nil && err != versionYmlMissing && err != versionYmlBad {
 		return nil, err
@@ -56,6 +56,11 @@ type Resolver struct {
 	flashMap         flash.FlashMap
 	cfg              syscfg.Cfg
 
+	// Setting values from a previous resolution with identical inputs.  These
+	// are used during the first pass only, allowing resolution to converge in
+	// a single iteration.
+	hintSettings map[string]string
+
 	// [api-name][api-supplier]
 	apiConflicts map[string]map[*ResolvePackage]struct{}
 }
@@ -324,6 +329,9 @@ func (r *Resolver) calcApiReqs() {
 //         error                non-nil on failure.
 func (r *Resolver) loadDepsForPkg(rpkg *ResolvePackage) (bool, error) {
 	settings := r.cfg.AllSettingsForLpkg(rpkg.Lpkg)
+	if r.hintSettings != nil {
+		settings = r.withHints(settings)
+	}
 
 	changed := false
 
@@ -411,6 +419,10 @@ func (r *Resolver) reloadCfg() (bool, error) {
 	// required for reloading syscfg, as settings may unlock additional
 	// settings.
 	settings := r.cfg.SettingValues()
+	if r.hintSettings != nil {
+		settings = r.withHints(settings)
+		r.hintSettings = nil
+	}
 	cfg, err := syscfg.Read(lpkgs, apis, r.injectedSettings, settings,
 		r.flashMap)
 	if err != nil {
@@ -429,6 +441,20 @@ func (r *Resolver) reloadCfg() (bool, error) {
 	return false, nil
 }
 
+// Returns the union of the specified settings and the resolver's hint
+// settings.  Settings that are already known take precedence over hints.
+func (r *Resolver) withHints(settings map[string]string) map[string]string {
+	merged := make(map[string]string, len(settings)+len(r.hintSettings))
+	for k, v := range r.hintSettings {
+		merged[k] = v
+	}
+	for k, v := range settings {
+		merged[k] = v
+	}
+
+	return merged
+}
+
 func (r *Resolver) resolveDepsOnce() (bool, error) {
 	// Circularly resolve dependencies, APIs, and required APIs until no new
 	// ones exist.
@@ -606,6 +632,21 @@ func ResolveFull(
 	injectedSettings map[string]string,
 	flashMap flash.FlashMap) (*Resolution, error) {
 
+	return ResolveFullHinted(loaderSeeds, appSeeds, injectedSettings,
+		flashMap, nil)
+}
+
+// Performs a full resolution, using the specified settings as a starting
+// point.  The hint settings should be the final setting values of a previous
+// resolution with the same inputs.  Hints only affect how quickly resolution
+// converges; the result is calculated in full either way.
+func ResolveFullHinted(
+	loaderSeeds []*pkg.LocalPackage,
+	appSeeds []*pkg.LocalPackage,
+	injectedSettings map[string]string,
+	flashMap flash.FlashMap,
+	hintSettings map[string]string) (*Resolution, error) {
+
 	// First, calculate syscfg and determine which package provides each
 	// required API.  Syscfg and APIs are project-wide; that is, they are
 	// calculated across the aggregate of all app packages and loader packages
@@ -614,6 +655,7 @@ func ResolveFull(
 
 	allSeeds := append(loaderSeeds, appSeeds...)
 	r := newResolver(allSeeds, injectedSettings, flashMap)
+	r.hintSettings = hintSettings
 
 	if err := r.resolveDepsAndCfg(); err != nil {
 		return nil, err
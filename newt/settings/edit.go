@@ -0,0 +1,497 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// This file implements programmatic editing of the newtrc file
+// ($HOME/.newt/repos.yml).  Edits are made line by line so that comments and
+// formatting in the rest of the file are preserved.  Each edit is performed
+// while holding a lock file, is validated by re-parsing the result, and is
+// written atomically (temporary file + rename), so concurrent newt processes
+// and provisioning scripts never observe a partially written file.
+//
+// A setting key is either a top-level key (e.g., "git.timeout") or a field of
+// a top-level map (e.g., "repository.apache-mynewt-core.login", which refers
+// to the "login" field of the "repository.apache-mynewt-core" map).
+
+package settings
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/util"
+	"mynewt.apache.org/newt/yaml"
+)
+
+const NEWTRC_LOCK_SUFFIX = ".lock"
+
+// How long to wait for another process to release the newtrc lock.
+const NEWTRC_LOCK_TIMEOUT = 10 * time.Second
+
+// A lock file older than this is assumed to belong to a process that died.
+const NEWTRC_LOCK_STALE = 2 * time.Minute
+
+type settingType int
+
+const (
+	SETTING_TYPE_STRING settingType = iota
+	SETTING_TYPE_BOOL
+	SETTING_TYPE_INT
+)
+
+// Newtrc settings whose values are not strings.
+var settingTypes = map[string]settingType{
+	"build.cache_errors":    SETTING_TYPE_BOOL,
+	"build.ccache":          SETTING_TYPE_BOOL,
+	"build.jobs":            SETTING_TYPE_INT,
+	"cache.git.enabled":     SETTING_TYPE_BOOL,
+	"cache.git.worktrees":   SETTING_TYPE_BOOL,
+	"cache.metadata.ttl":    SETTING_TYPE_INT,
+	"cache.objects.enabled": SETTING_TYPE_BOOL,
+	"exec.hang_timeout":     SETTING_TYPE_INT,
+	"git.timeout":           SETTING_TYPE_INT,
+	"install.frozen":        SETTING_TYPE_BOOL,
+	"newt.auto_exec":        SETTING_TYPE_BOOL,
+}
+
+var settingKeyRe = regexp.MustCompile(`^[A-Za-z0-9_\-]+(\.[A-Za-z0-9_\-]+)*$`)
+
+// Returns the path of the newtrc file.
+func NewtrcPath() (string, error) {
+	dir := NewtrcDir()
+	if dir == "" {
+		return "", util.NewNewtError(
+			"cannot determine the user's home directory")
+	}
+
+	return dir + "/" + REPOS_FILENAME, nil
+}
+
+// Acquires the newtrc lock.  The returned function releases it.
+func lockNewtrc(path string) (func(), error) {
+	lockPath := path + NEWTRC_LOCK_SUFFIX
+	deadline := time.Now().Add(NEWTRC_LOCK_TIMEOUT)
+
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY,
+			0644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, util.ChildNewtError(err)
+		}
+
+		if fi, err := os.Stat(lockPath); err == nil &&
+			time.Since(fi.ModTime()) > NEWTRC_LOCK_STALE {
+
+			os.Remove(lockPath)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, util.FmtNewtError(
+				"timed out waiting for %s; delete it if no other newt "+
+					"process is running", lockPath)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func readNewtrcText(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", util.ChildNewtError(err)
+	}
+
+	return string(data), nil
+}
+
+func parseNewtrcText(text string) (map[string]interface{}, error) {
+	raw := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(text), &raw); err != nil {
+		return nil, util.FmtNewtError("invalid YAML: %s", err.Error())
+	}
+
+	return raw, nil
+}
+
+// Determines where a setting lives in the newtrc file.
+//
+// @return string               The name of the top-level map containing the
+//                                  setting, or "" for a top-level setting.
+// @return string               The setting's key within its map, or the full
+//                                  key for a top-level setting.
+func splitSettingKey(raw map[string]interface{},
+	key string) (string, string) {
+
+	if v, ok := raw[key]; ok {
+		if _, err := cast.ToStringMapE(v); err != nil {
+			return "", key
+		}
+	}
+
+	// Use the longest existing map whose name is a prefix of the key.
+	prefix := key
+	for {
+		i := strings.LastIndex(prefix, ".")
+		if i <= 0 {
+			break
+		}
+		prefix = prefix[:i]
+
+		if v, ok := raw[prefix]; ok {
+			if _, err := cast.ToStringMapE(v); err == nil {
+				return prefix, key[i+1:]
+			}
+		}
+	}
+
+	// Repository credentials are always stored in a per-repo map; private
+	// package indexes in the "search.indexes" map.
+	parts := strings.SplitN(key, ".", 3)
+	if len(parts) == 3 &&
+		(parts[0] == "repository" || parts[0]+"."+parts[1] == "search.indexes") {
+
+		return parts[0] + "." + parts[1], parts[2]
+	}
+
+	return "", key
+}
+
+func lookupSetting(raw map[string]interface{}, key string) (string, bool) {
+	section, field := splitSettingKey(raw, key)
+
+	var v interface{}
+	var ok bool
+	if section == "" {
+		v, ok = raw[field]
+	} else {
+		v, ok = cast.ToStringMap(raw[section])[field]
+	}
+	if !ok || v == nil {
+		return "", false
+	}
+
+	return cast.ToString(v), true
+}
+
+// Checks a setting's key and value, and converts the value to the form in
+// which it is written.
+func normalizeSetting(key string, val string) (string, error) {
+	if !settingKeyRe.MatchString(key) {
+		return "", util.FmtNewtError("invalid setting name: \"%s\"", key)
+	}
+
+	if strings.ContainsAny(val, "\r\n") {
+		return "", util.FmtNewtError(
+			"invalid value for %s: multi-line values are not supported", key)
+	}
+
+	switch settingTypes[key] {
+	case SETTING_TYPE_BOOL:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return "", util.FmtNewtError(
+				"invalid value for %s: \"%s\" is not a boolean", key, val)
+		}
+		if b {
+			return "1", nil
+		}
+		return "0", nil
+
+	case SETTING_TYPE_INT:
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			return "", util.FmtNewtError(
+				"invalid value for %s: \"%s\" is not a non-negative integer",
+				key, val)
+		}
+		return strconv.Itoa(n), nil
+
+	default:
+		return val, nil
+	}
+}
+
+// Formats a value for the newtrc file.  Strings are single-quoted so that
+// they are never interpreted as numbers or booleans, and so that no
+// characters need escaping other than the quote itself.
+func settingValueText(key string, val string) string {
+	if settingTypes[key] != SETTING_TYPE_STRING {
+		return val
+	}
+
+	return "'" + strings.Replace(val, "'", "''", -1) + "'"
+}
+
+var yamlKeyRe = regexp.MustCompile(`^(\s*)([^\s#:][^:]*?)\s*:(\s|$)`)
+
+// Parses a "key: value" line.
+//
+// @return string               The line's indentation.
+// @return string               The key; "" if the line doesn't contain one.
+func parseYamlLine(line string) (string, string) {
+	m := yamlKeyRe.FindStringSubmatch(line)
+	if m == nil {
+		return "", ""
+	}
+
+	return m[1], strings.Trim(m[2], `"'`)
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+// Finds the line containing the specified key, searching lines [start, end)
+// for a key at the given indentation.  Returns -1 if the key isn't present.
+func findKeyLine(lines []string, start int, end int, key string,
+	indent int) int {
+
+	for i := start; i < end; i++ {
+		ws, k := parseYamlLine(lines[i])
+		if k == key && len(ws) == indent {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Determines the index one past the last line belonging to the entry that
+// starts at the specified line (i.e., the entry's nested and continuation
+// lines).
+func entryEnd(lines []string, idx int) int {
+	base := indentOf(lines[idx])
+	end := idx + 1
+	for i := idx + 1; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if indentOf(lines[i]) <= base {
+			break
+		}
+		end = i + 1
+	}
+
+	return end
+}
+
+// Applies a change to the text of a newtrc file.  A nil value removes the
+// setting.
+func editNewtrcText(text string, raw map[string]interface{}, key string,
+	valText *string) string {
+
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if text == "" {
+		lines = nil
+	}
+
+	replace := func(start int, end int, repl []string) {
+		tail := append(repl, lines[end:]...)
+		lines = append(lines[:start], tail...)
+	}
+
+	section, field := splitSettingKey(raw, key)
+	if section == "" {
+		idx := findKeyLine(lines, 0, len(lines), field, 0)
+		switch {
+		case idx >= 0 && valText == nil:
+			replace(idx, entryEnd(lines, idx), nil)
+		case idx >= 0:
+			replace(idx, entryEnd(lines, idx),
+				[]string{field + ": " + *valText})
+		case valText != nil:
+			lines = append(lines, field+": "+*valText)
+		}
+	} else {
+		hdr := findKeyLine(lines, 0, len(lines), section, 0)
+		if hdr < 0 {
+			if valText != nil {
+				lines = append(lines, section+":",
+					"    "+field+": "+*valText)
+			}
+		} else {
+			end := entryEnd(lines, hdr)
+
+			// Use the indentation of the map's existing entries.
+			indent := "    "
+			for i := hdr + 1; i < end; i++ {
+				if ws, k := parseYamlLine(lines[i]); k != "" {
+					indent = ws
+					break
+				}
+			}
+
+			idx := findKeyLine(lines, hdr+1, end, field, len(indent))
+			switch {
+			case idx >= 0 && valText == nil:
+				replace(idx, entryEnd(lines, idx), nil)
+				if entryEnd(lines, hdr) == hdr+1 {
+					// The map is now empty; remove it.
+					replace(hdr, hdr+1, nil)
+				}
+			case idx >= 0:
+				replace(idx, entryEnd(lines, idx),
+					[]string{indent + field + ": " + *valText})
+			case valText != nil:
+				replace(end, end,
+					[]string{indent + field + ": " + *valText})
+			}
+		}
+	}
+
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Writes a file atomically: the contents are written to a temporary file in
+// the same directory, which then replaces the original.
+func writeFileAtomic(path string, contents string) error {
+	tmp := fmt.Sprintf("%s.tmp.%d", path, os.Getpid())
+	if err := ioutil.WriteFile(tmp, []byte(contents), 0600); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// Reads a single setting directly from the newtrc file.
+//
+// @return string               The setting's value.
+// @return bool                 false if the setting is not present.
+func GetNewtrcValue(key string) (string, bool, error) {
+	path, err := NewtrcPath()
+	if err != nil {
+		return "", false, err
+	}
+
+	text, err := readNewtrcText(path)
+	if err != nil {
+		return "", false, err
+	}
+
+	raw, err := parseNewtrcText(text)
+	if err != nil {
+		return "", false, util.FmtNewtError("%s: %s", path, err.Error())
+	}
+
+	val, ok := lookupSetting(raw, key)
+	return val, ok, nil
+}
+
+// Locks, edits, validates, and atomically rewrites the newtrc file.  A nil
+// value removes the setting.
+func editNewtrc(key string, val *string) error {
+	path, err := NewtrcPath()
+	if err != nil {
+		return err
+	}
+
+	var valText *string
+	if val != nil {
+		norm, err := normalizeSetting(key, *val)
+		if err != nil {
+			return err
+		}
+		val = &norm
+
+		text := settingValueText(key, norm)
+		valText = &text
+	} else if !settingKeyRe.MatchString(key) {
+		return util.FmtNewtError("invalid setting name: \"%s\"", key)
+	}
+
+	if err := os.MkdirAll(NewtrcDir(), 0755); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	unlock, err := lockNewtrc(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	text, err := readNewtrcText(path)
+	if err != nil {
+		return err
+	}
+
+	raw, err := parseNewtrcText(text)
+	if err != nil {
+		return util.FmtNewtError("%s: %s; fix the file before editing it",
+			path, err.Error())
+	}
+
+	newText := editNewtrcText(text, raw, key, valText)
+
+	// Make sure the edit had the intended effect before replacing the file.
+	newRaw, err := parseNewtrcText(newText)
+	if err != nil {
+		return util.FmtNewtError(
+			"failed to update %s; the result would be %s", path, err.Error())
+	}
+	got, ok := lookupSetting(newRaw, key)
+	if (val == nil && ok) || (val != nil && (!ok || got != *val)) {
+		return util.FmtNewtError(
+			"failed to update %s: cannot edit setting \"%s\" in this file; "+
+				"please edit it manually", path, key)
+	}
+
+	if err := writeFileAtomic(path, newText); err != nil {
+		return err
+	}
+
+	// Make the change visible to the rest of this newt invocation.
+	newtrcOnce.Do(func() {})
+	newtrc = readNewtrc()
+
+	return nil
+}
+
+// Sets a newtrc setting, creating the newtrc file if necessary.
+func SetNewtrcValue(key string, val string) error {
+	return editNewtrc(key, &val)
+}
+
+// Removes a newtrc setting.  Removing a setting that is not present is not an
+// error.
+func UnsetNewtrcValue(key string) error {
+	return editNewtrc(key, nil)
+}
@@ -20,10 +20,14 @@
 package settings
 
 import (
+	"os"
 	"os/user"
+	"path/filepath"
 	"strings"
+	"sync"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/cast"
 
 	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/ycfg"
@@ -31,17 +35,30 @@ import (
 
 const NEWTRC_DIR string = ".newt"
 const REPOS_FILENAME string = "repos.yml"
+const GIT_CACHE_DIR string = "cache/git"
+const ARTIFACT_CACHE_DIR string = "cache/artifacts"
 
 // Contains general newt settings read from $HOME/.newt
 var newtrc ycfg.YCfg
+var newtrcOnce sync.Once
 
-func readNewtrc() ycfg.YCfg {
+// Returns the path of the user's newt settings directory ($HOME/.newt), or ""
+// if the user's home directory cannot be determined.
+func NewtrcDir() string {
 	usr, err := user.Current()
 	if err != nil {
+		return ""
+	}
+
+	return usr.HomeDir + "/" + NEWTRC_DIR
+}
+
+func readNewtrc() ycfg.YCfg {
+	dir := NewtrcDir()
+	if dir == "" {
 		return ycfg.YCfg{}
 	}
 
-	dir := usr.HomeDir + "/" + NEWTRC_DIR
 	yc, err := newtutil.ReadConfig(dir,
 		strings.TrimSuffix(REPOS_FILENAME, ".yml"))
 	if err != nil {
@@ -53,10 +70,355 @@ func readNewtrc() ycfg.YCfg {
 }
 
 func Newtrc() ycfg.YCfg {
-	if newtrc != nil {
-		return newtrc
-	}
+	newtrcOnce.Do(func() {
+		newtrc = readNewtrc()
+	})
 
-	newtrc = readNewtrc()
 	return newtrc
 }
+
+// Maps newtrc proxy settings to the environment variables that git (and most
+// other HTTP clients) consult.
+var proxyEnvVars = []struct {
+	setting string
+	envVars []string
+}{
+	{"proxy.http", []string{"http_proxy", "HTTP_PROXY"}},
+	{"proxy.https", []string{"https_proxy", "HTTPS_PROXY"}},
+	{"proxy.no_proxy", []string{"no_proxy", "NO_PROXY"}},
+}
+
+// Returns the proxy configuration from $HOME/.newt/repos.yml as a list of
+// key=value environment variable assignments.  Variables that are already
+// present in newt's environment are not overridden.  Returns nil if no proxy
+// settings are configured.
+func ProxyEnv() []string {
+	var env []string
+
+	nrc := Newtrc()
+	for _, p := range proxyEnvVars {
+		val := nrc.GetValString(p.setting, nil)
+		if val == "" {
+			continue
+		}
+
+		for _, v := range p.envVars {
+			if _, ok := os.LookupEnv(v); !ok {
+				env = append(env, v+"="+val)
+			}
+		}
+	}
+
+	return env
+}
+
+// Returns the value of a newtrc proxy setting (e.g., "proxy.https").  As with
+// ProxyEnv(), a corresponding environment variable takes precedence over the
+// newtrc.  Returns "" if the proxy isn't configured.
+func ProxySetting(setting string) string {
+	for _, p := range proxyEnvVars {
+		if p.setting != setting {
+			continue
+		}
+
+		for _, v := range p.envVars {
+			if val, ok := os.LookupEnv(v); ok {
+				return val
+			}
+		}
+	}
+
+	return Newtrc().GetValString(setting, nil)
+}
+
+// Returns the path of the shared git mirror directory, or "" if the mirror
+// cache is disabled.  The cache is enabled with the following newtrc setting:
+//
+//     cache.git.enabled: 1
+//
+// The default location ($HOME/.newt/cache/git) can be overridden with the
+// "cache.git.dir" setting.
+func GitCacheDir() string {
+	nrc := Newtrc()
+	if !nrc.GetValBool("cache.git.enabled", nil) {
+		return ""
+	}
+
+	if dir := nrc.GetValString("cache.git.dir", nil); dir != "" {
+		return dir
+	}
+
+	dir := NewtrcDir()
+	if dir == "" {
+		return ""
+	}
+
+	return dir + "/" + GIT_CACHE_DIR
+}
+
+// Indicates whether repos should be checked out as worktrees of shared bare
+// repos in the git cache rather than cloned.  Worktrees are enabled with the
+// following newtrc settings:
+//
+//     cache.git.enabled: 1
+//     cache.git.worktrees: 1
+func GitWorktrees() bool {
+	if GitCacheDir() == "" {
+		return false
+	}
+
+	return Newtrc().GetValBool("cache.git.worktrees", nil)
+}
+
+// Returns the path of the shared resolution cache, or "" if the cache is
+// disabled.  The cache is experimental; it is enabled by specifying its
+// location in newtrc:
+//
+//     cache.resolve.dir: /path/to/shared/store
+func ResolveCacheDir() string {
+	return Newtrc().GetValString("cache.resolve.dir", nil)
+}
+
+// Returns the path of the downloaded artifact cache, or "" if the user's home
+// directory cannot be determined.  The default location
+// ($HOME/.newt/cache/artifacts) can be overridden with the
+// "cache.artifacts.dir" newtrc setting.
+func ArtifactCacheDir() string {
+	if dir := Newtrc().GetValString("cache.artifacts.dir", nil); dir != "" {
+		return dir
+	}
+
+	dir := NewtrcDir()
+	if dir == "" {
+		return ""
+	}
+
+	return dir + "/" + ARTIFACT_CACHE_DIR
+}
+
+// Returns the maximum number of seconds a git operation may take, or 0 if git
+// operations never time out.  The timeout is specified with the "git.timeout"
+// newtrc setting.
+func GitTimeout() int {
+	return Newtrc().GetValInt("git.timeout", nil)
+}
+
+// Returns the number of seconds a downloaded repo description (i.e., a repo's
+// `repository.yml` file) is used before the repo is fetched again, or 0 if
+// repos are always fetched.  Specified with the "cache.metadata.ttl" newtrc
+// setting; by default, repos are always fetched.
+func MetadataCacheTTL() int {
+	return Newtrc().GetValInt("cache.metadata.ttl", nil)
+}
+
+// Returns the number of seconds an external command (git, compiler, download
+// script, etc.) may run without producing output before it is considered hung
+// and killed, or 0 if commands are never considered hung.  The timeout is
+// specified with the "exec.hang_timeout" newtrc setting.
+func HangTimeout() int {
+	return Newtrc().GetValInt("exec.hang_timeout", nil)
+}
+
+// Returns the template that `newt new` uses when none is specified on the
+// command line, or "" for the default.  Organizations can point this at their
+// own starting point with the "new.template" newtrc setting, e.g.:
+//
+//     new.template: https://git.example.com/mynewt-starter.git#v2
+func NewTemplate() string {
+	return Newtrc().GetValString("new.template", nil)
+}
+
+// Indicates whether object files and archives are stored in, and reused from,
+// a content-addressed cache shared by all of a project's targets.  Enabled
+// with the following newtrc setting:
+//
+//     cache.objects.enabled: 1
+func ObjectCache() bool {
+	return Newtrc().GetValBool("cache.objects.enabled", nil)
+}
+
+// Returns the number of concurrent build jobs to run when the "-j" flag is not
+// specified, or 0 to use one job per CPU.  Specified with the following newtrc
+// setting:
+//
+//     build.jobs: <count>
+//
+// A higher count is useful when compilations are dispatched to other machines
+// (see BuildLauncher()).
+func BuildJobs() int {
+	return Newtrc().GetValInt("build.jobs", nil)
+}
+
+// Indicates whether compiler failures should be remembered so that unchanged
+// broken files are not recompiled.  Enabled with the following newtrc
+// setting:
+//
+//     build.cache_errors: 1
+func BuildCacheErrors() bool {
+	return Newtrc().GetValBool("build.cache_errors", nil)
+}
+
+// Returns the build backend named by the "build.backend" newtrc setting, or ""
+// if newt compiles source files itself.  Currently, the only alternative
+// backend is "ninja".
+func BuildBackend() string {
+	return Newtrc().GetValString("build.backend", nil)
+}
+
+// Returns the ninja executable that the ninja build backend runs.  Specified
+// with the "build.ninja_path" newtrc setting; defaults to "ninja".  A bare
+// command name is looked up in the PATH.
+func NinjaPath() string {
+	p := Newtrc().GetValString("build.ninja_path", nil)
+	if p == "" {
+		return "ninja"
+	}
+
+	if !strings.Contains(p, "/") {
+		return p
+	}
+	return expandNewtrcPath(p)
+}
+
+// Indicates whether compiler invocations are routed through ccache.  A target
+// can override this with its "target.ccache" setting.  Enabled with the
+// following newtrc setting:
+//
+//     build.ccache: 1
+func BuildCcache() bool {
+	return Newtrc().GetValBool("build.ccache", nil)
+}
+
+// Returns the ccache executable.  Specified with the "build.ccache_path"
+// newtrc setting; defaults to "ccache".  A bare command name is looked up in
+// the PATH.
+func CcachePath() string {
+	p := Newtrc().GetValString("build.ccache_path", nil)
+	if p == "" {
+		return "ccache"
+	}
+
+	if !strings.Contains(p, "/") {
+		return p
+	}
+	return expandNewtrcPath(p)
+}
+
+// Returns the compiler launcher chain specified by the "build.launcher" newtrc
+// setting, outermost first, e.g., "distcc" or "ccache distcc".  A target can
+// override this with its "target.launcher" setting.
+func BuildLauncher() []string {
+	return LauncherChain(Newtrc().GetValString("build.launcher", nil))
+}
+
+// Parses a whitespace-separated compiler launcher chain.  Bare command names
+// are looked up in the PATH.
+func LauncherChain(s string) []string {
+	var chain []string
+	for _, p := range strings.Fields(s) {
+		if strings.Contains(p, "/") {
+			p = expandNewtrcPath(p)
+		}
+		chain = append(chain, p)
+	}
+
+	return chain
+}
+
+// Indicates whether `newt install` performs a frozen install (i.e., only
+// verifies that each repo matches the project's lock file) even without the
+// "--frozen" flag.  Intended for CI machines.  Enabled with the following
+// newtrc setting:
+//
+//     install.frozen: 1
+func InstallFrozen() bool {
+	return Newtrc().GetValBool("install.frozen", nil)
+}
+
+// Returns the paths of the public keys that may sign the specified repo's
+// metadata (`repository.yml` and `version.yml`), or nil if the repo's metadata
+// need not be signed.  Keys are PEM files listed per repo under the
+// "repo.trusted_keys" newtrc setting; keys listed under "*" apply to every
+// repo:
+//
+//     repo.trusted_keys:
+//         apache-mynewt-core: ~/.newt/keys/mynewt.pem
+//         "*":
+//             - ~/.newt/keys/acme.pem
+//
+// Relative paths are relative to the newtrc directory.
+func RepoTrustedKeys(repoName string) []string {
+	m := Newtrc().GetValStringMap("repo.trusted_keys", nil)
+
+	var paths []string
+	for _, name := range []string{repoName, "*"} {
+		itf, ok := m[name]
+		if !ok {
+			continue
+		}
+
+		var keys []string
+		if s, ok := itf.(string); ok {
+			keys = []string{s}
+		} else {
+			keys = cast.ToStringSlice(itf)
+		}
+
+		for _, k := range keys {
+			paths = append(paths, expandNewtrcPath(k))
+		}
+	}
+
+	return paths
+}
+
+// Expands a leading "~/" in a path from newtrc, and makes a relative path
+// relative to the newtrc directory.
+func expandNewtrcPath(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if usr, err := user.Current(); err == nil {
+			return usr.HomeDir + path[1:]
+		}
+	}
+
+	if !filepath.IsAbs(path) {
+		return NewtrcDir() + "/" + path
+	}
+
+	return path
+}
+
+// Indicates whether newt may download and run the newt version that a
+// project requires when it doesn't satisfy the project's
+// "project.newt_version".  Enabled with the following newtrc setting:
+//
+//     newt.auto_exec: 1
+func NewtAutoExec() bool {
+	return Newtrc().GetValBool("newt.auto_exec", nil)
+}
+
+// Returns the location from which a project's required newt executable is
+// downloaded if the project doesn't specify one, or "" if there is none.  See
+// downloader.NewtDownloadUrl() for the placeholders it may contain.
+func NewtDownloadUrl() string {
+	return Newtrc().GetValString("newt.download_url", nil)
+}
+
+// The default location of newt release downloads.  "%s" is replaced with the
+// release's version number.
+const NEWT_RELEASE_URL_DFLT = "https://archive.apache.org/dist/mynewt/" +
+	"apache-mynewt-%s/"
+
+// Returns the location from which the specified newt release can be
+// downloaded.  The default can be overridden with the "newt.release_url"
+// newtrc setting, e.g.:
+//
+//     newt.release_url: https://mirror.example.com/mynewt/%s/
+func NewtReleaseUrl(ver newtutil.Version) string {
+	tmpl := Newtrc().GetValString("newt.release_url", nil)
+	if tmpl == "" {
+		tmpl = NEWT_RELEASE_URL_DFLT
+	}
+
+	return strings.Replace(tmpl, "%s", ver.String(), -1)
+}
@@ -0,0 +1,279 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package signing implements named signing profiles.  A profile ties a
+// signing key to the rules for using it, so that, e.g., a production key is
+// only ever used for production targets and a development key never signs a
+// production image by mistake.  Profiles are defined in `project.yml` and in
+// newtrc ($HOME/.newt/repos.yml):
+//
+//     signing.profiles:
+//         dev:
+//             key: keys/dev.pem
+//         prod:
+//             key_env: PROD_SIGNING_KEY      # Key path read from env var.
+//             key_id: 0
+//             key_hash: 5b2f...e0            # SHA-256 of the public key.
+//             policy: release-prod.yml       # Release policy to enforce.
+//             targets: targets/board_a targets/board_b
+//
+// A profile can be defined in both places, but newtrc may only say where the
+// key lives ("key" and "key_env"); the rules for using it (expected key,
+// policy, targets) come from `project.yml` alone, so a machine's settings
+// can't loosen them.  Relative paths in `project.yml` are relative to the
+// project root.
+//
+// A target selects its default profile with `target.signing_profile`.
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/image"
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/newt/settings"
+	"mynewt.apache.org/newt/newt/target"
+	"mynewt.apache.org/newt/newt/ycfg"
+	"mynewt.apache.org/newt/util"
+)
+
+const PROFILES_KEY = "signing.profiles"
+
+// The profile fields that newtrc may specify.
+var newtrcProfileFields = map[string]bool{
+	"key":     true,
+	"key_env": true,
+}
+
+type Profile struct {
+	Name string
+
+	// Path of the private key.
+	KeyFile string
+	KeyId   uint8
+
+	// Expected SHA-256 of the key's public half (hex); "" if unchecked.
+	KeyHash string
+
+	// Release policy file that images signed with this profile must meet; ""
+	// for none.
+	Policy string
+
+	// Full names of the targets allowed to use this profile; empty allows any
+	// target.
+	Targets []string
+}
+
+// Reads the profile definitions from a config.  Relative paths are resolved
+// against baseDir.
+func readProfileFields(yc ycfg.YCfg,
+	baseDir string) map[string]map[string]string {
+
+	profiles := map[string]map[string]string{}
+
+	for name, itf := range cast.ToStringMap(yc.GetFirstVal(PROFILES_KEY, nil)) {
+		fields := cast.ToStringMapString(itf)
+		for _, k := range []string{"key", "policy"} {
+			if v := fields[k]; v != "" && baseDir != "" &&
+				!filepath.IsAbs(v) {
+
+				fields[k] = baseDir + "/" + v
+			}
+		}
+		profiles[name] = fields
+	}
+
+	return profiles
+}
+
+// Returns the fields of every defined profile, merged from project.yml and
+// newtrc.  Only a profile's key location is taken from newtrc.
+func profileFields() map[string]map[string]string {
+	profiles := map[string]map[string]string{}
+
+	if proj := project.GetProject(); proj != nil {
+		profiles = readProfileFields(proj.Config(), proj.BasePath)
+	}
+
+	for name, fields := range readProfileFields(settings.Newtrc(), "") {
+		if profiles[name] == nil {
+			profiles[name] = map[string]string{}
+		}
+		for k, v := range fields {
+			if !newtrcProfileFields[k] {
+				util.StatusMessage(util.VERBOSITY_QUIET,
+					"* Warning: ignoring \"%s\" of signing profile \"%s\" "+
+						"in newtrc; only \"key\" and \"key_env\" may be set "+
+						"there\n", k, name)
+				continue
+			}
+			profiles[name][k] = v
+		}
+	}
+
+	return profiles
+}
+
+// Returns the names of all defined profiles, sorted.
+func ProfileNames() []string {
+	names := []string{}
+	for name, _ := range profileFields() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func parseProfile(name string, fields map[string]string) (*Profile, error) {
+	p := &Profile{
+		Name:    name,
+		KeyFile: fields["key"],
+		KeyHash: strings.ToLower(fields["key_hash"]),
+		Policy:  fields["policy"],
+		Targets: strings.Fields(strings.Replace(fields["targets"], ",", " ",
+			-1)),
+	}
+
+	if env := fields["key_env"]; env != "" {
+		if v := os.Getenv(env); v != "" {
+			p.KeyFile = v
+		}
+	}
+	if p.KeyFile == "" {
+		return nil, util.FmtNewtError(
+			"signing profile \"%s\" does not specify a key (\"key\" or "+
+				"\"key_env\")", name)
+	}
+
+	if s := fields["key_id"]; s != "" {
+		id, err := strconv.ParseUint(s, 10, 8)
+		if err != nil {
+			return nil, util.FmtNewtError(
+				"signing profile \"%s\" has invalid key_id \"%s\"; must be "+
+					"between 0-255", name, s)
+		}
+		p.KeyId = uint8(id)
+	}
+
+	return p, nil
+}
+
+// Looks up a profile by name.
+func GetProfile(name string) (*Profile, error) {
+	fields := profileFields()[name]
+	if fields == nil {
+		names := ProfileNames()
+		if len(names) == 0 {
+			return nil, util.FmtNewtError(
+				"unknown signing profile \"%s\"; no profiles are defined "+
+					"(\"%s\" in project.yml or ~/.newt/repos.yml)",
+				name, PROFILES_KEY)
+		}
+		return nil, util.FmtNewtError(
+			"unknown signing profile \"%s\"; defined profiles: %s",
+			name, strings.Join(names, ", "))
+	}
+
+	return parseProfile(name, fields)
+}
+
+// Returns the name of the profile a target uses by default, or "".
+func TargetProfileName(t *target.Target) string {
+	return t.Vars["target.signing_profile"]
+}
+
+// Returns the SHA-256 (hex) of the public half of the specified private key.
+func KeyHash(keyFile string) (string, error) {
+	keyBytes, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return "", util.FmtNewtError("Error reading key file: %s",
+			err.Error())
+	}
+
+	priv, err := image.ParsePrivateKey(keyBytes)
+	if err != nil {
+		return "", err
+	}
+
+	var pub interface{}
+	switch k := priv.(type) {
+	case *rsa.PrivateKey:
+		pub = &k.PublicKey
+	case *ecdsa.PrivateKey:
+		pub = &k.PublicKey
+	default:
+		return "", util.NewNewtError("Unknown private key format")
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", util.ChildNewtError(err)
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(der)), nil
+}
+
+// Verifies that a target may be signed with the profile and that the
+// profile's key is the expected one.
+//
+// @return string               The hash of the profile's public key.
+func (p *Profile) Check(t *target.Target) (string, error) {
+	if len(p.Targets) > 0 {
+		allowed := false
+		for _, name := range p.Targets {
+			if name == t.FullName() || name == t.ShortName() {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return "", util.FmtNewtError(
+				"signing profile \"%s\" may not be used for target %s; "+
+					"allowed targets: %s",
+				p.Name, t.FullName(), strings.Join(p.Targets, ", "))
+		}
+	}
+
+	hash, err := KeyHash(p.KeyFile)
+	if err != nil {
+		return "", util.FmtNewtError("signing profile \"%s\": %s",
+			p.Name, err.Error())
+	}
+
+	if p.KeyHash != "" && p.KeyHash != hash {
+		return "", util.FmtNewtError(
+			"signing profile \"%s\" expects a different key than %s "+
+				"(key_hash: %s; actual: %s)",
+			p.Name, p.KeyFile, p.KeyHash, hash)
+	}
+
+	return hash, nil
+}
@@ -0,0 +1,491 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// A snapshot records everything needed to reproduce a target's build:
+//     * The contents of the target directory (target.yml, pkg.yml,
+//       syscfg.yml, etc.).
+//     * The hash of each installed repo.
+//     * The target's fully resolved syscfg.
+//     * The SHA256 of each image that had been built when the snapshot was
+//       taken.
+//
+// Snapshots are stored in the project's "snapshots" directory:
+//     snapshots/<name>/snapshot.yml
+//     snapshots/<name>/target/<target-files>
+
+package snapshot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"mynewt.apache.org/newt/newt/builder"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/newt/pkg"
+	"mynewt.apache.org/newt/newt/project"
+	"mynewt.apache.org/newt/newt/repo"
+	"mynewt.apache.org/newt/newt/target"
+	"mynewt.apache.org/newt/util"
+	"mynewt.apache.org/newt/yaml"
+)
+
+const SNAPSHOTS_DIR = "snapshots"
+const SNAPSHOT_FILENAME = "snapshot.yml"
+const SNAPSHOT_TARGET_DIR = "target"
+
+type Snapshot struct {
+	Name       string
+	TargetName string
+	Created    string
+
+	// [repo-name] => hash
+	Repos map[string]string
+
+	// [build-name] => sha256
+	Images map[string]string
+
+	// [setting-name] => value
+	Syscfg map[string]string
+
+	// [filename] => contents
+	Files map[string][]byte
+}
+
+func SnapshotsDir() string {
+	return project.GetProject().Path() + "/" + SNAPSHOTS_DIR
+}
+
+func SnapshotDir(name string) string {
+	return SnapshotsDir() + "/" + name
+}
+
+// Ensures the specified snapshot name refers to a directory immediately inside
+// the snapshots directory.
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." ||
+		strings.ContainsAny(name, "/\\"+string(os.PathSeparator)) {
+
+		return util.FmtNewtError("Invalid snapshot name: \"%s\"", name)
+	}
+
+	base := filepath.Clean(SnapshotsDir())
+	if filepath.Dir(filepath.Clean(filepath.Join(base, name))) != base {
+		return util.FmtNewtError("Invalid snapshot name: \"%s\"", name)
+	}
+
+	return nil
+}
+
+func snapshotFilePath(name string) string {
+	return SnapshotDir(name) + "/" + SNAPSHOT_FILENAME
+}
+
+func snapshotTargetDir(name string) string {
+	return SnapshotDir(name) + "/" + SNAPSHOT_TARGET_DIR
+}
+
+// Returns the names of all snapshots in the project, sorted alphabetically.
+func Names() ([]string, error) {
+	if util.NodeNotExist(SnapshotsDir()) {
+		return nil, nil
+	}
+
+	dirs, err := util.ChildDirs(SnapshotsDir())
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, dir := range dirs {
+		if util.NodeExist(snapshotFilePath(dir)) {
+			names = append(names, dir)
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Reads the regular files at the top level of the specified directory.
+func readFiles(dir string) (map[string][]byte, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	files := map[string][]byte{}
+	for _, info := range infos {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(dir + "/" + info.Name())
+		if err != nil {
+			return nil, util.ChildNewtError(err)
+		}
+		files[info.Name()] = data
+	}
+
+	return files, nil
+}
+
+func fileHash(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+func imageHashes(t *target.Target) map[string]string {
+	hashes := map[string]string{}
+
+	add := func(buildName string, lpkg *pkg.LocalPackage) {
+		if lpkg == nil {
+			return
+		}
+
+		path := builder.AppImgPath(t.Name(), buildName, lpkg.Name())
+		if hash, err := fileHash(path); err == nil {
+			hashes[buildName] = hash
+		}
+	}
+
+	add(builder.BUILD_NAME_APP, t.App())
+	add(builder.BUILD_NAME_LOADER, t.Loader())
+
+	return hashes
+}
+
+func repoHashes() (map[string]string, error) {
+	hashes := map[string]string{}
+
+	for _, r := range project.GetProject().Repos() {
+		if r.IsLocal() || util.NodeNotExist(r.Path()) {
+			continue
+		}
+
+		hash, err := r.CurrentHash()
+		if err != nil {
+			return nil, err
+		}
+		hashes[r.Name()] = hash
+	}
+
+	return hashes, nil
+}
+
+// Captures the current state of the specified target.
+func capture(t *target.Target, name string) (*Snapshot, error) {
+	ss := &Snapshot{
+		Name:       name,
+		TargetName: t.FullName(),
+		Created:    time.Now().Format(time.RFC3339),
+	}
+
+	var err error
+
+	ss.Files, err = readFiles(t.Package().BasePath())
+	if err != nil {
+		return nil, err
+	}
+
+	ss.Repos, err = repoHashes()
+	if err != nil {
+		return nil, err
+	}
+
+	ss.Images = imageHashes(t)
+
+	b, err := builder.NewTargetBuilder(t)
+	if err != nil {
+		return nil, err
+	}
+	res, err := b.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	ss.Syscfg = res.Cfg.SettingValues()
+
+	return ss, nil
+}
+
+func writeMap(buf *bytes.Buffer, key string, m map[string]string) {
+	if len(m) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(m))
+	for k, _ := range m {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(buf, "%s:\n", key)
+	for _, n := range names {
+		fmt.Fprintf(buf, "    %s: %s\n", n, yaml.EscapeString(m[n]))
+	}
+}
+
+func (ss *Snapshot) write() error {
+	buf := bytes.Buffer{}
+
+	fmt.Fprintf(&buf, "snapshot.target: %s\n",
+		yaml.EscapeString(ss.TargetName))
+	fmt.Fprintf(&buf, "snapshot.created: %s\n",
+		yaml.EscapeString(ss.Created))
+	writeMap(&buf, "snapshot.repos", ss.Repos)
+	writeMap(&buf, "snapshot.images", ss.Images)
+	writeMap(&buf, "snapshot.syscfg", ss.Syscfg)
+
+	dir := snapshotTargetDir(ss.Name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	for name, data := range ss.Files {
+		if err := ioutil.WriteFile(dir+"/"+name, data, 0644); err != nil {
+			return util.ChildNewtError(err)
+		}
+	}
+
+	if err := ioutil.WriteFile(snapshotFilePath(ss.Name), buf.Bytes(),
+		0644); err != nil {
+
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// Reads the named snapshot from disk.
+func Read(name string) (*Snapshot, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+
+	path := snapshotFilePath(name)
+	if util.NodeNotExist(path) {
+		return nil, util.FmtNewtError("Unknown snapshot: %s", name)
+	}
+
+	yc, err := newtutil.ReadConfigPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ss := &Snapshot{
+		Name:       name,
+		TargetName: yc.GetValString("snapshot.target", nil),
+		Created:    yc.GetValString("snapshot.created", nil),
+		Repos:      yc.GetValStringMapString("snapshot.repos", nil),
+		Images:     yc.GetValStringMapString("snapshot.images", nil),
+		Syscfg:     yc.GetValStringMapString("snapshot.syscfg", nil),
+	}
+
+	if ss.TargetName == "" {
+		return nil, util.FmtNewtError(
+			"Snapshot \"%s\" does not specify a target", name)
+	}
+
+	ss.Files, err = readFiles(snapshotTargetDir(name))
+	if err != nil {
+		return nil, err
+	}
+
+	return ss, nil
+}
+
+// Creates a new snapshot of the specified target.  If force is true, an
+// existing snapshot with the same name is replaced.
+func Create(t *target.Target, name string, force bool) (*Snapshot, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+
+	dir := SnapshotDir(name)
+	if util.NodeExist(dir) {
+		if !force {
+			return nil, util.FmtNewtError(
+				"Snapshot \"%s\" already exists; use -f to overwrite", name)
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return nil, util.ChildNewtError(err)
+		}
+	}
+
+	ss, err := capture(t, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ss.write(); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	return ss, nil
+}
+
+// Writes the snapshot's target files back to the target directory.  Files in
+// the target directory that are not part of the snapshot are left alone.  The
+// target directory is recreated if the target has since been deleted.
+func (ss *Snapshot) RestoreTarget() error {
+	proj := project.GetProject()
+
+	repoName, pkgName, err := newtutil.ParsePackageString(ss.TargetName)
+	if err != nil {
+		return err
+	}
+
+	r := proj.LocalRepo()
+	if repoName != "" {
+		r = proj.FindRepo(repoName)
+		if r == nil {
+			return util.FmtNewtError(
+				"Snapshot target \"%s\" belongs to unknown repo", ss.TargetName)
+		}
+	}
+
+	dir := r.Path() + "/" + pkgName
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return util.ChildNewtError(err)
+	}
+
+	for name, data := range ss.Files {
+		if err := ioutil.WriteFile(dir+"/"+name, data, 0644); err != nil {
+			return util.ChildNewtError(err)
+		}
+	}
+
+	return nil
+}
+
+// Checks out the commit that each repo was at when the snapshot was taken.
+func (ss *Snapshot) RestoreRepos() error {
+	proj := project.GetProject()
+
+	names := make([]string, 0, len(ss.Repos))
+	for n, _ := range ss.Repos {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		r := proj.FindRepo(n)
+		if r == nil {
+			return util.FmtNewtError(
+				"Snapshot refers to unknown repo \"%s\"", n)
+		}
+
+		if err := restoreRepo(r, ss.Repos[n]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func restoreRepo(r *repo.Repo, hash string) error {
+	cur, err := r.CurrentHash()
+	if err == nil && cur == hash {
+		return nil
+	}
+
+	util.StatusMessage(util.VERBOSITY_DEFAULT,
+		"Restoring repo \"%s\" to %s\n", r.Name(), hash)
+
+	return r.Install(newtutil.RepoVersion{Commit: hash})
+}
+
+func diffMaps(category string, old map[string]string,
+	cur map[string]string) []string {
+
+	keys := map[string]struct{}{}
+	for k, _ := range old {
+		keys[k] = struct{}{}
+	}
+	for k, _ := range cur {
+		keys[k] = struct{}{}
+	}
+
+	names := make([]string, 0, len(keys))
+	for k, _ := range keys {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, n := range names {
+		o, inOld := old[n]
+		c, inCur := cur[n]
+
+		if !inOld {
+			lines = append(lines,
+				fmt.Sprintf("%s: %s: (none) --> %s", category, n, c))
+		} else if !inCur {
+			lines = append(lines,
+				fmt.Sprintf("%s: %s: %s --> (none)", category, n, o))
+		} else if o != c {
+			lines = append(lines,
+				fmt.Sprintf("%s: %s: %s --> %s", category, n, o, c))
+		}
+	}
+
+	return lines
+}
+
+func diffFiles(old map[string][]byte, cur map[string][]byte) []string {
+	oldHashes := make(map[string]string, len(old))
+	for n, data := range old {
+		oldHashes[n] = fmt.Sprintf("%x", sha256.Sum256(data))[:12]
+	}
+
+	curHashes := make(map[string]string, len(cur))
+	for n, data := range cur {
+		curHashes[n] = fmt.Sprintf("%x", sha256.Sum256(data))[:12]
+	}
+
+	return diffMaps("file", oldHashes, curHashes)
+}
+
+// Compares the snapshot against the current state of its target.  Each
+// element of the returned slice describes a single difference.
+func (ss *Snapshot) Diff(t *target.Target) ([]string, error) {
+	cur, err := capture(t, ss.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	lines = append(lines, diffFiles(ss.Files, cur.Files)...)
+	lines = append(lines, diffMaps("repo", ss.Repos, cur.Repos)...)
+	lines = append(lines, diffMaps("syscfg", ss.Syscfg, cur.Syscfg)...)
+	lines = append(lines, diffMaps("image", ss.Images, cur.Images)...)
+
+	return lines, nil
+}
@@ -0,0 +1,153 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Migration rewrites a set of syscfg overrides such that they refer to
+// current setting names.  A setting definition indicates that it has been
+// renamed with the following fields:
+//
+//     syscfg.defs:
+//         OLD_NAME:
+//             description: 'Use NEW_NAME instead.'
+//             value: 0
+//             deprecated: 1       # or defunct: 1
+//             replacement: NEW_NAME
+//
+// Overrides of a renamed setting are moved to its replacement.  Overrides
+// that cannot be migrated automatically are reported to the user.
+
+package syscfg
+
+import (
+	"fmt"
+	"sort"
+)
+
+type CfgMigration struct {
+	OldName string
+	NewName string
+	Value   string
+}
+
+type CfgMigrationResult struct {
+	// The migrated set of overrides.
+	Vals map[string]string
+
+	// Overrides that were renamed.
+	Migrations []CfgMigration
+
+	// Overrides that require manual attention.
+	Problems []string
+}
+
+// Follows a chain of replacements starting at the specified setting.  Returns
+// the name of the first supported setting in the chain, or "" if the chain
+// ends in an unsupported setting or loops back on itself.
+func (cfg *Cfg) finalReplacement(name string) string {
+	seen := map[string]struct{}{}
+
+	for {
+		if _, ok := seen[name]; ok {
+			return ""
+		}
+		seen[name] = struct{}{}
+
+		entry, ok := cfg.Settings[name]
+		if !ok {
+			return ""
+		}
+		if entry.State == CFG_SETTING_STATE_GOOD {
+			return name
+		}
+		if entry.Replacement == "" {
+			return ""
+		}
+
+		name = entry.Replacement
+	}
+}
+
+// Migrates the specified set of overrides (typically a target's
+// "syscfg.vals") to the current setting names.
+func (cfg *Cfg) MigrateVals(vals map[string]string) CfgMigrationResult {
+	res := CfgMigrationResult{
+		Vals: make(map[string]string, len(vals)),
+	}
+
+	names := make([]string, 0, len(vals))
+	for k, _ := range vals {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	// Overrides of supported settings carry over unchanged.  These take
+	// precedence over any migrated overrides.
+	var renamed []string
+	for _, name := range names {
+		entry, ok := cfg.Settings[name]
+		if !ok {
+			res.Vals[name] = vals[name]
+			res.Problems = append(res.Problems,
+				fmt.Sprintf("%s: setting is not defined", name))
+		} else if entry.State == CFG_SETTING_STATE_GOOD {
+			res.Vals[name] = vals[name]
+		} else {
+			renamed = append(renamed, name)
+		}
+	}
+
+	for _, name := range renamed {
+		val := vals[name]
+		entry := cfg.Settings[name]
+
+		newName := cfg.finalReplacement(name)
+		if newName == "" {
+			res.Vals[name] = val
+			if entry.State == CFG_SETTING_STATE_DEFUNCT {
+				res.Problems = append(res.Problems,
+					fmt.Sprintf("%s: setting is defunct and has no "+
+						"replacement", name))
+			} else {
+				res.Problems = append(res.Problems,
+					fmt.Sprintf("%s: setting is deprecated and has no "+
+						"replacement", name))
+			}
+			continue
+		}
+
+		if oldVal, ok := res.Vals[newName]; ok {
+			// Keep the original override; the user needs to decide which
+			// value is correct.
+			res.Vals[name] = val
+			res.Problems = append(res.Problems,
+				fmt.Sprintf("%s: replacement %s is already overridden "+
+					"(%s=%s, %s=%s)", name, newName, name, val, newName,
+					oldVal))
+			continue
+		}
+
+		res.Vals[newName] = val
+		res.Migrations = append(res.Migrations, CfgMigration{
+			OldName: name,
+			NewName: newName,
+			Value:   val,
+		})
+	}
+
+	return res
+}
@@ -43,6 +43,10 @@ import (
 
 const HEADER_PATH = "syscfg/syscfg.h"
 
+// Version of the generated header's format.  Increment this whenever a newt
+// change alters the header's contents for the same configuration.
+const FORMAT_VERSION = 1
+
 const SYSCFG_PREFIX_SETTING = "MYNEWT_VAL_"
 
 type CfgSettingType int
@@ -65,6 +69,14 @@ var cfgSettingNameTypeMap = map[string]CfgSettingType{
 	"flash_owner":   CFG_SETTING_TYPE_FLASH_OWNER,
 }
 
+type CfgSettingState int
+
+const (
+	CFG_SETTING_STATE_GOOD CfgSettingState = iota
+	CFG_SETTING_STATE_DEPRECATED
+	CFG_SETTING_STATE_DEFUNCT
+)
+
 type CfgPoint struct {
 	Value  string
 	Source *pkg.LocalPackage
@@ -78,6 +90,12 @@ type CfgEntry struct {
 	Restrictions []CfgRestriction
 	PackageDef   *pkg.LocalPackage
 	History      []CfgPoint
+
+	// Indicates whether the setting is still supported.  Deprecated and
+	// defunct settings can specify the name of the setting that supersedes
+	// them.
+	State       CfgSettingState
+	Replacement string
 }
 
 type CfgPriority struct {
@@ -127,6 +145,13 @@ type Cfg struct {
 	// Multiple packages defining the same setting.
 	// [setting-name][defining-package][{}]
 	Redefines map[string]map[*pkg.LocalPackage]struct{}
+
+	// Overrides of defunct settings.
+	Defunct map[string][]CfgPoint
+
+	//// Warnings
+	// Overrides of deprecated settings.
+	Deprecated map[string][]CfgPoint
 }
 
 func NewCfg() Cfg {
@@ -140,6 +165,8 @@ func NewCfg() Cfg {
 		PriorityViolations:  []CfgPriority{},
 		FlashConflicts:      []CfgFlashConflict{},
 		Redefines:           map[string]map[*pkg.LocalPackage]struct{}{},
+		Defunct:             map[string][]CfgPoint{},
+		Deprecated:          map[string][]CfgPoint{},
 	}
 }
 
@@ -357,6 +384,18 @@ func readSetting(name string, lpkg *pkg.LocalPackage,
 	}
 	entry.appendValue(lpkg, entry.Value)
 
+	if cast.ToBool(vals["defunct"]) {
+		entry.State = CFG_SETTING_STATE_DEFUNCT
+	} else if cast.ToBool(vals["deprecated"]) {
+		entry.State = CFG_SETTING_STATE_DEPRECATED
+	}
+	entry.Replacement = stringValue(vals["replacement"])
+	if entry.Replacement != "" && entry.State == CFG_SETTING_STATE_GOOD {
+		return entry, util.FmtNewtError(
+			"setting %s specifies a replacement but is not deprecated "+
+				"or defunct", name)
+	}
+
 	entry.Restrictions = []CfgRestriction{}
 	restrictionStrings := cast.ToStringSlice(vals["restrictions"])
 	for _, rstring := range restrictionStrings {
@@ -482,6 +521,33 @@ func (cfg *Cfg) readValsOnce(lpkg *pkg.LocalPackage,
 	return nil
 }
 
+// Detects all overrides of deprecated and defunct settings and records them
+// internally.
+func (cfg *Cfg) detectUnsupportedOverrides() {
+	for name, entry := range cfg.Settings {
+		if len(entry.History) <= 1 {
+			continue
+		}
+
+		switch entry.State {
+		case CFG_SETTING_STATE_DEPRECATED:
+			cfg.Deprecated[name] = entry.History
+		case CFG_SETTING_STATE_DEFUNCT:
+			cfg.Defunct[name] = entry.History
+		}
+	}
+}
+
+// Describes a setting's replacement for inclusion in a warning or error
+// message.
+func (entry *CfgEntry) replacementText() string {
+	if entry.Replacement == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(" (use %s instead)", entry.Replacement)
+}
+
 func (cfg *Cfg) Log() {
 	keys := make([]string, len(cfg.Settings))
 	i := 0
@@ -787,6 +853,22 @@ func (cfg *Cfg) ErrorText() string {
 		}
 	}
 
+	// Defunct setting errors.
+	if len(cfg.Defunct) > 0 {
+		settingNames := make([]string, 0, len(cfg.Defunct))
+		for k, _ := range cfg.Defunct {
+			settingNames = append(settingNames, k)
+		}
+		sort.Strings(settingNames)
+
+		str += "Override of defunct settings:\n"
+		for _, name := range settingNames {
+			entry := cfg.Settings[name]
+			historyMap[name] = entry.History
+			str += fmt.Sprintf("    %s%s\n", name, entry.replacementText())
+		}
+	}
+
 	if len(cfg.FlashConflicts) > 0 {
 		str += "Flash errors detected:\n"
 		for _, conflict := range cfg.FlashConflicts {
@@ -827,6 +909,24 @@ func (cfg *Cfg) WarningText() string {
 		}
 	}
 
+	if len(cfg.Deprecated) > 0 {
+		settingNames := make([]string, 0, len(cfg.Deprecated))
+		for k, _ := range cfg.Deprecated {
+			settingNames = append(settingNames, k)
+		}
+		sort.Strings(settingNames)
+
+		if str != "" {
+			str += "\n"
+		}
+		str += "Use of deprecated settings:"
+		for _, n := range settingNames {
+			entry := cfg.Settings[n]
+			historyMap[n] = entry.History
+			str += fmt.Sprintf("\n    %s%s", n, entry.replacementText())
+		}
+	}
+
 	if len(historyMap) > 0 {
 		str += "\n" + historyText(historyMap)
 	}
@@ -971,6 +1071,7 @@ func Read(lpkgs []*pkg.LocalPackage, apis []string,
 	}
 
 	cfg.detectAmbiguities()
+	cfg.detectUnsupportedOverrides()
 	cfg.detectViolations()
 	cfg.detectPriorityViolations()
 	cfg.detectFlashConflicts(flashMap)
@@ -36,6 +36,10 @@ import (
 	"mynewt.apache.org/newt/util"
 )
 
+// Version of the generated source file's format.  Increment this whenever a
+// newt change alters the file's contents for the same set of packages.
+const FORMAT_VERSION = 1
+
 type initFunc struct {
 	stage int
 	name  string
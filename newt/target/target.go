@@ -27,6 +27,8 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/spf13/cast"
+
 	"mynewt.apache.org/newt/newt/newtutil"
 	"mynewt.apache.org/newt/newt/pkg"
 	"mynewt.apache.org/newt/newt/project"
@@ -39,6 +41,12 @@ const TARGET_FILENAME string = "target.yml"
 const DEFAULT_BUILD_PROFILE string = "default"
 const DEFAULT_HEADER_SIZE uint32 = 0x20
 
+// Pins repos to versions for this target only; a map of repo name to version.
+// Each entry can also be specified as its own key, e.g.,
+// "target.repos.apache-mynewt-core: 1.9.0".
+const TARGET_REPOS_KEY = "target.repos"
+const TARGET_REPOS_PREFIX = TARGET_REPOS_KEY + "."
+
 var globalTargetMap map[string]*Target
 
 type Target struct {
@@ -51,6 +59,24 @@ type Target struct {
 	HeaderSize   uint32
 	KeyFile      string
 
+	// Whether manufacturing images mark this target's image as confirmed so
+	// that it does not need to be confirmed on the device's first boot.
+	ImageConfirm bool
+
+	// Whether compiler invocations are routed through ccache
+	// (target.ccache); nil if the target defers to the newtrc's
+	// "build.ccache" setting.
+	Ccache *bool
+
+	// The compiler launcher chain (target.launcher), e.g., "distcc";
+	// overrides the newtrc's "build.launcher" setting.  "none" compiles
+	// locally.
+	Launcher string
+
+	// Repos this target pins to a version other than the project's
+	// (target.repos); repo name => version string.
+	RepoVersions map[string]string
+
 	// target.yml configuration structure
 	Vars map[string]string
 }
@@ -84,7 +110,14 @@ func (target *Target) Load(basePkg *pkg.LocalPackage) error {
 	target.Vars = map[string]string{}
 
 	for k, v := range yc.AllSettings() {
-		target.Vars[k] = fmt.Sprintf("%v", v)
+		if k == TARGET_REPOS_KEY {
+			// Flatten the map so that the target can be saved.
+			for rk, rv := range cast.ToStringMapString(v) {
+				target.Vars[TARGET_REPOS_KEY+"."+rk] = rv
+			}
+		} else {
+			target.Vars[k] = fmt.Sprintf("%v", v)
+		}
 	}
 
 	target.BspName = target.Vars["target.bsp"]
@@ -106,6 +139,25 @@ func (target *Target) Load(basePkg *pkg.LocalPackage) error {
 
 	target.KeyFile = target.Vars["target.key_file"]
 
+	target.ImageConfirm, _ = strconv.ParseBool(
+		target.Vars["target.image_confirm"])
+
+	target.Ccache = nil
+	if ccache, err := strconv.ParseBool(
+		target.Vars["target.ccache"]); err == nil {
+
+		target.Ccache = &ccache
+	}
+
+	target.Launcher = target.Vars["target.launcher"]
+
+	target.RepoVersions = map[string]string{}
+	for k, v := range target.Vars {
+		if strings.HasPrefix(k, TARGET_REPOS_PREFIX) {
+			target.RepoVersions[strings.TrimPrefix(k, TARGET_REPOS_PREFIX)] = v
+		}
+	}
+
 	// Note: App not required in the case of unit tests.
 
 	// Remember the name of the configuration file so that it can be specified
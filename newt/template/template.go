@@ -0,0 +1,476 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// template: Instantiates new projects from template repositories.
+//
+// A template is a project skeleton: a git repo or directory whose contents
+// are copied into the new project.  If the template contains a
+// "template.yml" file, file contents and paths are treated as templates:
+// each occurrence of "{{name}}" is replaced with the value of the variable
+// "name".  Only defined variables are replaced; other text containing braces
+// is left alone.  The file itself is not copied.  Example:
+//
+//     template.description: "Acme BLE sensor project"
+//     template.vars:
+//         bsp:
+//             description: "BSP package for the initial target"
+//             default: "@apache-mynewt-core/hw/bsp/nordic_pca10056"
+//         app_name:
+//             default: "{{project_name}}_app"
+//         company:
+//             description: "Copyright holder"
+//     template.exclude:
+//         - "docs/internal"
+//
+// The "project_name", "bsp", and "app_name" variables are always defined; a
+// variable without a default must be given a value when the template is
+// instantiated.  A default may refer to project_name and to any variable
+// given a value on the command line.
+package template
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cast"
+
+	"mynewt.apache.org/newt/newt/downloader"
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+)
+
+const TEMPLATE_FILENAME = "template.yml"
+
+// The template used when none is specified.
+const DEFAULT_TEMPLATE = "apache/mynewt-blinky"
+
+// Variables that are defined by every template.
+const (
+	VAR_PROJECT_NAME = "project_name"
+	VAR_BSP          = "bsp"
+	VAR_APP_NAME     = "app_name"
+)
+
+var varRefRe = regexp.MustCompile(`\{\{([A-Za-z_][A-Za-z0-9_]*)\}\}`)
+
+// A variable declared in "template.yml".
+type Var struct {
+	Name        string
+	Description string
+	Dflt        string
+	HasDflt     bool
+}
+
+type Template struct {
+	// The template specifier that the template was downloaded from.
+	Spec string
+
+	// The directory containing the downloaded template.
+	Path string
+
+	// Whether the template contains a "template.yml" file.  Substitution is
+	// only performed if it does.
+	HasConfig bool
+
+	Description string
+	Vars        map[string]*Var
+
+	// Paths, relative to the template root, that are not copied.
+	Exclude []string
+}
+
+// Splits a template specifier of the form "<source>[#<ref>]".
+func splitSpec(spec string) (string, string) {
+	if idx := strings.LastIndex(spec, "#"); idx > 0 {
+		return spec[:idx], spec[idx+1:]
+	}
+
+	return spec, ""
+}
+
+// Creates a downloader for the specified template source: a git URL, a local
+// directory, or a GitHub repo given as "<user>/<repo>".  A nil downloader
+// indicates a local directory that is used as is.
+func sourceDownloader(src string) (downloader.Downloader, error) {
+	if strings.Contains(src, "://") || strings.HasPrefix(src, "git@") ||
+		strings.HasSuffix(src, ".git") {
+
+		dl := downloader.NewGitDownloader()
+		dl.Url = src
+		return dl, nil
+	}
+
+	if util.NodeExist(src) {
+		return nil, nil
+	}
+
+	parts := strings.Split(src, "/")
+	if len(parts) == 2 && parts[0] != "" && parts[1] != "" {
+		dl := downloader.NewGithubDownloader()
+		dl.User = parts[0]
+		dl.Repo = parts[1]
+		return dl, nil
+	}
+
+	return nil, util.FmtNewtError(
+		"invalid template \"%s\"; specify a git URL, a directory, or a "+
+			"GitHub repo (<user>/<repo>)", src)
+}
+
+// Downloads the specified template to a temporary directory.  The caller is
+// responsible for removing the returned template's directory.
+//
+// @param spec                  The template: "<source>[#<ref>]", where
+//                                  source is a git URL, a local directory,
+//                                  or a GitHub repo ("<user>/<repo>"), and
+//                                  ref is the branch, tag, or commit to use
+//                                  (default: the main branch).
+func Download(spec string) (*Template, error) {
+	src, ref := splitSpec(spec)
+
+	dl, err := sourceDownloader(src)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpdir, err := newtutil.MakeTempRepoDir()
+	if err != nil {
+		return nil, err
+	}
+
+	if dl == nil {
+		if ref != "" {
+			os.RemoveAll(tmpdir)
+			return nil, util.FmtNewtError(
+				"a ref (#%s) cannot be used with a template directory", ref)
+		}
+		err = util.CopyDir(src, tmpdir)
+	} else {
+		if ref == "" {
+			if src == DEFAULT_TEMPLATE {
+				ref = newtutil.NewtBlinkyTag
+			} else {
+				ref = dl.MainBranch()
+			}
+		}
+		err = dl.DownloadRepo(ref, tmpdir)
+	}
+	if err != nil {
+		os.RemoveAll(tmpdir)
+		return nil, err
+	}
+
+	os.RemoveAll(tmpdir + "/.git")
+
+	t := &Template{
+		Spec: spec,
+		Path: tmpdir,
+	}
+	if err := t.readConfig(); err != nil {
+		os.RemoveAll(tmpdir)
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (t *Template) readConfig() error {
+	t.Vars = map[string]*Var{}
+	for _, name := range []string{VAR_PROJECT_NAME, VAR_BSP, VAR_APP_NAME} {
+		t.Vars[name] = &Var{Name: name}
+	}
+
+	path := t.Path + "/" + TEMPLATE_FILENAME
+	if util.NodeNotExist(path) {
+		return nil
+	}
+	t.HasConfig = true
+
+	yc, err := newtutil.ReadConfigPath(path)
+	if err != nil {
+		return err
+	}
+
+	t.Description = yc.GetValString("template.description", nil)
+	t.Exclude = yc.GetValStringSlice("template.exclude", nil)
+
+	for name, v := range yc.GetValStringMap("template.vars", nil) {
+		if !varRefRe.MatchString("{{" + name + "}}") {
+			return util.FmtNewtError(
+				"%s: invalid variable name \"%s\"", TEMPLATE_FILENAME, name)
+		}
+
+		fields, err := cast.ToStringMapE(v)
+		if err != nil {
+			return util.FmtNewtError(
+				"%s: variable \"%s\" must be a map", TEMPLATE_FILENAME, name)
+		}
+
+		tv := &Var{
+			Name:        name,
+			Description: cast.ToString(fields["description"]),
+		}
+		if dflt, ok := fields["default"]; ok {
+			tv.Dflt = cast.ToString(dflt)
+			tv.HasDflt = true
+		}
+		t.Vars[name] = tv
+	}
+
+	return nil
+}
+
+// Returns the template's variables, sorted by name.
+func (t *Template) SortedVars() []*Var {
+	names := make([]string, 0, len(t.Vars))
+	for name, _ := range t.Vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	vars := make([]*Var, len(names))
+	for i, name := range names {
+		vars[i] = t.Vars[name]
+	}
+
+	return vars
+}
+
+// Replaces each reference to a defined variable in the specified string.
+func substitute(s string, vals map[string]string) string {
+	return varRefRe.ReplaceAllStringFunc(s, func(ref string) string {
+		name := ref[2 : len(ref)-2]
+		if val, ok := vals[name]; ok {
+			return val
+		}
+		return ref
+	})
+}
+
+// Returns the set of variables referenced by the template's file contents and
+// paths.
+func (t *Template) references() (map[string]struct{}, error) {
+	refs := map[string]struct{}{}
+	add := func(s string) {
+		for _, m := range varRefRe.FindAllStringSubmatch(s, -1) {
+			refs[m[1]] = struct{}{}
+		}
+	}
+
+	err := t.walk(func(rel string, path string, info os.FileInfo) error {
+		add(rel)
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.IndexByte(b, 0) < 0 {
+			add(string(b))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	return refs, nil
+}
+
+// Determines the value of each template variable.  Values specified by the
+// user take precedence over defaults.  An error is returned if a referenced
+// variable has no value, or if the user specifies a variable that the
+// template doesn't define.
+func (t *Template) resolveVars(given map[string]string,
+	refs map[string]struct{}) (map[string]string, error) {
+
+	vals := map[string]string{}
+	for name, val := range given {
+		if _, ok := t.Vars[name]; !ok {
+			return nil, util.FmtNewtError(
+				"template %s does not define variable \"%s\"", t.Spec, name)
+		}
+		vals[name] = val
+	}
+
+	missing := []string{}
+	for _, v := range t.SortedVars() {
+		if _, ok := vals[v.Name]; ok {
+			continue
+		}
+
+		if v.HasDflt {
+			vals[v.Name] = substitute(v.Dflt, given)
+		} else if _, ok := refs[v.Name]; ok {
+			missing = append(missing, varString(v))
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, util.FmtNewtError(
+			"template %s requires values for the following variables "+
+				"(specify with --var <name>=<value>):\n%s",
+			t.Spec, strings.Join(missing, "\n"))
+	}
+
+	return vals, nil
+}
+
+func (t *Template) excluded(relPath string) bool {
+	for _, ex := range t.Exclude {
+		ex = strings.Trim(ex, "/")
+		if relPath == ex || strings.HasPrefix(relPath, ex+"/") {
+			return true
+		}
+		if ok, _ := filepath.Match(ex, relPath); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Copies the template to the specified directory, substituting variables in
+// file contents and paths.
+//
+// @param dstDir                The new project's directory; must not exist.
+// @param given                 Variable values specified by the user.
+//                                  project_name defaults to the base name of
+//                                  the destination directory.
+func (t *Template) Instantiate(dstDir string,
+	given map[string]string) error {
+
+	if util.NodeExist(dstDir) {
+		return util.FmtNewtError(
+			"Cannot create new project, directory %s already exists", dstDir)
+	}
+
+	if !t.HasConfig {
+		if len(given) > 0 {
+			return util.FmtNewtError(
+				"template %s does not contain a %s file; it takes no "+
+					"variables", t.Spec, TEMPLATE_FILENAME)
+		}
+		return util.CopyDir(t.Path, dstDir)
+	}
+
+	withName := map[string]string{
+		VAR_PROJECT_NAME: filepath.Base(dstDir),
+	}
+	for k, v := range given {
+		withName[k] = v
+	}
+
+	refs, err := t.references()
+	if err != nil {
+		return err
+	}
+	vals, err := t.resolveVars(withName, refs)
+	if err != nil {
+		return err
+	}
+
+	err = t.walk(func(rel string, path string, info os.FileInfo) error {
+		dst := dstDir
+		if rel != "." {
+			// A substituted path must not leave the new project.
+			subRel, err := newtutil.CleanRelPath(substitute(rel, vals))
+			if err != nil || subRel == "." {
+				return util.FmtNewtError(
+					"template path \"%s\" becomes \"%s\", which is not "+
+						"within the project", rel, substitute(rel, vals))
+			}
+			dst += "/" + subRel
+		}
+
+		if info.IsDir() {
+			return os.MkdirAll(dst, info.Mode().Perm()|0700)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		// Binary files are copied verbatim.
+		if bytes.IndexByte(b, 0) < 0 {
+			b = []byte(substitute(string(b), vals))
+		}
+
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(dst, b, info.Mode().Perm())
+	})
+	if err != nil {
+		os.RemoveAll(dstDir)
+		return util.ChildNewtError(err)
+	}
+
+	return nil
+}
+
+// Visits every file and directory in the template that gets copied.  The
+// callback receives each entry's slash-separated path relative to the
+// template root, and its full path.
+func (t *Template) walk(
+	fn func(rel string, path string, info os.FileInfo) error) error {
+
+	return filepath.Walk(t.Path, func(path string, info os.FileInfo,
+		err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(t.Path, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if rel == TEMPLATE_FILENAME || t.excluded(rel) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		return fn(rel, path, info)
+	})
+}
+
+func varString(v *Var) string {
+	s := "    " + v.Name
+	if v.Description != "" {
+		s += ": " + v.Description
+	}
+
+	return s
+}
@@ -0,0 +1,138 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// ccache support.  When ccache is one of a build's compiler launchers (see
+// launcher.go), rebuilding unchanged sources (e.g., after `newt clean` or a
+// branch switch) is served from the ccache cache.
+
+package toolchain
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Sloppiness options newt requires.  Newt generates headers (syscfg.h,
+// sysflash.h, etc.) immediately before compiling; without these options,
+// ccache refuses to use its direct mode for any file that includes a header
+// modified during the current second, which is every file after a clean.
+var ccacheSloppiness = []string{
+	"include_file_ctime",
+	"include_file_mtime",
+}
+
+type Ccache struct {
+	// The ccache executable.
+	Path string
+
+	// Additional environment for each ccache invocation.
+	Env []string
+}
+
+type CcacheStats struct {
+	Hits   int
+	Misses int
+}
+
+// Creates a ccache wrapper for compiler invocations.
+//
+// @param path                  The ccache executable.
+// @param baseDir               The project base directory.  Absolute paths
+//                                  within this directory are rewritten to
+//                                  relative ones before hashing so that
+//                                  separate checkouts of a project share
+//                                  cache entries.
+func NewCcache(path string, baseDir string) *Ccache {
+	sloppiness := append([]string{}, ccacheSloppiness...)
+	seen := map[string]bool{}
+	for _, s := range sloppiness {
+		seen[s] = true
+	}
+
+	// Setting CCACHE_SLOPPINESS overrides ccache's configuration file rather
+	// than adding to it; retain whatever the user has configured.
+	cur := os.Getenv("CCACHE_SLOPPINESS")
+	if cur == "" {
+		o, err := util.ShellCommandLimitDbgOutput(
+			[]string{path, "--get-config", "sloppiness"}, nil, false, -1)
+		if err == nil {
+			cur = strings.TrimSpace(string(o))
+		}
+	}
+	for _, s := range strings.Split(cur, ",") {
+		s = strings.TrimSpace(s)
+		if s != "" && !seen[s] {
+			sloppiness = append(sloppiness, s)
+			seen[s] = true
+		}
+	}
+
+	env := []string{"CCACHE_SLOPPINESS=" + strings.Join(sloppiness, ",")}
+	if os.Getenv("CCACHE_BASEDIR") == "" {
+		env = append(env, "CCACHE_BASEDIR="+baseDir)
+	}
+
+	return &Ccache{
+		Path: path,
+		Env:  env,
+	}
+}
+
+// Reads ccache's cumulative statistics.  Requires ccache 3.7 or later.
+func (cc *Ccache) Stats() (CcacheStats, error) {
+	stats := CcacheStats{}
+
+	o, err := util.ShellCommandLimitDbgOutput(
+		[]string{cc.Path, "--print-stats"}, cc.Env, false, -1)
+	if err != nil {
+		return stats, err
+	}
+
+	for _, line := range strings.Split(string(o), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+
+		n, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+
+		switch fields[0] {
+		case "direct_cache_hit", "preprocessed_cache_hit":
+			stats.Hits += n
+		case "cache_miss":
+			stats.Misses += n
+		}
+	}
+
+	return stats, nil
+}
+
+// Calculates the statistics accumulated since an earlier snapshot.
+func (s CcacheStats) Since(prev CcacheStats) CcacheStats {
+	return CcacheStats{
+		Hits:   s.Hits - prev.Hits,
+		Misses: s.Misses - prev.Misses,
+	}
+}
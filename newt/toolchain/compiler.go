@@ -60,10 +60,12 @@ type CompilerInfo struct {
 	IgnoreDirs  []*regexp.Regexp
 }
 
+// An entry in a clang compilation database (compile_commands.json).
 type CompileCommand struct {
-	Directory string `json:"directory"`
-	Command   string `json:"command"`
-	File      string `json:"file"`
+	Directory string   `json:"directory"`
+	Arguments []string `json:"arguments"`
+	File      string   `json:"file"`
+	Output    string   `json:"output,omitempty"`
 }
 
 type Compiler struct {
@@ -71,7 +73,8 @@ type Compiler struct {
 	LinkerScripts []string
 
 	// Needs to be locked whenever a mutable field in this struct is accessed
-	// during a build.  Currently, objPathList is the only such member.
+	// during a build.  Currently, objPathList, compileCommands, and
+	// depsGenerated are the only such members.
 	mutex *sync.Mutex
 
 	depTracker            DepTracker
@@ -85,6 +88,7 @@ type Compiler struct {
 	ldResolveCircularDeps bool
 	ldMapFile             bool
 	ldBinFile             bool
+	rspFiles              bool
 	baseDir               string
 	srcDir                string
 	dstDir                string
@@ -104,12 +108,42 @@ type Compiler struct {
 	compileCommands []CompileCommand
 
 	extraDeps []string
+
+	// Wraps compiler invocations; nil if compiling locally.
+	launcher *Launcher
+
+	// The shared object cache directory; "" if the cache is disabled.
+	objCacheDir string
+
+	// Source files whose dependency files were generated during this run.
+	depsGenerated map[string]bool
+
+	// Memory placement: the allocated sections of an object file get
+	// prefixed with the section name mapped to its source file (e.g.,
+	// ".placement_itcm"), so that the linker can place them in an alternate
+	// memory region.  Keys are slash-separated absolute source paths; the
+	// key "" applies to every source file.
+	SectionPrefixes map[string]string
 }
 
 func (c *Compiler) GetCompileCommands() []CompileCommand {
 	return c.compileCommands
 }
 
+// Records the command used to build the specified source file in the
+// compilation database.
+func (c *Compiler) addCompileCommand(file string, cmd []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.compileCommands = append(c.compileCommands,
+		CompileCommand{
+			Arguments: cmd,
+			File:      file,
+			Output:    c.dstFilePath(file) + ".o",
+		})
+}
+
 func (c *Compiler) GetCcPath() string {
 	return c.ccPath
 }
@@ -235,6 +269,7 @@ func NewCompiler(compilerDir string, dstDir string,
 		dstDir:          dstDir,
 		extraDeps:       []string{},
 		compileCommands: []CompileCommand{},
+		depsGenerated:   map[string]bool{},
 	}
 
 	c.depTracker = NewDepTracker(c)
@@ -294,6 +329,10 @@ func (c *Compiler) load(compilerDir string, buildProfile string) error {
 	c.ldMapFile = yc.GetValBool("compiler.ld.mapfile", settings)
 	c.ldBinFile = yc.GetValBoolDflt("compiler.ld.binfile", settings, true)
 
+	// Long command lines are passed via response files unless the compiler
+	// doesn't support them.
+	c.rspFiles = yc.GetValBoolDflt("compiler.response_files", settings, true)
+
 	if len(c.lclInfo.Cflags) == 0 {
 		// Assume no Cflags implies an unsupported build profile.
 		return util.FmtNewtError("Compiler doesn't support build profile "+
@@ -326,17 +365,25 @@ func (c *Compiler) AddDeps(depFilenames ...string) {
 // date, so no compilation is necessary.  The name of the object file should
 // still be remembered so that it gets linked in to the final library or
 // executable.
-func (c *Compiler) SkipSourceFile(srcFile string) error {
+func (c *Compiler) SkipSourceFile(srcFile string, compilerType int) error {
 	objPath := c.dstFilePath(srcFile) + ".o"
 
 	c.mutex.Lock()
 	c.objPathList[filepath.ToSlash(objPath)] = true
 	c.mutex.Unlock()
 
+	// The file still belongs in the compilation database; its command is
+	// unchanged, or it wouldn't have been skipped.
+	cmd, err := c.CompileFileCmd(srcFile, compilerType)
+	if err != nil {
+		return err
+	}
+	c.addCompileCommand(srcFile, cmd)
+
 	// Update the dependency tracker with the object file's modification time.
 	// This is necessary later for determining if the library / executable
 	// needs to be rebuilt.
-	err := c.depTracker.ProcessFileTime(objPath)
+	err = c.depTracker.ProcessFileTime(objPath)
 	if err != nil {
 		return err
 	}
@@ -351,20 +398,47 @@ func (c *Compiler) includesStrings() []string {
 		return nil
 	}
 
-	includes := util.SortFields(c.info.Includes...)
+	// Normalize the paths before removing duplicates; many packages refer
+	// to the same directory by different paths.
+	includes := make([]string, 0, len(c.info.Includes))
+	for _, s := range util.SortFields(c.info.Includes...) {
+		s = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(s)), c.baseDir+"/")
+		includes = append(includes, s)
+	}
+	includes = util.SortFields(includes...)
 
 	tokens := make([]string, len(includes))
 	for i, s := range includes {
-		s = strings.TrimPrefix(filepath.ToSlash(filepath.Clean(s)), c.baseDir+"/")
 		tokens[i] = "-I" + s
 	}
 
 	return tokens
 }
 
+// Removes redundant macro definitions.  "-DFOO" is equivalent to "-DFOO=1",
+// so the shorter form is dropped when both are present.
+func dedupDefines(flags []string) []string {
+	present := make(map[string]bool, len(flags))
+	for _, f := range flags {
+		present[f] = true
+	}
+
+	result := make([]string, 0, len(flags))
+	for _, f := range flags {
+		if strings.HasPrefix(f, "-D") && !strings.Contains(f, "=") &&
+			present[f+"=1"] {
+
+			continue
+		}
+		result = append(result, f)
+	}
+
+	return result
+}
+
 func (c *Compiler) cflagsStrings() []string {
 	cflags := util.SortFields(c.info.Cflags...)
-	return cflags
+	return dedupDefines(cflags)
 }
 
 func (c *Compiler) aflagsStrings() []string {
@@ -389,17 +463,22 @@ func (c *Compiler) dstFilePath(srcPath string) string {
 	return dstPath
 }
 
-// Calculates the command-line invocation necessary to compile the specified C
-// or assembly file.
+// Returns the path of the Makefile dependency file that compiling the
+// specified source file produces.
+func (c *Compiler) DepFilePath(srcPath string) string {
+	return c.dstFilePath(srcPath) + ".d"
+}
+
+// Calculates the flags (including include paths) that the specified C or
+// assembly file is compiled with.
 //
 // @param file                  The filename of the source file to compile.
 // @param compilerType          One of the COMPILER_TYPE_[...] constants.
 //
-// @return                      (success) The command arguments.
-func (c *Compiler) CompileFileCmd(file string, compilerType int) (
-	[]string, error) {
-
-	objPath := c.dstFilePath(file) + ".o"
+// @return string               The compiler executable.
+// @return []string             The compiler flags.
+func (c *Compiler) CompileFlags(file string, compilerType int) (
+	string, []string, error) {
 
 	var cmdName string
 	var flags []string
@@ -418,13 +497,40 @@ func (c *Compiler) CompileFileCmd(file string, compilerType int) (
 		cmdName = c.cppPath
 		flags = c.cflagsStrings()
 	default:
-		return nil, util.NewNewtError("Unknown compiler type")
+		return "", nil, util.NewNewtError("Unknown compiler type")
 	}
 
+	// Identify placed files on the command line; this also ensures a file
+	// gets rebuilt when its placement changes.
+	if prefix := c.sectionPrefix(file); prefix != "" {
+		flags = append(flags, "-DMYNEWT_PLACEMENT="+
+			strings.TrimPrefix(prefix, ".placement_"))
+	}
+
+	flags = append(flags, c.includesStrings()...)
+
+	return cmdName, flags, nil
+}
+
+// Calculates the command-line invocation necessary to compile the specified C
+// or assembly file.
+//
+// @param file                  The filename of the source file to compile.
+// @param compilerType          One of the COMPILER_TYPE_[...] constants.
+//
+// @return                      (success) The command arguments.
+func (c *Compiler) CompileFileCmd(file string, compilerType int) (
+	[]string, error) {
+
+	cmdName, flags, err := c.CompileFlags(file, compilerType)
+	if err != nil {
+		return nil, err
+	}
+
+	objPath := c.dstFilePath(file) + ".o"
 	srcPath := strings.TrimPrefix(file, c.baseDir+"/")
 	cmd := []string{cmdName}
 	cmd = append(cmd, flags...)
-	cmd = append(cmd, c.includesStrings()...)
 	cmd = append(cmd, []string{
 		"-c",
 		"-o",
@@ -435,6 +541,46 @@ func (c *Compiler) CompileFileCmd(file string, compilerType int) (
 	return cmd, nil
 }
 
+// Retrieves the section prefix that applies to the specified source file; ""
+// if the file isn't placed in an alternate memory region.
+func (c *Compiler) sectionPrefix(file string) string {
+	if len(c.SectionPrefixes) == 0 {
+		return ""
+	}
+
+	path := filepath.ToSlash(file)
+	if abs, err := filepath.Abs(file); err == nil {
+		path = filepath.ToSlash(abs)
+	}
+
+	if prefix, ok := c.SectionPrefixes[path]; ok {
+		return prefix
+	}
+
+	return c.SectionPrefixes[""]
+}
+
+// Renames the allocated sections of a freshly compiled object file according
+// to its source file's memory placement (e.g., ".text" becomes
+// ".placement_itcm.text").  The object file must not have been placed already.
+func (c *Compiler) placeObject(file string, objPath string) error {
+	prefix := c.sectionPrefix(file)
+	if prefix == "" {
+		return nil
+	}
+
+	cmd := []string{
+		c.ocPath,
+		"--prefix-alloc-sections=" + prefix,
+		objPath,
+	}
+	if _, err := util.ShellCommand(cmd, nil); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // Generates a dependency Makefile (.d) for the specified source C file.
 //
 // @param file                  The name of the source file.
@@ -451,6 +597,11 @@ func (c *Compiler) GenDepsForFile(file string) error {
 	cmd = append(cmd, c.includesStrings()...)
 	cmd = append(cmd, []string{"-MM", "-MG", srcPath}...)
 
+	cmd, err := c.rspFileCmd(cmd, depPath+".rsp")
+	if err != nil {
+		return err
+	}
+
 	o, err := util.ShellCommandLimitDbgOutput(cmd, nil, true, 0)
 	if err != nil {
 		return err
@@ -473,9 +624,28 @@ func (c *Compiler) GenDepsForFile(file string) error {
 		return util.NewNewtError(err.Error())
 	}
 
+	c.mutex.Lock()
+	c.depsGenerated[file] = true
+	c.mutex.Unlock()
+
 	return nil
 }
 
+// Regenerates the dependency file for the specified source file unless it
+// was already generated during this run.  A dependency file generated by an
+// earlier run doesn't account for includes added since.
+func (c *Compiler) ensureDepsCurrent(file string) error {
+	c.mutex.Lock()
+	done := c.depsGenerated[file]
+	c.mutex.Unlock()
+
+	if done {
+		return nil
+	}
+
+	return c.GenDepsForFile(file)
+}
+
 func serializeCommand(cmd []string) []byte {
 	// Use a newline as the separator rather than a space to disambiguate cases
 	// where arguments contain spaces.
@@ -531,28 +701,62 @@ func (c *Compiler) CompileFile(file string, compilerType int) error {
 		return err
 	}
 
+	// The object cache key is only trustworthy if the dependency file
+	// reflects the source file's current includes.
+	cacheKey := ""
+	if c.objCacheDir != "" {
+		if err := c.ensureDepsCurrent(file); err != nil {
+			return err
+		}
+		cacheKey = c.objCacheKey(file, cmd)
+	}
+	cached := cacheKey != "" && c.objCacheFetch(cacheKey, ".o", objPath)
+
+	suffix := ""
+	if cached {
+		suffix = " (cached)"
+	}
+
 	srcPath := strings.TrimPrefix(file, c.baseDir+"/")
 	switch compilerType {
 	case COMPILER_TYPE_C:
-		util.StatusMessage(util.VERBOSITY_DEFAULT, "Compiling %s\n", srcPath)
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "Compiling %s%s\n",
+			srcPath, suffix)
 	case COMPILER_TYPE_CPP:
-		util.StatusMessage(util.VERBOSITY_DEFAULT, "Compiling %s\n", srcPath)
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "Compiling %s%s\n",
+			srcPath, suffix)
 	case COMPILER_TYPE_ASM:
-		util.StatusMessage(util.VERBOSITY_DEFAULT, "Assembling %s\n", srcPath)
+		util.StatusMessage(util.VERBOSITY_DEFAULT, "Assembling %s%s\n",
+			srcPath, suffix)
 	default:
 		return util.NewNewtError("Unknown compiler type")
 	}
 
-	_, err = util.ShellCommand(cmd, nil)
-	if err != nil {
-		return err
+	// Hash the dependencies before compiling so that a change made during
+	// the compile is detected by the next build.
+	hashes := c.objDepHashes(file)
+
+	if cached {
+		clearCachedError(objPath)
+	} else {
+		start := time.Now()
+		if err := c.runCompileCmd(file, objPath, cmd); err != nil {
+			return err
+		}
+		recordStep("compile "+srcPath, start)
+
+		if err := c.placeObject(file, objPath); err != nil {
+			return err
+		}
+
+		if cacheKey != "" {
+			c.objCacheStore(cacheKey, ".o", objPath)
+		}
 	}
 
-	c.compileCommands = append(c.compileCommands,
-		CompileCommand{
-			Command: strings.Join(cmd, " "),
-			File:    file,
-		})
+	writeDepHashes(objPath, hashes)
+
+	c.addCompileCommand(file, cmd)
 
 	err = writeCommandFile(objPath, cmd)
 	if err != nil {
@@ -610,7 +814,7 @@ func (c *Compiler) CompileC(filename string) error {
 	if compileRequired {
 		err = c.CompileFile(filename, COMPILER_TYPE_C)
 	} else {
-		err = c.SkipSourceFile(filename)
+		err = c.SkipSourceFile(filename, COMPILER_TYPE_C)
 	}
 	if err != nil {
 		return err
@@ -637,7 +841,7 @@ func (c *Compiler) CompileCpp(filename string) error {
 	if compileRequired {
 		err = c.CompileFile(filename, COMPILER_TYPE_CPP)
 	} else {
-		err = c.SkipSourceFile(filename)
+		err = c.SkipSourceFile(filename, COMPILER_TYPE_CPP)
 	}
 
 	if err != nil {
@@ -667,7 +871,7 @@ func (c *Compiler) CompileAs(filename string) error {
 	if compileRequired {
 		err = c.CompileFile(filename, COMPILER_TYPE_ASM)
 	} else {
-		err = c.SkipSourceFile(filename)
+		err = c.SkipSourceFile(filename, COMPILER_TYPE_ASM)
 	}
 	if err != nil {
 		return err
@@ -900,7 +1104,7 @@ func (c *Compiler) CompileBinary(dstFile string, options map[string]bool,
 	}
 
 	cmd := c.CompileBinaryCmd(dstFile, options, objFiles, keepSymbols, elfLib)
-	_, err := util.ShellCommand(cmd, nil)
+	_, err := c.shellCommandRsp(cmd, dstFile+".rsp")
 	if err != nil {
 		return err
 	}
@@ -1041,10 +1245,12 @@ func (c *Compiler) CompileElf(binFile string, objFiles []string,
 		if err := os.MkdirAll(filepath.Dir(binFile), 0755); err != nil {
 			return util.NewNewtError(err.Error())
 		}
+		start := time.Now()
 		err := c.CompileBinary(binFile, options, objFiles, keepSymbols, elfLib)
 		if err != nil {
 			return err
 		}
+		recordStep("link "+strings.TrimPrefix(binFile, c.baseDir+"/"), start)
 	}
 
 	err = c.generateExtras(binFile, options)
@@ -1194,10 +1400,19 @@ func (c *Compiler) CompileArchive(archiveFile string) error {
 	// Delete the old archive, if it exists.
 	os.Remove(archiveFile)
 
+	cacheKey := ""
+	if c.objCacheDir != "" {
+		cacheKey = c.archiveCacheKey(objList)
+	}
+	cached := cacheKey != "" && c.objCacheFetch(cacheKey, ".a", archiveFile)
+
 	util.StatusMessage(util.VERBOSITY_DEFAULT, "Archiving %s",
 		path.Base(archiveFile))
 	util.StatusMessage(util.VERBOSITY_VERBOSE, " with object files %s",
 		strings.Join(objList, " "))
+	if cached {
+		util.StatusMessage(util.VERBOSITY_DEFAULT, " (cached)")
+	}
 	util.StatusMessage(util.VERBOSITY_DEFAULT, "\n")
 
 	if err != nil && !os.IsNotExist(err) {
@@ -1205,9 +1420,18 @@ func (c *Compiler) CompileArchive(archiveFile string) error {
 	}
 
 	cmd := c.CompileArchiveCmd(archiveFile, objFiles)
-	_, err = util.ShellCommand(cmd, nil)
-	if err != nil {
-		return err
+	if !cached {
+		start := time.Now()
+		_, err = c.shellCommandRsp(cmd, archiveFile+".rsp")
+		if err != nil {
+			return err
+		}
+		recordStep("archive "+strings.TrimPrefix(archiveFile, c.baseDir+"/"),
+			start)
+
+		if cacheKey != "" {
+			c.objCacheStore(cacheKey, ".a", archiveFile)
+		}
 	}
 
 	err = writeCommandFile(archiveFile, cmd)
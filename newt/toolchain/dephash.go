@@ -0,0 +1,180 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Content-based change detection for object file dependencies.  Modification
+// times alone are not reliable: some git operations (and some editors) leave a
+// modified file with an older timestamp than the objects built from it.  This
+// is common when a developer edits a dependency repo in place under `repos/`.
+// When an object is built, the hashes of all its dependencies are recorded
+// next to it; an object whose dependencies' contents have since changed is
+// rebuilt even if the timestamps indicate otherwise.
+
+package toolchain
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Suffix of the file listing the hashes of an object's dependencies.
+const DEP_HASH_SUFFIX = ".dephash"
+
+type depHashEntry struct {
+	modTime time.Time
+	size    int64
+	hash    string
+}
+
+// Hashes of the files seen during this run.  Most headers are included by
+// many source files; each is only hashed once unless it changes.
+var depHashCache = map[string]depHashEntry{}
+var depHashMutex sync.Mutex
+
+func fileHash(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", util.ChildNewtError(err)
+	}
+
+	depHashMutex.Lock()
+	entry, ok := depHashCache[path]
+	depHashMutex.Unlock()
+
+	if ok && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+		return entry.hash, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", util.ChildNewtError(err)
+	}
+	hash := fmt.Sprintf("%x", sha1.Sum(b))
+
+	depHashMutex.Lock()
+	depHashCache[path] = depHashEntry{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		hash:    hash,
+	}
+	depHashMutex.Unlock()
+
+	return hash, nil
+}
+
+// Hashes each of the specified files.  Files that don't exist are omitted.
+func depHashes(deps []string) map[string]string {
+	hashes := make(map[string]string, len(deps))
+	for _, dep := range deps {
+		if hash, err := fileHash(dep); err == nil {
+			hashes[dep] = hash
+		}
+	}
+
+	return hashes
+}
+
+func readDepHashes(objPath string) map[string]string {
+	lines, err := util.ReadLines(objPath + DEP_HASH_SUFFIX)
+	if err != nil {
+		return nil
+	}
+
+	hashes := make(map[string]string, len(lines))
+	for _, line := range lines {
+		// <hash> <path>
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) == 2 {
+			hashes[fields[1]] = fields[0]
+		}
+	}
+
+	return hashes
+}
+
+func writeDepHashes(objPath string, hashes map[string]string) {
+	deps := make([]string, 0, len(hashes))
+	for dep, _ := range hashes {
+		deps = append(deps, dep)
+	}
+	sort.Strings(deps)
+
+	lines := make([]string, len(deps))
+	for i, dep := range deps {
+		lines[i] = hashes[dep] + " " + dep
+	}
+
+	// The hashes only serve to detect changes that timestamps miss; failing
+	// to record them is not an error.
+	content := strings.Join(lines, "\n") + "\n"
+	if err := ioutil.WriteFile(objPath+DEP_HASH_SUFFIX, []byte(content),
+		0644); err != nil {
+
+		log.Debugf("failed to write dependency hashes for %s: %s",
+			objPath, err.Error())
+	}
+}
+
+// Determines whether any of an object's dependencies has different contents
+// than when the object was built.  If no hashes were recorded for the object
+// (e.g., it was built by an older version of newt), the current hashes are
+// recorded and the object is assumed to be up to date.
+//
+// @return string               The first changed dependency; "" if none
+//                                  changed.
+func depContentChanged(objPath string, deps []string) string {
+	prev := readDepHashes(objPath)
+	if prev == nil {
+		writeDepHashes(objPath, depHashes(deps))
+		return ""
+	}
+
+	for _, dep := range deps {
+		prevHash, ok := prev[dep]
+		if !ok {
+			continue
+		}
+
+		hash, err := fileHash(dep)
+		if err != nil || hash != prevHash {
+			return dep
+		}
+	}
+
+	return ""
+}
+
+// Hashes the dependencies of the object built from the specified source file.
+func (c *Compiler) objDepHashes(srcFile string) map[string]string {
+	deps, err := ParseDepsFile(c.dstFilePath(srcFile) + ".d")
+	if err != nil {
+		deps = []string{srcFile}
+	}
+
+	return depHashes(append(deps, c.extraDeps...))
+}
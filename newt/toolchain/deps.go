@@ -107,6 +107,42 @@ func ParseDepsFile(filename string) ([]string, error) {
 	return allDeps, nil
 }
 
+// Estimates the relative cost of compiling the specified source file: the
+// size of the file plus the sizes of the headers it included when it was last
+// compiled.  Used to decide which files to compile first.
+//
+// @param file                  The source file.
+// @param sizes                 Memoized file sizes; shared between calls
+//                                  since most headers are included by many
+//                                  source files.
+func (c *Compiler) CompileCost(file string, sizes map[string]int64) int64 {
+	size := func(path string) int64 {
+		if n, ok := sizes[path]; ok {
+			return n
+		}
+
+		var n int64
+		if info, err := os.Stat(path); err == nil {
+			n = info.Size()
+		}
+		sizes[path] = n
+		return n
+	}
+
+	deps, err := ParseDepsFile(c.DepFilePath(file))
+	if err != nil || len(deps) == 0 {
+		return size(file)
+	}
+
+	// The dependency list begins with the source file itself.
+	var cost int64
+	for _, dep := range deps {
+		cost += size(dep)
+	}
+
+	return cost
+}
+
 // Updates the dependency tracker's most recent timestamp according to the
 // modification time of the specified file.  If the specified file is older
 // than the tracker's currently most-recent time, this function has no effect.
@@ -147,6 +183,64 @@ func commandHasChanged(dstFile string, cmd []string) bool {
 	return changed
 }
 
+// Describes how the command that previously built a file differs from the
+// specified one.  Each output file records its own effective command line, so
+// a flag change only triggers a rebuild of the files whose flags actually
+// changed (e.g., a change to one package's cflags only affects that package's
+// object files).  This function is used to report the exact difference.
+//
+// @param dstFile               The output file whose build invocation is being
+//                                  tested.
+// @param cmd                   The command that would be used to generate the
+//                                  specified destination file.
+//
+// @return                      A human-readable description of the change.
+func commandChangeText(dstFile string, cmd []string) string {
+	prevCmd, err := ioutil.ReadFile(dstFile + ".cmd")
+	if err != nil {
+		return "no previous command"
+	}
+
+	prevArgs := map[string]bool{}
+	for _, arg := range strings.Split(string(prevCmd), "\n") {
+		prevArgs[arg] = true
+	}
+
+	curArgs := map[string]bool{}
+	for _, arg := range cmd {
+		curArgs[arg] = true
+	}
+
+	added := []string{}
+	for _, arg := range cmd {
+		if !prevArgs[arg] {
+			added = append(added, arg)
+		}
+	}
+
+	removed := []string{}
+	for arg, _ := range prevArgs {
+		if !curArgs[arg] {
+			removed = append(removed, arg)
+		}
+	}
+
+	if len(added) == 0 && len(removed) == 0 {
+		return "arguments reordered"
+	}
+
+	parts := []string{}
+	if len(added) > 0 {
+		parts = append(parts, "added ["+strings.Join(added, " ")+"]")
+	}
+	if len(removed) > 0 {
+		removed = util.SortFields(removed...)
+		parts = append(parts, "removed ["+strings.Join(removed, " ")+"]")
+	}
+
+	return strings.Join(parts, ", ")
+}
+
 // Determines if the specified C or assembly file needs to be built.  A compile
 // is required if any of the following is true:
 //     * The destination object file does not exist.
@@ -155,6 +249,8 @@ func commandHasChanged(dstFile string, cmd []string) bool {
 //     * The source file has a newer modification time than the object file.
 //     * One or more included header files has a newer modification time than
 //       the object file.
+//     * The contents of one or more included header files differ from when
+//       the object file was built.
 func (tracker *DepTracker) CompileRequired(srcFile string,
 	compilerType int) (bool, error) {
 
@@ -170,7 +266,8 @@ func (tracker *DepTracker) CompileRequired(srcFile string,
 
 	if commandHasChanged(objPath, cmd) {
 		util.StatusMessage(util.VERBOSITY_VERBOSE, "%s - rebuild required; "+
-			"different command\n", srcFile)
+			"different command (%s)\n", srcFile,
+			commandChangeText(objPath, cmd))
 		err := tracker.compiler.GenDepsForFile(srcFile)
 		if err != nil {
 			return false, err
@@ -224,6 +321,10 @@ func (tracker *DepTracker) CompileRequired(srcFile string,
 		return false, err
 	}
 
+	// Also consider files that the package explicitly depends on (e.g.,
+	// generated files).
+	deps = append(deps, tracker.compiler.extraDeps...)
+
 	// Check if any dependencies are newer than the destination object file.
 	for _, dep := range deps {
 		if util.NodeNotExist(dep) {
@@ -249,6 +350,14 @@ func (tracker *DepTracker) CompileRequired(srcFile string,
 		}
 	}
 
+	// The timestamps indicate the object is up to date, but a dependency may
+	// have been modified without its timestamp changing.
+	if dep := depContentChanged(objPath, deps); dep != "" {
+		util.StatusMessage(util.VERBOSITY_VERBOSE, "%s - rebuild required; "+
+			"contents of dependency changed (%s)\n", srcFile, dep)
+		return true, nil
+	}
+
 	return false, nil
 }
 
@@ -266,6 +375,9 @@ func (tracker *DepTracker) ArchiveRequired(archiveFile string,
 	// rebuild is required.
 	cmd := tracker.compiler.CompileArchiveCmd(archiveFile, objFiles)
 	if commandHasChanged(archiveFile, cmd) {
+		util.StatusMessage(util.VERBOSITY_VERBOSE, "%s - rearchive required; "+
+			"different command (%s)\n", archiveFile,
+			commandChangeText(archiveFile, cmd))
 		return true, nil
 	}
 
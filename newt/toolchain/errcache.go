@@ -0,0 +1,240 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Failed compilations are optionally recorded in a ".err" file next to the
+// object file.  The record contains a digest of the compiler invocation and of
+// every input file; if a subsequent build would compile exactly the same
+// inputs, the recorded error is reported without invoking the compiler again.
+// The digest also records which include directories contain each header the
+// file uses, so a header that appears in an earlier include directory, or
+// that was missing and has since been added, invalidates the record.
+
+package toolchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"mynewt.apache.org/newt/newt/settings"
+	"mynewt.apache.org/newt/util"
+)
+
+func errCachePath(objPath string) string {
+	return objPath + ".err"
+}
+
+// Returns the include directories that the specified compiler command
+// searches, in order.
+func cmdIncludeDirs(cmd []string) []string {
+	dirs := []string{}
+	for i, arg := range cmd {
+		switch {
+		case arg == "-I" && i+1 < len(cmd):
+			dirs = append(dirs, cmd[i+1])
+		case strings.HasPrefix(arg, "-I") && arg != "-I":
+			dirs = append(dirs, arg[2:])
+		}
+	}
+
+	return dirs
+}
+
+// Hashes which of the specified directories contain each of a source file's
+// header dependencies.  A header is identified by its path relative to the
+// include directory it was found in; a header that wasn't found at all
+// (listed as-is in the dependency file) is identified by its name.
+func hashHeaderLocations(h hash.Hash, deps []string, dirs []string) {
+	names := map[string]bool{}
+	for _, dep := range deps {
+		found := false
+		for _, dir := range dirs {
+			if strings.HasPrefix(dep, dir+"/") {
+				names[strings.TrimPrefix(dep, dir+"/")] = true
+				found = true
+			}
+		}
+		if !found && util.NodeNotExist(dep) {
+			names[dep] = true
+		}
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name, _ := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		h.Write([]byte("\n<include " + name + ">"))
+		for _, dir := range dirs {
+			if util.NodeExist(dir + "/" + name) {
+				h.Write([]byte(" " + dir))
+			}
+		}
+	}
+}
+
+// Calculates a digest of everything that affects the compilation of the
+// specified source file: the command line, the source file, each of its
+// dependencies, and the include directories that its headers are found in.
+//
+// @return string               The digest; "" if the source file's
+//                                  dependencies are not known.
+func (c *Compiler) compileInputHash(file string, cmd []string) (
+	string, error) {
+
+	depPath := c.dstFilePath(file) + ".d"
+	if util.NodeNotExist(depPath) {
+		return "", nil
+	}
+
+	deps, err := ParseDepsFile(depPath)
+	if err != nil {
+		return "", err
+	}
+
+	// Quoted includes are searched for in the source file's directory
+	// first.
+	srcDir := filepath.Dir(strings.TrimPrefix(file, c.baseDir+"/"))
+	dirs := append([]string{filepath.ToSlash(srcDir)},
+		cmdIncludeDirs(cmd)...)
+
+	h := sha256.New()
+	h.Write(serializeCommand(cmd))
+	hashHeaderLocations(h, deps, dirs)
+
+	deps = append(deps, file)
+	deps = append(deps, c.extraDeps...)
+	sort.Strings(deps)
+	for _, dep := range deps {
+		h.Write([]byte("\n" + dep + "\n"))
+
+		contents, err := ioutil.ReadFile(dep)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return "", util.ChildNewtError(err)
+			}
+			h.Write([]byte("<missing>"))
+			continue
+		}
+		h.Write(contents)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Retrieves the recorded output of a failed compilation if the inputs have not
+// changed since it failed.
+//
+// @return []byte               The compiler output; nil if no matching
+//                                  failure is recorded.
+func readCachedError(objPath string, hash string) []byte {
+	contents, err := ioutil.ReadFile(errCachePath(objPath))
+	if err != nil {
+		return nil
+	}
+
+	nl := bytes.IndexByte(contents, '\n')
+	if nl < 0 || string(contents[:nl]) != hash {
+		return nil
+	}
+
+	return contents[nl+1:]
+}
+
+func writeCachedError(objPath string, hash string, output []byte) {
+	contents := append([]byte(hash+"\n"), output...)
+	if err := ioutil.WriteFile(
+		errCachePath(objPath), contents, 0644); err != nil {
+
+		log.Debugf("failed to record compiler error for %s: %s",
+			objPath, err.Error())
+	}
+}
+
+func clearCachedError(objPath string) {
+	os.Remove(errCachePath(objPath))
+}
+
+// Records the output of a failed compilation.  The dependency file may
+// predate the change that broke the build (e.g., a new #include), so it is
+// regenerated first and the error is recorded against the current
+// dependencies.
+func (c *Compiler) recordError(file string, objPath string, cmd []string,
+	output []byte) {
+
+	if err := c.GenDepsForFile(file); err != nil {
+		log.Debugf("not recording compiler error for %s: %s",
+			objPath, err.Error())
+		return
+	}
+
+	hash, err := c.compileInputHash(file, cmd)
+	if err != nil || hash == "" {
+		return
+	}
+
+	writeCachedError(objPath, hash, output)
+}
+
+// Compiles a file, consulting the error cache first if it is enabled.  Without
+// the cache, this is equivalent to executing the command directly.
+func (c *Compiler) runCompileCmd(file string, objPath string,
+	cmd []string) error {
+
+	rspPath := objPath + ".rsp"
+	if !settings.BuildCacheErrors() {
+		_, err := c.execCompileCmd(cmd, rspPath)
+		return err
+	}
+
+	hash, err := c.compileInputHash(file, cmd)
+	if err != nil {
+		return err
+	}
+
+	if hash != "" {
+		if o := readCachedError(objPath, hash); o != nil {
+			util.StatusMessage(util.VERBOSITY_VERBOSE,
+				"%s - unchanged since last failure; reporting cached "+
+					"error\n", file)
+			return util.NewNewtError(string(o))
+		}
+	}
+
+	o, err := c.execCompileCmd(cmd, rspPath)
+	if err != nil {
+		if len(o) > 0 {
+			c.recordError(file, objPath, cmd, o)
+		}
+		return err
+	}
+
+	clearCachedError(objPath)
+	return nil
+}
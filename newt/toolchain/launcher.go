@@ -0,0 +1,140 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Compiler launchers.  A launcher is a program that each compiler invocation
+// is passed through, e.g., ccache, distcc, icecc, or sccache.  Launchers can
+// be chained ("ccache distcc"); each one runs the rest of the chain.
+//
+// Only compilations go through the launcher.  Dependency generation (`-MM
+// -MG`), which must see generated headers that may not exist yet, archiving,
+// and linking always run locally.  Source files are always compiled with the
+// project directory as the working directory and with relative include paths,
+// so generated headers (`bin/targets/<target>/generated/include`) are found
+// the same way locally and remotely; distcc and icecc preprocess locally, and
+// sccache ships the headers it finds.
+//
+// Newt's own .cmd files and compilation databases never mention the
+// launcher; changing launchers does not cause anything to be rebuilt.
+
+package toolchain
+
+import (
+	"path/filepath"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"mynewt.apache.org/newt/util"
+)
+
+type Launcher struct {
+	// Prefixed to each compiler invocation.
+	Cmd []string
+
+	// Additional environment for each compiler invocation.
+	Env []string
+
+	// The chain's ccache instance; nil if ccache is not in use.
+	Ccache *Ccache
+
+	// Whether the chain includes a launcher other than ccache (e.g., distcc).
+	// Such launchers may run the compiler on another host, where a response
+	// file written by newt doesn't exist.
+	Distributed bool
+}
+
+// Indicates whether the specified launcher executable is ccache.
+func IsCcache(path string) bool {
+	return strings.TrimSuffix(filepath.Base(path), ".exe") == "ccache"
+}
+
+// Creates a launcher from a chain of launcher executables.
+//
+// @param ccachePath            The ccache executable at the head of the
+//                                  chain; "" if ccache is not in use.
+// @param paths                 The remaining launcher executables, outermost
+//                                  first.
+// @param baseDir               The project base directory.
+//
+// @return *Launcher            The launcher; nil if the chain is empty.
+func NewLauncher(ccachePath string, paths []string,
+	baseDir string) *Launcher {
+
+	if ccachePath == "" {
+		if len(paths) == 0 {
+			return nil
+		}
+		return &Launcher{
+			Cmd:         paths,
+			Distributed: true,
+		}
+	}
+
+	l := &Launcher{
+		Cmd:    []string{ccachePath},
+		Ccache: NewCcache(ccachePath, baseDir),
+	}
+	l.Env = append(l.Env, l.Ccache.Env...)
+
+	// Let ccache run the remainder of the chain.  This way, only cache misses
+	// get dispatched, and the remote launcher doesn't become part of ccache's
+	// hash.
+	if len(paths) > 0 {
+		l.Env = append(l.Env, "CCACHE_PREFIX="+strings.Join(paths, " "))
+		l.Distributed = true
+	}
+
+	return l
+}
+
+// Prefixes a compiler invocation with the launcher chain.
+func (l *Launcher) Wrap(cmd []string) []string {
+	return append(append([]string{}, l.Cmd...), cmd...)
+}
+
+// Routes the compiler's invocations through the specified launcher; nil
+// compiles locally.
+func (c *Compiler) SetLauncher(l *Launcher) {
+	c.launcher = l
+}
+
+// Executes a compiler invocation, routing it through the launcher if there is
+// one.
+func (c *Compiler) execCompileCmd(cmd []string, rspPath string) (
+	[]byte, error) {
+
+	if c.launcher == nil {
+		return c.shellCommandRsp(cmd, rspPath)
+	}
+
+	// A remote compiler can't read a local response file; pass the full
+	// command line instead.
+	rspCmd := cmd
+	if !c.launcher.Distributed {
+		var err error
+		rspCmd, err = c.rspFileCmd(cmd, rspPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.Debugf("compiling via launcher: %s",
+		strings.Join(c.launcher.Cmd, " "))
+	return util.ShellCommand(c.launcher.Wrap(rspCmd), c.launcher.Env)
+}
@@ -0,0 +1,150 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package toolchain
+
+import (
+	"path/filepath"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Names of the rules in a generated Ninja file.
+const (
+	NINJA_RULE_CC   = "cc"
+	NINJA_RULE_AS   = "as"
+	NINJA_RULE_ASPP = "aspp"
+	NINJA_RULE_AR   = "ar"
+	NINJA_RULE_COPY = "copy"
+)
+
+// A single build statement in a Ninja file.
+type NinjaEdge struct {
+	Rule    string
+	Outputs []string
+	Inputs  []string
+
+	// Files that trigger a rebuild when changed, but which don't appear on
+	// the command line (e.g., the package's yml files).
+	Implicit []string
+
+	// The command that produces the outputs; empty for rules with a fixed
+	// command.
+	Command []string
+
+	// Commands that post-process the outputs.
+	Post [][]string
+
+	// The dependency file that the command writes; empty if the rule
+	// doesn't track header dependencies.
+	Depfile string
+}
+
+// Calculates the Ninja build statement that compiles the specified source
+// file.  The file's command is also recorded in the compilation database and
+// its object file is added to the set that gets archived.
+//
+// @return *NinjaEdge           The build statement; nil if the file is
+//                                  ignored.
+func (c *Compiler) NinjaCompileEdge(file string,
+	compilerType int) (*NinjaEdge, error) {
+
+	file = filepath.ToSlash(file)
+	if c.ShouldIgnoreFile(file) {
+		log.Infof("Ignoring %s because package dictates it.", file)
+		return nil, nil
+	}
+
+	if compilerType == COMPILER_TYPE_ARCHIVE {
+		return &NinjaEdge{
+			Rule:    NINJA_RULE_COPY,
+			Outputs: []string{c.dstDir + "/" + filepath.Base(file)},
+			Inputs:  []string{file},
+		}, nil
+	}
+
+	cmd, err := c.CompileFileCmd(file, compilerType)
+	if err != nil {
+		return nil, err
+	}
+
+	objPath := c.dstFilePath(file) + ".o"
+
+	c.mutex.Lock()
+	c.objPathList[filepath.ToSlash(objPath)] = true
+	c.mutex.Unlock()
+
+	c.addCompileCommand(file, cmd)
+
+	if c.launcher != nil {
+		cmd = c.launcher.Wrap(cmd)
+	}
+
+	edge := &NinjaEdge{
+		Rule:     NINJA_RULE_CC,
+		Outputs:  []string{objPath},
+		Inputs:   []string{file},
+		Implicit: append([]string{}, c.extraDeps...),
+		Command:  cmd,
+		Depfile:  c.DepFilePath(file),
+	}
+	if compilerType == COMPILER_TYPE_ASM {
+		// Only assembly files that go through the preprocessor (.S) have
+		// header dependencies.
+		if filepath.Ext(file) == ".S" {
+			edge.Rule = NINJA_RULE_ASPP
+		} else {
+			edge.Rule = NINJA_RULE_AS
+			edge.Depfile = ""
+		}
+	}
+
+	if prefix := c.sectionPrefix(file); prefix != "" {
+		edge.Post = append(edge.Post, []string{
+			c.ocPath,
+			"--prefix-alloc-sections=" + prefix,
+			objPath,
+		})
+	}
+
+	return edge, nil
+}
+
+// Calculates the Ninja build statement that archives the object files of
+// every source file passed to NinjaCompileEdge().
+//
+// @return *NinjaEdge           The build statement; nil if there is nothing
+//                                  to archive.
+func (c *Compiler) NinjaArchiveEdge(archiveFile string) *NinjaEdge {
+	// Make sure the compiler package info is added to the global set.
+	c.ensureLclInfoAdded()
+
+	objFiles := c.getObjFiles([]string{})
+	if len(objFiles) == 0 {
+		return nil
+	}
+
+	return &NinjaEdge{
+		Rule:    NINJA_RULE_AR,
+		Outputs: []string{archiveFile},
+		Inputs:  objFiles,
+		Command: c.CompileArchiveCmd(archiveFile, nil),
+	}
+}
+
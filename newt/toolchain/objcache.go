@@ -0,0 +1,201 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Content-addressed object cache.  Many targets compile the same package
+// sources with the same flags; when the cache is enabled, each object file
+// and archive newt builds is also stored in a directory shared by every
+// target in the project, keyed by a digest of everything that determines its
+// contents.  A later build of any target (or of the same target after a
+// clean or a branch switch) that would produce identical output copies it
+// from the cache instead of compiling.
+//
+// An object's key covers:
+//     * The version of the compiler.
+//     * The compiler invocation, except for the output path and include
+//       directories (these differ between targets).
+//     * The contents of the source file and of every header it includes, in
+//       inclusion order.  This accounts for the include directories: two
+//       builds that resolve the same headers to files with identical
+//       contents produce identical objects.
+//
+// An archive's key covers the archiver's version and the name and contents of
+// each member object.
+//
+// The cache lives in the project's bin directory, so `newt clean all` empties
+// it.  The ninja backend does not use it.
+
+package toolchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// The "--version" output of each tool seen during this run.
+var toolVersions = map[string]string{}
+var toolVersionsMtx sync.Mutex
+
+func toolVersion(tool string) string {
+	toolVersionsMtx.Lock()
+	defer toolVersionsMtx.Unlock()
+
+	if v, ok := toolVersions[tool]; ok {
+		return v
+	}
+
+	o, err := util.ShellCommandLimitDbgOutput(
+		[]string{tool, "--version"}, nil, false, -1)
+	if err != nil {
+		// Fall back to the tool's path; the cache key still distinguishes
+		// toolchains installed in different locations.
+		log.Debugf("failed to determine version of %s: %s", tool,
+			err.Error())
+		o = nil
+	}
+
+	v := tool + "\n" + string(o)
+	toolVersions[tool] = v
+	return v
+}
+
+// Directs the compiler to store its objects and archives in, and reuse them
+// from, the specified cache directory; "" disables the cache.
+func (c *Compiler) SetObjCacheDir(dir string) {
+	c.objCacheDir = dir
+}
+
+func (c *Compiler) objCachePath(key string, ext string) string {
+	return c.objCacheDir + "/" + key[:2] + "/" + key + ext
+}
+
+// Calculates the object cache key for the specified source file.  The file's
+// dependency (.d) file must be up to date.  The cached object is the placed
+// one (see placeObject), so the file's section prefix is part of the key.
+//
+// @return string               The key; "" if the object cannot be cached
+//                                  (e.g., it includes a missing header).
+func (c *Compiler) objCacheKey(file string, cmd []string) string {
+	deps, err := ParseDepsFile(c.dstFilePath(file) + ".d")
+	if err != nil || len(deps) == 0 {
+		return ""
+	}
+
+	h := sha256.New()
+	h.Write([]byte(toolVersion(cmd[0])))
+	h.Write([]byte("section-prefix " + c.sectionPrefix(file) + "\n"))
+
+	for i := 1; i < len(cmd); i++ {
+		switch {
+		case cmd[i] == "-o":
+			i++
+		case strings.HasPrefix(cmd[i], "-I"):
+		default:
+			h.Write([]byte(cmd[i] + "\n"))
+		}
+	}
+
+	for _, dep := range deps {
+		hash, err := fileHash(dep)
+		if err != nil {
+			return ""
+		}
+		h.Write([]byte(hash + "\n"))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Calculates the object cache key for an archive of the specified objects.
+func (c *Compiler) archiveCacheKey(objFiles []string) string {
+	h := sha256.New()
+	h.Write([]byte(toolVersion(c.arPath)))
+
+	for _, obj := range objFiles {
+		hash, err := fileHash(obj)
+		if err != nil {
+			return ""
+		}
+		h.Write([]byte(filepath.Base(obj) + " " + hash + "\n"))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Copies a file out of the object cache.
+//
+// @return bool                 true if the file was in the cache.
+func (c *Compiler) objCacheFetch(key string, ext string, dst string) bool {
+	src := c.objCachePath(key, ext)
+	if util.NodeNotExist(src) {
+		return false
+	}
+
+	if err := util.CopyFile(src, dst); err != nil {
+		log.Debugf("failed to copy %s from object cache: %s", dst,
+			err.Error())
+		os.Remove(dst)
+		return false
+	}
+
+	return true
+}
+
+// Adds a file to the object cache.  Failing to do so is not an error; the
+// file just gets rebuilt next time.
+func (c *Compiler) objCacheStore(key string, ext string, src string) {
+	dst := c.objCachePath(key, ext)
+	if util.NodeExist(dst) {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		log.Debugf("failed to create object cache directory: %s",
+			err.Error())
+		return
+	}
+
+	// Copy to a temporary file first so that a concurrent build never sees a
+	// partially written entry.
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), ".tmp")
+	if err != nil {
+		log.Debugf("failed to add %s to object cache: %s", src, err.Error())
+		return
+	}
+	tmp.Close()
+
+	if err := util.CopyFile(src, tmp.Name()); err != nil {
+		log.Debugf("failed to add %s to object cache: %s", src, err.Error())
+		os.Remove(tmp.Name())
+		return
+	}
+
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		log.Debugf("failed to add %s to object cache: %s", src, err.Error())
+		os.Remove(tmp.Name())
+	}
+}
@@ -0,0 +1,122 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package toolchain
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+
+	"mynewt.apache.org/newt/util"
+)
+
+// Command lines longer than this are passed to the tool via a response file
+// (@file).  Windows limits a command line to 32K characters (8K when run
+// through cmd.exe).  Elsewhere, the entire command line is passed to the
+// shell as a single argument, which Linux limits to 128K.
+func maxCmdLineLen() int {
+	if runtime.GOOS == "windows" {
+		return 8000
+	}
+	return 100000
+}
+
+func cmdLineLen(cmd []string) int {
+	n := 0
+	for _, arg := range cmd {
+		n += len(arg) + 1
+	}
+	return n
+}
+
+// Indicates whether tool invocations are passed through the shell (see
+// util.ShellCommand).  If so, the shell splits and unquotes each argument, so
+// a response file must leave that to the tool.
+func rspShellQuoting() bool {
+	return util.ExecuteShell &&
+		(runtime.GOOS == "linux" || runtime.GOOS == "darwin")
+}
+
+// Escapes an argument for inclusion in a GCC-style response file.  Within a
+// response file, whitespace separates arguments, single and double quotes
+// group them, and a backslash escapes the character that follows it.
+//
+// If shell is true, the argument is written the way util.ShellCommand passes
+// it to /bin/sh: double quotes are escaped, but whitespace, single quotes,
+// and backslashes keep their meaning.  Otherwise, the argument is passed to
+// the tool verbatim, so every special character is escaped.
+func rspFileEscape(arg string, shell bool) string {
+	if shell {
+		return strings.Replace(arg, "\"", "\\\"", -1)
+	}
+
+	var b bytes.Buffer
+	for _, c := range arg {
+		switch c {
+		case '\\', ' ', '\t', '\n', '\'', '"':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// Converts the specified command into one that reads its arguments from a
+// response file if the command line is too long to execute directly.  The
+// response file is written to rspPath.  Commands that are short enough, or
+// that belong to a compiler that doesn't support response files, are
+// returned unchanged; any response file left at rspPath by an earlier build
+// is removed so that it can't be mistaken for the current one.
+func (c *Compiler) rspFileCmd(cmd []string, rspPath string) ([]string, error) {
+	if !c.rspFiles || len(cmd) < 2 || cmdLineLen(cmd) <= maxCmdLineLen() {
+		if err := os.Remove(rspPath); err != nil && !os.IsNotExist(err) {
+			return nil, util.ChildNewtError(err)
+		}
+		return cmd, nil
+	}
+
+	shell := rspShellQuoting()
+	lines := make([]string, len(cmd)-1)
+	for i, arg := range cmd[1:] {
+		lines[i] = rspFileEscape(arg, shell)
+	}
+
+	body := strings.Join(lines, "\n") + "\n"
+	if err := ioutil.WriteFile(rspPath, []byte(body), 0644); err != nil {
+		return nil, util.ChildNewtError(err)
+	}
+
+	return []string{cmd[0], "@" + rspPath}, nil
+}
+
+// Executes the specified tool invocation, using a response file if the
+// command line is too long.
+func (c *Compiler) shellCommandRsp(cmd []string, rspPath string) (
+	[]byte, error) {
+
+	rspCmd, err := c.rspFileCmd(cmd, rspPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return util.ShellCommand(rspCmd, nil)
+}
@@ -0,0 +1,112 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package toolchain
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRspFileEscape(t *testing.T) {
+	tests := []struct {
+		arg   string
+		shell bool
+		want  string
+	}{
+		{`-Ifoo`, false, `-Ifoo`},
+		{`-Idir with space`, false, `-Idir\ with\ space`},
+		{`-DSTR="a b"`, false, `-DSTR=\"a\ b\"`},
+		{`-DCH='x'`, false, `-DCH=\'x\'`},
+		{`C:\path`, false, `C:\\path`},
+		{"a\tb", false, "a\\\tb"},
+
+		{`-Ifoo`, true, `-Ifoo`},
+		{`-DSTR="a b"`, true, `-DSTR=\"a b\"`},
+		{`-DCH='x y'`, true, `-DCH='x y'`},
+		{`-Da -Db`, true, `-Da -Db`},
+	}
+
+	for _, tc := range tests {
+		got := rspFileEscape(tc.arg, tc.shell)
+		if got != tc.want {
+			t.Errorf("rspFileEscape(%q, %v)=%q, want %q",
+				tc.arg, tc.shell, got, tc.want)
+		}
+	}
+}
+
+func TestRspFileCmd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rspfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rspPath := filepath.Join(dir, "main.o.rsp")
+	c := &Compiler{rspFiles: true}
+
+	long := []string{"gcc"}
+	for cmdLineLen(long) <= maxCmdLineLen() {
+		long = append(long, "-Isome/long/include/path")
+	}
+
+	tests := []struct {
+		name    string
+		cmd     []string
+		wantRsp bool
+	}{
+		{"long", long, true},
+		{"short removes stale", []string{"gcc", "-c", "main.c"}, false},
+	}
+
+	for _, tc := range tests {
+		cmd, err := c.rspFileCmd(tc.cmd, rspPath)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.name, err.Error())
+		}
+
+		_, statErr := os.Stat(rspPath)
+		if tc.wantRsp {
+			if len(cmd) != 2 || cmd[1] != "@"+rspPath {
+				t.Errorf("%s: cmd=%v, want response file", tc.name, cmd)
+			}
+			if statErr != nil {
+				t.Errorf("%s: response file not written", tc.name)
+				continue
+			}
+			body, _ := ioutil.ReadFile(rspPath)
+			lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+			if len(lines) != len(tc.cmd)-1 {
+				t.Errorf("%s: %d response file lines, want %d",
+					tc.name, len(lines), len(tc.cmd)-1)
+			}
+		} else {
+			if strings.Join(cmd, " ") != strings.Join(tc.cmd, " ") {
+				t.Errorf("%s: cmd=%v, want %v", tc.name, cmd, tc.cmd)
+			}
+			if !os.IsNotExist(statErr) {
+				t.Errorf("%s: stale response file not removed", tc.name)
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Build step timing.  Each compile, archive, and link step records how long
+// it took so that the slowest steps can be reported at the end of a build.
+
+package toolchain
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type StepTiming struct {
+	Desc     string
+	Duration time.Duration
+}
+
+type stepTimingSorter []StepTiming
+
+func (s stepTimingSorter) Len() int {
+	return len(s)
+}
+func (s stepTimingSorter) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s stepTimingSorter) Less(i, j int) bool {
+	if s[i].Duration != s[j].Duration {
+		return s[i].Duration > s[j].Duration
+	}
+	return s[i].Desc < s[j].Desc
+}
+
+var stepTimings []StepTiming
+var stepTimingsMtx sync.Mutex
+
+// Records the duration of a build step that started at the specified time.
+func recordStep(desc string, start time.Time) {
+	stepTimingsMtx.Lock()
+	defer stepTimingsMtx.Unlock()
+
+	stepTimings = append(stepTimings, StepTiming{
+		Desc:     desc,
+		Duration: time.Since(start),
+	})
+}
+
+// Returns the n longest build steps recorded so far, longest first.
+func SlowestSteps(n int) []StepTiming {
+	stepTimingsMtx.Lock()
+	defer stepTimingsMtx.Unlock()
+
+	steps := make([]StepTiming, len(stepTimings))
+	copy(steps, stepTimings)
+	sort.Sort(stepTimingSorter(steps))
+
+	if n < len(steps) {
+		steps = steps[:n]
+	}
+	return steps
+}
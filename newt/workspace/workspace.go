@@ -0,0 +1,164 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package workspace groups several newt projects that share a single repo
+// store.  A workspace is a directory containing a `workspace.yml` file with
+// the following format:
+//
+//     workspace.projects:
+//         - fw/sensor-node
+//         - fw/gateway
+//     workspace.repos_dir: repos    # Optional; this is the default.
+//
+// Project paths are relative to the workspace directory.  The repos of every
+// listed project are installed in the workspace's repo store rather than in
+// each project's own "repos" directory, so a repo used by several projects is
+// only downloaded once.  Because the projects share each repo's checkout,
+// they must agree on the version of every repo they have in common.
+package workspace
+
+import (
+	"path/filepath"
+
+	"mynewt.apache.org/newt/newt/newtutil"
+	"mynewt.apache.org/newt/util"
+)
+
+const WORKSPACE_FILE_NAME = "workspace.yml"
+const WORKSPACE_REPOS_DIR_DFLT = "repos"
+
+type Workspace struct {
+	BasePath string
+
+	// Absolute paths of the member projects, in the order they are listed.
+	ProjectPaths []string
+
+	// Absolute path of the shared repo store.
+	ReposDir string
+}
+
+func cleanPath(path string) string {
+	return filepath.ToSlash(filepath.Clean(path))
+}
+
+// Reads the workspace in the specified directory.
+func Load(dir string) (*Workspace, error) {
+	dir = cleanPath(dir)
+	path := dir + "/" + WORKSPACE_FILE_NAME
+
+	yc, err := newtutil.ReadConfigPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ws := &Workspace{
+		BasePath: dir,
+	}
+
+	for _, p := range yc.GetValStringSlice("workspace.projects", nil) {
+		if !filepath.IsAbs(p) {
+			p = dir + "/" + p
+		}
+		p = cleanPath(p)
+
+		if util.NodeNotExist(p + "/project.yml") {
+			return nil, util.FmtNewtError(
+				"%s: \"%s\" is not a newt project (no project.yml)", path, p)
+		}
+
+		ws.ProjectPaths = append(ws.ProjectPaths, p)
+	}
+	if len(ws.ProjectPaths) == 0 {
+		return nil, util.FmtNewtError(
+			"%s: \"workspace.projects\" does not list any projects", path)
+	}
+
+	reposDir := yc.GetValString("workspace.repos_dir", nil)
+	if reposDir == "" {
+		reposDir = WORKSPACE_REPOS_DIR_DFLT
+	}
+	if !filepath.IsAbs(reposDir) {
+		reposDir = dir + "/" + reposDir
+	}
+	ws.ReposDir = cleanPath(reposDir)
+
+	return ws, nil
+}
+
+// Finds the workspace containing the specified directory by searching it and
+// each of its ancestors for a `workspace.yml` file.  Nil is returned if the
+// directory is not in a workspace.
+func Find(dir string) (*Workspace, error) {
+	dir = cleanPath(dir)
+	for {
+		if util.NodeExist(dir + "/" + WORKSPACE_FILE_NAME) {
+			return Load(dir)
+		}
+
+		parent := cleanPath(filepath.Dir(dir))
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// Finds the workspace that the specified project is a member of.  Nil is
+// returned if the project is not in a workspace, or if the workspace doesn't
+// list it.  Only the nearest `workspace.yml` is considered; if it can't be
+// read, a warning is displayed and the project is treated as standalone.
+func FindForProject(projPath string) (*Workspace, error) {
+	ws, err := Find(projPath)
+	if err != nil {
+		util.StatusMessage(util.VERBOSITY_QUIET,
+			"* Warning: ignoring workspace: %s\n", err.Error())
+		return nil, nil
+	}
+	if ws == nil {
+		return nil, nil
+	}
+
+	if !ws.Contains(projPath) {
+		return nil, nil
+	}
+
+	return ws, nil
+}
+
+// Indicates whether the specified project is a member of the workspace.
+func (ws *Workspace) Contains(projPath string) bool {
+	projPath = cleanPath(projPath)
+	for _, p := range ws.ProjectPaths {
+		if p == projPath {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns a project's path relative to the workspace directory.
+func (ws *Workspace) RelPath(projPath string) string {
+	rel, err := filepath.Rel(ws.BasePath, projPath)
+	if err != nil {
+		return projPath
+	}
+
+	return filepath.ToSlash(rel)
+}
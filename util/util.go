@@ -33,6 +33,8 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -44,6 +46,13 @@ var PrintShellCmds bool
 var ExecuteShell bool
 var logFile *os.File
 
+// Number of warnings printed during this run.
+var numWarnings int32
+
+// Serializes writes so that messages from concurrent operations don't get
+// mixed together.
+var writeMtx sync.Mutex
+
 func ParseEqualsPair(v string) (string, string, error) {
 	s := strings.Split(v, "=")
 	return s[0], s[1], nil
@@ -95,6 +104,12 @@ func ChildNewtError(parent error) *NewtError {
 		if !ok || newtErr == nil || newtErr.Parent == nil {
 			break
 		}
+
+		// A failed shell command's text is its output; keep that rather
+		// than the bare exit status.
+		if _, ok := newtErr.Parent.(*exec.ExitError); ok {
+			break
+		}
 		parent = newtErr.Parent
 	}
 
@@ -107,8 +122,16 @@ func ChildNewtError(parent error) *NewtError {
 func WriteMessage(f *os.File, level int, message string,
 	args ...interface{}) {
 
+	if isWarningMessage(message) {
+		atomic.AddInt32(&numWarnings, 1)
+	}
+
 	if Verbosity >= level {
 		str := fmt.Sprintf(message, args...)
+
+		writeMtx.Lock()
+		defer writeMtx.Unlock()
+
 		f.WriteString(str)
 		f.Sync()
 
@@ -118,6 +141,19 @@ func WriteMessage(f *os.File, level int, message string,
 	}
 }
 
+// Indicates whether a status message is a warning.  Warnings are
+// conventionally prefixed with "WARNING" or "* Warning".
+func isWarningMessage(message string) bool {
+	message = strings.TrimLeft(message, " *")
+	return strings.HasPrefix(strings.ToUpper(message), "WARNING")
+}
+
+// Returns the number of warnings printed so far during this run, including
+// those suppressed by the verbosity level.
+func WarningCount() int {
+	return int(atomic.LoadInt32(&numWarnings))
+}
+
 // Print Silent, Quiet and Verbose aware status messages to stdout.
 func StatusMessage(level int, message string, args ...interface{}) {
 	WriteMessage(os.Stdout, level, message, args...)
@@ -253,6 +289,25 @@ func Init(logLevel log.Level, logFile string, verbosity int) error {
 	return nil
 }
 
+// Returns the environment for a child process: newt's own environment with
+// the specified key=value pairs added.  Each pair replaces any inherited value
+// of the same variable.
+func ChildEnv(env []string) []string {
+	names := map[string]bool{}
+	for _, kv := range env {
+		names[strings.SplitN(kv, "=", 2)[0]] = true
+	}
+
+	childEnv := []string{}
+	for _, kv := range os.Environ() {
+		if !names[strings.SplitN(kv, "=", 2)[0]] {
+			childEnv = append(childEnv, kv)
+		}
+	}
+
+	return append(childEnv, env...)
+}
+
 func LogShellCmd(cmdStrs []string, env []string) {
 	envLogStr := ""
 	if len(env) > 0 {
@@ -284,6 +339,20 @@ func ShellCommandLimitDbgOutput(
 	cmdStrs []string, env []string, logCmd bool, maxDbgOutputChrs int) (
 	[]byte, error) {
 
+	return ShellCommandTimeout(cmdStrs, env, logCmd, maxDbgOutputChrs, 0)
+}
+
+// Execute the specified process and block until it completes or the specified
+// timeout elapses.  A process that is still running when the timeout elapses
+// is killed along with its descendants.  A timeout of 0 means wait
+// indefinitely.  Independently of the timeout, a process that is silent for
+// longer than HangTimeout is killed the same way.
+//
+// @return []byte               Combined stdout and stderr output of process.
+// @return error                NewtError on failure.
+func ShellCommandTimeout(cmdStrs []string, env []string, logCmd bool,
+	maxDbgOutputChrs int, timeout time.Duration) ([]byte, error) {
+
 	var name string
 	var args []string
 
@@ -302,11 +371,53 @@ func ShellCommandLimitDbgOutput(
 	cmd := exec.Command(name, args...)
 
 	if env != nil {
-		cmd.Env = append(env, os.Environ()...)
+		cmd.Env = ChildEnv(env)
 	}
 
-	o, err := cmd.CombinedOutput()
+	var b bytes.Buffer
+	wd := NewWatchdog(cmdStrs, HangTimeout)
+	cmd.Stdout = wd.Writer(&b)
+	cmd.Stderr = cmd.Stdout
 
+	if err := cmd.Start(); err != nil {
+		log.Debugf("err=%s", err.Error())
+		return nil, NewNewtError(err.Error())
+	}
+
+	wd.Watch(cmd.Process)
+	defer wd.Stop()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	// A nil channel never becomes ready.
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	var err error
+	select {
+	case err = <-done:
+		if wd.Fired() {
+			return nil, wd.Error()
+		}
+	case <-timeoutCh:
+		// Don't wait for the process to exit; a child that escapes the kill
+		// may keep the output pipe open.
+		KillProcessTree(cmd.Process)
+		log.Debugf("process timed out after %s", timeout.String())
+		return nil, FmtNewtError("Command timed out after %s: %s",
+			timeout.String(), strings.Join(cmdStrs, " "))
+	case <-wd.Hung():
+		return nil, wd.Error()
+	}
+
+	o := b.Bytes()
 	if maxDbgOutputChrs < 0 || len(o) <= maxDbgOutputChrs {
 		dbgStr := string(o)
 		log.Debugf("o=%s", dbgStr)
@@ -317,11 +428,17 @@ func ShellCommandLimitDbgOutput(
 
 	if err != nil {
 		log.Debugf("err=%s", err.Error())
+
+		// Keep the underlying error so that callers can inspect the exit
+		// status.
+		var nerr *NewtError
 		if len(o) > 0 {
-			return o, NewNewtError(string(o))
+			nerr = NewNewtError(string(o))
 		} else {
-			return o, NewNewtError(err.Error())
+			nerr = NewNewtError(err.Error())
 		}
+		nerr.Parent = err
+		return o, nerr
 	} else {
 		return o, nil
 	}
@@ -356,7 +473,7 @@ func ShellInteractiveCommand(cmdStr []string, env []string) error {
 	}()
 
 	if env != nil {
-		env = append(env, os.Environ()...)
+		env = ChildEnv(env)
 	}
 
 	// Transfer stdin, stdout, and stderr to the new process
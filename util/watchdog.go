@@ -0,0 +1,245 @@
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// The period of silence after which a spawned command is considered hung.  A
+// command that produces no output on stdout or stderr for this long is killed
+// along with all of its descendants.  0 disables the watchdog.
+var HangTimeout time.Duration
+
+// The number of bytes of a command's most recent output that are included in
+// a hang report.
+const WATCHDOG_TAIL_LEN = 1024
+
+// Output that indicates a command is waiting for the user to enter
+// credentials.
+var credentialPromptRe = regexp.MustCompile(
+	`(?i)(username|password|passphrase|credentials)[^\n]*:\s*$`)
+
+// Supervises a spawned process.  Every write to the writer returned by
+// `Writer()` counts as activity; if the process is silent for longer than the
+// timeout, the watchdog records diagnostics and kills the process tree.
+//
+// Usage:
+//     wd := NewWatchdog(cmdStrs, HangTimeout)
+//     cmd.Stdout = wd.Writer(&buf)
+//     cmd.Stderr = cmd.Stdout
+//     cmd.Start()
+//     wd.Watch(cmd.Process)
+//     err := cmd.Wait()
+//     wd.Stop()
+//     if wd.Fired() { ... wd.Error() ... }
+type Watchdog struct {
+	cmdStrs []string
+	timeout time.Duration
+
+	mtx      sync.Mutex
+	lastTime time.Time
+	tail     []byte
+	report   string
+
+	hung chan struct{}
+	stop chan struct{}
+}
+
+type watchdogWriter struct {
+	wd *Watchdog
+	w  io.Writer
+}
+
+// Creates a watchdog for the specified command.  A timeout of 0 yields a
+// watchdog that never fires.
+func NewWatchdog(cmdStrs []string, timeout time.Duration) *Watchdog {
+	return &Watchdog{
+		cmdStrs:  cmdStrs,
+		timeout:  timeout,
+		lastTime: time.Now(),
+		hung:     make(chan struct{}),
+		stop:     make(chan struct{}),
+	}
+}
+
+func (ww *watchdogWriter) Write(p []byte) (int, error) {
+	ww.wd.activity(p)
+	return ww.w.Write(p)
+}
+
+// Wraps a writer such that everything written to it counts as activity.  The
+// same returned writer should be used for both stdout and stderr.
+func (wd *Watchdog) Writer(w io.Writer) io.Writer {
+	return &watchdogWriter{wd: wd, w: w}
+}
+
+func (wd *Watchdog) activity(p []byte) {
+	wd.mtx.Lock()
+	defer wd.mtx.Unlock()
+
+	wd.lastTime = time.Now()
+	wd.tail = append(wd.tail, p...)
+	if len(wd.tail) > WATCHDOG_TAIL_LEN {
+		wd.tail = wd.tail[len(wd.tail)-WATCHDOG_TAIL_LEN:]
+	}
+}
+
+// Starts supervising the specified process.  The watchdog runs until the
+// process is killed or `Stop()` is called.
+func (wd *Watchdog) Watch(proc *os.Process) {
+	if wd.timeout <= 0 {
+		return
+	}
+
+	wd.mtx.Lock()
+	wd.lastTime = time.Now()
+	wd.mtx.Unlock()
+
+	go func() {
+		timer := time.NewTimer(wd.timeout)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-wd.stop:
+				return
+
+			case <-timer.C:
+				wd.mtx.Lock()
+				idle := time.Since(wd.lastTime)
+				wd.mtx.Unlock()
+
+				if idle < wd.timeout {
+					timer.Reset(wd.timeout - idle)
+					continue
+				}
+
+				wd.fire(proc)
+				return
+			}
+		}
+	}()
+}
+
+// Stops supervising the process.  Call this after the process exits.
+func (wd *Watchdog) Stop() {
+	select {
+	case <-wd.stop:
+	default:
+		close(wd.stop)
+	}
+}
+
+// Returns a channel that is closed when the watchdog kills a hung process.
+func (wd *Watchdog) Hung() <-chan struct{} {
+	return wd.hung
+}
+
+// Indicates whether the watchdog killed the process.
+func (wd *Watchdog) Fired() bool {
+	select {
+	case <-wd.hung:
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns an error containing the hang report, or nil if the watchdog did
+// not fire.
+func (wd *Watchdog) Error() error {
+	if !wd.Fired() {
+		return nil
+	}
+
+	wd.mtx.Lock()
+	defer wd.mtx.Unlock()
+
+	return NewNewtError(wd.report)
+}
+
+// Kills the specified process along with all of its descendants.  Killing
+// only the process would leave behind any children it spawned (e.g., the
+// helpers of a git fetch), which may hold its output pipes open.
+func KillProcessTree(proc *os.Process) {
+	killProcessTree(proc, processTree(proc.Pid))
+}
+
+// Records diagnostics for a hung process and kills it along with its
+// descendants.
+func (wd *Watchdog) fire(proc *os.Process) {
+	pids := processTree(proc.Pid)
+
+	wd.mtx.Lock()
+	tail := string(wd.tail)
+	wd.mtx.Unlock()
+
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, "Command produced no output for %s and was killed: "+
+		"%s\n", wd.timeout.String(), strings.Join(wd.cmdStrs, " "))
+
+	if strings.TrimSpace(tail) != "" {
+		fmt.Fprintf(&buf, "Last output:\n%s\n",
+			indentLines(strings.TrimRight(tail, "\n"), "    "))
+	}
+
+	if diag := processDiagnostics(pids); diag != "" {
+		fmt.Fprintf(&buf, "Process tree:\n%s\n",
+			indentLines(strings.TrimRight(diag, "\n"), "    "))
+	}
+
+	if credentialPromptRe.MatchString(tail) {
+		fmt.Fprintf(&buf, "The command appears to be waiting for "+
+			"credentials; configure a credential helper or key so that it "+
+			"can run non-interactively.\n")
+	}
+
+	report := strings.TrimRight(buf.String(), "\n")
+	log.Debugf("%s", report)
+
+	wd.mtx.Lock()
+	wd.report = report
+	wd.mtx.Unlock()
+
+	// Signal the hang before killing the process so that anyone waiting on
+	// the process sees it.
+	close(wd.hung)
+
+	killProcessTree(proc, pids)
+}
+
+func indentLines(s string, indent string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = indent + line
+	}
+
+	return strings.Join(lines, "\n")
+}
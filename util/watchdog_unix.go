@@ -0,0 +1,95 @@
+// +build !windows
+
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Returns the specified process and all of its descendants, parents first.
+// Descendants can only be discovered if `ps` is available.
+func processTree(pid int) []int {
+	pids := []int{pid}
+
+	out, err := exec.Command("ps", "-A", "-o", "pid=", "-o", "ppid=").Output()
+	if err != nil {
+		return pids
+	}
+
+	children := map[int][]int{}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		child, err1 := strconv.Atoi(fields[0])
+		parent, err2 := strconv.Atoi(fields[1])
+		if err1 == nil && err2 == nil {
+			children[parent] = append(children[parent], child)
+		}
+	}
+
+	for i := 0; i < len(pids); i++ {
+		pids = append(pids, children[pids[i]]...)
+	}
+
+	return pids
+}
+
+// Describes the state of each of the specified processes: a `ps` listing,
+// followed by each process's kernel stack where the system exposes it.
+func processDiagnostics(pids []int) string {
+	pidStrs := make([]string, len(pids))
+	for i, pid := range pids {
+		pidStrs[i] = strconv.Itoa(pid)
+	}
+
+	out, _ := exec.Command("ps", "-o", "pid,ppid,stat,etime,wchan,args",
+		"-p", strings.Join(pidStrs, ",")).Output()
+	s := string(out)
+
+	for _, pid := range pidStrs {
+		stack, err := ioutil.ReadFile("/proc/" + pid + "/stack")
+		if err == nil && len(stack) > 0 {
+			s += "Kernel stack of " + pid + ":\n" + string(stack)
+		}
+	}
+
+	return s
+}
+
+// Kills the specified processes.  Descendants are stopped first so that they
+// can't spawn replacements while their parents are killed.
+func killProcessTree(proc *os.Process, pids []int) {
+	for _, pid := range pids[1:] {
+		syscall.Kill(pid, syscall.SIGSTOP)
+	}
+	proc.Kill()
+	for _, pid := range pids[1:] {
+		syscall.Kill(pid, syscall.SIGKILL)
+	}
+}
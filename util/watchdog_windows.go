@@ -0,0 +1,47 @@
+// +build windows
+
+/**
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *  http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package util
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// Windows identifies the tree by its root; taskkill finds the descendants.
+func processTree(pid int) []int {
+	return []int{pid}
+}
+
+func processDiagnostics(pids []int) string {
+	out, _ := exec.Command("tasklist", "/v", "/fi",
+		"PID eq "+strconv.Itoa(pids[0])).Output()
+	return string(out)
+}
+
+func killProcessTree(proc *os.Process, pids []int) {
+	err := exec.Command("taskkill", "/t", "/f", "/pid",
+		strconv.Itoa(proc.Pid)).Run()
+	if err != nil {
+		proc.Kill()
+	}
+}